@@ -0,0 +1,173 @@
+// Package authz decides whether an authenticated request may reach a handler.
+// It runs after the chain authenticator and reads the userauth.Identity that
+// whichever auth handler authenticated the request stored.
+//
+// Requirements are plain functions composed with RequireAll and RequireAny.
+// A request without an identity is answered with 401; an identity that does
+// not meet the requirement with 403.
+//
+// Groups that came with the credential (headerauth) are authoritative; for
+// every other identity they are looked up through Cfg.Groups, only when a
+// requirement asks for them. Scopes only narrow
+// scoped credentials (personal access tokens): a session or password login
+// acts with the user's full rights, so RequireAnyScope lets it through.
+package authz
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/go-bumbu/userauth"
+)
+
+// Principal is the identity of a request under evaluation.
+type Principal struct {
+	Identity userauth.Identity
+
+	groups      []string
+	groupsKnown bool
+	lookup      userauth.GroupsGetter
+}
+
+// Scoped reports whether the credential is limited to Identity.Scopes: it
+// is marked Scoped, or it is a token.
+func (p *Principal) Scoped() bool { return p.Identity.Scoped || p.Identity.TokenID != "" }
+
+// Groups returns the groups of the principal, looking them up on first use.
+func (p *Principal) Groups() ([]string, error) {
+	if p.groupsKnown {
+		return p.groups, nil
+	}
+	if p.Identity.Groups != nil {
+		p.groups, p.groupsKnown = p.Identity.Groups, true
+		return p.groups, nil
+	}
+	if p.lookup == nil {
+		return nil, nil
+	}
+	groups, err := p.lookup.GetGroups(p.Identity.UserID)
+	if err != nil {
+		return nil, err
+	}
+	p.groups, p.groupsKnown = groups, true
+	return groups, nil
+}
+
+// Requirement reports whether a principal may proceed. An error is an
+// internal failure, e.g. the group lookup failing.
+type Requirement func(p *Principal) (bool, error)
+
+// RequireGroup is met when the principal belongs to group.
+func RequireGroup(group string) Requirement {
+	return func(p *Principal) (bool, error) {
+		groups, err := p.Groups()
+		if err != nil {
+			return false, err
+		}
+		return slices.Contains(groups, group), nil
+	}
+}
+
+// RequireAnyScope is met when a scoped principal holds at least one of the
+// scopes. Unscoped principals always meet it.
+func RequireAnyScope(scopes ...string) Requirement {
+	return func(p *Principal) (bool, error) {
+		if !p.Scoped() {
+			return true, nil
+		}
+		for _, s := range scopes {
+			if slices.Contains(p.Identity.Scopes, s) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+// RequireAll is met when every requirement is; with none, any authenticated
+// request meets it.
+func RequireAll(reqs ...Requirement) Requirement {
+	return func(p *Principal) (bool, error) {
+		for _, req := range reqs {
+			if ok, err := req(p); !ok || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+}
+
+// RequireAny is met when at least one requirement is.
+func RequireAny(reqs ...Requirement) Requirement {
+	return func(p *Principal) (bool, error) {
+		for _, req := range reqs {
+			if ok, err := req(p); ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+}
+
+// ErrUnauthenticated is returned by Allowed when the request carries no
+// identity.
+var ErrUnauthenticated = errors.New("authz: request is not authenticated")
+
+// Cfg configures an Authorizer.
+type Cfg struct {
+	// Groups looks up group memberships for identities that do not carry
+	// their own (sessions, basic auth, tokens), e.g. userdb.Store. Without it
+	// those identities belong to no group.
+	Groups userauth.GroupsGetter
+	Logger *slog.Logger
+}
+
+// Authorizer checks requirements against the identity on a request.
+type Authorizer struct {
+	groups userauth.GroupsGetter
+	logger *slog.Logger
+}
+
+// New creates an Authorizer.
+func New(cfg Cfg) *Authorizer {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.DiscardHandler)
+	}
+	return &Authorizer{groups: cfg.Groups, logger: cfg.Logger}
+}
+
+// Allowed reports whether the request meets req. It returns
+// ErrUnauthenticated when the request carries no identity.
+func (a *Authorizer) Allowed(r *http.Request, req Requirement) (bool, error) {
+	id, ok := userauth.IdentityFromContext(r.Context())
+	if !ok {
+		return false, ErrUnauthenticated
+	}
+	return req(&Principal{Identity: id, lookup: a.groups})
+}
+
+// Middleware only lets requests that meet req through to next. Mount it
+// inside the chain authenticator's middleware, which stores the identity:
+//
+//	chainAuth.Middleware(az.Middleware(authz.RequireGroup("admin"))(next))
+func (a *Authorizer) Middleware(req Requirement) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, err := a.Allowed(r, req)
+			switch {
+			case errors.Is(err, ErrUnauthenticated):
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			case err != nil:
+				a.logger.Error("authz: evaluating requirement", "err", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			case !ok:
+				a.logger.Debug("authz: access denied", "path", r.URL.Path)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+			default:
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package authz_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-bumbu/userauth"
+	"github.com/go-bumbu/userauth/auth/authz"
+	"github.com/go-bumbu/userauth/auth/chain"
+	"github.com/go-bumbu/userauth/auth/headerauth"
+	"github.com/go-bumbu/userauth/auth/tokenauth"
+)
+
+// groupStore is a userauth.GroupsGetter that counts lookups.
+type groupStore struct {
+	groups  map[string][]string
+	err     error
+	lookups int
+}
+
+func (s *groupStore) GetGroups(userID string) ([]string, error) {
+	s.lookups++
+	return s.groups[userID], s.err
+}
+
+func as(id userauth.Identity) func(*http.Request) {
+	return func(r *http.Request) {
+		*r = *r.WithContext(userauth.ContextWithIdentity(r.Context(), id))
+	}
+}
+
+func asSession(userID string) func(*http.Request) {
+	return as(userauth.Identity{UserID: userID, Method: "sessionAuth"})
+}
+
+func asToken(userID string, scopes ...string) func(*http.Request) {
+	// like tokenauth: scoped, whether or not the verifier reports a token ID
+	return as(userauth.Identity{UserID: userID, Method: "tokenauth", Scopes: scopes, Scoped: true})
+}
+
+func asProxy(user string, groups ...string) func(*http.Request) {
+	if groups == nil {
+		groups = []string{}
+	}
+	return as(userauth.Identity{UserID: user, Method: "httpheader", Groups: groups})
+}
+
+func asBasic(userID string) func(*http.Request) {
+	return as(userauth.Identity{UserID: userID, Method: "basicauth"})
+}
+
+func TestMiddleware(t *testing.T) {
+	store := &groupStore{groups: map[string][]string{"ana": {"admin", "staff"}, "bob": {"staff"}}}
+	readOrAdmin := authz.RequireAll(
+		authz.RequireAnyScope("read", "admin"),
+		authz.RequireGroup("staff"),
+	)
+
+	tcs := []struct {
+		name     string
+		identity func(*http.Request)
+		req      authz.Requirement
+		want     int
+	}{
+		{name: "no identity", req: authz.RequireAll(), want: http.StatusUnauthorized},
+		{name: "any identity", identity: asSession("bob"), req: authz.RequireAll(), want: http.StatusOK},
+		{name: "session in group", identity: asSession("ana"), req: authz.RequireGroup("admin"), want: http.StatusOK},
+		{name: "session not in group", identity: asSession("bob"), req: authz.RequireGroup("admin"), want: http.StatusForbidden},
+		{name: "basic auth uses the store", identity: asBasic("ana"), req: authz.RequireGroup("admin"), want: http.StatusOK},
+		{name: "session is not scoped", identity: asSession("bob"), req: readOrAdmin, want: http.StatusOK},
+		{name: "token with a matching scope", identity: asToken("bob", "read"), req: readOrAdmin, want: http.StatusOK},
+		{name: "token without the scope", identity: asToken("bob", "write"), req: readOrAdmin, want: http.StatusForbidden},
+		{name: "token without scopes", identity: asToken("ana"), req: authz.RequireAnyScope("read"), want: http.StatusForbidden},
+		{name: "token scope does not grant groups", identity: asToken("nobody", "read"), req: readOrAdmin, want: http.StatusForbidden},
+		{name: "proxy groups", identity: asProxy("carol", "admin"), req: authz.RequireGroup("admin"), want: http.StatusOK},
+		{name: "proxy groups are authoritative", identity: asProxy("ana"), req: authz.RequireGroup("admin"), want: http.StatusForbidden},
+		{
+			name:     "any of",
+			identity: asSession("bob"),
+			req:      authz.RequireAny(authz.RequireGroup("admin"), authz.RequireGroup("staff")),
+			want:     http.StatusOK,
+		},
+		{
+			name:     "none of",
+			identity: asSession("bob"),
+			req:      authz.RequireAny(authz.RequireGroup("admin"), authz.RequireGroup("ops")),
+			want:     http.StatusForbidden,
+		},
+	}
+
+	az := authz.New(authz.Cfg{Groups: store})
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			h := az.Middleware(tc.req)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.identity != nil {
+				tc.identity(r)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tc.want {
+				t.Errorf("want status %d, got %d", tc.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestGroupLookup(t *testing.T) {
+	t.Run("looked up once and only when needed", func(t *testing.T) {
+		store := &groupStore{groups: map[string][]string{"ana": {"staff"}}}
+		az := authz.New(authz.Cfg{Groups: store})
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		asSession("ana")(r)
+
+		if _, err := az.Allowed(r, authz.RequireAnyScope("read")); err != nil {
+			t.Fatal(err)
+		}
+		if store.lookups != 0 {
+			t.Errorf("scope checks must not look up groups, got %d lookups", store.lookups)
+		}
+		ok, err := az.Allowed(r, authz.RequireAll(authz.RequireGroup("ops"), authz.RequireGroup("staff")))
+		if err != nil || ok {
+			t.Fatalf("want denied, got %v, %v", ok, err)
+		}
+		ok, err = az.Allowed(r, authz.RequireAny(authz.RequireGroup("ops"), authz.RequireGroup("staff")))
+		if err != nil || !ok {
+			t.Fatalf("want allowed, got %v, %v", ok, err)
+		}
+		if store.lookups != 2 {
+			t.Errorf("want one lookup per evaluation, got %d", store.lookups)
+		}
+	})
+
+	t.Run("without a store nobody is in a group", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		asSession("ana")(r)
+		ok, err := authz.New(authz.Cfg{}).Allowed(r, authz.RequireGroup("staff"))
+		if err != nil || ok {
+			t.Errorf("want denied, got %v, %v", ok, err)
+		}
+	})
+
+	t.Run("store failure is a 500", func(t *testing.T) {
+		az := authz.New(authz.Cfg{Groups: &groupStore{err: errors.New("db down")}})
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		asSession("ana")(r)
+		w := httptest.NewRecorder()
+		az.Middleware(authz.RequireGroup("staff"))(http.NotFoundHandler()).ServeHTTP(w, r)
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("want 500, got %d", w.Code)
+		}
+	})
+}
+
+type staticVerifier map[string]tokenauth.RequestData
+
+func (v staticVerifier) Verify(token string) (tokenauth.RequestData, bool, error) {
+	data, ok := v[token]
+	return data, ok, nil
+}
+
+func TestWithChain(t *testing.T) {
+	tokens, err := tokenauth.New(tokenauth.Cfg{Verifier: staticVerifier{
+		// custom verifiers need not report token IDs
+		"reader":   {UserID: "ana", Scopes: []string{"read"}},
+		"writer":   {UserID: "ana", Scopes: []string{"write"}},
+		"unscoped": {UserID: "ana"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := headerauth.New(headerauth.Cfg{ParseGroups: true})
+	auth := chain.New([]chain.AuthHandler{tokens, proxy}, nil, nil, nil)
+	az := authz.New(authz.Cfg{Groups: &groupStore{groups: map[string][]string{"ana": {"admin"}}}})
+
+	h := auth.Middleware(az.Middleware(authz.RequireAll(
+		authz.RequireGroup("admin"),
+		authz.RequireAnyScope("read"),
+	))(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {})))
+
+	tcs := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{name: "anonymous", want: http.StatusUnauthorized},
+		{name: "token with scope", headers: map[string]string{"Authorization": "Bearer reader"}, want: http.StatusOK},
+		{name: "token without scope", headers: map[string]string{"Authorization": "Bearer writer"}, want: http.StatusForbidden},
+		{name: "token with no scopes", headers: map[string]string{"Authorization": "Bearer unscoped"}, want: http.StatusForbidden},
+		{name: "proxy admin", headers: map[string]string{headerauth.UserAuthHeader: "bob", headerauth.GroupsAuthHeader: "admin"}, want: http.StatusOK},
+		{name: "proxy user", headers: map[string]string{headerauth.UserAuthHeader: "bob", headerauth.GroupsAuthHeader: "users"}, want: http.StatusForbidden},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tc.want {
+				t.Errorf("want status %d, got %d", tc.want, w.Code)
+			}
+		})
+	}
+}
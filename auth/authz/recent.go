@@ -0,0 +1,60 @@
+package authz
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-bumbu/userauth"
+)
+
+// RecentAuth reports whether id proved its credentials within maxAge, with
+// every one of methods when given. Token identities never qualify: a token
+// is a standing credential, not a fresh proof.
+func RecentAuth(id userauth.Identity, maxAge time.Duration, methods ...string) bool {
+	if id.Scoped || id.TokenID != "" || id.AuthTime.IsZero() || time.Since(id.AuthTime) > maxAge {
+		return false
+	}
+	for _, m := range methods {
+		if !slices.Contains(id.Methods, m) {
+			return false
+		}
+	}
+	return true
+}
+
+// ReauthResponse is the 401 body of RequireRecentAuth: what a client must
+// prove again, e.g. through login.Flow.Reauthenticate.
+type ReauthResponse struct {
+	Error   string   `json:"error"`
+	MaxAge  int      `json:"maxAge"` // seconds
+	Methods []string `json:"methods,omitempty"`
+}
+
+// RequireRecentAuth guards sensitive operations (deleting the account,
+// minting a token, disabling TOTP) with a step-up: the identity must have
+// authenticated within maxAge, with all of methods. Requests without an
+// identity get a plain 401; stale ones a 401 ReauthResponse.
+func RequireRecentAuth(maxAge time.Duration, methods ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, ok := userauth.IdentityFromContext(r.Context())
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if !RecentAuth(id, maxAge, methods...) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				_ = json.NewEncoder(w).Encode(ReauthResponse{
+					Error:   "reauthentication required",
+					MaxAge:  int(maxAge / time.Second),
+					Methods: methods,
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package authz_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-bumbu/userauth"
+	"github.com/go-bumbu/userauth/auth/authz"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRequireRecentAuth(t *testing.T) {
+	now := time.Now()
+	tcs := []struct {
+		name     string
+		identity func(*http.Request)
+		methods  []string
+		want     int
+	}{
+		{name: "no identity", want: http.StatusUnauthorized},
+		{
+			name:     "fresh session",
+			identity: as(userauth.Identity{UserID: "ana", AuthTime: now.Add(-time.Minute), Methods: []string{"password"}}),
+			want:     http.StatusOK,
+		},
+		{
+			name:     "stale session",
+			identity: as(userauth.Identity{UserID: "ana", AuthTime: now.Add(-time.Hour), Methods: []string{"password", "totp"}}),
+			want:     http.StatusUnauthorized,
+		},
+		{
+			name:     "fresh, with the required method",
+			identity: as(userauth.Identity{UserID: "ana", AuthTime: now, Methods: []string{"password", "totp"}}),
+			methods:  []string{"totp"},
+			want:     http.StatusOK,
+		},
+		{
+			name:     "fresh, missing the required method",
+			identity: as(userauth.Identity{UserID: "ana", AuthTime: now, Methods: []string{"password"}}),
+			methods:  []string{"totp"},
+			want:     http.StatusUnauthorized,
+		},
+		{
+			name:     "unknown auth time",
+			identity: as(userauth.Identity{UserID: "ana"}),
+			want:     http.StatusUnauthorized,
+		},
+		{
+			name:     "tokens never count as recent",
+			identity: as(userauth.Identity{UserID: "ana", TokenID: "t1", AuthTime: now}),
+			want:     http.StatusUnauthorized,
+		},
+		{
+			name:     "scoped credentials never count as recent",
+			identity: as(userauth.Identity{UserID: "ana", Scoped: true, AuthTime: now}),
+			want:     http.StatusUnauthorized,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			h := authz.RequireRecentAuth(5*time.Minute, tc.methods...)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+			r := httptest.NewRequest(http.MethodPost, "/account/delete", nil)
+			if tc.identity != nil {
+				tc.identity(r)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tc.want {
+				t.Fatalf("want status %d, got %d", tc.want, w.Code)
+			}
+			if w.Code != http.StatusUnauthorized || tc.identity == nil {
+				return
+			}
+			var got authz.ReauthResponse
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			want := authz.ReauthResponse{Error: "reauthentication required", MaxAge: 300, Methods: tc.methods}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("body (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/go-bumbu/userauth"
+	"github.com/go-bumbu/userauth/auth/chain"
 	"github.com/go-bumbu/userauth/internal/hashutil"
 	"github.com/go-bumbu/userauth/service/throttle"
 	throttlememory "github.com/go-bumbu/userauth/service/throttle/store/memory"
@@ -84,71 +86,97 @@ func (auth *AuthHandler) handleAuth(w http.ResponseWriter, r *http.Request) (log
 	loggedIn = false
 	if ok {
 		var err error
-		loggedIn, err = auth.verify(username, password)
+		var userID string
+		loggedIn, userID, err = auth.verify(username, password)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Error while checking user login: %v", err), http.StatusInternalServerError)
 			return
 		}
+		if loggedIn {
+			*r = *r.WithContext(userauth.ContextWithIdentity(r.Context(), userauth.Identity{
+				UserID:   userID,
+				LoginID:  username,
+				Method:   basicAuthName,
+				AuthTime: time.Now(),
+				Methods:  []string{"password"},
+			}))
+		}
 	}
 	if auth.enforce {
-		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s", charset="UTF-8"`, auth.message))
+		w.Header().Set("WWW-Authenticate", auth.challenge())
 	}
 	return
 }
 
+// Challenge implements chain.Challenger. Only an enforcing handler
+// challenges: without Enforce, browsers must never be prompted.
+func (auth *AuthHandler) Challenge(_ *http.Request) string {
+	if !auth.enforce {
+		return ""
+	}
+	return auth.challenge()
+}
+
+// Verify chain.Challenger at compile time.
+var _ chain.Challenger = (*AuthHandler)(nil)
+
+func (auth *AuthHandler) challenge() string {
+	return fmt.Sprintf(`Basic realm="%s", charset="UTF-8"`, auth.message)
+}
+
 // throttleKey namespaces this handler's entries in a shared throttle store.
 const throttleKey = "basicauth"
 
 // verify checks the credentials against the user store under the backoff
 // throttle. Unknown user, disabled user, wrong password, a malformed stored
 // hash and a throttled request are all credential failures (false, nil); an
-// error is an internal store failure.
-func (auth *AuthHandler) verify(username, password string) (bool, error) {
+// error is an internal store failure. On success it returns the user ID.
+func (auth *AuthHandler) verify(username, password string) (bool, string, error) {
 	if auth.throttle != nil {
 		allowed, err := auth.throttle.Allow(username, throttleKey)
 		if err != nil {
-			return false, err
+			return false, "", err
 		}
 		if !allowed {
 			auth.logger.Debug("throttled", "username", username)
-			return false, nil
+			return false, "", nil
 		}
 	}
-	ok, err := auth.checkCredentials(username, password)
+	userID, ok, err := auth.checkCredentials(username, password)
 	if err != nil || auth.throttle == nil {
-		return ok, err
+		return ok, userID, err
 	}
 	if !ok {
 		if err := auth.throttle.Fail(username, throttleKey); err != nil {
-			return false, err
+			return false, "", err
 		}
-		return false, nil
+		return false, "", nil
 	}
 	if err := auth.throttle.Success(username, throttleKey); err != nil {
-		return false, err
+		return false, "", err
 	}
-	return true, nil
+	return true, userID, nil
 }
 
 // checkCredentials is the throttle-free credential check. Unknown user,
 // disabled user, wrong password and a malformed stored hash are all
 // credential failures (false, nil); an error is an internal store failure.
-func (auth *AuthHandler) checkCredentials(username, password string) (bool, error) {
+func (auth *AuthHandler) checkCredentials(username, password string) (string, bool, error) {
 	user, err := auth.users.GetUserByLogin(username)
 	if err != nil {
 		if errors.Is(err, userauth.ErrUserNotFound) || errors.Is(err, userauth.ErrUserDisabled) {
-			return false, nil
+			return "", false, nil
 		}
-		return false, err
+		return "", false, err
 	}
 	if !user.Enabled {
-		return false, nil
+		return "", false, nil
 	}
 	ok, err := hashutil.VerifyPassword(password, user.HashPw)
-	if err != nil {
-		return false, nil
+	if err != nil || !ok {
+		return "", false, nil
 	}
-	return ok, nil
+	return user.ID, true, nil
 }
 
 func (auth *AuthHandler) Middleware(next http.Handler) http.Handler {
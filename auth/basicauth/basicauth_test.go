@@ -307,6 +307,21 @@ func TestHandleAuth(t *testing.T) {
 			if gotHeader != tc.wantAuthHeader {
 				t.Errorf("expected WWW-Authenticate header presence: %v, got: %v", tc.wantAuthHeader, gotHeader)
 			}
+			id, ok := userauth.IdentityFromContext(tc.request.Context())
+			if ok != tc.wantLoggedIn || (ok && (id.UserID != "admin" || id.LoginID != "admin" || id.Method != "basicauth")) {
+				t.Errorf("unexpected identity %+v (present: %v)", id, ok)
+			}
 		})
 	}
 }
+
+func TestChallenge(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if got := basicauth.NewHandler(dummyUser{}, "", false, nil).Challenge(r); got != "" {
+		t.Errorf("a non-enforcing handler must not prompt, got %q", got)
+	}
+	want := `Basic realm="app", charset="UTF-8"`
+	if got := basicauth.NewHandler(dummyUser{}, "app", true, nil).Challenge(r); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
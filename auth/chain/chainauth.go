@@ -1,9 +1,12 @@
 package chain
 
 import (
+	"encoding/json"
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
 	"strings"
 )
 
@@ -13,38 +16,105 @@ type AuthHandler interface {
 	HandleAuth(w http.ResponseWriter, r *http.Request) (allowAccess, stopEvaluation bool)
 }
 
+// Challenger is implemented by auth handlers that can tell a client how to
+// authenticate. On a 401 the chain sends every non-empty challenge as a
+// WWW-Authenticate header, e.g. `Basic realm="app"` or `Bearer`.
+type Challenger interface {
+	Challenge(r *http.Request) string
+}
+
+// Decision is the outcome of evaluating the chain for one request.
+type Decision struct {
+	Allowed bool
+	// Handler is the Name() of the handler that allowed access or stopped
+	// evaluation; empty when every handler fell through.
+	Handler string
+}
+
 type callback func(w http.ResponseWriter, r *http.Request)
 
+// DefaultReturnParam is the query parameter carrying the return-to URL when
+// browsers are redirected to the login page. The login form transport
+// (flow/login/handlers/form) reads the same parameter.
+const DefaultReturnParam = "return_to"
+
+// Cfg configures an Authenticator.
+type Cfg struct {
+	Handlers []AuthHandler
+	Logger   *slog.Logger
+	// LoginURL, when set, is where unauthenticated browser requests (GET or
+	// HEAD accepting text/html) are redirected, with the requested path in
+	// ReturnParam. Other clients get a 401 JSON error.
+	LoginURL string
+	// ReturnParam names the return-to query parameter; defaults to
+	// DefaultReturnParam.
+	ReturnParam string
+	// OnDecision, if set, is called with every decision, e.g. for access
+	// logs or metrics.
+	OnDecision func(r *http.Request, d Decision)
+	// Unauthorized replaces the built-in 401 response entirely.
+	Unauthorized func(w http.ResponseWriter, r *http.Request)
+	// Authorized is called after the protected handler served the request.
+	Authorized func(w http.ResponseWriter, r *http.Request)
+}
+
 type Authenticator struct {
 	handlers             []AuthHandler
 	Logger               *slog.Logger
 	unauthorizedCallback callback
 	authorizedCallback   callback
+	loginURL             string
+	returnParam          string
+	onDecision           func(r *http.Request, d Decision)
 }
 
 func New(handlers []AuthHandler, l *slog.Logger, unAuthCallback, authCallback callback) *Authenticator {
-	logger := l
+	return NewFromCfg(Cfg{Handlers: handlers, Logger: l, Unauthorized: unAuthCallback, Authorized: authCallback})
+}
+
+// NewFromCfg creates an Authenticator from the config.
+func NewFromCfg(cfg Cfg) *Authenticator {
+	logger := cfg.Logger
 	if logger == nil {
 		logger = slog.New(slog.NewJSONHandler(io.Discard, nil))
 	}
+	if cfg.ReturnParam == "" {
+		cfg.ReturnParam = DefaultReturnParam
+	}
 
 	n := []string{}
-	for _, h := range handlers {
+	for _, h := range cfg.Handlers {
 		n = append(n, h.Name())
 	}
 	logger.Info("configuring authenticator", slog.String("handlers", strings.Join(n, ",")))
 
 	a := Authenticator{
-		handlers:             handlers,
+		handlers:             cfg.Handlers,
 		Logger:               logger,
-		unauthorizedCallback: unAuthCallback,
-		authorizedCallback:   authCallback,
+		unauthorizedCallback: cfg.Unauthorized,
+		authorizedCallback:   cfg.Authorized,
+		loginURL:             cfg.LoginURL,
+		returnParam:          cfg.ReturnParam,
+		onDecision:           cfg.OnDecision,
 	}
 	return &a
 }
 
 func (a *Authenticator) EvalAuth(w http.ResponseWriter, r *http.Request) bool {
+	return a.Evaluate(w, r).Allowed
+}
+
+// Evaluate runs the handlers in order and reports which one decided.
+func (a *Authenticator) Evaluate(w http.ResponseWriter, r *http.Request) Decision {
+	d := a.evaluate(w, r)
+	a.Logger.Debug("auth decision", slog.Bool("allowed", d.Allowed), slog.String("handler", d.Handler))
+	if a.onDecision != nil {
+		a.onDecision(r, d)
+	}
+	return d
+}
 
+func (a *Authenticator) evaluate(w http.ResponseWriter, r *http.Request) Decision {
 	for _, authHandler := range a.handlers {
 		a.Logger.Debug("evaluating auth handler", slog.String("name", authHandler.Name()))
 		ok, breakEval := authHandler.HandleAuth(w, r)
@@ -52,13 +122,13 @@ func (a *Authenticator) EvalAuth(w http.ResponseWriter, r *http.Request) bool {
 			slog.Bool("isAuthenticated", ok), slog.Bool("breakEvaluation", breakEval),
 		)
 		if ok {
-			return true
+			return Decision{Allowed: true, Handler: authHandler.Name()}
 		}
 		if breakEval {
-			break
+			return Decision{Handler: authHandler.Name()}
 		}
 	}
-	return false
+	return Decision{}
 }
 
 func (a *Authenticator) Middleware(next http.Handler) http.Handler {
@@ -75,8 +145,77 @@ func (a *Authenticator) Middleware(next http.Handler) http.Handler {
 				a.unauthorizedCallback(w, r)
 				return
 			}
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			a.unauthorized(w, r)
 		}
 
 	})
 }
+
+// unauthorized answers by client: browsers go to the login page, API
+// clients get the challenges and a JSON error.
+func (a *Authenticator) unauthorized(w http.ResponseWriter, r *http.Request) {
+	browser := isBrowser(r)
+	if browser && a.loginURL != "" {
+		http.Redirect(w, r, a.loginRedirect(r), http.StatusSeeOther)
+		return
+	}
+	for _, h := range a.handlers {
+		c, ok := h.(Challenger)
+		if !ok {
+			continue
+		}
+		if ch := c.Challenge(r); ch != "" && !slices.Contains(w.Header().Values("WWW-Authenticate"), ch) {
+			w.Header().Add("WWW-Authenticate", ch)
+		}
+	}
+	if browser {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+}
+
+func (a *Authenticator) loginRedirect(r *http.Request) string {
+	target, err := url.Parse(a.loginURL)
+	if err != nil {
+		return a.loginURL
+	}
+	// r.RequestURI is the path the client asked for, before any prefix
+	// stripping by the router
+	back := r.RequestURI
+	if back == "" {
+		back = r.URL.RequestURI()
+	}
+	if IsSafeReturnTo(back) {
+		q := target.Query()
+		q.Set(a.returnParam, back)
+		target.RawQuery = q.Encode()
+	}
+	return target.String()
+}
+
+// isBrowser reports whether the request is a page navigation, which can
+// follow a redirect to a login page.
+func isBrowser(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// IsSafeReturnTo reports whether target is a local path that is safe to
+// redirect to after login: it must start with a single "/" and carry no
+// scheme or host. Login handlers should check the return-to parameter with
+// it before redirecting.
+func IsSafeReturnTo(target string) bool {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return false
+	}
+	if strings.ContainsFunc(target, func(r rune) bool { return r < 0x20 || r == 0x7f }) {
+		return false
+	}
+	u, err := url.Parse(target)
+	return err == nil && u.Scheme == "" && u.Host == ""
+}
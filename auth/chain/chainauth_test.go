@@ -3,10 +3,12 @@ package chain_test
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/go-bumbu/userauth/auth/chain"
+	"github.com/google/go-cmp/cmp"
 )
 
 var _ = spew.Dump
@@ -140,3 +142,174 @@ func TestMiddleware(t *testing.T) {
 		})
 	}
 }
+
+// challengingHandler is a MockAuthHandler that also implements chain.Challenger.
+type challengingHandler struct {
+	MockAuthHandler
+	challenge string
+}
+
+func (c *challengingHandler) Challenge(*http.Request) string { return c.challenge }
+
+func TestUnauthorizedResponse(t *testing.T) {
+	handlers := []chain.AuthHandler{
+		&MockAuthHandler{name: "session"},
+		&challengingHandler{MockAuthHandler: MockAuthHandler{name: "basic"}, challenge: `Basic realm="app"`},
+		&challengingHandler{MockAuthHandler: MockAuthHandler{name: "token"}, challenge: "Bearer"},
+		&challengingHandler{MockAuthHandler: MockAuthHandler{name: "quiet"}},
+	}
+
+	tcs := []struct {
+		name           string
+		cfg            chain.Cfg
+		method         string
+		target         string
+		accept         string
+		wantStatus     int
+		wantLocation   string
+		wantChallenges []string
+		wantJSON       bool
+	}{
+		{
+			name:           "api client gets challenges and json",
+			method:         http.MethodGet,
+			target:         "/api/items",
+			accept:         "application/json",
+			wantStatus:     http.StatusUnauthorized,
+			wantChallenges: []string{`Basic realm="app"`, "Bearer"},
+			wantJSON:       true,
+		},
+		{
+			name:         "browser is sent to the login page",
+			cfg:          chain.Cfg{LoginURL: "/login"},
+			method:       http.MethodGet,
+			target:       "/settings?tab=security",
+			accept:       "text/html,application/xhtml+xml,*/*;q=0.8",
+			wantStatus:   http.StatusSeeOther,
+			wantLocation: "/login?return_to=%2Fsettings%3Ftab%3Dsecurity",
+		},
+		{
+			name:         "login url keeps its query and custom param",
+			cfg:          chain.Cfg{LoginURL: "/auth?lang=de", ReturnParam: "back"},
+			method:       http.MethodGet,
+			target:       "/settings",
+			accept:       "text/html",
+			wantStatus:   http.StatusSeeOther,
+			wantLocation: "/auth?back=%2Fsettings&lang=de",
+		},
+		{
+			name:         "unsafe return path is dropped",
+			cfg:          chain.Cfg{LoginURL: "/login"},
+			method:       http.MethodGet,
+			target:       "//evil.example/x",
+			accept:       "text/html",
+			wantStatus:   http.StatusSeeOther,
+			wantLocation: "/login",
+		},
+		{
+			name:           "form post is not redirected",
+			cfg:            chain.Cfg{LoginURL: "/login"},
+			method:         http.MethodPost,
+			target:         "/settings",
+			accept:         "text/html",
+			wantStatus:     http.StatusUnauthorized,
+			wantChallenges: []string{`Basic realm="app"`, "Bearer"},
+			wantJSON:       true,
+		},
+		{
+			name:           "browser without login url gets a plain 401",
+			method:         http.MethodGet,
+			target:         "/",
+			accept:         "text/html",
+			wantStatus:     http.StatusUnauthorized,
+			wantChallenges: []string{`Basic realm="app"`, "Bearer"},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.Handlers = handlers
+			auth := chain.NewFromCfg(tc.cfg)
+			req := httptest.NewRequest(tc.method, tc.target, nil)
+			req.Header.Set("Accept", tc.accept)
+			rr := httptest.NewRecorder()
+			auth.Middleware(http.NotFoundHandler()).ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("want status %d, got %d", tc.wantStatus, rr.Code)
+			}
+			if got := rr.Header().Get("Location"); got != tc.wantLocation {
+				t.Errorf("want Location %q, got %q", tc.wantLocation, got)
+			}
+			if diff := cmp.Diff(tc.wantChallenges, rr.Header().Values("WWW-Authenticate")); diff != "" {
+				t.Errorf("challenges (-want +got):\n%s", diff)
+			}
+			isJSON := rr.Header().Get("Content-Type") == "application/json"
+			if isJSON != tc.wantJSON {
+				t.Errorf("want json %v, got content type %q", tc.wantJSON, rr.Header().Get("Content-Type"))
+			}
+			if isJSON && strings.TrimSpace(rr.Body.String()) != `{"error":"unauthorized"}` {
+				t.Errorf("unexpected body %q", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestDecision(t *testing.T) {
+	tcs := []struct {
+		name     string
+		handlers []chain.AuthHandler
+		want     chain.Decision
+	}{
+		{
+			name:     "allowing handler decides",
+			handlers: []chain.AuthHandler{&MockAuthHandler{name: "a"}, &MockAuthHandler{name: "b", loggedIn: true}},
+			want:     chain.Decision{Allowed: true, Handler: "b"},
+		},
+		{
+			name:     "stopping handler decides",
+			handlers: []chain.AuthHandler{&MockAuthHandler{name: "a", stopEval: true}, &MockAuthHandler{name: "b", loggedIn: true}},
+			want:     chain.Decision{Handler: "a"},
+		},
+		{
+			name:     "nobody decides when all fall through",
+			handlers: []chain.AuthHandler{&MockAuthHandler{name: "a"}},
+			want:     chain.Decision{},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var reported []chain.Decision
+			auth := chain.NewFromCfg(chain.Cfg{
+				Handlers:   tc.handlers,
+				OnDecision: func(_ *http.Request, d chain.Decision) { reported = append(reported, d) },
+			})
+			got := auth.Evaluate(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("decision (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff([]chain.Decision{tc.want}, reported); diff != "" {
+				t.Errorf("reported (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestIsSafeReturnTo(t *testing.T) {
+	tcs := map[string]bool{
+		"/":                      true,
+		"/settings?tab=a":        true,
+		"/a/b#frag":              true,
+		"":                       false,
+		"settings":               false,
+		"//evil.example":         false,
+		"/\\evil.example":        false,
+		"https://evil.example/":  false,
+		"/ok\r\nSet-Cookie: a=b": false,
+		"javascript:alert(1)":    false,
+	}
+	for target, want := range tcs {
+		if got := chain.IsSafeReturnTo(target); got != want {
+			t.Errorf("IsSafeReturnTo(%q) = %v, want %v", target, got, want)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/go-bumbu/userauth"
 	"github.com/go-bumbu/userauth/auth/chain"
 	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
@@ -100,6 +101,12 @@ func (m *Manager) HandleAuth(w http.ResponseWriter, r *http.Request) (allowAcces
 	if data.IsAuthenticated {
 		m.logger.Debug("session auth: user authenticated", "user", data.UserId)
 		CtxSetUserData(r, data)
+		*r = *r.WithContext(userauth.ContextWithIdentity(r.Context(), userauth.Identity{
+			UserID:   data.UserId,
+			Method:   SessionMngrName,
+			AuthTime: data.AuthTime,
+			Methods:  data.AMR,
+		}))
 		err = m.updateExpiry(data, session, r, w)
 		if err != nil {
 			m.logger.Debug("session auth: error updating session expiry", "user", data.UserId, "error", err)
@@ -132,17 +139,33 @@ var _ chain.AuthHandler = (*Manager)(nil)
 
 // LoginUser stores the user as logged-in in the session store.
 func (m *Manager) LoginUser(r *http.Request, w http.ResponseWriter, userID string, sessionRenew bool) error {
+	return m.LoginUserWithMethods(r, w, userID, sessionRenew, nil)
+}
+
+// LoginUserWithMethods is LoginUser recording the login methods the user
+// proved (SessionData.AMR); login.Flow calls it with the satisfied factors.
+func (m *Manager) LoginUserWithMethods(r *http.Request, w http.ResponseWriter, userID string, sessionRenew bool, methods []string) error {
+	return m.LoginUserWithDevice(r, w, userID, sessionRenew, methods, "")
+}
+
+// LoginUserWithDevice is LoginUserWithMethods also recording the trusted
+// device the user logged in from (UserData.DeviceID). It implements
+// login.DeviceLogin.
+func (m *Manager) LoginUserWithDevice(r *http.Request, w http.ResponseWriter, userID string, sessionRenew bool, methods []string, deviceID string) error {
 	if !m.allowRenew {
 		sessionRenew = false
 	}
 	authData := SessionData{
 		UserData: UserData{
 			UserId:          userID,
+			DeviceID:        deviceID,
 			IsAuthenticated: true,
 		},
 		RenewExpiration: sessionRenew,
 		Expiration:      time.Now().Add(m.sessionDur),
 		ForceReAuth:     time.Now().Add(m.maxSessionDur),
+		AuthTime:        time.Now(),
+		AMR:             methods,
 	}
 	session, err := m.Get(r, m.cookieName)
 	if err != nil {
@@ -154,10 +177,32 @@ func (m *Manager) LoginUser(r *http.Request, w http.ResponseWriter, userID strin
 		"sessionDur", m.sessionDur,
 		"maxSessionDur", m.maxSessionDur,
 		"renewExpiration", sessionRenew,
+		"device", deviceID,
 	)
 	return m.write(r, w, session, authData)
 }
 
+// ErrNoSession is returned by UpgradeSession when the request has no
+// authenticated session for the user.
+var ErrNoSession = errors.New("no authenticated session for the user")
+
+// UpgradeSession records a re-authentication in the user's current session:
+// AuthTime becomes now and AMR the methods just proven. Expiry windows, the
+// renew flag and the CSRF token are kept. It implements login.SessionUpgrader.
+func (m *Manager) UpgradeSession(r *http.Request, w http.ResponseWriter, userID string, methods []string) error {
+	data, session, err := m.read(r)
+	if err != nil {
+		return err
+	}
+	if session == nil || !data.IsAuthenticated || data.UserId != userID {
+		return ErrNoSession
+	}
+	data.AuthTime = time.Now()
+	data.AMR = methods
+	m.logger.Debug("session upgraded", "user", userID, "amr", methods)
+	return m.write(r, w, session, data)
+}
+
 // Get returns the session from the store, or a new session on cookie decode errors.
 func (m *Manager) Get(r *http.Request, name string) (*sessions.Session, error) {
 	session, err := m.store.Get(r, name)
@@ -252,7 +297,9 @@ func (m *Manager) read(r *http.Request) (SessionData, *sessions.Session, error)
 
 // UserData holds identity and auth state for the current request.
 type UserData struct {
-	UserId          string
+	UserId string
+	// DeviceID is the trusted device (service/trusteddevice) the session was
+	// created from; empty when the browser was not trusted at login.
 	DeviceID        string
 	IsAuthenticated bool
 }
@@ -264,6 +311,12 @@ type SessionData struct {
 	RenewExpiration bool
 	ForceReAuth     time.Time
 	LastUpdate      time.Time
+	// AuthTime is when LoginUser created the session or UpgradeSession last
+	// re-authenticated it; AMR lists the login methods proven then.
+	AuthTime time.Time
+	AMR      []string
+	// CSRFToken is the session's anti-CSRF token; see Manager.CSRFToken.
+	CSRFToken string
 }
 
 // Verify updates IsAuthenticated based on expiration and force-reauth times.
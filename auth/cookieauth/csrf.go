@@ -0,0 +1,41 @@
+package cookieauth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+)
+
+// CSRFToken returns the anti-CSRF token bound to the request's session,
+// creating one (and the session cookie, for anonymous visitors) when the
+// session has none. LoginUser and LogoutUser start a fresh session without
+// a token, so clients fetch a new one after either. Manager satisfies
+// csrf.Sessions with this and SessionCSRFToken.
+func (m *Manager) CSRFToken(r *http.Request, w http.ResponseWriter) (string, error) {
+	data, session, err := m.read(r)
+	if err != nil {
+		return "", err
+	}
+	if data.CSRFToken != "" {
+		return data.CSRFToken, nil
+	}
+	if session == nil {
+		if session, err = m.Get(r, m.cookieName); err != nil {
+			return "", err
+		}
+	}
+	b := make([]byte, 32)
+	_, _ = rand.Read(b) // never fails, see crypto/rand
+	data.CSRFToken = base64.RawURLEncoding.EncodeToString(b)
+	if err := m.write(r, w, session, data); err != nil {
+		return "", err
+	}
+	return data.CSRFToken, nil
+}
+
+// SessionCSRFToken returns the session's anti-CSRF token without creating
+// one; empty when none was issued.
+func (m *Manager) SessionCSRFToken(r *http.Request) (string, error) {
+	data, _, err := m.read(r)
+	return data.CSRFToken, err
+}
@@ -0,0 +1,63 @@
+package cookieauth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-bumbu/userauth/auth/cookieauth"
+)
+
+func TestCSRFToken(t *testing.T) {
+	m := newManager(t, cookieauth.Cfg{})
+
+	// an anonymous visitor gets a token and a session cookie to hold it
+	rec := httptest.NewRecorder()
+	token, err := m.CSRFToken(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(token) < 40 {
+		t.Fatalf("token too short: %q", token)
+	}
+	req := withCookies(rec)
+
+	got, err := m.SessionCSRFToken(req)
+	if err != nil || got != token {
+		t.Fatalf("SessionCSRFToken = %q, %v; want %q", got, err, token)
+	}
+	again, err := m.CSRFToken(req, httptest.NewRecorder())
+	if err != nil || again != token {
+		t.Errorf("an existing token must be reused, got %q (%v)", again, err)
+	}
+
+	// logging in replaces the session, and with it the token
+	rec = httptest.NewRecorder()
+	if err := m.LoginUser(req, rec, "alice", false); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.SessionCSRFToken(withCookies(rec)); got != "" {
+		t.Errorf("login must rotate the token, still have %q", got)
+	}
+	fresh, err := m.CSRFToken(withCookies(rec), httptest.NewRecorder())
+	if err != nil || fresh == token {
+		t.Errorf("want a new token after login, got %q (%v)", fresh, err)
+	}
+}
+
+func TestSessionCSRFToken_NoSession(t *testing.T) {
+	m := newManager(t, cookieauth.Cfg{})
+	got, err := m.SessionCSRFToken(httptest.NewRequest(http.MethodPost, "/", nil))
+	if err != nil || got != "" {
+		t.Errorf("got %q, %v; want no token", got, err)
+	}
+}
+
+// withCookies returns a request carrying the cookies set on rec.
+func withCookies(rec *httptest.ResponseRecorder) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	for _, c := range (&http.Response{Header: rec.Header()}).Cookies() {
+		req.AddCookie(c)
+	}
+	return req
+}
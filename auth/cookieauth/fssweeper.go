@@ -0,0 +1,79 @@
+package cookieauth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultFsSweepAge is the FsSweeper default: the Manager's default
+// MaxSessionDur, after which every session forces a new login anyway.
+const DefaultFsSweepAge = 24 * time.Hour
+
+// FsSweeper removes abandoned session files from the directory of a
+// sessions.FilesystemStore (see NewFsStore). gorilla/sessions writes one
+// "session_<id>" file per session and never deletes a file whose cookie
+// simply expired, so without a sweeper the directory grows forever.
+//
+// A file is removed once it has not been written for MaxAge. A file
+// untouched for the Manager's MaxSessionDur holds a session the Manager
+// would reject, so MaxAge should be at least that — and at least the
+// lifetime of anything else keeping sessions in the same store. FsSweeper
+// implements userauth.Sweeper.
+type FsSweeper struct {
+	// Path is the directory given to NewFsStore. Required: gorilla's
+	// fallback for an empty path is the shared temp dir, which is not
+	// ours to sweep.
+	Path   string
+	MaxAge time.Duration // default DefaultFsSweepAge
+}
+
+const fsSessionPrefix = "session_"
+
+// Sweep removes session files older than MaxAge. Files that vanish during
+// the sweep (a concurrent logout) are not errors.
+func (s FsSweeper) Sweep(ctx context.Context) (int, error) {
+	if s.Path == "" {
+		return 0, errors.New("cookieauth: FsSweeper requires a Path")
+	}
+	maxAge := s.MaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultFsSweepAge
+	}
+	entries, err := os.ReadDir(s.Path)
+	if err != nil {
+		return 0, err
+	}
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+		if e.IsDir() || !strings.HasPrefix(e.Name(), fsSessionPrefix) {
+			continue
+		}
+		info, err := e.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return removed, err
+		}
+		if info.ModTime().After(cutoff) {
+			continue
+		}
+		err = os.Remove(filepath.Join(s.Path, e.Name()))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,74 @@
+package cookieauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-bumbu/userauth/auth/cookieauth"
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/securecookie"
+)
+
+func TestFsSweeper(t *testing.T) {
+	dir := t.TempDir()
+	store, err := cookieauth.NewFsStore(dir, securecookie.GenerateRandomKey(32), securecookie.GenerateRandomKey(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// two real sessions written by the store
+	for range 2 {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		sess, err := store.New(r, "s")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sess.Values["k"] = "v"
+		if err := sess.Save(r, httptest.NewRecorder()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "session_*"))
+	if len(files) != 2 {
+		t.Fatalf("want 2 session files, got %v", files)
+	}
+	// age one of them, and leave a stale file that is not a session
+	old := time.Now().Add(-48 * time.Hour)
+	other := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(other, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{files[0], other} {
+		if err := os.Chtimes(f, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := cookieauth.FsSweeper{Path: dir}.Sweep(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("removed %d files, want 1", n)
+	}
+	entries, _ := os.ReadDir(dir)
+	var left []string
+	for _, e := range entries {
+		left = append(left, e.Name())
+	}
+	sort.Strings(left)
+	want := []string{"notes.txt", filepath.Base(files[1])}
+	sort.Strings(want)
+	if diff := cmp.Diff(want, left); diff != "" {
+		t.Errorf("remaining files (-want +got):\n%s", diff)
+	}
+
+	if _, err := (cookieauth.FsSweeper{}).Sweep(context.Background()); err == nil {
+		t.Error("an empty Path must be rejected")
+	}
+}
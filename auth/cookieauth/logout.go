@@ -1,15 +1,27 @@
 package cookieauth
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/go-bumbu/userauth/auth/csrf"
+)
 
 // UserLogout destroys an existing session. Manager satisfies this implicitly.
 type UserLogout interface {
 	LogoutUser(r *http.Request, w http.ResponseWriter) error
 }
 
-// LogoutHandler returns an HTTP handler that destroys the session and optionally redirects.
-func LogoutHandler(LogOuter UserLogout, redirect string) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+// LogoutHandler returns the POST endpoint that destroys the session and optionally
+// redirects; other methods get 405. With protector set, the request must pass its CSRF
+// checks, so other sites cannot log users out; nil leaves that to the caller. Login
+// pages are better served by the login transports' LogoutHandler (flow/login/handlers
+// and its form package), which go through login.Flow.Logout.
+func LogoutHandler(LogOuter UserLogout, redirect string, protector *csrf.Protector) http.Handler {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
 		err := LogOuter.LogoutUser(r, w)
 		if err != nil {
@@ -20,4 +32,8 @@ func LogoutHandler(LogOuter UserLogout, redirect string) http.Handler {
 			http.Redirect(w, r, redirect, http.StatusSeeOther)
 		}
 	})
+	if protector == nil {
+		return h
+	}
+	return protector.Middleware(h)
 }
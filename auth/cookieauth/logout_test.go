@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/go-bumbu/userauth/auth/cookieauth"
+	"github.com/go-bumbu/userauth/auth/csrf"
 )
 
 type fakeLogout struct {
@@ -18,10 +19,17 @@ func (f fakeLogout) LogoutUser(_ *http.Request, _ http.ResponseWriter) error {
 }
 
 func TestLogoutHandler(t *testing.T) {
+	protector, err := csrf.New(csrf.Cfg{})
+	if err != nil {
+		t.Fatal(err)
+	}
 	tcs := []struct {
 		name         string
 		logOuter     cookieauth.UserLogout
 		redirect     string
+		method       string // defaults to POST
+		site         string // Sec-Fetch-Site
+		protector    *csrf.Protector
 		wantStatus   int
 		wantLocation string
 	}{
@@ -37,6 +45,26 @@ func TestLogoutHandler(t *testing.T) {
 			wantStatus:   http.StatusSeeOther,
 			wantLocation: "/login",
 		},
+		{
+			name:       "get is not allowed",
+			logOuter:   fakeLogout{},
+			method:     http.MethodGet,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "same-origin post passes the csrf check",
+			logOuter:   fakeLogout{},
+			site:       "same-origin",
+			protector:  protector,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "cross-site post is refused",
+			logOuter:   fakeLogout{},
+			site:       "cross-site",
+			protector:  protector,
+			wantStatus: http.StatusForbidden,
+		},
 		{
 			name:       "logout error returns 500",
 			logOuter:   fakeLogout{err: errors.New("boom")},
@@ -46,8 +74,15 @@ func TestLogoutHandler(t *testing.T) {
 
 	for _, tc := range tcs {
 		t.Run(tc.name, func(t *testing.T) {
-			handler := cookieauth.LogoutHandler(tc.logOuter, tc.redirect)
-			req := httptest.NewRequest(http.MethodGet, "/logout", nil)
+			handler := cookieauth.LogoutHandler(tc.logOuter, tc.redirect, tc.protector)
+			method := tc.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req := httptest.NewRequest(method, "/logout", nil)
+			if tc.site != "" {
+				req.Header.Set("Sec-Fetch-Site", tc.site)
+			}
 			rec := httptest.NewRecorder()
 			handler.ServeHTTP(rec, req)
 
@@ -65,10 +100,11 @@ func TestLogoutHandler(t *testing.T) {
 func TestLogoutHandlerWithManager(t *testing.T) {
 	m := newManager(t, cookieauth.Cfg{})
 	req := loginAndCookie(t, m, "tester")
+	req.Method = http.MethodPost
 	req.RequestURI = "/logout"
 
 	rec := httptest.NewRecorder()
-	cookieauth.LogoutHandler(m, "").ServeHTTP(rec, req)
+	cookieauth.LogoutHandler(m, "", nil).ServeHTTP(rec, req)
 
 	if rec.Result().StatusCode != http.StatusOK {
 		t.Fatalf("expected status 200, got %d", rec.Result().StatusCode)
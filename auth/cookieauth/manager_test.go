@@ -8,7 +8,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-bumbu/userauth"
 	"github.com/go-bumbu/userauth/auth/cookieauth"
+	"github.com/google/go-cmp/cmp"
 	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 )
@@ -177,6 +179,113 @@ func TestLoginUser(t *testing.T) {
 			t.Errorf("unexpected session data: %+v", data)
 		}
 	})
+
+	t.Run("device and methods are recorded", func(t *testing.T) {
+		m := newManager(t, cookieauth.Cfg{})
+		loginReq := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		err := m.LoginUserWithDevice(loginReq, rec, "tester", false, []string{"password", "device"}, "dev1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, c := range rec.Result().Cookies() {
+			req.AddCookie(c)
+		}
+		data, err := m.GetSessData(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data.DeviceID != "dev1" || len(data.AMR) != 2 {
+			t.Errorf("unexpected session data: %+v", data)
+		}
+	})
+}
+
+func TestHandleAuthIdentity(t *testing.T) {
+	m := newManager(t, cookieauth.Cfg{})
+	before := time.Now()
+	req := loginAndCookie(t, m, "tester")
+
+	time.Sleep(10 * time.Millisecond)
+	if ok, _ := m.HandleAuth(httptest.NewRecorder(), req); !ok {
+		t.Fatal("expected the session to authenticate")
+	}
+	id, ok := userauth.IdentityFromContext(req.Context())
+	if !ok || id.UserID != "tester" || id.Method != cookieauth.SessionMngrName {
+		t.Fatalf("unexpected identity %+v (present: %v)", id, ok)
+	}
+	if id.AuthTime.Before(before) || !id.AuthTime.Before(time.Now().Add(-5*time.Millisecond)) {
+		t.Errorf("AuthTime should be the login time, got %v", id.AuthTime)
+	}
+}
+
+func TestUpgradeSession(t *testing.T) {
+	m := newManager(t, cookieauth.Cfg{})
+
+	loginReq := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	if err := m.LoginUserWithMethods(loginReq, rec, "tester", true, []string{"password"}); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range (&http.Response{Header: rec.Header()}).Cookies() {
+		req.AddCookie(c)
+	}
+	before, err := m.GetSessData(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"password"}, before.AMR); diff != "" {
+		t.Errorf("login AMR (-want +got):\n%s", diff)
+	}
+
+	t.Run("another user's session is not upgraded", func(t *testing.T) {
+		err := m.UpgradeSession(req, httptest.NewRecorder(), "someone-else", []string{"totp"})
+		if !errors.Is(err, cookieauth.ErrNoSession) {
+			t.Errorf("want ErrNoSession, got %v", err)
+		}
+	})
+
+	t.Run("no session", func(t *testing.T) {
+		err := m.UpgradeSession(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder(), "tester", nil)
+		if !errors.Is(err, cookieauth.ErrNoSession) {
+			t.Errorf("want ErrNoSession, got %v", err)
+		}
+	})
+
+	t.Run("upgrade refreshes auth time and methods only", func(t *testing.T) {
+		time.Sleep(10 * time.Millisecond)
+		rec := httptest.NewRecorder()
+		if err := m.UpgradeSession(req, rec, "tester", []string{"totp"}); err != nil {
+			t.Fatal(err)
+		}
+		upgraded := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, c := range (&http.Response{Header: rec.Header()}).Cookies() {
+			upgraded.AddCookie(c)
+		}
+		after, err := m.GetSessData(upgraded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !after.AuthTime.After(before.AuthTime) {
+			t.Errorf("AuthTime not refreshed: %v -> %v", before.AuthTime, after.AuthTime)
+		}
+		if diff := cmp.Diff([]string{"totp"}, after.AMR); diff != "" {
+			t.Errorf("AMR (-want +got):\n%s", diff)
+		}
+		if !after.ForceReAuth.Equal(before.ForceReAuth) || after.RenewExpiration != before.RenewExpiration {
+			t.Error("the session windows must be kept")
+		}
+
+		if ok, _ := m.HandleAuth(httptest.NewRecorder(), upgraded); !ok {
+			t.Fatal("expected the upgraded session to authenticate")
+		}
+		id, _ := userauth.IdentityFromContext(upgraded.Context())
+		if diff := cmp.Diff([]string{"totp"}, id.Methods); diff != "" {
+			t.Errorf("identity methods (-want +got):\n%s", diff)
+		}
+	})
 }
 
 func TestGet(t *testing.T) {
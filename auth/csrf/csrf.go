@@ -0,0 +1,228 @@
+// Package csrf protects cookie-authenticated endpoints against cross-site
+// request forgery with two independent checks on every unsafe request
+// (anything but GET, HEAD, OPTIONS and TRACE):
+//
+//   - Origin: the browser-set Sec-Fetch-Site header must say same-origin
+//     (or none, for user-initiated navigation); without it, an Origin header
+//     must match the request's scheme and host. Origins in Cfg.TrustedOrigins, such as an
+//     SPA served from another host, pass as well. Requests carrying neither
+//     header come from non-browser clients, which cannot be driven
+//     cross-site, and pass this check.
+//   - Token: a synchronizer token stored in the user's session must be
+//     echoed in a request header (DefaultHeader) or, for HTML forms, a form
+//     field (DefaultFormField). SPAs fetch it from TokenHandler, server-rendered
+//     pages embed Token; it rotates whenever the session is replaced (login,
+//     logout), so fetch it again afterwards.
+//
+// The session binding is the consumer-side Sessions interface, which
+// cookieauth.Manager satisfies. Without Sessions only the origin check runs.
+package csrf
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultHeader is the request header carrying the token.
+const DefaultHeader = "X-CSRF-Token"
+
+// DefaultFormField is the form field carrying the token when the header is
+// absent.
+const DefaultFormField = "csrf_token"
+
+var (
+	// ErrCrossOrigin: the request came from a foreign, untrusted origin.
+	ErrCrossOrigin = errors.New("csrf: cross-origin request")
+	// ErrTokenMissing: the request or the session has no token.
+	ErrTokenMissing = errors.New("csrf: token missing")
+	// ErrTokenInvalid: the request's token does not match the session's.
+	ErrTokenInvalid = errors.New("csrf: token mismatch")
+)
+
+// Sessions binds tokens to the user's session; *cookieauth.Manager
+// satisfies it.
+type Sessions interface {
+	// CSRFToken returns the session's token, creating one when absent.
+	CSRFToken(r *http.Request, w http.ResponseWriter) (string, error)
+	// SessionCSRFToken returns the session's token, or "" when none exists.
+	SessionCSRFToken(r *http.Request) (string, error)
+}
+
+// Cfg configures a Protector.
+type Cfg struct {
+	// Sessions enables the token check. Nil means origin checks only.
+	Sessions Sessions
+	// TrustedOrigins are additional origins ("https://app.example.com")
+	// allowed to make unsafe requests.
+	TrustedOrigins []string
+	// Header names the request header carrying the token; defaults to
+	// DefaultHeader.
+	Header string
+	// FormField names the form field checked when the header is absent;
+	// defaults to DefaultFormField.
+	FormField string
+	Logger    *slog.Logger
+}
+
+// Protector enforces the CSRF checks.
+type Protector struct {
+	sessions Sessions
+	trusted  map[string]bool // scheme://host[:port]
+	header   string
+	field    string
+	logger   *slog.Logger
+}
+
+// New validates cfg and returns a Protector.
+func New(cfg Cfg) (*Protector, error) {
+	p := &Protector{
+		sessions: cfg.Sessions,
+		trusted:  map[string]bool{},
+		header:   cfg.Header,
+		field:    cfg.FormField,
+		logger:   cfg.Logger,
+	}
+	for _, o := range cfg.TrustedOrigins {
+		u, err := url.Parse(o)
+		if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+			return nil, fmt.Errorf("csrf: invalid trusted origin %q: want scheme://host[:port]", o)
+		}
+		p.trusted[strings.ToLower(u.Scheme+"://"+u.Host)] = true
+	}
+	if p.header == "" {
+		p.header = DefaultHeader
+	}
+	if p.field == "" {
+		p.field = DefaultFormField
+	}
+	if p.logger == nil {
+		p.logger = slog.Default()
+	}
+	return p, nil
+}
+
+// Middleware rejects unsafe requests that fail Check with 403
+// {"error":"csrf check failed"}.
+func (p *Protector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := p.Check(r); err != nil {
+			p.logger.Debug("csrf: request rejected", "method", r.Method, "path", r.URL.Path, "error", err)
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "csrf check failed"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Check runs the origin and token checks; safe methods always pass.
+func (p *Protector) Check(r *http.Request) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return nil
+	}
+	if err := p.checkOrigin(r); err != nil {
+		return err
+	}
+	if p.sessions == nil {
+		return nil
+	}
+	want, err := p.sessions.SessionCSRFToken(r)
+	if err != nil {
+		return fmt.Errorf("csrf: reading session: %w", err)
+	}
+	got := r.Header.Get(p.header)
+	if got == "" {
+		// only reads url-encoded and multipart bodies; JSON stays untouched
+		got = r.PostFormValue(p.field)
+	}
+	if want == "" || got == "" {
+		return ErrTokenMissing
+	}
+	if subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+		return ErrTokenInvalid
+	}
+	return nil
+}
+
+func (p *Protector) checkOrigin(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return nil
+	case "":
+		// older browsers: fall back to comparing Origin with the request's
+		// scheme and host
+		if origin == "" {
+			return nil
+		}
+		if strings.EqualFold(origin, requestOrigin(r)) {
+			return nil
+		}
+	}
+	if p.trusted[strings.ToLower(origin)] {
+		return nil
+	}
+	return ErrCrossOrigin
+}
+
+// requestOrigin is the scheme://host of r as the server received it. Behind
+// a TLS-terminating proxy that is http://; list the public https origin in
+// Cfg.TrustedOrigins for browsers that fall back to this comparison.
+func requestOrigin(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// Token returns the session's token for embedding in a page, creating it
+// (and the session cookie) when needed; call it before writing the body.
+// Without Sessions it returns "".
+func (p *Protector) Token(r *http.Request, w http.ResponseWriter) (string, error) {
+	if p.sessions == nil {
+		return "", nil
+	}
+	return p.sessions.CSRFToken(r, w)
+}
+
+// FormField returns the name of the form field carrying the token.
+func (p *Protector) FormField() string { return p.field }
+
+// TokenHandler returns the GET endpoint SPAs call for the session's token:
+// 200 {"token":"..."}, also set in the response header. It creates the
+// session when needed, so it works before login. Without Sessions it
+// answers 404.
+func (p *Protector) TokenHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "wrong method"})
+			return
+		}
+		if p.sessions == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "csrf tokens not enabled"})
+			return
+		}
+		token, err := p.sessions.CSRFToken(r, w)
+		if err != nil {
+			p.logger.Error("csrf: issuing token failed", "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set(p.header, token)
+		writeJSON(w, http.StatusOK, map[string]string{"token": token})
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
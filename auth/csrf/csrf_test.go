@@ -0,0 +1,191 @@
+package csrf_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-bumbu/userauth/auth/csrf"
+)
+
+// fakeSessions holds a single session token.
+type fakeSessions struct {
+	token  string
+	issued int
+	err    error
+}
+
+func (s *fakeSessions) CSRFToken(_ *http.Request, _ http.ResponseWriter) (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	if s.token == "" {
+		s.token = "fresh-token"
+		s.issued++
+	}
+	return s.token, nil
+}
+
+func (s *fakeSessions) SessionCSRFToken(_ *http.Request) (string, error) {
+	return s.token, s.err
+}
+
+func TestCheck(t *testing.T) {
+	tcs := []struct {
+		name     string
+		method   string
+		headers  map[string]string
+		body     string
+		sessions csrf.Sessions
+		wantErr  error
+	}{
+		{name: "safe method needs nothing", method: http.MethodGet, headers: map[string]string{"Sec-Fetch-Site": "cross-site"}, sessions: &fakeSessions{}},
+		{name: "same-origin fetch", method: http.MethodPost, headers: map[string]string{"Sec-Fetch-Site": "same-origin"}},
+		{name: "user-initiated navigation", method: http.MethodPost, headers: map[string]string{"Sec-Fetch-Site": "none"}},
+		{name: "cross-site fetch", method: http.MethodPost, headers: map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example"}, wantErr: csrf.ErrCrossOrigin},
+		{name: "same-site is not same-origin", method: http.MethodDelete, headers: map[string]string{"Sec-Fetch-Site": "same-site", "Origin": "https://other.example.com"}, wantErr: csrf.ErrCrossOrigin},
+		{name: "trusted origin", method: http.MethodPost, headers: map[string]string{"Sec-Fetch-Site": "same-site", "Origin": "https://APP.example.com"}},
+		{name: "origin matches host", method: http.MethodPost, headers: map[string]string{"Origin": "https://example.com"}},
+		{name: "origin scheme mismatch", method: http.MethodPost, headers: map[string]string{"Origin": "http://example.com"}, wantErr: csrf.ErrCrossOrigin},
+		{name: "origin mismatch", method: http.MethodPost, headers: map[string]string{"Origin": "https://evil.example"}, wantErr: csrf.ErrCrossOrigin},
+		{name: "opaque origin", method: http.MethodPost, headers: map[string]string{"Origin": "null"}, wantErr: csrf.ErrCrossOrigin},
+		{name: "non-browser client", method: http.MethodPost},
+		{
+			name: "token matches", method: http.MethodPost,
+			headers:  map[string]string{"Sec-Fetch-Site": "same-origin", csrf.DefaultHeader: "tok"},
+			sessions: &fakeSessions{token: "tok"},
+		},
+		{
+			name: "token mismatch", method: http.MethodPost,
+			headers:  map[string]string{"Sec-Fetch-Site": "same-origin", csrf.DefaultHeader: "other"},
+			sessions: &fakeSessions{token: "tok"}, wantErr: csrf.ErrTokenInvalid,
+		},
+		{
+			name: "token not sent", method: http.MethodPost,
+			headers:  map[string]string{"Sec-Fetch-Site": "same-origin"},
+			sessions: &fakeSessions{token: "tok"}, wantErr: csrf.ErrTokenMissing,
+		},
+		{
+			name: "session has no token", method: http.MethodPost,
+			headers:  map[string]string{"Sec-Fetch-Site": "same-origin", csrf.DefaultHeader: ""},
+			sessions: &fakeSessions{}, wantErr: csrf.ErrTokenMissing,
+		},
+		{
+			name: "token in a form field", method: http.MethodPost,
+			headers:  map[string]string{"Sec-Fetch-Site": "same-origin", "Content-Type": "application/x-www-form-urlencoded"},
+			body:     csrf.DefaultFormField + "=tok",
+			sessions: &fakeSessions{token: "tok"},
+		},
+		{
+			name: "token does not excuse a foreign origin", method: http.MethodPost,
+			headers:  map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example", csrf.DefaultHeader: "tok"},
+			sessions: &fakeSessions{token: "tok"}, wantErr: csrf.ErrCrossOrigin,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := csrf.New(csrf.Cfg{Sessions: tc.sessions, TrustedOrigins: []string{"https://app.example.com"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(tc.method, "https://example.com/api/login", strings.NewReader(tc.body))
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+			if err := p.Check(r); !errors.Is(err, tc.wantErr) {
+				t.Errorf("err = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	p, err := csrf.New(csrf.Cfg{Sessions: &fakeSessions{token: "tok"}, Header: "X-Token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	called := false
+	h := p.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+
+	r := httptest.NewRequest(http.MethodPost, "/api/logout", nil)
+	r.Header.Set(csrf.DefaultHeader, "tok") // wrong header name for this Protector
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden || called {
+		t.Fatalf("want 403 without calling next, got %d (called %v)", w.Code, called)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil || body["error"] != "csrf check failed" {
+		t.Errorf("unexpected body %v (%v)", body, err)
+	}
+
+	r.Header.Set("X-Token", "tok")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || !called {
+		t.Errorf("want the request through, got %d (called %v)", w.Code, called)
+	}
+}
+
+func TestTokenHandler(t *testing.T) {
+	sessions := &fakeSessions{}
+	p, err := csrf.New(csrf.Cfg{Sessions: sessions})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		w := httptest.NewRecorder()
+		p.TokenHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/csrf", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d", w.Code)
+		}
+		var body map[string]string
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body["token"] != "fresh-token" || w.Header().Get(csrf.DefaultHeader) != "fresh-token" {
+			t.Errorf("unexpected token body %v header %q", body, w.Header().Get(csrf.DefaultHeader))
+		}
+		if w.Header().Get("Cache-Control") != "no-store" {
+			t.Error("the token must not be cached")
+		}
+	}
+	if sessions.issued != 1 {
+		t.Errorf("the session token should be issued once and reused, issued %d", sessions.issued)
+	}
+
+	tcs := []struct {
+		name       string
+		cfg        csrf.Cfg
+		method     string
+		wantStatus int
+	}{
+		{name: "wrong method", cfg: csrf.Cfg{Sessions: &fakeSessions{}}, method: http.MethodPost, wantStatus: http.StatusMethodNotAllowed},
+		{name: "no sessions", method: http.MethodGet, wantStatus: http.StatusNotFound},
+		{name: "session error", cfg: csrf.Cfg{Sessions: &fakeSessions{err: errors.New("boom")}}, method: http.MethodGet, wantStatus: http.StatusInternalServerError},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := csrf.New(tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			p.TokenHandler().ServeHTTP(w, httptest.NewRequest(tc.method, "/api/csrf", nil))
+			if w.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantStatus)
+			}
+		})
+	}
+}
+
+func TestNew_InvalidTrustedOrigin(t *testing.T) {
+	for _, o := range []string{"app.example.com", "https://app.example.com/path", "https://", "://bad"} {
+		if _, err := csrf.New(csrf.Cfg{TrustedOrigins: []string{o}}); err == nil {
+			t.Errorf("want error for origin %q", o)
+		}
+	}
+}
@@ -17,7 +17,9 @@ import (
 	"net/http"
 	"net/netip"
 	"strings"
+	"time"
 
+	"github.com/go-bumbu/userauth"
 	"github.com/go-bumbu/userauth/auth/chain"
 )
 
@@ -115,6 +117,17 @@ func (h *HeaderHandler) HandleAuth(w http.ResponseWriter, r *http.Request) (allo
 	}
 
 	CtxSetRequestData(r, data)
+	id := userauth.Identity{
+		UserID:   data.UserName,
+		LoginID:  data.UserName,
+		Method:   authName,
+		Groups:   data.Groups,
+		AuthTime: time.Now(),
+	}
+	if h.parseGroups && id.Groups == nil {
+		id.Groups = []string{} // the proxy asserted "no groups"
+	}
+	*r = *r.WithContext(userauth.ContextWithIdentity(r.Context(), id))
 	h.logger.Debug("header auth: user authenticated", "user", data.UserName)
 	return true, stopEvaluation
 }
@@ -6,9 +6,12 @@ import (
 	"net/http/httptest"
 	"net/netip"
 	"testing"
+	"time"
 
+	"github.com/go-bumbu/userauth"
 	"github.com/go-bumbu/userauth/auth/headerauth"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 func TestHttpHeaderResponseCode(t *testing.T) {
@@ -126,8 +129,10 @@ func TestContextInjection(t *testing.T) {
 
 	var got headerauth.RequestData
 	var gotErr error
+	var gotID userauth.Identity
 	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		got, gotErr = headerauth.CtxGetRequestData(r)
+		gotID, _ = userauth.IdentityFromContext(r.Context())
 	})
 
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
@@ -143,6 +148,22 @@ func TestContextInjection(t *testing.T) {
 	if diff := cmp.Diff(want, got); diff != "" {
 		t.Errorf("context data mismatch (-want +got):\n%s", diff)
 	}
+	wantID := userauth.Identity{UserID: "user1", LoginID: "user1", Method: "httpheader", Groups: []string{"admin", "dev"}}
+	if diff := cmp.Diff(wantID, gotID, cmpopts.IgnoreFields(userauth.Identity{}, "AuthTime")); diff != "" {
+		t.Errorf("identity mismatch (-want +got):\n%s", diff)
+	}
+	if time.Since(gotID.AuthTime) > time.Minute {
+		t.Errorf("AuthTime should be the request time, got %v", gotID.AuthTime)
+	}
+
+	t.Run("parsed but absent groups are known to be empty", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(headerauth.UserAuthHeader, "user1")
+		h.Middleware(inner).ServeHTTP(httptest.NewRecorder(), req)
+		if gotID.Groups == nil || len(gotID.Groups) != 0 {
+			t.Errorf("want an empty, non-nil group list, got %#v", gotID.Groups)
+		}
+	})
 
 	t.Run("no data without HandleAuth", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/", nil)
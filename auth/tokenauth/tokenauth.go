@@ -15,7 +15,9 @@ import (
 	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/go-bumbu/userauth"
 	"github.com/go-bumbu/userauth/auth/chain"
 )
 
@@ -112,10 +114,31 @@ func (h *Handler) HandleAuth(w http.ResponseWriter, r *http.Request) (allowAcces
 		return false, h.enforce
 	}
 	CtxSetRequestData(r, data)
+	*r = *r.WithContext(userauth.ContextWithIdentity(r.Context(), userauth.Identity{
+		UserID:   data.UserID,
+		LoginID:  data.LoginID,
+		Method:   authName,
+		TokenID:  data.TokenID,
+		Scopes:   data.Scopes,
+		Scoped:   true,
+		AuthTime: time.Now(),
+	}))
 	h.logger.Debug("token auth: authenticated", "user", data.UserID, "tokenID", data.TokenID)
 	return true, false
 }
 
+// Verify chain.Challenger at compile time.
+var _ chain.Challenger = (*Handler)(nil)
+
+// Challenge implements chain.Challenger: the bearer scheme, flagged as
+// invalid_token (RFC 6750) when the request presented a token.
+func (h *Handler) Challenge(r *http.Request) string {
+	if _, present := h.extractToken(r); present {
+		return h.scheme + ` error="invalid_token"`
+	}
+	return h.scheme
+}
+
 // extractToken finds a presented token: Authorization first (only when the
 // scheme matches — a Basic header is not a token and falls through), then
 // the custom header when configured.
@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/go-bumbu/userauth"
 	"github.com/go-bumbu/userauth/auth/tokenauth"
 )
 
@@ -42,7 +43,7 @@ func TestNewRequiresVerifier(t *testing.T) {
 }
 
 func TestHandleAuthTruthTable(t *testing.T) {
-	good := fakeVerifier{valid: "pat_AAAAAAAA_secret", data: tokenauth.RequestData{UserID: "u1", Scopes: []string{"read"}}}
+	good := fakeVerifier{valid: "pat_AAAAAAAA_secret", data: tokenauth.RequestData{UserID: "u1", TokenID: "aaaaaaaa", Scopes: []string{"read"}}}
 	validToken := "pat_AAAAAAAA_secret"
 	whitespaceToken := "  " + validToken + "  "
 	tests := []struct {
@@ -92,6 +93,12 @@ func TestHandleAuthTruthTable(t *testing.T) {
 				if data.UserID != "u1" || len(data.Scopes) != 1 {
 					t.Errorf("context data mismatch: %+v", data)
 				}
+				id, ok := userauth.IdentityFromContext(r.Context())
+				if !ok || id.UserID != "u1" || id.Method != "tokenauth" || id.TokenID != "aaaaaaaa" || len(id.Scopes) != 1 || !id.Scoped {
+					t.Errorf("identity mismatch: %+v", id)
+				}
+			} else if _, ok := userauth.IdentityFromContext(r.Context()); ok {
+				t.Error("no identity expected")
 			}
 		})
 	}
@@ -141,3 +148,15 @@ func TestCtxGetRequestDataWithoutAuth(t *testing.T) {
 		t.Error("empty context should error")
 	}
 }
+
+func TestChallenge(t *testing.T) {
+	h := newHandler(t, tokenauth.Cfg{Verifier: fakeVerifier{valid: "x"}, BearerScheme: "Token"})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if got := h.Challenge(r); got != "Token" {
+		t.Errorf("want a bare scheme without a token, got %q", got)
+	}
+	r.Header.Set("Authorization", "Token wrong")
+	if got := h.Challenge(r); got != `Token error="invalid_token"` {
+		t.Errorf("want invalid_token for a presented token, got %q", got)
+	}
+}
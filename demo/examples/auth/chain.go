@@ -10,7 +10,9 @@ import (
 	"github.com/go-bumbu/userauth/auth/basicauth"
 	"github.com/go-bumbu/userauth/auth/chain"
 	"github.com/go-bumbu/userauth/auth/cookieauth"
+	"github.com/go-bumbu/userauth/demo/internal/logout"
 	"github.com/go-bumbu/userauth/demo/web"
+	loginflow "github.com/go-bumbu/userauth/flow/login"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/securecookie"
 )
@@ -37,17 +39,25 @@ func Chain(log *slog.Logger, users userauth.UserGetter, rnd *web.Renderer) http.
 	}
 
 	// basic auth stays non-enforcing so a failed header check falls through
-	// to the callback instead of prompting the browser
+	// to the login redirect instead of prompting the browser
 	basic := basicauth.NewHandler(users, "", false, log)
 
-	authenticator := chain.New(
-		[]chain.AuthHandler{sessMgr, basic},
-		log,
-		func(w http.ResponseWriter, r *http.Request) {
-			http.Redirect(w, r, "/chain/login", http.StatusSeeOther)
-		},
-		nil,
-	)
+	// browsers are sent to the login page, API clients get a JSON 401
+	authenticator := chain.NewFromCfg(chain.Cfg{
+		Handlers: []chain.AuthHandler{sessMgr, basic},
+		Logger:   log,
+		LoginURL: "/chain/login",
+	})
+
+	// logout goes through a login flow over the same session manager; it
+	// only needs the flow to end the session, the demo login below is fake
+	flow := &loginflow.Flow{
+		Users:   users,
+		Methods: []loginflow.Method{loginflow.PasswordMethod{Users: users}},
+		Policy:  loginflow.RequireAny(loginflow.Chain{loginflow.MethodPassword}),
+		Session: sessMgr,
+		Logger:  log,
+	}
 
 	r := mux.NewRouter()
 
@@ -65,6 +75,6 @@ func Chain(log *slog.Logger, users userauth.UserGetter, rnd *web.Renderer) http.
 		authenticator.Middleware(rnd.ProtectedPage("content protected by an auth chain: cookie session, then basic auth")),
 	)
 
-	r.Path("/logout").Handler(cookieauth.LogoutHandler(sessMgr, "/"))
+	r.Path("/logout").Methods(http.MethodPost).Handler(logout.Handler(log, flow))
 	return r
 }
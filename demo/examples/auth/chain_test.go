@@ -9,13 +9,25 @@ import (
 func TestChainUnauthenticatedRedirectsToLogin(t *testing.T) {
 	handler := Chain(testLogger(), staticDemoUsers(), testWeb())
 	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Accept", "text/html")
 	w := httptest.NewRecorder()
 	handler.ServeHTTP(w, req)
 	if w.Code != http.StatusSeeOther {
-		t.Fatalf("want 303 redirect from the unauthorized callback, got %d", w.Code)
+		t.Fatalf("want 303 redirect to the login page, got %d", w.Code)
 	}
-	if loc := w.Header().Get("Location"); loc != "/chain/login" {
-		t.Errorf("want redirect to /chain/login, got %q", loc)
+	if loc := w.Header().Get("Location"); loc != "/chain/login?return_to=%2Fprotected" {
+		t.Errorf("want redirect to /chain/login with the return path, got %q", loc)
+	}
+}
+
+func TestChainUnauthenticatedAPIClient(t *testing.T) {
+	handler := Chain(testLogger(), staticDemoUsers(), testWeb())
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("want a JSON 401, got %d %q", w.Code, w.Header().Get("Content-Type"))
 	}
 }
 
@@ -61,9 +73,42 @@ func TestChainWrongBasicAuthRedirects(t *testing.T) {
 	handler := Chain(testLogger(), staticDemoUsers(), testWeb())
 	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
 	req.SetBasicAuth("demo", "wrong")
+	req.Header.Set("Accept", "text/html")
 	w := httptest.NewRecorder()
 	handler.ServeHTTP(w, req)
 	if w.Code != http.StatusSeeOther {
 		t.Fatalf("wrong credentials: want 303 to login, got %d", w.Code)
 	}
 }
+
+func TestChainLogout(t *testing.T) {
+	handler := Chain(testLogger(), staticDemoUsers(), testWeb())
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/login", nil))
+	cookies := w.Result().Cookies()
+
+	tcs := []struct {
+		name   string
+		method string
+		site   string // Sec-Fetch-Site
+		want   int
+	}{
+		{name: "get is refused", method: http.MethodGet, want: http.StatusMethodNotAllowed},
+		{name: "cross-site post is refused", method: http.MethodPost, site: "cross-site", want: http.StatusForbidden},
+		{name: "same-origin post logs out", method: http.MethodPost, site: "same-origin", want: http.StatusSeeOther},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/logout", nil)
+			req.Header.Set("Sec-Fetch-Site", tc.site)
+			for _, c := range cookies {
+				req.AddCookie(c)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tc.want {
+				t.Fatalf("want %d, got %d", tc.want, w.Code)
+			}
+		})
+	}
+}
@@ -75,7 +75,7 @@ func Section(log *slog.Logger, users userauth.UserGetter, rnd *web.Renderer) exa
 				Links: []examples.Link{
 					{Href: "/chain/login", Text: "/chain/login", Desc: "start a cookie session (demo only, no credential check)"},
 					{Href: "/chain/protected", Text: "/chain/protected", Desc: "chain-protected page (cookie or basic auth)"},
-					{Href: "/chain/logout", Text: "/chain/logout", Desc: "end the session"},
+					{Href: "/chain/logout", Text: "/chain/logout", Post: true, Desc: "end the session"},
 				},
 				Mount: func(r *mux.Router) {
 					r.PathPrefix("/chain/").Handler(http.StripPrefix("/chain", Chain(log, users, rnd)))
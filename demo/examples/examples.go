@@ -12,11 +12,13 @@ import (
 )
 
 // Link is one entry point of an example, shown on the index page. Links
-// without an Href (e.g. JSON endpoints) are rendered as plain code.
+// without an Href (e.g. JSON endpoints) are rendered as plain code; Post
+// links (e.g. logout) as a button submitting a POST form.
 type Link struct {
 	Href string
 	Text string
 	Desc string
+	Post bool
 }
 
 // Example is one self-contained demo: the copy shown on the index page plus
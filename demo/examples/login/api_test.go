@@ -67,8 +67,9 @@ func postJSON(handler http.Handler, path, body string) *httptest.ResponseRecorde
 }
 
 type apiResponse struct {
-	Done bool     `json:"done"`
-	Next []string `json:"next"`
+	Done    bool     `json:"done"`
+	Next    []string `json:"next"`
+	Attempt string   `json:"attempt"`
 }
 
 func decode(t *testing.T, w *httptest.ResponseRecorder) apiResponse {
@@ -130,7 +131,7 @@ func TestAPILoginTOTPSecondFactor(t *testing.T) {
 	if err != nil {
 		t.Fatalf("generate code: %v", err)
 	}
-	w = postJSON(handler, "/api/login/verify", `{"username":"demo","method":"totp","code":"`+code+`"}`)
+	w = postJSON(handler, "/api/login/verify", `{"username":"demo","method":"totp","code":"`+code+`","attempt":"`+res.Attempt+`"}`)
 	if w.Code != http.StatusOK {
 		t.Fatalf("verify step: want 200, got %d; body=%s", w.Code, w.Body.String())
 	}
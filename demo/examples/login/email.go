@@ -10,6 +10,7 @@ import (
 
 	"github.com/go-bumbu/userauth/auth/cookieauth"
 	"github.com/go-bumbu/userauth/demo/internal/deliver"
+	"github.com/go-bumbu/userauth/demo/internal/logout"
 	"github.com/go-bumbu/userauth/demo/web"
 	loginflow "github.com/go-bumbu/userauth/flow/login"
 	flowmemory "github.com/go-bumbu/userauth/flow/login/attemptstore/memory"
@@ -94,7 +95,7 @@ func Email(log *slog.Logger, rnd *web.Renderer) http.Handler {
 	protected.Handle("", http.HandlerFunc(app.protected))
 	protected.Use(sessMgr.Middleware)
 
-	r.Path("/logout").Handler(cookieauth.LogoutHandler(sessMgr, "/"))
+	r.Path("/logout").Methods(http.MethodPost).Handler(logout.Handler(log, app.flow))
 	return r
 }
 
@@ -112,7 +113,7 @@ func (a *emailLoginApp) requestCode(w http.ResponseWriter, r *http.Request) {
 		a.renderLogin(w, r, "", "Email is required.")
 		return
 	}
-	if err := a.flow.Initiate(r, email, loginflow.MethodEmail); err != nil {
+	if err := a.flow.Initiate(r, "", email, loginflow.MethodEmail); err != nil {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
@@ -134,7 +135,7 @@ func (a *emailLoginApp) verifyCode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, err := a.flow.Submit(r, w, email, loginflow.MethodEmail, code, false)
+	res, err := a.flow.Submit(r, w, "", email, loginflow.MethodEmail, code, false)
 	if err != nil {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
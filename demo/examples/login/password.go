@@ -13,6 +13,7 @@ import (
 
 	"github.com/go-bumbu/userauth"
 	"github.com/go-bumbu/userauth/auth/cookieauth"
+	"github.com/go-bumbu/userauth/demo/internal/logout"
 	"github.com/go-bumbu/userauth/demo/web"
 	loginflow "github.com/go-bumbu/userauth/flow/login"
 	"github.com/gorilla/mux"
@@ -62,7 +63,7 @@ func Password(log *slog.Logger, users userauth.UserGetter, rnd *web.Renderer) ht
 		password := req.FormValue("password")
 		keepLoggedIn := req.FormValue("session_renew") == "on"
 
-		res, err := flow.Submit(req, w, username, loginflow.MethodPassword, password, keepLoggedIn)
+		res, err := flow.Submit(req, w, "", username, loginflow.MethodPassword, password, keepLoggedIn)
 		if err != nil {
 			log.Error("password login: flow error", "error", err)
 			http.Error(w, "internal error", http.StatusInternalServerError)
@@ -74,7 +75,7 @@ func Password(log *slog.Logger, users userauth.UserGetter, rnd *web.Renderer) ht
 		}
 		http.Redirect(w, req, "/password/protected", http.StatusSeeOther)
 	})
-	r.Path("/logout").Handler(cookieauth.LogoutHandler(sessMgr, "/"))
+	r.Path("/logout").Methods(http.MethodPost).Handler(logout.Handler(log, flow))
 
 	return r
 }
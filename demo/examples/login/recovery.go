@@ -13,8 +13,10 @@ import (
 
 	"github.com/go-bumbu/userauth"
 	"github.com/go-bumbu/userauth/auth/cookieauth"
+	"github.com/go-bumbu/userauth/demo/internal/logout"
 	"github.com/go-bumbu/userauth/demo/web"
 	loginflow "github.com/go-bumbu/userauth/flow/login"
+	attemptcookie "github.com/go-bumbu/userauth/flow/login/attemptstore/cookie"
 	flowmemory "github.com/go-bumbu/userauth/flow/login/attemptstore/memory"
 	"github.com/go-bumbu/userauth/userstore/staticusers"
 	"github.com/gorilla/mux"
@@ -57,9 +59,10 @@ func (s *recoveryStore) Remaining(userID string) []string {
 
 // recoveryLoginApp holds the demo-owned transport: forms, redirects and rendering.
 type recoveryLoginApp struct {
-	rnd   *web.Renderer
-	users *recoveryStore
-	flow  *loginflow.Flow
+	rnd     *web.Renderer
+	users   *recoveryStore
+	flow    *loginflow.Flow
+	attempt attemptcookie.Transport // carries the handle from step 1 to step 2
 }
 
 // Recovery demonstrates completing a two-factor login with a single-use
@@ -93,7 +96,7 @@ func Recovery(log *slog.Logger, rnd *web.Renderer) http.Handler {
 		panic(fmt.Errorf("recovery: session manager: %w", err))
 	}
 
-	app := &recoveryLoginApp{rnd: rnd, users: users}
+	app := &recoveryLoginApp{rnd: rnd, users: users, attempt: attemptcookie.Transport{Path: recoveryBasePath}}
 	app.flow = &loginflow.Flow{
 		Users: users,
 		Methods: []loginflow.Method{
@@ -116,7 +119,7 @@ func Recovery(log *slog.Logger, rnd *web.Renderer) http.Handler {
 	protected.Handle("", rnd.ProtectedPage("content protected by password + recovery-code login"))
 	protected.Use(sessMgr.Middleware)
 
-	r.Path("/logout").Handler(cookieauth.LogoutHandler(sessMgr, "/"))
+	r.Path("/logout").Methods(http.MethodPost).Handler(logout.Handler(log, app.flow))
 	return r
 }
 
@@ -129,7 +132,7 @@ func (a *recoveryLoginApp) loginForm(w http.ResponseWriter, r *http.Request) {
 // recovery code next, so the user is redirected to the verify page.
 func (a *recoveryLoginApp) passwordStep(w http.ResponseWriter, r *http.Request) {
 	username := strings.TrimSpace(r.FormValue("username"))
-	res, err := a.flow.Submit(r, w, username, loginflow.MethodPassword, r.FormValue("password"), false)
+	res, err := a.flow.Submit(r, w, "", username, loginflow.MethodPassword, r.FormValue("password"), false)
 	if err != nil {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
@@ -142,6 +145,7 @@ func (a *recoveryLoginApp) passwordStep(w http.ResponseWriter, r *http.Request)
 		http.Redirect(w, r, recoveryBasePath+"/protected", http.StatusSeeOther)
 		return
 	}
+	a.attempt.Write(w, res.Attempt)
 	http.Redirect(w, r, recoveryBasePath+"/login/verify?user="+url.QueryEscape(username), http.StatusSeeOther)
 }
 
@@ -157,7 +161,7 @@ func (a *recoveryLoginApp) verifyCode(w http.ResponseWriter, r *http.Request) {
 	username := strings.TrimSpace(r.FormValue("username"))
 	code := strings.TrimSpace(r.FormValue("code"))
 
-	res, err := a.flow.Submit(r, w, username, loginflow.MethodRecovery, code, false)
+	res, err := a.flow.Submit(r, w, a.attempt.Read(r), username, loginflow.MethodRecovery, code, false)
 	if err != nil {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
@@ -168,6 +172,7 @@ func (a *recoveryLoginApp) verifyCode(w http.ResponseWriter, r *http.Request) {
 		a.renderVerify(w, r, username, "Invalid or already used recovery code.")
 		return
 	}
+	a.attempt.Clear(w)
 	http.Redirect(w, r, recoveryBasePath+"/protected", http.StatusSeeOther)
 }
 
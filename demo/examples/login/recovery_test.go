@@ -7,6 +7,8 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+
+	"github.com/go-bumbu/userauth/demo/internal/demotest"
 )
 
 var recoveryCodeRe = regexp.MustCompile(`email-code"[^>]*>([a-z0-9]{8})<`)
@@ -22,9 +24,10 @@ func TestRecoveryLoginHappyPath(t *testing.T) {
 	if loc := w.Header().Get("Location"); !strings.HasPrefix(loc, "/recovery/login/verify") {
 		t.Errorf("want redirect to /recovery/login/verify..., got %q", loc)
 	}
-	if len(w.Result().Cookies()) != 0 {
+	if len(demotest.SessionCookies(w)) != 0 {
 		t.Error("no session cookie should be set at the password step")
 	}
+	attempt := w.Result().Cookies()
 
 	// Step 2: GET the verify page and scrape a remaining recovery code.
 	req := httptest.NewRequest(http.MethodGet, "/login/verify?user=demo", nil)
@@ -37,7 +40,7 @@ func TestRecoveryLoginHappyPath(t *testing.T) {
 	code := m[1]
 
 	// Step 3: submit the recovery code.
-	w = postForm(handler, "/login/verify", url.Values{"username": {"demo"}, "code": {code}})
+	w = postForm(handler, "/login/verify", url.Values{"username": {"demo"}, "code": {code}}, attempt...)
 	if w.Code != http.StatusSeeOther {
 		t.Fatalf("recovery step: want 303, got %d", w.Code)
 	}
@@ -67,7 +70,7 @@ func TestRecoveryLoginCodeIsSingleUse(t *testing.T) {
 	handler := Recovery(testLogger(), testWeb())
 
 	// First login consumes the code.
-	_ = postForm(handler, "/login", url.Values{"username": {"demo"}, "password": {"demo"}})
+	attempt := postForm(handler, "/login", url.Values{"username": {"demo"}, "password": {"demo"}}).Result().Cookies()
 	req := httptest.NewRequest(http.MethodGet, "/login/verify?user=demo", nil)
 	rec := httptest.NewRecorder()
 	handler.ServeHTTP(rec, req)
@@ -76,21 +79,21 @@ func TestRecoveryLoginCodeIsSingleUse(t *testing.T) {
 		t.Fatalf("verify page missing recovery codes; body=%s", rec.Body.String())
 	}
 	code := m[1]
-	w := postForm(handler, "/login/verify", url.Values{"username": {"demo"}, "code": {code}})
+	w := postForm(handler, "/login/verify", url.Values{"username": {"demo"}, "code": {code}}, attempt...)
 	if w.Code != http.StatusSeeOther {
 		t.Fatalf("first use: want 303, got %d", w.Code)
 	}
 
 	// Second login replays the same code; it must be rejected.
-	_ = postForm(handler, "/login", url.Values{"username": {"demo"}, "password": {"demo"}})
-	w = postForm(handler, "/login/verify", url.Values{"username": {"demo"}, "code": {code}})
+	attempt = postForm(handler, "/login", url.Values{"username": {"demo"}, "password": {"demo"}}).Result().Cookies()
+	w = postForm(handler, "/login/verify", url.Values{"username": {"demo"}, "code": {code}}, attempt...)
 	if w.Code != http.StatusOK {
 		t.Fatalf("replayed code: want 200 (error page), got %d", w.Code)
 	}
 	if !strings.Contains(w.Body.String(), "Invalid or already used") {
 		t.Errorf("want error message; body=%s", w.Body.String())
 	}
-	if len(w.Result().Cookies()) != 0 {
+	if len(demotest.SessionCookies(w)) != 0 {
 		t.Error("no session cookie should be set on a replayed code")
 	}
 }
@@ -119,8 +122,8 @@ func TestRecoveryLoginCodeWithoutPassword(t *testing.T) {
 	}
 
 	// The rejected submission must not have burned the code.
-	_ = postForm(handler, "/login", url.Values{"username": {"demo"}, "password": {"demo"}})
-	w = postForm(handler, "/login/verify", url.Values{"username": {"demo"}, "code": {code}})
+	attempt := postForm(handler, "/login", url.Values{"username": {"demo"}, "password": {"demo"}}).Result().Cookies()
+	w = postForm(handler, "/login/verify", url.Values{"username": {"demo"}, "code": {code}}, attempt...)
 	if w.Code != http.StatusSeeOther {
 		t.Fatalf("code should still be usable after a rejected early submission: want 303, got %d", w.Code)
 	}
@@ -33,7 +33,7 @@ func Section(log *slog.Logger, static userauth.UserGetter, users *userdb.Store,
 				Links: []examples.Link{
 					{Href: "/password/login", Text: "/password/login", Desc: "login form"},
 					{Href: "/password/protected", Text: "/password/protected", Desc: "session-protected page"},
-					{Href: "/password/logout", Text: "/password/logout", Desc: "logout (invalidate the session cookie)"},
+					{Href: "/password/logout", Text: "/password/logout", Post: true, Desc: "logout (invalidate the session cookie)"},
 				},
 				Mount: func(r *mux.Router) {
 					r.PathPrefix("/password/").Handler(http.StripPrefix("/password", Password(log, static, rnd)))
@@ -49,7 +49,7 @@ func Section(log *slog.Logger, static userauth.UserGetter, users *userdb.Store,
 				Links: []examples.Link{
 					{Href: "/emailcode/login", Text: "/emailcode/login", Desc: "request a login code"},
 					{Href: "/emailcode/protected", Text: "/emailcode/protected", Desc: "cookie-protected page"},
-					{Href: "/emailcode/logout", Text: "/emailcode/logout", Desc: "logout"},
+					{Href: "/emailcode/logout", Text: "/emailcode/logout", Post: true, Desc: "logout"},
 				},
 				Mount: func(r *mux.Router) {
 					r.PathPrefix("/emailcode/").Handler(http.StripPrefix("/emailcode", Email(log, rnd)))
@@ -66,7 +66,7 @@ func Section(log *slog.Logger, static userauth.UserGetter, users *userdb.Store,
 				Links: []examples.Link{
 					{Href: "/totp/login", Text: "/totp/login", Desc: "password step, then the authenticator-code step"},
 					{Href: "/totp/protected", Text: "/totp/protected", Desc: "session-protected page"},
-					{Href: "/totp/logout", Text: "/totp/logout", Desc: "logout"},
+					{Href: "/totp/logout", Text: "/totp/logout", Post: true, Desc: "logout"},
 				},
 				Mount: func(r *mux.Router) {
 					r.PathPrefix("/totp/").Handler(http.StripPrefix("/totp", TOTP(log, rnd)))
@@ -83,7 +83,7 @@ func Section(log *slog.Logger, static userauth.UserGetter, users *userdb.Store,
 				Links: []examples.Link{
 					{Href: "/recovery/login", Text: "/recovery/login", Desc: "password step, then the recovery-code step"},
 					{Href: "/recovery/protected", Text: "/recovery/protected", Desc: "session-protected page"},
-					{Href: "/recovery/logout", Text: "/recovery/logout", Desc: "logout"},
+					{Href: "/recovery/logout", Text: "/recovery/logout", Post: true, Desc: "logout"},
 				},
 				Mount: func(r *mux.Router) {
 					r.PathPrefix("/recovery/").Handler(http.StripPrefix("/recovery", Recovery(log, rnd)))
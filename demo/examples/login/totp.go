@@ -10,8 +10,10 @@ import (
 
 	"github.com/go-bumbu/userauth"
 	"github.com/go-bumbu/userauth/auth/cookieauth"
+	"github.com/go-bumbu/userauth/demo/internal/logout"
 	"github.com/go-bumbu/userauth/demo/web"
 	loginflow "github.com/go-bumbu/userauth/flow/login"
+	attemptcookie "github.com/go-bumbu/userauth/flow/login/attemptstore/cookie"
 	flowmemory "github.com/go-bumbu/userauth/flow/login/attemptstore/memory"
 	totpsvc "github.com/go-bumbu/userauth/service/totp"
 	"github.com/go-bumbu/userauth/userstore/staticusers"
@@ -31,8 +33,9 @@ const demoTOTPSecret = "JBSWY3DPEHPK3PXP" // #nosec G101 -- demo TOTP secret
 
 // totpLoginApp holds the demo-owned transport: forms, redirects and rendering.
 type totpLoginApp struct {
-	rnd  *web.Renderer
-	flow *loginflow.Flow
+	rnd     *web.Renderer
+	flow    *loginflow.Flow
+	attempt attemptcookie.Transport // carries the handle from step 1 to step 2
 }
 
 // TOTP demonstrates a two-step login: the policy requires the password first
@@ -68,7 +71,7 @@ func TOTP(log *slog.Logger, rnd *web.Renderer) http.Handler {
 		panic(fmt.Errorf("totp: verifier: %w", err))
 	}
 
-	app := &totpLoginApp{rnd: rnd}
+	app := &totpLoginApp{rnd: rnd, attempt: attemptcookie.Transport{Path: totpBasePath}}
 	app.flow = &loginflow.Flow{
 		Users: users,
 		Methods: []loginflow.Method{
@@ -91,7 +94,7 @@ func TOTP(log *slog.Logger, rnd *web.Renderer) http.Handler {
 	protected.Handle("", rnd.ProtectedPage("content protected by password + TOTP login"))
 	protected.Use(sessMgr.Middleware)
 
-	r.Path("/logout").Handler(cookieauth.LogoutHandler(sessMgr, "/"))
+	r.Path("/logout").Methods(http.MethodPost).Handler(logout.Handler(log, app.flow))
 	return r
 }
 
@@ -104,7 +107,7 @@ func (a *totpLoginApp) loginForm(w http.ResponseWriter, r *http.Request) {
 // TOTP factor next, so the user is redirected to the verify page.
 func (a *totpLoginApp) passwordStep(w http.ResponseWriter, r *http.Request) {
 	username := strings.TrimSpace(r.FormValue("username"))
-	res, err := a.flow.Submit(r, w, username, loginflow.MethodPassword, r.FormValue("password"), false)
+	res, err := a.flow.Submit(r, w, "", username, loginflow.MethodPassword, r.FormValue("password"), false)
 	if err != nil {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
@@ -117,6 +120,7 @@ func (a *totpLoginApp) passwordStep(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, totpBasePath+"/protected", http.StatusSeeOther)
 		return
 	}
+	a.attempt.Write(w, res.Attempt)
 	http.Redirect(w, r, totpBasePath+"/login/verify?user="+url.QueryEscape(username), http.StatusSeeOther)
 }
 
@@ -132,7 +136,7 @@ func (a *totpLoginApp) verifyCode(w http.ResponseWriter, r *http.Request) {
 	username := strings.TrimSpace(r.FormValue("username"))
 	code := strings.TrimSpace(r.FormValue("code"))
 
-	res, err := a.flow.Submit(r, w, username, loginflow.MethodTOTP, code, false)
+	res, err := a.flow.Submit(r, w, a.attempt.Read(r), username, loginflow.MethodTOTP, code, false)
 	if err != nil {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
@@ -143,6 +147,7 @@ func (a *totpLoginApp) verifyCode(w http.ResponseWriter, r *http.Request) {
 		a.renderVerify(w, r, username, "Invalid code, try again.")
 		return
 	}
+	a.attempt.Clear(w)
 	http.Redirect(w, r, totpBasePath+"/protected", http.StatusSeeOther)
 }
 
@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-bumbu/userauth/demo/internal/demotest"
 	"github.com/pquerna/otp/totp"
 )
 
@@ -36,16 +37,17 @@ func TestTOTPLoginHappyPath(t *testing.T) {
 	if loc := w.Header().Get("Location"); !strings.HasPrefix(loc, "/totp/login/verify") {
 		t.Errorf("want redirect to /totp/login/verify..., got %q", loc)
 	}
-	if len(w.Result().Cookies()) != 0 {
+	if len(demotest.SessionCookies(w)) != 0 {
 		t.Error("no session cookie should be set at the password step")
 	}
+	attempt := w.Result().Cookies()
 
 	// Step 2: authenticator code.
 	code, err := totp.GenerateCode(demoTOTPSecret, time.Now())
 	if err != nil {
 		t.Fatalf("generate code: %v", err)
 	}
-	w = postForm(handler, "/login/verify", url.Values{"username": {"demo"}, "code": {code}})
+	w = postForm(handler, "/login/verify", url.Values{"username": {"demo"}, "code": {code}}, attempt...)
 	if w.Code != http.StatusSeeOther {
 		t.Fatalf("totp step: want 303, got %d", w.Code)
 	}
@@ -89,9 +91,9 @@ func TestTOTPLoginCodeWithoutPassword(t *testing.T) {
 
 func TestTOTPLoginWrongCode(t *testing.T) {
 	handler := TOTP(testLogger(), testWeb())
-	_ = postForm(handler, "/login", url.Values{"username": {"demo"}, "password": {"demo"}})
+	attempt := postForm(handler, "/login", url.Values{"username": {"demo"}, "password": {"demo"}}).Result().Cookies()
 
-	w := postForm(handler, "/login/verify", url.Values{"username": {"demo"}, "code": {"000000"}})
+	w := postForm(handler, "/login/verify", url.Values{"username": {"demo"}, "code": {"000000"}}, attempt...)
 	if w.Code != http.StatusOK {
 		t.Fatalf("wrong code: want 200 (error page), got %d", w.Code)
 	}
@@ -103,11 +105,7 @@ func TestTOTPLoginWrongCode(t *testing.T) {
 	}
 }
 
-// postForm posts a urlencoded form to handler without cookies.
-func postForm(handler http.Handler, path string, form url.Values) *httptest.ResponseRecorder {
-	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	w := httptest.NewRecorder()
-	handler.ServeHTTP(w, req)
-	return w
+// postForm posts a urlencoded form to handler, attaching cookies.
+func postForm(handler http.Handler, path string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	return demotest.PostForm(handler, path, form, cookies)
 }
@@ -14,7 +14,7 @@ func (a *app) loginPost(w http.ResponseWriter, r *http.Request) {
 	username := strings.TrimSpace(r.FormValue("username"))
 	password := r.FormValue("password")
 
-	res, err := a.flow.Submit(r, w, username, login.MethodPassword, password, false)
+	res, err := a.flow.Submit(r, w, "", username, login.MethodPassword, password, false)
 	if err != nil {
 		http.Error(w, "login error", http.StatusInternalServerError)
 		return
@@ -24,6 +24,7 @@ func (a *app) loginPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if !res.Done {
+		a.attempt.Write(w, res.Attempt)
 		a.rnd.Render(w, r, "profile_2fa.tmpl.html", map[string]any{"UserID": username})
 		return
 	}
@@ -35,14 +36,15 @@ func (a *app) loginPost(w http.ResponseWriter, r *http.Request) {
 func (a *app) verify2FA(w http.ResponseWriter, r *http.Request) {
 	userID := strings.TrimSpace(r.FormValue("userID"))
 	code := strings.TrimSpace(r.FormValue("code"))
+	attempt := a.attempt.Read(r)
 
-	res, err := a.flow.Submit(r, w, userID, login.MethodTOTP, code, false)
+	res, err := a.flow.Submit(r, w, attempt, userID, login.MethodTOTP, code, false)
 	if err != nil {
 		http.Error(w, "login error", http.StatusInternalServerError)
 		return
 	}
 	if !res.OK {
-		res, err = a.flow.Submit(r, w, userID, login.MethodRecovery, code, false)
+		res, err = a.flow.Submit(r, w, attempt, userID, login.MethodRecovery, code, false)
 		if err != nil {
 			http.Error(w, "login error", http.StatusInternalServerError)
 			return
@@ -58,5 +60,6 @@ func (a *app) verify2FA(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	a.attempt.Clear(w)
 	http.Redirect(w, r, "/profile/", http.StatusSeeOther)
 }
@@ -44,22 +44,23 @@ func TestProfileLoginTwoStepTOTP(t *testing.T) {
 	if !strings.Contains(w.Body.String(), "/profile/login/2fa") {
 		t.Errorf("expected the 2FA form in the body")
 	}
-	if len(w.Result().Cookies()) != 0 {
+	if len(demotest.SessionCookies(w)) != 0 {
 		t.Error("no session cookie should be set at the password step")
 	}
+	attempt := w.Result().Cookies()
 
 	code, err := totp.GenerateCode(secret, time.Now())
 	if err != nil {
 		t.Fatalf("generate code: %v", err)
 	}
-	w = demotest.PostForm(handler, "/login/2fa", url.Values{"userID": {uid}, "code": {code}}, nil)
+	w = demotest.PostForm(handler, "/login/2fa", url.Values{"userID": {uid}, "code": {code}}, attempt)
 	if w.Code != http.StatusSeeOther {
 		t.Fatalf("2FA step: want 303, got %d", w.Code)
 	}
 	if w.Header().Get("Location") != "/profile/" {
 		t.Errorf("want redirect /profile/, got %q", w.Header().Get("Location"))
 	}
-	if len(w.Result().Cookies()) == 0 {
+	if len(demotest.SessionCookies(w)) == 0 {
 		t.Error("expected a session cookie after 2FA")
 	}
 }
@@ -72,9 +73,9 @@ func TestProfileLoginTwoStepWrongCode(t *testing.T) {
 	}
 	enableTOTP(t, mfaSvc, users, uid)
 	// establish the pending login (password step)
-	_ = demotest.PostForm(handler, "/login", url.Values{"username": {uid}, "password": {"pw"}}, nil)
+	attempt := demotest.PostForm(handler, "/login", url.Values{"username": {uid}, "password": {"pw"}}, nil).Result().Cookies()
 
-	w := demotest.PostForm(handler, "/login/2fa", url.Values{"userID": {uid}, "code": {"000000"}}, nil)
+	w := demotest.PostForm(handler, "/login/2fa", url.Values{"userID": {uid}, "code": {"000000"}}, attempt)
 	if w.Code != http.StatusOK {
 		t.Fatalf("wrong code: want 200 (re-render), got %d", w.Code)
 	}
@@ -14,9 +14,11 @@ import (
 
 	"github.com/go-bumbu/userauth"
 	"github.com/go-bumbu/userauth/auth/cookieauth"
+	"github.com/go-bumbu/userauth/demo/internal/logout"
 	"github.com/go-bumbu/userauth/demo/internal/mfa"
 	"github.com/go-bumbu/userauth/demo/web"
 	"github.com/go-bumbu/userauth/flow/login"
+	attemptcookie "github.com/go-bumbu/userauth/flow/login/attemptstore/cookie"
 	flowmemory "github.com/go-bumbu/userauth/flow/login/attemptstore/memory"
 	"github.com/go-bumbu/userauth/flow/pat/handlers"
 	patsvc "github.com/go-bumbu/userauth/service/pat"
@@ -33,6 +35,7 @@ type app struct {
 	rnd     *web.Renderer
 	sessMgr *cookieauth.Manager
 	flow    *login.Flow
+	attempt attemptcookie.Transport // carries the handle to the 2FA step
 	pats    *patsvc.Service
 }
 
@@ -99,7 +102,8 @@ func New(log *slog.Logger, users *userdb.Store, mfaSvc mfa.Services, rnd *web.Re
 			Session:  sessMgr,
 			Logger:   log,
 		},
-		pats: pats,
+		attempt: attemptcookie.Transport{Path: "/profile"},
+		pats:    pats,
 	}
 
 	r := mux.NewRouter()
@@ -108,7 +112,7 @@ func New(log *slog.Logger, users *userdb.Store, mfaSvc mfa.Services, rnd *web.Re
 	})
 	r.Path("/login").Methods(http.MethodPost).HandlerFunc(a.loginPost)
 	r.Path("/login/2fa").Methods(http.MethodPost).HandlerFunc(a.verify2FA)
-	r.Path("/logout").Handler(cookieauth.LogoutHandler(a.sessMgr, "/"))
+	r.Path("/logout").Methods(http.MethodPost).Handler(logout.Handler(log, a.flow))
 	r.Path("/").Methods(http.MethodGet).Handler(a.requireAuth(http.HandlerFunc(a.view)))
 	r.Path("/change-password").Methods(http.MethodPost).Handler(a.requireAuth(http.HandlerFunc(a.changePassword)))
 	r.Path("/change-email").Methods(http.MethodPost).Handler(a.requireAuth(http.HandlerFunc(a.changeEmail)))
@@ -35,7 +35,7 @@ func Section(log *slog.Logger, users *userdb.Store, mfaSvc mfa.Services, rnd *we
 				Links: []examples.Link{
 					{Href: "/profile/", Text: "/profile/", Desc: "view and edit your profile (redirects to login if not authenticated)"},
 					{Href: "/profile/login", Text: "/profile/login", Desc: "login with a database account (asks for TOTP when enrolled)"},
-					{Href: "/profile/logout", Text: "/profile/logout", Desc: "logout"},
+					{Href: "/profile/logout", Text: "/profile/logout", Post: true, Desc: "logout"},
 					{Href: "/profile/pat", Text: "/profile/pat", Desc: "create and revoke personal access tokens"},
 				},
 				Mount: func(r *mux.Router) {
@@ -169,13 +169,13 @@ func TestProfileRecoveryCodeLogin(t *testing.T) {
 	recCode := recoveryCodeRe.FindAllStringSubmatch(cw.Body.String(), -1)[0][1]
 
 	// password step establishes the pending login
-	_ = demotest.PostForm(handler, "/login", url.Values{"username": {uid}, "password": {"pw"}}, nil)
+	attempt := demotest.PostForm(handler, "/login", url.Values{"username": {uid}, "password": {"pw"}}, nil).Result().Cookies()
 	// log in with the recovery code
-	w := demotest.PostForm(handler, "/login/2fa", url.Values{"userID": {uid}, "code": {recCode}}, nil)
+	w := demotest.PostForm(handler, "/login/2fa", url.Values{"userID": {uid}, "code": {recCode}}, attempt)
 	if w.Code != http.StatusSeeOther {
 		t.Fatalf("recovery login: want 303, got %d", w.Code)
 	}
-	if len(w.Result().Cookies()) == 0 {
+	if len(demotest.SessionCookies(w)) == 0 {
 		t.Error("expected a session cookie after recovery-code login")
 	}
 	count, _ := mfaSvc.Recovery.Remaining(canonicalID(t, users, uid))
@@ -184,8 +184,8 @@ func TestProfileRecoveryCodeLogin(t *testing.T) {
 	}
 
 	// reusing the same code must fail
-	_ = demotest.PostForm(handler, "/login", url.Values{"username": {uid}, "password": {"pw"}}, nil)
-	w = demotest.PostForm(handler, "/login/2fa", url.Values{"userID": {uid}, "code": {recCode}}, nil)
+	attempt = demotest.PostForm(handler, "/login", url.Values{"username": {uid}, "password": {"pw"}}, nil).Result().Cookies()
+	w = demotest.PostForm(handler, "/login/2fa", url.Values{"userID": {uid}, "code": {recCode}}, attempt)
 	if len(w.Result().Cookies()) != 0 {
 		t.Error("reused recovery code must not authenticate")
 	}
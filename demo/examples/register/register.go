@@ -43,9 +43,12 @@ func (c userdbCreator) CreateVerifiedUser(u regflow.NewUser) error {
 	return c.users.CreateUserWithHashedPassword(userdb.User{
 		LoginID:              u.LoginID,
 		Pw:                   u.PasswordHash,
-		Enabled:              true,
+		Enabled:              !u.Disabled,
 		PrimaryEmail:         u.Email,
 		PrimaryEmailVerified: u.EmailVerified,
+		Groups:               u.Groups,
+		InvitedBy:            u.InvitedBy,
+		Attributes:           u.Attributes,
 	})
 }
 
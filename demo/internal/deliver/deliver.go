@@ -9,7 +9,8 @@ import (
 	"context"
 	"log/slog"
 	"sync"
-	"time"
+
+	"github.com/go-bumbu/userauth/service/verificationcode"
 )
 
 // Board remembers the latest plaintext code per recipient so a page can
@@ -26,10 +27,10 @@ func NewBoard() *Board {
 }
 
 // Deliver implements verificationcode.Deliverer by stashing the code for display.
-func (b *Board) Deliver(_ context.Context, to string, code string, _ time.Time) error {
+func (b *Board) Deliver(_ context.Context, msg verificationcode.Message) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	b.codes[to] = code
+	b.codes[msg.To] = msg.Code
 	return nil
 }
 
@@ -57,7 +58,7 @@ type Log struct {
 }
 
 // Deliver implements verificationcode.Deliverer by logging the code.
-func (d Log) Deliver(_ context.Context, to string, code string, _ time.Time) error {
-	d.Logger.Info(d.Msg, "to", to, "code", code)
+func (d Log) Deliver(_ context.Context, msg verificationcode.Message) error {
+	d.Logger.Info(d.Msg, "to", msg.To, "code", msg.Code, "purpose", msg.Purpose, "locale", msg.Locale)
 	return nil
 }
@@ -1,5 +1,6 @@
 // Package demotest holds helpers shared by the demo example tests: a silent
-// logger, the template renderer, form posting, and a seeded in-memory user DB.
+// logger, the template renderer, form posting, cookie filtering, and a seeded
+// in-memory user DB.
 package demotest
 
 import (
@@ -12,6 +13,7 @@ import (
 	"strings"
 
 	"github.com/go-bumbu/userauth/demo/web"
+	attemptcookie "github.com/go-bumbu/userauth/flow/login/attemptstore/cookie"
 	"github.com/go-bumbu/userauth/userstore/userdb"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -37,6 +39,18 @@ func PostForm(handler http.Handler, path string, form url.Values, cookies []*htt
 	return w
 }
 
+// SessionCookies returns the cookies w set, leaving out the login attempt
+// handle the multi-step examples carry between their steps.
+func SessionCookies(w *httptest.ResponseRecorder) []*http.Cookie {
+	var out []*http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name != attemptcookie.DefaultName {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
 // SeedAccounts are the users NewUserStore creates.
 var SeedAccounts = []struct{ ID, Pw string }{
 	{"admin", "admin"},
@@ -0,0 +1,29 @@
+// Package logout builds the demo's logout endpoints on the login form
+// transport: POST only, behind the CSRF origin check, so other sites cannot
+// log a demo user out.
+package logout
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-bumbu/userauth/auth/csrf"
+	"github.com/go-bumbu/userauth/flow/login"
+	"github.com/go-bumbu/userauth/flow/login/handlers/form"
+)
+
+// Handler returns the POST endpoint that ends flow's session and redirects
+// to the index. The check is origin-only: the logout buttons live on the
+// index page, which carries no session token to echo.
+func Handler(log *slog.Logger, flow *login.Flow) http.Handler {
+	protector, err := csrf.New(csrf.Cfg{Logger: log})
+	if err != nil {
+		panic(fmt.Errorf("logout: csrf: %w", err))
+	}
+	f, err := form.New(flow, form.Opts{CSRF: protector, Logger: log})
+	if err != nil {
+		panic(fmt.Errorf("logout: form transport: %w", err))
+	}
+	return f.LogoutHandler("/")
+}
@@ -0,0 +1,503 @@
+// Package admin is the user-administration engine: list and search users,
+// create, enable, disable, rename and delete them, set their groups, reset
+// their TOTP factor and recovery codes, and list and revoke their personal
+// access tokens. HTTP lives in handlers/.
+//
+// Every operation acts for the userauth.Identity on the request and passes
+// through two hooks:
+//
+//   - Flow.Authorize decides whether the identity may perform it. It is
+//     required — without one nothing runs — and sees the action, the target
+//     user and the parameters, so rules can go beyond "is an admin" (only
+//     owners grant the owner group, nobody deletes themselves).
+//   - Flow.Audit receives an Event for every authenticated attempt:
+//     succeeded, denied or failed.
+//
+// Authorization runs before the target user is looked up, so a denied
+// identity cannot tell existing user IDs from unknown ones.
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-bumbu/userauth"
+	"github.com/go-bumbu/userauth/auth/authz"
+	"github.com/go-bumbu/userauth/service/pat"
+	"github.com/go-bumbu/userauth/userstore/userdb"
+)
+
+// Action names an administrative operation.
+type Action string
+
+// The actions and the Operation.Detail keys they carry.
+const (
+	ActionList        Action = "list"         // no detail
+	ActionCreate      Action = "create"       // "login_id", "groups"
+	ActionEnable      Action = "enable"       // no detail
+	ActionDisable     Action = "disable"      // no detail
+	ActionDelete      Action = "delete"       // "login_id" of the deleted user, once looked up
+	ActionRename      Action = "rename"       // "login_id": the new one
+	ActionSetGroups   Action = "set_groups"   // "groups"
+	ActionResetTOTP   Action = "reset_totp"   // no detail
+	ActionListTokens  Action = "list_tokens"  // no detail
+	ActionRevokeToken Action = "revoke_token" // "token_id"
+)
+
+// Operation is one administrative request, as put to the Authorizer and
+// reported in its Event.
+type Operation struct {
+	Action Action
+	// Target is the user ID acted on; empty for ActionList, and for
+	// ActionCreate until the account exists.
+	Target string
+	// Detail holds the action's parameters, see the Action constants.
+	// Lists of values (groups) are comma-separated.
+	Detail map[string]string
+}
+
+// Authorizer decides whether the identity on r may perform op. false
+// denies it; an error is an internal failure.
+type Authorizer interface {
+	Allow(r *http.Request, op Operation) (bool, error)
+}
+
+// AuthorizerFunc adapts a function to the Authorizer interface.
+type AuthorizerFunc func(r *http.Request, op Operation) (bool, error)
+
+func (f AuthorizerFunc) Allow(r *http.Request, op Operation) (bool, error) { return f(r, op) }
+
+// Require allows every operation to unscoped identities (sessions, basic
+// auth) that meet req, e.g. Require(az, authz.RequireGroup("admin")).
+// Scoped identities, such as personal access tokens, are always denied: a
+// group check alone would let an admin's "read" token delete users. Use
+// RequireAdmin to admit tokens that carry an admin scope.
+func Require(az *authz.Authorizer, req authz.Requirement) Authorizer {
+	return allowIf(az, authz.RequireAll(unscoped, req))
+}
+
+// RequireAdmin allows every operation to members of group; scoped
+// identities must also carry scope.
+func RequireAdmin(az *authz.Authorizer, group, scope string) Authorizer {
+	return allowIf(az, authz.RequireAll(authz.RequireGroup(group), authz.RequireAnyScope(scope)))
+}
+
+func allowIf(az *authz.Authorizer, req authz.Requirement) Authorizer {
+	return AuthorizerFunc(func(r *http.Request, _ Operation) (bool, error) {
+		return az.Allowed(r, req)
+	})
+}
+
+// unscoped is met by identities that are not limited to scopes.
+func unscoped(p *authz.Principal) (bool, error) { return !p.Scoped(), nil }
+
+// Outcome is how an attempted operation ended.
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeDenied  Outcome = "denied" // Flow.Authorize refused it
+	OutcomeFailed  Outcome = "failed" // it was allowed but returned an error
+)
+
+// Event is the audit record of one attempted operation.
+type Event struct {
+	Operation
+	Time    time.Time
+	Actor   string // user ID of the identity that attempted it
+	Outcome Outcome
+	Err     error // set for OutcomeFailed
+}
+
+// Users is the user store the engine administers. userdb.Store satisfies
+// it.
+type Users interface {
+	userauth.UserGetter
+	userauth.UserLister
+	userauth.UserUpdater
+	userauth.GroupsGetter
+	userauth.GroupsSetter
+	// CreateUser writes the account with its enabled state, email and
+	// groups at once, so it never exists half-configured.
+	CreateUser(usr userdb.User) error
+	SetLoginID(userID, newLoginID string) error
+	Delete(userID string) error
+}
+
+// TOTPResetter turns a user's TOTP factor off. *totp.Service satisfies it.
+type TOTPResetter interface {
+	Disable(userID string) error
+}
+
+// RecoveryCodeClearer removes a user's recovery codes.
+// *recoverycodes.Service satisfies it.
+type RecoveryCodeClearer interface {
+	Clear(userID string) error
+}
+
+// TokenManager lists and revokes a user's personal access tokens.
+// *pat.Service satisfies it.
+type TokenManager interface {
+	List(userID string) ([]pat.TokenRecord, error)
+	Revoke(userID, tokenID string) error
+}
+
+// ErrNoIdentity is returned when the request carries no authenticated user.
+var ErrNoIdentity = errors.New("admin: no authenticated user in request")
+
+// ErrForbidden is returned when Flow.Authorize denies the operation.
+var ErrForbidden = errors.New("admin: operation not allowed")
+
+// ErrUserExists is returned by Create and Rename when the login ID is taken.
+var ErrUserExists = errors.New("admin: user already exists")
+
+// ErrNotConfigured is returned by the TOTP and token operations when the
+// Flow has no TOTP or Tokens.
+var ErrNotConfigured = errors.New("admin: operation not configured")
+
+// ValidationError is an input rejection (login ID format, password policy,
+// empty group names). Transports render Msg as a 400.
+type ValidationError struct {
+	Msg string
+}
+
+func (e *ValidationError) Error() string { return e.Msg }
+
+// User is a user as the engine returns it: the account and its groups.
+type User struct {
+	userauth.User
+	Groups []string
+}
+
+// Page is one page of List.
+type Page struct {
+	Users      []User
+	Total      int    // users matching the filters, ignoring paging
+	NextCursor string // see userauth.ListResult
+}
+
+// NewUser is the account Create makes.
+type NewUser struct {
+	LoginID  string
+	Password string // plaintext; the store hashes it
+	// Email defaults to LoginID when the username format is email.
+	Email string
+	// EmailVerified vouches for Email, sparing the user the verification.
+	EmailVerified bool
+	Enabled       bool
+	Groups        []string
+}
+
+// Flow is the administration engine. Users and Authorize are required.
+type Flow struct {
+	Users     Users      // required
+	Authorize Authorizer // required: decides every operation
+	// TOTP and RecoveryCodes are reset by ResetTOTP; without TOTP it
+	// returns ErrNotConfigured, without RecoveryCodes the codes are kept.
+	TOTP          TOTPResetter
+	RecoveryCodes RecoveryCodeClearer
+	// Tokens serves ListTokens and RevokeToken; without it they return
+	// ErrNotConfigured.
+	Tokens TokenManager
+	// Password rejects unacceptable passwords at Create; its error message
+	// is shown to the admin. Defaults to requiring a non-empty one.
+	Password       func(pw string) error
+	UsernameFormat userauth.UsernameFormat
+	// Audit receives every Event. Defaults to logging them at Info on
+	// Logger.
+	Audit  func(e Event)
+	Logger *slog.Logger // optional; defaults to slog.Default()
+}
+
+func (f *Flow) logger() *slog.Logger {
+	if f.Logger != nil {
+		return f.Logger
+	}
+	return slog.Default()
+}
+
+func (f *Flow) check() error {
+	if f.Users == nil || f.Authorize == nil {
+		return errors.New("admin: Users and Authorize are required")
+	}
+	return nil
+}
+
+// run authorizes op for the request's identity, performs it and reports
+// the attempt. do may fill in ev.Target and ev.Detail as it learns them.
+func (f *Flow) run(r *http.Request, op Operation, do func(ev *Event) error) error {
+	if err := f.check(); err != nil {
+		return err
+	}
+	id, ok := userauth.IdentityFromContext(r.Context())
+	if !ok {
+		return ErrNoIdentity
+	}
+	ev := Event{Operation: op, Actor: id.UserID}
+	allowed, err := f.Authorize.Allow(r, op)
+	switch {
+	case err != nil:
+		err = fmt.Errorf("admin: authorize: %w", err)
+		ev.Outcome, ev.Err = OutcomeFailed, err
+	case !allowed:
+		ev.Outcome, err = OutcomeDenied, ErrForbidden
+	default:
+		if err = do(&ev); err != nil {
+			ev.Outcome, ev.Err = OutcomeFailed, err
+		} else {
+			ev.Outcome = OutcomeSuccess
+		}
+	}
+	ev.Time = time.Now().UTC()
+	f.audit(ev)
+	return err
+}
+
+func (f *Flow) audit(ev Event) {
+	if f.Audit != nil {
+		f.Audit(ev)
+		return
+	}
+	args := []any{"action", ev.Action, "actor", ev.Actor, "target", ev.Target, "outcome", ev.Outcome}
+	for k, v := range ev.Detail {
+		args = append(args, k, v)
+	}
+	if ev.Err != nil {
+		args = append(args, "err", ev.Err)
+	}
+	f.logger().Info("admin: audit", args...)
+}
+
+// List returns a page of users matching opts, with their groups; see
+// userauth.ListOpts.
+func (f *Flow) List(r *http.Request, opts userauth.ListOpts) (Page, error) {
+	var page Page
+	err := f.run(r, Operation{Action: ActionList}, func(*Event) error {
+		res, err := f.Users.List(opts)
+		if err != nil {
+			return err
+		}
+		page = Page{Users: make([]User, 0, len(res.Users)), Total: res.Total, NextCursor: res.NextCursor}
+		for _, u := range res.Users {
+			usr, err := f.withGroups(u)
+			if err != nil {
+				return err
+			}
+			page.Users = append(page.Users, usr)
+		}
+		return nil
+	})
+	return page, err
+}
+
+// Create makes an account and returns it. A taken login ID is
+// ErrUserExists. The account is written in one step, already enabled or
+// disabled, with its email and groups.
+func (f *Flow) Create(r *http.Request, in NewUser) (User, error) {
+	if in.Email == "" && f.UsernameFormat == userauth.UsernameFormatEmail {
+		in.Email = in.LoginID
+	}
+	op := Operation{Action: ActionCreate, Detail: map[string]string{
+		"login_id": in.LoginID,
+		"groups":   strings.Join(in.Groups, ","),
+	}}
+	var usr User
+	err := f.run(r, op, func(ev *Event) error {
+		if err := f.validLoginID(in.LoginID); err != nil {
+			return err
+		}
+		if err := f.validatePassword(in.Password); err != nil {
+			return &ValidationError{Msg: err.Error()}
+		}
+		if err := validGroups(in.Groups); err != nil {
+			return err
+		}
+		if err := f.available(in.LoginID, ""); err != nil {
+			return err
+		}
+		err := f.Users.CreateUser(userdb.User{
+			LoginID:              in.LoginID,
+			Pw:                   in.Password,
+			Enabled:              in.Enabled,
+			PrimaryEmail:         in.Email,
+			PrimaryEmailVerified: in.Email != "" && in.EmailVerified,
+			Groups:               in.Groups,
+		})
+		if err != nil {
+			return fmt.Errorf("admin: create user: %w", err)
+		}
+		u, err := f.Users.GetUserByLogin(in.LoginID)
+		if err != nil {
+			return fmt.Errorf("admin: read back user: %w", err)
+		}
+		ev.Target = u.ID
+		usr, err = f.withGroups(u)
+		return err
+	})
+	return usr, err
+}
+
+// SetEnabled enables or disables the user; disabled users cannot log in.
+func (f *Flow) SetEnabled(r *http.Request, userID string, enabled bool) error {
+	action := ActionDisable
+	if enabled {
+		action = ActionEnable
+	}
+	return f.run(r, Operation{Action: action, Target: userID}, func(*Event) error {
+		if _, err := f.Users.GetUser(userID); err != nil {
+			return err
+		}
+		return f.Users.SetEnabled(userID, enabled)
+	})
+}
+
+// Delete removes the user and, with stores like userdb, everything that
+// belongs to them.
+func (f *Flow) Delete(r *http.Request, userID string) error {
+	return f.run(r, Operation{Action: ActionDelete, Target: userID}, func(ev *Event) error {
+		usr, err := f.Users.GetUser(userID)
+		if err != nil {
+			return err
+		}
+		ev.Detail = map[string]string{"login_id": usr.LoginID}
+		return f.Users.Delete(userID)
+	})
+}
+
+// Rename changes the user's login ID. The user ID, and with it sessions
+// and enrolments, stays the same.
+func (f *Flow) Rename(r *http.Request, userID, newLoginID string) error {
+	op := Operation{Action: ActionRename, Target: userID, Detail: map[string]string{"login_id": newLoginID}}
+	return f.run(r, op, func(*Event) error {
+		if err := f.validLoginID(newLoginID); err != nil {
+			return err
+		}
+		if _, err := f.Users.GetUser(userID); err != nil {
+			return err
+		}
+		if err := f.available(newLoginID, userID); err != nil {
+			return err
+		}
+		return f.Users.SetLoginID(userID, newLoginID)
+	})
+}
+
+// SetGroups replaces the user's group memberships; none removes them all.
+func (f *Flow) SetGroups(r *http.Request, userID string, groups []string) error {
+	op := Operation{Action: ActionSetGroups, Target: userID, Detail: map[string]string{"groups": strings.Join(groups, ",")}}
+	return f.run(r, op, func(*Event) error {
+		if err := validGroups(groups); err != nil {
+			return err
+		}
+		if _, err := f.Users.GetUser(userID); err != nil {
+			return err
+		}
+		return f.Users.SetGroups(userID, groups)
+	})
+}
+
+// ResetTOTP turns the user's TOTP factor off and clears their recovery
+// codes, for a user who lost their authenticator. They can enrol again
+// after the next login.
+func (f *Flow) ResetTOTP(r *http.Request, userID string) error {
+	return f.run(r, Operation{Action: ActionResetTOTP, Target: userID}, func(*Event) error {
+		if f.TOTP == nil {
+			return ErrNotConfigured
+		}
+		if _, err := f.Users.GetUser(userID); err != nil {
+			return err
+		}
+		if err := f.TOTP.Disable(userID); err != nil {
+			return err
+		}
+		if f.RecoveryCodes != nil {
+			return f.RecoveryCodes.Clear(userID)
+		}
+		return nil
+	})
+}
+
+// ListTokens returns the user's personal access tokens, oldest first.
+func (f *Flow) ListTokens(r *http.Request, userID string) ([]pat.TokenRecord, error) {
+	var recs []pat.TokenRecord
+	err := f.run(r, Operation{Action: ActionListTokens, Target: userID}, func(*Event) error {
+		if f.Tokens == nil {
+			return ErrNotConfigured
+		}
+		if _, err := f.Users.GetUser(userID); err != nil {
+			return err
+		}
+		var err error
+		recs, err = f.Tokens.List(userID)
+		return err
+	})
+	return recs, err
+}
+
+// RevokeToken deletes one of the user's personal access tokens; an unknown
+// token, or one of another user, is pat.ErrTokenNotFound.
+func (f *Flow) RevokeToken(r *http.Request, userID, tokenID string) error {
+	op := Operation{Action: ActionRevokeToken, Target: userID, Detail: map[string]string{"token_id": tokenID}}
+	return f.run(r, op, func(*Event) error {
+		if f.Tokens == nil {
+			return ErrNotConfigured
+		}
+		return f.Tokens.Revoke(userID, tokenID)
+	})
+}
+
+func (f *Flow) withGroups(u userauth.User) (User, error) {
+	groups, err := f.Users.GetGroups(u.ID)
+	if err != nil {
+		return User{}, fmt.Errorf("admin: groups: %w", err)
+	}
+	return User{User: u, Groups: groups}, nil
+}
+
+func (f *Flow) validLoginID(loginID string) error {
+	if strings.TrimSpace(loginID) == "" {
+		return &ValidationError{Msg: "login ID is required"}
+	}
+	if err := userauth.ValidateLoginID(loginID, f.UsernameFormat); err != nil {
+		return &ValidationError{Msg: err.Error()}
+	}
+	return nil
+}
+
+func (f *Flow) validatePassword(pw string) error {
+	if f.Password != nil {
+		return f.Password(pw)
+	}
+	if pw == "" {
+		return errors.New("password is required")
+	}
+	return nil
+}
+
+// available returns ErrUserExists when loginID belongs to a user other
+// than self.
+func (f *Flow) available(loginID, self string) error {
+	usr, err := f.Users.GetUserByLogin(loginID)
+	switch {
+	case errors.Is(err, userauth.ErrUserNotFound):
+		return nil
+	case err != nil:
+		return err
+	case usr.ID != self:
+		return ErrUserExists
+	}
+	return nil
+}
+
+func validGroups(groups []string) error {
+	for _, g := range groups {
+		if strings.TrimSpace(g) == "" {
+			return &ValidationError{Msg: "group names must not be empty"}
+		}
+	}
+	return nil
+}
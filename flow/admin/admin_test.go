@@ -0,0 +1,452 @@
+package admin_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-bumbu/userauth"
+	"github.com/go-bumbu/userauth/auth/authz"
+	"github.com/go-bumbu/userauth/flow/admin"
+	"github.com/go-bumbu/userauth/service/pat"
+	"github.com/go-bumbu/userauth/service/recoverycodes"
+	"github.com/go-bumbu/userauth/service/totp"
+	"github.com/go-bumbu/userauth/userstore/userdb"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type env struct {
+	flow   *admin.Flow
+	users  *userdb.Store
+	totp   *totp.Service
+	codes  *recoverycodes.Service
+	tokens *pat.Service
+	events []admin.Event
+	// admin is the user ID of the acting administrator, a member of "admin".
+	admin string
+}
+
+func newEnv(t *testing.T) *env {
+	t.Helper()
+	gdb, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := userdb.New(gdb, userdb.Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	totpSvc, err := totp.NewService(users.TOTPStore(), totp.Opts{Issuer: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := recoverycodes.NewService(users.RecoveryCodeStore(), recoverycodes.Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := pat.NewService(users.PATStore(), users, pat.Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &env{users: users, totp: totpSvc, codes: codes, tokens: tokens}
+	e.flow = &admin.Flow{
+		Users:         users,
+		Authorize:     admin.RequireAdmin(authz.New(authz.Cfg{Groups: users}), "admin", "admin"),
+		TOTP:          totpSvc,
+		RecoveryCodes: codes,
+		Tokens:        tokens,
+		Audit:         func(ev admin.Event) { e.events = append(e.events, ev) },
+	}
+	e.admin = e.mustCreate(t, userdb.User{LoginID: "root", Pw: "pw", Enabled: true, Groups: []string{"admin"}})
+	return e
+}
+
+func (e *env) mustCreate(t *testing.T, u userdb.User) string {
+	t.Helper()
+	if err := e.users.CreateUser(u); err != nil {
+		t.Fatal(err)
+	}
+	got, err := e.users.GetUserByLogin(u.LoginID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got.ID
+}
+
+// as returns a request acting for userID.
+func as(userID string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	return r.WithContext(userauth.ContextWithIdentity(r.Context(), userauth.Identity{UserID: userID}))
+}
+
+func (e *env) lastEvent(t *testing.T) admin.Event {
+	t.Helper()
+	if len(e.events) == 0 {
+		t.Fatal("no audit event")
+	}
+	return e.events[len(e.events)-1]
+}
+
+func TestUnwired(t *testing.T) {
+	f := &admin.Flow{}
+	if _, err := f.List(as("u1"), userauth.ListOpts{}); err == nil {
+		t.Error("flow without Users and Authorize must error")
+	}
+}
+
+func TestAccess(t *testing.T) {
+	e := newEnv(t)
+	bob := e.mustCreate(t, userdb.User{LoginID: "bob", Pw: "pw", Enabled: true})
+
+	// no identity: refused before the hooks run
+	if _, err := e.flow.List(httptest.NewRequest(http.MethodGet, "/", nil), userauth.ListOpts{}); !errors.Is(err, admin.ErrNoIdentity) {
+		t.Errorf("no identity: want ErrNoIdentity, got %v", err)
+	}
+	if len(e.events) != 0 {
+		t.Errorf("no identity: want no event, got %+v", e.events)
+	}
+
+	// a non-admin is denied, and the denial is audited
+	if err := e.flow.SetEnabled(as(bob), e.admin, false); !errors.Is(err, admin.ErrForbidden) {
+		t.Fatalf("non-admin: want ErrForbidden, got %v", err)
+	}
+	ev := e.lastEvent(t)
+	want := admin.Event{
+		Operation: admin.Operation{Action: admin.ActionDisable, Target: e.admin},
+		Actor:     bob,
+		Outcome:   admin.OutcomeDenied,
+	}
+	if diff := cmp.Diff(want, ev, cmpopts.IgnoreFields(admin.Event{}, "Time")); diff != "" {
+		t.Errorf("denied event (-want +got):\n%s", diff)
+	}
+	if ev.Time.IsZero() {
+		t.Error("event time not set")
+	}
+	usr, _ := e.users.GetUser(e.admin)
+	if !usr.Enabled {
+		t.Error("denied operation must not run")
+	}
+
+	// the authorizer sees the operation: nobody deletes themselves
+	e.flow.Authorize = admin.AuthorizerFunc(func(r *http.Request, op admin.Operation) (bool, error) {
+		id, _ := userauth.IdentityFromContext(r.Context())
+		return op.Action != admin.ActionDelete || op.Target != id.UserID, nil
+	})
+	if err := e.flow.Delete(as(e.admin), e.admin); !errors.Is(err, admin.ErrForbidden) {
+		t.Errorf("self delete: want ErrForbidden, got %v", err)
+	}
+	if err := e.flow.Delete(as(e.admin), bob); err != nil {
+		t.Errorf("delete other: %v", err)
+	}
+
+	// authorizer failures are internal errors
+	e.flow.Authorize = admin.AuthorizerFunc(func(*http.Request, admin.Operation) (bool, error) {
+		return false, errors.New("boom")
+	})
+	err := e.flow.SetGroups(as(e.admin), e.admin, nil)
+	if err == nil || errors.Is(err, admin.ErrForbidden) {
+		t.Errorf("authorizer error: want internal error, got %v", err)
+	}
+	if ev := e.lastEvent(t); ev.Outcome != admin.OutcomeFailed || ev.Err == nil {
+		t.Errorf("authorizer error: want failed event, got %+v", ev)
+	}
+}
+
+func TestScopedAccess(t *testing.T) {
+	tcs := []struct {
+		name    string
+		id      userauth.Identity
+		require bool // authorize with Require(az, RequireGroup("admin")) instead of RequireAdmin
+		allow   bool
+	}{
+		{name: "session", id: userauth.Identity{}, allow: true},
+		{name: "admin scope", id: userauth.Identity{Scoped: true, Scopes: []string{"read", "admin"}}, allow: true},
+		{name: "read scope", id: userauth.Identity{Scoped: true, Scopes: []string{"read"}}},
+		{name: "no scopes", id: userauth.Identity{Scoped: true}},
+		{name: "require: session", id: userauth.Identity{}, require: true, allow: true},
+		{name: "require: read scope", id: userauth.Identity{Scoped: true, Scopes: []string{"read"}}, require: true},
+		{name: "require: admin scope", id: userauth.Identity{Scoped: true, Scopes: []string{"admin"}}, require: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			e := newEnv(t)
+			if tc.require {
+				e.flow.Authorize = admin.Require(authz.New(authz.Cfg{Groups: e.users}), authz.RequireGroup("admin"))
+			}
+			bob := e.mustCreate(t, userdb.User{LoginID: "bob", Pw: "pw", Enabled: true})
+			tc.id.UserID = e.admin
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r = r.WithContext(userauth.ContextWithIdentity(r.Context(), tc.id))
+
+			err := e.flow.Delete(r, bob)
+			if tc.allow && err != nil {
+				t.Fatalf("want allowed, got %v", err)
+			}
+			if !tc.allow && !errors.Is(err, admin.ErrForbidden) {
+				t.Fatalf("want ErrForbidden, got %v", err)
+			}
+			if _, err := e.users.GetUser(bob); (err == nil) == tc.allow {
+				t.Errorf("user deleted = %v, want %v", err != nil, tc.allow)
+			}
+		})
+	}
+}
+
+func TestCreate(t *testing.T) {
+	e := newEnv(t)
+	r := as(e.admin)
+
+	usr, err := e.flow.Create(r, admin.NewUser{
+		LoginID:       "alice",
+		Password:      "pw",
+		Email:         "alice@example.com",
+		EmailVerified: true,
+		Enabled:       true,
+		Groups:        []string{"ops"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := admin.User{
+		User: userauth.User{
+			ID: usr.ID, LoginID: "alice", Enabled: true,
+			PrimaryEmail: "alice@example.com", PrimaryEmailVerified: true,
+		},
+		Groups: []string{"ops"},
+	}
+	if diff := cmp.Diff(want, usr, cmpopts.IgnoreFields(userauth.User{}, "HashPw")); diff != "" {
+		t.Errorf("created user (-want +got):\n%s", diff)
+	}
+	ev := e.lastEvent(t)
+	if ev.Outcome != admin.OutcomeSuccess || ev.Target != usr.ID || ev.Detail["login_id"] != "alice" || ev.Detail["groups"] != "ops" {
+		t.Errorf("unexpected create event: %+v", ev)
+	}
+
+	// a disabled account stays disabled even when the store enables by default
+	usr, err = e.flow.Create(r, admin.NewUser{LoginID: "held", Password: "pw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usr.Enabled {
+		t.Error("want disabled account")
+	}
+
+	tcs := []struct {
+		name string
+		in   admin.NewUser
+		want func(error) bool
+	}{
+		{"taken", admin.NewUser{LoginID: "alice", Password: "pw"}, func(err error) bool { return errors.Is(err, admin.ErrUserExists) }},
+		{"no password", admin.NewUser{LoginID: "carol"}, isValidation},
+		{"empty login", admin.NewUser{Password: "pw"}, isValidation},
+		{"empty group", admin.NewUser{LoginID: "carol", Password: "pw", Groups: []string{" "}}, isValidation},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := e.flow.Create(r, tc.in); !tc.want(err) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if ev := e.lastEvent(t); ev.Outcome != admin.OutcomeFailed {
+				t.Errorf("want failed event, got %+v", ev)
+			}
+		})
+	}
+	if _, err := e.users.GetUserByLogin("carol"); !errors.Is(err, userauth.ErrUserNotFound) {
+		t.Errorf("rejected create must not leave a user, got %v", err)
+	}
+
+	// the account is written in one step, never configured afterwards
+	spy := &updateSpy{Store: e.users}
+	e.flow.Users = spy
+	if _, err := e.flow.Create(r, admin.NewUser{LoginID: "dave", Password: "pw", Email: "dave@example.com", Groups: []string{"ops"}}); err != nil {
+		t.Fatal(err)
+	}
+	if spy.updates != 0 {
+		t.Errorf("want no updates after the create, got %d", spy.updates)
+	}
+}
+
+// updateSpy counts the updates that would configure an account after it was
+// created.
+type updateSpy struct {
+	*userdb.Store
+	updates int
+}
+
+func (s *updateSpy) SetEnabled(userID string, enabled bool) error {
+	s.updates++
+	return s.Store.SetEnabled(userID, enabled)
+}
+
+func (s *updateSpy) SetPrimaryEmail(userID, email string) error {
+	s.updates++
+	return s.Store.SetPrimaryEmail(userID, email)
+}
+
+func (s *updateSpy) SetPrimaryEmailVerified(userID string, verified bool) error {
+	s.updates++
+	return s.Store.SetPrimaryEmailVerified(userID, verified)
+}
+
+func (s *updateSpy) SetGroups(userID string, groups []string) error {
+	s.updates++
+	return s.Store.SetGroups(userID, groups)
+}
+
+func TestCreateEmailLogin(t *testing.T) {
+	e := newEnv(t)
+	e.flow.UsernameFormat = userauth.UsernameFormatEmail
+
+	if _, err := e.flow.Create(as(e.admin), admin.NewUser{LoginID: "dave", Password: "pw"}); !isValidation(err) {
+		t.Errorf("non-email login: want ValidationError, got %v", err)
+	}
+	usr, err := e.flow.Create(as(e.admin), admin.NewUser{LoginID: "dave@example.com", Password: "pw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usr.PrimaryEmail != "dave@example.com" || usr.PrimaryEmailVerified {
+		t.Errorf("want unverified email from login ID, got %+v", usr.User)
+	}
+}
+
+func TestManageUser(t *testing.T) {
+	e := newEnv(t)
+	r := as(e.admin)
+	bob := e.mustCreate(t, userdb.User{LoginID: "bob", Pw: "pw", Enabled: true})
+	e.mustCreate(t, userdb.User{LoginID: "carol", Pw: "pw", Enabled: true})
+
+	if err := e.flow.SetEnabled(r, bob, false); err != nil {
+		t.Fatal(err)
+	}
+	if usr, _ := e.users.GetUser(bob); usr.Enabled {
+		t.Error("disable: user still enabled")
+	}
+	if err := e.flow.SetEnabled(r, bob, true); err != nil {
+		t.Fatal(err)
+	}
+	if ev := e.lastEvent(t); ev.Action != admin.ActionEnable {
+		t.Errorf("want enable event, got %+v", ev)
+	}
+
+	if err := e.flow.Rename(r, bob, "carol"); !errors.Is(err, admin.ErrUserExists) {
+		t.Errorf("rename to taken: want ErrUserExists, got %v", err)
+	}
+	if err := e.flow.Rename(r, bob, "bob"); err != nil {
+		t.Errorf("rename to own login ID: %v", err)
+	}
+	if err := e.flow.Rename(r, bob, "robert"); err != nil {
+		t.Fatal(err)
+	}
+	if usr, _ := e.users.GetUser(bob); usr.LoginID != "robert" {
+		t.Errorf("rename: want robert, got %q", usr.LoginID)
+	}
+
+	if err := e.flow.SetGroups(r, bob, []string{"ops", "dev"}); err != nil {
+		t.Fatal(err)
+	}
+	page, err := e.flow.List(r, userauth.ListOpts{Search: "robert"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Users) != 1 || page.Total != 1 {
+		t.Fatalf("search: want robert only, got %+v", page)
+	}
+	if diff := cmp.Diff([]string{"dev", "ops"}, page.Users[0].Groups, cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+		t.Errorf("groups (-want +got):\n%s", diff)
+	}
+
+	if err := e.flow.Delete(r, bob); err != nil {
+		t.Fatal(err)
+	}
+	if ev := e.lastEvent(t); ev.Detail["login_id"] != "robert" {
+		t.Errorf("delete event: want login_id robert, got %+v", ev.Detail)
+	}
+
+	// operations on an unknown user find nothing
+	for name, op := range map[string]func() error{
+		"enable": func() error { return e.flow.SetEnabled(r, bob, true) },
+		"delete": func() error { return e.flow.Delete(r, bob) },
+		"rename": func() error { return e.flow.Rename(r, bob, "bobby") },
+		"groups": func() error { return e.flow.SetGroups(r, bob, nil) },
+		"totp":   func() error { return e.flow.ResetTOTP(r, bob) },
+		"tokens": func() error { _, err := e.flow.ListTokens(r, bob); return err },
+		"revoke": func() error { return e.flow.RevokeToken(r, bob, "x") },
+	} {
+		err := op()
+		if !errors.Is(err, userauth.ErrUserNotFound) && !errors.Is(err, pat.ErrTokenNotFound) {
+			t.Errorf("%s unknown user: want not found, got %v", name, err)
+		}
+	}
+}
+
+func TestResetTOTP(t *testing.T) {
+	e := newEnv(t)
+	r := as(e.admin)
+	bob := e.mustCreate(t, userdb.User{LoginID: "bob", Pw: "pw", Enabled: true})
+	if err := e.users.TOTPStore().Set(bob, totp.Record{Secret: "s", Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.codes.Issue(bob); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.flow.ResetTOTP(r, bob); err != nil {
+		t.Fatal(err)
+	}
+	if on, _ := e.totp.Enabled(bob); on {
+		t.Error("TOTP still enabled")
+	}
+	if n, _ := e.codes.Remaining(bob); n != 0 {
+		t.Errorf("want recovery codes cleared, %d left", n)
+	}
+
+	e.flow.TOTP = nil
+	if err := e.flow.ResetTOTP(r, bob); !errors.Is(err, admin.ErrNotConfigured) {
+		t.Errorf("no TOTP: want ErrNotConfigured, got %v", err)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	e := newEnv(t)
+	r := as(e.admin)
+	bob := e.mustCreate(t, userdb.User{LoginID: "bob", Pw: "pw", Enabled: true})
+	_, rec, err := e.tokens.Mint(bob, "ci", nil, nil, pat.HashOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recs, err := e.flow.ListTokens(r, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].TokenID != rec.TokenID {
+		t.Fatalf("want bob's token, got %+v", recs)
+	}
+	if err := e.flow.RevokeToken(r, e.admin, rec.TokenID); !errors.Is(err, pat.ErrTokenNotFound) {
+		t.Errorf("revoke as other user: want ErrTokenNotFound, got %v", err)
+	}
+	if err := e.flow.RevokeToken(r, bob, rec.TokenID); err != nil {
+		t.Fatal(err)
+	}
+	if ev := e.lastEvent(t); ev.Action != admin.ActionRevokeToken || ev.Detail["token_id"] != rec.TokenID {
+		t.Errorf("unexpected revoke event: %+v", ev)
+	}
+	if recs, _ := e.flow.ListTokens(r, bob); len(recs) != 0 {
+		t.Errorf("want no tokens left, got %+v", recs)
+	}
+
+	e.flow.Tokens = nil
+	if _, err := e.flow.ListTokens(r, bob); !errors.Is(err, admin.ErrNotConfigured) {
+		t.Errorf("no Tokens: want ErrNotConfigured, got %v", err)
+	}
+}
+
+func isValidation(err error) bool {
+	var ve *admin.ValidationError
+	return errors.As(err, &ve)
+}
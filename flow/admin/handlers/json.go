@@ -0,0 +1,433 @@
+// Package handlers provides JSON endpoints over an admin.Flow: list and
+// search users, create, enable, disable, rename and delete them, set their
+// groups, reset their TOTP factor and recovery codes, and list and revoke
+// their personal access tokens.
+//
+// Unlike the other admin endpoints in this module, these do their own
+// authorization: every request goes through the flow's Authorize and is
+// audited. Mount them behind the auth chain, which stores the identity the
+// flow acts for; without one they answer 401.
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-bumbu/userauth"
+	"github.com/go-bumbu/userauth/auth/csrf"
+	"github.com/go-bumbu/userauth/flow/admin"
+	"github.com/go-bumbu/userauth/service/pat"
+)
+
+// JSON exposes an admin.Flow as JSON endpoints.
+type JSON struct {
+	Flow   *admin.Flow
+	Logger *slog.Logger
+	CSRF   *csrf.Protector // optional; every POST endpoint must pass its checks
+}
+
+// User is one user as the endpoints show it.
+type User struct {
+	ID            string   `json:"id"`
+	LoginID       string   `json:"login_id"`
+	Enabled       bool     `json:"enabled"`
+	Email         string   `json:"email,omitempty"`
+	EmailVerified bool     `json:"email_verified"`
+	Groups        []string `json:"groups"`
+}
+
+// ListResponse is the body of a successful list. NextCursor, passed back
+// as the cursor parameter, fetches the next page; absent on the last one.
+type ListResponse struct {
+	Users      []User `json:"users"`
+	Total      int    `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// CreatePayload is the request body for CreateHandler; see admin.NewUser.
+type CreatePayload struct {
+	LoginID       string   `json:"login_id"`
+	Password      string   `json:"password"`
+	Email         string   `json:"email,omitempty"`
+	EmailVerified bool     `json:"email_verified,omitempty"`
+	Enabled       bool     `json:"enabled,omitempty"`
+	Groups        []string `json:"groups,omitempty"`
+}
+
+// UserPayload is the request body for the endpoints acting on one user.
+// LoginID is the new login ID for RenameHandler, Groups the new groups for
+// GroupsHandler and TokenID the token for RevokeTokenHandler; the other
+// endpoints ignore them.
+type UserPayload struct {
+	UserID  string   `json:"user_id"`
+	LoginID string   `json:"login_id,omitempty"`
+	Groups  []string `json:"groups,omitempty"`
+	TokenID string   `json:"token_id,omitempty"`
+}
+
+// Token is one personal access token's metadata; never its secret.
+type Token struct {
+	TokenID    string     `json:"token_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TokensResponse is the body of a successful token list.
+type TokensResponse struct {
+	Tokens []Token `json:"tokens"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func toUser(u admin.User) User {
+	groups := u.Groups
+	if groups == nil {
+		groups = []string{}
+	}
+	return User{
+		ID:            u.ID,
+		LoginID:       u.LoginID,
+		Enabled:       u.Enabled,
+		Email:         u.PrimaryEmail,
+		EmailVerified: u.PrimaryEmailVerified,
+		Groups:        groups,
+	}
+}
+
+// ListHandler returns the GET endpoint listing users, one page at a time.
+// Every query parameter is optional:
+//
+//   - search: substring of the login ID, email or name
+//   - enabled, second_factor: true or false
+//   - group: member of the group
+//   - created_after, created_before: RFC 3339 times
+//   - sort: login_id (default), name, email or created_at
+//   - order: asc (default) or desc
+//   - limit, offset: page size and rows to skip
+//   - cursor: next_cursor of the previous page, with the same sort and order
+//
+// Responses:
+//   - 200 ListResponse
+//   - 400 for a malformed parameter or cursor
+//   - 401 when the request carries no identity
+//   - 403 when the flow's Authorize denies it
+//   - 405 for non-GET requests
+//   - 500 for store failures
+func (h *JSON) ListHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		opts, msg := listOpts(r)
+		if msg != "" {
+			h.writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+		page, err := h.Flow.List(r, opts)
+		if err != nil {
+			h.writeFlowError(w, err)
+			return
+		}
+		out := ListResponse{Users: make([]User, 0, len(page.Users)), Total: page.Total, NextCursor: page.NextCursor}
+		for _, u := range page.Users {
+			out.Users = append(out.Users, toUser(u))
+		}
+		h.writeJSON(w, http.StatusOK, out)
+	})
+}
+
+// listOpts parses the ListHandler query; msg describes a malformed one.
+func listOpts(r *http.Request) (opts userauth.ListOpts, msg string) {
+	q := r.URL.Query()
+	opts.Search = q.Get("search")
+	opts.Group = q.Get("group")
+	opts.Cursor = q.Get("cursor")
+	for name, dst := range map[string]**bool{"enabled": &opts.Enabled, "second_factor": &opts.SecondFactor} {
+		if v := q.Get(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return opts, name + " must be true or false"
+			}
+			*dst = &b
+		}
+	}
+	for name, dst := range map[string]*time.Time{"created_after": &opts.CreatedAfter, "created_before": &opts.CreatedBefore} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return opts, name + " must be an RFC 3339 time"
+			}
+			*dst = t
+		}
+	}
+	for name, dst := range map[string]*int{"limit": &opts.Limit, "offset": &opts.Offset} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return opts, name + " must be a non-negative number"
+			}
+			*dst = n
+		}
+	}
+	switch sort := userauth.SortField(q.Get("sort")); sort {
+	case "", userauth.SortLoginID, userauth.SortName, userauth.SortEmail, userauth.SortCreatedAt:
+		opts.Sort = sort
+	default:
+		return opts, "sort must be login_id, name, email or created_at"
+	}
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		return opts, "order must be asc or desc"
+	}
+	return opts, ""
+}
+
+// CreateHandler returns the POST endpoint creating a user.
+//
+// Responses:
+//   - 201 User
+//   - 400 for a malformed body, login ID or group, or a rejected password
+//   - 401 when the request carries no identity
+//   - 403 when the flow's Authorize denies it
+//   - 405 for non-POST requests
+//   - 409 when the login ID is taken
+//   - 500 for store failures
+func (h *JSON) CreateHandler() http.Handler {
+	return h.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		var p CreatePayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			h.writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		usr, err := h.Flow.Create(r, admin.NewUser{
+			LoginID:       p.LoginID,
+			Password:      p.Password,
+			Email:         p.Email,
+			EmailVerified: p.EmailVerified,
+			Enabled:       p.Enabled,
+			Groups:        p.Groups,
+		})
+		if err != nil {
+			h.writeFlowError(w, err)
+			return
+		}
+		h.writeJSON(w, http.StatusCreated, toUser(usr))
+	}))
+}
+
+// EnableHandler returns the POST endpoint enabling a user.
+//
+// Responses:
+//   - 204 on success
+//   - 400 for a malformed body or missing user_id
+//   - 401 when the request carries no identity
+//   - 403 when the flow's Authorize denies it
+//   - 404 for an unknown user
+//   - 405 for non-POST requests
+//   - 500 for store failures
+func (h *JSON) EnableHandler() http.Handler {
+	return h.withUser(func(r *http.Request, p UserPayload) error {
+		return h.Flow.SetEnabled(r, p.UserID, true)
+	})
+}
+
+// DisableHandler returns the POST endpoint disabling a user; responses as
+// for EnableHandler.
+func (h *JSON) DisableHandler() http.Handler {
+	return h.withUser(func(r *http.Request, p UserPayload) error {
+		return h.Flow.SetEnabled(r, p.UserID, false)
+	})
+}
+
+// DeleteHandler returns the POST endpoint deleting a user; responses as
+// for EnableHandler.
+func (h *JSON) DeleteHandler() http.Handler {
+	return h.withUser(func(r *http.Request, p UserPayload) error {
+		return h.Flow.Delete(r, p.UserID)
+	})
+}
+
+// RenameHandler returns the POST endpoint changing a user's login ID to
+// the payload's login_id.
+//
+// Responses:
+//   - 204 on success
+//   - 400 for a malformed body, missing user_id or invalid login_id
+//   - 401 when the request carries no identity
+//   - 403 when the flow's Authorize denies it
+//   - 404 for an unknown user
+//   - 405 for non-POST requests
+//   - 409 when the login ID is taken
+//   - 500 for store failures
+func (h *JSON) RenameHandler() http.Handler {
+	return h.withUser(func(r *http.Request, p UserPayload) error {
+		return h.Flow.Rename(r, p.UserID, p.LoginID)
+	})
+}
+
+// GroupsHandler returns the POST endpoint replacing a user's groups with
+// the payload's groups; none removes them all. Responses as for
+// EnableHandler, plus 400 for an empty group name.
+func (h *JSON) GroupsHandler() http.Handler {
+	return h.withUser(func(r *http.Request, p UserPayload) error {
+		return h.Flow.SetGroups(r, p.UserID, p.Groups)
+	})
+}
+
+// ResetTOTPHandler returns the POST endpoint turning a user's TOTP factor
+// off and clearing their recovery codes. Responses as for EnableHandler;
+// 404 also when the flow has no TOTP.
+func (h *JSON) ResetTOTPHandler() http.Handler {
+	return h.withUser(func(r *http.Request, p UserPayload) error {
+		return h.Flow.ResetTOTP(r, p.UserID)
+	})
+}
+
+// RevokeTokenHandler returns the POST endpoint revoking the payload's
+// token_id of a user. Responses as for EnableHandler; 404 also for a token
+// the user does not own, and when the flow has no Tokens.
+func (h *JSON) RevokeTokenHandler() http.Handler {
+	return h.withUser(func(r *http.Request, p UserPayload) error {
+		if p.TokenID == "" {
+			return &admin.ValidationError{Msg: "token_id is required"}
+		}
+		return h.Flow.RevokeToken(r, p.UserID, p.TokenID)
+	})
+}
+
+// TokensHandler returns the GET endpoint listing the personal access
+// tokens of the user in the user_id query parameter, oldest first.
+//
+// Responses:
+//   - 200 TokensResponse
+//   - 400 for a missing user_id
+//   - 401 when the request carries no identity
+//   - 403 when the flow's Authorize denies it
+//   - 404 for an unknown user, or when the flow has no Tokens
+//   - 405 for non-GET requests
+//   - 500 for store failures
+func (h *JSON) TokensHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		userID := r.URL.Query().Get("user_id")
+		if userID == "" {
+			h.writeError(w, http.StatusBadRequest, "user_id is required")
+			return
+		}
+		recs, err := h.Flow.ListTokens(r, userID)
+		if err != nil {
+			h.writeFlowError(w, err)
+			return
+		}
+		out := TokensResponse{Tokens: make([]Token, 0, len(recs))}
+		for _, rec := range recs {
+			out.Tokens = append(out.Tokens, Token{
+				TokenID:    rec.TokenID,
+				Name:       rec.Name,
+				Scopes:     rec.Scopes,
+				ExpiresAt:  rec.ExpiresAt,
+				LastUsedAt: rec.LastUsedAt,
+				CreatedAt:  rec.CreatedAt,
+			})
+		}
+		h.writeJSON(w, http.StatusOK, out)
+	})
+}
+
+// withUser is the shared body of the POST endpoints taking a UserPayload
+// and answering 204.
+func (h *JSON) withUser(do func(*http.Request, UserPayload) error) http.Handler {
+	return h.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		var p UserPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			h.writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if p.UserID == "" {
+			h.writeError(w, http.StatusBadRequest, "user_id is required")
+			return
+		}
+		if err := do(r, p); err != nil {
+			h.writeFlowError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+// writeFlowError maps Flow errors to HTTP responses.
+func (h *JSON) writeFlowError(w http.ResponseWriter, err error) {
+	var ve *admin.ValidationError
+	switch {
+	case errors.As(err, &ve):
+		h.writeError(w, http.StatusBadRequest, ve.Msg)
+	case errors.Is(err, userauth.ErrInvalidCursor):
+		h.writeError(w, http.StatusBadRequest, "invalid cursor")
+	case errors.Is(err, admin.ErrNoIdentity):
+		h.writeError(w, http.StatusUnauthorized, "unauthorized")
+	case errors.Is(err, admin.ErrForbidden):
+		h.writeError(w, http.StatusForbidden, "forbidden")
+	case errors.Is(err, userauth.ErrUserNotFound):
+		h.writeError(w, http.StatusNotFound, "user not found")
+	case errors.Is(err, pat.ErrTokenNotFound):
+		h.writeError(w, http.StatusNotFound, "token not found")
+	case errors.Is(err, admin.ErrNotConfigured):
+		h.writeError(w, http.StatusNotFound, "not configured")
+	case errors.Is(err, admin.ErrUserExists):
+		h.writeError(w, http.StatusConflict, "user already exists")
+	default:
+		h.logger().Error("admin handler: internal error", "err", err)
+		h.writeError(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+func (h *JSON) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.logger().Error("admin handler: encode response", "err", err)
+	}
+}
+
+func (h *JSON) writeError(w http.ResponseWriter, status int, msg string) {
+	h.writeJSON(w, status, errorResponse{Error: msg})
+}
+
+// protect wraps next in the CSRF middleware when one is configured.
+func (h *JSON) protect(next http.Handler) http.Handler {
+	if h.CSRF == nil {
+		return next
+	}
+	return h.CSRF.Middleware(next)
+}
+
+func (h *JSON) logger() *slog.Logger {
+	if h.Logger != nil {
+		return h.Logger
+	}
+	return slog.Default()
+}
@@ -0,0 +1,292 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-bumbu/userauth"
+	"github.com/go-bumbu/userauth/auth/authz"
+	"github.com/go-bumbu/userauth/flow/admin"
+	"github.com/go-bumbu/userauth/flow/admin/handlers"
+	"github.com/go-bumbu/userauth/service/pat"
+	"github.com/go-bumbu/userauth/service/recoverycodes"
+	"github.com/go-bumbu/userauth/service/totp"
+	"github.com/go-bumbu/userauth/userstore/userdb"
+	"github.com/google/go-cmp/cmp"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type fixture struct {
+	h      *handlers.JSON
+	users  *userdb.Store
+	tokens *pat.Service
+	admin  string // user ID of a member of "admin"
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	gdb, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := userdb.New(gdb, userdb.Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	totpSvc, err := totp.NewService(users.TOTPStore(), totp.Opts{Issuer: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := recoverycodes.NewService(users.RecoveryCodeStore(), recoverycodes.Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := pat.NewService(users.PATStore(), users, pat.Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fixture{users: users, tokens: tokens}
+	f.h = &handlers.JSON{
+		Flow: &admin.Flow{
+			Users:         users,
+			Authorize:     admin.RequireAdmin(authz.New(authz.Cfg{Groups: users}), "admin", "admin"),
+			TOTP:          totpSvc,
+			RecoveryCodes: codes,
+			Tokens:        tokens,
+			Audit:         func(admin.Event) {},
+		},
+		Logger: slog.New(slog.DiscardHandler),
+	}
+	f.admin = f.create(t, userdb.User{LoginID: "root", Pw: "pw", Enabled: true, Groups: []string{"admin"}})
+	return f
+}
+
+func (f *fixture) create(t *testing.T, u userdb.User) string {
+	t.Helper()
+	if err := f.users.CreateUser(u); err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.users.GetUserByLogin(u.LoginID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got.ID
+}
+
+func do(t *testing.T, h http.Handler, method, target, userID string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, target, &buf)
+	if userID != "" {
+		req = req.WithContext(userauth.ContextWithIdentity(req.Context(), userauth.Identity{UserID: userID}))
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.NewDecoder(rec.Body).Decode(&v); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return v
+}
+
+func TestList(t *testing.T) {
+	f := newFixture(t)
+	f.create(t, userdb.User{LoginID: "alice", Pw: "pw", Enabled: true, PrimaryEmail: "alice@example.com"})
+	f.create(t, userdb.User{LoginID: "bob", Pw: "pw"})
+	list := f.h.ListHandler()
+
+	rec := do(t, list, http.MethodGet, "/users?enabled=true&order=desc", f.admin, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("want 200, got %d: %s", rec.Code, rec.Body)
+	}
+	got := decode[handlers.ListResponse](t, rec)
+	want := handlers.ListResponse{
+		Users: []handlers.User{
+			{ID: f.admin, LoginID: "root", Enabled: true, Groups: []string{"admin"}},
+			{ID: got.Users[1].ID, LoginID: "alice", Enabled: true, Email: "alice@example.com", Groups: []string{}},
+		},
+		Total: 2,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("list (-want +got):\n%s", diff)
+	}
+
+	// cursor paging
+	var logins []string
+	target := "/users?limit=2"
+	for {
+		rec := do(t, list, http.MethodGet, target, f.admin, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("page: want 200, got %d: %s", rec.Code, rec.Body)
+		}
+		page := decode[handlers.ListResponse](t, rec)
+		for _, u := range page.Users {
+			logins = append(logins, u.LoginID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		target = "/users?limit=2&cursor=" + page.NextCursor
+	}
+	if diff := cmp.Diff([]string{"alice", "bob", "root"}, logins); diff != "" {
+		t.Errorf("paged logins (-want +got):\n%s", diff)
+	}
+
+	tcs := []struct {
+		name   string
+		target string
+		userID string
+		want   int
+	}{
+		{"bad bool", "/users?enabled=maybe", f.admin, http.StatusBadRequest},
+		{"bad time", "/users?created_after=yesterday", f.admin, http.StatusBadRequest},
+		{"bad sort", "/users?sort=password", f.admin, http.StatusBadRequest},
+		{"bad order", "/users?order=up", f.admin, http.StatusBadRequest},
+		{"bad limit", "/users?limit=-1", f.admin, http.StatusBadRequest},
+		{"bad cursor", "/users?cursor=nope", f.admin, http.StatusBadRequest},
+		{"no identity", "/users", "", http.StatusUnauthorized},
+		{"not admin", "/users", got.Users[1].ID, http.StatusForbidden},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if rec := do(t, list, http.MethodGet, tc.target, tc.userID, nil); rec.Code != tc.want {
+				t.Errorf("want %d, got %d: %s", tc.want, rec.Code, rec.Body)
+			}
+		})
+	}
+	if rec := do(t, list, http.MethodPost, "/users", f.admin, nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: want 405, got %d", rec.Code)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	f := newFixture(t)
+	create := f.h.CreateHandler()
+
+	rec := do(t, create, http.MethodPost, "/users", f.admin, handlers.CreatePayload{
+		LoginID: "alice", Password: "pw", Email: "alice@example.com", Enabled: true, Groups: []string{"ops"},
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("want 201, got %d: %s", rec.Code, rec.Body)
+	}
+	got := decode[handlers.User](t, rec)
+	want := handlers.User{ID: got.ID, LoginID: "alice", Enabled: true, Email: "alice@example.com", Groups: []string{"ops"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("created (-want +got):\n%s", diff)
+	}
+
+	tcs := []struct {
+		name string
+		body any
+		want int
+	}{
+		{"taken", handlers.CreatePayload{LoginID: "alice", Password: "pw"}, http.StatusConflict},
+		{"no password", handlers.CreatePayload{LoginID: "bob"}, http.StatusBadRequest},
+		{"malformed", "not an object", http.StatusBadRequest},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if rec := do(t, create, http.MethodPost, "/users", f.admin, tc.body); rec.Code != tc.want {
+				t.Errorf("want %d, got %d: %s", tc.want, rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestUserActions(t *testing.T) {
+	f := newFixture(t)
+	bob := f.create(t, userdb.User{LoginID: "bob", Pw: "pw", Enabled: true})
+	f.create(t, userdb.User{LoginID: "carol", Pw: "pw"})
+	_, tok, err := f.tokens.Mint(bob, "ci", nil, nil, pat.HashOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		name    string
+		handler http.Handler
+		body    any
+		want    int
+	}{
+		{"disable", f.h.DisableHandler(), handlers.UserPayload{UserID: bob}, http.StatusNoContent},
+		{"enable", f.h.EnableHandler(), handlers.UserPayload{UserID: bob}, http.StatusNoContent},
+		{"enable unknown", f.h.EnableHandler(), handlers.UserPayload{UserID: "nobody"}, http.StatusNotFound},
+		{"missing user", f.h.EnableHandler(), handlers.UserPayload{}, http.StatusBadRequest},
+		{"rename taken", f.h.RenameHandler(), handlers.UserPayload{UserID: bob, LoginID: "carol"}, http.StatusConflict},
+		{"rename empty", f.h.RenameHandler(), handlers.UserPayload{UserID: bob}, http.StatusBadRequest},
+		{"rename", f.h.RenameHandler(), handlers.UserPayload{UserID: bob, LoginID: "robert"}, http.StatusNoContent},
+		{"groups", f.h.GroupsHandler(), handlers.UserPayload{UserID: bob, Groups: []string{"ops"}}, http.StatusNoContent},
+		{"empty group", f.h.GroupsHandler(), handlers.UserPayload{UserID: bob, Groups: []string{""}}, http.StatusBadRequest},
+		{"reset totp", f.h.ResetTOTPHandler(), handlers.UserPayload{UserID: bob}, http.StatusNoContent},
+		{"revoke no token", f.h.RevokeTokenHandler(), handlers.UserPayload{UserID: bob}, http.StatusBadRequest},
+		{"revoke unknown", f.h.RevokeTokenHandler(), handlers.UserPayload{UserID: bob, TokenID: "nope"}, http.StatusNotFound},
+		{"revoke", f.h.RevokeTokenHandler(), handlers.UserPayload{UserID: bob, TokenID: tok.TokenID}, http.StatusNoContent},
+		{"delete", f.h.DeleteHandler(), handlers.UserPayload{UserID: bob}, http.StatusNoContent},
+		{"delete again", f.h.DeleteHandler(), handlers.UserPayload{UserID: bob}, http.StatusNotFound},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if rec := do(t, tc.handler, http.MethodPost, "/", f.admin, tc.body); rec.Code != tc.want {
+				t.Errorf("want %d, got %d: %s", tc.want, rec.Code, rec.Body)
+			}
+		})
+	}
+	if rec := do(t, f.h.DeleteHandler(), http.MethodGet, "/", f.admin, nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: want 405, got %d", rec.Code)
+	}
+	if rec := do(t, f.h.DeleteHandler(), http.MethodPost, "/", "", handlers.UserPayload{UserID: f.admin}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("no identity: want 401, got %d", rec.Code)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	f := newFixture(t)
+	bob := f.create(t, userdb.User{LoginID: "bob", Pw: "pw", Enabled: true})
+	_, tok, err := f.tokens.Mint(bob, "ci", []string{"read"}, nil, pat.HashOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := f.h.TokensHandler()
+
+	rec := do(t, tokens, http.MethodGet, "/tokens?user_id="+bob, f.admin, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("want 200, got %d: %s", rec.Code, rec.Body)
+	}
+	got := decode[handlers.TokensResponse](t, rec)
+	want := handlers.TokensResponse{Tokens: []handlers.Token{
+		{TokenID: tok.TokenID, Name: "ci", Scopes: []string{"read"}, CreatedAt: got.Tokens[0].CreatedAt},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("tokens (-want +got):\n%s", diff)
+	}
+
+	if rec := do(t, tokens, http.MethodGet, "/tokens", f.admin, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("no user_id: want 400, got %d", rec.Code)
+	}
+	if rec := do(t, tokens, http.MethodGet, "/tokens?user_id=nobody", f.admin, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown user: want 404, got %d", rec.Code)
+	}
+	if rec := do(t, tokens, http.MethodGet, "/tokens?user_id="+bob, bob, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("not admin: want 403, got %d", rec.Code)
+	}
+	f.h.Flow.Tokens = nil
+	if rec := do(t, tokens, http.MethodGet, "/tokens?user_id="+bob, f.admin, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("no Tokens: want 404, got %d", rec.Code)
+	}
+}
@@ -1,24 +1,26 @@
 // Package db provides a GORM-backed login.AttemptStore. Attempts are
-// stored server-side in the login_attempts table, one row per user.
+// stored server-side in the login_attempts table, one row per attempt key.
 package db
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
 	"time"
 
 	"github.com/go-bumbu/userauth/flow/login"
 	"gorm.io/gorm"
 )
 
-// attemptModel stores one login attempt per user (login_attempts table).
+// attemptModel stores one login attempt per key (login_attempts table).
 type attemptModel struct {
 	gorm.Model
-	UserID              string `gorm:"uniqueIndex;not null"`
+	Key                 string `gorm:"column:attempt_key;uniqueIndex;not null"`
+	UserID              string `gorm:"not null"`
 	Satisfied           string // JSON-encoded []string of verified method IDs
 	SessionKeepLoggedIn bool
+	Reauth              bool
 	ExpiresAt           time.Time `gorm:"not null"`
 }
 
@@ -32,28 +34,39 @@ type Store struct {
 	db *gorm.DB
 }
 
-// New creates a Store and auto-migrates the login_attempts table.
+// New creates a Store and auto-migrates the login_attempts table. A table
+// from before attempt keys (one unique row per user) is dropped rather than
+// migrated: attempts live minutes, so the cost is that logins in progress
+// restart.
 func New(db *gorm.DB) (*Store, error) {
+	m := db.Migrator()
+	if m.HasTable(&attemptModel{}) && !m.HasColumn(&attemptModel{}, "Key") {
+		if err := m.DropTable(&attemptModel{}); err != nil {
+			return nil, err
+		}
+	}
 	if err := db.AutoMigrate(&attemptModel{}); err != nil {
 		return nil, err
 	}
 	return &Store{db: db}, nil
 }
 
-// Set stores the login attempt for the user. Overwrites any existing entry.
-func (s *Store) Set(_ *http.Request, _ http.ResponseWriter, a login.Attempt) error {
+// Set stores the login attempt under key. Overwrites any existing entry.
+func (s *Store) Set(key string, a login.Attempt) error {
 	satisfied, err := json.Marshal(a.Satisfied)
 	if err != nil {
 		return fmt.Errorf("login attempt encode satisfied: %w", err)
 	}
 	var m attemptModel
-	err = s.db.Where("user_id = ?", a.UserID).First(&m).Error
+	err = s.db.Where("attempt_key = ?", key).First(&m).Error
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		return err
 	}
+	m.Key = key
 	m.UserID = a.UserID
 	m.Satisfied = string(satisfied)
 	m.SessionKeepLoggedIn = a.SessionKeepLoggedIn
+	m.Reauth = a.Reauth
 	m.ExpiresAt = a.ExpiresAt
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return s.db.Create(&m).Error
@@ -61,11 +74,11 @@ func (s *Store) Set(_ *http.Request, _ http.ResponseWriter, a login.Attempt) err
 	return s.db.Save(&m).Error
 }
 
-// Get retrieves the login attempt for the user. Returns an error if not found
-// or expired; an expired row is deleted.
-func (s *Store) Get(_ *http.Request, userID string) (login.Attempt, error) {
+// Get retrieves the login attempt stored under key. Returns an error if not
+// found or expired; an expired row is deleted.
+func (s *Store) Get(key string) (login.Attempt, error) {
 	var m attemptModel
-	err := s.db.Where("user_id = ?", userID).First(&m).Error
+	err := s.db.Where("attempt_key = ?", key).First(&m).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return login.Attempt{}, ErrAttemptNotFound
@@ -87,10 +100,18 @@ func (s *Store) Get(_ *http.Request, userID string) (login.Attempt, error) {
 		Satisfied:           satisfied,
 		ExpiresAt:           m.ExpiresAt,
 		SessionKeepLoggedIn: m.SessionKeepLoggedIn,
+		Reauth:              m.Reauth,
 	}, nil
 }
 
-// Clear deletes the login attempt for the user.
-func (s *Store) Clear(_ *http.Request, _ http.ResponseWriter, userID string) error {
-	return s.db.Where("user_id = ?", userID).Delete(&attemptModel{}).Error
+// Clear deletes the login attempt stored under key.
+func (s *Store) Clear(key string) error {
+	return s.db.Where("attempt_key = ?", key).Delete(&attemptModel{}).Error
+}
+
+// Sweep permanently deletes expired attempts, including rows Clear has
+// already soft-deleted.
+func (s *Store) Sweep(ctx context.Context) (int, error) {
+	res := s.db.WithContext(ctx).Unscoped().Where("expires_at < ?", time.Now()).Delete(&attemptModel{})
+	return int(res.RowsAffected), res.Error
 }
@@ -1,9 +1,8 @@
 package db_test
 
 import (
+	"context"
 	"errors"
-	"net/http"
-	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -29,21 +28,19 @@ func newTestStore(t *testing.T) *attemptdb.Store {
 }
 
 func TestStore(t *testing.T) {
-	r := httptest.NewRequest(http.MethodPost, "/", nil)
-	w := httptest.NewRecorder()
-
 	t.Run("set and get", func(t *testing.T) {
 		store := newTestStore(t)
 		a := login.Attempt{
 			UserID:              "alice",
 			Satisfied:           []string{"password"},
 			SessionKeepLoggedIn: true,
+			Reauth:              true,
 			ExpiresAt:           time.Now().Add(5 * time.Minute),
 		}
-		if err := store.Set(r, w, a); err != nil {
+		if err := store.Set("key-alice", a); err != nil {
 			t.Fatal(err)
 		}
-		got, err := store.Get(r, "alice")
+		got, err := store.Get("key-alice")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -54,7 +51,7 @@ func TestStore(t *testing.T) {
 
 	t.Run("get missing", func(t *testing.T) {
 		store := newTestStore(t)
-		if _, err := store.Get(r, "nobody"); !errors.Is(err, attemptdb.ErrAttemptNotFound) {
+		if _, err := store.Get("key-nobody"); !errors.Is(err, attemptdb.ErrAttemptNotFound) {
 			t.Fatalf("want ErrAttemptNotFound, got %v", err)
 		}
 	})
@@ -62,14 +59,14 @@ func TestStore(t *testing.T) {
 	t.Run("expired attempt is dropped", func(t *testing.T) {
 		store := newTestStore(t)
 		a := login.Attempt{UserID: "bob", ExpiresAt: time.Now().Add(-time.Second)}
-		if err := store.Set(r, w, a); err != nil {
+		if err := store.Set("key-bob", a); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := store.Get(r, "bob"); !errors.Is(err, attemptdb.ErrAttemptExpired) {
+		if _, err := store.Get("key-bob"); !errors.Is(err, attemptdb.ErrAttemptExpired) {
 			t.Fatalf("want ErrAttemptExpired, got %v", err)
 		}
 		// a second Get finds nothing: the expired row was deleted
-		if _, err := store.Get(r, "bob"); !errors.Is(err, attemptdb.ErrAttemptNotFound) {
+		if _, err := store.Get("key-bob"); !errors.Is(err, attemptdb.ErrAttemptNotFound) {
 			t.Fatalf("want ErrAttemptNotFound after expiry cleanup, got %v", err)
 		}
 	})
@@ -77,26 +74,26 @@ func TestStore(t *testing.T) {
 	t.Run("clear", func(t *testing.T) {
 		store := newTestStore(t)
 		a := login.Attempt{UserID: "carol", ExpiresAt: time.Now().Add(time.Minute)}
-		if err := store.Set(r, w, a); err != nil {
+		if err := store.Set("key-carol", a); err != nil {
 			t.Fatal(err)
 		}
-		if err := store.Clear(r, w, "carol"); err != nil {
+		if err := store.Clear("key-carol"); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := store.Get(r, "carol"); !errors.Is(err, attemptdb.ErrAttemptNotFound) {
+		if _, err := store.Get("key-carol"); !errors.Is(err, attemptdb.ErrAttemptNotFound) {
 			t.Fatalf("want ErrAttemptNotFound after clear, got %v", err)
 		}
 	})
 
 	t.Run("overwrites previous", func(t *testing.T) {
 		store := newTestStore(t)
-		if err := store.Set(r, w, login.Attempt{
+		if err := store.Set("key-dave", login.Attempt{
 			UserID:    "dave",
 			ExpiresAt: time.Now().Add(5 * time.Minute),
 		}); err != nil {
 			t.Fatal(err)
 		}
-		if err := store.Set(r, w, login.Attempt{
+		if err := store.Set("key-dave", login.Attempt{
 			UserID:              "dave",
 			Satisfied:           []string{"password", "totp"},
 			SessionKeepLoggedIn: true,
@@ -104,7 +101,7 @@ func TestStore(t *testing.T) {
 		}); err != nil {
 			t.Fatal(err)
 		}
-		got, err := store.Get(r, "dave")
+		got, err := store.Get("key-dave")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -115,4 +112,72 @@ func TestStore(t *testing.T) {
 			t.Errorf("satisfied mismatch (-want +got):\n%s", diff)
 		}
 	})
+
+	t.Run("attempts of one user are kept apart", func(t *testing.T) {
+		store := newTestStore(t)
+		exp := time.Now().Add(5 * time.Minute)
+		if err := store.Set("key-phone", login.Attempt{UserID: "erin", Satisfied: []string{"password"}, ExpiresAt: exp}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Set("key-laptop", login.Attempt{UserID: "erin", ExpiresAt: exp}); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.Get("key-phone")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"password"}, got.Satisfied); diff != "" {
+			t.Errorf("satisfied mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+// TestNewReplacesLegacyTable covers the upgrade from the per-user table: it
+// is dropped and recreated with attempt keys.
+func TestNewReplacesLegacyTable(t *testing.T) {
+	gdb, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := `CREATE TABLE login_attempts (id integer PRIMARY KEY, user_id text NOT NULL UNIQUE, expires_at datetime NOT NULL)`
+	if err := gdb.Exec(legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := gdb.Exec(`INSERT INTO login_attempts (user_id, expires_at) VALUES ('alice', ?)`, time.Now().Add(time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := attemptdb.New(gdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := time.Now().Add(time.Minute)
+	for _, key := range []string{"key-1", "key-2"} {
+		if err := store.Set(key, login.Attempt{UserID: "alice", ExpiresAt: exp}); err != nil {
+			t.Fatalf("Set(%s): %v", key, err)
+		}
+	}
+}
+
+func TestSweep(t *testing.T) {
+	store := newTestStore(t)
+	_ = store.Set("key-alice", login.Attempt{UserID: "alice", ExpiresAt: time.Now().Add(time.Minute)})
+	_ = store.Set("key-bob", login.Attempt{UserID: "bob", ExpiresAt: time.Now().Add(-time.Minute)})
+	// cleared rows are only soft-deleted; the sweep purges them once expired
+	_ = store.Set("key-carol", login.Attempt{UserID: "carol", ExpiresAt: time.Now().Add(-time.Minute)})
+	_ = store.Clear("key-carol")
+
+	n, err := store.Sweep(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("removed %d attempts, want 2", n)
+	}
+	if _, err := store.Get("key-alice"); err != nil {
+		t.Errorf("live attempt must survive the sweep: %v", err)
+	}
+	if _, err := store.Get("key-bob"); !errors.Is(err, attemptdb.ErrAttemptNotFound) {
+		t.Errorf("want ErrAttemptNotFound after the sweep, got %v", err)
+	}
 }
@@ -2,8 +2,8 @@
 package memory
 
 import (
+	"context"
 	"errors"
-	"net/http"
 	"sync"
 	"time"
 
@@ -26,30 +26,48 @@ func New() *Store {
 	}
 }
 
-func (m *Store) Set(_ *http.Request, _ http.ResponseWriter, a login.Attempt) error {
+func (m *Store) Set(key string, a login.Attempt) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.store[a.UserID] = a
+	m.store[key] = a
 	return nil
 }
 
-func (m *Store) Get(_ *http.Request, userID string) (login.Attempt, error) {
+func (m *Store) Get(key string) (login.Attempt, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	a, ok := m.store[userID]
+	a, ok := m.store[key]
 	if !ok {
 		return login.Attempt{}, ErrAttemptNotFound
 	}
 	if time.Now().After(a.ExpiresAt) {
-		delete(m.store, userID)
+		delete(m.store, key)
 		return login.Attempt{}, ErrAttemptExpired
 	}
 	return a, nil
 }
 
-func (m *Store) Clear(_ *http.Request, _ http.ResponseWriter, userID string) error {
+func (m *Store) Clear(key string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	delete(m.store, userID)
+	delete(m.store, key)
 	return nil
 }
+
+// Sweep removes expired attempts.
+func (m *Store) Sweep(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for key, a := range m.store {
+		if now.After(a.ExpiresAt) {
+			delete(m.store, key)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -1,9 +1,8 @@
 package memory_test
 
 import (
+	"context"
 	"errors"
-	"net/http"
-	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -13,9 +12,6 @@ import (
 )
 
 func TestStore(t *testing.T) {
-	r := httptest.NewRequest(http.MethodPost, "/", nil)
-	w := httptest.NewRecorder()
-
 	t.Run("set and get", func(t *testing.T) {
 		store := memory.New()
 		a := login.Attempt{
@@ -24,10 +20,10 @@ func TestStore(t *testing.T) {
 			SessionKeepLoggedIn: true,
 			ExpiresAt:           time.Now().Add(5 * time.Minute),
 		}
-		if err := store.Set(r, w, a); err != nil {
+		if err := store.Set("key-alice", a); err != nil {
 			t.Fatal(err)
 		}
-		got, err := store.Get(r, "alice")
+		got, err := store.Get("key-alice")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -38,7 +34,7 @@ func TestStore(t *testing.T) {
 
 	t.Run("get missing", func(t *testing.T) {
 		store := memory.New()
-		if _, err := store.Get(r, "nobody"); !errors.Is(err, memory.ErrAttemptNotFound) {
+		if _, err := store.Get("key-nobody"); !errors.Is(err, memory.ErrAttemptNotFound) {
 			t.Fatalf("want ErrAttemptNotFound, got %v", err)
 		}
 	})
@@ -46,14 +42,14 @@ func TestStore(t *testing.T) {
 	t.Run("expired attempt is dropped", func(t *testing.T) {
 		store := memory.New()
 		a := login.Attempt{UserID: "alice", ExpiresAt: time.Now().Add(-time.Second)}
-		if err := store.Set(r, w, a); err != nil {
+		if err := store.Set("key-alice", a); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := store.Get(r, "alice"); !errors.Is(err, memory.ErrAttemptExpired) {
+		if _, err := store.Get("key-alice"); !errors.Is(err, memory.ErrAttemptExpired) {
 			t.Fatalf("want ErrAttemptExpired, got %v", err)
 		}
 		// a second Get finds nothing: the expired entry was deleted
-		if _, err := store.Get(r, "alice"); !errors.Is(err, memory.ErrAttemptNotFound) {
+		if _, err := store.Get("key-alice"); !errors.Is(err, memory.ErrAttemptNotFound) {
 			t.Fatalf("want ErrAttemptNotFound after expiry cleanup, got %v", err)
 		}
 	})
@@ -61,14 +57,34 @@ func TestStore(t *testing.T) {
 	t.Run("clear", func(t *testing.T) {
 		store := memory.New()
 		a := login.Attempt{UserID: "alice", ExpiresAt: time.Now().Add(time.Minute)}
-		if err := store.Set(r, w, a); err != nil {
+		if err := store.Set("key-alice", a); err != nil {
 			t.Fatal(err)
 		}
-		if err := store.Clear(r, w, "alice"); err != nil {
+		if err := store.Clear("key-alice"); err != nil {
 			t.Fatal(err)
 		}
-		if _, err := store.Get(r, "alice"); !errors.Is(err, memory.ErrAttemptNotFound) {
+		if _, err := store.Get("key-alice"); !errors.Is(err, memory.ErrAttemptNotFound) {
 			t.Fatalf("want ErrAttemptNotFound after clear, got %v", err)
 		}
 	})
 }
+
+func TestSweep(t *testing.T) {
+	store := memory.New()
+	_ = store.Set("key-alice", login.Attempt{UserID: "alice", ExpiresAt: time.Now().Add(time.Minute)})
+	_ = store.Set("key-bob", login.Attempt{UserID: "bob", ExpiresAt: time.Now().Add(-time.Minute)})
+
+	n, err := store.Sweep(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("removed %d attempts, want 1", n)
+	}
+	if _, err := store.Get("key-alice"); err != nil {
+		t.Errorf("live attempt must survive the sweep: %v", err)
+	}
+	if _, err := store.Get("key-bob"); !errors.Is(err, memory.ErrAttemptNotFound) {
+		t.Errorf("want ErrAttemptNotFound after the sweep, got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package login
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-bumbu/userauth/service/trusteddevice"
+)
+
+// DeviceTrust recognises and issues trusted-device cookies for Flow.Devices;
+// *trusteddevice.Service implements it.
+type DeviceTrust interface {
+	// Verify reports whether the request carries a live trusted device of
+	// the user; a non-nil error is a store failure.
+	Verify(r *http.Request, userID string) (trusteddevice.Device, bool, error)
+	// Trust records the browser as a trusted device of the user and sets its
+	// cookie.
+	Trust(r *http.Request, w http.ResponseWriter, userID, name string) (trusteddevice.Device, error)
+}
+
+// DeviceLogin is a MethodsLogin that also records the trusted device the
+// login came from (cookieauth's UserData.DeviceID). When Session implements
+// it and a device was recognised or trusted, the flow passes its ID along.
+type DeviceLogin interface {
+	LoginUserWithDevice(r *http.Request, w http.ResponseWriter, userID string, keepLoggedIn bool, methods []string, deviceID string) error
+}
+
+type rememberDeviceKey struct{}
+
+// WithRememberDevice marks a submission with the user's request to trust
+// the browser: if it completes the login, Flow.Devices trusts the device
+// under name (empty falls back to the User-Agent). Transports set it from a
+// "remember this device" checkbox:
+//
+//	r = r.WithContext(login.WithRememberDevice(r.Context(), ""))
+func WithRememberDevice(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, rememberDeviceKey{}, name)
+}
+
+func rememberDevice(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(rememberDeviceKey{}).(string)
+	return name, ok
+}
+
+// recognizeDevice adds MethodDevice to the attempt when the signals carry a
+// known device, returning its ID. Re-authentication never counts a device
+// (its signals have none).
+func recognizeDevice(sig Signals, att *Attempt) string {
+	if !sig.KnownDevice {
+		return ""
+	}
+	if !contains(att.Satisfied, MethodDevice) {
+		att.Satisfied = append(att.Satisfied, MethodDevice)
+	}
+	return sig.deviceID
+}
+
+// trustDevice trusts the browser when the finishing submission asked for it
+// (WithRememberDevice). A failure is logged, not returned: the login itself
+// succeeded.
+func (f *Flow) trustDevice(r *http.Request, w http.ResponseWriter, userID string) string {
+	name, ok := rememberDevice(r.Context())
+	if f.Devices == nil || !ok {
+		return ""
+	}
+	d, err := f.Devices.Trust(r, w, userID, name)
+	if err != nil {
+		f.logger().Error("login: failed to trust device", "userID", userID, "error", err)
+		return ""
+	}
+	return d.ID
+}
@@ -0,0 +1,150 @@
+package login_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-bumbu/userauth/flow/login"
+	"github.com/go-bumbu/userauth/service/trusteddevice"
+	tdmemory "github.com/go-bumbu/userauth/service/trusteddevice/store/memory"
+	"github.com/google/go-cmp/cmp"
+)
+
+// deviceSession records the methods and device of each login, like
+// cookieauth.Manager.
+type deviceSession struct {
+	upgradingSession
+	deviceID string
+}
+
+func (s *deviceSession) LoginUserWithDevice(r *http.Request, w http.ResponseWriter, userID string, keep bool, methods []string, deviceID string) error {
+	s.deviceID = deviceID
+	return s.LoginUserWithMethods(r, w, userID, keep, methods)
+}
+
+func deviceFixture(t *testing.T, policy login.Policy) (*fixture, *deviceSession, *trusteddevice.Service) {
+	t.Helper()
+	devices, err := trusteddevice.NewService(tdmemory.New(), trusteddevice.Opts{
+		HashKey: []byte("0123456789abcdef0123456789abcdef"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := newFixture(policy)
+	session := &deviceSession{}
+	f.flow.Session = session
+	f.flow.Devices = devices
+	return f, session, devices
+}
+
+// submitWith submits one factor with the given cookies, optionally asking to
+// remember the device, and returns the result and response cookies.
+func submitWith(t *testing.T, f *fixture, cookies []*http.Cookie, remember bool, userID, method, input string) (login.Result, []*http.Cookie) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/login", nil)
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	if remember {
+		r = r.WithContext(login.WithRememberDevice(r.Context(), "laptop"))
+	}
+	w := httptest.NewRecorder()
+	res, err := f.flow.Submit(r, w, f.handles[userID], userID, method, input, false)
+	if err != nil {
+		t.Fatalf("Submit(%s, %s): %v", userID, method, err)
+	}
+	f.keep(userID, res)
+	return res, w.Result().Cookies()
+}
+
+func TestFlowTrustedDevice(t *testing.T) {
+	policy := login.TrustedDevice(login.RequireAny(login.Chain{"password", "totp"}), "totp")
+
+	// trust logs alice in with both factors, remembering the device, and
+	// returns the device cookie.
+	trust := func(t *testing.T, f *fixture) []*http.Cookie {
+		t.Helper()
+		submitWith(t, f, nil, false, "alice", "password", "alice-pw")
+		res, cookies := submitWith(t, f, nil, true, "alice", "totp", totpCode(t))
+		if !res.Done {
+			t.Fatalf("want Done, got %+v", res)
+		}
+		if len(cookies) != 1 || cookies[0].Name != trusteddevice.DefaultCookieName {
+			t.Fatalf("want the device cookie, got %v", cookies)
+		}
+		return cookies
+	}
+
+	t.Run("remembered device skips the second factor", func(t *testing.T) {
+		f, session, devices := deviceFixture(t, policy)
+		cookies := trust(t, f)
+		listed, err := devices.List("alice")
+		if err != nil || len(listed) != 1 || listed[0].Name != "laptop" {
+			t.Fatalf("List = %+v, %v", listed, err)
+		}
+		if session.deviceID != listed[0].ID {
+			t.Errorf("trusting login: deviceID = %q, want %q", session.deviceID, listed[0].ID)
+		}
+
+		session.deviceID = ""
+		res, _ := submitWith(t, f, cookies, false, "alice", "password", "alice-pw")
+		if !res.Done {
+			t.Fatalf("want Done after password on a trusted device, got %+v", res)
+		}
+		if diff := cmp.Diff([]string{"password", "device"}, session.methods); diff != "" {
+			t.Errorf("methods (-want +got):\n%s", diff)
+		}
+		if session.deviceID != listed[0].ID {
+			t.Errorf("deviceID = %q, want %q", session.deviceID, listed[0].ID)
+		}
+	})
+
+	t.Run("device never replaces the password", func(t *testing.T) {
+		f, _, _ := deviceFixture(t, policy)
+		cookies := trust(t, f)
+		if res, _ := submitWith(t, f, cookies, false, "alice", "totp", totpCode(t)); res.OK {
+			t.Fatalf("totp before password must be rejected, got %+v", res)
+		}
+		if res, _ := submitWith(t, f, cookies, false, "alice", "password", "wrong"); res.OK {
+			t.Fatalf("wrong password must be rejected, got %+v", res)
+		}
+	})
+
+	t.Run("revoked device asks for the second factor again", func(t *testing.T) {
+		f, _, devices := deviceFixture(t, policy)
+		cookies := trust(t, f)
+		if err := devices.RevokeAll("alice"); err != nil {
+			t.Fatal(err)
+		}
+		res, _ := submitWith(t, f, cookies, false, "alice", "password", "alice-pw")
+		if res.Done || !cmp.Equal(res.Next, []string{"totp"}) {
+			t.Fatalf("want totp next, got %+v", res)
+		}
+	})
+
+	t.Run("device counts only under a TrustedDevice policy", func(t *testing.T) {
+		f, _, _ := deviceFixture(t, login.RequireAny(login.Chain{"password", "totp"}))
+		cookies := trust(t, f)
+		res, _ := submitWith(t, f, cookies, false, "alice", "password", "alice-pw")
+		if res.Done {
+			t.Fatalf("plain policy must still ask for totp, got %+v", res)
+		}
+	})
+
+	t.Run("re-authentication ignores the device", func(t *testing.T) {
+		f, session, _ := deviceFixture(t, policy)
+		cookies := trust(t, f)
+		r := httptest.NewRequest(http.MethodPost, "/reauth", nil)
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		res, err := f.flow.Reauthenticate(r, httptest.NewRecorder(), "", "alice", "password", "alice-pw")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Done || len(session.upgrades) != 0 {
+			t.Fatalf("re-authentication must not be completed by a device, got %+v", res)
+		}
+	})
+}
@@ -23,8 +23,8 @@ type printDeliverer struct {
 	lastCode string
 }
 
-func (d *printDeliverer) Deliver(_ context.Context, _ string, code string, _ time.Time) error {
-	d.lastCode = code
+func (d *printDeliverer) Deliver(_ context.Context, msg verificationcode.Message) error {
+	d.lastCode = msg.Code
 	return nil
 }
 
@@ -56,10 +56,10 @@ func Example() {
 	r := httptest.NewRequest(http.MethodPost, "/login", nil)
 	w := httptest.NewRecorder()
 
-	res, _ := flow.Submit(r, w, "bob", login.MethodPassword, "wrong", false)
+	res, _ := flow.Submit(r, w, "", "bob", login.MethodPassword, "wrong", false)
 	fmt.Printf("wrong password: ok=%v done=%v\n", res.OK, res.Done)
 
-	res, _ = flow.Submit(r, w, "bob", login.MethodPassword, "secret", false)
+	res, _ = flow.Submit(r, w, "", "bob", login.MethodPassword, "secret", false)
 	fmt.Printf("right password: ok=%v done=%v\n", res.OK, res.Done)
 
 	// Output:
@@ -101,17 +101,18 @@ func Example_emailPlusTOTP() {
 
 	// Step 1: issue and "deliver" a one-time code. For unknown or disabled
 	// users this silently does nothing, so the endpoint stays enumeration-safe.
-	_ = flow.Initiate(r, "alice@example.com", login.MethodEmail)
+	_ = flow.Initiate(r, "", "alice@example.com", login.MethodEmail)
 
 	// Step 2: the user submits the emailed code. Result.Next tells the
-	// transport which factors may come next.
-	res, _ := flow.Submit(r, w, "alice@example.com", login.MethodEmail, mail.lastCode, false)
+	// transport which factors may come next, Result.Attempt is the handle
+	// that continues this attempt.
+	res, _ := flow.Submit(r, w, "", "alice@example.com", login.MethodEmail, mail.lastCode, false)
 	fmt.Printf("after email code: ok=%v done=%v next=%v\n", res.OK, res.Done, res.Next)
 
 	// Step 3: the user submits their authenticator code; the policy is now
 	// satisfied and the session is created.
 	code, _ := totp.GenerateCode(key.Secret(), time.Now())
-	res, _ = flow.Submit(r, w, "alice@example.com", login.MethodTOTP, code, false)
+	res, _ = flow.Submit(r, w, res.Attempt, "alice@example.com", login.MethodTOTP, code, false)
 	fmt.Printf("after totp: ok=%v done=%v\n", res.OK, res.Done)
 
 	// Output:
@@ -154,8 +155,8 @@ func Example_alternativeChains() {
 	w := httptest.NewRecorder()
 
 	// bob picks the email chain; one factor completes the login.
-	_ = flow.Initiate(r, "bob", login.MethodEmail)
-	res, _ := flow.Submit(r, w, "bob", login.MethodEmail, mail.lastCode, false)
+	_ = flow.Initiate(r, "", "bob", login.MethodEmail)
+	res, _ := flow.Submit(r, w, "", "bob", login.MethodEmail, mail.lastCode, false)
 	fmt.Printf("email chain: ok=%v done=%v\n", res.OK, res.Done)
 
 	// Output:
@@ -195,10 +196,10 @@ func ExampleSecondFactorAfter() {
 	r := httptest.NewRequest(http.MethodPost, "/login", nil)
 	w := httptest.NewRecorder()
 
-	res, _ := flow.Submit(r, w, "plain", login.MethodPassword, "secret", false)
+	res, _ := flow.Submit(r, w, "", "plain", login.MethodPassword, "secret", false)
 	fmt.Printf("plain: done=%v\n", res.Done)
 
-	res, _ = flow.Submit(r, w, "careful", login.MethodPassword, "secret", false)
+	res, _ = flow.Submit(r, w, "", "careful", login.MethodPassword, "secret", false)
 	fmt.Printf("careful: done=%v next=%v\n", res.Done, res.Next)
 
 	// Output:
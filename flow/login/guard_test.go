@@ -1,6 +1,10 @@
 package login_test
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
 	"testing"
 	"time"
 
@@ -117,3 +121,157 @@ func TestGuard_OutOfOrderSubmissionNotCounted(t *testing.T) {
 		t.Fatalf("out-of-order submissions must not consume the failure budget, got %+v", res)
 	}
 }
+
+func ipRequest(remote, forwarded string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/login", nil)
+	r.RemoteAddr = remote
+	if forwarded != "" {
+		r.Header.Set("X-Forwarded-For", forwarded)
+	}
+	return r
+}
+
+func TestIPGuard(t *testing.T) {
+	proxy := netip.MustParsePrefix("10.0.0.0/8")
+	tcs := []struct {
+		name    string
+		guard   login.IPGuard
+		fail    []*http.Request // failures charged before the check
+		check   *http.Request
+		allowed bool
+	}{
+		{
+			name:    "within budget",
+			guard:   login.IPGuard{Budget: 2},
+			fail:    []*http.Request{ipRequest("192.0.2.7:1234", "")},
+			check:   ipRequest("192.0.2.7:1234", ""),
+			allowed: true,
+		},
+		{
+			name:  "budget spent across accounts",
+			guard: login.IPGuard{Budget: 2},
+			fail: []*http.Request{
+				ipRequest("192.0.2.7:1234", ""),
+				ipRequest("192.0.2.7:5678", ""),
+			},
+			check: ipRequest("192.0.2.7:1234", ""),
+		},
+		{
+			name:    "other IPv4 addresses are separate",
+			guard:   login.IPGuard{Budget: 1},
+			fail:    []*http.Request{ipRequest("192.0.2.7:1234", "")},
+			check:   ipRequest("192.0.2.8:1234", ""),
+			allowed: true,
+		},
+		{
+			name:  "IPv4 aggregation",
+			guard: login.IPGuard{Budget: 1, IPv4Prefix: 24},
+			fail:  []*http.Request{ipRequest("192.0.2.7:1234", "")},
+			check: ipRequest("192.0.2.8:1234", ""),
+		},
+		{
+			name:  "IPv6 aggregated per /64",
+			guard: login.IPGuard{Budget: 1},
+			fail:  []*http.Request{ipRequest("[2001:db8:1:2::1]:1234", "")},
+			check: ipRequest("[2001:db8:1:2:ffff::9]:1234", ""),
+		},
+		{
+			name:    "neighbouring IPv6 /64 is separate",
+			guard:   login.IPGuard{Budget: 1},
+			fail:    []*http.Request{ipRequest("[2001:db8:1:2::1]:1234", "")},
+			check:   ipRequest("[2001:db8:1:3::1]:1234", ""),
+			allowed: true,
+		},
+		{
+			name:  "client behind trusted proxy",
+			guard: login.IPGuard{Budget: 1, TrustedProxies: []netip.Prefix{proxy}},
+			fail:  []*http.Request{ipRequest("10.0.0.1:1234", "192.0.2.7")},
+			check: ipRequest("10.0.0.2:1234", "198.51.100.1, 192.0.2.7"),
+		},
+		{
+			name:    "untrusted peer cannot pick its key",
+			guard:   login.IPGuard{Budget: 1},
+			fail:    []*http.Request{ipRequest("192.0.2.7:1234", "198.51.100.1")},
+			check:   ipRequest("192.0.2.8:1234", "192.0.2.7"),
+			allowed: true,
+		},
+		{
+			name:    "expired budget is forgiven",
+			guard:   login.IPGuard{Budget: 1, Window: time.Nanosecond},
+			fail:    []*http.Request{ipRequest("192.0.2.7:1234", "")},
+			check:   ipRequest("192.0.2.7:1234", ""),
+			allowed: true,
+		},
+		{
+			name:    "unresolvable address is not throttled",
+			guard:   login.IPGuard{Budget: 1},
+			fail:    []*http.Request{ipRequest("@", "")},
+			check:   ipRequest("@", ""),
+			allowed: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			g := tc.guard
+			g.Store = throttlememory.New()
+			for i, r := range tc.fail {
+				if err := g.Fail(r, fmt.Sprintf("user%d", i), login.MethodPassword); err != nil {
+					t.Fatal(err)
+				}
+			}
+			time.Sleep(time.Millisecond) // let a nanosecond window lapse
+			ok, err := g.Allow(tc.check, "someone", login.MethodPassword)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tc.allowed {
+				t.Errorf("Allow = %v, want %v", ok, tc.allowed)
+			}
+		})
+	}
+
+	t.Run("failures age out of the sliding window", func(t *testing.T) {
+		g := login.IPGuard{Store: throttlememory.New(), Budget: 2, Window: 50 * time.Millisecond}
+		r := ipRequest("192.0.2.7:1234", "")
+		for i := range 2 {
+			if err := g.Fail(r, fmt.Sprintf("user%d", i), login.MethodPassword); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if ok, err := g.Allow(r, "someone", login.MethodPassword); err != nil || ok {
+			t.Fatalf("budget spent: Allow = %v, %v; want a denial", ok, err)
+		}
+		time.Sleep(110 * time.Millisecond) // two windows: nothing overlaps any more
+		if ok, err := g.Allow(r, "someone", login.MethodPassword); err != nil || !ok {
+			t.Fatalf("after the window: Allow = %v, %v; want allowed", ok, err)
+		}
+	})
+
+	t.Run("requires a store", func(t *testing.T) {
+		if _, err := (&login.IPGuard{}).Allow(ipRequest("192.0.2.7:1", ""), "bob", login.MethodPassword); err == nil {
+			t.Fatal("expected an error without a Store")
+		}
+	})
+}
+
+func TestAllGuards(t *testing.T) {
+	store := throttlememory.New()
+	f := newFixture(login.RequireAny(login.Chain{"password"}))
+	f.flow.Guard = login.AllGuards(
+		login.ThrottleGuard{Throttle: &login.Throttle{Store: store, FreeFailures: 2, BaseDelay: time.Hour}},
+		&login.IPGuard{Store: store, Budget: 3},
+	)
+
+	// The per-account limit applies on its own ...
+	submit(t, f, "bob", "password", "wrong")
+	submit(t, f, "bob", "password", "wrong")
+	if res := submit(t, f, "bob", "password", "bob-pw"); res.OK {
+		t.Fatalf("account throttle must apply, got %+v", res)
+	}
+	// ... and the per-source one stops the next account from the same
+	// address although that account has never failed.
+	submit(t, f, "carol", "password", "wrong")
+	if res := submit(t, f, "alice", "password", "alice-pw"); res.OK {
+		t.Fatalf("source budget must apply across accounts, got %+v", res)
+	}
+}
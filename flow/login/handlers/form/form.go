@@ -0,0 +1,530 @@
+// Package form provides a server-rendered HTML transport on top of
+// login.Flow: one page per step (password, authenticator code, recovery
+// code, email code), rendered from overridable html/template files, with
+// every POST answered by a redirect (POST-redirect-GET) so reloads and the
+// back button never resubmit credentials.
+//
+// Like the JSON transport it stays deliberately dumb. All credential-shaped
+// failures — unknown user, disabled user, wrong password or code, a factor
+// the policy is not offering, an expired attempt — redirect to the same
+// page with the same error, and requesting a code always reports that a code
+// is on its way.
+//
+// Routes, relative to Opts.BasePath (default "/login"):
+//
+//	GET  /                 first step: password form, or the username form of
+//	                       a passwordless flow
+//	POST /                 submit the password
+//	GET  /{method}         code form for the method (totp, recovery, email, ...)
+//	POST /{method}         submit the code
+//	POST /{method}/send    issue a code for a deliverable method
+//
+// The attempt handle of a login in progress travels in an HttpOnly cookie
+// (Opts.AttemptCookie); the query string only carries display state and the
+// page to return to after login (Opts.ReturnParam), which every step passes
+// on.
+//
+// Pages are looked up by name in the template set: password.html,
+// request.html (the passwordless first step), <method>.html for each code
+// method with code.html as the fallback, all wrapped by layout.html. The
+// embedded defaults are plain, unstyled HTML; Opts.TemplateDir overrides any
+// of them file by file. Templates receive a PageData.
+package form
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-bumbu/userauth"
+	"github.com/go-bumbu/userauth/auth/chain"
+	"github.com/go-bumbu/userauth/auth/csrf"
+	"github.com/go-bumbu/userauth/flow/login"
+	"github.com/go-bumbu/userauth/flow/login/attemptstore/cookie"
+	"github.com/go-bumbu/userauth/internal/locale"
+)
+
+// DefaultBasePath is where the routes are mounted when Opts.BasePath is empty.
+const DefaultBasePath = "/login"
+
+// Opts configures the transport; everything about authentication lives in
+// the flow.
+type Opts struct {
+	// BasePath is the path the handler is mounted at; redirects and form
+	// actions are built from it. Defaults to DefaultBasePath.
+	BasePath string
+	// SuccessURL is where a completed login is redirected; defaults to "/".
+	SuccessURL string
+	// TemplateDir optionally overrides the embedded page templates, file by
+	// file; see the package documentation for the names.
+	TemplateDir string
+	// CSRF, when set, guards every POST and embeds its token in the forms
+	// (PageData.CSRFToken).
+	CSRF *csrf.Protector
+	// AttemptCookie carries the attempt handle between steps; its Path
+	// defaults to BasePath.
+	AttemptCookie cookie.Transport
+	// ReturnParam names the query parameter carrying the page to return to
+	// after login, as the chain authenticator's login redirect sets it;
+	// defaults to chain.DefaultReturnParam. A return-to that fails
+	// chain.IsSafeReturnTo is ignored in favour of SuccessURL.
+	ReturnParam string
+	Logger      *slog.Logger // optional; defaults to slog.Default()
+}
+
+// Form exposes a login.Flow as HTML forms.
+type Form struct {
+	flow    *login.Flow
+	base    string
+	success string
+	start   string // method of the first step: password or a deliverable method
+	pages   *pages
+	csrf    *csrf.Protector
+	attempt cookie.Transport
+	ret     string // return-to query parameter
+	logger  *slog.Logger
+}
+
+// PageData is the data every page template receives.
+type PageData struct {
+	// Method is the step's method ID; "password" or the deliverable method
+	// on the first step.
+	Method string
+	// Action is the URL the page's form posts to.
+	Action string
+	// SendAction, for deliverable methods, is the URL that issues a new code.
+	SendAction string
+	// User is the login identifier entered so far.
+	User string
+	// First reports that this step is the first factor, so the page should
+	// offer "keep me signed in".
+	First bool
+	// RememberDevice reports that the flow can trust devices, so a later
+	// step should offer "trust this device" (the remember_device field).
+	RememberDevice bool
+	// Error is the message of a failed submission; credential failures all
+	// share one message.
+	Error string
+	// Notice is an informational message, e.g. that a code was sent.
+	Notice string
+	// Alternatives are the other methods the policy accepts at this step.
+	Alternatives []Alternative
+	// StartOver links back to the first step on later steps.
+	StartOver string
+	// CSRFField and CSRFToken are set when Opts.CSRF is; the default pages
+	// render them as a hidden input through the "csrf" template.
+	CSRFField string
+	CSRFToken string
+}
+
+// Alternative links to another method accepted at the current step.
+type Alternative struct {
+	Method string
+	Label  string
+	URL    string
+}
+
+// Error and notice messages keyed by the code carried in the redirect URL.
+// Only these fixed strings are ever rendered, never text from the request.
+var (
+	errorMessages = map[string]string{
+		"invalid": "Invalid credentials.",
+		"missing": "Please fill in all fields.",
+	}
+	noticeMessages = map[string]string{
+		"sent": "If the account exists, a code is on its way.",
+	}
+	methodLabels = map[string]string{
+		login.MethodPassword: "Use your password",
+		login.MethodTOTP:     "Use your authenticator app",
+		login.MethodRecovery: "Use a recovery code",
+		login.MethodEmail:    "Email me a code",
+	}
+)
+
+// New returns a Form over flow. The flow must register the password method
+// or at least one deliverable method to start from.
+func New(flow *login.Flow, opts Opts) (*Form, error) {
+	if flow == nil {
+		return nil, errors.New("login form: flow is required")
+	}
+	f := &Form{
+		flow:    flow,
+		base:    strings.TrimSuffix(opts.BasePath, "/"),
+		success: opts.SuccessURL,
+		csrf:    opts.CSRF,
+		attempt: opts.AttemptCookie,
+		ret:     opts.ReturnParam,
+		logger:  opts.Logger,
+	}
+	if opts.BasePath == "" {
+		f.base = DefaultBasePath
+	}
+	if f.attempt.Path == "" {
+		f.attempt.Path = f.base
+	}
+	if f.success == "" {
+		f.success = "/"
+	}
+	if f.ret == "" {
+		f.ret = chain.DefaultReturnParam
+	}
+	if f.logger == nil {
+		f.logger = slog.Default()
+	}
+	for _, m := range flow.Methods {
+		if m.ID() == login.MethodPassword {
+			f.start = login.MethodPassword
+			break
+		}
+		if _, ok := m.(login.Initiator); ok && f.start == "" {
+			f.start = m.ID()
+		}
+	}
+	if f.start == "" {
+		return nil, errors.New("login form: flow has neither a password nor a deliverable method to start from")
+	}
+	var err error
+	if f.pages, err = parsePages(opts.TemplateDir); err != nil {
+		return nil, fmt.Errorf("login form: %w", err)
+	}
+	return f, nil
+}
+
+// Handler returns the routes; mount it at BasePath, e.g.
+// mux.Handle("/login/", f.Handler()) together with mux.Handle("/login", ...).
+func (f *Form) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+f.base, f.startPage)
+	mux.Handle("POST "+f.base, f.protect(http.HandlerFunc(f.submitPassword)))
+	mux.HandleFunc("GET "+f.base+"/{method}", f.codePage)
+	mux.Handle("POST "+f.base+"/{method}", f.protect(http.HandlerFunc(f.submitCode)))
+	mux.Handle("POST "+f.base+"/{method}/send", f.protect(http.HandlerFunc(f.sendCode)))
+	return mux
+}
+
+// LogoutHandler returns the POST endpoint that ends the session and
+// redirects to redirect ("/" when empty); Session must implement
+// login.UserLogout. Logout pages post a form carrying the CSRF token
+// (Opts.CSRF), so other sites cannot log the user out.
+func (f *Form) LogoutHandler(redirect string) http.Handler {
+	if redirect == "" {
+		redirect = "/"
+	}
+	return f.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := f.flow.Logout(r, w); err != nil {
+			f.fail(w, "logout", err)
+			return
+		}
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+	}))
+}
+
+// ReauthRequestCodeHandler returns the POST endpoint that issues a one-time
+// code for re-authenticating the signed-in user (step-up), then redirects
+// to redirect with notice=sent whether or not a code went out. The form
+// field "method" picks the method (default "email"). Mount it behind the
+// auth chain: the user comes from the request's userauth.Identity, and a
+// request without one gets 401.
+func (f *Form) ReauthRequestCodeHandler(redirect string) http.Handler {
+	return f.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		method := r.PostFormValue("method")
+		if method == "" {
+			method = login.MethodEmail
+		}
+		if !f.initiator(method) {
+			http.NotFound(w, r)
+			return
+		}
+		id, ok := userauth.IdentityFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err := f.flow.InitiateReauth(locale.FromRequest(r), f.attempt.Read(r), id.UserID, method); err != nil {
+			f.fail(w, "initiate reauth failed", err)
+			return
+		}
+		f.redirect(w, r, redirect, url.Values{"notice": {"sent"}})
+	}))
+}
+
+func (f *Form) protect(next http.Handler) http.Handler {
+	if f.csrf == nil {
+		return next
+	}
+	return f.csrf.Middleware(next)
+}
+
+// startPage renders the first step.
+func (f *Form) startPage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	ret := f.returnTo(q)
+	data := PageData{Method: f.start, User: q.Get("user"), First: true}
+	page := "password"
+	if f.start == login.MethodPassword {
+		data.Action = f.withReturn(f.base, ret)
+	} else {
+		page = "request"
+		data.Action = f.withReturn(f.methodURL(f.start)+"/send", ret)
+	}
+	f.render(w, r, page, data, q)
+}
+
+// submitPassword handles the password step.
+func (f *Form) submitPassword(w http.ResponseWriter, r *http.Request) {
+	user := strings.TrimSpace(r.PostFormValue("username"))
+	password := r.PostFormValue("password")
+	if f.start != login.MethodPassword {
+		http.NotFound(w, r)
+		return
+	}
+	ret := f.returnTo(r.URL.Query())
+	if user == "" || password == "" {
+		f.redirect(w, r, f.base, url.Values{"user": {user}, "error": {"missing"}, f.ret: {ret}})
+		return
+	}
+	res, err := f.flow.Submit(r, w, "", user, login.MethodPassword, password, r.PostFormValue("remember") != "")
+	f.advance(w, r, res, err, user, f.base, nil, ret)
+}
+
+// codePage renders the code form of a method.
+func (f *Form) codePage(w http.ResponseWriter, r *http.Request) {
+	method := r.PathValue("method")
+	if !f.registered(method) || method == login.MethodPassword {
+		http.NotFound(w, r)
+		return
+	}
+	q := r.URL.Query()
+	next := f.nextFrom(q)
+	ret := f.returnTo(q)
+	data := PageData{
+		Method:    method,
+		Action:    f.withReturn(f.methodURL(method), ret),
+		User:      q.Get("user"),
+		First:     len(next) == 0,
+		StartOver: f.withReturn(f.base, ret),
+	}
+	data.RememberDevice = !data.First && f.flow.Devices != nil
+	if f.initiator(method) {
+		data.SendAction = f.withReturn(f.methodURL(method)+"/send", ret)
+	}
+	for _, alt := range next {
+		if alt == method {
+			continue
+		}
+		label := methodLabels[alt]
+		if label == "" {
+			label = "Use " + alt
+		}
+		data.Alternatives = append(data.Alternatives, Alternative{
+			Method: alt,
+			Label:  label,
+			URL:    f.stepURL(alt, data.User, next, "", ret),
+		})
+	}
+	page := method
+	if !f.pages.has(page) {
+		page = "code"
+	}
+	f.render(w, r, page, data, q)
+}
+
+// submitCode handles a code step.
+func (f *Form) submitCode(w http.ResponseWriter, r *http.Request) {
+	method := r.PathValue("method")
+	if !f.registered(method) || method == login.MethodPassword {
+		http.NotFound(w, r)
+		return
+	}
+	user := strings.TrimSpace(r.PostFormValue("username"))
+	code := strings.TrimSpace(r.PostFormValue("code"))
+	next := f.nextFrom(r.URL.Query())
+	ret := f.returnTo(r.URL.Query())
+	back := f.methodURL(method)
+	if user == "" || code == "" {
+		f.redirect(w, r, back, url.Values{"user": {user}, "next": nextParam(next), "error": {"missing"}, f.ret: {ret}})
+		return
+	}
+	if r.PostFormValue("remember_device") != "" {
+		r = r.WithContext(login.WithRememberDevice(r.Context(), ""))
+	}
+	res, err := f.flow.Submit(r, w, f.attempt.Read(r), user, method, code, r.PostFormValue("remember") != "")
+	f.advance(w, r, res, err, user, back, next, ret)
+}
+
+// sendCode issues a code and moves on to its form. The redirect is the same
+// whether or not a code went out.
+func (f *Form) sendCode(w http.ResponseWriter, r *http.Request) {
+	method := r.PathValue("method")
+	if !f.initiator(method) {
+		http.NotFound(w, r)
+		return
+	}
+	user := strings.TrimSpace(r.PostFormValue("username"))
+	next := f.nextFrom(r.URL.Query())
+	ret := f.returnTo(r.URL.Query())
+	if user == "" {
+		target := f.base
+		if f.start != method {
+			target = f.methodURL(method)
+		}
+		f.redirect(w, r, target, url.Values{"next": nextParam(next), "error": {"missing"}, f.ret: {ret}})
+		return
+	}
+	if err := f.flow.Initiate(locale.FromRequest(r), f.attempt.Read(r), user, method); err != nil {
+		f.fail(w, "initiate failed", err)
+		return
+	}
+	f.redirect(w, r, f.stepURL(method, user, next, "sent", ret), nil)
+}
+
+// advance redirects after a Submit: to the return-to path (ret) or
+// SuccessURL when done, to the next step when more factors are required,
+// or back with the uniform error.
+func (f *Form) advance(w http.ResponseWriter, r *http.Request, res login.Result, err error, user, back string, next []string, ret string) {
+	switch {
+	case err != nil:
+		f.fail(w, "flow error", err)
+	case !res.OK:
+		f.redirect(w, r, back, url.Values{"user": {user}, "next": nextParam(next), "error": {"invalid"}, f.ret: {ret}})
+	case res.Done:
+		f.attempt.Clear(w)
+		target := f.success
+		if ret != "" {
+			target = ret
+		}
+		http.Redirect(w, r, target, http.StatusSeeOther)
+	default:
+		f.attempt.Write(w, res.Attempt)
+		f.redirect(w, r, f.stepURL(res.Next[0], user, res.Next, "", ret), nil)
+	}
+}
+
+// stepURL is the GET URL of a method's code form. A deliverable method
+// reached as a later factor has not sent anything yet; its page offers the
+// send button.
+func (f *Form) stepURL(method, user string, next []string, notice, ret string) string {
+	q := url.Values{"user": {user}}
+	if len(next) > 0 {
+		q["next"] = nextParam(next)
+	}
+	if notice != "" {
+		q.Set("notice", notice)
+	}
+	if ret != "" {
+		q.Set(f.ret, ret)
+	}
+	return f.methodURL(method) + "?" + q.Encode()
+}
+
+// returnTo reads the return-to path from the query; anything that is not a
+// safe local path is dropped.
+func (f *Form) returnTo(q url.Values) string {
+	if ret := q.Get(f.ret); chain.IsSafeReturnTo(ret) {
+		return ret
+	}
+	return ""
+}
+
+// withReturn carries the return-to path on a form action or link.
+func (f *Form) withReturn(target, ret string) string {
+	if ret == "" {
+		return target
+	}
+	return target + "?" + url.Values{f.ret: {ret}}.Encode()
+}
+
+func (f *Form) methodURL(method string) string {
+	return f.base + "/" + url.PathEscape(method)
+}
+
+func (f *Form) redirect(w http.ResponseWriter, r *http.Request, target string, q url.Values) {
+	for k, v := range q {
+		if len(v) == 0 || v[0] == "" {
+			delete(q, k)
+		}
+	}
+	if len(q) > 0 {
+		target += "?" + q.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// nextFrom reads the methods offered at this step from the query, keeping
+// only registered ones: the list only drives links, the flow decides.
+func (f *Form) nextFrom(q url.Values) []string {
+	var next []string
+	for _, id := range strings.Split(q.Get("next"), ",") {
+		if id != "" && f.registered(id) {
+			next = append(next, id)
+		}
+	}
+	return next
+}
+
+func nextParam(next []string) []string {
+	if len(next) == 0 {
+		return nil
+	}
+	return []string{strings.Join(next, ",")}
+}
+
+func (f *Form) registered(id string) bool {
+	for _, m := range f.flow.Methods {
+		if m.ID() == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Form) initiator(id string) bool {
+	for _, m := range f.flow.Methods {
+		if m.ID() == id {
+			_, ok := m.(login.Initiator)
+			return ok
+		}
+	}
+	return false
+}
+
+// render fills in the messages and CSRF token and executes the page into a
+// buffer, so a template error still yields a clean 500.
+func (f *Form) render(w http.ResponseWriter, r *http.Request, page string, data PageData, q url.Values) {
+	data.Error = errorMessages[q.Get("error")]
+	data.Notice = noticeMessages[q.Get("notice")]
+	if f.csrf != nil {
+		token, err := f.csrf.Token(r, w)
+		if err != nil {
+			f.fail(w, "csrf token", err)
+			return
+		}
+		data.CSRFField, data.CSRFToken = f.csrf.FormField(), token
+	}
+	var buf bytes.Buffer
+	if err := f.pages.execute(&buf, page, data); err != nil {
+		f.fail(w, "render "+page, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = buf.WriteTo(w)
+}
+
+func (f *Form) fail(w http.ResponseWriter, what string, err error) {
+	f.logger.Error("login form: "+what, "error", err)
+	http.Error(w, "internal error", http.StatusInternalServerError)
+}
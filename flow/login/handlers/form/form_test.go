@@ -0,0 +1,465 @@
+package form_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-bumbu/userauth"
+	"github.com/go-bumbu/userauth/auth/cookieauth"
+	"github.com/go-bumbu/userauth/auth/csrf"
+	"github.com/go-bumbu/userauth/flow/login"
+	"github.com/go-bumbu/userauth/flow/login/attemptstore/memory"
+	"github.com/go-bumbu/userauth/flow/login/handlers"
+	"github.com/go-bumbu/userauth/flow/login/handlers/form"
+	"github.com/go-bumbu/userauth/internal/hashutil"
+	totpsvc "github.com/go-bumbu/userauth/service/totp"
+	"github.com/go-bumbu/userauth/service/verificationcode"
+	csmemory "github.com/go-bumbu/userauth/service/verificationcode/store/memory"
+	"github.com/go-bumbu/userauth/userstore/staticusers"
+	"github.com/gorilla/securecookie"
+	"github.com/pquerna/otp/totp"
+)
+
+var totpSecret = func() string {
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "test", AccountName: "test"})
+	if err != nil {
+		panic(err)
+	}
+	return key.Secret()
+}()
+
+// captureLogin records the user a session was created for.
+type captureLogin struct{ userID string }
+
+func (l *captureLogin) LoginUser(_ *http.Request, _ http.ResponseWriter, userID string, _ bool) error {
+	l.userID = userID
+	return nil
+}
+
+// captureDeliverer records the last delivered code.
+type captureDeliverer struct{ code string }
+
+func (d *captureDeliverer) Deliver(_ context.Context, msg verificationcode.Message) error {
+	d.code = msg.Code
+	return nil
+}
+
+var users = &staticusers.Users{Users: []staticusers.User{
+	{Id: "plain", HashPw: hashutil.MustHashPassword("plain-pw"), Enabled: true},
+	{Id: "careful", HashPw: hashutil.MustHashPassword("careful-pw"), Enabled: true, TOTPSecret: totpSecret},
+	{Id: "gone", HashPw: hashutil.MustHashPassword("gone-pw"), Enabled: false},
+}}
+
+// browser drives the form over a real server, following the redirects and
+// keeping cookies like a browser.
+type browser struct {
+	t      *testing.T
+	srv    *httptest.Server
+	client *http.Client
+}
+
+func newBrowser(t *testing.T, f *form.Form) *browser {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle("/login", f.Handler())
+	mux.Handle("/login/", f.Handler())
+	mux.Handle("/logout", f.LogoutHandler("/"))
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, _ *http.Request) { _, _ = io.WriteString(w, "home") })
+	mux.HandleFunc("GET /settings", func(w http.ResponseWriter, _ *http.Request) { _, _ = io.WriteString(w, "settings") })
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &browser{t: t, srv: srv, client: &http.Client{Jar: jar}}
+}
+
+// other is a second browser on the same server, with its own cookies.
+func (b *browser) other() *browser {
+	b.t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	return &browser{t: b.t, srv: b.srv, client: &http.Client{Jar: jar}}
+}
+
+// page is where the browser ended up.
+type page struct {
+	status int
+	path   string
+	query  url.Values
+	body   string
+}
+
+func (b *browser) do(req *http.Request, err error) page {
+	b.t.Helper()
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	res, err := b.client.Do(req)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	return page{status: res.StatusCode, path: res.Request.URL.Path, query: res.Request.URL.Query(), body: string(body)}
+}
+
+func (b *browser) get(path string) page {
+	b.t.Helper()
+	return b.do(http.NewRequest(http.MethodGet, b.srv.URL+path, nil))
+}
+
+func (b *browser) post(path string, form url.Values) page {
+	b.t.Helper()
+	req, err := http.NewRequest(http.MethodPost, b.srv.URL+path, strings.NewReader(form.Encode()))
+	if req != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	return b.do(req, err)
+}
+
+func passwordTOTPForm(t *testing.T, session login.UserLogin, opts form.Opts) *form.Form {
+	t.Helper()
+	factor, err := totpsvc.FromGetter(users, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := form.NewPasswordTOTP(form.PasswordTOTPCfg{
+		Flow: handlers.PasswordTOTPCfg{
+			Users:    users,
+			Session:  session,
+			Attempts: memory.New(),
+			TOTP:     factor,
+			Recovery: rejectRecovery{},
+		},
+		Opts: opts,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+type rejectRecovery struct{}
+
+func (rejectRecovery) VerifyRecoveryCode(string, string) (bool, error) { return false, nil }
+
+func TestPasswordTOTP(t *testing.T) {
+	t.Run("password-only user", func(t *testing.T) {
+		session := &captureLogin{}
+		b := newBrowser(t, passwordTOTPForm(t, session, form.Opts{}))
+		if p := b.get("/login"); p.status != http.StatusOK || !strings.Contains(p.body, `name="password"`) {
+			t.Fatalf("want the password form, got %d:\n%s", p.status, p.body)
+		}
+		p := b.post("/login", url.Values{"username": {"plain"}, "password": {"plain-pw"}})
+		if p.path != "/" || p.body != "home" || session.userID != "plain" {
+			t.Fatalf("want to land home logged in, got %s (%q), session %q", p.path, p.body, session.userID)
+		}
+	})
+
+	t.Run("TOTP user takes the second step", func(t *testing.T) {
+		session := &captureLogin{}
+		b := newBrowser(t, passwordTOTPForm(t, session, form.Opts{}))
+		p := b.post("/login", url.Values{"username": {"careful"}, "password": {"careful-pw"}})
+		if p.path != "/login/totp" || p.query.Get("user") != "careful" || session.userID != "" {
+			t.Fatalf("want the totp page without a session, got %s?%s (session %q)", p.path, p.query.Encode(), session.userID)
+		}
+		if !strings.Contains(p.body, "Authenticator code") || !strings.Contains(p.body, "Use a recovery code") {
+			t.Errorf("totp page should offer the recovery alternative:\n%s", p.body)
+		}
+
+		p = b.post("/login/totp?next=totp,recovery", url.Values{"username": {"careful"}, "code": {"000000"}})
+		if p.path != "/login/totp" || !strings.Contains(p.body, "Invalid credentials.") {
+			t.Fatalf("a wrong code should come back with the error, got %s:\n%s", p.path, p.body)
+		}
+		if !strings.Contains(p.body, "Use a recovery code") {
+			t.Error("the alternatives must survive a failed submission")
+		}
+
+		code, err := totp.GenerateCode(totpSecret, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		p = b.post("/login/totp", url.Values{"username": {"careful"}, "code": {code}})
+		if p.path != "/" || session.userID != "careful" {
+			t.Fatalf("want to land home logged in, got %s, session %q", p.path, session.userID)
+		}
+	})
+
+	t.Run("the second step stays with the browser that took the first", func(t *testing.T) {
+		session := &captureLogin{}
+		b := newBrowser(t, passwordTOTPForm(t, session, form.Opts{}))
+		b.post("/login", url.Values{"username": {"careful"}, "password": {"careful-pw"}})
+
+		code, err := totp.GenerateCode(totpSecret, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := b.other().post("/login/totp", url.Values{"username": {"careful"}, "code": {code}})
+		if p.path != "/login/totp" || p.query.Get("error") != "invalid" || session.userID != "" {
+			t.Fatalf("another browser must not finish the login, got %s?%s (session %q)", p.path, p.query.Encode(), session.userID)
+		}
+	})
+}
+
+func TestReturnTo(t *testing.T) {
+	t.Run("single step returns to the page", func(t *testing.T) {
+		b := newBrowser(t, passwordTOTPForm(t, &captureLogin{}, form.Opts{}))
+		if p := b.get("/login?return_to=%2Fsettings"); !strings.Contains(p.body, "return_to=") {
+			t.Fatalf("the password form must carry the return-to path:\n%s", p.body)
+		}
+		p := b.post("/login?return_to=%2Fsettings", url.Values{"username": {"plain"}, "password": {"plain-pw"}})
+		if p.path != "/settings" || p.body != "settings" {
+			t.Fatalf("want to land on /settings, got %s (%q)", p.path, p.body)
+		}
+	})
+
+	t.Run("unsafe return-to falls back to the success url", func(t *testing.T) {
+		b := newBrowser(t, passwordTOTPForm(t, &captureLogin{}, form.Opts{}))
+		p := b.post("/login?return_to=%2F%2Fevil.example%2Fx", url.Values{"username": {"plain"}, "password": {"plain-pw"}})
+		if p.path != "/" || p.body != "home" {
+			t.Fatalf("want to land home, got %s (%q)", p.path, p.body)
+		}
+	})
+
+	t.Run("the return-to survives the second step", func(t *testing.T) {
+		b := newBrowser(t, passwordTOTPForm(t, &captureLogin{}, form.Opts{}))
+		p := b.post("/login?return_to=%2Fsettings", url.Values{"username": {"careful"}, "password": {"careful-pw"}})
+		if p.path != "/login/totp" || p.query.Get("return_to") != "/settings" || p.query.Get("next") == "" {
+			t.Fatalf("want the totp page carrying both return_to and next, got %s?%s", p.path, p.query.Encode())
+		}
+		if !strings.Contains(p.body, "return_to=") {
+			t.Errorf("the totp form must post the return-to path on:\n%s", p.body)
+		}
+		code, err := totp.GenerateCode(totpSecret, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		p = b.post("/login/totp?return_to=%2Fsettings", url.Values{"username": {"careful"}, "code": {code}})
+		if p.path != "/settings" {
+			t.Fatalf("want to land on /settings, got %s", p.path)
+		}
+	})
+}
+
+func TestUniformFailures(t *testing.T) {
+	b := newBrowser(t, passwordTOTPForm(t, &captureLogin{}, form.Opts{}))
+	var pages []page
+	for _, creds := range [][2]string{{"plain", "wrong"}, {"gone", "gone-pw"}, {"nobody", "pw"}} {
+		p := b.post("/login", url.Values{"username": {creds[0]}, "password": {creds[1]}})
+		if p.path != "/login" || p.query.Get("error") != "invalid" {
+			t.Fatalf("%s: want the login page with the error, got %s?%s", creds[0], p.path, p.query.Encode())
+		}
+		// the only difference may be the echoed username
+		p.body = strings.ReplaceAll(p.body, creds[0], "USER")
+		pages = append(pages, p)
+	}
+	for _, p := range pages[1:] {
+		if p.body != pages[0].body {
+			t.Errorf("failure pages differ:\n%s\n---\n%s", pages[0].body, p.body)
+		}
+	}
+
+	p := b.post("/login", url.Values{"username": {"plain"}})
+	if !strings.Contains(p.body, "Please fill in all fields.") {
+		t.Errorf("missing fields should say so:\n%s", p.body)
+	}
+	if p := b.get("/login/password"); p.status != http.StatusNotFound {
+		t.Errorf("the password step has no code page, got %d", p.status)
+	}
+	if p := b.get("/login/nope"); p.status != http.StatusNotFound {
+		t.Errorf("unknown methods should 404, got %d", p.status)
+	}
+}
+
+func TestEmailCode(t *testing.T) {
+	deliver := &captureDeliverer{}
+	session := &captureLogin{}
+	f, err := form.NewEmailCode(form.EmailCodeCfg{
+		Flow: handlers.EmailCodeCfg{
+			Users:   users,
+			Codes:   verificationcode.NewService(csmemory.New(), verificationcode.Opts{}),
+			Deliver: deliver,
+			Session: session,
+		},
+		Opts: form.Opts{SuccessURL: "/"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newBrowser(t, f)
+
+	if p := b.get("/login"); !strings.Contains(p.body, `action="/login/email/send"`) || strings.Contains(p.body, `name="password"`) {
+		t.Fatalf("want the username-only request page:\n%s", p.body)
+	}
+	known := b.post("/login/email/send", url.Values{"username": {"plain"}})
+	unknown := b.post("/login/email/send", url.Values{"username": {"nobody"}})
+	for _, p := range []page{known, unknown} {
+		if p.path != "/login/email" || !strings.Contains(p.body, "a code is on its way") {
+			t.Errorf("requesting a code must look the same for every account, got %s:\n%s", p.path, p.body)
+		}
+	}
+	if deliver.code == "" {
+		t.Fatal("no code delivered to the known user")
+	}
+	if !strings.Contains(known.body, `name="remember"`) {
+		t.Error("a first-factor code page offers keep-me-signed-in")
+	}
+
+	p := b.post("/login/email", url.Values{"username": {"plain"}, "code": {deliver.code}})
+	if p.path != "/" || session.userID != "plain" {
+		t.Fatalf("want to land home logged in, got %s, session %q", p.path, session.userID)
+	}
+}
+
+func TestReauthRequestCode(t *testing.T) {
+	deliver := &captureDeliverer{}
+	f, err := form.NewEmailCode(form.EmailCodeCfg{
+		Flow: handlers.EmailCodeCfg{
+			Users:   users,
+			Codes:   verificationcode.NewService(csmemory.New(), verificationcode.Opts{}),
+			Deliver: deliver,
+			Session: &captureLogin{},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := f.ReauthRequestCodeHandler("/account/confirm")
+	send := func(method string, id *userauth.Identity) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/account/reauth/send", nil)
+		if id != nil {
+			r = r.WithContext(userauth.ContextWithIdentity(r.Context(), *id))
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := send(http.MethodPost, nil); w.Code != http.StatusUnauthorized || deliver.code != "" {
+		t.Errorf("without an identity: want 401 and no code, got %d (code %q)", w.Code, deliver.code)
+	}
+	if w := send(http.MethodGet, &userauth.Identity{UserID: "plain"}); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: want 405, got %d", w.Code)
+	}
+	w := send(http.MethodPost, &userauth.Identity{UserID: "plain"})
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/account/confirm?notice=sent" {
+		t.Fatalf("want a redirect to the confirm page, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if deliver.code == "" {
+		t.Error("no code delivered to the signed-in user")
+	}
+}
+
+func TestTemplateDir(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("password.html", `{{define "title"}}Welcome back{{end}}{{define "content"}}<form action="{{.Action}}"></form>{{end}}`)
+
+	b := newBrowser(t, passwordTOTPForm(t, &captureLogin{}, form.Opts{TemplateDir: dir}))
+	p := b.get("/login")
+	if !strings.Contains(p.body, "<title>Welcome back</title>") {
+		t.Errorf("override not used:\n%s", p.body)
+	}
+	if p := b.get("/login/totp?user=careful"); !strings.Contains(p.body, "Authenticator code") {
+		t.Errorf("pages without an override keep the default:\n%s", p.body)
+	}
+
+	write("totp.html", `{{define "title"}}{{.Nope}}{{end}}{{define "content"}}{{end}}`)
+	b = newBrowser(t, passwordTOTPForm(t, &captureLogin{}, form.Opts{TemplateDir: dir}))
+	if p := b.get("/login/totp"); p.status != http.StatusInternalServerError {
+		t.Errorf("a failing template should 500 cleanly, got %d", p.status)
+	}
+
+	write("recovery.html", `{{define "title"}`)
+	_, err := form.New(&login.Flow{Methods: []login.Method{login.PasswordMethod{Users: users}}}, form.Opts{TemplateDir: dir})
+	if err == nil {
+		t.Error("want error for a template that does not parse")
+	}
+	if _, err := form.New(&login.Flow{Methods: []login.Method{login.PasswordMethod{Users: users}}}, form.Opts{TemplateDir: "/nonexistent"}); err == nil {
+		t.Error("want error for a missing template dir")
+	}
+}
+
+var csrfInput = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+func TestCSRF(t *testing.T) {
+	store, err := cookieauth.NewCookieStore(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Options.Secure = false // the test server speaks plain HTTP
+	sessions, err := cookieauth.New(cookieauth.Cfg{Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	protector, err := csrf.New(csrf.Cfg{Sessions: sessions})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newBrowser(t, passwordTOTPForm(t, sessions, form.Opts{CSRF: protector}))
+
+	m := csrfInput.FindStringSubmatch(b.get("/login").body)
+	if m == nil {
+		t.Fatal("the form must embed the token")
+	}
+	if p := b.post("/login", url.Values{"username": {"plain"}, "password": {"plain-pw"}}); p.status != http.StatusForbidden {
+		t.Fatalf("a POST without the token must be rejected, got %d", p.status)
+	}
+	p := b.post("/login", url.Values{"username": {"plain"}, "password": {"plain-pw"}, "csrf_token": {m[1]}})
+	if p.path != "/" {
+		t.Fatalf("with the token the login should go through, got %d %s", p.status, p.path)
+	}
+
+	// logging in rotated the token
+	m = csrfInput.FindStringSubmatch(b.get("/login").body)
+	if m == nil {
+		t.Fatal("the form must embed the token")
+	}
+	if p := b.post("/logout", nil); p.status != http.StatusForbidden {
+		t.Fatalf("a logout without the token must be rejected, got %d", p.status)
+	}
+	if p := b.get("/logout"); p.status != http.StatusMethodNotAllowed {
+		t.Fatalf("a GET logout must be rejected, got %d", p.status)
+	}
+	if p := b.post("/logout", url.Values{"csrf_token": {m[1]}}); p.path != "/" {
+		t.Fatalf("with the token the logout should go through, got %d %s", p.status, p.path)
+	}
+	// the session is gone, and the token with it
+	if p := b.post("/logout", url.Values{"csrf_token": {m[1]}}); p.status != http.StatusForbidden {
+		t.Fatalf("the old token must not survive the logout, got %d", p.status)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := form.New(nil, form.Opts{}); err == nil {
+		t.Error("want error for a nil flow")
+	}
+	factor, err := totpsvc.FromGetter(users, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := form.New(&login.Flow{Methods: []login.Method{login.TOTPMethod{TOTP: factor}}}, form.Opts{}); err == nil {
+		t.Error("want error for a flow with no first step")
+	}
+}
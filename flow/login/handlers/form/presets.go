@@ -0,0 +1,30 @@
+package form
+
+import "github.com/go-bumbu/userauth/flow/login/handlers"
+
+// PasswordTOTPCfg configures NewPasswordTOTP: Flow is the JSON preset's
+// configuration, so both transports build the identical flow.
+type PasswordTOTPCfg struct {
+	Flow handlers.PasswordTOTPCfg
+	Opts
+}
+
+// NewPasswordTOTP returns HTML forms for username+password login with an
+// optional TOTP second factor (or a recovery code in its place), mirroring
+// handlers.NewPasswordTOTP.
+func NewPasswordTOTP(cfg PasswordTOTPCfg) (*Form, error) {
+	return New(handlers.NewPasswordTOTP(cfg.Flow).Flow, cfg.Opts)
+}
+
+// EmailCodeCfg configures NewEmailCode; see PasswordTOTPCfg.
+type EmailCodeCfg struct {
+	Flow handlers.EmailCodeCfg
+	Opts
+}
+
+// NewEmailCode returns HTML forms for passwordless email-code login: the
+// first page asks for the username and sends the code, the second takes it,
+// mirroring handlers.NewEmailCode.
+func NewEmailCode(cfg EmailCodeCfg) (*Form, error) {
+	return New(handlers.NewEmailCode(cfg.Flow).Flow, cfg.Opts)
+}
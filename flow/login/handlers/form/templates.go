@@ -0,0 +1,87 @@
+package form
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+//go:embed templates
+var embedded embed.FS
+
+const layoutFile = "layout.html"
+
+// pages holds one parsed template set per page: the layout plus the page's
+// own file.
+type pages struct {
+	sets map[string]*template.Template
+}
+
+// parsePages parses the embedded pages, replacing each file that also exists
+// in dir. Files only present in dir add pages, e.g. a template for a custom
+// method.
+func parsePages(dir string) (*pages, error) {
+	base, err := fs.Sub(embedded, "templates")
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]fs.FS{}
+	if err := collect(base, files); err != nil {
+		return nil, fmt.Errorf("embedded templates: %w", err)
+	}
+	if dir != "" {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("template dir: %w", err)
+		}
+		if err := collect(os.DirFS(dir), files); err != nil {
+			return nil, fmt.Errorf("template dir %s: %w", dir, err)
+		}
+	}
+
+	p := &pages{sets: map[string]*template.Template{}}
+	for name, fsys := range files {
+		if name == layoutFile {
+			continue
+		}
+		t, err := template.ParseFS(files[layoutFile], layoutFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", layoutFile, err)
+		}
+		if _, err := t.ParseFS(fsys, name); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		p.sets[strings.TrimSuffix(name, path.Ext(name))] = t
+	}
+	return p, nil
+}
+
+// collect records the file system each top-level .html file comes from;
+// later calls win.
+func collect(fsys fs.FS, into map[string]fs.FS) error {
+	names, err := fs.Glob(fsys, "*.html")
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		into[name] = fsys
+	}
+	return nil
+}
+
+func (p *pages) has(page string) bool {
+	_, ok := p.sets[page]
+	return ok
+}
+
+func (p *pages) execute(w io.Writer, page string, data PageData) error {
+	t, ok := p.sets[page]
+	if !ok {
+		return fmt.Errorf("no template for page %q", page)
+	}
+	return t.ExecuteTemplate(w, "layout", data)
+}
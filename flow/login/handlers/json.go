@@ -14,7 +14,10 @@ import (
 	"log/slog"
 	"net/http"
 
+	"github.com/go-bumbu/userauth"
+	"github.com/go-bumbu/userauth/auth/csrf"
 	"github.com/go-bumbu/userauth/flow/login"
+	"github.com/go-bumbu/userauth/internal/locale"
 )
 
 // JSON exposes a login.Flow as JSON endpoints. Use one of the preset
@@ -28,7 +31,8 @@ import (
 //	mux.Handle("POST /api/login/verify", j.VerifyHandler())
 type JSON struct {
 	Flow   *login.Flow
-	Logger *slog.Logger // optional; defaults to slog.Default()
+	Logger *slog.Logger    // optional; defaults to slog.Default()
+	CSRF   *csrf.Protector // optional; wraps every endpoint in its Middleware
 }
 
 // LoginPayload is the request body for LoginHandler.
@@ -36,6 +40,9 @@ type LoginPayload struct {
 	User         string `json:"username"`
 	Password     string `json:"password"`
 	SessionRenew bool   `json:"sessionRenew"`
+	// RememberDevice asks Flow.Devices to trust the browser if this
+	// submission completes the login.
+	RememberDevice bool `json:"rememberDevice"`
 }
 
 // VerifyPayload is the request body for VerifyHandler.
@@ -43,16 +50,41 @@ type VerifyPayload struct {
 	User   string `json:"username"`
 	Method string `json:"method"` // e.g. "totp", "recovery", "email"
 	Code   string `json:"code"`
+	// Attempt is Response.Attempt from the previous step of this login;
+	// empty when the code is the first factor.
+	Attempt string `json:"attempt,omitempty"`
 	// SessionRenew only matters when this verification is the first factor
 	// of the flow (e.g. passwordless email login); otherwise the value
 	// captured at the first factor wins.
 	SessionRenew bool `json:"sessionRenew"`
+	// RememberDevice is LoginPayload.RememberDevice; typically set with the
+	// second factor.
+	RememberDevice bool `json:"rememberDevice"`
 }
 
 // RequestCodePayload is the request body for RequestCodeHandler.
 type RequestCodePayload struct {
 	User   string `json:"username"`
 	Method string `json:"method,omitempty"` // defaults to "email"
+	// Attempt is Response.Attempt when the code is requested as a later
+	// factor; the policy decides what is offered from that attempt.
+	Attempt string `json:"attempt,omitempty"`
+}
+
+// ReauthPayload is the request body for ReauthHandler.
+type ReauthPayload struct {
+	Method string `json:"method"` // e.g. "password", "totp"
+	Input  string `json:"input"`  // the password or code
+	// Attempt is Response.Attempt from the previous step, if any.
+	Attempt string `json:"attempt,omitempty"`
+}
+
+// ReauthRequestCodePayload is the request body for ReauthRequestCodeHandler.
+type ReauthRequestCodePayload struct {
+	Method string `json:"method,omitempty"` // defaults to "email"
+	// Attempt is Response.Attempt when the code is requested as a later
+	// factor of the re-authentication.
+	Attempt string `json:"attempt,omitempty"`
 }
 
 // Response is the success body of LoginHandler and VerifyHandler.
@@ -62,6 +94,10 @@ type Response struct {
 	// Next lists the method IDs the user may attempt now; set when the
 	// submitted factor was accepted but the policy requires more.
 	Next []string `json:"next,omitempty"`
+	// Attempt is set with Next: the handle to send with the next step of
+	// this login. Keep it in memory only; it stands for the factors
+	// verified so far.
+	Attempt string `json:"attempt,omitempty"`
 }
 
 type errorResponse struct {
@@ -72,11 +108,11 @@ type errorResponse struct {
 //
 // Responses:
 //   - 200 {"done":true} — login complete, session created
-//   - 200 {"done":false,"next":["totp",...]} — password accepted, second factor required
+//   - 200 {"done":false,"next":["totp",...],"attempt":"..."} — password accepted, second factor required
 //   - 401 {"error":"unauthorized"} — identical for unknown user, disabled user and wrong password
 //   - 400 / 405 / 500 for malformed requests, wrong method, internal failures
 func (h *JSON) LoginHandler() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return h.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var p LoginPayload
 		if !h.decode(w, r, &p) {
 			return
@@ -89,9 +125,9 @@ func (h *JSON) LoginHandler() http.Handler {
 			h.writeError(w, http.StatusBadRequest, "password login not available")
 			return
 		}
-		res, err := h.Flow.Submit(r, w, p.User, login.MethodPassword, p.Password, p.SessionRenew)
+		res, err := h.Flow.Submit(withRemember(r, p.RememberDevice), w, "", p.User, login.MethodPassword, p.Password, p.SessionRenew)
 		h.respond(w, res, err)
-	})
+	}))
 }
 
 // VerifyHandler returns the POST endpoint that submits a one-time code
@@ -99,10 +135,10 @@ func (h *JSON) LoginHandler() http.Handler {
 // code as the first factor of a passwordless login.
 //
 // Responses mirror LoginHandler; a code for a factor the policy is not
-// currently offering (e.g. TOTP before the password step, or an expired
-// attempt) yields the same 401 as a wrong code.
+// currently offering (e.g. TOTP before the password step, or a missing or
+// expired attempt) yields the same 401 as a wrong code.
 func (h *JSON) VerifyHandler() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return h.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var p VerifyPayload
 		if !h.decode(w, r, &p) {
 			return
@@ -115,9 +151,19 @@ func (h *JSON) VerifyHandler() http.Handler {
 			h.writeError(w, http.StatusBadRequest, "unknown method")
 			return
 		}
-		res, err := h.Flow.Submit(r, w, p.User, p.Method, p.Code, p.SessionRenew)
+		res, err := h.Flow.Submit(withRemember(r, p.RememberDevice), w, p.Attempt, p.User, p.Method, p.Code, p.SessionRenew)
 		h.respond(w, res, err)
-	})
+	}))
+}
+
+// withRemember marks the request for login.WithRememberDevice when the
+// client asked to trust the browser; the device is named after its
+// User-Agent.
+func withRemember(r *http.Request, remember bool) *http.Request {
+	if !remember {
+		return r
+	}
+	return r.WithContext(login.WithRememberDevice(r.Context(), ""))
 }
 
 // RequestCodeHandler returns the POST endpoint that requests delivery of a
@@ -128,7 +174,7 @@ func (h *JSON) VerifyHandler() http.Handler {
 // to known enabled users and logs failures server-side, so the endpoint
 // cannot be used to probe which accounts exist.
 func (h *JSON) RequestCodeHandler() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return h.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var p RequestCodePayload
 		if !h.decode(w, r, &p) {
 			return
@@ -145,13 +191,113 @@ func (h *JSON) RequestCodeHandler() http.Handler {
 			h.writeError(w, http.StatusBadRequest, "method does not support code delivery")
 			return
 		}
-		if err := h.Flow.Initiate(r, p.User, method); err != nil {
+		if err := h.Flow.Initiate(locale.FromRequest(r), p.Attempt, p.User, method); err != nil {
 			h.logger().Error("json login: initiate failed", "method", method, "error", err)
 			h.writeError(w, http.StatusInternalServerError, "internal error")
 			return
 		}
 		h.writeJSON(w, http.StatusAccepted, struct{}{})
-	})
+	}))
+}
+
+// ReauthHandler returns the POST endpoint that re-authenticates the
+// signed-in user (step-up) and upgrades their session. Mount it behind the
+// auth chain: the user comes from the request's userauth.Identity, never
+// from the body.
+//
+// Responses mirror VerifyHandler ({"done":true} once the session was
+// upgraded, {"done":false,"next":[...]} when ReauthPolicy wants more); a
+// request without an identity gets 401 like a wrong credential.
+func (h *JSON) ReauthHandler() http.Handler {
+	return h.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p ReauthPayload
+		if !h.decode(w, r, &p) {
+			return
+		}
+		if p.Method == "" || p.Input == "" {
+			h.writeError(w, http.StatusBadRequest, "method and input are required")
+			return
+		}
+		if !h.methodAvailable(p.Method) {
+			h.writeError(w, http.StatusBadRequest, "unknown method")
+			return
+		}
+		id, ok := userauth.IdentityFromContext(r.Context())
+		if !ok {
+			h.writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		res, err := h.Flow.Reauthenticate(r, w, p.Attempt, id.UserID, p.Method, p.Input)
+		h.respond(w, res, err)
+	}))
+}
+
+// ReauthRequestCodeHandler returns the POST endpoint that issues a one-time
+// code (method defaults to "email") for re-authenticating the signed-in
+// user; ReauthHandler then submits it. Like ReauthHandler it is mounted
+// behind the auth chain and takes the user from the request's
+// userauth.Identity.
+//
+// Responses:
+//   - 202 {} — whether or not ReauthPolicy offered the method and a code went out
+//   - 401 {"error":"unauthorized"} — no identity on the request
+//   - 400 / 405 / 500 for malformed requests, wrong method, internal failures
+func (h *JSON) ReauthRequestCodeHandler() http.Handler {
+	return h.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p ReauthRequestCodePayload
+		if !h.decode(w, r, &p) {
+			return
+		}
+		method := p.Method
+		if method == "" {
+			method = login.MethodEmail
+		}
+		if !h.initiatorAvailable(method) {
+			h.writeError(w, http.StatusBadRequest, "method does not support code delivery")
+			return
+		}
+		id, ok := userauth.IdentityFromContext(r.Context())
+		if !ok {
+			h.writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		if err := h.Flow.InitiateReauth(locale.FromRequest(r), p.Attempt, id.UserID, method); err != nil {
+			h.logger().Error("json login: initiate reauth failed", "method", method, "error", err)
+			h.writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		h.writeJSON(w, http.StatusAccepted, struct{}{})
+	}))
+}
+
+// LogoutHandler returns the POST endpoint that ends the session; Session
+// must implement login.UserLogout. With CSRF configured, other sites cannot
+// log the user out.
+//
+// Responses:
+//   - 204 — session ended (also when there was none)
+//   - 405 / 500 for wrong method, internal failures
+func (h *JSON) LogoutHandler() http.Handler {
+	return h.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			h.writeError(w, http.StatusMethodNotAllowed, "wrong method")
+			return
+		}
+		if err := h.Flow.Logout(r, w); err != nil {
+			h.logger().Error("json login: logout failed", "error", err)
+			h.writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+// protect wraps next in the CSRF middleware when one is configured.
+func (h *JSON) protect(next http.Handler) http.Handler {
+	if h.CSRF == nil {
+		return next
+	}
+	return h.CSRF.Middleware(next)
 }
 
 func (h *JSON) logger() *slog.Logger {
@@ -211,7 +357,7 @@ func (h *JSON) respond(w http.ResponseWriter, res login.Result, err error) {
 		h.writeError(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
-	h.writeJSON(w, http.StatusOK, Response{Done: res.Done, Next: res.Next})
+	h.writeJSON(w, http.StatusOK, Response{Done: res.Done, Next: res.Next, Attempt: res.Attempt})
 }
 
 func (h *JSON) writeJSON(w http.ResponseWriter, status int, body any) {
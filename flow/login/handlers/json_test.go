@@ -9,15 +9,20 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-bumbu/userauth/auth/cookieauth"
+	"github.com/go-bumbu/userauth/auth/csrf"
 	"github.com/go-bumbu/userauth/flow/login"
 	"github.com/go-bumbu/userauth/flow/login/attemptstore/memory"
 	"github.com/go-bumbu/userauth/flow/login/handlers"
 	"github.com/go-bumbu/userauth/internal/hashutil"
 	totpsvc "github.com/go-bumbu/userauth/service/totp"
+	"github.com/go-bumbu/userauth/service/trusteddevice"
+	tdmemory "github.com/go-bumbu/userauth/service/trusteddevice/store/memory"
 	"github.com/go-bumbu/userauth/service/verificationcode"
 	csmemory "github.com/go-bumbu/userauth/service/verificationcode/store/memory"
 	"github.com/go-bumbu/userauth/userstore/staticusers"
 	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/securecookie"
 	"github.com/pquerna/otp/totp"
 )
 
@@ -31,11 +36,18 @@ var totpSecret = func() string {
 	return key.Secret()
 }()
 
-// captureLogin records LoginUser calls instead of creating a real session.
+// captureLogin records LoginUser and LogoutUser calls instead of managing a
+// real session.
 type captureLogin struct {
-	userID string
-	keep   bool
-	calls  int
+	userID  string
+	keep    bool
+	calls   int
+	logouts int
+}
+
+func (l *captureLogin) LogoutUser(_ *http.Request, _ http.ResponseWriter) error {
+	l.logouts++
+	return nil
 }
 
 func (l *captureLogin) LoginUser(_ *http.Request, _ http.ResponseWriter, userID string, keep bool) error {
@@ -47,11 +59,13 @@ func (l *captureLogin) LoginUser(_ *http.Request, _ http.ResponseWriter, userID
 
 // captureDeliverer records the last delivered code instead of sending it.
 type captureDeliverer struct {
-	code string
+	code   string
+	locale string
 }
 
-func (d *captureDeliverer) Deliver(_ context.Context, _ string, code string, _ time.Time) error {
-	d.code = code
+func (d *captureDeliverer) Deliver(_ context.Context, msg verificationcode.Message) error {
+	d.code = msg.Code
+	d.locale = msg.Locale
 	return nil
 }
 
@@ -144,8 +158,11 @@ func TestPasswordTOTPLogin(t *testing.T) {
 		if session.calls != 0 {
 			t.Fatal("no session before the second factor")
 		}
+		if res.Attempt == "" {
+			t.Fatal("want an attempt handle for the second step")
+		}
 
-		w = postJSON(t, j.VerifyHandler(), handlers.VerifyPayload{User: "careful", Method: "totp", Code: totpCode(t)})
+		w = postJSON(t, j.VerifyHandler(), handlers.VerifyPayload{User: "careful", Method: "totp", Code: totpCode(t), Attempt: res.Attempt})
 		if w.Code != http.StatusOK {
 			t.Fatalf("verify: want 200, got %d: %s", w.Code, w.Body.String())
 		}
@@ -159,6 +176,46 @@ func TestPasswordTOTPLogin(t *testing.T) {
 
 }
 
+func TestPasswordTOTPRememberDevice(t *testing.T) {
+	users := &staticusers.Users{Users: []staticusers.User{
+		{Id: "careful", HashPw: hashutil.MustHashPassword("careful-pw"), Enabled: true, TOTPSecret: totpSecret},
+	}}
+	devices, err := trusteddevice.NewService(tdmemory.New(), trusteddevice.Opts{HashKey: securecookie.GenerateRandomKey(32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := &captureLogin{}
+	j := handlers.NewPasswordTOTP(handlers.PasswordTOTPCfg{
+		Users:    users,
+		Session:  session,
+		Attempts: memory.New(),
+		TOTP:     totpFactor(users),
+		Devices:  devices,
+	})
+
+	first := decodeResponse(t, postJSON(t, j.LoginHandler(), handlers.LoginPayload{User: "careful", Password: "careful-pw"}))
+	w := postJSON(t, j.VerifyHandler(), handlers.VerifyPayload{User: "careful", Method: "totp", Code: totpCode(t), Attempt: first.Attempt, RememberDevice: true})
+	if res := decodeResponse(t, w); !res.Done {
+		t.Fatalf("want done after TOTP, got %+v", res)
+	}
+	device := requestWithCookies(w.Header()).Cookies()
+	if len(device) != 1 || device[0].Name != trusteddevice.DefaultCookieName {
+		t.Fatalf("want the trusted-device cookie, got %v", device)
+	}
+
+	raw, _ := json.Marshal(handlers.LoginPayload{User: "careful", Password: "careful-pw"})
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(raw))
+	req.AddCookie(device[0])
+	w = httptest.NewRecorder()
+	j.LoginHandler().ServeHTTP(w, req)
+	if res := decodeResponse(t, w); !res.Done {
+		t.Fatalf("trusted device should skip TOTP, got %+v", res)
+	}
+	if session.calls != 2 {
+		t.Errorf("want two sessions, got %d", session.calls)
+	}
+}
+
 func TestPasswordTOTPLoginRejections(t *testing.T) {
 	t.Run("credential failures are one uniform 401", func(t *testing.T) {
 		j, session := passwordTOTPFixture()
@@ -195,14 +252,28 @@ func TestPasswordTOTPLoginRejections(t *testing.T) {
 		}
 	})
 
-	t.Run("wrong totp keeps the attempt open for a retry", func(t *testing.T) {
+	t.Run("totp without the attempt handle is 401", func(t *testing.T) {
 		j, session := passwordTOTPFixture()
+		// the password step happened elsewhere: knowing the username is not
+		// enough to continue it
 		postJSON(t, j.LoginHandler(), handlers.LoginPayload{User: "careful", Password: "careful-pw"})
-		w := postJSON(t, j.VerifyHandler(), handlers.VerifyPayload{User: "careful", Method: "totp", Code: "000000"})
+		w := postJSON(t, j.VerifyHandler(), handlers.VerifyPayload{User: "careful", Method: "totp", Code: totpCode(t)})
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("want 401, got %d", w.Code)
+		}
+		if session.calls != 0 {
+			t.Error("no session must be created")
+		}
+	})
+
+	t.Run("wrong totp keeps the attempt open for a retry", func(t *testing.T) {
+		j, session := passwordTOTPFixture()
+		first := decodeResponse(t, postJSON(t, j.LoginHandler(), handlers.LoginPayload{User: "careful", Password: "careful-pw"}))
+		w := postJSON(t, j.VerifyHandler(), handlers.VerifyPayload{User: "careful", Method: "totp", Code: "000000", Attempt: first.Attempt})
 		if w.Code != http.StatusUnauthorized {
 			t.Fatalf("wrong code: want 401, got %d", w.Code)
 		}
-		w = postJSON(t, j.VerifyHandler(), handlers.VerifyPayload{User: "careful", Method: "totp", Code: totpCode(t)})
+		w = postJSON(t, j.VerifyHandler(), handlers.VerifyPayload{User: "careful", Method: "totp", Code: totpCode(t), Attempt: first.Attempt})
 		if w.Code != http.StatusOK {
 			t.Fatalf("retry: want 200, got %d", w.Code)
 		}
@@ -262,7 +333,7 @@ func TestPasswordTOTPRecoveryCode(t *testing.T) {
 		if diff := cmp.Diff(want, res.Next); diff != "" {
 			t.Fatalf("next mismatch (-want +got):\n%s", diff)
 		}
-		w = postJSON(t, j.VerifyHandler(), handlers.VerifyPayload{User: "careful", Method: "recovery", Code: "rescue-123"})
+		w = postJSON(t, j.VerifyHandler(), handlers.VerifyPayload{User: "careful", Method: "recovery", Code: "rescue-123", Attempt: res.Attempt})
 		if w.Code != http.StatusOK {
 			t.Fatalf("recovery verify: want 200, got %d: %s", w.Code, w.Body.String())
 		}
@@ -318,6 +389,21 @@ func TestEmailCodeLogin(t *testing.T) {
 		}
 	})
 
+	t.Run("request-code passes the Accept-Language preference to the deliverer", func(t *testing.T) {
+		j, deliverer, _ := emailCodeFixture()
+		raw, _ := json.Marshal(handlers.RequestCodePayload{User: "demo@example.com"})
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(raw))
+		req.Header.Set("Accept-Language", "en;q=0.8, de-CH")
+		w := httptest.NewRecorder()
+		j.RequestCodeHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("want 202, got %d", w.Code)
+		}
+		if deliverer.locale != "de-CH" {
+			t.Errorf("want locale de-CH, got %q", deliverer.locale)
+		}
+	})
+
 	t.Run("request-code responses do not reveal account existence", func(t *testing.T) {
 		j, deliverer, _ := emailCodeFixture()
 		known := postJSON(t, j.RequestCodeHandler(), handlers.RequestCodePayload{User: "demo@example.com"})
@@ -359,3 +445,231 @@ func TestEmailCodeLogin(t *testing.T) {
 		}
 	})
 }
+
+func TestCSRFProtection(t *testing.T) {
+	store, err := cookieauth.NewCookieStore(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := cookieauth.New(cookieauth.Cfg{Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	protector, err := csrf.New(csrf.Cfg{Sessions: sessions})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &staticusers.Users{Users: []staticusers.User{
+		{Id: "plain", HashPw: hashutil.MustHashPassword("plain-pw"), Enabled: true},
+	}}
+	session := &captureLogin{}
+	j := handlers.NewPasswordTOTP(handlers.PasswordTOTPCfg{Users: users, Session: session, CSRF: protector})
+
+	// the SPA fetches the token before logging in
+	tokenRec := httptest.NewRecorder()
+	protector.TokenHandler().ServeHTTP(tokenRec, httptest.NewRequest(http.MethodGet, "/api/csrf", nil))
+	token := tokenRec.Header().Get(csrf.DefaultHeader)
+
+	submit := func(withToken bool) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/login", bytes.NewReader([]byte(`{"username":"plain","password":"plain-pw"}`)))
+		for _, c := range (&http.Response{Header: tokenRec.Header()}).Cookies() {
+			req.AddCookie(c)
+		}
+		if withToken {
+			req.Header.Set(csrf.DefaultHeader, token)
+		}
+		w := httptest.NewRecorder()
+		j.LoginHandler().ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := submit(false); code != http.StatusForbidden || session.calls != 0 {
+		t.Fatalf("without the token: status %d, logins %d; want 403 and no login", code, session.calls)
+	}
+	if code := submit(true); code != http.StatusOK || session.calls != 1 {
+		t.Fatalf("with the token: status %d, logins %d; want 200 and a login", code, session.calls)
+	}
+}
+
+func TestLogoutHandler(t *testing.T) {
+	store, err := cookieauth.NewCookieStore(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := cookieauth.New(cookieauth.Cfg{Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	protector, err := csrf.New(csrf.Cfg{Sessions: sessions})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &staticusers.Users{Users: []staticusers.User{
+		{Id: "plain", HashPw: hashutil.MustHashPassword("plain-pw"), Enabled: true},
+	}}
+	session := &captureLogin{}
+	h := handlers.NewPasswordTOTP(handlers.PasswordTOTPCfg{Users: users, Session: session, CSRF: protector}).LogoutHandler()
+
+	tokenRec := httptest.NewRecorder()
+	protector.TokenHandler().ServeHTTP(tokenRec, httptest.NewRequest(http.MethodGet, "/api/csrf", nil))
+	token := tokenRec.Header().Get(csrf.DefaultHeader)
+
+	tcs := []struct {
+		name     string
+		method   string
+		origin   string
+		token    string
+		wantCode int
+		wantOut  int
+	}{
+		{name: "cross-site form post", method: http.MethodPost, origin: "https://evil.example", wantCode: http.StatusForbidden},
+		{name: "missing token", method: http.MethodPost, wantCode: http.StatusForbidden},
+		{name: "get", method: http.MethodGet, token: token, wantCode: http.StatusMethodNotAllowed},
+		{name: "post with token", method: http.MethodPost, token: token, wantCode: http.StatusNoContent, wantOut: 1},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			session.logouts = 0
+			req := httptest.NewRequest(tc.method, "/api/logout", nil)
+			for _, c := range (&http.Response{Header: tokenRec.Header()}).Cookies() {
+				req.AddCookie(c)
+			}
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+			if tc.token != "" {
+				req.Header.Set(csrf.DefaultHeader, tc.token)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			if w.Code != tc.wantCode || session.logouts != tc.wantOut {
+				t.Errorf("status %d, logouts %d; want %d and %d", w.Code, session.logouts, tc.wantCode, tc.wantOut)
+			}
+		})
+	}
+}
+
+func TestReauthHandler(t *testing.T) {
+	store, err := cookieauth.NewCookieStore(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := cookieauth.New(cookieauth.Cfg{Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &staticusers.Users{Users: []staticusers.User{
+		{Id: "plain", HashPw: hashutil.MustHashPassword("plain-pw"), Enabled: true},
+	}}
+	j := handlers.NewPasswordTOTP(handlers.PasswordTOTPCfg{Users: users, Session: sessions})
+	reauth := sessions.Middleware(j.ReauthHandler())
+
+	login := postJSON(t, j.LoginHandler(), handlers.LoginPayload{User: "plain", Password: "plain-pw"})
+	if login.Code != http.StatusOK {
+		t.Fatalf("login: %d %s", login.Code, login.Body)
+	}
+	post := func(cookies http.Header, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/reauth", bytes.NewReader([]byte(body)))
+		for _, c := range (&http.Response{Header: cookies}).Cookies() {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		reauth.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post(nil, `{"method":"password","input":"plain-pw"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("without a session: want 401, got %d", w.Code)
+	}
+	if w := post(login.Header(), `{"method":"password","input":"wrong"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: want 401, got %d", w.Code)
+	}
+	if w := post(login.Header(), `{"method":"password"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("missing input: want 400, got %d", w.Code)
+	}
+
+	before, err := sessions.GetSessData(requestWithCookies(login.Header()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	w := post(login.Header(), `{"method":"password","input":"plain-pw"}`)
+	if w.Code != http.StatusOK || !decodeResponse(t, w).Done {
+		t.Fatalf("reauth: %d %s", w.Code, w.Body)
+	}
+	after, err := sessions.GetSessData(requestWithCookies(w.Header()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.UserId != "plain" || !after.AuthTime.After(before.AuthTime) {
+		t.Errorf("session not upgraded: %v -> %v", before.AuthTime, after.AuthTime)
+	}
+	if diff := cmp.Diff([]string{"password"}, after.AMR); diff != "" {
+		t.Errorf("AMR (-want +got):\n%s", diff)
+	}
+}
+
+func TestReauthRequestCodeHandler(t *testing.T) {
+	store, err := cookieauth.NewCookieStore(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := cookieauth.New(cookieauth.Cfg{Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &staticusers.Users{Users: []staticusers.User{
+		{Id: "demo@example.com", Enabled: true},
+	}}
+	deliverer := &captureDeliverer{}
+	j := handlers.NewEmailCode(handlers.EmailCodeCfg{
+		Users:   users,
+		Codes:   verificationcode.NewService(csmemory.New(), verificationcode.Opts{}),
+		Deliver: deliverer,
+		Session: sessions,
+	})
+	requestCode := sessions.Middleware(j.ReauthRequestCodeHandler())
+	reauth := sessions.Middleware(j.ReauthHandler())
+
+	login := httptest.NewRecorder()
+	if err := sessions.LoginUser(httptest.NewRequest(http.MethodGet, "/", nil), login, "demo@example.com", false); err != nil {
+		t.Fatal(err)
+	}
+	post := func(h http.Handler, cookies http.Header, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/reauth", bytes.NewReader([]byte(body)))
+		for _, c := range (&http.Response{Header: cookies}).Cookies() {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post(requestCode, nil, `{}`); w.Code != http.StatusUnauthorized || deliverer.code != "" {
+		t.Errorf("without a session: want 401 and no code, got %d (code %q)", w.Code, deliverer.code)
+	}
+	if w := post(requestCode, login.Header(), `{"method":"password"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("non-deliverable method: want 400, got %d", w.Code)
+	}
+	if w := post(requestCode, login.Header(), `{}`); w.Code != http.StatusAccepted || deliverer.code == "" {
+		t.Fatalf("request code: want 202 and a code, got %d (code %q)", w.Code, deliverer.code)
+	}
+	w := post(reauth, login.Header(), `{"method":"email","input":"`+deliverer.code+`"}`)
+	if w.Code != http.StatusOK || !decodeResponse(t, w).Done {
+		t.Fatalf("reauth with the code: %d %s", w.Code, w.Body)
+	}
+	after, err := sessions.GetSessData(requestWithCookies(w.Header()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"email"}, after.AMR); diff != "" {
+		t.Errorf("AMR (-want +got):\n%s", diff)
+	}
+}
+
+func requestWithCookies(h http.Header) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range (&http.Response{Header: h}).Cookies() {
+		req.AddCookie(c)
+	}
+	return req
+}
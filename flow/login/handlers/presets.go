@@ -5,6 +5,7 @@ import (
 	"slices"
 
 	"github.com/go-bumbu/userauth"
+	"github.com/go-bumbu/userauth/auth/csrf"
 	"github.com/go-bumbu/userauth/flow/login"
 	throttlememory "github.com/go-bumbu/userauth/service/throttle/store/memory"
 	"github.com/go-bumbu/userauth/service/verificationcode"
@@ -24,6 +25,9 @@ type PasswordTOTPCfg struct {
 	TOTP login.TOTPFactor
 	// Recovery optionally lets a recovery code stand in for the TOTP code.
 	Recovery userauth.RecoveryCodeVerifier
+	// Devices optionally lets users trust a browser (rememberDevice) so that
+	// it skips the TOTP step on later logins; pass a *trusteddevice.Service.
+	Devices login.DeviceTrust
 	// Throttle slows down repeated wrong TOTP/recovery guesses, and (via
 	// login.ThrottleGuard) wrong passwords per login identifier. Nil gets an
 	// in-memory throttle with the package defaults — per-instance state, so
@@ -31,7 +35,14 @@ type PasswordTOTPCfg struct {
 	// throttlestore/db. It cannot be disabled: 6-digit codes are
 	// brute-forceable without one.
 	Throttle *login.Throttle
-	Logger   *slog.Logger
+	// IPGuard optionally adds a per-network failure budget on top of the
+	// per-account guard, against credential stuffing; both limits apply.
+	IPGuard *login.IPGuard
+	// CSRF optionally guards the endpoints against cross-site request
+	// forgery, login CSRF included (csrf.New with the cookieauth.Manager as
+	// Sessions; clients fetch the token before the first step).
+	CSRF   *csrf.Protector
+	Logger *slog.Logger
 }
 
 // NewPasswordTOTP returns JSON endpoints for username+password login with an
@@ -43,6 +54,10 @@ func NewPasswordTOTP(cfg PasswordTOTPCfg) *JSON {
 	if cfg.Throttle == nil {
 		cfg.Throttle = &login.Throttle{Store: throttlememory.New()}
 	}
+	policy := passwordTOTPPolicy(cfg)
+	if cfg.Devices != nil {
+		policy = login.TrustedDevice(policy, login.MethodTOTP)
+	}
 	methods := []login.Method{login.PasswordMethod{Users: cfg.Users}}
 	if cfg.TOTP != nil {
 		methods = append(methods, login.TOTPMethod{TOTP: cfg.TOTP, Throttle: cfg.Throttle})
@@ -50,16 +65,22 @@ func NewPasswordTOTP(cfg PasswordTOTPCfg) *JSON {
 	if cfg.Recovery != nil {
 		methods = append(methods, login.RecoveryMethod{Codes: cfg.Recovery, Throttle: cfg.Throttle})
 	}
+	var guard login.Guard = login.ThrottleGuard{Throttle: cfg.Throttle}
+	if cfg.IPGuard != nil {
+		guard = login.AllGuards(guard, cfg.IPGuard)
+	}
 	return &JSON{
 		Flow: &login.Flow{
 			Users:    cfg.Users,
 			Methods:  methods,
-			Policy:   passwordTOTPPolicy(cfg),
+			Policy:   policy,
 			Attempts: cfg.Attempts,
 			Session:  cfg.Session,
-			Guard:    login.ThrottleGuard{Throttle: cfg.Throttle},
+			Guard:    guard,
+			Devices:  cfg.Devices,
 			Logger:   cfg.Logger,
 		},
+		CSRF:   cfg.CSRF,
 		Logger: cfg.Logger,
 	}
 }
@@ -112,7 +133,9 @@ type EmailCodeCfg struct {
 	// unknown accounts too — wrong codes for existing users are already
 	// capped per issued code). Nil gets a ThrottleGuard sharing the Resend
 	// limiter's store.
-	Guard  login.Guard
+	Guard login.Guard
+	// CSRF optionally guards the endpoints; see PasswordTOTPCfg.CSRF.
+	CSRF   *csrf.Protector
 	Logger *slog.Logger
 }
 
@@ -137,6 +160,7 @@ func NewEmailCode(cfg EmailCodeCfg) *JSON {
 			Guard:   cfg.Guard,
 			Logger:  cfg.Logger,
 		},
+		CSRF:   cfg.CSRF,
 		Logger: cfg.Logger,
 	}
 }
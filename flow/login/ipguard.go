@@ -0,0 +1,195 @@
+package login
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/go-bumbu/userauth/internal/clientip"
+)
+
+// IP guard defaults: a source may fail 30 times within any 15 minutes.
+// IPv6 clients are aggregated per /64, the smallest block a single
+// subscriber is usually handed.
+const (
+	DefaultIPBudget   = 30
+	DefaultIPWindow   = 15 * time.Minute
+	DefaultIPv6Prefix = 64
+	DefaultIPv4Prefix = 32
+)
+
+// ipGuardMethod namespaces IPGuard entries in the ThrottleStore.
+const ipGuardMethod = "guard:ip"
+
+// IPGuard is a Guard keyed by the client's network instead of the login
+// identifier: it notices credential stuffing — one source trying many
+// accounts, each only a few times — that ThrottleGuard cannot see. Combine
+// the two with AllGuards so both limits apply.
+//
+// Every credential failure from a source is charged to one budget across
+// all accounts and methods: a sliding window admits at most Budget
+// failures in any Window, however the source paces them, and denies it
+// until enough of them have aged out. The window is the usual two-bucket
+// approximation: failures are counted per fixed Window-long bucket, and
+// the previous bucket's count is weighted by how much of it still
+// overlaps the window. Denials are not counted, so a blocked source is
+// released on time however hard it keeps trying. Success does not reset
+// the budget: one valid password must not launder a stuffing run, and a
+// shared NAT address should rather get a generous Budget.
+//
+// The client address is resolved like Flow.TrustedProxies does; requests
+// whose address cannot be parsed are never throttled. State lives in a
+// ThrottleStore under the "guard:ip" method, keyed by the aggregated
+// network and bucket (e.g. "2001:db8:1:2::/64@1934521"), so the store may
+// be shared with a Throttle or ResendLimiter; its Sweep removes old buckets
+// as long as Window is shorter than the store's Retention. Zero-valued
+// fields fall back to the package defaults; Store is required.
+type IPGuard struct {
+	Store          ThrottleStore
+	TrustedProxies []netip.Prefix
+	Budget         int           // failures per source within any Window
+	Window         time.Duration // length of the sliding window
+	IPv6Prefix     int           // IPv6 aggregation in bits; default 64
+	IPv4Prefix     int           // IPv4 aggregation in bits; default 32 (no aggregation)
+}
+
+func (g *IPGuard) budget() int {
+	if g.Budget > 0 {
+		return g.Budget
+	}
+	return DefaultIPBudget
+}
+
+func (g *IPGuard) window() time.Duration {
+	if g.Window > 0 {
+		return g.Window
+	}
+	return DefaultIPWindow
+}
+
+// source returns the aggregated network of the request's client, or "" when
+// the address cannot be resolved.
+func (g *IPGuard) source(r *http.Request) string {
+	addr := clientip.Resolve(r, g.TrustedProxies)
+	if !addr.IsValid() {
+		return ""
+	}
+	bits := g.IPv4Prefix
+	if bits <= 0 || bits > 32 {
+		bits = DefaultIPv4Prefix
+	}
+	if addr.Is6() {
+		bits = g.IPv6Prefix
+		if bits <= 0 || bits > 128 {
+			bits = DefaultIPv6Prefix
+		}
+	}
+	p, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return p.String()
+}
+
+func (g *IPGuard) check() error {
+	if g.Store == nil {
+		return errors.New("login: IPGuard requires a Store")
+	}
+	return nil
+}
+
+// bucket returns the index of the fixed window holding t and how far into
+// it t lies, as a fraction.
+func (g *IPGuard) bucket(t time.Time) (int64, float64) {
+	w := g.window().Nanoseconds()
+	n := t.UnixNano()
+	return n / w, float64(n%w) / float64(w)
+}
+
+func bucketKey(source string, bucket int64) string {
+	return source + "@" + strconv.FormatInt(bucket, 10)
+}
+
+// Allow implements Guard: it estimates the failures of the trailing Window
+// from the current and the previous bucket.
+func (g *IPGuard) Allow(r *http.Request, _, _ string) (bool, error) {
+	if err := g.check(); err != nil {
+		return false, err
+	}
+	source := g.source(r)
+	if source == "" {
+		return true, nil
+	}
+	bucket, elapsed := g.bucket(time.Now())
+	cur, _, err := g.Store.Failures(bucketKey(source, bucket), ipGuardMethod)
+	if err != nil {
+		return false, err
+	}
+	prev, _, err := g.Store.Failures(bucketKey(source, bucket-1), ipGuardMethod)
+	if err != nil {
+		return false, err
+	}
+	return float64(cur)+float64(prev)*(1-elapsed) < float64(g.budget()), nil
+}
+
+// Fail implements Guard: the failure is charged to the source's budget.
+func (g *IPGuard) Fail(r *http.Request, _, _ string) error {
+	if err := g.check(); err != nil {
+		return err
+	}
+	source := g.source(r)
+	if source == "" {
+		return nil
+	}
+	now := time.Now()
+	bucket, _ := g.bucket(now)
+	return g.Store.AddFailure(bucketKey(source, bucket), ipGuardMethod, now)
+}
+
+// Success implements Guard and deliberately leaves the budget alone.
+func (g *IPGuard) Success(*http.Request, string, string) error {
+	return g.check()
+}
+
+// allGuards applies every guard; see AllGuards.
+type allGuards []Guard
+
+// AllGuards combines guards so that all their limits apply: a submission is
+// allowed only when every guard allows it (evaluation stops at the first
+// denial), and failures and successes are reported to each of them. The
+// usual pairing is per account and per source:
+//
+//	Guard: login.AllGuards(
+//		login.ThrottleGuard{Throttle: throttle},
+//		&login.IPGuard{Store: store, TrustedProxies: proxies})
+func AllGuards(guards ...Guard) Guard {
+	return allGuards(guards)
+}
+
+func (gs allGuards) Allow(r *http.Request, loginID, methodID string) (bool, error) {
+	for _, g := range gs {
+		ok, err := g.Allow(r, loginID, methodID)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (gs allGuards) Fail(r *http.Request, loginID, methodID string) error {
+	var errs []error
+	for _, g := range gs {
+		errs = append(errs, g.Fail(r, loginID, methodID))
+	}
+	return errors.Join(errs...)
+}
+
+func (gs allGuards) Success(r *http.Request, loginID, methodID string) error {
+	var errs []error
+	for _, g := range gs {
+		errs = append(errs, g.Success(r, loginID, methodID))
+	}
+	return errors.Join(errs...)
+}
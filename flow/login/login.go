@@ -11,19 +11,25 @@
 //     method not offered) produce the same Result, so transports can stay
 //     enumeration-safe without trying
 //   - attempts expire, and the session is created in exactly one place
+//   - an attempt is bound to the client it was issued to: continuing it
+//     takes the opaque handle from the previous Result, not just the login ID
 //
 // Callers compose requirements at the policy level (see RequireAny and
 // Chain) and keep ownership of the transport: forms, JSON, rendering.
 package login
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"time"
 
 	"github.com/go-bumbu/userauth"
+	"github.com/go-bumbu/userauth/internal/hashutil"
 )
 
 // DefaultAttemptExpiry bounds how long a partially completed login stays valid.
@@ -32,8 +38,8 @@ const DefaultAttemptExpiry = 5 * time.Minute
 // Attempt is the server-side state of a login in progress.
 //
 // Satisfied is an authentication claim: whoever controls it can skip factors.
-// AttemptStore implementations MUST keep it server-side or in an
-// authenticated (signed/encrypted) client token — never in a plain cookie.
+// AttemptStore implementations MUST keep it server-side; clients only ever
+// hold the opaque handle (Result.Attempt).
 type Attempt struct {
 	UserID    string
 	Satisfied []string // method IDs verified so far, in order
@@ -43,14 +49,20 @@ type Attempt struct {
 	// carried through the flow and only applied at the end, when the session
 	// is created. It is captured from the first accepted factor submission.
 	SessionKeepLoggedIn bool
+
+	// Reauth marks a step-up attempt started by Reauthenticate: it completes
+	// by upgrading the user's existing session, never by creating one.
+	Reauth bool
 }
 
-// AttemptStore persists login attempts between factor submissions.
-// Implementations key by Attempt.UserID.
+// AttemptStore persists login attempts between factor submissions, keyed by
+// an opaque string the Flow derives from the attempt handle (a SHA-256
+// digest: stores never hold the handle itself). A Flow rotates the key on
+// every step, so implementations hold many short-lived entries per user.
 type AttemptStore interface {
-	Set(r *http.Request, w http.ResponseWriter, a Attempt) error
-	Get(r *http.Request, userID string) (Attempt, error)
-	Clear(r *http.Request, w http.ResponseWriter, userID string) error
+	Set(key string, a Attempt) error
+	Get(key string) (Attempt, error)
+	Clear(key string) error
 }
 
 // UserLogin creates a session for an authenticated user.
@@ -59,6 +71,26 @@ type UserLogin interface {
 	LoginUser(r *http.Request, w http.ResponseWriter, userID string, keepLoggedIn bool) error
 }
 
+// MethodsLogin is a UserLogin that also records which methods authenticated
+// the user (the session's AMR). When Session implements it, the flow passes
+// Attempt.Satisfied along; cookieauth.Manager does.
+type MethodsLogin interface {
+	LoginUserWithMethods(r *http.Request, w http.ResponseWriter, userID string, keepLoggedIn bool, methods []string) error
+}
+
+// SessionUpgrader refreshes the authentication time and methods of the
+// user's existing session without creating a new one. Reauthenticate
+// requires Session to implement it.
+type SessionUpgrader interface {
+	UpgradeSession(r *http.Request, w http.ResponseWriter, userID string, methods []string) error
+}
+
+// UserLogout ends the user's session. Logout requires Session to implement
+// it; cookieauth.Manager does.
+type UserLogout interface {
+	LogoutUser(r *http.Request, w http.ResponseWriter) error
+}
+
 // Result is the outcome of a Submit call.
 //
 // OK=false means the submission was rejected for a credential-shaped reason
@@ -69,6 +101,11 @@ type Result struct {
 	OK   bool     // the submitted factor was accepted
 	Done bool     // all requirements met; the session has been created
 	Next []string // when OK && !Done: method IDs the user may attempt next
+	// Attempt is set when OK && !Done: the handle the client passes with its
+	// next submission to continue this attempt. It is a bearer secret for
+	// the factors verified so far; transports hand it to the client that
+	// made this submission only (response body, HttpOnly cookie).
+	Attempt string
 }
 
 // Flow is the login engine. Users, Policy and Session are required.
@@ -92,7 +129,21 @@ type Flow struct {
 	// work; it is what makes the password step non-brute-forceable per
 	// account (small-keyspace factors are additionally throttled at their
 	// verifier). Nil means unguarded. See Guard and ThrottleGuard.
-	Guard  Guard
+	Guard Guard
+	// ReauthPolicy decides which factors Reauthenticate asks for, e.g. only
+	// TOTP for a user already signed in with a password. Defaults to Policy.
+	ReauthPolicy Policy
+	// Devices, when set, lets a trusted browser count as MethodDevice (wrap
+	// Policy with TrustedDevice for it to skip a factor) and trusts the
+	// browser when a completing submission carries WithRememberDevice.
+	Devices DeviceTrust
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For is
+	// believed when resolving Signals.IP; empty means the peer address is
+	// the client.
+	TrustedProxies []netip.Prefix
+	// Groups supplies Signals.Groups for SignalPolicies such as
+	// RequireForGroups; nil leaves them unknown.
+	Groups userauth.GroupsGetter
 	Logger *slog.Logger // optional; defaults to slog.Default()
 }
 
@@ -110,6 +161,13 @@ func (f *Flow) expiry() time.Duration {
 	return DefaultAttemptExpiry
 }
 
+func (f *Flow) policy(reauth bool) Policy {
+	if reauth && f.ReauthPolicy != nil {
+		return f.ReauthPolicy
+	}
+	return f.Policy
+}
+
 func (f *Flow) method(id string) Method {
 	for _, m := range f.Methods {
 		if m.ID() == id {
@@ -126,22 +184,74 @@ func (f *Flow) check() error {
 	return nil
 }
 
-// loadAttempt returns the current attempt for the user, or a fresh one when
-// none exists (including when no store is configured) or the stored one has
-// expired. Store errors are treated as "no attempt": the safe consequence is
-// that the user re-verifies factors.
-func (f *Flow) loadAttempt(r *http.Request, userID string) Attempt {
-	if f.Attempts == nil {
-		return Attempt{UserID: userID, ExpiresAt: time.Now().Add(f.expiry())}
-	}
-	att, err := f.Attempts.Get(r, userID)
-	if err == nil && time.Now().Before(att.ExpiresAt) {
-		return att
+// attemptHandleBytes is the entropy of an attempt handle.
+const attemptHandleBytes = 32
+
+// newAttemptHandle returns a fresh random attempt handle.
+func newAttemptHandle() (string, error) {
+	b := make([]byte, attemptHandleBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// attemptKey is the store key of a handle. Stores see only the digest, so
+// a leaked table or store dump does not let anyone continue an attempt.
+func attemptKey(handle string) string {
+	return hashutil.HashCodeSHA256(handle)
+}
+
+// loadAttempt returns the attempt the handle refers to, or a fresh one when
+// there is none (no handle, no store configured), the stored one has
+// expired, belongs to another user or is of the other kind (login vs.
+// re-authentication). The second value is the handle when the stored
+// attempt was used, "" for a fresh one. Store errors are treated as "no
+// attempt": the safe consequence is that the user re-verifies factors.
+func (f *Flow) loadAttempt(handle, userID string, reauth bool) (Attempt, string) {
+	fresh := Attempt{UserID: userID, ExpiresAt: time.Now().Add(f.expiry()), Reauth: reauth}
+	if f.Attempts == nil || handle == "" {
+		return fresh, ""
+	}
+	att, err := f.Attempts.Get(attemptKey(handle))
 	if err != nil {
 		f.logger().Debug("login: no usable attempt, starting fresh", "userID", userID, "reason", err)
+		return fresh, ""
+	}
+	if att.UserID != userID || att.Reauth != reauth || !time.Now().Before(att.ExpiresAt) {
+		f.logger().Debug("login: attempt does not match the submission, starting fresh", "userID", userID)
+		return fresh, ""
+	}
+	return att, handle
+}
+
+// saveAttempt stores att under a new handle and retires the previous one,
+// so a handle continues an attempt for one step only. It returns the new
+// handle.
+func (f *Flow) saveAttempt(prev string, att Attempt) (string, error) {
+	if f.Attempts == nil {
+		return "", errors.New("login: multi-step policy requires an Attempts store")
+	}
+	handle, err := newAttemptHandle()
+	if err != nil {
+		return "", fmt.Errorf("login: attempt handle: %w", err)
+	}
+	if err := f.Attempts.Set(attemptKey(handle), att); err != nil {
+		return "", fmt.Errorf("login: store attempt: %w", err)
+	}
+	f.clearAttempt(prev, att.UserID)
+	return handle, nil
+}
+
+// clearAttempt deletes the attempt behind handle, if any. Failures are
+// logged, not returned: the attempt expires on its own.
+func (f *Flow) clearAttempt(handle, userID string) {
+	if f.Attempts == nil || handle == "" {
+		return
+	}
+	if err := f.Attempts.Clear(attemptKey(handle)); err != nil {
+		f.logger().Error("login: failed to clear attempt", "userID", userID, "error", err)
 	}
-	return Attempt{UserID: userID, ExpiresAt: time.Now().Add(f.expiry())}
 }
 
 // getEnabledUser is the shared known-and-enabled gate. It resolves the login
@@ -214,24 +324,42 @@ func (f *Flow) verifyGuarded(r *http.Request, m Method, user userauth.User, logi
 	return true, nil
 }
 
-// completeLogin creates the session and clears the attempt: the one place a
-// login finishes.
-func (f *Flow) completeLogin(r *http.Request, w http.ResponseWriter, userID string, att Attempt) error {
-	if err := f.Session.LoginUser(r, w, userID, att.SessionKeepLoggedIn); err != nil {
-		return fmt.Errorf("login: create session: %w", err)
-	}
-	if f.Attempts != nil {
-		if err := f.Attempts.Clear(r, w, userID); err != nil {
-			f.logger().Error("login: failed to clear attempt", "userID", userID, "error", err)
+// completeLogin creates the session (or, for a re-authentication, upgrades
+// it) and clears the attempt behind handle: the one place a login finishes.
+// deviceID names the trusted device the login came from, if any.
+func (f *Flow) completeLogin(r *http.Request, w http.ResponseWriter, handle, userID string, att Attempt, deviceID string) error {
+	if !att.Reauth && deviceID == "" {
+		deviceID = f.trustDevice(r, w, userID)
+	}
+	if att.Reauth {
+		up, _ := f.Session.(SessionUpgrader) // checked by Reauthenticate
+		if err := up.UpgradeSession(r, w, userID, att.Satisfied); err != nil {
+			return fmt.Errorf("login: upgrade session: %w", err)
+		}
+	} else if dl, ok := f.Session.(DeviceLogin); ok && deviceID != "" {
+		if err := dl.LoginUserWithDevice(r, w, userID, att.SessionKeepLoggedIn, att.Satisfied, deviceID); err != nil {
+			return fmt.Errorf("login: create session: %w", err)
 		}
+	} else if ml, ok := f.Session.(MethodsLogin); ok {
+		if err := ml.LoginUserWithMethods(r, w, userID, att.SessionKeepLoggedIn, att.Satisfied); err != nil {
+			return fmt.Errorf("login: create session: %w", err)
+		}
+	} else if err := f.Session.LoginUser(r, w, userID, att.SessionKeepLoggedIn); err != nil {
+		return fmt.Errorf("login: create session: %w", err)
 	}
-	f.logger().Debug("login: login complete", "userID", userID, "satisfied", att.Satisfied)
+	f.clearAttempt(handle, userID)
+	f.logger().Debug("login: login complete", "userID", userID, "satisfied", att.Satisfied, "reauth", att.Reauth)
 	return nil
 }
 
 // Submit verifies one factor and advances the attempt. When the policy is
 // satisfied it creates the session and clears the attempt.
 //
+// attempt is the handle from the previous Result of this login ("" for the
+// first factor). Without it, or with a handle for another user, the
+// submission starts a new attempt, so only the client that verified the
+// earlier factors can build on them.
+//
 // keepLoggedIn is recorded on the first accepted factor of an attempt (see
 // Attempt.SessionKeepLoggedIn) and only used when the session is eventually
 // created; later submissions cannot change it.
@@ -239,7 +367,7 @@ func (f *Flow) completeLogin(r *http.Request, w http.ResponseWriter, userID stri
 // A non-nil error is an internal failure (misconfiguration, store or
 // verifier breakage) that transports should render as a generic 5xx. All
 // credential failures come back as (Result{OK: false}, nil).
-func (f *Flow) Submit(r *http.Request, w http.ResponseWriter, loginID, methodID, input string, keepLoggedIn bool) (Result, error) {
+func (f *Flow) Submit(r *http.Request, w http.ResponseWriter, attempt, loginID, methodID, input string, keepLoggedIn bool) (Result, error) {
 	if err := f.check(); err != nil {
 		return Result{}, err
 	}
@@ -264,52 +392,136 @@ func (f *Flow) Submit(r *http.Request, w http.ResponseWriter, loginID, methodID,
 		// throttles guesses against existing accounts.
 		return Result{}, f.guardFail(r, loginID, methodID)
 	}
+	return f.advance(r, w, attempt, user, loginID, m, input, keepLoggedIn, false)
+}
+
+// Logout ends the session of the request. Transports call it from an
+// unsafe (POST) endpoint behind their CSRF protection, so that other sites
+// cannot log users out. Session must implement UserLogout.
+func (f *Flow) Logout(r *http.Request, w http.ResponseWriter) error {
+	if err := f.check(); err != nil {
+		return err
+	}
+	lo, ok := f.Session.(UserLogout)
+	if !ok {
+		return errors.New("login: Session does not support logout")
+	}
+	if err := lo.LogoutUser(r, w); err != nil {
+		return fmt.Errorf("login: logout: %w", err)
+	}
+	return nil
+}
+
+// Reauthenticate is Submit for a user who already has a session: it verifies
+// the factors ReauthPolicy asks for and then upgrades that session's
+// authentication time and methods instead of creating a new one. userID is
+// the canonical ID of the signed-in user (userauth.Identity.UserID), never a
+// value from the request body. Session must implement SessionUpgrader.
+//
+// Results, errors and attempt handles follow Submit. Re-authentication
+// attempts are kept apart from login attempts: neither can complete the
+// other.
+func (f *Flow) Reauthenticate(r *http.Request, w http.ResponseWriter, attempt, userID, methodID, input string) (Result, error) {
+	if err := f.check(); err != nil {
+		return Result{}, err
+	}
+	if _, ok := f.Session.(SessionUpgrader); !ok {
+		return Result{}, errors.New("login: Session does not support re-authentication")
+	}
+	m := f.method(methodID)
+	if m == nil {
+		return Result{}, fmt.Errorf("login: method %q not registered", methodID)
+	}
+	user, ok, err := f.getEnabledUserByID(userID)
+	if err != nil || !ok {
+		return Result{}, err
+	}
+	allowed, err := f.guardAllow(r, user.LoginID, methodID)
+	if err != nil || !allowed {
+		return Result{}, err
+	}
+	return f.advance(r, w, attempt, user, user.LoginID, m, input, false, true)
+}
+
+// getEnabledUserByID is getEnabledUser for a canonical user ID.
+func (f *Flow) getEnabledUserByID(userID string) (userauth.User, bool, error) {
+	user, err := f.Users.GetUser(userID)
+	if err != nil {
+		if errors.Is(err, userauth.ErrUserNotFound) {
+			return userauth.User{}, false, nil
+		}
+		return userauth.User{}, false, err
+	}
+	return user, user.Enabled, nil
+}
 
+// advance is the shared factor step of Submit and Reauthenticate, for a user
+// already known to be enabled.
+func (f *Flow) advance(r *http.Request, w http.ResponseWriter, handle string, user userauth.User, loginID string, m Method, input string, keepLoggedIn, reauth bool) (Result, error) {
 	// From here on, use the canonical user.ID: attempts, verifiers and the
 	// session must all agree on the same key.
-	att := f.loadAttempt(r, user.ID)
+	att, handle := f.loadAttempt(handle, user.ID, reauth)
 	if len(att.Satisfied) == 0 {
 		att.SessionKeepLoggedIn = keepLoggedIn
 	}
+	policy := f.policy(reauth)
+	sig, err := f.signals(r, user, reauth, unproven(att, reauth))
+	if err != nil {
+		return Result{}, err
+	}
 
 	// A factor only counts when the policy is currently offering it.
-	_, next, err := f.Policy.Next(user, att.Satisfied)
+	_, next, err := nextWith(policy, sig, user, att.Satisfied)
 	if err != nil {
 		return Result{}, err
 	}
-	if !contains(next, methodID) {
-		f.logger().Debug("login: method not offered", "userID", user.ID, "method", methodID, "satisfied", att.Satisfied)
+	if !contains(next, m.ID()) {
+		f.logger().Debug("login: method not offered", "userID", user.ID, "method", m.ID(), "satisfied", att.Satisfied)
 		return Result{}, nil
 	}
 
-	ok, err = f.verifyGuarded(r, m, user, loginID, input)
+	ok, err := f.verifyGuarded(r, m, user, loginID, input)
 	if err != nil || !ok {
 		return Result{}, err
 	}
+	if sig.Preliminary {
+		// the first factor is proven: now the account's signals may be
+		// loaded, and must still offer it
+		if sig, err = f.signals(r, user, reauth, false); err != nil {
+			return Result{}, err
+		}
+		if _, next, err = nextWith(policy, sig, user, att.Satisfied); err != nil {
+			return Result{}, err
+		}
+		if !contains(next, m.ID()) {
+			f.logger().Debug("login: method not offered to the user", "userID", user.ID, "method", m.ID())
+			return Result{}, nil
+		}
+	}
 
-	att.Satisfied = append(att.Satisfied, methodID)
-	done, next, err := f.Policy.Next(user, att.Satisfied)
+	att.Satisfied = append(att.Satisfied, m.ID())
+	deviceID := recognizeDevice(sig, &att)
+	done, next, err := nextWith(policy, sig, user, att.Satisfied)
 	if err != nil {
 		return Result{}, err
 	}
 	if done {
-		if err := f.completeLogin(r, w, user.ID, att); err != nil {
+		if err := f.completeLogin(r, w, handle, user.ID, att, deviceID); err != nil {
 			return Result{}, err
 		}
 		return Result{OK: true, Done: true}, nil
 	}
 
-	if f.Attempts == nil {
-		return Result{}, errors.New("login: multi-step policy requires an Attempts store")
-	}
-	if err := f.Attempts.Set(r, w, att); err != nil {
-		return Result{}, fmt.Errorf("login: store attempt: %w", err)
+	handle, err = f.saveAttempt(handle, att)
+	if err != nil {
+		return Result{}, err
 	}
-	return Result{OK: true, Next: next}, nil
+	return Result{OK: true, Next: next, Attempt: handle}, nil
 }
 
 // Initiate triggers issuance for a deliverable factor (e.g. generate and send
-// an email code). The method must implement Initiator.
+// an email code). The method must implement Initiator. attempt is the handle
+// of the login in progress, "" when the code is its first factor.
 //
 // It is enumeration-safe by construction: issuance is silently skipped for
 // unknown or disabled users and for methods the policy is not currently
@@ -320,29 +532,54 @@ func (f *Flow) Submit(r *http.Request, w http.ResponseWriter, loginID, methodID,
 // Note: when the Initiator delivers synchronously (e.g. blocking SMTP),
 // response timing can still reveal whether issuance happened; deliverers
 // should queue and return.
-func (f *Flow) Initiate(r *http.Request, loginID, methodID string) error {
-	if err := f.check(); err != nil {
+func (f *Flow) Initiate(r *http.Request, attempt, loginID, methodID string) error {
+	init, err := f.initiator(methodID)
+	if err != nil {
+		return err
+	}
+	user, ok, err := f.getEnabledUser(loginID)
+	if err != nil || !ok {
 		return err
 	}
+	return f.initiate(r, attempt, init, user, methodID, false)
+}
+
+// InitiateReauth is Initiate for a re-authentication: it issues a code for
+// the signed-in user when ReauthPolicy currently offers the method.
+func (f *Flow) InitiateReauth(r *http.Request, attempt, userID, methodID string) error {
+	init, err := f.initiator(methodID)
+	if err != nil {
+		return err
+	}
+	user, ok, err := f.getEnabledUserByID(userID)
+	if err != nil || !ok {
+		return err
+	}
+	return f.initiate(r, attempt, init, user, methodID, true)
+}
+
+func (f *Flow) initiator(methodID string) (Initiator, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
 	m := f.method(methodID)
 	if m == nil {
-		return fmt.Errorf("login: method %q not registered", methodID)
+		return nil, fmt.Errorf("login: method %q not registered", methodID)
 	}
 	init, isInit := m.(Initiator)
 	if !isInit {
-		return fmt.Errorf("login: method %q does not support initiation", methodID)
+		return nil, fmt.Errorf("login: method %q does not support initiation", methodID)
 	}
+	return init, nil
+}
 
-	user, ok, err := f.getEnabledUser(loginID)
+func (f *Flow) initiate(r *http.Request, handle string, init Initiator, user userauth.User, methodID string, reauth bool) error {
+	att, _ := f.loadAttempt(handle, user.ID, reauth)
+	sig, err := f.signals(r, user, reauth, unproven(att, reauth))
 	if err != nil {
 		return err
 	}
-	if !ok {
-		return nil
-	}
-
-	att := f.loadAttempt(r, user.ID)
-	_, next, err := f.Policy.Next(user, att.Satisfied)
+	_, next, err := nextWith(f.policy(reauth), sig, user, att.Satisfied)
 	if err != nil {
 		return err
 	}
@@ -373,6 +610,12 @@ func (f *Flow) Initiate(r *http.Request, loginID, methodID string) error {
 	return nil
 }
 
+// unproven reports whether att has proven no factor yet; signals for it
+// are preliminary. A re-authentication is made by a signed-in user.
+func unproven(att Attempt, reauth bool) bool {
+	return !reauth && len(att.Satisfied) == 0
+}
+
 func contains(list []string, s string) bool {
 	for _, v := range list {
 		if v == s {
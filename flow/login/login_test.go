@@ -15,6 +15,7 @@ import (
 	"github.com/go-bumbu/userauth/service/verificationcode"
 	csmemory "github.com/go-bumbu/userauth/service/verificationcode/store/memory"
 	"github.com/go-bumbu/userauth/userstore/staticusers"
+	"github.com/google/go-cmp/cmp"
 	"github.com/pquerna/otp/totp"
 )
 
@@ -41,10 +42,12 @@ func totpFactor(users *staticusers.Users) login.TOTPFactor {
 // captureDeliverer records the last delivered code instead of sending it.
 type captureDeliverer struct {
 	code string
+	msg  verificationcode.Message
 }
 
-func (d *captureDeliverer) Deliver(_ context.Context, _ string, code string, _ time.Time) error {
-	d.code = code
+func (d *captureDeliverer) Deliver(_ context.Context, msg verificationcode.Message) error {
+	d.msg = msg
+	d.code = msg.Code
 	return nil
 }
 
@@ -67,6 +70,9 @@ type fixture struct {
 	users     *staticusers.Users
 	deliverer *captureDeliverer
 	session   *captureLogin
+	// handles plays the client: the attempt handle each user's last
+	// accepted step returned, passed along with their next submission.
+	handles map[string]string
 }
 
 // newFixture builds a Flow with password, TOTP and email methods over two
@@ -92,23 +98,35 @@ func newFixture(policy login.Policy) *fixture {
 		Attempts: memory.New(),
 		Session:  session,
 	}
-	return &fixture{flow: flow, users: users, deliverer: deliverer, session: session}
+	return &fixture{flow: flow, users: users, deliverer: deliverer, session: session, handles: map[string]string{}}
 }
 
 func submit(t *testing.T, f *fixture, userID, method, input string) login.Result {
 	t.Helper()
 	r := httptest.NewRequest(http.MethodPost, "/login", nil)
-	res, err := f.flow.Submit(r, httptest.NewRecorder(), userID, method, input, false)
+	res, err := f.flow.Submit(r, httptest.NewRecorder(), f.handles[userID], userID, method, input, false)
 	if err != nil {
 		t.Fatalf("Submit(%s, %s): %v", userID, method, err)
 	}
+	f.keep(userID, res)
 	return res
 }
 
+// keep stores the handle of an accepted step and forgets it once the login
+// is done, like a client would.
+func (f *fixture) keep(key string, res login.Result) {
+	switch {
+	case res.Done:
+		delete(f.handles, key)
+	case res.OK:
+		f.handles[key] = res.Attempt
+	}
+}
+
 func initiate(t *testing.T, f *fixture, userID, method string) {
 	t.Helper()
 	r := httptest.NewRequest(http.MethodPost, "/login", nil)
-	if err := f.flow.Initiate(r, userID, method); err != nil {
+	if err := f.flow.Initiate(r, f.handles[userID], userID, method); err != nil {
 		t.Fatalf("Initiate(%s, %s): %v", userID, method, err)
 	}
 }
@@ -154,7 +172,7 @@ func TestFlowSingleFactor(t *testing.T) {
 
 	t.Run("unregistered method is an internal error", func(t *testing.T) {
 		r := httptest.NewRequest(http.MethodPost, "/login", nil)
-		_, err := f.flow.Submit(r, httptest.NewRecorder(), "bob", "sms", "123", false)
+		_, err := f.flow.Submit(r, httptest.NewRecorder(), "", "bob", "sms", "123", false)
 		if err == nil {
 			t.Fatal("want error for unregistered method")
 		}
@@ -295,11 +313,25 @@ func TestFlowInitiate(t *testing.T) {
 	t.Run("method without initiation support is an error", func(t *testing.T) {
 		f := newFixture(policy)
 		r := httptest.NewRequest(http.MethodPost, "/login", nil)
-		if err := f.flow.Initiate(r, "bob", "password"); err == nil {
+		if err := f.flow.Initiate(r, "", "bob", "password"); err == nil {
 			t.Fatal("want error for non-initiable method")
 		}
 	})
 
+	t.Run("message carries the login purpose and the context locale", func(t *testing.T) {
+		f := newFixture(policy)
+		r := httptest.NewRequest(http.MethodPost, "/login", nil)
+		r = r.WithContext(verificationcode.WithLocale(r.Context(), "de"))
+		if err := f.flow.Initiate(r, "", "bob", "email"); err != nil {
+			t.Fatal(err)
+		}
+		want := verificationcode.Message{To: "bob", Code: f.deliverer.code, ExpiresAt: f.deliverer.msg.ExpiresAt,
+			Purpose: verificationcode.PurposeLogin, Locale: "de"}
+		if diff := cmp.Diff(want, f.deliverer.msg); diff != "" {
+			t.Errorf("unexpected message (-want +got):\n%s", diff)
+		}
+	})
+
 	t.Run("resend limiter silently skips issuance", func(t *testing.T) {
 		f := newFixture(policy)
 		f.flow.Resend = &login.ResendLimiter{Store: throttlememory.New()}
@@ -341,6 +373,80 @@ func TestFlowAttemptExpiry(t *testing.T) {
 	}
 }
 
+// keyRecorder is an attempt store that remembers the keys it was given.
+type keyRecorder struct {
+	*memory.Store
+	keys []string
+}
+
+func (k *keyRecorder) Set(key string, a login.Attempt) error {
+	k.keys = append(k.keys, key)
+	return k.Store.Set(key, a)
+}
+
+func TestFlowAttemptHandles(t *testing.T) {
+	policy := login.RequireAny(login.Chain{"password", "totp"})
+
+	t.Run("the second factor needs the handle", func(t *testing.T) {
+		f := newFixture(policy)
+		submit(t, f, "alice", "password", "alice-pw")
+		delete(f.handles, "alice") // another client, same login ID
+		if res := submit(t, f, "alice", "totp", totpCode(t)); res.OK {
+			t.Fatalf("TOTP without the handle must be rejected, got %+v", res)
+		}
+		if f.session.calls != 0 {
+			t.Error("no session must be created")
+		}
+	})
+
+	t.Run("a handle only continues its own user's attempt", func(t *testing.T) {
+		f := newFixture(policy)
+		submit(t, f, "bob", "password", "bob-pw")
+		f.handles["alice"] = f.handles["bob"]
+		if res := submit(t, f, "alice", "totp", totpCode(t)); res.OK {
+			t.Fatalf("bob's handle must not carry alice's login, got %+v", res)
+		}
+	})
+
+	t.Run("handles rotate on every step", func(t *testing.T) {
+		f := newFixture(login.RequireAny(login.Chain{"password", "email", "totp"}))
+		submit(t, f, "alice", "password", "alice-pw")
+		first := f.handles["alice"]
+		initiate(t, f, "alice", "email")
+		submit(t, f, "alice", "email", f.deliverer.code)
+		if f.handles["alice"] == first {
+			t.Fatal("the handle must change after an accepted step")
+		}
+		f.handles["alice"] = first
+		if res := submit(t, f, "alice", "totp", totpCode(t)); res.OK {
+			t.Fatalf("a retired handle must not continue the attempt, got %+v", res)
+		}
+	})
+
+	t.Run("the store never sees the handle", func(t *testing.T) {
+		f := newFixture(policy)
+		store := &keyRecorder{Store: memory.New()}
+		f.flow.Attempts = store
+		res := submit(t, f, "alice", "password", "alice-pw")
+		if len(store.keys) != 1 || store.keys[0] == res.Attempt || store.keys[0] == "" {
+			t.Fatalf("want one digest key, got %q for handle %q", store.keys, res.Attempt)
+		}
+	})
+
+	t.Run("a finished login clears its attempt", func(t *testing.T) {
+		f := newFixture(policy)
+		submit(t, f, "alice", "password", "alice-pw")
+		handle := f.handles["alice"]
+		if res := submit(t, f, "alice", "totp", totpCode(t)); !res.Done || res.Attempt != "" {
+			t.Fatalf("want done without a handle, got %+v", res)
+		}
+		f.handles["alice"] = handle
+		if res := submit(t, f, "alice", "totp", totpCode(t)); res.OK {
+			t.Fatalf("a completed attempt must not be replayed, got %+v", res)
+		}
+	})
+}
+
 func TestFlowKeepLoggedIn(t *testing.T) {
 	policy := login.RequireAny(login.Chain{"password", "totp"})
 	f := newFixture(policy)
@@ -348,10 +454,11 @@ func TestFlowKeepLoggedIn(t *testing.T) {
 
 	// keepLoggedIn is captured on the first factor; the second submission's
 	// value is ignored.
-	if _, err := f.flow.Submit(r, httptest.NewRecorder(), "alice", "password", "alice-pw", true); err != nil {
+	res, err := f.flow.Submit(r, httptest.NewRecorder(), "", "alice", "password", "alice-pw", true)
+	if err != nil {
 		t.Fatal(err)
 	}
-	if _, err := f.flow.Submit(r, httptest.NewRecorder(), "alice", "totp", totpCode(t), false); err != nil {
+	if _, err := f.flow.Submit(r, httptest.NewRecorder(), res.Attempt, "alice", "totp", totpCode(t), false); err != nil {
 		t.Fatal(err)
 	}
 	if f.session.calls != 1 || !f.session.keep {
@@ -19,6 +19,9 @@ const (
 	MethodEmail    = "email"
 	MethodSMS      = "sms"
 	MethodRecovery = "recovery"
+	// MethodDevice is not a Method: the engine adds it to Attempt.Satisfied
+	// when Flow.Devices recognises the browser (see TrustedDevice).
+	MethodDevice = "device"
 )
 
 // Method verifies a single login factor.
@@ -168,6 +171,12 @@ type CodeMethod struct {
 	// for SMS). When nil, the primary email is used, falling back to the login
 	// ID for stores that keep the address there.
 	Recipient func(userauth.User) string
+	// Purpose tells the deliverer how to word the message; defaults to
+	// verificationcode.PurposeLogin.
+	Purpose verificationcode.Purpose
+	// Locale resolves the message language for a user. When nil, the locale
+	// the transport put on the context (verificationcode.WithLocale) is used.
+	Locale func(ctx context.Context, user userauth.User) string
 }
 
 func (m CodeMethod) ID() string { return m.MethodID }
@@ -184,7 +193,27 @@ func (m CodeMethod) Initiate(ctx context.Context, user userauth.User) error {
 	if err != nil {
 		return err
 	}
-	return m.Deliver.Deliver(ctx, m.recipient(user), code, expiresAt)
+	return m.Deliver.Deliver(ctx, verificationcode.Message{
+		To:        m.recipient(user),
+		Code:      code,
+		ExpiresAt: expiresAt,
+		Purpose:   m.purpose(),
+		Locale:    m.locale(ctx, user),
+	})
+}
+
+func (m CodeMethod) purpose() verificationcode.Purpose {
+	if m.Purpose != "" {
+		return m.Purpose
+	}
+	return verificationcode.PurposeLogin
+}
+
+func (m CodeMethod) locale(ctx context.Context, user userauth.User) string {
+	if m.Locale != nil {
+		return m.Locale(ctx, user)
+	}
+	return verificationcode.LocaleFromContext(ctx)
 }
 
 func (m CodeMethod) recipient(user userauth.User) string {
@@ -16,8 +16,8 @@ type Policy interface {
 }
 
 // PolicyFunc adapts a function to the Policy interface, for dynamic rules
-// (step-up auth, trusted networks, …) that the declarative helpers cannot
-// express.
+// that the declarative helpers cannot express. Rules on the request itself
+// (network, device, groups) use SignalPolicyFunc.
 type PolicyFunc func(user userauth.User, satisfied []string) (bool, []string, error)
 
 func (f PolicyFunc) Next(user userauth.User, satisfied []string) (bool, []string, error) {
@@ -106,3 +106,33 @@ func SecondFactorAfter(first string, provider userauth.SecondFactorProvider) Pol
 		return false, next, nil
 	})
 }
+
+// TrustedDevice wraps a policy so that a trusted device (MethodDevice, added
+// by the engine when Flow.Devices recognises the browser) stands in for one
+// of the replaces methods — typically the second factors:
+//
+//	TrustedDevice(SecondFactorAfter("password", provider), "totp", "email")
+//
+// The device only substitutes for a method inner is offering at that point
+// and never for the first factor: at least one real factor must be
+// satisfied. With no replaces it stands in for any offered method.
+func TrustedDevice(inner Policy, replaces ...string) Policy {
+	return SignalPolicyFunc(func(sig Signals, user userauth.User, satisfied []string) (bool, []string, error) {
+		proven := make([]string, 0, len(satisfied))
+		for _, id := range satisfied {
+			if id != MethodDevice {
+				proven = append(proven, id)
+			}
+		}
+		done, next, err := nextWith(inner, sig, user, proven)
+		if err != nil || done || len(proven) == 0 || !contains(satisfied, MethodDevice) {
+			return done, next, err
+		}
+		for _, id := range next {
+			if len(replaces) == 0 || contains(replaces, id) {
+				return nextWith(inner, sig, user, append(proven, id))
+			}
+		}
+		return done, next, nil
+	})
+}
@@ -153,3 +153,66 @@ func TestSecondFactorAfter(t *testing.T) {
 		}
 	})
 }
+
+func TestTrustedDevice(t *testing.T) {
+	provider := sfProvider{"with2fa": {userauth.SecondFactorTOTP, userauth.SecondFactorEmail}}
+	inner := login.SecondFactorAfter("password", provider)
+
+	tcs := []struct {
+		name      string
+		replaces  []string
+		satisfied []string
+		wantDone  bool
+		wantNext  []string
+	}{
+		{
+			name:     "nothing satisfied: the inner policy decides",
+			replaces: []string{"totp"},
+			wantNext: []string{"password"},
+		},
+		{
+			name:      "device never stands in for the first factor",
+			replaces:  []string{"password"},
+			satisfied: []string{"device"},
+			wantNext:  []string{"password"},
+		},
+		{
+			name:      "without a device the second factor is required",
+			replaces:  []string{"totp"},
+			satisfied: []string{"password"},
+			wantNext:  []string{"totp", "email"},
+		},
+		{
+			name:      "device replaces an offered second factor",
+			replaces:  []string{"totp"},
+			satisfied: []string{"password", "device"},
+			wantDone:  true,
+		},
+		{
+			name:      "device does not replace methods it is not listed for",
+			replaces:  []string{"sms"},
+			satisfied: []string{"password", "device"},
+			wantNext:  []string{"totp", "email"},
+		},
+		{
+			name:      "no replaces: any offered method",
+			satisfied: []string{"password", "device"},
+			wantDone:  true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			p := login.TrustedDevice(inner, tc.replaces...)
+			done, next, err := p.Next(userauth.User{ID: "with2fa"}, tc.satisfied)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if done != tc.wantDone {
+				t.Errorf("done: want %v, got %v", tc.wantDone, done)
+			}
+			if diff := cmp.Diff(tc.wantNext, next); diff != "" {
+				t.Errorf("next mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
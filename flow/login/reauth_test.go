@@ -0,0 +1,149 @@
+package login_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-bumbu/userauth/flow/login"
+	"github.com/google/go-cmp/cmp"
+)
+
+// upgradingSession records logins with their methods and session upgrades,
+// like cookieauth.Manager.
+type upgradingSession struct {
+	captureLogin
+	methods  []string
+	upgrades []string // user IDs
+}
+
+func (s *upgradingSession) LoginUserWithMethods(r *http.Request, w http.ResponseWriter, userID string, keep bool, methods []string) error {
+	s.methods = methods
+	return s.LoginUser(r, w, userID, keep)
+}
+
+func (s *upgradingSession) UpgradeSession(_ *http.Request, _ http.ResponseWriter, userID string, methods []string) error {
+	s.upgrades = append(s.upgrades, userID)
+	s.methods = methods
+	return nil
+}
+
+func reauthFixture(reauthPolicy login.Policy) (*fixture, *upgradingSession) {
+	f := newFixture(login.RequireAny(login.Chain{"password", "totp"}))
+	session := &upgradingSession{}
+	f.flow.Session = session
+	f.flow.ReauthPolicy = reauthPolicy
+	return f, session
+}
+
+func reauth(t *testing.T, f *fixture, userID, method, input string) login.Result {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/reauth", nil)
+	key := "reauth:" + userID
+	res, err := f.flow.Reauthenticate(r, httptest.NewRecorder(), f.handles[key], userID, method, input)
+	if err != nil {
+		t.Fatalf("Reauthenticate(%s, %s): %v", userID, method, err)
+	}
+	f.keep(key, res)
+	return res
+}
+
+func TestLoginRecordsMethods(t *testing.T) {
+	f, session := reauthFixture(nil)
+	submit(t, f, "alice", "password", "alice-pw")
+	if res := submit(t, f, "alice", "totp", totpCode(t)); !res.Done {
+		t.Fatalf("want Done, got %+v", res)
+	}
+	if diff := cmp.Diff([]string{"password", "totp"}, session.methods); diff != "" {
+		t.Errorf("methods (-want +got):\n%s", diff)
+	}
+	if len(session.upgrades) != 0 {
+		t.Error("a login must not upgrade")
+	}
+}
+
+func TestReauthenticate(t *testing.T) {
+	t.Run("upgrades the session with the reauth policy", func(t *testing.T) {
+		f, session := reauthFixture(login.RequireAny(login.Chain{"totp"}))
+		res := reauth(t, f, "alice", "totp", totpCode(t))
+		if !res.OK || !res.Done {
+			t.Fatalf("want OK+Done, got %+v", res)
+		}
+		if diff := cmp.Diff([]string{"alice"}, session.upgrades); diff != "" {
+			t.Errorf("upgrades (-want +got):\n%s", diff)
+		}
+		if diff := cmp.Diff([]string{"totp"}, session.methods); diff != "" {
+			t.Errorf("methods (-want +got):\n%s", diff)
+		}
+		if session.calls != 0 {
+			t.Error("re-authentication must not create a session")
+		}
+	})
+
+	t.Run("defaults to the login policy", func(t *testing.T) {
+		f, session := reauthFixture(nil)
+		if res := reauth(t, f, "alice", "password", "alice-pw"); !res.OK || res.Done {
+			t.Fatalf("want OK, not Done, got %+v", res)
+		}
+		if res := reauth(t, f, "alice", "totp", totpCode(t)); !res.Done {
+			t.Fatalf("want Done, got %+v", res)
+		}
+		if len(session.upgrades) != 1 || session.calls != 0 {
+			t.Errorf("want one upgrade and no login, got %+v", session)
+		}
+	})
+
+	t.Run("login and reauth attempts do not mix", func(t *testing.T) {
+		f, session := reauthFixture(nil)
+		submit(t, f, "alice", "password", "alice-pw")
+		if res := reauth(t, f, "alice", "totp", totpCode(t)); res.OK {
+			t.Fatalf("a login attempt must not advance a reauth, got %+v", res)
+		}
+
+		f, session = reauthFixture(nil)
+		reauth(t, f, "alice", "password", "alice-pw")
+		if res := submit(t, f, "alice", "totp", totpCode(t)); res.OK {
+			t.Fatalf("a reauth attempt must not advance a login, got %+v", res)
+		}
+		if session.calls != 0 || len(session.upgrades) != 0 {
+			t.Errorf("nothing may complete, got %+v", session)
+		}
+	})
+
+	t.Run("wrong input, unknown and disabled users fail uniformly", func(t *testing.T) {
+		f, session := reauthFixture(login.RequireAny(login.Chain{"password"}))
+		for _, in := range [][2]string{{"bob", "nope"}, {"ghost", "x"}, {"carol", "carol-pw"}} {
+			if res := reauth(t, f, in[0], "password", in[1]); res.OK {
+				t.Errorf("%s: want rejection, got %+v", in[0], res)
+			}
+		}
+		if len(session.upgrades) != 0 {
+			t.Error("no session may be upgraded")
+		}
+	})
+
+	t.Run("session without upgrade support", func(t *testing.T) {
+		f := newFixture(login.RequireAny(login.Chain{"password"}))
+		r := httptest.NewRequest(http.MethodPost, "/reauth", nil)
+		if _, err := f.flow.Reauthenticate(r, httptest.NewRecorder(), "", "bob", "password", "bob-pw"); err == nil {
+			t.Error("want error when Session cannot upgrade")
+		}
+	})
+
+	t.Run("codes are issued for the reauth policy", func(t *testing.T) {
+		f, session := reauthFixture(login.RequireAny(login.Chain{"email"}))
+		r := httptest.NewRequest(http.MethodPost, "/reauth", nil)
+		if err := f.flow.InitiateReauth(r, "", "bob", "email"); err != nil {
+			t.Fatal(err)
+		}
+		if f.deliverer.code == "" {
+			t.Fatal("no code delivered")
+		}
+		if res := reauth(t, f, "bob", "email", f.deliverer.code); !res.Done {
+			t.Fatalf("want Done, got %+v", res)
+		}
+		if len(session.upgrades) != 1 {
+			t.Errorf("want one upgrade, got %v", session.upgrades)
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package login
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+
+	"github.com/go-bumbu/userauth"
+	"github.com/go-bumbu/userauth/internal/clientip"
+)
+
+// Signals are the request facts a SignalPolicy may decide on. The engine
+// builds them once per submission or initiation, after the user is known.
+//
+// Groups and KnownDevice are facts about the account, so they are loaded
+// only once the attempt has proven a factor: before that the signals are
+// Preliminary and an unauthenticated client causes no group lookup and no
+// device write. Re-authentication signals are never preliminary.
+type Signals struct {
+	// IP is the client address, resolved through Flow.TrustedProxies;
+	// invalid when it cannot be determined.
+	IP netip.Addr
+	// UserAgent is the request's User-Agent header.
+	UserAgent string
+	// KnownDevice reports that Flow.Devices recognised the browser as a
+	// trusted device of the user. Always false for re-authentication.
+	KnownDevice bool
+	// Groups are the user's groups from Flow.Groups. Nil means unknown (no
+	// Flow.Groups), an empty slice means no groups — RequireForGroups fails
+	// on nil rather than guess.
+	Groups []string
+	// Preliminary is set while the attempt has proven no factor: Groups
+	// and KnownDevice are not loaded yet. The helpers below then offer the
+	// factors of both their branches, and the engine checks the first
+	// factor again with the full signals once it is verified, so a factor
+	// only the other branch offers fails like a wrong credential. Initiate
+	// may thus send a first-factor code that the user's branch rejects.
+	Preliminary bool
+
+	deviceID string
+}
+
+// SignalPolicy is a Policy that also decides on request signals (network,
+// device, groups). The engine calls NextWithSignals when Flow.Policy or
+// Flow.ReauthPolicy implements it; Next evaluates it with empty Signals.
+type SignalPolicy interface {
+	Policy
+	NextWithSignals(sig Signals, user userauth.User, satisfied []string) (done bool, next []string, err error)
+}
+
+// SignalPolicyFunc adapts a function to SignalPolicy, for risk rules the
+// helpers below cannot express. Like every Policy it must not perform side
+// effects.
+type SignalPolicyFunc func(sig Signals, user userauth.User, satisfied []string) (bool, []string, error)
+
+func (f SignalPolicyFunc) Next(user userauth.User, satisfied []string) (bool, []string, error) {
+	return f(Signals{}, user, satisfied)
+}
+
+func (f SignalPolicyFunc) NextWithSignals(sig Signals, user userauth.User, satisfied []string) (bool, []string, error) {
+	return f(sig, user, satisfied)
+}
+
+// nextWith consults p with the signals when it can use them.
+func nextWith(p Policy, sig Signals, user userauth.User, satisfied []string) (bool, []string, error) {
+	if sp, ok := p.(SignalPolicy); ok {
+		return sp.NextWithSignals(sig, user, satisfied)
+	}
+	return p.Next(user, satisfied)
+}
+
+// either offers the factors of both p and otherwise, for preliminary
+// signals that cannot pick a branch yet. It never reports done.
+func either(p, otherwise Policy, sig Signals, user userauth.User, satisfied []string) (bool, []string, error) {
+	_, next, err := nextWith(p, sig, user, satisfied)
+	if err != nil {
+		return false, nil, err
+	}
+	_, more, err := nextWith(otherwise, sig, user, satisfied)
+	if err != nil {
+		return false, nil, err
+	}
+	for _, m := range more {
+		if !contains(next, m) {
+			next = append(next, m)
+		}
+	}
+	return false, next, nil
+}
+
+// RequireFromNetworks applies p to clients whose IP is in one of the
+// networks and otherwise to everyone else, including clients whose address
+// is unknown — so otherwise should be the stricter of the two:
+//
+//	office := []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}
+//	RequireFromNetworks(office,
+//		RequireAny(Chain{"password"}),          // in the office
+//		RequireAny(Chain{"password", "totp"}))  // anywhere else
+func RequireFromNetworks(networks []netip.Prefix, p, otherwise Policy) Policy {
+	return SignalPolicyFunc(func(sig Signals, user userauth.User, satisfied []string) (bool, []string, error) {
+		if sig.IP.IsValid() && slices.ContainsFunc(networks, func(n netip.Prefix) bool { return n.Contains(sig.IP) }) {
+			return nextWith(p, sig, user, satisfied)
+		}
+		return nextWith(otherwise, sig, user, satisfied)
+	})
+}
+
+// RequireForGroups applies p to members of any of the groups and otherwise
+// to everyone else, e.g. TOTP for admins only. It needs Flow.Groups and
+// fails with an error when the groups are unknown.
+func RequireForGroups(groups []string, p, otherwise Policy) Policy {
+	return SignalPolicyFunc(func(sig Signals, user userauth.User, satisfied []string) (bool, []string, error) {
+		if sig.Preliminary {
+			return either(p, otherwise, sig, user, satisfied)
+		}
+		if sig.Groups == nil {
+			return false, nil, fmt.Errorf("login: RequireForGroups: groups of user %q unknown; set Flow.Groups", user.ID)
+		}
+		if slices.ContainsFunc(groups, func(g string) bool { return slices.Contains(sig.Groups, g) }) {
+			return nextWith(p, sig, user, satisfied)
+		}
+		return nextWith(otherwise, sig, user, satisfied)
+	})
+}
+
+// RequireForNewDevices applies p when the browser is not a trusted device
+// of the user (see Flow.Devices) and otherwise when it is. Unlike
+// TrustedDevice it picks a whole policy rather than letting the device
+// stand in for one factor.
+func RequireForNewDevices(p, otherwise Policy) Policy {
+	return SignalPolicyFunc(func(sig Signals, user userauth.User, satisfied []string) (bool, []string, error) {
+		if sig.Preliminary {
+			return either(p, otherwise, sig, user, satisfied)
+		}
+		if sig.KnownDevice {
+			return nextWith(otherwise, sig, user, satisfied)
+		}
+		return nextWith(p, sig, user, satisfied)
+	})
+}
+
+// signals builds the request signals for the user; preliminary ones stop
+// before the account lookups. A group lookup failure is an internal error;
+// a device lookup failure is logged and means "not a known device", the
+// stricter answer.
+func (f *Flow) signals(r *http.Request, user userauth.User, reauth, preliminary bool) (Signals, error) {
+	sig := Signals{
+		IP:          clientip.Resolve(r, f.TrustedProxies),
+		UserAgent:   r.UserAgent(),
+		Preliminary: preliminary,
+	}
+	if preliminary {
+		return sig, nil
+	}
+	if f.Groups != nil {
+		groups, err := f.Groups.GetGroups(user.ID)
+		if err != nil {
+			return Signals{}, fmt.Errorf("login: groups: %w", err)
+		}
+		if groups == nil {
+			groups = []string{}
+		}
+		sig.Groups = groups
+	}
+	if f.Devices != nil && !reauth {
+		d, ok, err := f.Devices.Verify(r, user.ID)
+		if err != nil {
+			f.logger().Error("login: trusted device lookup failed", "userID", user.ID, "error", err)
+		} else if ok {
+			sig.KnownDevice, sig.deviceID = true, d.ID
+		}
+	}
+	return sig, nil
+}
@@ -0,0 +1,244 @@
+package login_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/go-bumbu/userauth"
+	"github.com/go-bumbu/userauth/flow/login"
+	"github.com/go-bumbu/userauth/service/trusteddevice"
+	"github.com/google/go-cmp/cmp"
+)
+
+var (
+	office       = []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}
+	passwordTOTP = login.RequireAny(login.Chain{"password", "totp"})
+	passwordOnly = login.RequireAny(login.Chain{"password"})
+)
+
+func TestSignalPolicies(t *testing.T) {
+	tcs := []struct {
+		name     string
+		policy   login.Policy
+		sig      login.Signals
+		wantDone bool
+		wantNext []string
+		wantErr  bool
+	}{
+		{
+			name:     "inside the network",
+			policy:   login.RequireFromNetworks(office, passwordOnly, passwordTOTP),
+			sig:      login.Signals{IP: netip.MustParseAddr("192.0.2.10")},
+			wantDone: true,
+		},
+		{
+			name:     "outside the network",
+			policy:   login.RequireFromNetworks(office, passwordOnly, passwordTOTP),
+			sig:      login.Signals{IP: netip.MustParseAddr("198.51.100.1")},
+			wantNext: []string{"totp"},
+		},
+		{
+			name:     "unknown address counts as outside",
+			policy:   login.RequireFromNetworks(office, passwordOnly, passwordTOTP),
+			wantNext: []string{"totp"},
+		},
+		{
+			name:     "group member",
+			policy:   login.RequireForGroups([]string{"admin"}, passwordTOTP, passwordOnly),
+			sig:      login.Signals{Groups: []string{"staff", "admin"}},
+			wantNext: []string{"totp"},
+		},
+		{
+			name:     "not a member",
+			policy:   login.RequireForGroups([]string{"admin"}, passwordTOTP, passwordOnly),
+			sig:      login.Signals{Groups: []string{}},
+			wantDone: true,
+		},
+		{
+			name:    "unknown groups fail closed",
+			policy:  login.RequireForGroups([]string{"admin"}, passwordTOTP, passwordOnly),
+			wantErr: true,
+		},
+		{
+			name:     "new device",
+			policy:   login.RequireForNewDevices(passwordTOTP, passwordOnly),
+			wantNext: []string{"totp"},
+		},
+		{
+			name:     "known device",
+			policy:   login.RequireForNewDevices(passwordTOTP, passwordOnly),
+			sig:      login.Signals{KnownDevice: true},
+			wantDone: true,
+		},
+		{
+			name: "nested: admins need totp even in the office",
+			policy: login.RequireFromNetworks(office,
+				login.RequireForGroups([]string{"admin"}, passwordTOTP, passwordOnly),
+				passwordTOTP),
+			sig:      login.Signals{IP: netip.MustParseAddr("192.0.2.10"), Groups: []string{"admin"}},
+			wantNext: []string{"totp"},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			sp, ok := tc.policy.(login.SignalPolicy)
+			if !ok {
+				t.Fatal("helper should return a SignalPolicy")
+			}
+			done, next, err := sp.NextWithSignals(tc.sig, userauth.User{ID: "u"}, []string{"password"})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if done != tc.wantDone {
+				t.Errorf("done: want %v, got %v", tc.wantDone, done)
+			}
+			if diff := cmp.Diff(tc.wantNext, next); diff != "" {
+				t.Errorf("next mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("preliminary signals offer both branches", func(t *testing.T) {
+		emailOnly := login.RequireAny(login.Chain{"email"})
+		for name, p := range map[string]login.Policy{
+			"groups":  login.RequireForGroups([]string{"admin"}, passwordTOTP, emailOnly),
+			"devices": login.RequireForNewDevices(passwordTOTP, emailOnly),
+		} {
+			done, next, err := p.(login.SignalPolicy).NextWithSignals(login.Signals{Preliminary: true}, userauth.User{ID: "u"}, nil)
+			if err != nil || done {
+				t.Fatalf("%s: done %v, err %v; want neither", name, done, err)
+			}
+			if diff := cmp.Diff([]string{"password", "email"}, next); diff != "" {
+				t.Errorf("%s: next mismatch (-want +got):\n%s", name, diff)
+			}
+		}
+	})
+
+	t.Run("plain Next evaluates empty signals", func(t *testing.T) {
+		p := login.RequireFromNetworks(office, passwordOnly, passwordTOTP)
+		if done, _, _ := p.Next(userauth.User{ID: "u"}, []string{"password"}); done {
+			t.Error("without signals the client must count as outside")
+		}
+	})
+}
+
+type staticGroups map[string][]string
+
+func (g staticGroups) GetGroups(userID string) ([]string, error) {
+	return g[userID], nil
+}
+
+// countingGroups counts the group lookups of the flow.
+type countingGroups struct {
+	staticGroups
+	calls int
+}
+
+func (g *countingGroups) GetGroups(userID string) ([]string, error) {
+	g.calls++
+	return g.staticGroups.GetGroups(userID)
+}
+
+// countingDevices counts the device checks of the flow; it recognises no
+// device.
+type countingDevices struct {
+	login.DeviceTrust
+	calls int
+}
+
+func (d *countingDevices) Verify(*http.Request, string) (trusteddevice.Device, bool, error) {
+	d.calls++
+	return trusteddevice.Device{}, false, nil
+}
+
+func TestFlowSignals(t *testing.T) {
+	proxy := netip.MustParsePrefix("10.0.0.0/8")
+
+	// login submits alice's password from remote with the given
+	// X-Forwarded-For and reports the result.
+	login1 := func(t *testing.T, f *fixture, remote, xff string) login.Result {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, "/login", nil)
+		r.RemoteAddr = remote
+		if xff != "" {
+			r.Header.Set("X-Forwarded-For", xff)
+		}
+		res, err := f.flow.Submit(r, httptest.NewRecorder(), "", "alice", "password", "alice-pw", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	t.Run("network policy with trusted proxies", func(t *testing.T) {
+		f := newFixture(login.RequireFromNetworks(office, passwordOnly, passwordTOTP))
+		f.flow.TrustedProxies = []netip.Prefix{proxy}
+		if res := login1(t, f, "192.0.2.5:4000", ""); !res.Done {
+			t.Errorf("direct office client: want Done, got %+v", res)
+		}
+		if res := login1(t, f, "10.1.2.3:4000", "192.0.2.5"); !res.Done {
+			t.Errorf("office client via trusted proxy: want Done, got %+v", res)
+		}
+		if res := login1(t, f, "198.51.100.9:4000", "192.0.2.5"); res.Done {
+			t.Errorf("spoofed header from an untrusted peer: want totp, got %+v", res)
+		}
+	})
+
+	t.Run("group policy reads Flow.Groups", func(t *testing.T) {
+		f := newFixture(login.RequireForGroups([]string{"admin"}, passwordTOTP, passwordOnly))
+		f.flow.Groups = staticGroups{"alice": {"admin"}}
+		if res := login1(t, f, "192.0.2.5:1", ""); res.Done || !cmp.Equal(res.Next, []string{"totp"}) {
+			t.Errorf("admin: want totp next, got %+v", res)
+		}
+		f = newFixture(login.RequireForGroups([]string{"admin"}, passwordTOTP, passwordOnly))
+		f.flow.Groups = staticGroups{}
+		if res := login1(t, f, "192.0.2.5:1", ""); !res.Done {
+			t.Errorf("non-member: want Done, got %+v", res)
+		}
+	})
+
+	t.Run("group policy without Flow.Groups is an internal error", func(t *testing.T) {
+		f := newFixture(login.RequireForGroups([]string{"admin"}, passwordTOTP, passwordOnly))
+		r := httptest.NewRequest(http.MethodPost, "/login", nil)
+		if _, err := f.flow.Submit(r, httptest.NewRecorder(), "", "alice", "password", "alice-pw", false); err == nil {
+			t.Error("want an error")
+		}
+	})
+	t.Run("account signals wait for the first factor", func(t *testing.T) {
+		f := newFixture(login.RequireForNewDevices(passwordTOTP, login.RequireForGroups([]string{"admin"}, passwordTOTP, passwordOnly)))
+		groups := &countingGroups{staticGroups: staticGroups{"alice": {"admin"}}}
+		devices := &countingDevices{}
+		f.flow.Groups, f.flow.Devices = groups, devices
+
+		if res := submit(t, f, "alice", "password", "wrong"); res.OK {
+			t.Fatalf("wrong password: want rejection, got %+v", res)
+		}
+		initiate(t, f, "alice", "email")
+		if groups.calls != 0 || devices.calls != 0 {
+			t.Fatalf("before any factor: %d group lookups, %d device checks; want none", groups.calls, devices.calls)
+		}
+		if res := submit(t, f, "alice", "password", "alice-pw"); !res.OK || !cmp.Equal(res.Next, []string{"totp"}) {
+			t.Fatalf("password: want totp next, got %+v", res)
+		}
+		if groups.calls == 0 || devices.calls == 0 {
+			t.Errorf("after the password: %d group lookups, %d device checks; want both", groups.calls, devices.calls)
+		}
+	})
+
+	t.Run("a first factor only the other branch offers fails", func(t *testing.T) {
+		f := newFixture(login.RequireForGroups([]string{"admin"}, passwordTOTP, login.RequireAny(login.Chain{"email"})))
+		f.flow.Groups = staticGroups{"alice": {"admin"}}
+		initiate(t, f, "alice", "email")
+		if f.deliverer.code == "" {
+			t.Fatal("preliminary signals offer the email code")
+		}
+		if res := submit(t, f, "alice", "email", f.deliverer.code); res.OK {
+			t.Errorf("admin with an email code: want rejection, got %+v", res)
+		}
+		if res := submit(t, f, "alice", "password", "alice-pw"); !res.OK || !cmp.Equal(res.Next, []string{"totp"}) {
+			t.Errorf("admin with a password: want totp next, got %+v", res)
+		}
+	})
+}
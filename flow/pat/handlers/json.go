@@ -12,6 +12,7 @@ import (
 	"path"
 	"time"
 
+	"github.com/go-bumbu/userauth/auth/csrf"
 	flowpat "github.com/go-bumbu/userauth/flow/pat"
 	patsvc "github.com/go-bumbu/userauth/service/pat"
 )
@@ -20,6 +21,7 @@ import (
 type JSON struct {
 	Flow   *flowpat.Flow
 	Logger *slog.Logger
+	CSRF   *csrf.Protector // optional; unsafe methods must pass its checks
 }
 
 // CreatePayload is the request body for CreateHandler.
@@ -75,7 +77,7 @@ func toMeta(rec patsvc.TokenRecord) TokenMeta {
 //   - 405 for non-POST requests
 //   - 500 for store failures
 func (h *JSON) CreateHandler() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return h.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
 			return
@@ -91,7 +93,7 @@ func (h *JSON) CreateHandler() http.Handler {
 			return
 		}
 		h.writeJSON(w, http.StatusCreated, CreateResponse{Token: plaintext, TokenMeta: toMeta(rec)})
-	})
+	}))
 }
 
 // ListHandler returns the GET endpoint listing the user's tokens (metadata only).
@@ -102,7 +104,7 @@ func (h *JSON) CreateHandler() http.Handler {
 //   - 405 for non-GET requests
 //   - 500 for store failures
 func (h *JSON) ListHandler() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return h.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
 			return
@@ -117,7 +119,7 @@ func (h *JSON) ListHandler() http.Handler {
 			out.Tokens = append(out.Tokens, toMeta(rec))
 		}
 		h.writeJSON(w, http.StatusOK, out)
-	})
+	}))
 }
 
 // DeleteHandler returns the DELETE endpoint revoking one token. The token ID
@@ -132,7 +134,7 @@ func (h *JSON) ListHandler() http.Handler {
 //   - 405 for non-DELETE requests
 //   - 500 for store failures
 func (h *JSON) DeleteHandler() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return h.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodDelete {
 			h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
 			return
@@ -147,7 +149,7 @@ func (h *JSON) DeleteHandler() http.Handler {
 			return
 		}
 		w.WriteHeader(http.StatusNoContent)
-	})
+	}))
 }
 
 // writeFlowError maps flow/service errors to HTTP responses.
@@ -179,6 +181,14 @@ func (h *JSON) writeError(w http.ResponseWriter, status int, msg string) {
 	h.writeJSON(w, status, errorResponse{Error: msg})
 }
 
+// protect wraps next in the CSRF middleware when one is configured.
+func (h *JSON) protect(next http.Handler) http.Handler {
+	if h.CSRF == nil {
+		return next
+	}
+	return h.CSRF.Middleware(next)
+}
+
 func (h *JSON) logger() *slog.Logger {
 	if h.Logger != nil {
 		return h.Logger
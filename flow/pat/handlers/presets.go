@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/go-bumbu/userauth/auth/cookieauth"
+	"github.com/go-bumbu/userauth/auth/csrf"
 	flowpat "github.com/go-bumbu/userauth/flow/pat"
 	patsvc "github.com/go-bumbu/userauth/service/pat"
 )
@@ -17,6 +18,9 @@ type Cfg struct {
 	// defaults to reading the cookieauth session context, which requires
 	// the endpoints to be mounted behind cookieauth session middleware.
 	UserID func(r *http.Request) (string, error)
+	// CSRF optionally guards create and delete against cross-site request
+	// forgery; mint tokens only on requests the user meant to make.
+	CSRF   *csrf.Protector
 	Logger *slog.Logger
 }
 
@@ -30,6 +34,7 @@ func New(cfg Cfg) *JSON {
 			Service: cfg.Service,
 			UserID:  cfg.UserID,
 		},
+		CSRF:   cfg.CSRF,
 		Logger: cfg.Logger,
 	}
 }
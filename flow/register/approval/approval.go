@@ -0,0 +1,185 @@
+// Package approval holds new accounts for moderator sign-off.
+//
+// register.ApprovalCheck creates the account disabled and records it here
+// through Service.Hold. An admin lists the pending approvals and approves
+// (enables the account) or rejects them; either way the registrant is told
+// through a verificationcode.Deliverer when the registration had an email.
+// Until an approval, the account stays disabled, and login rejects it like
+// any other disabled account.
+//
+// The Service owns the policy; persistence is delegated to a Store, the same
+// split as the invite package.
+package approval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-bumbu/userauth/service/verificationcode"
+)
+
+// ErrNotFound is returned when no pending approval exists for the user ID.
+var ErrNotFound = errors.New("approval not found")
+
+// Request is one account awaiting approval.
+type Request struct {
+	UserID    string // the account, created disabled
+	LoginID   string
+	Email     string // notice recipient; empty when the registration had none
+	Locale    string // the registrant's language for the notice
+	CreatedAt time.Time
+}
+
+// Store is pure persistence for pending approvals, keyed by user ID. Get
+// and Delete return ErrNotFound for an unknown user ID: a decision claims
+// the request by deleting it, so of two concurrent decisions exactly one
+// gets past Delete.
+type Store interface {
+	Save(req Request) error
+	Get(userID string) (Request, error)
+	List() ([]Request, error) // oldest first
+	Delete(userID string) error
+}
+
+// Enabler switches a held account on. userdb.Store satisfies it, as does any
+// userauth.UserUpdater.
+type Enabler interface {
+	SetEnabled(userID string, enabled bool) error
+}
+
+// Deleter removes a rejected account. userdb.Store satisfies it.
+type Deleter interface {
+	Delete(userID string) error
+}
+
+// Opts configures a Service. All fields are optional.
+type Opts struct {
+	// Deliver notifies registrants of the decision
+	// (PurposeRegistrationApproved / PurposeRegistrationRejected, the
+	// reason in Message.Note). Nil sends nothing.
+	Deliver verificationcode.Deliverer
+	// Delete, when set, removes rejected accounts so their login ID can
+	// be registered again. Without it a rejected account stays disabled.
+	Delete Deleter
+	Logger *slog.Logger // defaults to discarding
+}
+
+// Service owns the approval policy over a Store. It satisfies the register
+// package's ApprovalHolder.
+type Service struct {
+	store   Store
+	users   Enabler
+	deliver verificationcode.Deliverer
+	deleter Deleter
+	logger  *slog.Logger
+}
+
+// New wires the service to a Store and the user store that enables approved
+// accounts.
+func New(store Store, users Enabler, opts Opts) *Service {
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.DiscardHandler)
+	}
+	return &Service{
+		store:   store,
+		users:   users,
+		deliver: opts.Deliver,
+		deleter: opts.Delete,
+		logger:  opts.Logger,
+	}
+}
+
+// Hold records a freshly created, disabled account as awaiting approval.
+// The locale on ctx (verificationcode.WithLocale) is kept for the notice.
+func (s *Service) Hold(ctx context.Context, userID, loginID, email string) error {
+	return s.store.Save(Request{
+		UserID:    userID,
+		LoginID:   loginID,
+		Email:     email,
+		Locale:    verificationcode.LocaleFromContext(ctx),
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+// List returns the pending approvals, oldest first.
+func (s *Service) List() ([]Request, error) {
+	return s.store.List()
+}
+
+// Approve enables the account, removes the pending approval and notifies
+// the registrant; reason is optional and included in the notice. An unknown
+// or already decided user ID returns ErrNotFound.
+func (s *Service) Approve(ctx context.Context, userID, reason string) error {
+	req, err := s.claim(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.users.SetEnabled(userID, true); err != nil {
+		// put the request back so the approval can be retried
+		s.restore(req)
+		return fmt.Errorf("approval: enable account: %w", err)
+	}
+	s.notify(ctx, req, verificationcode.PurposeRegistrationApproved, reason)
+	return nil
+}
+
+// Reject removes the pending approval, deletes the account when Opts.Delete
+// is set (it otherwise stays disabled) and notifies the registrant with the
+// optional reason. An unknown or already decided user ID returns
+// ErrNotFound.
+func (s *Service) Reject(ctx context.Context, userID, reason string) error {
+	req, err := s.claim(userID)
+	if err != nil {
+		return err
+	}
+	if s.deleter != nil {
+		if err := s.deleter.Delete(userID); err != nil {
+			// put the request back so the rejection can be retried
+			s.restore(req)
+			return fmt.Errorf("approval: delete account: %w", err)
+		}
+	}
+	s.notify(ctx, req, verificationcode.PurposeRegistrationRejected, reason)
+	return nil
+}
+
+// claim takes the pending request out of the store; only the caller whose
+// Delete succeeds may act on it.
+func (s *Service) claim(userID string) (Request, error) {
+	req, err := s.store.Get(userID)
+	if err != nil {
+		return Request{}, err
+	}
+	if err := s.store.Delete(userID); err != nil {
+		return Request{}, err
+	}
+	return req, nil
+}
+
+// restore puts a claimed request back after its decision failed. A failure
+// is logged: the caller reports the original error.
+func (s *Service) restore(req Request) {
+	if err := s.store.Save(req); err != nil {
+		s.logger.Error("approval: restoring request failed", "userID", req.UserID, "error", err)
+	}
+}
+
+// notify delivers the decision. Failures are logged, not returned: the
+// decision stands either way.
+func (s *Service) notify(ctx context.Context, req Request, purpose verificationcode.Purpose, reason string) {
+	if s.deliver == nil || req.Email == "" {
+		return
+	}
+	err := s.deliver.Deliver(ctx, verificationcode.Message{
+		To:      req.Email,
+		Purpose: purpose,
+		Locale:  req.Locale,
+		Note:    reason,
+	})
+	if err != nil {
+		s.logger.Error("approval: notice delivery failed", "userID", req.UserID, "purpose", purpose, "error", err)
+	}
+}
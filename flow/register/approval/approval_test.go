@@ -0,0 +1,216 @@
+package approval_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-bumbu/userauth/flow/register/approval"
+	"github.com/go-bumbu/userauth/flow/register/approval/memory"
+	"github.com/go-bumbu/userauth/service/verificationcode"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// fakeUsers records enable and delete calls; optionally fails.
+type fakeUsers struct {
+	enabled   map[string]bool
+	deleted   []string
+	enableErr error
+	deleteErr error
+}
+
+func (u *fakeUsers) SetEnabled(userID string, enabled bool) error {
+	if u.enableErr != nil {
+		return u.enableErr
+	}
+	u.enabled[userID] = enabled
+	return nil
+}
+
+func (u *fakeUsers) Delete(userID string) error {
+	if u.deleteErr != nil {
+		return u.deleteErr
+	}
+	u.deleted = append(u.deleted, userID)
+	return nil
+}
+
+// captureDeliverer records delivered messages; optionally fails.
+type captureDeliverer struct {
+	msgs []verificationcode.Message
+	err  error
+}
+
+func (d *captureDeliverer) Deliver(_ context.Context, msg verificationcode.Message) error {
+	if d.err != nil {
+		return d.err
+	}
+	d.msgs = append(d.msgs, msg)
+	return nil
+}
+
+type fixture struct {
+	svc     *approval.Service
+	users   *fakeUsers
+	deliver *captureDeliverer
+}
+
+func newFixture(t *testing.T, deleteRejected bool) *fixture {
+	t.Helper()
+	f := &fixture{
+		users:   &fakeUsers{enabled: map[string]bool{}},
+		deliver: &captureDeliverer{},
+	}
+	opts := approval.Opts{Deliver: f.deliver}
+	if deleteRejected {
+		opts.Delete = f.users
+	}
+	f.svc = approval.New(memory.New(), f.users, opts)
+	ctx := verificationcode.WithLocale(context.Background(), "de")
+	if err := f.svc.Hold(ctx, "u1", "alice", "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestHoldAndList(t *testing.T) {
+	f := newFixture(t, false)
+	if err := f.svc.Hold(context.Background(), "u2", "bob", ""); err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.svc.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []approval.Request{
+		{UserID: "u1", LoginID: "alice", Email: "alice@example.com", Locale: "de"},
+		{UserID: "u2", LoginID: "bob"},
+	}
+	for _, req := range got {
+		if req.CreatedAt.IsZero() {
+			t.Errorf("request %s has no creation time", req.UserID)
+		}
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(approval.Request{}, "CreatedAt")); diff != "" {
+		t.Errorf("list mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestApprove(t *testing.T) {
+	f := newFixture(t, false)
+	if err := f.svc.Approve(context.Background(), "u1", "welcome"); err != nil {
+		t.Fatal(err)
+	}
+	if !f.users.enabled["u1"] {
+		t.Error("approved account must be enabled")
+	}
+	want := []verificationcode.Message{{
+		To:      "alice@example.com",
+		Purpose: verificationcode.PurposeRegistrationApproved,
+		Locale:  "de", // the registrant's, not the admin's
+		Note:    "welcome",
+	}}
+	if diff := cmp.Diff(want, f.deliver.msgs); diff != "" {
+		t.Errorf("notice mismatch (-want +got):\n%s", diff)
+	}
+	if err := f.svc.Approve(context.Background(), "u1", ""); !errors.Is(err, approval.ErrNotFound) {
+		t.Errorf("second approval: want ErrNotFound, got %v", err)
+	}
+	if err := f.svc.Reject(context.Background(), "u1", ""); !errors.Is(err, approval.ErrNotFound) {
+		t.Errorf("reject after approval: want ErrNotFound, got %v", err)
+	}
+}
+
+func TestReject(t *testing.T) {
+	tcs := []struct {
+		name        string
+		delete      bool
+		wantDeleted []string
+	}{
+		{name: "account stays disabled"},
+		{name: "account deleted", delete: true, wantDeleted: []string{"u1"}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFixture(t, tc.delete)
+			if err := f.svc.Reject(context.Background(), "u1", "spam"); err != nil {
+				t.Fatal(err)
+			}
+			if f.users.enabled["u1"] {
+				t.Error("rejected account must not be enabled")
+			}
+			if diff := cmp.Diff(tc.wantDeleted, f.users.deleted); diff != "" {
+				t.Errorf("deleted mismatch (-want +got):\n%s", diff)
+			}
+			if len(f.deliver.msgs) != 1 || f.deliver.msgs[0].Purpose != verificationcode.PurposeRegistrationRejected || f.deliver.msgs[0].Note != "spam" {
+				t.Errorf("want one rejection notice with the reason, got %+v", f.deliver.msgs)
+			}
+			if reqs, _ := f.svc.List(); len(reqs) != 0 {
+				t.Errorf("want no pending approvals left, got %+v", reqs)
+			}
+		})
+	}
+}
+
+func TestApproveEnableFailureKeepsRequest(t *testing.T) {
+	f := newFixture(t, false)
+	f.users.enableErr = errors.New("db down")
+	if err := f.svc.Approve(context.Background(), "u1", ""); err == nil {
+		t.Fatal("want error when the account cannot be enabled")
+	}
+	if len(f.deliver.msgs) != 0 {
+		t.Error("no notice may go out for a failed approval")
+	}
+	f.users.enableErr = nil
+	if err := f.svc.Approve(context.Background(), "u1", ""); err != nil {
+		t.Fatalf("retry after failure: %v", err)
+	}
+}
+
+func TestRejectDeleteFailureKeepsRequest(t *testing.T) {
+	f := newFixture(t, true)
+	f.users.deleteErr = errors.New("db down")
+	if err := f.svc.Reject(context.Background(), "u1", "spam"); err == nil {
+		t.Fatal("want error when the account cannot be deleted")
+	}
+	if len(f.deliver.msgs) != 0 {
+		t.Error("no notice may go out for a failed rejection")
+	}
+	if reqs, _ := f.svc.List(); len(reqs) != 1 || reqs[0].UserID != "u1" {
+		t.Fatalf("want the request pending again, got %+v", reqs)
+	}
+	f.users.deleteErr = nil
+	if err := f.svc.Reject(context.Background(), "u1", "spam"); err != nil {
+		t.Fatalf("retry after failure: %v", err)
+	}
+	if diff := cmp.Diff([]string{"u1"}, f.users.deleted); diff != "" {
+		t.Errorf("deleted mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNoticeDelivery(t *testing.T) {
+	t.Run("delivery failure does not undo the decision", func(t *testing.T) {
+		f := newFixture(t, false)
+		f.deliver.err = errors.New("smtp down")
+		if err := f.svc.Approve(context.Background(), "u1", ""); err != nil {
+			t.Fatal(err)
+		}
+		if !f.users.enabled["u1"] {
+			t.Error("account must be enabled despite the failed notice")
+		}
+	})
+
+	t.Run("no email, no notice", func(t *testing.T) {
+		f := newFixture(t, false)
+		if err := f.svc.Hold(context.Background(), "u2", "bob", ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.svc.Approve(context.Background(), "u2", ""); err != nil {
+			t.Fatal(err)
+		}
+		if len(f.deliver.msgs) != 0 {
+			t.Errorf("want no notice without an email, got %+v", f.deliver.msgs)
+		}
+	})
+}
@@ -0,0 +1,106 @@
+// Package db provides a GORM-backed approval.Store. Pending approvals are
+// stored in the pending_approvals table, one row per held account; Delete is
+// a single DELETE whose affected row count tells concurrent decisions apart.
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-bumbu/userauth/flow/register/approval"
+	"gorm.io/gorm"
+)
+
+// approvalModel stores one pending approval per row (pending_approvals
+// table). Rows are deleted for good once decided; there is no soft delete.
+type approvalModel struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    string `gorm:"uniqueIndex;not null"`
+	LoginID   string
+	Email     string
+	Locale    string
+	CreatedAt time.Time `gorm:"index;autoCreateTime:false"`
+}
+
+func (approvalModel) TableName() string { return "pending_approvals" }
+
+// Store is a GORM-backed approval store.
+type Store struct {
+	db *gorm.DB
+}
+
+// New creates a Store and auto-migrates the pending_approvals table.
+func New(db *gorm.DB) (*Store, error) {
+	if err := db.AutoMigrate(&approvalModel{}); err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Save stores the request. Overwrites any existing entry for the user ID.
+func (s *Store) Save(req approval.Request) error {
+	var m approvalModel
+	err := s.db.Where("user_id = ?", req.UserID).First(&m).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	m.UserID = req.UserID
+	m.LoginID = req.LoginID
+	m.Email = req.Email
+	m.Locale = req.Locale
+	m.CreatedAt = req.CreatedAt
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return s.db.Create(&m).Error
+	}
+	return s.db.Save(&m).Error
+}
+
+// Get retrieves the pending approval of the user.
+func (s *Store) Get(userID string) (approval.Request, error) {
+	var m approvalModel
+	err := s.db.Where("user_id = ?", userID).First(&m).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return approval.Request{}, approval.ErrNotFound
+		}
+		return approval.Request{}, err
+	}
+	return m.toRequest(), nil
+}
+
+// List returns the pending approvals, oldest first.
+func (s *Store) List() ([]approval.Request, error) {
+	var rows []approvalModel
+	if err := s.db.Order("created_at ASC, id ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make([]approval.Request, 0, len(rows))
+	for _, m := range rows {
+		out = append(out, m.toRequest())
+	}
+	return out, nil
+}
+
+// Delete removes the pending approval of the user. RowsAffected reports
+// whether this call removed it, so only one of two concurrent decisions
+// succeeds.
+func (s *Store) Delete(userID string) error {
+	res := s.db.Where("user_id = ?", userID).Delete(&approvalModel{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return approval.ErrNotFound
+	}
+	return nil
+}
+
+func (m approvalModel) toRequest() approval.Request {
+	return approval.Request{
+		UserID:    m.UserID,
+		LoginID:   m.LoginID,
+		Email:     m.Email,
+		Locale:    m.Locale,
+		CreatedAt: m.CreatedAt,
+	}
+}
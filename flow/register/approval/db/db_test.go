@@ -0,0 +1,110 @@
+package db_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-bumbu/userauth/flow/register/approval"
+	approvaldb "github.com/go-bumbu/userauth/flow/register/approval/db"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestStore(t *testing.T) *approvaldb.Store {
+	t.Helper()
+	gdb, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := approvaldb.New(gdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestStore(t *testing.T) {
+	t.Run("save and get", func(t *testing.T) {
+		store := newTestStore(t)
+		req := approval.Request{UserID: "u1", LoginID: "alice", Email: "a@example.com", Locale: "de", CreatedAt: time.Now().UTC()}
+		if err := store.Save(req); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.Get("u1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(req, got, cmpopts.EquateApproxTime(time.Second)); diff != "" {
+			t.Errorf("request mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("save overwrites", func(t *testing.T) {
+		store := newTestStore(t)
+		if err := store.Save(approval.Request{UserID: "u1", LoginID: "old"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Save(approval.Request{UserID: "u1", LoginID: "new"}); err != nil {
+			t.Fatal(err)
+		}
+		all, err := store.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(all) != 1 || all[0].LoginID != "new" {
+			t.Errorf("want one overwritten request, got %+v", all)
+		}
+	})
+
+	t.Run("get and delete missing", func(t *testing.T) {
+		store := newTestStore(t)
+		if _, err := store.Get("nope"); !errors.Is(err, approval.ErrNotFound) {
+			t.Fatalf("Get: want ErrNotFound, got %v", err)
+		}
+		if err := store.Delete("nope"); !errors.Is(err, approval.ErrNotFound) {
+			t.Fatalf("Delete: want ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("delete once", func(t *testing.T) {
+		store := newTestStore(t)
+		if err := store.Save(approval.Request{UserID: "u1"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Delete("u1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Delete("u1"); !errors.Is(err, approval.ErrNotFound) {
+			t.Fatalf("second Delete: want ErrNotFound, got %v", err)
+		}
+		// the row is gone for good: the user can be held again
+		if err := store.Save(approval.Request{UserID: "u1"}); err != nil {
+			t.Fatalf("save after delete: %v", err)
+		}
+	})
+
+	t.Run("list oldest first", func(t *testing.T) {
+		store := newTestStore(t)
+		now := time.Now().UTC()
+		for i, id := range []string{"late", "early", "middle"} {
+			offset := []time.Duration{2, 0, 1}[i] * time.Minute
+			if err := store.Save(approval.Request{UserID: id, CreatedAt: now.Add(offset)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := store.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, req := range got {
+			ids = append(ids, req.UserID)
+		}
+		if diff := cmp.Diff([]string{"early", "middle", "late"}, ids); diff != "" {
+			t.Errorf("order mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
@@ -0,0 +1,165 @@
+// Package handlers provides admin JSON endpoints over an approval.Service:
+// list the accounts awaiting approval, and approve or reject one with an
+// optional reason. Approving enables an account, so mount the endpoints
+// behind an admin check (authz.Middleware with authz.RequireGroup, for
+// instance); the package does no authorization of its own.
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-bumbu/userauth/auth/csrf"
+	"github.com/go-bumbu/userauth/flow/register/approval"
+)
+
+// JSON exposes an approval.Service as admin endpoints.
+type JSON struct {
+	Service *approval.Service
+	Logger  *slog.Logger
+	CSRF    *csrf.Protector // optional; approve and reject must pass its checks
+}
+
+// Pending is one account awaiting approval.
+type Pending struct {
+	UserID    string    `json:"user_id"`
+	LoginID   string    `json:"login_id"`
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ListResponse is the body of a successful list.
+type ListResponse struct {
+	Pending []Pending `json:"pending"`
+}
+
+// DecisionPayload is the request body for ApproveHandler and
+// RejectHandler. Reason is optional and passed on to the registrant.
+type DecisionPayload struct {
+	UserID string `json:"user_id"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// ListHandler returns the GET endpoint listing the pending approvals,
+// oldest first.
+//
+// Responses:
+//   - 200 ListResponse
+//   - 405 for non-GET requests
+//   - 500 for store failures
+func (h *JSON) ListHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		reqs, err := h.Service.List()
+		if err != nil {
+			h.writeServiceError(w, err)
+			return
+		}
+		out := ListResponse{Pending: make([]Pending, 0, len(reqs))}
+		for _, req := range reqs {
+			out.Pending = append(out.Pending, Pending{
+				UserID:    req.UserID,
+				LoginID:   req.LoginID,
+				Email:     req.Email,
+				CreatedAt: req.CreatedAt,
+			})
+		}
+		h.writeJSON(w, http.StatusOK, out)
+	})
+}
+
+// ApproveHandler returns the POST endpoint approving an account: it is
+// enabled and the registrant notified.
+//
+// Responses:
+//   - 204 on success
+//   - 400 for a malformed body or missing user_id
+//   - 404 when the user has no pending approval (unknown or already decided)
+//   - 405 for non-POST requests
+//   - 500 for store failures
+func (h *JSON) ApproveHandler() http.Handler {
+	return h.decision("approved", func(r *http.Request, p DecisionPayload) error {
+		return h.Service.Approve(r.Context(), p.UserID, p.Reason)
+	})
+}
+
+// RejectHandler returns the POST endpoint rejecting an account: it stays
+// disabled, or is deleted when the service is configured to, and the
+// registrant is notified. Responses mirror ApproveHandler.
+func (h *JSON) RejectHandler() http.Handler {
+	return h.decision("rejected", func(r *http.Request, p DecisionPayload) error {
+		return h.Service.Reject(r.Context(), p.UserID, p.Reason)
+	})
+}
+
+// decision is the shared body of the approve and reject endpoints.
+func (h *JSON) decision(outcome string, decide func(*http.Request, DecisionPayload) error) http.Handler {
+	return h.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		var p DecisionPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			h.writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if p.UserID == "" {
+			h.writeError(w, http.StatusBadRequest, "user_id is required")
+			return
+		}
+		if err := decide(r, p); err != nil {
+			h.writeServiceError(w, err)
+			return
+		}
+		h.logger().Info("registration "+outcome, "userID", p.UserID, "reason", p.Reason)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+// writeServiceError maps Service errors to HTTP responses.
+func (h *JSON) writeServiceError(w http.ResponseWriter, err error) {
+	if errors.Is(err, approval.ErrNotFound) {
+		h.writeError(w, http.StatusNotFound, "no pending approval")
+		return
+	}
+	h.logger().Error("approval handler: internal error", "err", err)
+	h.writeError(w, http.StatusInternalServerError, "internal error")
+}
+
+func (h *JSON) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.logger().Error("approval handler: encode response", "err", err)
+	}
+}
+
+func (h *JSON) writeError(w http.ResponseWriter, status int, msg string) {
+	h.writeJSON(w, status, errorResponse{Error: msg})
+}
+
+// protect wraps next in the CSRF middleware when one is configured.
+func (h *JSON) protect(next http.Handler) http.Handler {
+	if h.CSRF == nil {
+		return next
+	}
+	return h.CSRF.Middleware(next)
+}
+
+func (h *JSON) logger() *slog.Logger {
+	if h.Logger != nil {
+		return h.Logger
+	}
+	return slog.Default()
+}
@@ -0,0 +1,147 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-bumbu/userauth/flow/register/approval"
+	"github.com/go-bumbu/userauth/flow/register/approval/handlers"
+	"github.com/go-bumbu/userauth/flow/register/approval/memory"
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeUsers records which accounts were enabled.
+type fakeUsers struct {
+	enabled map[string]bool
+}
+
+func (u *fakeUsers) SetEnabled(userID string, enabled bool) error {
+	u.enabled[userID] = enabled
+	return nil
+}
+
+// newFixture returns handlers over a service holding "u1" (alice) and "u2"
+// (bob), in that order.
+func newFixture(t *testing.T) (*handlers.JSON, *fakeUsers) {
+	t.Helper()
+	users := &fakeUsers{enabled: map[string]bool{}}
+	svc := approval.New(memory.New(), users, approval.Opts{})
+	for _, u := range [][2]string{{"u1", "alice"}, {"u2", "bob"}} {
+		if err := svc.Hold(context.Background(), u[0], u[1], u[1]+"@example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &handlers.JSON{Service: svc, Logger: slog.New(slog.DiscardHandler)}, users
+}
+
+func do(t *testing.T, h http.Handler, method, target string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, &buf))
+	return rec
+}
+
+func listLogins(t *testing.T, h *handlers.JSON) []string {
+	t.Helper()
+	rec := do(t, h.ListHandler(), http.MethodGet, "/approvals", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp handlers.ListResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	got := []string{}
+	for _, p := range resp.Pending {
+		got = append(got, p.LoginID)
+	}
+	return got
+}
+
+func TestListHandler(t *testing.T) {
+	h, _ := newFixture(t)
+	if diff := cmp.Diff([]string{"alice", "bob"}, listLogins(t, h)); diff != "" {
+		t.Errorf("list mismatch (-want +got):\n%s", diff)
+	}
+	if rec := do(t, h.ListHandler(), http.MethodPost, "/approvals", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST list: status = %d, want 405", rec.Code)
+	}
+}
+
+func TestDecisionHandlers(t *testing.T) {
+	tcs := []struct {
+		name        string
+		approve     bool
+		method      string
+		body        any
+		wantStatus  int
+		wantEnabled bool
+		wantPending []string
+	}{
+		{
+			name: "approve", approve: true, method: http.MethodPost,
+			body:       handlers.DecisionPayload{UserID: "u1", Reason: "welcome"},
+			wantStatus: http.StatusNoContent, wantEnabled: true, wantPending: []string{"bob"},
+		},
+		{
+			name: "reject", method: http.MethodPost,
+			body:       handlers.DecisionPayload{UserID: "u1", Reason: "spam"},
+			wantStatus: http.StatusNoContent, wantPending: []string{"bob"},
+		},
+		{
+			name: "unknown user", approve: true, method: http.MethodPost,
+			body:       handlers.DecisionPayload{UserID: "nobody"},
+			wantStatus: http.StatusNotFound, wantPending: []string{"alice", "bob"},
+		},
+		{
+			name: "missing user id", method: http.MethodPost,
+			body:       handlers.DecisionPayload{Reason: "spam"},
+			wantStatus: http.StatusBadRequest, wantPending: []string{"alice", "bob"},
+		},
+		{
+			name: "wrong method", approve: true, method: http.MethodGet,
+			wantStatus: http.StatusMethodNotAllowed, wantPending: []string{"alice", "bob"},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			h, users := newFixture(t)
+			handler := h.RejectHandler()
+			if tc.approve {
+				handler = h.ApproveHandler()
+			}
+			rec := do(t, handler, tc.method, "/approvals/decide", tc.body)
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tc.wantStatus, rec.Body)
+			}
+			if users.enabled["u1"] != tc.wantEnabled {
+				t.Errorf("u1 enabled = %v, want %v", users.enabled["u1"], tc.wantEnabled)
+			}
+			if diff := cmp.Diff(tc.wantPending, listLogins(t, h)); diff != "" {
+				t.Errorf("pending mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecisionIsFinal(t *testing.T) {
+	h, _ := newFixture(t)
+	body := handlers.DecisionPayload{UserID: "u1"}
+	if rec := do(t, h.ApproveHandler(), http.MethodPost, "/", body); rec.Code != http.StatusNoContent {
+		t.Fatalf("approve: status = %d", rec.Code)
+	}
+	if rec := do(t, h.RejectHandler(), http.MethodPost, "/", body); rec.Code != http.StatusNotFound {
+		t.Errorf("reject after approve: status = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,92 @@
+package approval_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-bumbu/userauth/flow/login"
+	"github.com/go-bumbu/userauth/flow/register"
+	"github.com/go-bumbu/userauth/flow/register/approval"
+	"github.com/go-bumbu/userauth/flow/register/approval/memory"
+	"github.com/go-bumbu/userauth/userstore/userdb"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// userdbCreator adapts userdb.Store to register.UserCreator, honouring
+// NewUser.Disabled.
+type userdbCreator struct {
+	users *userdb.Store
+}
+
+func (c userdbCreator) CreateVerifiedUser(u register.NewUser) error {
+	return c.users.CreateUserWithHashedPassword(userdb.User{
+		LoginID: u.LoginID,
+		Pw:      u.PasswordHash,
+		Enabled: !u.Disabled,
+	})
+}
+
+type nopSession struct{}
+
+func (nopSession) LoginUser(*http.Request, http.ResponseWriter, string, bool) error { return nil }
+
+// TestLoginRejectedUntilApproved runs registration, login and approval over
+// one user store: the held account exists but cannot log in until an admin
+// approves it.
+func TestLoginRejectedUntilApproved(t *testing.T) {
+	gdb, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := userdb.New(gdb, userdb.Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	approvals := approval.New(memory.New(), users, approval.Opts{})
+	reg := &register.Flow{
+		Users:   users,
+		Creator: userdbCreator{users: users},
+		Checks:  []register.Check{register.ApprovalCheck{Approvals: approvals}},
+	}
+	lf := &login.Flow{
+		Users:   users,
+		Methods: []login.Method{login.PasswordMethod{Users: users}},
+		Policy:  login.RequireAny(login.Chain{login.MethodPassword}),
+		Session: nopSession{},
+	}
+	loginOK := func() bool {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, "/login", nil)
+		res, err := lf.Submit(r, httptest.NewRecorder(), "", "alice", login.MethodPassword, "pw", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Done
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/register", nil)
+	res, err := reg.Start(r, httptest.NewRecorder(), register.StartInput{LoginID: "alice", Password: "pw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Held {
+		t.Fatalf("want the account held, got %+v", res)
+	}
+	if loginOK() {
+		t.Fatal("login must be rejected while the account awaits approval")
+	}
+
+	pending, err := approvals.List()
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("want one pending approval, got %+v (err %v)", pending, err)
+	}
+	if err := approvals.Approve(context.Background(), pending[0].UserID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !loginOK() {
+		t.Error("login must succeed once approved")
+	}
+}
@@ -0,0 +1,68 @@
+// Package memory provides an in-memory approval.Store. Safe for concurrent
+// use. Suitable for development and testing, or for single-instance
+// deployments; pending approvals are lost on restart, leaving their
+// accounts disabled.
+package memory
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/go-bumbu/userauth/flow/register/approval"
+)
+
+// Store is an in-memory approval store.
+type Store struct {
+	mu    sync.Mutex
+	store map[string]approval.Request
+}
+
+func New() *Store {
+	return &Store{store: make(map[string]approval.Request)}
+}
+
+func (m *Store) Save(req approval.Request) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.store[req.UserID] = req
+	return nil
+}
+
+func (m *Store) Get(userID string) (approval.Request, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	req, ok := m.store[userID]
+	if !ok {
+		return approval.Request{}, approval.ErrNotFound
+	}
+	return req, nil
+}
+
+// List returns the pending approvals, oldest first.
+func (m *Store) List() ([]approval.Request, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]approval.Request, 0, len(m.store))
+	for _, req := range m.store {
+		out = append(out, req)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].UserID < out[j].UserID
+	})
+	return out, nil
+}
+
+// Delete removes the request; the mutex makes check-and-delete atomic, so
+// only one of two concurrent decisions succeeds.
+func (m *Store) Delete(userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.store[userID]; !ok {
+		return approval.ErrNotFound
+	}
+	delete(m.store, userID)
+	return nil
+}
@@ -0,0 +1,91 @@
+package memory_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-bumbu/userauth/flow/register/approval"
+	"github.com/go-bumbu/userauth/flow/register/approval/memory"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStore(t *testing.T) {
+	t.Run("save and get", func(t *testing.T) {
+		store := memory.New()
+		req := approval.Request{UserID: "u1", LoginID: "alice", Email: "a@example.com", Locale: "de", CreatedAt: time.Now().UTC()}
+		if err := store.Save(req); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.Get("u1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(req, got); diff != "" {
+			t.Errorf("request mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("get and delete missing", func(t *testing.T) {
+		store := memory.New()
+		if _, err := store.Get("nope"); !errors.Is(err, approval.ErrNotFound) {
+			t.Fatalf("Get: want ErrNotFound, got %v", err)
+		}
+		if err := store.Delete("nope"); !errors.Is(err, approval.ErrNotFound) {
+			t.Fatalf("Delete: want ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("list oldest first", func(t *testing.T) {
+		store := memory.New()
+		now := time.Now().UTC()
+		for i, id := range []string{"late", "early", "middle"} {
+			offset := []time.Duration{2, 0, 1}[i] * time.Minute
+			if err := store.Save(approval.Request{UserID: id, CreatedAt: now.Add(offset)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := store.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, req := range got {
+			ids = append(ids, req.UserID)
+		}
+		if diff := cmp.Diff([]string{"early", "middle", "late"}, ids); diff != "" {
+			t.Errorf("order mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("concurrent delete succeeds once", func(t *testing.T) {
+		store := memory.New()
+		if err := store.Save(approval.Request{UserID: "u1"}); err != nil {
+			t.Fatal(err)
+		}
+		const n = 16
+		var wg sync.WaitGroup
+		results := make(chan error, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results <- store.Delete("u1")
+			}()
+		}
+		wg.Wait()
+		close(results)
+		wins := 0
+		for err := range results {
+			if err == nil {
+				wins++
+			} else if !errors.Is(err, approval.ErrNotFound) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if wins != 1 {
+			t.Errorf("want exactly one successful delete, got %d", wins)
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package register
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// AttributeType is the value type of an Attribute. Values travel as strings
+// in every type; the type decides what parses and the canonical spelling.
+type AttributeType string
+
+const (
+	AttrString AttributeType = "string" // any text up to MaxLen
+	AttrInt    AttributeType = "int"    // a base-10 integer, canonicalized ("007" → "7")
+	AttrBool   AttributeType = "bool"   // strconv.ParseBool forms, canonicalized to "true"/"false"
+)
+
+// DefaultAttributeMaxLen bounds AttrString values when Attribute.MaxLen is
+// zero.
+const DefaultAttributeMaxLen = 256
+
+// Attribute declares one extra field collected at registration, such as a
+// display name or a locale.
+type Attribute struct {
+	Name     string
+	Type     AttributeType // defaults to AttrString
+	Required bool
+	// MaxLen bounds an AttrString value in characters; defaults to
+	// DefaultAttributeMaxLen.
+	MaxLen int
+	// Options, when set, lists the accepted values (after canonicalization).
+	Options []string
+	// Validate, when set, runs last on the canonical value; its error
+	// message is shown to the user.
+	Validate func(value string) error
+}
+
+// AttributeSchema declares the extra fields a Flow accepts. Submitted
+// attributes outside the schema are rejected, not dropped, so a client
+// typo does not silently lose data.
+type AttributeSchema []Attribute
+
+// Check validates in against the schema and returns the canonical values.
+// Optional attributes left empty are omitted; a nil map means none were
+// set. Rejections are *ValidationError.
+func (s AttributeSchema) Check(in map[string]string) (map[string]string, error) {
+	for name := range in {
+		if s.attribute(name) == nil {
+			return nil, &ValidationError{Msg: fmt.Sprintf("unknown attribute %q", name)}
+		}
+	}
+	var out map[string]string
+	for _, a := range s {
+		v, err := a.canonical(in[a.Name])
+		if err != nil {
+			return nil, &ValidationError{Msg: fmt.Sprintf("%s: %s", a.Name, err)}
+		}
+		if v == "" {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]string)
+		}
+		out[a.Name] = v
+	}
+	return out, nil
+}
+
+// valid reports a misconfigured schema: unnamed or duplicate attributes and
+// unknown types.
+func (s AttributeSchema) valid() error {
+	seen := make(map[string]bool, len(s))
+	for _, a := range s {
+		if a.Name == "" || seen[a.Name] {
+			return fmt.Errorf("register: attribute name %q empty or duplicate", a.Name)
+		}
+		seen[a.Name] = true
+		switch a.Type {
+		case "", AttrString, AttrInt, AttrBool:
+		default:
+			return fmt.Errorf("register: attribute %q has unknown type %q", a.Name, a.Type)
+		}
+	}
+	return nil
+}
+
+func (s AttributeSchema) attribute(name string) *Attribute {
+	for i := range s {
+		if s[i].Name == name {
+			return &s[i]
+		}
+	}
+	return nil
+}
+
+// canonical validates v and returns its canonical form, "" for an absent
+// optional value.
+func (a Attribute) canonical(v string) (string, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		if a.Required {
+			return "", fmt.Errorf("is required")
+		}
+		return "", nil
+	}
+	switch a.Type {
+	case AttrString, "":
+		maxLen := a.MaxLen
+		if maxLen <= 0 {
+			maxLen = DefaultAttributeMaxLen
+		}
+		if !utf8.ValidString(v) || strings.ContainsFunc(v, unicode.IsControl) {
+			return "", fmt.Errorf("contains invalid characters")
+		}
+		if utf8.RuneCountInString(v) > maxLen {
+			return "", fmt.Errorf("must be at most %d characters", maxLen)
+		}
+	case AttrInt:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("must be a whole number")
+		}
+		v = strconv.FormatInt(n, 10)
+	case AttrBool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return "", fmt.Errorf("must be true or false")
+		}
+		v = strconv.FormatBool(b)
+	}
+	if len(a.Options) > 0 && !slices.Contains(a.Options, v) {
+		return "", fmt.Errorf("must be one of %s", strings.Join(a.Options, ", "))
+	}
+	if a.Validate != nil {
+		if err := a.Validate(v); err != nil {
+			return "", err
+		}
+	}
+	return v, nil
+}
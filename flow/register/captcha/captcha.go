@@ -0,0 +1,142 @@
+// Package captcha verifies CAPTCHA response tokens against a provider's
+// siteverify endpoint; *Verifier satisfies register.CaptchaVerifier.
+//
+// Cloudflare Turnstile, hCaptcha and Google reCAPTCHA share one protocol: a
+// form POST of secret, response and (optionally) remoteip, answered with
+// JSON carrying "success", "hostname" and "error-codes". Any provider that
+// speaks it works by pointing Config.URL at its endpoint.
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Siteverify endpoints of the common providers.
+const (
+	TurnstileURL = "https://challenges.cloudflare.com/turnstile/v0/siteverify"
+	HCaptchaURL  = "https://api.hcaptcha.com/siteverify"
+)
+
+// DefaultTimeout bounds one verification request.
+const DefaultTimeout = 5 * time.Second
+
+// maxResponse caps how much of a provider response is read.
+const maxResponse = 64 << 10
+
+// Config configures a Verifier. URL and Secret are required.
+type Config struct {
+	URL    string // siteverify endpoint, e.g. TurnstileURL
+	Secret string // the site's secret key
+	// Hostname, when set, must match the hostname the provider reports the
+	// token was solved on, so tokens from another site using the same
+	// provider are refused.
+	Hostname string
+	// Client sends the requests; defaults to a plain http.Client.
+	Client *http.Client
+	// Timeout bounds each request; defaults to DefaultTimeout.
+	Timeout time.Duration
+}
+
+// Verifier checks tokens with one provider.
+type Verifier struct {
+	url      string
+	secret   string
+	hostname string
+	client   *http.Client
+	timeout  time.Duration
+}
+
+// New validates cfg and returns a Verifier.
+func New(cfg Config) (*Verifier, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("captcha: url is required")
+	}
+	if cfg.Secret == "" {
+		return nil, fmt.Errorf("captcha: secret is required")
+	}
+	v := &Verifier{
+		url:      cfg.URL,
+		secret:   cfg.Secret,
+		hostname: cfg.Hostname,
+		client:   cfg.Client,
+		timeout:  cfg.Timeout,
+	}
+	if v.client == nil {
+		v.client = &http.Client{}
+	}
+	if v.timeout <= 0 {
+		v.timeout = DefaultTimeout
+	}
+	return v, nil
+}
+
+// configErrors are provider error codes that blame the deployment, not the
+// token: they fail the registration as an internal error.
+var configErrors = map[string]bool{
+	"missing-input-secret":    true,
+	"invalid-input-secret":    true,
+	"sitekey-secret-mismatch": true,
+	"internal-error":          true,
+}
+
+// siteverifyResponse is the part of the provider answer the Verifier reads.
+type siteverifyResponse struct {
+	Success    bool     `json:"success"`
+	Hostname   string   `json:"hostname"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+// VerifyCaptcha asks the provider about token. A refused token — invalid,
+// expired, already redeemed, or solved on another hostname — is (false,
+// nil); an unreachable provider, a non-2xx status, an unreadable answer or
+// an error code blaming the secret is an error, so outages and
+// misconfiguration surface as a 5xx instead of blaming the user.
+func (v *Verifier) VerifyCaptcha(ctx context.Context, token, remoteIP string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+
+	form := url.Values{"secret": {v.secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, fmt.Errorf("captcha: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("captcha: siteverify: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return false, fmt.Errorf("captcha: siteverify: status %d", resp.StatusCode)
+	}
+	var out siteverifyResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponse)).Decode(&out); err != nil {
+		return false, fmt.Errorf("captcha: siteverify: decode response: %w", err)
+	}
+	if !out.Success {
+		for _, code := range out.ErrorCodes {
+			if configErrors[code] {
+				return false, fmt.Errorf("captcha: siteverify: %s", code)
+			}
+		}
+		return false, nil
+	}
+	if v.hostname != "" && !strings.EqualFold(out.Hostname, v.hostname) {
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,164 @@
+package captcha_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-bumbu/userauth/flow/register/captcha"
+	"github.com/google/go-cmp/cmp"
+)
+
+const secret = "test-secret"
+
+// provider is a siteverify stand-in: "good" tokens solved on example.com
+// pass, "other-site" tokens were solved on another hostname, everything else
+// is refused. It records the last form it received.
+type provider struct {
+	form   map[string]string
+	status int
+	reply  any // overrides the computed answer when set
+}
+
+func (p *provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.form = map[string]string{}
+	for k := range r.PostForm {
+		p.form[k] = r.PostForm.Get(k)
+	}
+	if p.status != 0 {
+		w.WriteHeader(p.status)
+		return
+	}
+	reply := p.reply
+	if reply == nil {
+		switch {
+		case r.PostForm.Get("secret") != secret:
+			reply = map[string]any{"success": false, "error-codes": []string{"invalid-input-secret"}}
+		case r.PostForm.Get("response") == "good":
+			reply = map[string]any{"success": true, "hostname": "example.com"}
+		case r.PostForm.Get("response") == "other-site":
+			reply = map[string]any{"success": true, "hostname": "evil.example"}
+		default:
+			reply = map[string]any{"success": false, "error-codes": []string{"invalid-input-response"}}
+		}
+	}
+	_ = json.NewEncoder(w).Encode(reply)
+}
+
+func newVerifier(t *testing.T, p *provider, mod func(*captcha.Config)) *captcha.Verifier {
+	t.Helper()
+	srv := httptest.NewServer(p)
+	t.Cleanup(srv.Close)
+	cfg := captcha.Config{URL: srv.URL, Secret: secret, Hostname: "example.com"}
+	if mod != nil {
+		mod(&cfg)
+	}
+	v, err := captcha.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestVerifyCaptcha(t *testing.T) {
+	tcs := []struct {
+		name    string
+		token   string
+		mod     func(*captcha.Config)
+		want    bool
+		wantErr bool
+	}{
+		{name: "valid token", token: "good", want: true},
+		{name: "refused token", token: "bad"},
+		{name: "empty token", token: ""},
+		{name: "token from another site", token: "other-site"},
+		{name: "any hostname when unset", token: "other-site", mod: func(c *captcha.Config) { c.Hostname = "" }, want: true},
+		{name: "wrong secret is an error", token: "good", mod: func(c *captcha.Config) { c.Secret = "nope" }, wantErr: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v := newVerifier(t, &provider{}, tc.mod)
+			got, err := v.VerifyCaptcha(context.Background(), tc.token, "")
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("VerifyCaptcha() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestVerifyCaptchaRequest(t *testing.T) {
+	p := &provider{}
+	v := newVerifier(t, p, nil)
+	if _, err := v.VerifyCaptcha(context.Background(), "good", "203.0.113.7"); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"secret": secret, "response": "good", "remoteip": "203.0.113.7"}
+	if diff := cmp.Diff(want, p.form); diff != "" {
+		t.Errorf("form mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := v.VerifyCaptcha(context.Background(), "good", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.form["remoteip"]; ok {
+		t.Error("remoteip must be omitted when unknown")
+	}
+
+	p.form = nil
+	if ok, _ := v.VerifyCaptcha(context.Background(), "", "203.0.113.7"); ok || p.form != nil {
+		t.Error("an empty token must be refused without asking the provider")
+	}
+}
+
+func TestVerifyCaptchaProviderFailure(t *testing.T) {
+	tcs := []struct {
+		name string
+		p    *provider
+	}{
+		{name: "5xx", p: &provider{status: http.StatusBadGateway}},
+		{name: "garbage", p: &provider{reply: "not an object"}},
+		{name: "provider internal error", p: &provider{reply: map[string]any{"success": false, "error-codes": []string{"internal-error"}}}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v := newVerifier(t, tc.p, nil)
+			if ok, err := v.VerifyCaptcha(context.Background(), "good", ""); err == nil || ok {
+				t.Errorf("want error, got ok=%v err=%v", ok, err)
+			}
+		})
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		release := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		t.Cleanup(srv.Close)
+		t.Cleanup(func() { close(release) }) // runs first: lets Close finish
+		v, err := captcha.New(captcha.Config{URL: srv.URL, Secret: secret, Timeout: 20 * time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := v.VerifyCaptcha(context.Background(), "good", ""); err == nil {
+			t.Error("want error when the provider does not answer in time")
+		}
+	})
+}
+
+func TestNew(t *testing.T) {
+	for _, cfg := range []captcha.Config{{Secret: secret}, {URL: captcha.TurnstileURL}} {
+		if _, err := captcha.New(cfg); err == nil {
+			t.Errorf("New(%+v): want error", cfg)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package register
 
 import (
 	"context"
+	"maps"
 	"time"
 
 	"github.com/go-bumbu/userauth/service/verificationcode"
@@ -10,8 +11,12 @@ import (
 // Well-known check IDs. Transports refer to checks by these strings; custom
 // checks may introduce their own.
 const (
-	CheckEmail  = "email"
-	CheckInvite = "invite"
+	CheckEmail       = "email"
+	CheckInvite      = "invite"
+	CheckApproval    = "approval"
+	CheckCaptcha     = "captcha"
+	CheckPoW         = "pow"
+	CheckEmailDomain = "email_domain"
 )
 
 // Check is one registration requirement. All configured checks must pass
@@ -28,8 +33,12 @@ type Check interface {
 // PreVerifier is a check that can be verified synchronously at Start from
 // the submitted input (e.g. an invite code), without a round trip. The
 // engine runs PreVerify instead of asking the user for a later submission.
+//
+// A rejection the user should be told about, rather than the uniform
+// failure, is returned as a *ValidationError; Start returns it wrapped,
+// like its own input validation errors. ctx is the Start request's context.
 type PreVerifier interface {
-	PreVerify(in StartInput) (bool, error)
+	PreVerify(ctx context.Context, in StartInput) (bool, error)
 }
 
 // Initiator is the optional issuance side of a deliverable check: generate a
@@ -47,6 +56,22 @@ type Finalizer interface {
 	Finalize(reg Registration) (bool, error)
 }
 
+// Provisioner is a Finalizer that also shapes the account: the engine calls
+// Provision in place of Finalize and creates the account from the NewUser
+// it returns. InviteCheck adds the groups and attributes an invite grants.
+type Provisioner interface {
+	Provision(reg Registration, u NewUser) (NewUser, bool, error)
+}
+
+// Holder is an optional hook for a requirement the registrant cannot meet
+// themselves, such as an admin's approval. When any check is a Holder, the
+// engine creates the account disabled (NewUser.Disabled), skips auto-login
+// and calls Hold with the new user ID; enabling the account is then up to
+// whatever Hold recorded it with.
+type Holder interface {
+	Hold(ctx context.Context, reg Registration, userID string) error
+}
+
 // CodeService issues and verifies one-time codes.
 // *verificationcode.Service satisfies this.
 type CodeService interface {
@@ -63,6 +88,10 @@ type CodeService interface {
 type EmailCheck struct {
 	Codes   CodeService
 	Deliver verificationcode.Deliverer
+	// Locale resolves the message language for the registration. When nil,
+	// the locale the transport put on the context
+	// (verificationcode.WithLocale) is used.
+	Locale func(ctx context.Context, reg Registration) string
 }
 
 func (c EmailCheck) ID() string { return CheckEmail }
@@ -78,12 +107,22 @@ func (c EmailCheck) Initiate(ctx context.Context, reg Registration) error {
 	if err != nil {
 		return err
 	}
-	return c.Deliver.Deliver(ctx, reg.Email, code, expiresAt)
+	locale := verificationcode.LocaleFromContext(ctx)
+	if c.Locale != nil {
+		locale = c.Locale(ctx, reg)
+	}
+	return c.Deliver.Deliver(ctx, verificationcode.Message{
+		To:        reg.Email,
+		Code:      code,
+		ExpiresAt: expiresAt,
+		Purpose:   verificationcode.PurposeRegistration,
+		Locale:    locale,
+	})
 }
 
 // InviteCheck requires a valid invite code. It is pre-verified at Start
 // (fail fast, read-only) and consumed atomically at account creation via
-// Finalize — an invite exhausted or revoked while the registration was
+// Provision — an invite exhausted or revoked while the registration was
 // pending aborts it.
 type InviteCheck struct {
 	Invites InviteConsumer
@@ -98,10 +137,139 @@ func (c InviteCheck) Verify(_, _ string) (bool, error) {
 	return false, nil
 }
 
-func (c InviteCheck) PreVerify(in StartInput) (bool, error) {
+func (c InviteCheck) PreVerify(_ context.Context, in StartInput) (bool, error) {
 	return c.Invites.Validate(in.InviteCode, in.Email)
 }
 
 func (c InviteCheck) Finalize(reg Registration) (bool, error) {
 	return c.Invites.Consume(reg.InviteCode, reg.Email)
 }
+
+// Provision consumes the invite like Finalize. When Invites is an
+// InviteRedeemer it also records the registrant as accepting the invite,
+// grants the invite's groups and attributes and sets NewUser.InvitedBy for
+// a referral; the invite's attributes win over the registrant's, which lets
+// an admin preset fields such as a team.
+func (c InviteCheck) Provision(reg Registration, u NewUser) (NewUser, bool, error) {
+	redeemer, ok := c.Invites.(InviteRedeemer)
+	if !ok {
+		ok, err := c.Finalize(reg)
+		return u, ok, err
+	}
+	groups, attributes, invitedBy, ok, err := redeemer.Redeem(reg.InviteCode, reg.Email, reg.LoginID)
+	if err != nil || !ok {
+		return u, ok, err
+	}
+	u.InvitedBy = invitedBy
+	u.Groups = append(u.Groups, groups...)
+	if len(attributes) > 0 {
+		merged := make(map[string]string, len(u.Attributes)+len(attributes))
+		maps.Copy(merged, u.Attributes)
+		maps.Copy(merged, attributes)
+		u.Attributes = merged
+	}
+	return u, true, nil
+}
+
+// ApprovalCheck holds every new account for an admin's approval. It asks
+// nothing of the registrant — it is satisfied at Start — and instead creates
+// the account disabled and records it with Approvals, where an admin
+// approves (enables) or rejects it.
+type ApprovalCheck struct {
+	Approvals ApprovalHolder
+}
+
+func (c ApprovalCheck) ID() string { return CheckApproval }
+
+// Verify always fails: there is nothing for the registrant to submit.
+func (c ApprovalCheck) Verify(_, _ string) (bool, error) {
+	return false, nil
+}
+
+func (c ApprovalCheck) PreVerify(context.Context, StartInput) (bool, error) {
+	return true, nil
+}
+
+func (c ApprovalCheck) Hold(ctx context.Context, reg Registration, userID string) error {
+	return c.Approvals.Hold(ctx, userID, reg.LoginID, reg.Email)
+}
+
+// CaptchaCheck requires a CAPTCHA solved in the registration form. The
+// widget's response token travels in StartInput.Captcha and is verified at
+// Start together with the client IP.
+//
+// The call to the provider runs under the request's context; the verifier
+// bounds it further with its own timeout.
+type CaptchaCheck struct {
+	Verifier CaptchaVerifier
+}
+
+func (c CaptchaCheck) ID() string { return CheckCaptcha }
+
+// Verify always fails: a CAPTCHA token is only accepted with the submission
+// it was solved for, at Start.
+func (c CaptchaCheck) Verify(_, _ string) (bool, error) {
+	return false, nil
+}
+
+func (c CaptchaCheck) PreVerify(ctx context.Context, in StartInput) (bool, error) {
+	if in.Captcha == "" {
+		return false, nil
+	}
+	var ip string
+	if in.ClientIP.IsValid() {
+		ip = in.ClientIP.String()
+	}
+	return c.Verifier.VerifyCaptcha(ctx, in.Captcha, ip)
+}
+
+// ProofOfWorkCheck requires a solved proof-of-work challenge — bot friction
+// without a third party. The client fetches a challenge, solves it for the
+// login ID it registers and sends the solution in StartInput.ProofOfWork.
+type ProofOfWorkCheck struct {
+	Verifier ProofOfWorkVerifier
+}
+
+func (c ProofOfWorkCheck) ID() string { return CheckPoW }
+
+// Verify always fails: the solution must be part of StartInput.
+func (c ProofOfWorkCheck) Verify(_, _ string) (bool, error) {
+	return false, nil
+}
+
+func (c ProofOfWorkCheck) PreVerify(_ context.Context, in StartInput) (bool, error) {
+	if in.ProofOfWork == "" {
+		return false, nil
+	}
+	return c.Verifier.VerifySolution(in.ProofOfWork, in.LoginID)
+}
+
+// EmailDomainCheck admits only registrations whose email the Policy accepts:
+// company domains only, no throwaway addresses, a domain that receives mail.
+// It checks StartInput.Email, which defaults to the login ID under
+// userauth.UsernameFormatEmail, and makes the email required.
+//
+// A refused address is a *ValidationError rather than the uniform failure:
+// the domain policy is no secret, and the registrant needs to know to use
+// another address.
+type EmailDomainCheck struct {
+	Policy EmailPolicy
+}
+
+func (c EmailDomainCheck) ID() string { return CheckEmailDomain }
+
+// Verify always fails: the email is part of StartInput.
+func (c EmailDomainCheck) Verify(_, _ string) (bool, error) {
+	return false, nil
+}
+
+func (c EmailDomainCheck) PreVerify(ctx context.Context, in StartInput) (bool, error) {
+	ok, err := c.Policy.AllowEmail(ctx, in.Email)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, &ValidationError{Msg: "email address not accepted"}
+	}
+	return true, nil
+}
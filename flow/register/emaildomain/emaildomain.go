@@ -0,0 +1,240 @@
+// Package emaildomain decides which email domains may register: allow and
+// deny lists, a disposable-domain list and an optional MX lookup. *Policy
+// satisfies register.EmailPolicy.
+//
+// List entries are either a domain, matching exactly, or "*." followed by a
+// domain, matching every subdomain of it but not the domain itself; list
+// both to admit a company and its subsidiaries' mail hosts. Matching is
+// case-insensitive.
+package emaildomain
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds one MX lookup.
+const DefaultTimeout = 5 * time.Second
+
+//go:embed disposable.txt
+var disposableList string
+
+// Resolver looks up MX records; *net.Resolver satisfies it.
+type Resolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+// Config configures a Policy. The zero value admits every domain.
+type Config struct {
+	// Allow, when non-empty, admits only the matching domains.
+	Allow []string
+	// Deny refuses the matching domains; it wins over Allow.
+	Deny []string
+	// BlockDisposable refuses throwaway-mail domains and their subdomains.
+	BlockDisposable bool
+	// Disposable replaces the embedded list (DisposableDomains) used by
+	// BlockDisposable.
+	Disposable []string
+	// MX, when set, requires the domain to publish at least one usable MX
+	// record; pass net.DefaultResolver for the system's DNS.
+	MX Resolver
+	// Timeout bounds each MX lookup; defaults to DefaultTimeout.
+	Timeout time.Duration
+}
+
+// Policy applies a Config. It is safe for concurrent use; SetDisposable may
+// swap the disposable list while registrations run.
+type Policy struct {
+	allow, deny     patterns
+	blockDisposable bool
+	mx              Resolver
+	timeout         time.Duration
+
+	mu         sync.RWMutex
+	disposable map[string]bool
+}
+
+// New validates cfg and returns a Policy.
+func New(cfg Config) (*Policy, error) {
+	allow, err := compile(cfg.Allow)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := compile(cfg.Deny)
+	if err != nil {
+		return nil, err
+	}
+	p := &Policy{
+		allow:           allow,
+		deny:            deny,
+		blockDisposable: cfg.BlockDisposable,
+		mx:              cfg.MX,
+		timeout:         cfg.Timeout,
+	}
+	if p.timeout <= 0 {
+		p.timeout = DefaultTimeout
+	}
+	disposable := cfg.Disposable
+	if disposable == nil {
+		disposable = DisposableDomains()
+	}
+	p.SetDisposable(disposable)
+	return p, nil
+}
+
+// SetDisposable replaces the disposable-domain list, e.g. with a fresher one
+// loaded through ParseList.
+func (p *Policy) SetDisposable(domains []string) {
+	set := make(map[string]bool, len(domains))
+	for _, d := range domains {
+		if d = normalize(d); d != "" {
+			set[d] = true
+		}
+	}
+	p.mu.Lock()
+	p.disposable = set
+	p.mu.Unlock()
+}
+
+// AllowEmail reports whether the domain of email may register. A malformed
+// address or a refused domain is (false, nil); errors are reserved for DNS
+// failures other than the domain not existing.
+func (p *Policy) AllowEmail(ctx context.Context, email string) (bool, error) {
+	domain, ok := domainOf(email)
+	if !ok {
+		return false, nil
+	}
+	if p.deny.match(domain) {
+		return false, nil
+	}
+	if len(p.allow) > 0 && !p.allow.match(domain) {
+		return false, nil
+	}
+	if p.blockDisposable && p.isDisposable(domain) {
+		return false, nil
+	}
+	if p.mx != nil {
+		return p.hasMX(ctx, domain)
+	}
+	return true, nil
+}
+
+func (p *Policy) isDisposable(domain string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for d := domain; ; {
+		if p.disposable[d] {
+			return true
+		}
+		_, parent, ok := strings.Cut(d, ".")
+		if !ok {
+			return false
+		}
+		d = parent
+	}
+}
+
+// hasMX reports whether domain publishes an MX record other than the null
+// MX ("."), which declares that the domain accepts no mail.
+func (p *Policy) hasMX(ctx context.Context, domain string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	records, err := p.mx.LookupMX(ctx, domain)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return false, nil
+		}
+		return false, fmt.Errorf("emaildomain: lookup MX %s: %w", domain, err)
+	}
+	for _, r := range records {
+		if r.Host != "" && r.Host != "." {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DisposableDomains returns the embedded disposable-domain list.
+func DisposableDomains() []string {
+	domains, _ := ParseList(strings.NewReader(disposableList)) // a strings.Reader does not fail
+	return domains
+}
+
+// ParseList reads a domain list in the format of the embedded one: one
+// domain per line, blank lines and lines starting with # ignored.
+func ParseList(r io.Reader) ([]string, error) {
+	var domains []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains = append(domains, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("emaildomain: read list: %w", err)
+	}
+	return domains, nil
+}
+
+// patterns is a compiled Allow or Deny list.
+type patterns []pattern
+
+type pattern struct {
+	domain   string
+	wildcard bool // matches subdomains of domain only
+}
+
+func compile(list []string) (patterns, error) {
+	out := make(patterns, 0, len(list))
+	for _, entry := range list {
+		d := normalize(entry)
+		wildcard := strings.HasPrefix(d, "*.")
+		d = strings.TrimPrefix(d, "*.")
+		if d == "" || strings.ContainsAny(d, "*@ ") {
+			return nil, fmt.Errorf("emaildomain: invalid pattern %q", entry)
+		}
+		out = append(out, pattern{domain: d, wildcard: wildcard})
+	}
+	return out, nil
+}
+
+func (ps patterns) match(domain string) bool {
+	for _, p := range ps {
+		if p.wildcard {
+			if strings.HasSuffix(domain, "."+p.domain) {
+				return true
+			}
+		} else if domain == p.domain {
+			return true
+		}
+	}
+	return false
+}
+
+// domainOf returns the normalized domain of email.
+func domainOf(email string) (string, bool) {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return "", false
+	}
+	domain := normalize(email[at+1:])
+	if domain == "" || strings.ContainsAny(domain, " @") {
+		return "", false
+	}
+	return domain, true
+}
+
+func normalize(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
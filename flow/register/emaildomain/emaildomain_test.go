@@ -0,0 +1,176 @@
+package emaildomain_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/go-bumbu/userauth/flow/register/emaildomain"
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeDNS answers MX lookups from a map; unknown names do not exist.
+type fakeDNS struct {
+	records map[string][]*net.MX
+	err     error
+	asked   []string
+}
+
+func (d *fakeDNS) LookupMX(_ context.Context, name string) ([]*net.MX, error) {
+	d.asked = append(d.asked, name)
+	if d.err != nil {
+		return nil, d.err
+	}
+	mx, ok := d.records[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return mx, nil
+}
+
+func TestAllowEmail(t *testing.T) {
+	tcs := []struct {
+		name  string
+		cfg   emaildomain.Config
+		email string
+		want  bool
+	}{
+		{name: "zero config admits all", email: "a@anything.example", want: true},
+		{name: "malformed", email: "no-at-sign"},
+		{name: "empty domain", email: "a@"},
+		{name: "empty local part", email: "@example.com"},
+
+		{name: "allow exact", cfg: emaildomain.Config{Allow: []string{"corp.example"}}, email: "a@corp.example", want: true},
+		{name: "allow is case-insensitive", cfg: emaildomain.Config{Allow: []string{"Corp.Example"}}, email: "a@CORP.example.", want: true},
+		{name: "allow exact excludes subdomains", cfg: emaildomain.Config{Allow: []string{"corp.example"}}, email: "a@eu.corp.example"},
+		{name: "allow wildcard", cfg: emaildomain.Config{Allow: []string{"*.corp.example"}}, email: "a@mail.eu.corp.example", want: true},
+		{name: "allow wildcard excludes apex", cfg: emaildomain.Config{Allow: []string{"*.corp.example"}}, email: "a@corp.example"},
+		{name: "wildcard needs a label boundary", cfg: emaildomain.Config{Allow: []string{"*.corp.example"}}, email: "a@evilcorp.example"},
+		{name: "outside allow list", cfg: emaildomain.Config{Allow: []string{"corp.example"}}, email: "a@gmail.example"},
+
+		{name: "deny", cfg: emaildomain.Config{Deny: []string{"spam.example"}}, email: "a@spam.example"},
+		{name: "deny wins over allow", cfg: emaildomain.Config{Allow: []string{"*.corp.example"}, Deny: []string{"contractors.corp.example"}}, email: "a@contractors.corp.example"},
+		{name: "not denied", cfg: emaildomain.Config{Deny: []string{"spam.example"}}, email: "a@ham.example", want: true},
+
+		{name: "disposable", cfg: emaildomain.Config{BlockDisposable: true}, email: "a@mailinator.com"},
+		{name: "disposable subdomain", cfg: emaildomain.Config{BlockDisposable: true}, email: "a@x.yopmail.com"},
+		{name: "disposable allowed unless blocked", email: "a@mailinator.com", want: true},
+		{name: "regular domain not disposable", cfg: emaildomain.Config{BlockDisposable: true}, email: "a@example.com", want: true},
+		{name: "custom disposable list", cfg: emaildomain.Config{BlockDisposable: true, Disposable: []string{"burner.example"}}, email: "a@burner.example"},
+		{name: "custom list replaces embedded", cfg: emaildomain.Config{BlockDisposable: true, Disposable: []string{"burner.example"}}, email: "a@mailinator.com", want: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := emaildomain.New(tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.AllowEmail(context.Background(), tc.email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("AllowEmail(%q) = %v, want %v", tc.email, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAllowEmailMX(t *testing.T) {
+	dns := &fakeDNS{records: map[string][]*net.MX{
+		"mail.example":   {{Host: "mx1.mail.example.", Pref: 10}},
+		"nomail.example": {{Host: ".", Pref: 0}}, // null MX
+		"empty.example":  {},
+	}}
+	p, err := emaildomain.New(emaildomain.Config{MX: dns, Deny: []string{"denied.example"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcs := []struct {
+		email string
+		want  bool
+	}{
+		{email: "a@mail.example", want: true},
+		{email: "a@nomail.example"},
+		{email: "a@empty.example"},
+		{email: "a@missing.example"},
+		{email: "a@denied.example"},
+	}
+	for _, tc := range tcs {
+		got, err := p.AllowEmail(context.Background(), tc.email)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.email, err)
+		}
+		if got != tc.want {
+			t.Errorf("AllowEmail(%q) = %v, want %v", tc.email, got, tc.want)
+		}
+	}
+	want := []string{"mail.example", "nomail.example", "empty.example", "missing.example"}
+	if diff := cmp.Diff(want, dns.asked); diff != "" {
+		t.Errorf("lookups mismatch, a denied domain must not be looked up (-want +got):\n%s", diff)
+	}
+
+	dns.err = &net.DNSError{Err: "server misbehaving", Name: "mail.example", IsTemporary: true}
+	if ok, err := p.AllowEmail(context.Background(), "a@mail.example"); err == nil || ok {
+		t.Errorf("DNS failure: want error, got ok=%v err=%v", ok, err)
+	}
+	if ok, err := p.AllowEmail(context.Background(), "a@"); err != nil || ok {
+		t.Errorf("malformed address must not be looked up: ok=%v err=%v", ok, err)
+	}
+}
+
+func TestSetDisposable(t *testing.T) {
+	p, err := emaildomain.New(emaildomain.Config{BlockDisposable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := emaildomain.ParseList(strings.NewReader("# fresh list\n\nnew-burner.example\n  Other.Example  \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"new-burner.example", "Other.Example"}, list); diff != "" {
+		t.Fatalf("ParseList mismatch (-want +got):\n%s", diff)
+	}
+	p.SetDisposable(list)
+	for email, want := range map[string]bool{
+		"a@new-burner.example": false,
+		"a@other.example":      false,
+		"a@mailinator.com":     true, // no longer listed
+	} {
+		if got, _ := p.AllowEmail(context.Background(), email); got != want {
+			t.Errorf("AllowEmail(%q) = %v, want %v", email, got, want)
+		}
+	}
+}
+
+func TestDisposableDomains(t *testing.T) {
+	domains := emaildomain.DisposableDomains()
+	if len(domains) == 0 {
+		t.Fatal("embedded list is empty")
+	}
+	for i, d := range domains {
+		if d != strings.ToLower(d) || strings.ContainsAny(d, " @*") {
+			t.Errorf("malformed entry %q", d)
+		}
+		if i > 0 && domains[i-1] >= d {
+			t.Errorf("list not sorted or has duplicates at %q", d)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, cfg := range []emaildomain.Config{
+		{Allow: []string{""}},
+		{Allow: []string{"*"}},
+		{Deny: []string{"*.*.example"}},
+		{Deny: []string{"user@example.com"}},
+	} {
+		if _, err := emaildomain.New(cfg); err == nil {
+			t.Errorf("New(%+v): want error", cfg)
+		}
+	}
+	if _, err := emaildomain.New(emaildomain.Config{}); err != nil {
+		t.Errorf("zero config: %v", err)
+	}
+}
@@ -5,13 +5,12 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"time"
 
 	"github.com/go-bumbu/userauth"
 	"github.com/go-bumbu/userauth/flow/register"
-	"github.com/go-bumbu/userauth/flow/register/invite"
-	invitememory "github.com/go-bumbu/userauth/flow/register/invite/memory"
 	"github.com/go-bumbu/userauth/flow/register/pendingstore/memory"
+	"github.com/go-bumbu/userauth/service/invite"
+	invitememory "github.com/go-bumbu/userauth/service/invite/memory"
 	"github.com/go-bumbu/userauth/service/verificationcode"
 	csmemory "github.com/go-bumbu/userauth/service/verificationcode/store/memory"
 )
@@ -43,9 +42,9 @@ type exampleDeliverer struct {
 	lastCode string
 }
 
-func (d *exampleDeliverer) Deliver(_ context.Context, to string, code string, _ time.Time) error {
-	d.lastCode = code
-	fmt.Printf("code delivered to %s\n", to)
+func (d *exampleDeliverer) Deliver(_ context.Context, msg verificationcode.Message) error {
+	d.lastCode = msg.Code
+	fmt.Printf("code delivered to %s\n", msg.To)
 	return nil
 }
 
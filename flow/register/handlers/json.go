@@ -15,8 +15,12 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
+	"time"
 
+	"github.com/go-bumbu/userauth/auth/csrf"
 	"github.com/go-bumbu/userauth/flow/register"
+	"github.com/go-bumbu/userauth/flow/register/pow"
+	"github.com/go-bumbu/userauth/internal/locale"
 )
 
 // JSON exposes a register.Flow as JSON endpoints. Use the preset constructor
@@ -28,9 +32,14 @@ import (
 //	mux.Handle("POST /api/register", j.RegisterHandler())
 //	mux.Handle("POST /api/register/verify", j.VerifyHandler())
 //	mux.Handle("POST /api/register/request-code", j.RequestCodeHandler())
+//	mux.Handle("GET /api/register/challenge", j.ChallengeHandler()) // with ProofOfWork
 type JSON struct {
 	Flow   *register.Flow
-	Logger *slog.Logger // optional; defaults to slog.Default()
+	Logger *slog.Logger    // optional; defaults to slog.Default()
+	CSRF   *csrf.Protector // optional; wraps every endpoint in its Middleware
+	// ProofOfWork issues the challenges served by ChallengeHandler; it must
+	// be the verifier of the flow's ProofOfWorkCheck.
+	ProofOfWork *pow.Service
 }
 
 // RegisterPayload is the request body for RegisterHandler.
@@ -39,6 +48,15 @@ type RegisterPayload struct {
 	Password   string `json:"password"`
 	Email      string `json:"email,omitempty"`      // required with email verification unless the username is the email
 	InviteCode string `json:"inviteCode,omitempty"` // required with invite gating
+	// Captcha is the CAPTCHA widget's response token; required with a
+	// CAPTCHA check.
+	Captcha string `json:"captcha,omitempty"`
+	// ProofOfWork is a solved challenge from ChallengeHandler; required
+	// with a proof-of-work check.
+	ProofOfWork string `json:"proofOfWork,omitempty"`
+	// Attributes are the extra fields declared in Flow.Attributes, by name.
+	// Values may be JSON strings, numbers or booleans.
+	Attributes map[string]json.RawMessage `json:"attributes,omitempty"`
 }
 
 // VerifyPayload is the request body for VerifyHandler.
@@ -64,6 +82,16 @@ type Response struct {
 	// Next lists the check IDs still pending; set when the submission was
 	// accepted but more checks are required.
 	Next []string `json:"next,omitempty"`
+	// Held is set with Done when the account awaits an admin's approval:
+	// it exists but cannot log in yet.
+	Held bool `json:"held,omitempty"`
+}
+
+// ChallengeResponse is the body of ChallengeHandler.
+type ChallengeResponse struct {
+	Challenge  string    `json:"challenge"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expiresAt"`
 }
 
 type errorResponse struct {
@@ -74,13 +102,14 @@ type errorResponse struct {
 //
 // Responses:
 //   - 200 {"done":true} — registration complete, account created
+//   - 200 {"done":true,"held":true} — account created, awaiting approval
 //   - 200 {"done":false,"next":["email"]} — accepted, verification pending
 //   - 409 {"error":"username taken"} — the login ID is in use
 //   - 400 {"error":"..."} — rejected input (password policy, login format, missing fields)
-//   - 401 {"error":"unauthorized"} — uniform for credential-shaped rejections (e.g. bad invite)
+//   - 401 {"error":"unauthorized"} — uniform for credential-shaped rejections (bad invite, CAPTCHA or proof of work)
 //   - 405 / 500 for wrong method and internal failures
 func (h *JSON) RegisterHandler() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return h.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var p RegisterPayload
 		if !h.decode(w, r, &p) {
 			return
@@ -89,14 +118,22 @@ func (h *JSON) RegisterHandler() http.Handler {
 			h.writeError(w, http.StatusBadRequest, "username and password are required")
 			return
 		}
-		res, err := h.Flow.Start(r, w, register.StartInput{
-			LoginID:    p.User,
-			Password:   p.Password,
-			Email:      p.Email,
-			InviteCode: p.InviteCode,
+		attrs, ok := attributeStrings(p.Attributes)
+		if !ok {
+			h.writeError(w, http.StatusBadRequest, "attributes must be strings, numbers or booleans")
+			return
+		}
+		res, err := h.Flow.Start(locale.FromRequest(r), w, register.StartInput{
+			LoginID:     p.User,
+			Password:    p.Password,
+			Email:       p.Email,
+			InviteCode:  p.InviteCode,
+			Captcha:     p.Captcha,
+			ProofOfWork: p.ProofOfWork,
+			Attributes:  attrs,
 		})
 		h.respond(w, res, err)
-	})
+	}))
 }
 
 // VerifyHandler returns the POST endpoint that submits a round-trip check,
@@ -105,7 +142,7 @@ func (h *JSON) RegisterHandler() http.Handler {
 // Responses mirror RegisterHandler; a wrong or expired code, a missing
 // pending registration and a replayed check all yield the same 401.
 func (h *JSON) VerifyHandler() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return h.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var p VerifyPayload
 		if !h.decode(w, r, &p) {
 			return
@@ -120,7 +157,7 @@ func (h *JSON) VerifyHandler() http.Handler {
 		}
 		res, err := h.Flow.VerifyCheck(r, w, p.User, p.Check, p.Code)
 		h.respond(w, res, err)
-	})
+	}))
 }
 
 // RequestCodeHandler returns the POST endpoint that re-requests delivery of
@@ -131,7 +168,7 @@ func (h *JSON) VerifyHandler() http.Handler {
 // logs failures server-side, so the endpoint cannot be used to probe which
 // registrations are in progress.
 func (h *JSON) RequestCodeHandler() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return h.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var p RequestCodePayload
 		if !h.decode(w, r, &p) {
 			return
@@ -148,13 +185,76 @@ func (h *JSON) RequestCodeHandler() http.Handler {
 			h.writeError(w, http.StatusBadRequest, "check does not support code delivery")
 			return
 		}
-		if err := h.Flow.Initiate(r, p.User, check); err != nil {
+		if err := h.Flow.Initiate(locale.FromRequest(r), p.User, check); err != nil {
 			h.logger().Error("json register: initiate failed", "check", check, "error", err)
 			h.writeError(w, http.StatusInternalServerError, "internal error")
 			return
 		}
 		h.writeJSON(w, http.StatusAccepted, struct{}{})
-	})
+	}))
+}
+
+// ChallengeHandler returns the GET endpoint that issues a proof-of-work
+// challenge. The client solves it for the username it registers (see package
+// pow) and sends the solution as proofOfWork. Challenges are stateless, so
+// the endpoint stores nothing.
+//
+// Responses:
+//   - 200 {"challenge":"...","difficulty":18,"expiresAt":"..."}
+//   - 404 when no ProofOfWork is configured
+//   - 405 / 500 for wrong method and internal failures
+func (h *JSON) ChallengeHandler() http.Handler {
+	return h.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.writeError(w, http.StatusMethodNotAllowed, "wrong method")
+			return
+		}
+		if h.ProofOfWork == nil {
+			h.writeError(w, http.StatusNotFound, "proof of work not enabled")
+			return
+		}
+		c, err := h.ProofOfWork.Issue()
+		if err != nil {
+			h.logger().Error("json register: issue challenge failed", "error", err)
+			h.writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		h.writeJSON(w, http.StatusOK, ChallengeResponse{Challenge: c.Token, Difficulty: c.Difficulty, ExpiresAt: c.ExpiresAt})
+	}))
+}
+
+// attributeStrings turns JSON scalars into the string values StartInput
+// carries: strings as they are, numbers and booleans by their literal, so
+// 42 and "42" are the same attribute value. Objects, arrays and null are
+// refused.
+func attributeStrings(in map[string]json.RawMessage) (map[string]string, bool) {
+	if len(in) == 0 {
+		return nil, true
+	}
+	out := make(map[string]string, len(in))
+	for name, raw := range in {
+		var v any
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, false
+		}
+		switch v := v.(type) {
+		case string:
+			out[name] = v
+		case float64, bool:
+			out[name] = string(raw)
+		default:
+			return nil, false
+		}
+	}
+	return out, true
+}
+
+// protect wraps next in the CSRF middleware when one is configured.
+func (h *JSON) protect(next http.Handler) http.Handler {
+	if h.CSRF == nil {
+		return next
+	}
+	return h.CSRF.Middleware(next)
 }
 
 func (h *JSON) logger() *slog.Logger {
@@ -224,7 +324,7 @@ func (h *JSON) respond(w http.ResponseWriter, res register.Result, err error) {
 		h.writeError(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
-	h.writeJSON(w, http.StatusOK, Response{Done: res.Done, Next: res.Next})
+	h.writeJSON(w, http.StatusOK, Response{Done: res.Done, Next: res.Next, Held: res.Held})
 }
 
 func (h *JSON) writeJSON(w http.ResponseWriter, status int, body any) {
@@ -7,26 +7,31 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
-	"time"
 
 	"github.com/go-bumbu/userauth"
 	"github.com/go-bumbu/userauth/flow/register"
+	"github.com/go-bumbu/userauth/flow/register/approval"
+	approvalmemory "github.com/go-bumbu/userauth/flow/register/approval/memory"
+	"github.com/go-bumbu/userauth/flow/register/emaildomain"
 	"github.com/go-bumbu/userauth/flow/register/handlers"
-	"github.com/go-bumbu/userauth/flow/register/invite"
-	invitememory "github.com/go-bumbu/userauth/flow/register/invite/memory"
 	"github.com/go-bumbu/userauth/flow/register/pendingstore/memory"
+	"github.com/go-bumbu/userauth/flow/register/pow"
+	"github.com/go-bumbu/userauth/service/invite"
+	invitememory "github.com/go-bumbu/userauth/service/invite/memory"
 	"github.com/go-bumbu/userauth/service/verificationcode"
 	csmemory "github.com/go-bumbu/userauth/service/verificationcode/store/memory"
+	"github.com/google/go-cmp/cmp"
 )
 
 // fakeUsers is a UserGetter over a mutable set of login IDs.
 type fakeUsers struct {
 	existing map[string]bool
+	disabled map[string]bool
 }
 
 func (u *fakeUsers) GetUser(id string) (userauth.User, error) {
 	if u.existing[id] {
-		return userauth.User{ID: id, LoginID: id, Enabled: true}, nil
+		return userauth.User{ID: id, LoginID: id, Enabled: !u.disabled[id]}, nil
 	}
 	return userauth.User{}, userauth.ErrUserNotFound
 }
@@ -35,13 +40,17 @@ func (u *fakeUsers) GetUserByLogin(loginID string) (userauth.User, error) {
 	return u.GetUser(loginID)
 }
 
-// captureCreator records created users.
+// captureCreator records created users and makes them visible in the user
+// store.
 type captureCreator struct {
 	users []register.NewUser
+	store *fakeUsers
 }
 
 func (c *captureCreator) CreateVerifiedUser(u register.NewUser) error {
 	c.users = append(c.users, u)
+	c.store.existing[u.LoginID] = true
+	c.store.disabled[u.LoginID] = u.Disabled
 	return nil
 }
 
@@ -50,8 +59,8 @@ type captureDeliverer struct {
 	code string
 }
 
-func (d *captureDeliverer) Deliver(_ context.Context, _ string, code string, _ time.Time) error {
-	d.code = code
+func (d *captureDeliverer) Deliver(_ context.Context, msg verificationcode.Message) error {
+	d.code = msg.Code
 	return nil
 }
 
@@ -64,9 +73,10 @@ type fixture struct {
 }
 
 func newFixture(mod func(*fixture, *handlers.Cfg)) *fixture {
+	users := &fakeUsers{existing: map[string]bool{"taken": true}, disabled: map[string]bool{}}
 	f := &fixture{
-		users:     &fakeUsers{existing: map[string]bool{"taken": true}},
-		creator:   &captureCreator{},
+		users:     users,
+		creator:   &captureCreator{store: users},
 		deliverer: &captureDeliverer{},
 		invites:   invite.New(invitememory.New(), invite.Opts{}),
 	}
@@ -335,3 +345,172 @@ func TestCombinedInviteAndEmail(t *testing.T) {
 		t.Error("want invite consumed")
 	}
 }
+
+// nopEnabler satisfies approval.Enabler; approving is not under test here.
+type nopEnabler struct{}
+
+func (nopEnabler) SetEnabled(string, bool) error { return nil }
+
+func TestApprovalHeld(t *testing.T) {
+	approvals := approval.New(approvalmemory.New(), nopEnabler{}, approval.Opts{})
+	f := newFixture(func(_ *fixture, cfg *handlers.Cfg) {
+		cfg.Approvals = approvals
+	})
+
+	status, body := post(t, f.json.RegisterHandler(), map[string]string{"username": "alice", "password": "pw"})
+	if status != http.StatusOK || body["done"] != true || body["held"] != true {
+		t.Fatalf("want 200 done+held, got %d %v", status, body)
+	}
+	if len(f.creator.users) != 1 || !f.creator.users[0].Disabled {
+		t.Fatalf("want one account created disabled, got %+v", f.creator.users)
+	}
+	pending, err := approvals.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].LoginID != "alice" {
+		t.Errorf("want alice awaiting approval, got %+v", pending)
+	}
+}
+
+func TestProofOfWork(t *testing.T) {
+	svc, err := pow.New([]byte("0123456789abcdef0123456789abcdef"), pow.Opts{Difficulty: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := newFixture(func(_ *fixture, cfg *handlers.Cfg) {
+		cfg.ProofOfWork = svc
+	})
+
+	rec := httptest.NewRecorder()
+	f.json.ChallengeHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/challenge", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("challenge status = %d: %s", rec.Code, rec.Body)
+	}
+	var c handlers.ChallengeResponse
+	if err := json.NewDecoder(rec.Body).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Challenge == "" || c.Difficulty != 8 || c.ExpiresAt.IsZero() {
+		t.Fatalf("unexpected challenge %+v", c)
+	}
+
+	status, _ := post(t, f.json.RegisterHandler(), map[string]string{"username": "alice", "password": "pw"})
+	if status != http.StatusUnauthorized {
+		t.Fatalf("without a solution: status = %d, want 401", status)
+	}
+	status, body := post(t, f.json.RegisterHandler(), map[string]string{
+		"username": "alice", "password": "pw", "proofOfWork": pow.Solve(c.Challenge, c.Difficulty, "alice"),
+	})
+	if status != http.StatusOK || body["done"] != true {
+		t.Fatalf("with a solution: want 200 done, got %d %v", status, body)
+	}
+}
+
+func TestChallengeHandlerErrors(t *testing.T) {
+	f := newFixture(nil)
+	rec := httptest.NewRecorder()
+	f.json.ChallengeHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/challenge", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("without ProofOfWork: status = %d, want 404", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	f.json.ChallengeHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/challenge", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status = %d, want 405", rec.Code)
+	}
+}
+
+// captchaFunc adapts a function to register.CaptchaVerifier.
+type captchaFunc func(token, remoteIP string) bool
+
+func (f captchaFunc) VerifyCaptcha(_ context.Context, token, remoteIP string) (bool, error) {
+	return f(token, remoteIP), nil
+}
+
+func TestCaptcha(t *testing.T) {
+	var gotIP string
+	f := newFixture(func(_ *fixture, cfg *handlers.Cfg) {
+		cfg.Captcha = captchaFunc(func(token, remoteIP string) bool {
+			gotIP = remoteIP
+			return token == "solved"
+		})
+	})
+	status, _ := post(t, f.json.RegisterHandler(), map[string]string{"username": "alice", "password": "pw", "captcha": "bot"})
+	if status != http.StatusUnauthorized {
+		t.Fatalf("refused captcha: status = %d, want 401", status)
+	}
+	status, body := post(t, f.json.RegisterHandler(), map[string]string{"username": "alice", "password": "pw", "captcha": "solved"})
+	if status != http.StatusOK || body["done"] != true {
+		t.Fatalf("solved captcha: want 200 done, got %d %v", status, body)
+	}
+	if gotIP != "192.0.2.1" {
+		t.Errorf("remote IP = %q, want the request's", gotIP)
+	}
+}
+
+func TestEmailDomainRefused(t *testing.T) {
+	policy, err := emaildomain.New(emaildomain.Config{BlockDisposable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := newFixture(func(_ *fixture, cfg *handlers.Cfg) {
+		cfg.EmailDomains = policy
+	})
+	status, body := post(t, f.json.RegisterHandler(), map[string]string{"username": "alice", "password": "pw", "email": "alice@mailinator.com"})
+	if status != http.StatusBadRequest || body["error"] != "email address not accepted" {
+		t.Fatalf("disposable email: want 400 with message, got %d %v", status, body)
+	}
+	status, body = post(t, f.json.RegisterHandler(), map[string]string{"username": "alice", "password": "pw", "email": "alice@example.com"})
+	if status != http.StatusOK || body["done"] != true {
+		t.Fatalf("regular email: want 200 done, got %d %v", status, body)
+	}
+}
+
+func TestRegisterAttributes(t *testing.T) {
+	schema := register.AttributeSchema{
+		{Name: "displayName", Required: true},
+		{Name: "age", Type: register.AttrInt},
+		{Name: "newsletter", Type: register.AttrBool},
+	}
+	tcs := []struct {
+		name       string
+		attributes any
+		wantStatus int
+		want       map[string]string
+	}{
+		{
+			name:       "scalars become canonical strings",
+			attributes: map[string]any{"displayName": "Alice", "age": 42, "newsletter": true},
+			wantStatus: http.StatusOK,
+			want:       map[string]string{"displayName": "Alice", "age": "42", "newsletter": "true"},
+		},
+		{name: "missing required", attributes: map[string]any{"age": 42}, wantStatus: http.StatusBadRequest},
+		{name: "unknown attribute", attributes: map[string]any{"displayName": "A", "role": "admin"}, wantStatus: http.StatusBadRequest},
+		{name: "fractional int", attributes: map[string]any{"displayName": "A", "age": 4.2}, wantStatus: http.StatusBadRequest},
+		{name: "nested value", attributes: map[string]any{"displayName": []string{"A"}}, wantStatus: http.StatusBadRequest},
+		{name: "null value", attributes: map[string]any{"displayName": nil}, wantStatus: http.StatusBadRequest},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFixture(func(_ *fixture, cfg *handlers.Cfg) {
+				cfg.Attributes = schema
+			})
+			status, body := post(t, f.json.RegisterHandler(), map[string]any{
+				"username": "alice", "password": "pw", "attributes": tc.attributes,
+			})
+			if status != tc.wantStatus {
+				t.Fatalf("status = %d, want %d: %v", status, tc.wantStatus, body)
+			}
+			if tc.wantStatus != http.StatusOK {
+				if len(f.creator.users) != 0 {
+					t.Fatal("user must not be created")
+				}
+				return
+			}
+			if diff := cmp.Diff(tc.want, f.creator.users[0].Attributes); diff != "" {
+				t.Errorf("attributes mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
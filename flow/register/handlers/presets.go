@@ -2,10 +2,13 @@ package handlers
 
 import (
 	"log/slog"
+	"net/netip"
 	"time"
 
 	"github.com/go-bumbu/userauth"
+	"github.com/go-bumbu/userauth/auth/csrf"
 	"github.com/go-bumbu/userauth/flow/register"
+	"github.com/go-bumbu/userauth/flow/register/pow"
 	"github.com/go-bumbu/userauth/service/verificationcode"
 )
 
@@ -14,7 +17,10 @@ import (
 //
 //   - Codes + Deliver enable email verification (requires Pending)
 //   - Invites enables invite-code gating
-//   - neither: open registration
+//   - Approvals holds new accounts, created disabled, for an admin
+//   - Captcha and ProofOfWork add bot protection at submission
+//   - EmailDomains restricts which email domains may register
+//   - none of them: open registration
 type Cfg struct {
 	Users   userauth.UserGetter   // required: login ID availability
 	Creator register.UserCreator  // required: creates the account
@@ -31,24 +37,70 @@ type Cfg struct {
 	// satisfies this). Nil disables invite gating.
 	Invites register.InviteConsumer
 
+	// Approvals holds every new account for an admin's approval
+	// (*approval.Service satisfies this); Creator must honour
+	// NewUser.Disabled. Nil creates accounts enabled.
+	Approvals register.ApprovalHolder
+	// Enabler disables a held account that Creator left enabled
+	// (userdb.Store satisfies this); see register.Flow.Enabler.
+	Enabler register.Enabler
+
+	// Captcha requires a solved CAPTCHA with every submission
+	// (*captcha.Verifier satisfies this). Nil disables it.
+	Captcha register.CaptchaVerifier
+	// ProofOfWork requires a solved proof-of-work challenge with every
+	// submission and serves the challenges (JSON.ChallengeHandler). Nil
+	// disables it.
+	ProofOfWork *pow.Service
+	// EmailDomains decides which email addresses may register
+	// (*emaildomain.Policy satisfies this); the email becomes required.
+	// Nil admits any.
+	EmailDomains register.EmailPolicy
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For is
+	// believed for the client IP passed to the CAPTCHA provider.
+	TrustedProxies []netip.Prefix
+
+	// Attributes declares the extra fields RegisterHandler accepts and
+	// passes on to Creator in NewUser.Attributes.
+	Attributes register.AttributeSchema
+
 	Password       register.PasswordValidator // optional; default requires non-empty
 	UsernameFormat userauth.UsernameFormat
 	Session        register.SessionCreator // optional: auto-login after registration
 	Expiry         time.Duration           // pending lifetime; default register.DefaultPendingExpiry
-	Logger         *slog.Logger
+	// CSRF optionally guards the endpoints against cross-site request
+	// forgery. When Session logs the new user in, the session — and with it
+	// the token — is replaced.
+	CSRF   *csrf.Protector
+	Logger *slog.Logger
 }
 
 // New returns JSON endpoints for self-registration, composing the checks
 // from what is configured: open registration, email verification, invite
-// gating, or both.
+// gating, admin approval, bot protection and email domain policy, in any
+// combination. Bot protection runs first, the cheap local proof of work
+// before the CAPTCHA provider, so bots never reach the email policy's DNS
+// lookups.
 func New(cfg Cfg) *JSON {
 	var checks []register.Check
+	if cfg.ProofOfWork != nil {
+		checks = append(checks, register.ProofOfWorkCheck{Verifier: cfg.ProofOfWork})
+	}
+	if cfg.Captcha != nil {
+		checks = append(checks, register.CaptchaCheck{Verifier: cfg.Captcha})
+	}
+	if cfg.EmailDomains != nil {
+		checks = append(checks, register.EmailDomainCheck{Policy: cfg.EmailDomains})
+	}
 	if cfg.Invites != nil {
 		checks = append(checks, register.InviteCheck{Invites: cfg.Invites})
 	}
 	if cfg.Codes != nil {
 		checks = append(checks, register.EmailCheck{Codes: cfg.Codes, Deliver: cfg.Deliver})
 	}
+	if cfg.Approvals != nil {
+		checks = append(checks, register.ApprovalCheck{Approvals: cfg.Approvals})
+	}
 	return &JSON{
 		Flow: &register.Flow{
 			Users:          cfg.Users,
@@ -57,10 +109,15 @@ func New(cfg Cfg) *JSON {
 			Pending:        cfg.Pending,
 			Password:       cfg.Password,
 			UsernameFormat: cfg.UsernameFormat,
+			Attributes:     cfg.Attributes,
 			Session:        cfg.Session,
+			Enabler:        cfg.Enabler,
 			Expiry:         cfg.Expiry,
+			TrustedProxies: cfg.TrustedProxies,
 			Logger:         cfg.Logger,
 		},
-		Logger: cfg.Logger,
+		CSRF:        cfg.CSRF,
+		Logger:      cfg.Logger,
+		ProofOfWork: cfg.ProofOfWork,
 	}
 }
@@ -37,6 +37,7 @@ type cookieData struct {
 	InviteCode string
 	Satisfied  []string
 	ExpiresAt  time.Time
+	Attributes map[string]string
 }
 
 // Store is a cookie-based pending registration store. Data is signed and
@@ -72,6 +73,7 @@ func (s *Store) Set(_ *http.Request, w http.ResponseWriter, reg register.Registr
 		InviteCode: reg.InviteCode,
 		Satisfied:  reg.Satisfied,
 		ExpiresAt:  reg.ExpiresAt,
+		Attributes: reg.Attributes,
 	})
 	if err != nil {
 		return fmt.Errorf("pending registration cookie encode: %w", err)
@@ -110,6 +112,7 @@ func (s *Store) Get(r *http.Request, loginID string) (register.Registration, err
 		InviteCode: data.InviteCode,
 		Satisfied:  data.Satisfied,
 		ExpiresAt:  data.ExpiresAt,
+		Attributes: data.Attributes,
 	}, nil
 }
 
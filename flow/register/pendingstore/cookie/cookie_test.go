@@ -47,6 +47,7 @@ func TestStore(t *testing.T) {
 			InviteCode: "inv123",
 			Satisfied:  []string{"invite"},
 			ExpiresAt:  time.Now().Add(5 * time.Minute),
+			Attributes: map[string]string{"displayName": "Alice", "newsletter": "true"},
 		}
 		if err := store.Set(r, w, reg); err != nil {
 			t.Fatal(err)
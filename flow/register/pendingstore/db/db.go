@@ -4,6 +4,7 @@
 package db
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -24,6 +25,7 @@ type registrationModel struct {
 	InviteCode string
 	Satisfied  string    // JSON-encoded []string of verified check IDs
 	ExpiresAt  time.Time `gorm:"not null"`
+	Attributes string    // JSON-encoded map[string]string; empty without attributes
 }
 
 func (registrationModel) TableName() string { return "pending_registrations" }
@@ -50,6 +52,12 @@ func (s *Store) Set(_ *http.Request, _ http.ResponseWriter, reg register.Registr
 	if err != nil {
 		return fmt.Errorf("pending registration encode satisfied: %w", err)
 	}
+	var attributes []byte
+	if len(reg.Attributes) > 0 {
+		if attributes, err = json.Marshal(reg.Attributes); err != nil {
+			return fmt.Errorf("pending registration encode attributes: %w", err)
+		}
+	}
 	var m registrationModel
 	err = s.db.Where("login_id = ?", reg.LoginID).First(&m).Error
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
@@ -61,6 +69,7 @@ func (s *Store) Set(_ *http.Request, _ http.ResponseWriter, reg register.Registr
 	m.InviteCode = reg.InviteCode
 	m.Satisfied = string(satisfied)
 	m.ExpiresAt = reg.ExpiresAt
+	m.Attributes = string(attributes)
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return s.db.Create(&m).Error
 	}
@@ -88,6 +97,12 @@ func (s *Store) Get(_ *http.Request, loginID string) (register.Registration, err
 			return register.Registration{}, fmt.Errorf("pending registration decode satisfied: %w", err)
 		}
 	}
+	var attributes map[string]string
+	if m.Attributes != "" {
+		if err := json.Unmarshal([]byte(m.Attributes), &attributes); err != nil {
+			return register.Registration{}, fmt.Errorf("pending registration decode attributes: %w", err)
+		}
+	}
 	return register.Registration{
 		LoginID:    m.LoginID,
 		PassHash:   m.PassHash,
@@ -95,6 +110,7 @@ func (s *Store) Get(_ *http.Request, loginID string) (register.Registration, err
 		InviteCode: m.InviteCode,
 		Satisfied:  satisfied,
 		ExpiresAt:  m.ExpiresAt,
+		Attributes: attributes,
 	}, nil
 }
 
@@ -102,3 +118,10 @@ func (s *Store) Get(_ *http.Request, loginID string) (register.Registration, err
 func (s *Store) Clear(_ *http.Request, _ http.ResponseWriter, loginID string) error {
 	return s.db.Where("login_id = ?", loginID).Delete(&registrationModel{}).Error
 }
+
+// Sweep permanently deletes expired pending registrations, including rows
+// Clear has already soft-deleted.
+func (s *Store) Sweep(ctx context.Context) (int, error) {
+	res := s.db.WithContext(ctx).Unscoped().Where("expires_at < ?", time.Now()).Delete(&registrationModel{})
+	return int(res.RowsAffected), res.Error
+}
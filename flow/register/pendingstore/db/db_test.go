@@ -1,6 +1,7 @@
 package db_test
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -41,6 +42,7 @@ func TestStore(t *testing.T) {
 			InviteCode: "inv123",
 			Satisfied:  []string{"invite"},
 			ExpiresAt:  time.Now().Add(5 * time.Minute),
+			Attributes: map[string]string{"displayName": "Alice", "newsletter": "true"},
 		}
 		if err := store.Set(r, w, reg); err != nil {
 			t.Fatal(err)
@@ -119,3 +121,28 @@ func TestStore(t *testing.T) {
 		}
 	})
 }
+
+func TestSweep(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	w := httptest.NewRecorder()
+	store := newTestStore(t)
+	_ = store.Set(r, w, register.Registration{LoginID: "alice", ExpiresAt: time.Now().Add(time.Minute)})
+	_ = store.Set(r, w, register.Registration{LoginID: "bob", ExpiresAt: time.Now().Add(-time.Minute)})
+	// cleared rows are only soft-deleted; the sweep purges them once expired
+	_ = store.Set(r, w, register.Registration{LoginID: "carol", ExpiresAt: time.Now().Add(-time.Minute)})
+	_ = store.Clear(r, w, "carol")
+
+	n, err := store.Sweep(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("removed %d registrations, want 2", n)
+	}
+	if _, err := store.Get(r, "alice"); err != nil {
+		t.Errorf("live registration must survive the sweep: %v", err)
+	}
+	if _, err := store.Get(r, "bob"); !errors.Is(err, pendingdb.ErrRegistrationNotFound) {
+		t.Errorf("want ErrRegistrationNotFound after the sweep, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@
 package memory
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"sync"
@@ -53,3 +54,21 @@ func (m *Store) Clear(_ *http.Request, _ http.ResponseWriter, loginID string) er
 	delete(m.store, loginID)
 	return nil
 }
+
+// Sweep removes expired pending registrations.
+func (m *Store) Sweep(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for id, reg := range m.store {
+		if now.After(reg.ExpiresAt) {
+			delete(m.store, id)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -1,6 +1,7 @@
 package memory_test
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -25,6 +26,7 @@ func TestStore(t *testing.T) {
 			InviteCode: "inv123",
 			Satisfied:  []string{"invite"},
 			ExpiresAt:  time.Now().Add(5 * time.Minute),
+			Attributes: map[string]string{"displayName": "Alice", "newsletter": "true"},
 		}
 		if err := store.Set(r, w, reg); err != nil {
 			t.Fatal(err)
@@ -90,3 +92,25 @@ func TestStore(t *testing.T) {
 		}
 	})
 }
+
+func TestSweep(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	w := httptest.NewRecorder()
+	store := memory.New()
+	_ = store.Set(r, w, register.Registration{LoginID: "alice", ExpiresAt: time.Now().Add(time.Minute)})
+	_ = store.Set(r, w, register.Registration{LoginID: "bob", ExpiresAt: time.Now().Add(-time.Minute)})
+
+	n, err := store.Sweep(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("removed %d registrations, want 1", n)
+	}
+	if _, err := store.Get(r, "alice"); err != nil {
+		t.Errorf("live registration must survive the sweep: %v", err)
+	}
+	if _, err := store.Get(r, "bob"); !errors.Is(err, memory.ErrRegistrationNotFound) {
+		t.Errorf("want ErrRegistrationNotFound after the sweep, got %v", err)
+	}
+}
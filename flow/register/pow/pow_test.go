@@ -0,0 +1,155 @@
+package pow_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"math/bits"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-bumbu/userauth/flow/register/pow"
+)
+
+var key = []byte("0123456789abcdef0123456789abcdef")
+
+// newService returns a Service with a difficulty low enough for fast tests.
+func newService(t *testing.T, opts pow.Opts) *pow.Service {
+	t.Helper()
+	if opts.Difficulty == 0 {
+		opts.Difficulty = 8
+	}
+	s, err := pow.New(key, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func issue(t *testing.T, s *pow.Service) pow.Challenge {
+	t.Helper()
+	c, err := s.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// solveFor issues challenges until the solution for loginID happens not to
+// solve it for other as well (a 1 in 2^difficulty chance), so that tests
+// rejecting the other login are deterministic.
+func solveFor(t *testing.T, s *pow.Service, loginID, other string) (pow.Challenge, string) {
+	t.Helper()
+	for {
+		c := issue(t, s)
+		solution := pow.Solve(c.Token, c.Difficulty, loginID)
+		ok, err := s.VerifySolution(solution, other)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			return c, solution
+		}
+	}
+}
+
+// failingCounter returns a solution for token and loginID whose hash has
+// fewer than difficulty leading zero bits.
+func failingCounter(token, loginID string, difficulty int) string {
+	for n := 0; ; n++ {
+		counter := strconv.Itoa(n)
+		sum := sha256.Sum256([]byte(token + ":" + loginID + ":" + counter))
+		if bits.LeadingZeros8(sum[0]) < min(difficulty, 8) {
+			return token + ":" + counter
+		}
+	}
+}
+
+func TestVerifySolution(t *testing.T) {
+	s := newService(t, pow.Opts{})
+	c, solved := solveFor(t, s, "alice", "bob")
+	if c.Difficulty != 8 || time.Until(c.ExpiresAt) <= 0 {
+		t.Fatalf("unexpected challenge %+v", c)
+	}
+	payload, sig, _ := strings.Cut(c.Token, ".")
+	raw, _ := base64.RawURLEncoding.DecodeString(payload)
+	raw[len(raw)-1] = 0 // claim difficulty 0
+	forged := base64.RawURLEncoding.EncodeToString(raw) + "." + sig
+
+	other, err := pow.New([]byte("another key, another key, another"), pow.Opts{Difficulty: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign := issue(t, other)
+
+	tcs := []struct {
+		name     string
+		solution string
+		loginID  string
+		want     bool
+	}{
+		{name: "solved", solution: solved, loginID: "alice", want: true},
+		{name: "solved for another login", solution: solved, loginID: "bob"},
+		{name: "insufficient work", solution: failingCounter(c.Token, "alice", c.Difficulty), loginID: "alice"},
+		{name: "forged difficulty", solution: forged + ":0", loginID: "alice"},
+		{name: "other key", solution: pow.Solve(foreign.Token, foreign.Difficulty, "alice"), loginID: "alice"},
+		{name: "leading zero counter", solution: strings.Replace(solved, ":", ":0", 1), loginID: "alice"},
+		{name: "no counter", solution: c.Token, loginID: "alice"},
+		{name: "garbage", solution: "not.a:1", loginID: "alice"},
+		{name: "empty", loginID: "alice"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := s.VerifySolution(tc.solution, tc.loginID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("VerifySolution() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestVerifySolutionExpired(t *testing.T) {
+	s := newService(t, pow.Opts{Expiry: 10 * time.Millisecond})
+	c := issue(t, s)
+	solution := pow.Solve(c.Token, c.Difficulty, "alice")
+	time.Sleep(20 * time.Millisecond)
+	if ok, _ := s.VerifySolution(solution, "alice"); ok {
+		t.Error("want an expired challenge refused")
+	}
+}
+
+func TestIssueIsUnique(t *testing.T) {
+	s := newService(t, pow.Opts{})
+	if a, b := issue(t, s), issue(t, s); a.Token == b.Token {
+		t.Error("want distinct challenges")
+	}
+}
+
+func TestNew(t *testing.T) {
+	tcs := []struct {
+		name string
+		key  []byte
+		opts pow.Opts
+	}{
+		{name: "short key", key: key[:31]},
+		{name: "difficulty too high", key: key, opts: pow.Opts{Difficulty: pow.MaxDifficulty + 1}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := pow.New(tc.key, tc.opts); err == nil {
+				t.Error("want error")
+			}
+		})
+	}
+	s, err := pow.New(key, pow.Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := issue(t, s); c.Difficulty != pow.DefaultDifficulty {
+		t.Errorf("default difficulty = %d, want %d", c.Difficulty, pow.DefaultDifficulty)
+	}
+}
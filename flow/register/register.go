@@ -23,14 +23,17 @@
 package register
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"strings"
 	"time"
 
 	"github.com/go-bumbu/userauth"
+	"github.com/go-bumbu/userauth/internal/clientip"
 	"github.com/go-bumbu/userauth/internal/hashutil"
 )
 
@@ -53,6 +56,9 @@ type Registration struct {
 	InviteCode string   // consumed at account creation; empty without invite check
 	Satisfied  []string // check IDs verified so far
 	ExpiresAt  time.Time
+	// Attributes are the validated extra fields (Flow.Attributes), handed
+	// to the UserCreator at creation.
+	Attributes map[string]string
 }
 
 // PendingStore persists registrations between check submissions.
@@ -69,6 +75,19 @@ type NewUser struct {
 	PasswordHash  string // bcrypt hash from hashutil
 	Email         string
 	EmailVerified bool // true when the email check ran
+	// Disabled asks for the account to be created disabled: a Holder check
+	// (admin approval) releases it later. Login rejects disabled users.
+	Disabled bool
+	// Attributes are the extra fields collected at registration, canonical
+	// per Flow.Attributes, plus any a Provisioner granted; nil when none
+	// were set.
+	Attributes map[string]string
+	// Groups are the initial group memberships a Provisioner granted (e.g.
+	// an invite's groups); nil when none.
+	Groups []string
+	// InvitedBy is the user ID of the user whose referral invite created
+	// the account; empty otherwise.
+	InvitedBy string
 }
 
 // UserCreator creates the final account from a completed registration. The
@@ -107,13 +126,55 @@ type InviteConsumer interface {
 	Consume(code, email string) (bool, error)
 }
 
+// InviteRedeemer is the richer side of InviteConsumer. Redeem consumes
+// like Consume, records loginID as having accepted the invite and returns
+// the groups and attributes the invite grants the new account, and the
+// user who issued it when it is a referral. *invite.Service satisfies this;
+// InviteCheck uses it when available.
+type InviteRedeemer interface {
+	Redeem(code, email, loginID string) (groups []string, attributes map[string]string, invitedBy string, ok bool, err error)
+}
+
+// CaptchaVerifier checks a CAPTCHA response token with its provider.
+// *captcha.Verifier satisfies this. remoteIP may be empty. Like Check.Verify,
+// it returns (false, nil) for a rejected token and reserves errors for
+// failing to reach a verdict.
+type CaptchaVerifier interface {
+	VerifyCaptcha(ctx context.Context, token, remoteIP string) (bool, error)
+}
+
+// ProofOfWorkVerifier checks a solved proof-of-work challenge for the login
+// ID it was solved for. *pow.Service satisfies this.
+type ProofOfWorkVerifier interface {
+	VerifySolution(solution, loginID string) (bool, error)
+}
+
+// EmailPolicy decides whether an email address may register.
+// *emaildomain.Policy satisfies this. A refused address is (false, nil).
+type EmailPolicy interface {
+	AllowEmail(ctx context.Context, email string) (bool, error)
+}
+
+// ApprovalHolder records an account that awaits an admin's approval.
+// *approval.Service satisfies this. The context carries the registration
+// request's locale for the later notice (verificationcode.WithLocale).
+type ApprovalHolder interface {
+	Hold(ctx context.Context, userID, loginID, email string) error
+}
+
+// Enabler disables an account that a UserCreator created enabled despite
+// NewUser.Disabled. userdb.Store satisfies this.
+type Enabler interface {
+	SetEnabled(userID string, enabled bool) error
+}
+
 // ErrUserExists reports that the login ID is already taken. Transports
 // should render it as a conflict ("username taken") — registration is
 // deliberately not enumeration-safe, see the package comment.
 var ErrUserExists = errors.New("register: user already exists")
 
 // ValidationError is a user-input rejection (password policy, login ID
-// format, missing fields). Transports render Msg to the user as a 400.
+// format, missing fields, refused email domain). Transports render Msg to the user as a 400.
 type ValidationError struct {
 	Msg string
 }
@@ -129,6 +190,9 @@ type Result struct {
 	OK   bool     // the submission was accepted
 	Done bool     // all checks passed; the account has been created
 	Next []string // when OK && !Done: check IDs still pending
+	// Held is set with Done when a Holder check created the account
+	// disabled: it exists, but the user cannot log in until released.
+	Held bool
 }
 
 // StartInput is the first submission of a registration.
@@ -137,6 +201,15 @@ type StartInput struct {
 	Password   string // plaintext; hashed by Start, never stored
 	Email      string // defaults to LoginID when the username format is email
 	InviteCode string
+	Captcha    string // CAPTCHA widget response token (CaptchaCheck)
+	// ProofOfWork is a solved challenge (ProofOfWorkCheck).
+	ProofOfWork string
+	// ClientIP is set by Start from the request (Flow.TrustedProxies);
+	// whatever the transport puts here is overwritten.
+	ClientIP netip.Addr
+	// Attributes are extra fields by name, validated against
+	// Flow.Attributes.
+	Attributes map[string]string
 }
 
 // Flow is the registration engine. Users and Creator are required.
@@ -153,8 +226,17 @@ type Flow struct {
 	Password       PasswordValidator   // optional; default requires non-empty
 	UsernameFormat userauth.UsernameFormat
 	Session        SessionCreator // optional: auto-login after creation
-	Expiry         time.Duration  // pending lifetime; defaults to DefaultPendingExpiry
-	Logger         *slog.Logger   // optional; defaults to slog.Default()
+	// Enabler disables a held account that the Creator left enabled. Without
+	// it, such an account is only refused and stays enabled.
+	Enabler Enabler
+	Expiry  time.Duration // pending lifetime; defaults to DefaultPendingExpiry
+	// Attributes declares the extra fields accepted at Start; without it,
+	// any submitted attribute is rejected.
+	Attributes AttributeSchema
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For is
+	// believed when resolving StartInput.ClientIP. Empty trusts none.
+	TrustedProxies []netip.Prefix
+	Logger         *slog.Logger // optional; defaults to slog.Default()
 }
 
 func (f *Flow) logger() *slog.Logger {
@@ -175,7 +257,7 @@ func (f *Flow) check() error {
 	if f.Users == nil || f.Creator == nil {
 		return errors.New("register: Users and Creator are required")
 	}
-	return nil
+	return f.Attributes.valid()
 }
 
 func (f *Flow) checkByID(id string) Check {
@@ -235,7 +317,7 @@ func (f *Flow) validateStart(in *StartInput) error {
 	if f.UsernameFormat == userauth.UsernameFormatEmail && in.Email == "" {
 		in.Email = in.LoginID
 	}
-	if in.Email == "" && f.checkByID(CheckEmail) != nil {
+	if in.Email == "" && (f.checkByID(CheckEmail) != nil || f.checkByID(CheckEmailDomain) != nil) {
 		return &ValidationError{Msg: "email is required"}
 	}
 
@@ -250,6 +332,11 @@ func (f *Flow) validateStart(in *StartInput) error {
 	if err := f.validatePassword(in.Password); err != nil {
 		return &ValidationError{Msg: err.Error()}
 	}
+	attrs, err := f.Attributes.Check(in.Attributes)
+	if err != nil {
+		return err
+	}
+	in.Attributes = attrs
 	return nil
 }
 
@@ -273,6 +360,7 @@ func (f *Flow) Start(r *http.Request, w http.ResponseWriter, in StartInput) (Res
 	if err := f.validateStart(&in); err != nil {
 		return Result{}, err
 	}
+	in.ClientIP = clientip.Resolve(r, f.TrustedProxies)
 
 	// Pre-verifiable checks (e.g. invite code) run against the input itself;
 	// any failure is credential-shaped and rejected uniformly.
@@ -282,7 +370,7 @@ func (f *Flow) Start(r *http.Request, w http.ResponseWriter, in StartInput) (Res
 		if !isPre {
 			continue
 		}
-		ok, err := pre.PreVerify(in)
+		ok, err := pre.PreVerify(r.Context(), in)
 		if err != nil {
 			return Result{}, fmt.Errorf("register: pre-verify %s: %w", c.ID(), err)
 		}
@@ -304,6 +392,7 @@ func (f *Flow) Start(r *http.Request, w http.ResponseWriter, in StartInput) (Res
 		InviteCode: in.InviteCode,
 		Satisfied:  satisfied,
 		ExpiresAt:  time.Now().Add(f.expiry()),
+		Attributes: in.Attributes,
 	}
 
 	next := f.remaining(reg.Satisfied)
@@ -422,13 +511,16 @@ func (f *Flow) Initiate(r *http.Request, loginID, checkID string) error {
 
 // finish is the single place an account is created. It re-checks login ID
 // availability (the pending window is a race), runs every Finalizer (e.g.
-// atomically consuming the invite), creates the user, optionally logs them
-// in, and clears the pending registration.
+// atomically consuming the invite), creates the user, hands a held account
+// to its Holders or else optionally logs the user in, and clears the pending
+// registration.
 //
 // A Finalizer returning false (invite exhausted or revoked while pending)
 // aborts with Result{OK: false} and clears the pending registration — the
 // user must start over. A session failure after creation is logged but still
-// reported as Done: the account exists and the user can log in normally.
+// reported as Done: the account exists and the user can log in normally. A
+// Holder failure is returned: the account then exists disabled with nobody
+// asked to release it, which an operator has to notice.
 func (f *Flow) finish(r *http.Request, w http.ResponseWriter, reg Registration) (Result, error) {
 	exists, err := f.userExists(reg.LoginID)
 	if err != nil {
@@ -439,14 +531,26 @@ func (f *Flow) finish(r *http.Request, w http.ResponseWriter, reg Registration)
 		return Result{}, ErrUserExists
 	}
 
+	u := NewUser{
+		LoginID:       reg.LoginID,
+		PasswordHash:  reg.PassHash,
+		Email:         reg.Email,
+		EmailVerified: contains(reg.Satisfied, CheckEmail),
+		Attributes:    reg.Attributes,
+	}
+
 	// Finalizers run before creation: consuming an invite past its limit is
 	// worse than burning one use on a failed creation.
 	for _, c := range f.Checks {
-		fin, isFin := c.(Finalizer)
-		if !isFin {
+		var ok bool
+		var err error
+		if prov, isProv := c.(Provisioner); isProv {
+			u, ok, err = prov.Provision(reg, u)
+		} else if fin, isFin := c.(Finalizer); isFin {
+			ok, err = fin.Finalize(reg)
+		} else {
 			continue
 		}
-		ok, err := fin.Finalize(reg)
 		if err != nil {
 			return Result{}, fmt.Errorf("register: finalize %s: %w", c.ID(), err)
 		}
@@ -457,12 +561,15 @@ func (f *Flow) finish(r *http.Request, w http.ResponseWriter, reg Registration)
 		}
 	}
 
-	if err := f.Creator.CreateVerifiedUser(NewUser{
-		LoginID:       reg.LoginID,
-		PasswordHash:  reg.PassHash,
-		Email:         reg.Email,
-		EmailVerified: contains(reg.Satisfied, CheckEmail),
-	}); err != nil {
+	var holders []Holder
+	for _, c := range f.Checks {
+		if h, isHolder := c.(Holder); isHolder {
+			holders = append(holders, h)
+		}
+	}
+
+	u.Disabled = len(holders) > 0
+	if err := f.Creator.CreateVerifiedUser(u); err != nil {
 		if errors.Is(err, ErrUserExists) {
 			f.clearPending(r, w, reg.LoginID)
 			return Result{}, ErrUserExists
@@ -470,6 +577,11 @@ func (f *Flow) finish(r *http.Request, w http.ResponseWriter, reg Registration)
 		return Result{}, fmt.Errorf("register: create user: %w", err)
 	}
 
+	if len(holders) > 0 {
+		f.clearPending(r, w, reg.LoginID)
+		return f.hold(r.Context(), reg, holders)
+	}
+
 	if f.Session != nil {
 		// The session keys on the canonical user ID, which only the store
 		// knows after creation: resolve the fresh account by its login ID.
@@ -487,6 +599,32 @@ func (f *Flow) finish(r *http.Request, w http.ResponseWriter, reg Registration)
 	return Result{OK: true, Done: true}, nil
 }
 
+// hold hands a freshly created, disabled account to the Holder checks. No
+// session is created: the account cannot log in until it is released.
+func (f *Flow) hold(ctx context.Context, reg Registration, holders []Holder) (Result, error) {
+	user, err := f.Users.GetUserByLogin(reg.LoginID)
+	if err != nil {
+		return Result{}, fmt.Errorf("register: resolve held account: %w", err)
+	}
+	if user.Enabled {
+		// The Creator ignored NewUser.Disabled: holding the account now
+		// would record it as awaiting approval while it can already log in.
+		if f.Enabler != nil {
+			if err := f.Enabler.SetEnabled(user.ID, false); err != nil {
+				f.logger().Error("register: disabling held account failed", "loginID", reg.LoginID, "error", err)
+			}
+		}
+		return Result{}, errors.New("register: held account was created enabled; the UserCreator must honour NewUser.Disabled")
+	}
+	for _, h := range holders {
+		if err := h.Hold(ctx, reg, user.ID); err != nil {
+			return Result{}, fmt.Errorf("register: hold account: %w", err)
+		}
+	}
+	f.logger().Debug("register: registration complete, account held", "loginID", reg.LoginID, "satisfied", reg.Satisfied)
+	return Result{OK: true, Done: true, Held: true}, nil
+}
+
 func (f *Flow) clearPending(r *http.Request, w http.ResponseWriter, loginID string) {
 	if f.Pending == nil {
 		return
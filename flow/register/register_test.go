@@ -3,44 +3,61 @@ package register_test
 import (
 	"context"
 	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/go-bumbu/userauth"
 	"github.com/go-bumbu/userauth/flow/register"
-	"github.com/go-bumbu/userauth/flow/register/invite"
-	invitememory "github.com/go-bumbu/userauth/flow/register/invite/memory"
+	"github.com/go-bumbu/userauth/flow/register/approval"
+	approvalmemory "github.com/go-bumbu/userauth/flow/register/approval/memory"
+	"github.com/go-bumbu/userauth/flow/register/emaildomain"
 	"github.com/go-bumbu/userauth/flow/register/pendingstore/memory"
+	"github.com/go-bumbu/userauth/flow/register/pow"
 	"github.com/go-bumbu/userauth/internal/hashutil"
+	"github.com/go-bumbu/userauth/service/invite"
+	invitememory "github.com/go-bumbu/userauth/service/invite/memory"
 	"github.com/go-bumbu/userauth/service/verificationcode"
 	csmemory "github.com/go-bumbu/userauth/service/verificationcode/store/memory"
+	"github.com/google/go-cmp/cmp"
 )
 
-// fakeUsers is a UserGetter over a mutable set of login IDs.
+// fakeUsers is a UserGetter over a mutable set of login IDs; it is also the
+// flow's Enabler.
 type fakeUsers struct {
 	existing map[string]bool
+	disabled map[string]bool
 }
 
 func (u *fakeUsers) GetUser(id string) (userauth.User, error) {
 	if u.existing[id] {
-		return userauth.User{ID: id, LoginID: id, Enabled: true}, nil
+		return userauth.User{ID: id, LoginID: id, Enabled: !u.disabled[id]}, nil
 	}
 	return userauth.User{}, userauth.ErrUserNotFound
 }
 
+func (u *fakeUsers) SetEnabled(id string, enabled bool) error {
+	u.disabled[id] = !enabled
+	return nil
+}
+
 func (u *fakeUsers) GetUserByLogin(loginID string) (userauth.User, error) {
 	return u.GetUser(loginID)
 }
 
 // captureCreator records created users; optionally fails. Like a real store,
 // it makes the created account visible in the user store (store) so the flow
-// can resolve it after creation (e.g. for auto-login).
+// can resolve it after creation (e.g. for auto-login). With ignoreDisabled it
+// behaves like a creator that predates NewUser.Disabled.
 type captureCreator struct {
-	users []register.NewUser
-	store *fakeUsers
-	err   error
+	users          []register.NewUser
+	store          *fakeUsers
+	err            error
+	ignoreDisabled bool
 }
 
 func (c *captureCreator) CreateVerifiedUser(u register.NewUser) error {
@@ -50,6 +67,7 @@ func (c *captureCreator) CreateVerifiedUser(u register.NewUser) error {
 	c.users = append(c.users, u)
 	if c.store != nil {
 		c.store.existing[u.LoginID] = true
+		c.store.disabled[u.LoginID] = u.Disabled && !c.ignoreDisabled
 	}
 	return nil
 }
@@ -58,17 +76,19 @@ func (c *captureCreator) CreateVerifiedUser(u register.NewUser) error {
 type captureDeliverer struct {
 	to    string
 	code  string
+	msg   verificationcode.Message
 	calls int
 	err   error
 }
 
-func (d *captureDeliverer) Deliver(_ context.Context, to string, code string, _ time.Time) error {
+func (d *captureDeliverer) Deliver(_ context.Context, msg verificationcode.Message) error {
 	d.calls++
 	if d.err != nil {
 		return d.err
 	}
-	d.to = to
-	d.code = code
+	d.msg = msg
+	d.to = msg.To
+	d.code = msg.Code
 	return nil
 }
 
@@ -99,7 +119,7 @@ type fixture struct {
 }
 
 func newFixture(mod func(*fixture)) *fixture {
-	users := &fakeUsers{existing: map[string]bool{"taken": true}}
+	users := &fakeUsers{existing: map[string]bool{"taken": true}, disabled: map[string]bool{}}
 	f := &fixture{
 		users:     users,
 		creator:   &captureCreator{store: users},
@@ -431,6 +451,34 @@ func TestEmailVerificationDeliveryAndConfig(t *testing.T) {
 		}
 	})
 
+	t.Run("message carries the registration purpose and resolved locale", func(t *testing.T) {
+		f := newFixture(func(f *fixture) {
+			withEmailCheck(f)
+			check := f.flow.Checks[0].(register.EmailCheck)
+			check.Locale = func(ctx context.Context, reg register.Registration) string {
+				if l := verificationcode.LocaleFromContext(ctx); l != "" {
+					return l + "-CH"
+				}
+				return "fr"
+			}
+			f.flow.Checks[0] = check
+		})
+		if _, err := start(t, f, input); err != nil {
+			t.Fatal(err)
+		}
+		if f.deliverer.msg.Purpose != verificationcode.PurposeRegistration || f.deliverer.msg.Locale != "fr" {
+			t.Errorf("unexpected message %+v", f.deliverer.msg)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/register/request-code", nil)
+		r = r.WithContext(verificationcode.WithLocale(r.Context(), "de"))
+		if err := f.flow.Initiate(r, "alice", register.CheckEmail); err != nil {
+			t.Fatal(err)
+		}
+		if f.deliverer.msg.Locale != "de-CH" {
+			t.Errorf("want resolver locale de-CH, got %q", f.deliverer.msg.Locale)
+		}
+	})
+
 	t.Run("initiate without pending registration is a silent no-op", func(t *testing.T) {
 		f := newFixture(withEmailCheck)
 		r := httptest.NewRequest(http.MethodPost, "/register/request-code", nil)
@@ -562,6 +610,59 @@ func TestInviteRegistration(t *testing.T) {
 		}
 	})
 
+	t.Run("invite grants groups and attributes", func(t *testing.T) {
+		f := newFixture(func(f *fixture) {
+			withInviteCheck(f)
+			f.flow.Attributes = register.AttributeSchema{{Name: "team"}, {Name: "displayName"}}
+		})
+		code := issue(t, f, invite.IssueOpts{
+			Groups:     []string{"beta", "staff"},
+			Attributes: map[string]string{"team": "platform"},
+		})
+		res, err := start(t, f, register.StartInput{
+			LoginID: "alice", Password: "pw", InviteCode: code,
+			Attributes: map[string]string{"team": "sales", "displayName": "Alice"},
+		})
+		if err != nil || !res.Done {
+			t.Fatalf("want Done, got res=%+v err=%v", res, err)
+		}
+		u := f.creator.users[0]
+		if diff := cmp.Diff([]string{"beta", "staff"}, u.Groups); diff != "" {
+			t.Errorf("groups mismatch (-want +got):\n%s", diff)
+		}
+		want := map[string]string{"team": "platform", "displayName": "Alice"} // the invite wins
+		if diff := cmp.Diff(want, u.Attributes); diff != "" {
+			t.Errorf("attributes mismatch (-want +got):\n%s", diff)
+		}
+		list, err := f.invites.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list[0].Accepted) != 1 || list[0].Accepted[0].LoginID != "alice" {
+			t.Errorf("want acceptance by alice recorded, got %+v", list[0].Accepted)
+		}
+		if u.InvitedBy != "" {
+			t.Errorf("admin invite: InvitedBy = %q, want empty", u.InvitedBy)
+		}
+	})
+
+	t.Run("referral records the issuer on the account", func(t *testing.T) {
+		f := newFixture(func(f *fixture) {
+			f.invites = invite.New(invitememory.New(), invite.Opts{ReferralQuota: 1})
+			withInviteCheck(f)
+		})
+		inv, err := f.invites.Refer("u-carol", invite.ReferOpts{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := start(t, f, register.StartInput{LoginID: "alice", Password: "pw", InviteCode: inv.Code})
+		if err != nil || !res.Done {
+			t.Fatalf("want Done, got res=%+v err=%v", res, err)
+		}
+		if got := f.creator.users[0].InvitedBy; got != "u-carol" {
+			t.Errorf("InvitedBy = %q, want u-carol", got)
+		}
+	})
 }
 
 func TestInviteRegistrationWithEmailCheck(t *testing.T) {
@@ -605,3 +706,426 @@ func TestCreatorConflict(t *testing.T) {
 		t.Fatalf("want ErrUserExists passed through from creator, got %v", err)
 	}
 }
+
+// nopEnabler satisfies approval.Enabler; approving is covered by the
+// approval package.
+type nopEnabler struct{}
+
+func (nopEnabler) SetEnabled(string, bool) error { return nil }
+
+// holderFunc adapts a function to register.ApprovalHolder.
+type holderFunc func(ctx context.Context, userID, loginID, email string) error
+
+func (f holderFunc) Hold(ctx context.Context, userID, loginID, email string) error {
+	return f(ctx, userID, loginID, email)
+}
+
+func TestApprovalRegistration(t *testing.T) {
+	t.Run("account created disabled and held", func(t *testing.T) {
+		approvals := approval.New(approvalmemory.New(), nopEnabler{}, approval.Opts{})
+		f := newFixture(func(f *fixture) {
+			withEmailCheck(f)
+			f.flow.Checks = append(f.flow.Checks, register.ApprovalCheck{Approvals: approvals})
+			f.flow.Session = f.session
+		})
+		res, err := start(t, f, register.StartInput{LoginID: "alice", Password: "pw", Email: "alice@example.com"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// approval is not something the registrant submits
+		if len(res.Next) != 1 || res.Next[0] != register.CheckEmail {
+			t.Fatalf("want only the email check pending, got %+v", res)
+		}
+		res, err = verify(t, f, "alice", register.CheckEmail, f.deliverer.code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.OK || !res.Done || !res.Held {
+			t.Fatalf("want OK+Done+Held, got %+v", res)
+		}
+		if len(f.creator.users) != 1 || !f.creator.users[0].Disabled || !f.creator.users[0].EmailVerified {
+			t.Fatalf("want one verified account created disabled, got %+v", f.creator.users)
+		}
+		if f.session.calls != 0 {
+			t.Error("a held account must not be logged in")
+		}
+		pending, err := approvals.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pending) != 1 || pending[0].UserID != "alice" || pending[0].Email != "alice@example.com" {
+			t.Errorf("want alice awaiting approval, got %+v", pending)
+		}
+	})
+
+	t.Run("verifying the approval check is rejected", func(t *testing.T) {
+		f := newFixture(func(f *fixture) {
+			withEmailCheck(f)
+			f.flow.Checks = append(f.flow.Checks, register.ApprovalCheck{Approvals: holderFunc(
+				func(context.Context, string, string, string) error { return nil })})
+		})
+		if _, err := start(t, f, register.StartInput{LoginID: "alice", Password: "pw", Email: "alice@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+		res, err := verify(t, f, "alice", register.CheckApproval, "yes")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.OK {
+			t.Fatalf("want rejection, got %+v", res)
+		}
+	})
+
+	t.Run("account created enabled is refused and disabled", func(t *testing.T) {
+		held := false
+		f := newFixture(func(f *fixture) {
+			f.creator.ignoreDisabled = true
+			f.flow.Enabler = f.users
+			f.flow.Checks = append(f.flow.Checks, register.ApprovalCheck{Approvals: holderFunc(
+				func(context.Context, string, string, string) error { held = true; return nil })})
+		})
+		if _, err := start(t, f, register.StartInput{LoginID: "alice", Password: "pw"}); err == nil {
+			t.Fatal("want error when the creator ignores NewUser.Disabled")
+		}
+		if held {
+			t.Error("an enabled account must not be recorded as awaiting approval")
+		}
+		if u, _ := f.users.GetUserByLogin("alice"); u.Enabled {
+			t.Error("want the account disabled through the Enabler")
+		}
+	})
+
+	t.Run("hold failure is an error", func(t *testing.T) {
+		f := newFixture(func(f *fixture) {
+			f.flow.Checks = append(f.flow.Checks, register.ApprovalCheck{Approvals: holderFunc(
+				func(context.Context, string, string, string) error { return errors.New("db down") })})
+		})
+		if _, err := start(t, f, register.StartInput{LoginID: "alice", Password: "pw"}); err == nil {
+			t.Fatal("want error when the account cannot be held")
+		}
+	})
+}
+
+// captchaStub accepts the token "solved" and records what it was asked. Like
+// a provider call, it fails once the request's context is done.
+type captchaStub struct {
+	token, remoteIP string
+	calls           int
+	err             error
+}
+
+func (c *captchaStub) VerifyCaptcha(ctx context.Context, token, remoteIP string) (bool, error) {
+	c.calls++
+	c.token, c.remoteIP = token, remoteIP
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return token == "solved", c.err
+}
+
+func TestCaptchaRegistration(t *testing.T) {
+	tcs := []struct {
+		name      string
+		token     string
+		header    string // X-Forwarded-For
+		err       error
+		canceled  bool // the client went away before Start
+		wantOK    bool
+		wantErr   bool
+		wantCalls int
+		wantIP    string
+	}{
+		{name: "solved", token: "solved", wantOK: true, wantCalls: 1, wantIP: "192.0.2.1"},
+		{name: "refused", token: "bot", wantCalls: 1, wantIP: "192.0.2.1"},
+		{name: "missing token is not sent", wantCalls: 0},
+		{name: "forwarded for a trusted proxy", token: "solved", header: "203.0.113.9", wantOK: true, wantCalls: 1, wantIP: "203.0.113.9"},
+		{name: "provider failure", token: "solved", err: errors.New("timeout"), wantErr: true, wantCalls: 1, wantIP: "192.0.2.1"},
+		{name: "canceled request", token: "solved", canceled: true, wantErr: true, wantCalls: 1, wantIP: "192.0.2.1"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			stub := &captchaStub{err: tc.err}
+			f := newFixture(func(f *fixture) {
+				f.flow.Checks = append(f.flow.Checks, register.CaptchaCheck{Verifier: stub})
+				f.flow.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}
+			})
+			r := httptest.NewRequest(http.MethodPost, "/register", nil) // RemoteAddr 192.0.2.1
+			if tc.header != "" {
+				r.Header.Set("X-Forwarded-For", tc.header)
+			}
+			if tc.canceled {
+				ctx, cancel := context.WithCancel(r.Context())
+				cancel()
+				r = r.WithContext(ctx)
+			}
+			res, err := f.flow.Start(r, httptest.NewRecorder(), register.StartInput{
+				LoginID: "alice", Password: "pw", Captcha: tc.token,
+				ClientIP: netip.MustParseAddr("198.51.100.1"), // ignored: Start resolves it
+			})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if res.OK != tc.wantOK || len(f.creator.users) != map[bool]int{true: 1}[tc.wantOK] {
+				t.Fatalf("want OK=%v, got %+v with %d users", tc.wantOK, res, len(f.creator.users))
+			}
+			if stub.calls != tc.wantCalls || stub.remoteIP != tc.wantIP {
+				t.Errorf("verifier asked %d times from %q, want %d from %q", stub.calls, stub.remoteIP, tc.wantCalls, tc.wantIP)
+			}
+		})
+	}
+}
+
+func TestProofOfWorkRegistration(t *testing.T) {
+	svc, err := pow.New([]byte("0123456789abcdef0123456789abcdef"), pow.Opts{Difficulty: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a solution for alice that does not happen to solve it for bob too
+	var solution string
+	for {
+		c, err := svc.Issue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		solution = pow.Solve(c.Token, c.Difficulty, "alice")
+		if ok, _ := svc.VerifySolution(solution, "bob"); !ok {
+			break
+		}
+	}
+
+	tcs := []struct {
+		name     string
+		loginID  string
+		solution string
+		wantOK   bool
+	}{
+		{name: "solved", loginID: "alice", solution: solution, wantOK: true},
+		{name: "surrounding space is trimmed", loginID: " alice ", solution: solution, wantOK: true},
+		{name: "solved for another login", loginID: "bob", solution: solution},
+		{name: "missing", loginID: "alice"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFixture(func(f *fixture) {
+				f.flow.Checks = append(f.flow.Checks, register.ProofOfWorkCheck{Verifier: svc})
+			})
+			res, err := start(t, f, register.StartInput{LoginID: tc.loginID, Password: "pw", ProofOfWork: tc.solution})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.OK != tc.wantOK || res.Done != tc.wantOK {
+				t.Fatalf("want OK+Done=%v, got %+v", tc.wantOK, res)
+			}
+		})
+	}
+
+	t.Run("only accepted at start", func(t *testing.T) {
+		f := newFixture(func(f *fixture) {
+			withEmailCheck(f)
+			f.flow.Checks = append(f.flow.Checks, register.ProofOfWorkCheck{Verifier: svc})
+		})
+		res, err := start(t, f, register.StartInput{LoginID: "alice", Password: "pw", Email: "alice@example.com", ProofOfWork: solution})
+		if err != nil || !res.OK {
+			t.Fatalf("start: res=%+v err=%v", res, err)
+		}
+		if len(res.Next) != 1 || res.Next[0] != register.CheckEmail {
+			t.Fatalf("want only the email check pending, got %+v", res)
+		}
+		if res, _ := verify(t, f, "alice", register.CheckPoW, solution); res.OK {
+			t.Error("want the pow check refused as a round-trip check")
+		}
+	})
+}
+
+func TestEmailDomainRegistration(t *testing.T) {
+	policy, err := emaildomain.New(emaildomain.Config{Allow: []string{"corp.example"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcs := []struct {
+		name    string
+		format  userauth.UsernameFormat
+		in      register.StartInput
+		wantOK  bool
+		wantMsg string // ValidationError message
+	}{
+		{name: "allowed email", in: register.StartInput{LoginID: "alice", Email: "alice@corp.example"}, wantOK: true},
+		{name: "refused email", in: register.StartInput{LoginID: "alice", Email: "alice@gmail.example"}, wantMsg: "email address not accepted"},
+		{name: "email required", in: register.StartInput{LoginID: "alice"}, wantMsg: "email is required"},
+		{name: "email login ID", format: userauth.UsernameFormatEmail, in: register.StartInput{LoginID: "alice@corp.example"}, wantOK: true},
+		{name: "refused email login ID", format: userauth.UsernameFormatEmail, in: register.StartInput{LoginID: "alice@gmail.example"}, wantMsg: "email address not accepted"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFixture(func(f *fixture) {
+				f.flow.Checks = append(f.flow.Checks, register.EmailDomainCheck{Policy: policy})
+				f.flow.UsernameFormat = tc.format
+			})
+			tc.in.Password = "pw"
+			res, err := start(t, f, tc.in)
+			var vErr *register.ValidationError
+			if tc.wantMsg != "" {
+				if !errors.As(err, &vErr) || vErr.Msg != tc.wantMsg {
+					t.Fatalf("want ValidationError %q, got %v", tc.wantMsg, err)
+				}
+				if len(f.creator.users) != 0 {
+					t.Fatal("user must not be created")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.OK != tc.wantOK || res.Done != tc.wantOK {
+				t.Fatalf("want OK+Done=%v, got %+v", tc.wantOK, res)
+			}
+		})
+	}
+
+	t.Run("MX lookup runs under the request's context", func(t *testing.T) {
+		policy, err := emaildomain.New(emaildomain.Config{MX: mxFunc(
+			func(ctx context.Context, _ string) ([]*net.MX, error) {
+				return []*net.MX{{Host: "mx.corp.example."}}, ctx.Err()
+			})})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := newFixture(func(f *fixture) {
+			f.flow.Checks = append(f.flow.Checks, register.EmailDomainCheck{Policy: policy})
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		r := httptest.NewRequest(http.MethodPost, "/register", nil).WithContext(ctx)
+		in := register.StartInput{LoginID: "alice", Password: "pw", Email: "alice@corp.example"}
+		if _, err := f.flow.Start(r, httptest.NewRecorder(), in); !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, want the request's cancellation", err)
+		}
+		if len(f.creator.users) != 0 {
+			t.Fatal("user must not be created")
+		}
+	})
+}
+
+// mxFunc adapts a function to emaildomain.Resolver.
+type mxFunc func(ctx context.Context, name string) ([]*net.MX, error)
+
+func (f mxFunc) LookupMX(ctx context.Context, name string) ([]*net.MX, error) { return f(ctx, name) }
+
+func TestAttributeSchema(t *testing.T) {
+	schema := register.AttributeSchema{
+		{Name: "displayName", Required: true, MaxLen: 5},
+		{Name: "age", Type: register.AttrInt},
+		{Name: "newsletter", Type: register.AttrBool},
+		{Name: "locale", Options: []string{"en", "de"}},
+		{Name: "team", Validate: func(v string) error {
+			if !strings.HasPrefix(v, "team-") {
+				return errors.New("must start with team-")
+			}
+			return nil
+		}},
+	}
+	tcs := []struct {
+		name    string
+		in      map[string]string
+		want    map[string]string
+		wantMsg string
+	}{
+		{
+			name: "canonical values",
+			in:   map[string]string{"displayName": " Alice ", "age": "007", "newsletter": "1", "locale": "de", "team": "team-a"},
+			want: map[string]string{"displayName": "Alice", "age": "7", "newsletter": "true", "locale": "de", "team": "team-a"},
+		},
+		{name: "empty optional values are omitted", in: map[string]string{"displayName": "Bob", "age": " "}, want: map[string]string{"displayName": "Bob"}},
+		{name: "required missing", in: map[string]string{"age": "3"}, wantMsg: "displayName: is required"},
+		{name: "too long", in: map[string]string{"displayName": "Alexandra"}, wantMsg: "displayName: must be at most 5 characters"},
+		{name: "length counts characters", in: map[string]string{"displayName": "Zoë"}, want: map[string]string{"displayName": "Zoë"}},
+		{name: "control characters", in: map[string]string{"displayName": "a\x00b"}, wantMsg: "displayName: contains invalid characters"},
+		{name: "not a number", in: map[string]string{"displayName": "A", "age": "ten"}, wantMsg: "age: must be a whole number"},
+		{name: "not a bool", in: map[string]string{"displayName": "A", "newsletter": "maybe"}, wantMsg: "newsletter: must be true or false"},
+		{name: "not an option", in: map[string]string{"displayName": "A", "locale": "fr"}, wantMsg: "locale: must be one of en, de"},
+		{name: "custom validation", in: map[string]string{"displayName": "A", "team": "ops"}, wantMsg: "team: must start with team-"},
+		{name: "unknown attribute", in: map[string]string{"displayName": "A", "role": "admin"}, wantMsg: `unknown attribute "role"`},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := schema.Check(tc.in)
+			if tc.wantMsg != "" {
+				var vErr *register.ValidationError
+				if !errors.As(err, &vErr) || vErr.Msg != tc.wantMsg {
+					t.Fatalf("want ValidationError %q, got %v", tc.wantMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("attributes mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRegistrationAttributes(t *testing.T) {
+	schema := register.AttributeSchema{
+		{Name: "displayName", Required: true},
+		{Name: "newsletter", Type: register.AttrBool},
+	}
+
+	t.Run("carried through pending state to the creator", func(t *testing.T) {
+		f := newFixture(func(f *fixture) {
+			withEmailCheck(f)
+			f.flow.Attributes = schema
+		})
+		res, err := start(t, f, register.StartInput{
+			LoginID: "alice", Password: "pw", Email: "alice@example.com",
+			Attributes: map[string]string{"displayName": "Alice", "newsletter": "t"},
+		})
+		if err != nil || !res.OK {
+			t.Fatalf("start: res=%+v err=%v", res, err)
+		}
+		if _, err := verify(t, f, "alice", register.CheckEmail, f.deliverer.code); err != nil {
+			t.Fatal(err)
+		}
+		if len(f.creator.users) != 1 {
+			t.Fatalf("want one created user, got %d", len(f.creator.users))
+		}
+		want := map[string]string{"displayName": "Alice", "newsletter": "true"}
+		if diff := cmp.Diff(want, f.creator.users[0].Attributes); diff != "" {
+			t.Errorf("attributes mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("invalid attributes are a validation error", func(t *testing.T) {
+		f := newFixture(func(f *fixture) { f.flow.Attributes = schema })
+		_, err := start(t, f, register.StartInput{LoginID: "alice", Password: "pw"})
+		var vErr *register.ValidationError
+		if !errors.As(err, &vErr) {
+			t.Fatalf("want ValidationError, got %v", err)
+		}
+	})
+
+	t.Run("attributes without a schema are rejected", func(t *testing.T) {
+		f := newFixture(nil)
+		_, err := start(t, f, register.StartInput{LoginID: "alice", Password: "pw", Attributes: map[string]string{"role": "admin"}})
+		var vErr *register.ValidationError
+		if !errors.As(err, &vErr) {
+			t.Fatalf("want ValidationError, got %v", err)
+		}
+	})
+
+	t.Run("misconfigured schema", func(t *testing.T) {
+		for _, bad := range []register.AttributeSchema{
+			{{Name: ""}},
+			{{Name: "a"}, {Name: "a"}},
+			{{Name: "a", Type: "date"}},
+		} {
+			f := newFixture(func(f *fixture) { f.flow.Attributes = bad })
+			_, err := start(t, f, register.StartInput{LoginID: "alice", Password: "pw"})
+			var vErr *register.ValidationError
+			if err == nil || errors.As(err, &vErr) {
+				t.Errorf("schema %+v: want configuration error, got %v", bad, err)
+			}
+		}
+	})
+}
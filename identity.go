@@ -0,0 +1,49 @@
+package userauth
+
+import (
+	"context"
+	"time"
+)
+
+// Identity is who a request acts for, as the auth handler that authenticated
+// it saw it. Every chain.AuthHandler in auth/ stores one in the request
+// context on success; read it with IdentityFromContext.
+type Identity struct {
+	UserID string
+	// LoginID is the identifier the credential was presented with; empty when
+	// the handler does not know it (sessions only remember the user ID).
+	LoginID string
+	// Method is the Name() of the auth handler that authenticated the request.
+	Method string
+	// Groups is set only by handlers that receive group memberships with the
+	// credential (headerauth); nil means they were not part of it.
+	Groups []string
+	// TokenID and Scopes are set for personal access tokens. Scoped marks a
+	// credential limited to Scopes; tokenauth always sets it, also when the
+	// verifier reports no TokenID, and then empty Scopes grant nothing.
+	TokenID string
+	Scopes  []string
+	Scoped  bool
+	// AuthTime is when the user last proved a credential: the login (or last
+	// re-authentication) for sessions, the request itself for per-request
+	// handlers.
+	AuthTime time.Time
+	// Methods are the login method IDs proven at AuthTime ("password",
+	// "totp", ...), i.e. the authentication methods references (AMR). Empty
+	// when the handler cannot tell (e.g. a proxy-asserted identity).
+	Methods []string
+}
+
+type identityCtxKey struct{}
+
+// ContextWithIdentity returns a copy of ctx carrying id.
+func ContextWithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityCtxKey{}, id)
+}
+
+// IdentityFromContext returns the identity of an authenticated request. ok is
+// false when no auth handler authenticated it.
+func IdentityFromContext(ctx context.Context) (id Identity, ok bool) {
+	id, ok = ctx.Value(identityCtxKey{}).(Identity)
+	return id, ok && id.UserID != ""
+}
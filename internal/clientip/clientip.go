@@ -0,0 +1,76 @@
+// Package clientip resolves the client address of a request behind reverse
+// proxies. It is shared by the login engine's request signals and guards;
+// callers configure the trusted proxies as []netip.Prefix, like
+// headerauth.Cfg.TrustedProxies.
+package clientip
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Resolve returns the client address of r. The peer (RemoteAddr) is the
+// client unless it is one of the trusted proxies; then X-Forwarded-For is
+// walked from the right, skipping trusted hops, and the first untrusted
+// address is the client. Entries left of it are client-controlled and never
+// consulted. A malformed entry stops the walk at the last good hop. The
+// result is invalid (netip.Addr{}) only when RemoteAddr cannot be parsed.
+func Resolve(r *http.Request, trusted []netip.Prefix) netip.Addr {
+	peer := Peer(r)
+	if !peer.IsValid() || !contains(trusted, peer) {
+		return peer
+	}
+	hops := forwardedFor(r)
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			return client
+		}
+		client = addr.Unmap()
+		if !contains(trusted, client) {
+			return client
+		}
+	}
+	return client
+}
+
+// Peer returns the address of the directly connected peer (RemoteAddr,
+// with or without a port), or an invalid address when it cannot be parsed.
+func Peer(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// RemoteAddr without a port (e.g. unix socket or tests); try as-is.
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+// forwardedFor returns the X-Forwarded-For hops in order, across repeated
+// headers.
+func forwardedFor(r *http.Request) []string {
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(v, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	return hops
+}
+
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
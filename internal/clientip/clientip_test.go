@@ -0,0 +1,43 @@
+package clientip
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	proxies := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	tcs := []struct {
+		name    string
+		remote  string
+		xff     []string
+		trusted []netip.Prefix
+		want    string
+	}{
+		{name: "direct peer", remote: "203.0.113.7:1234", want: "203.0.113.7"},
+		{name: "peer without port", remote: "203.0.113.7", want: "203.0.113.7"},
+		{name: "untrusted peer ignores the header", remote: "203.0.113.7:1", xff: []string{"198.51.100.1"}, trusted: proxies, want: "203.0.113.7"},
+		{name: "no trusted proxies ignores the header", remote: "10.0.0.1:1", xff: []string{"198.51.100.1"}, want: "10.0.0.1"},
+		{name: "trusted proxy", remote: "10.0.0.1:1", xff: []string{"198.51.100.1"}, trusted: proxies, want: "198.51.100.1"},
+		{name: "spoofed left entries are skipped", remote: "10.0.0.1:1", xff: []string{"1.2.3.4, 198.51.100.1, 10.0.0.2"}, trusted: proxies, want: "198.51.100.1"},
+		{name: "repeated headers", remote: "10.0.0.1:1", xff: []string{"1.2.3.4", "198.51.100.1"}, trusted: proxies, want: "198.51.100.1"},
+		{name: "all hops trusted", remote: "10.0.0.1:1", xff: []string{"10.0.0.3, 10.0.0.2"}, trusted: proxies, want: "10.0.0.3"},
+		{name: "malformed hop stops the walk", remote: "10.0.0.1:1", xff: []string{"198.51.100.1, junk"}, trusted: proxies, want: "10.0.0.1"},
+		{name: "mapped IPv4 is unmapped", remote: "[::ffff:203.0.113.7]:1", want: "203.0.113.7"},
+		{name: "IPv6 peer", remote: "[2001:db8::1]:443", want: "2001:db8::1"},
+		{name: "unparsable peer", remote: "pipe", want: "invalid IP"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tc.remote
+			for _, v := range tc.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := Resolve(r, tc.trusted).String(); got != tc.want {
+				t.Errorf("Resolve = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+// Package locale carries the client's preferred language from a request to
+// the code deliverers. It is shared by the login, registration and invite
+// transports, which hand it to verificationcode through the request context.
+package locale
+
+import (
+	"net/http"
+
+	"github.com/go-bumbu/userauth/service/verificationcode"
+)
+
+// FromRequest puts the client's preferred language (Accept-Language) on the
+// request context, where code deliverers pick it up, unless the application
+// already set one with verificationcode.WithLocale.
+func FromRequest(r *http.Request) *http.Request {
+	if verificationcode.LocaleFromContext(r.Context()) != "" {
+		return r
+	}
+	l := verificationcode.PreferredLocale(r.Header.Get("Accept-Language"))
+	if l == "" {
+		return r
+	}
+	return r.WithContext(verificationcode.WithLocale(r.Context(), l))
+}
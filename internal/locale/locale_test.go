@@ -0,0 +1,36 @@
+package locale
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-bumbu/userauth/service/verificationcode"
+)
+
+func TestFromRequest(t *testing.T) {
+	tcs := []struct {
+		name   string
+		header string
+		set    string
+		want   string
+	}{
+		{name: "accept language", header: "de-CH, en;q=0.5", want: "de-CH"},
+		{name: "no header", want: ""},
+		{name: "application locale wins", header: "de", set: "fr", want: "fr"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", nil)
+			if tc.header != "" {
+				r.Header.Set("Accept-Language", tc.header)
+			}
+			if tc.set != "" {
+				r = r.WithContext(verificationcode.WithLocale(r.Context(), tc.set))
+			}
+			got := verificationcode.LocaleFromContext(FromRequest(r).Context())
+			if got != tc.want {
+				t.Errorf("want locale %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package userauth
+
+import (
+	"errors"
+	"time"
+)
+
+// SortField is a user attribute a UserLister orders by.
+type SortField string
+
+const (
+	SortLoginID   SortField = "login_id" // the default
+	SortName      SortField = "name"
+	SortEmail     SortField = "email" // primary email
+	SortCreatedAt SortField = "created_at"
+)
+
+// ListOpts selects, orders and pages the users a UserLister returns. The
+// zero value lists everyone by login ID, one default-sized page.
+type ListOpts struct {
+	// Limit is the page size; stores apply their own default when it is <=0
+	// and may cap it.
+	Limit int
+	// Offset skips rows; <0 is treated as 0. Ignored when Cursor is set —
+	// prefer the cursor, which stays fast on deep pages.
+	Offset int
+	// Cursor continues a listing after the last user of a previous page
+	// (ListResult.NextCursor). It is opaque, and valid only with the Sort
+	// and Desc of the listing that issued it.
+	Cursor string
+
+	// Search keeps users whose login ID, primary email or name contains it;
+	// case-insensitive for ASCII.
+	Search string
+	// Enabled, when set, keeps only enabled (true) or disabled (false) users.
+	Enabled *bool
+	// Group, when set, keeps only members of the group.
+	Group string
+	// SecondFactor, when set, keeps only users with (true) or without
+	// (false) a second factor: a confirmed TOTP enrolment, or email or SMS
+	// codes turned on.
+	SecondFactor *bool
+	// CreatedAfter and CreatedBefore bound the creation time: at or after
+	// CreatedAfter, strictly before CreatedBefore. Zero means unbounded.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+
+	Sort SortField // default SortLoginID
+	Desc bool      // descending instead of ascending
+}
+
+// ListResult is a page of users plus the count of all matching users.
+type ListResult struct {
+	Users []User // page of users, in the requested order
+	Total int    // number of users matching the filters, ignoring paging
+	// NextCursor fetches the following page through ListOpts.Cursor; empty
+	// on the last page.
+	NextCursor string
+}
+
+// UserLister pages through users for administration. Users with equal sort
+// keys keep a stable order, so cursor pages neither skip nor repeat users.
+type UserLister interface {
+	List(opts ListOpts) (ListResult, error)
+}
+
+// ErrInvalidCursor is returned by a UserLister for a cursor it did not
+// issue, or one issued for a different Sort or Desc.
+var ErrInvalidCursor = errors.New("invalid list cursor")
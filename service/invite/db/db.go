@@ -0,0 +1,259 @@
+// Package db provides a GORM-backed invite.Store. Invites are stored in the
+// invites table and the accounts that accepted them in invite_acceptances.
+// Consume decrements the remaining uses with a single conditional UPDATE,
+// which keeps the check-and-decrement atomic, and records the acceptance in
+// the same transaction.
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-bumbu/userauth/service/invite"
+	"gorm.io/gorm"
+)
+
+// inviteModel stores one invite per row (invites table).
+type inviteModel struct {
+	gorm.Model
+	Code       string `gorm:"uniqueIndex;not null"`
+	Note       string
+	Email      string
+	UsesLeft   int
+	ExpiresAt  time.Time // zero value means the invite never expires
+	IssuedAt   time.Time
+	Revoked    bool
+	Groups     string // JSON-encoded []string; empty without groups
+	Attributes string // JSON-encoded map[string]string; empty without attributes
+	IssuedBy   string `gorm:"index"`
+}
+
+func (inviteModel) TableName() string { return "invites" }
+
+// acceptanceModel records one account created with an invite
+// (invite_acceptances table).
+type acceptanceModel struct {
+	ID         uint   `gorm:"primaryKey"`
+	InviteCode string `gorm:"index;not null"`
+	LoginID    string `gorm:"not null"`
+	AcceptedAt time.Time
+}
+
+func (acceptanceModel) TableName() string { return "invite_acceptances" }
+
+// Store is a GORM-backed invite store.
+type Store struct {
+	db *gorm.DB
+}
+
+// New creates a Store and auto-migrates the invites and invite_acceptances
+// tables.
+func New(db *gorm.DB) (*Store, error) {
+	if err := db.AutoMigrate(&inviteModel{}, &acceptanceModel{}); err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Save stores the invite. Overwrites any existing entry with the same code;
+// acceptances are left alone.
+func (s *Store) Save(inv invite.Invite) error {
+	groups, attributes, err := encodeGrants(inv)
+	if err != nil {
+		return err
+	}
+	var m inviteModel
+	err = s.db.Where("code = ?", inv.Code).First(&m).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	m.Code = inv.Code
+	m.Note = inv.Note
+	m.Email = inv.Email
+	m.UsesLeft = inv.UsesLeft
+	m.ExpiresAt = inv.ExpiresAt
+	m.IssuedAt = inv.CreatedAt
+	m.Revoked = inv.Revoked
+	m.Groups = groups
+	m.Attributes = attributes
+	m.IssuedBy = inv.IssuedBy
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return s.db.Create(&m).Error
+	}
+	return s.db.Save(&m).Error
+}
+
+// Get retrieves the invite by code.
+func (s *Store) Get(code string) (invite.Invite, error) {
+	return get(s.db, code)
+}
+
+func get(tx *gorm.DB, code string) (invite.Invite, error) {
+	var m inviteModel
+	err := tx.Where("code = ?", code).First(&m).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return invite.Invite{}, invite.ErrInviteNotFound
+		}
+		return invite.Invite{}, err
+	}
+	accepted, err := acceptances(tx.Where("invite_code = ?", code))
+	if err != nil {
+		return invite.Invite{}, err
+	}
+	return m.toInvite(accepted[code])
+}
+
+// List returns all invites, including revoked and exhausted ones.
+func (s *Store) List() ([]invite.Invite, error) {
+	return list(s.db, s.db)
+}
+
+// ListIssuedBy returns the invites issued by userID, oldest first.
+func (s *Store) ListIssuedBy(userID string) ([]invite.Invite, error) {
+	issued := s.db.Model(&inviteModel{}).Select("code").Where("issued_by = ?", userID)
+	return list(s.db.Where("issued_by = ?", userID), s.db.Where("invite_code IN (?)", issued))
+}
+
+// list loads the invites matched by invites, oldest first, with the
+// acceptances matched by accepted.
+func list(invites, accepted *gorm.DB) ([]invite.Invite, error) {
+	var rows []inviteModel
+	if err := invites.Order("id ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	byCode, err := acceptances(accepted)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]invite.Invite, 0, len(rows))
+	for _, m := range rows {
+		inv, err := m.toInvite(byCode[m.Code])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, inv)
+	}
+	return out, nil
+}
+
+// acceptances loads the acceptances matched by q grouped by invite code,
+// oldest first.
+func acceptances(q *gorm.DB) (map[string][]invite.Acceptance, error) {
+	var rows []acceptanceModel
+	if err := q.Order("id ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[string][]invite.Acceptance)
+	for _, a := range rows {
+		out[a.InviteCode] = append(out[a.InviteCode], invite.Acceptance{LoginID: a.LoginID, At: a.AcceptedAt})
+	}
+	return out, nil
+}
+
+// Delete removes the invite by code.
+func (s *Store) Delete(code string) error {
+	return s.db.Where("code = ?", code).Delete(&inviteModel{}).Error
+}
+
+// Consume atomically decrements UsesLeft of a usable invite. The single
+// conditional UPDATE makes the check-and-decrement atomic; RowsAffected
+// reports whether a usable invite matched. The acceptance and the returned
+// invite are written and read in the same transaction.
+func (s *Store) Consume(code, email, acceptedBy string) (invite.Invite, bool, error) {
+	var inv invite.Invite
+	var ok bool
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(&inviteModel{}).
+			Where("code = ? AND revoked = ? AND uses_left > 0", code, false).
+			Where("expires_at = ? OR expires_at > ?", time.Time{}, now).
+			Where("email = ? OR email = ?", "", email).
+			Update("uses_left", gorm.Expr("uses_left - 1"))
+		if res.Error != nil || res.RowsAffected != 1 {
+			return res.Error
+		}
+		if acceptedBy != "" {
+			a := acceptanceModel{InviteCode: code, LoginID: acceptedBy, AcceptedAt: now.UTC()}
+			if err := tx.Create(&a).Error; err != nil {
+				return err
+			}
+		}
+		var err error
+		if inv, err = get(tx, code); err != nil {
+			return err
+		}
+		ok = true
+		return nil
+	})
+	if err != nil {
+		return invite.Invite{}, false, err
+	}
+	return inv, ok, nil
+}
+
+func encodeGrants(inv invite.Invite) (groups, attributes string, err error) {
+	if len(inv.Groups) > 0 {
+		b, err := json.Marshal(inv.Groups)
+		if err != nil {
+			return "", "", fmt.Errorf("invite encode groups: %w", err)
+		}
+		groups = string(b)
+	}
+	if len(inv.Attributes) > 0 {
+		b, err := json.Marshal(inv.Attributes)
+		if err != nil {
+			return "", "", fmt.Errorf("invite encode attributes: %w", err)
+		}
+		attributes = string(b)
+	}
+	return groups, attributes, nil
+}
+
+func (m inviteModel) toInvite(accepted []invite.Acceptance) (invite.Invite, error) {
+	inv := invite.Invite{
+		Code:      m.Code,
+		Note:      m.Note,
+		Email:     m.Email,
+		UsesLeft:  m.UsesLeft,
+		ExpiresAt: m.ExpiresAt,
+		CreatedAt: m.IssuedAt,
+		Revoked:   m.Revoked,
+		Accepted:  accepted,
+		IssuedBy:  m.IssuedBy,
+	}
+	if m.Groups != "" {
+		if err := json.Unmarshal([]byte(m.Groups), &inv.Groups); err != nil {
+			return invite.Invite{}, fmt.Errorf("invite decode groups: %w", err)
+		}
+	}
+	if m.Attributes != "" {
+		if err := json.Unmarshal([]byte(m.Attributes), &inv.Attributes); err != nil {
+			return invite.Invite{}, fmt.Errorf("invite decode attributes: %w", err)
+		}
+	}
+	return inv, nil
+}
+
+// Sweep permanently deletes invites past their expiry, with their
+// acceptances; invites without one are kept.
+func (s *Store) Sweep(ctx context.Context) (int, error) {
+	var n int
+	now := time.Now()
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		expired := tx.Unscoped().Model(&inviteModel{}).Select("code").
+			Where("expires_at <> ? AND expires_at < ?", time.Time{}, now)
+		if err := tx.Where("invite_code IN (?)", expired).Delete(&acceptanceModel{}).Error; err != nil {
+			return err
+		}
+		res := tx.Unscoped().
+			Where("expires_at <> ? AND expires_at < ?", time.Time{}, now).
+			Delete(&inviteModel{})
+		n = int(res.RowsAffected)
+		return res.Error
+	})
+	return n, err
+}
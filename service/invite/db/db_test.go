@@ -1,13 +1,14 @@
 package db_test
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"testing"
 	"time"
 
-	"github.com/go-bumbu/userauth/flow/register/invite"
-	invitedb "github.com/go-bumbu/userauth/flow/register/invite/db"
+	"github.com/go-bumbu/userauth/service/invite"
+	invitedb "github.com/go-bumbu/userauth/service/invite/db"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"gorm.io/driver/sqlite"
@@ -38,12 +39,15 @@ func TestStore(t *testing.T) {
 	t.Run("save and get", func(t *testing.T) {
 		store := newTestStore(t)
 		inv := invite.Invite{
-			Code:      "abc123",
-			Note:      "team A",
-			Email:     "a@example.com",
-			UsesLeft:  3,
-			ExpiresAt: time.Now().Add(time.Hour).UTC(),
-			CreatedAt: time.Now().UTC(),
+			Code:       "abc123",
+			Note:       "team A",
+			Email:      "a@example.com",
+			UsesLeft:   3,
+			ExpiresAt:  time.Now().Add(time.Hour).UTC(),
+			CreatedAt:  time.Now().UTC(),
+			Groups:     []string{"beta", "staff"},
+			Attributes: map[string]string{"team": "a"},
+			IssuedBy:   "u-1",
 		}
 		if err := store.Save(inv); err != nil {
 			t.Fatal(err)
@@ -118,7 +122,7 @@ func TestStoreConsume(t *testing.T) {
 		if err := store.Save(invite.Invite{Code: "abc", UsesLeft: 2}); err != nil {
 			t.Fatal(err)
 		}
-		ok, err := store.Consume("abc", "")
+		_, ok, err := store.Consume("abc", "", "")
 		if err != nil || !ok {
 			t.Fatalf("want consume ok, got ok=%v err=%v", ok, err)
 		}
@@ -151,7 +155,7 @@ func TestStoreConsume(t *testing.T) {
 			{"expired", ""},
 			{"bound", "b@example.com"},
 		} {
-			ok, err := store.Consume(tc.code, tc.email)
+			_, ok, err := store.Consume(tc.code, tc.email, "")
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -160,7 +164,7 @@ func TestStoreConsume(t *testing.T) {
 			}
 		}
 		// email-bound invite consumable by the bound email
-		ok, err := store.Consume("bound", "a@example.com")
+		_, ok, err := store.Consume("bound", "a@example.com", "")
 		if err != nil || !ok {
 			t.Errorf("want bound invite consumable by matching email, got ok=%v err=%v", ok, err)
 		}
@@ -171,7 +175,7 @@ func TestStoreConsume(t *testing.T) {
 		if err := store.Save(invite.Invite{Code: "forever", UsesLeft: 1}); err != nil {
 			t.Fatal(err)
 		}
-		ok, err := store.Consume("forever", "")
+		_, ok, err := store.Consume("forever", "", "")
 		if err != nil || !ok {
 			t.Errorf("want zero-expiry invite consumable, got ok=%v err=%v", ok, err)
 		}
@@ -179,6 +183,82 @@ func TestStoreConsume(t *testing.T) {
 
 }
 
+func TestStoreAcceptances(t *testing.T) {
+	store := newTestStore(t)
+	if err := store.Save(invite.Invite{Code: "team", UsesLeft: 3, Groups: []string{"staff"}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, login := range []string{"alice", "", "bob"} {
+		inv, ok, err := store.Consume("team", "", login)
+		if err != nil || !ok {
+			t.Fatalf("consume for %q: ok=%v err=%v", login, ok, err)
+		}
+		if diff := cmp.Diff([]string{"staff"}, inv.Groups); diff != "" {
+			t.Errorf("consumed invite groups mismatch (-want +got):\n%s", diff)
+		}
+	}
+	got, err := store.Get("team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Save, e.g. from Revoke, leaves the acceptances alone
+	got.Revoked = true
+	if err := store.Save(got); err != nil {
+		t.Fatal(err)
+	}
+	list, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logins []string
+	for _, a := range list[0].Accepted {
+		logins = append(logins, a.LoginID)
+		if a.At.IsZero() {
+			t.Errorf("acceptance of %s has no time", a.LoginID)
+		}
+	}
+	if diff := cmp.Diff([]string{"alice", "bob"}, logins); diff != "" {
+		t.Errorf("acceptances mismatch (-want +got):\n%s", diff)
+	}
+	if list[0].UsesLeft != 0 || !list[0].Revoked {
+		t.Errorf("unexpected invite state %+v", list[0])
+	}
+}
+
+func TestStoreListIssuedBy(t *testing.T) {
+	store := newTestStore(t)
+	for _, inv := range []invite.Invite{
+		{Code: "r1", UsesLeft: 1, IssuedBy: "u-alice"},
+		{Code: "admin", UsesLeft: 1},
+		{Code: "r2", UsesLeft: 1, IssuedBy: "u-alice"},
+		{Code: "r3", UsesLeft: 1, IssuedBy: "u-bob"},
+	} {
+		if err := store.Save(inv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok, err := store.Consume("r2", "", "carol"); err != nil || !ok {
+		t.Fatalf("consume: ok=%v err=%v", ok, err)
+	}
+	got, err := store.ListIssuedBy("u-alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var codes []string
+	for _, inv := range got {
+		codes = append(codes, inv.Code)
+	}
+	if diff := cmp.Diff([]string{"r1", "r2"}, codes); diff != "" {
+		t.Errorf("codes mismatch (-want +got):\n%s", diff)
+	}
+	if len(got[1].Accepted) != 1 || got[1].Accepted[0].LoginID != "carol" {
+		t.Errorf("want carol's acceptance on r2, got %+v", got[1].Accepted)
+	}
+	if got, err := store.ListIssuedBy("u-nobody"); err != nil || len(got) != 0 {
+		t.Errorf("want none, got %v err=%v", got, err)
+	}
+}
+
 func TestStoreConcurrency(t *testing.T) {
 	t.Run("concurrent consume of single-use invite", func(t *testing.T) {
 		store := newTestStore(t)
@@ -192,7 +272,7 @@ func TestStoreConcurrency(t *testing.T) {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				ok, err := store.Consume("once", "")
+				_, ok, err := store.Consume("once", "", "")
 				if err != nil {
 					t.Error(err)
 				}
@@ -212,3 +292,39 @@ func TestStoreConcurrency(t *testing.T) {
 		}
 	})
 }
+
+func TestSweep(t *testing.T) {
+	store := newTestStore(t)
+	now := time.Now()
+	_ = store.Save(invite.Invite{Code: "open", UsesLeft: 1})
+	_ = store.Save(invite.Invite{Code: "live", UsesLeft: 1, ExpiresAt: now.Add(time.Hour)})
+	_ = store.Save(invite.Invite{Code: "expired", UsesLeft: 2, ExpiresAt: now.Add(time.Hour)})
+	if _, ok, err := store.Consume("expired", "", "alice"); err != nil || !ok {
+		t.Fatalf("consume: ok=%v err=%v", ok, err)
+	}
+	_ = store.Save(invite.Invite{Code: "expired", UsesLeft: 1, ExpiresAt: now.Add(-time.Hour)})
+
+	n, err := store.Sweep(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("removed %d invites, want 1", n)
+	}
+	if _, err := store.Get("expired"); !errors.Is(err, invite.ErrInviteNotFound) {
+		t.Errorf("want ErrInviteNotFound for the swept invite, got %v", err)
+	}
+	for _, code := range []string{"open", "live"} {
+		if _, err := store.Get(code); err != nil {
+			t.Errorf("invite %q must survive the sweep: %v", code, err)
+		}
+	}
+	// the swept invite's acceptances went with it: a new invite reusing
+	// the code starts clean
+	if err := store.Save(invite.Invite{Code: "expired", UsesLeft: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if inv, _ := store.Get("expired"); len(inv.Accepted) != 0 {
+		t.Errorf("want no acceptances carried over, got %+v", inv.Accepted)
+	}
+}
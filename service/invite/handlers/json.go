@@ -0,0 +1,410 @@
+// Package handlers provides JSON endpoints over an invite.Service.
+//
+// The admin endpoints issue, list, revoke and (re)send invites. Invites can
+// grant groups, so mount them behind an admin check (authz.Middleware with
+// authz.RequireGroup, for instance); the package does no authorization of
+// its own.
+//
+// The referral endpoints let any signed-in user issue invites from their
+// quota (invite.Opts.ReferralQuota) and list the ones they issued. They act
+// for the userauth.Identity on the request, so mount them behind the auth
+// chain; without an identity they answer 401.
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-bumbu/userauth"
+	"github.com/go-bumbu/userauth/auth/csrf"
+	"github.com/go-bumbu/userauth/internal/locale"
+	"github.com/go-bumbu/userauth/service/invite"
+	"github.com/go-bumbu/userauth/service/verificationcode"
+)
+
+// JSON exposes an invite.Service as admin and referral endpoints.
+type JSON struct {
+	Service *invite.Service
+	Logger  *slog.Logger
+	CSRF    *csrf.Protector // optional; every POST endpoint must pass its checks
+}
+
+// Invite is one invite as the endpoints show it.
+type Invite struct {
+	Code       string            `json:"code"`
+	Note       string            `json:"note,omitempty"`
+	Email      string            `json:"email,omitempty"`
+	UsesLeft   int               `json:"uses_left"`
+	ExpiresAt  *time.Time        `json:"expires_at,omitempty"` // absent = never expires
+	CreatedAt  time.Time         `json:"created_at"`
+	Revoked    bool              `json:"revoked"`
+	Groups     []string          `json:"groups,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	IssuedBy   string            `json:"issued_by,omitempty"`
+	Accepted   []Acceptance      `json:"accepted,omitempty"`
+}
+
+// Acceptance is one account created with an invite.
+type Acceptance struct {
+	LoginID string    `json:"login_id"`
+	At      time.Time `json:"at"`
+}
+
+// IssuePayload is the request body for IssueHandler. Every field is
+// optional; see invite.IssueOpts for the defaults. Send mails the invite to
+// Email once issued, in Locale or else the request's Accept-Language.
+type IssuePayload struct {
+	Uses       int               `json:"uses,omitempty"`
+	ExpiresAt  *time.Time        `json:"expires_at,omitempty"`
+	Email      string            `json:"email,omitempty"`
+	Note       string            `json:"note,omitempty"`
+	Groups     []string          `json:"groups,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Send       bool              `json:"send,omitempty"`
+	Locale     string            `json:"locale,omitempty"`
+}
+
+// ReferPayload is the request body for ReferHandler; Send and Locale work
+// as in IssuePayload.
+type ReferPayload struct {
+	Email  string `json:"email,omitempty"`
+	Note   string `json:"note,omitempty"`
+	Send   bool   `json:"send,omitempty"`
+	Locale string `json:"locale,omitempty"`
+}
+
+// CodePayload is the request body for RevokeHandler and SendHandler.
+type CodePayload struct {
+	Code   string `json:"code"`
+	Locale string `json:"locale,omitempty"` // SendHandler only
+}
+
+// IssueResponse is the body of a successful issue or referral. Sent
+// reports whether the invite was mailed; a failed send does not undo the
+// invite, which can be sent again with SendHandler.
+type IssueResponse struct {
+	Invite Invite `json:"invite"`
+	Sent   bool   `json:"sent"`
+}
+
+// ListResponse is the body of a successful admin list.
+type ListResponse struct {
+	Invites []Invite `json:"invites"`
+}
+
+// ReferralsResponse is the body of a successful referral list.
+type ReferralsResponse struct {
+	Invites   []Invite `json:"invites"`
+	Remaining int      `json:"remaining"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func toInvite(inv invite.Invite) Invite {
+	out := Invite{
+		Code:       inv.Code,
+		Note:       inv.Note,
+		Email:      inv.Email,
+		UsesLeft:   inv.UsesLeft,
+		CreatedAt:  inv.CreatedAt,
+		Revoked:    inv.Revoked,
+		Groups:     inv.Groups,
+		Attributes: inv.Attributes,
+		IssuedBy:   inv.IssuedBy,
+	}
+	if !inv.ExpiresAt.IsZero() {
+		exp := inv.ExpiresAt
+		out.ExpiresAt = &exp
+	}
+	for _, a := range inv.Accepted {
+		out.Accepted = append(out.Accepted, Acceptance{LoginID: a.LoginID, At: a.At})
+	}
+	return out
+}
+
+func toInvites(invs []invite.Invite) []Invite {
+	out := make([]Invite, 0, len(invs))
+	for _, inv := range invs {
+		out = append(out, toInvite(inv))
+	}
+	return out
+}
+
+// IssueHandler returns the admin POST endpoint issuing an invite.
+//
+// Responses:
+//   - 201 IssueResponse
+//   - 400 for a malformed body, negative uses, an expiry in the past, or
+//     send without an email
+//   - 405 for non-POST requests
+//   - 500 for store failures
+func (h *JSON) IssueHandler() http.Handler {
+	return h.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		var p IssuePayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			h.writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		opts := invite.IssueOpts{
+			Uses:       p.Uses,
+			Email:      p.Email,
+			Note:       p.Note,
+			Groups:     p.Groups,
+			Attributes: p.Attributes,
+		}
+		if p.ExpiresAt != nil {
+			opts.ExpiresAt = *p.ExpiresAt
+		}
+		switch {
+		case p.Uses < 0:
+			h.writeError(w, http.StatusBadRequest, "uses must not be negative")
+			return
+		case p.ExpiresAt != nil && !p.ExpiresAt.After(time.Now()):
+			h.writeError(w, http.StatusBadRequest, "expires_at is in the past")
+			return
+		case p.Send && p.Email == "":
+			h.writeError(w, http.StatusBadRequest, "send requires an email")
+			return
+		}
+		inv, err := h.Service.Issue(opts)
+		if err != nil {
+			h.writeServiceError(w, err)
+			return
+		}
+		h.logger().Info("invite issued", "code", inv.Code, "uses", inv.UsesLeft, "groups", inv.Groups)
+		h.writeIssued(w, r, inv, p.Send, p.Locale)
+	}))
+}
+
+// ListHandler returns the admin GET endpoint listing every invite,
+// including revoked, expired and used-up ones.
+//
+// Responses:
+//   - 200 ListResponse
+//   - 405 for non-GET requests
+//   - 500 for store failures
+func (h *JSON) ListHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		invs, err := h.Service.List()
+		if err != nil {
+			h.writeServiceError(w, err)
+			return
+		}
+		h.writeJSON(w, http.StatusOK, ListResponse{Invites: toInvites(invs)})
+	})
+}
+
+// RevokeHandler returns the admin POST endpoint revoking an invite.
+//
+// Responses:
+//   - 204 on success
+//   - 400 for a malformed body or missing code
+//   - 404 for an unknown code
+//   - 405 for non-POST requests
+//   - 500 for store failures
+func (h *JSON) RevokeHandler() http.Handler {
+	return h.withCode(func(w http.ResponseWriter, r *http.Request, p CodePayload) {
+		if err := h.Service.Revoke(p.Code); err != nil {
+			h.writeServiceError(w, err)
+			return
+		}
+		h.logger().Info("invite revoked", "code", p.Code)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// SendHandler returns the admin POST endpoint mailing an email-bound invite
+// again, in the payload's locale or else the request's Accept-Language.
+//
+// Responses:
+//   - 204 on success
+//   - 400 for a malformed body or missing code
+//   - 404 for an unknown code, or when the service has no Deliverer
+//   - 405 for non-POST requests
+//   - 409 for an invite without an email, or one that can no longer be used
+//   - 500 for store and delivery failures
+func (h *JSON) SendHandler() http.Handler {
+	return h.withCode(func(w http.ResponseWriter, r *http.Request, p CodePayload) {
+		if err := h.Service.Send(withLocale(r, p.Locale).Context(), p.Code); err != nil {
+			h.writeServiceError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// ReferHandler returns the POST endpoint a signed-in user issues a referral
+// invite from. The invite is single use, expires after
+// invite.Opts.ReferralExpiry and records the user as its issuer, and through
+// it on the account it creates.
+//
+// Responses:
+//   - 201 IssueResponse
+//   - 400 for a malformed body, or send without an email
+//   - 401 when the request carries no identity
+//   - 403 when the user's quota is used up
+//   - 404 when referrals are disabled
+//   - 405 for non-POST requests
+//   - 500 for store failures
+func (h *JSON) ReferHandler() http.Handler {
+	return h.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		id, ok := userauth.IdentityFromContext(r.Context())
+		if !ok {
+			h.writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		var p ReferPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			h.writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if p.Send && p.Email == "" {
+			h.writeError(w, http.StatusBadRequest, "send requires an email")
+			return
+		}
+		inv, err := h.Service.Refer(id.UserID, invite.ReferOpts{Email: p.Email, Note: p.Note})
+		if err != nil {
+			h.writeServiceError(w, err)
+			return
+		}
+		h.logger().Info("referral invite issued", "code", inv.Code, "userID", id.UserID)
+		h.writeIssued(w, r, inv, p.Send, p.Locale)
+	}))
+}
+
+// ReferralsHandler returns the GET endpoint listing the referral invites
+// the signed-in user issued, oldest first, and how many they have left.
+//
+// Responses:
+//   - 200 ReferralsResponse
+//   - 401 when the request carries no identity
+//   - 404 when referrals are disabled
+//   - 405 for non-GET requests
+//   - 500 for store failures
+func (h *JSON) ReferralsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		id, ok := userauth.IdentityFromContext(r.Context())
+		if !ok {
+			h.writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		invs, remaining, err := h.Service.Referrals(id.UserID)
+		if err != nil {
+			h.writeServiceError(w, err)
+			return
+		}
+		h.writeJSON(w, http.StatusOK, ReferralsResponse{Invites: toInvites(invs), Remaining: remaining})
+	})
+}
+
+// withCode is the shared body of the endpoints taking a CodePayload.
+func (h *JSON) withCode(next func(http.ResponseWriter, *http.Request, CodePayload)) http.Handler {
+	return h.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		var p CodePayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			h.writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if p.Code == "" {
+			h.writeError(w, http.StatusBadRequest, "code is required")
+			return
+		}
+		next(w, r, p)
+	}))
+}
+
+// writeIssued answers a successful issue or referral, mailing the invite
+// first when asked to.
+func (h *JSON) writeIssued(w http.ResponseWriter, r *http.Request, inv invite.Invite, send bool, lang string) {
+	sent := false
+	if send {
+		if err := h.Service.Send(withLocale(r, lang).Context(), inv.Code); err != nil {
+			h.logger().Warn("invite handler: send invite", "code", inv.Code, "err", err)
+		} else {
+			sent = true
+		}
+	}
+	h.writeJSON(w, http.StatusCreated, IssueResponse{Invite: toInvite(inv), Sent: sent})
+}
+
+// writeServiceError maps Service errors to HTTP responses.
+func (h *JSON) writeServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, invite.ErrInviteNotFound):
+		h.writeError(w, http.StatusNotFound, "invite not found")
+	case errors.Is(err, invite.ErrReferralDisabled):
+		h.writeError(w, http.StatusNotFound, "referrals are disabled")
+	case errors.Is(err, invite.ErrNoDeliverer):
+		h.writeError(w, http.StatusNotFound, "sending invites is not configured")
+	case errors.Is(err, invite.ErrQuotaExceeded):
+		h.writeError(w, http.StatusForbidden, "invite quota used up")
+	case errors.Is(err, invite.ErrNoEmail):
+		h.writeError(w, http.StatusConflict, "invite has no email")
+	case errors.Is(err, invite.ErrNotUsable):
+		h.writeError(w, http.StatusConflict, "invite can no longer be used")
+	default:
+		h.logger().Error("invite handler: internal error", "err", err)
+		h.writeError(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+// withLocale puts the invitee's language on the request context for the
+// deliverer: lang when given, else the client's, as locale.FromRequest.
+func withLocale(r *http.Request, lang string) *http.Request {
+	if lang == "" {
+		return locale.FromRequest(r)
+	}
+	return r.WithContext(verificationcode.WithLocale(r.Context(), lang))
+}
+
+func (h *JSON) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.logger().Error("invite handler: encode response", "err", err)
+	}
+}
+
+func (h *JSON) writeError(w http.ResponseWriter, status int, msg string) {
+	h.writeJSON(w, status, errorResponse{Error: msg})
+}
+
+// protect wraps next in the CSRF middleware when one is configured.
+func (h *JSON) protect(next http.Handler) http.Handler {
+	if h.CSRF == nil {
+		return next
+	}
+	return h.CSRF.Middleware(next)
+}
+
+func (h *JSON) logger() *slog.Logger {
+	if h.Logger != nil {
+		return h.Logger
+	}
+	return slog.Default()
+}
@@ -0,0 +1,259 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-bumbu/userauth"
+	"github.com/go-bumbu/userauth/service/invite"
+	"github.com/go-bumbu/userauth/service/invite/handlers"
+	"github.com/go-bumbu/userauth/service/invite/memory"
+	"github.com/go-bumbu/userauth/service/verificationcode"
+	"github.com/google/go-cmp/cmp"
+)
+
+// captureDeliverer records delivered messages.
+type captureDeliverer struct {
+	msgs []verificationcode.Message
+}
+
+func (d *captureDeliverer) Deliver(_ context.Context, msg verificationcode.Message) error {
+	d.msgs = append(d.msgs, msg)
+	return nil
+}
+
+func newFixture(t *testing.T, opts invite.Opts) (*handlers.JSON, *captureDeliverer) {
+	t.Helper()
+	d := &captureDeliverer{}
+	opts.Deliver = d
+	svc := invite.New(memory.New(), opts)
+	return &handlers.JSON{Service: svc, Logger: slog.New(slog.DiscardHandler)}, d
+}
+
+func do(t *testing.T, h http.Handler, method, target string, body any, mod func(*http.Request) *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, target, &buf)
+	if mod != nil {
+		req = mod(req)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func as(userID string) func(*http.Request) *http.Request {
+	return func(r *http.Request) *http.Request {
+		return r.WithContext(userauth.ContextWithIdentity(r.Context(), userauth.Identity{UserID: userID}))
+	}
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.NewDecoder(rec.Body).Decode(&v); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return v
+}
+
+func TestIssueListRevoke(t *testing.T) {
+	h, d := newFixture(t, invite.Opts{})
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	rec := do(t, h.IssueHandler(), http.MethodPost, "/invites", handlers.IssuePayload{
+		Uses:       3,
+		ExpiresAt:  &expires,
+		Email:      "vip@example.com",
+		Note:       "launch",
+		Groups:     []string{"beta"},
+		Attributes: map[string]string{"team": "a"},
+		Send:       true,
+		Locale:     "de",
+	}, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("issue status = %d: %s", rec.Code, rec.Body)
+	}
+	issued := decode[handlers.IssueResponse](t, rec)
+	if !issued.Sent || len(d.msgs) != 1 || d.msgs[0].Locale != "de" || d.msgs[0].To != "vip@example.com" {
+		t.Errorf("want the invite mailed in de, sent=%v msgs=%+v", issued.Sent, d.msgs)
+	}
+	want := handlers.Invite{
+		Code:       issued.Invite.Code,
+		Note:       "launch",
+		Email:      "vip@example.com",
+		UsesLeft:   3,
+		ExpiresAt:  &expires,
+		CreatedAt:  issued.Invite.CreatedAt,
+		Groups:     []string{"beta"},
+		Attributes: map[string]string{"team": "a"},
+	}
+	if diff := cmp.Diff(want, issued.Invite); diff != "" {
+		t.Errorf("issued invite mismatch (-want +got):\n%s", diff)
+	}
+
+	rec = do(t, h.RevokeHandler(), http.MethodPost, "/invites/revoke", handlers.CodePayload{Code: want.Code}, nil)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("revoke status = %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = do(t, h.ListHandler(), http.MethodGet, "/invites", nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list status = %d: %s", rec.Code, rec.Body)
+	}
+	want.Revoked = true
+	if diff := cmp.Diff(handlers.ListResponse{Invites: []handlers.Invite{want}}, decode[handlers.ListResponse](t, rec)); diff != "" {
+		t.Errorf("list mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSendHandler(t *testing.T) {
+	h, d := newFixture(t, invite.Opts{})
+	bound, _ := h.Service.Issue(invite.IssueOpts{Email: "vip@example.com"})
+	unbound, _ := h.Service.Issue(invite.IssueOpts{})
+
+	req := func(r *http.Request) *http.Request {
+		r.Header.Set("Accept-Language", "de-CH, en;q=0.5")
+		return r
+	}
+	rec := do(t, h.SendHandler(), http.MethodPost, "/invites/send", handlers.CodePayload{Code: bound.Code}, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("send status = %d: %s", rec.Code, rec.Body)
+	}
+	if len(d.msgs) != 1 || d.msgs[0].Locale != "de-CH" || d.msgs[0].Code != bound.Code {
+		t.Errorf("want one message in the request's language, got %+v", d.msgs)
+	}
+
+	tcs := []struct {
+		name string
+		code string
+		want int
+	}{
+		{name: "unbound", code: unbound.Code, want: http.StatusConflict},
+		{name: "unknown", code: "nope", want: http.StatusNotFound},
+		{name: "missing code", want: http.StatusBadRequest},
+	}
+	for _, tc := range tcs {
+		rec := do(t, h.SendHandler(), http.MethodPost, "/invites/send", handlers.CodePayload{Code: tc.code}, nil)
+		if rec.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+
+	noDeliver := &handlers.JSON{Service: invite.New(memory.New(), invite.Opts{}), Logger: slog.New(slog.DiscardHandler)}
+	inv, _ := noDeliver.Service.Issue(invite.IssueOpts{Email: "vip@example.com"})
+	if rec := do(t, noDeliver.SendHandler(), http.MethodPost, "/", handlers.CodePayload{Code: inv.Code}, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("without a Deliverer: status = %d, want 404", rec.Code)
+	}
+	rec = do(t, noDeliver.IssueHandler(), http.MethodPost, "/", handlers.IssuePayload{Email: "x@example.com", Send: true}, nil)
+	if rec.Code != http.StatusCreated || decode[handlers.IssueResponse](t, rec).Sent {
+		t.Errorf("a failed send must still issue, unsent: status = %d", rec.Code)
+	}
+}
+
+func TestIssueHandlerErrors(t *testing.T) {
+	h, _ := newFixture(t, invite.Opts{})
+	past := time.Now().Add(-time.Minute)
+	tcs := []struct {
+		name   string
+		method string
+		body   any
+		want   int
+	}{
+		{name: "GET", method: http.MethodGet, want: http.StatusMethodNotAllowed},
+		{name: "malformed", method: http.MethodPost, body: "not an object", want: http.StatusBadRequest},
+		{name: "negative uses", method: http.MethodPost, body: handlers.IssuePayload{Uses: -1}, want: http.StatusBadRequest},
+		{name: "past expiry", method: http.MethodPost, body: handlers.IssuePayload{ExpiresAt: &past}, want: http.StatusBadRequest},
+		{name: "send without email", method: http.MethodPost, body: handlers.IssuePayload{Send: true}, want: http.StatusBadRequest},
+		{name: "defaults", method: http.MethodPost, body: handlers.IssuePayload{}, want: http.StatusCreated},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := do(t, h.IssueHandler(), tc.method, "/invites", tc.body, nil)
+			if rec.Code != tc.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tc.want, rec.Body)
+			}
+		})
+	}
+	if rec := do(t, h.ListHandler(), http.MethodPost, "/invites", nil, nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST list: status = %d, want 405", rec.Code)
+	}
+	if rec := do(t, h.RevokeHandler(), http.MethodPost, "/", handlers.CodePayload{Code: "nope"}, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("revoke unknown: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestReferral(t *testing.T) {
+	h, d := newFixture(t, invite.Opts{ReferralQuota: 2})
+
+	rec := do(t, h.ReferHandler(), http.MethodPost, "/referrals", handlers.ReferPayload{Email: "bob@example.com", Send: true}, as("u-alice"))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("refer status = %d: %s", rec.Code, rec.Body)
+	}
+	first := decode[handlers.IssueResponse](t, rec)
+	if first.Invite.IssuedBy != "u-alice" || first.Invite.UsesLeft != 1 || first.Invite.ExpiresAt == nil || !first.Sent || len(d.msgs) != 1 {
+		t.Errorf("unexpected referral %+v", first)
+	}
+	// a referral grants nothing, whatever the client sends
+	rec = do(t, h.ReferHandler(), http.MethodPost, "/referrals", map[string]any{"groups": []string{"admin"}}, as("u-alice"))
+	if rec.Code != http.StatusCreated || decode[handlers.IssueResponse](t, rec).Invite.Groups != nil {
+		t.Errorf("want a plain referral, status = %d", rec.Code)
+	}
+	rec = do(t, h.ReferHandler(), http.MethodPost, "/referrals", handlers.ReferPayload{}, as("u-alice"))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("over quota: status = %d, want 403", rec.Code)
+	}
+
+	rec = do(t, h.ReferralsHandler(), http.MethodGet, "/referrals", nil, as("u-alice"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("referrals status = %d: %s", rec.Code, rec.Body)
+	}
+	got := decode[handlers.ReferralsResponse](t, rec)
+	if len(got.Invites) != 2 || got.Remaining != 0 || got.Invites[0].Code != first.Invite.Code {
+		t.Errorf("unexpected referrals %+v", got)
+	}
+	rec = do(t, h.ReferralsHandler(), http.MethodGet, "/referrals", nil, as("u-bob"))
+	if got := decode[handlers.ReferralsResponse](t, rec); len(got.Invites) != 0 || got.Remaining != 2 {
+		t.Errorf("bob: want none issued and full quota, got %+v", got)
+	}
+}
+
+func TestReferralErrors(t *testing.T) {
+	h, _ := newFixture(t, invite.Opts{ReferralQuota: 1})
+	disabled, _ := newFixture(t, invite.Opts{})
+	tcs := []struct {
+		name    string
+		handler http.Handler
+		method  string
+		body    any
+		mod     func(*http.Request) *http.Request
+		want    int
+	}{
+		{name: "refer anonymous", handler: h.ReferHandler(), method: http.MethodPost, body: handlers.ReferPayload{}, want: http.StatusUnauthorized},
+		{name: "list anonymous", handler: h.ReferralsHandler(), method: http.MethodGet, want: http.StatusUnauthorized},
+		{name: "refer disabled", handler: disabled.ReferHandler(), method: http.MethodPost, body: handlers.ReferPayload{}, mod: as("u-alice"), want: http.StatusNotFound},
+		{name: "list disabled", handler: disabled.ReferralsHandler(), method: http.MethodGet, mod: as("u-alice"), want: http.StatusNotFound},
+		{name: "send without email", handler: h.ReferHandler(), method: http.MethodPost, body: handlers.ReferPayload{Send: true}, mod: as("u-alice"), want: http.StatusBadRequest},
+		{name: "refer GET", handler: h.ReferHandler(), method: http.MethodGet, mod: as("u-alice"), want: http.StatusMethodNotAllowed},
+		{name: "list POST", handler: h.ReferralsHandler(), method: http.MethodPost, mod: as("u-alice"), want: http.StatusMethodNotAllowed},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := do(t, tc.handler, tc.method, "/referrals", tc.body, tc.mod)
+			if rec.Code != tc.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tc.want, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+// Package invite manages invite codes for gated user registration.
+//
+// The Service owns the policy (code generation, defaults, referral quotas);
+// persistence is delegated to a Store. Invites are issued, listed and
+// revoked independently of any registration flow — by admins, through
+// invite/handlers, and, in referral mode, by users themselves — and the
+// register package consumes them through a small interface at account
+// creation time.
+//
+// An invite can grant the account it creates groups and attributes, and
+// records the login ID of every account that accepted it. Invites bound to
+// an email can be sent there, and sent again, through a Deliverer.
+//
+// Codes are stored in plaintext, deliberately: unlike one-time verification
+// codes they must be listable by an admin, and they are long random strings
+// (default 12 alphanumeric characters, ~62 bits of entropy), not user
+// secrets derived from a small space.
+package invite
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"maps"
+	"math/big"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-bumbu/userauth/service/verificationcode"
+)
+
+// DefaultCodeLength is the length of generated invite codes.
+const DefaultCodeLength = 12
+
+// DefaultReferralExpiry is the lifetime of a referral invite.
+const DefaultReferralExpiry = 14 * 24 * time.Hour
+
+const codeCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// ErrInviteNotFound is returned by Store.Get when no invite has the code.
+var ErrInviteNotFound = errors.New("invite not found")
+
+// Errors returned by Send.
+var (
+	ErrNoDeliverer = errors.New("invite: no Deliverer configured")
+	ErrNoEmail     = errors.New("invite: not bound to an email")
+	ErrNotUsable   = errors.New("invite: revoked, expired or used up")
+)
+
+// Errors returned by Refer and Referrals.
+var (
+	ErrReferralDisabled = errors.New("invite: referrals are disabled")
+	ErrQuotaExceeded    = errors.New("invite: referral quota exhausted")
+)
+
+// Invite is one invite code with its usage constraints.
+type Invite struct {
+	Code      string    // the plaintext code handed to the invitee
+	Note      string    // optional admin note (who it is for, campaign, …)
+	Email     string    // optional binding: only this email may consume it
+	UsesLeft  int       // remaining uses; issued with at least 1
+	ExpiresAt time.Time // zero means the invite never expires
+	CreatedAt time.Time
+	Revoked   bool
+	// Groups and Attributes are granted to every account created with the
+	// invite.
+	Groups     []string
+	Attributes map[string]string
+	// Accepted lists the accounts created with the invite, oldest first.
+	Accepted []Acceptance
+	// IssuedBy is the user ID of the user who issued a referral invite;
+	// empty for invites issued by an admin.
+	IssuedBy string
+}
+
+// Acceptance records one account created with an invite.
+type Acceptance struct {
+	LoginID string
+	At      time.Time
+}
+
+// Usable reports whether the invite can still be consumed by the given
+// email at time now. Store implementations use it to keep Consume semantics
+// consistent.
+func (i Invite) Usable(email string, now time.Time) bool {
+	if i.Revoked || i.UsesLeft <= 0 {
+		return false
+	}
+	if !i.ExpiresAt.IsZero() && now.After(i.ExpiresAt) {
+		return false
+	}
+	if i.Email != "" && i.Email != email {
+		return false
+	}
+	return true
+}
+
+// Store is pure persistence for invites; it never generates codes.
+//
+// Consume must atomically decrement UsesLeft of a usable invite (not
+// revoked, not expired, uses left, matching email binding) and, when
+// acceptedBy is set, append an Acceptance for it in the same step. It
+// returns the invite as consumed, or (false, nil) for any
+// invalid-code-shaped reason — unknown code included — and reserves errors
+// for storage failures. Accepted is only ever appended to by Consume; Save
+// leaves it as stored.
+//
+// ListIssuedBy returns the invites with the given IssuedBy, oldest first;
+// it backs referral quotas.
+type Store interface {
+	Save(inv Invite) error
+	Get(code string) (Invite, error)
+	List() ([]Invite, error)
+	ListIssuedBy(userID string) ([]Invite, error)
+	Delete(code string) error
+	Consume(code, email, acceptedBy string) (Invite, bool, error)
+}
+
+// Opts configures a Service. Zero-valued fields fall back to defaults.
+type Opts struct {
+	CodeLength int // generated code length; default DefaultCodeLength
+	// Deliver sends invites for Send (PurposeInvite); nil disables Send.
+	Deliver verificationcode.Deliverer
+	// Link, when set, builds the registration URL sent with the code,
+	// e.g. func(code string) string { return base + "?invite=" + code }.
+	Link func(code string) string
+	// ReferralQuota is how many invites each user may issue with Refer over
+	// their lifetime; zero disables referrals.
+	ReferralQuota int
+	// ReferralExpiry is the lifetime of a referral invite; default
+	// DefaultReferralExpiry.
+	ReferralExpiry time.Duration
+}
+
+// Service owns invite policy: code generation, defaults and referral
+// quotas. Persistence is delegated to a Store. It satisfies the register
+// package's InviteConsumer and InviteRedeemer.
+type Service struct {
+	store          Store
+	codeLen        int
+	deliver        verificationcode.Deliverer
+	link           func(code string) string
+	referralQuota  int
+	referralExpiry time.Duration
+
+	referMu sync.Mutex // serializes Refer's count-then-save
+}
+
+// New wires the service to a Store and applies defaults for zero-valued
+// options.
+func New(store Store, opts Opts) *Service {
+	if opts.CodeLength <= 0 {
+		opts.CodeLength = DefaultCodeLength
+	}
+	if opts.ReferralExpiry <= 0 {
+		opts.ReferralExpiry = DefaultReferralExpiry
+	}
+	return &Service{
+		store:          store,
+		codeLen:        opts.CodeLength,
+		deliver:        opts.Deliver,
+		link:           opts.Link,
+		referralQuota:  opts.ReferralQuota,
+		referralExpiry: opts.ReferralExpiry,
+	}
+}
+
+// IssueOpts describes the invite to create. Zero-valued fields mean:
+// single use, no expiry, no email binding, no note, no grants.
+type IssueOpts struct {
+	Uses      int       // number of allowed uses; <=0 means 1
+	ExpiresAt time.Time // zero means never expires
+	Email     string    // optional: bind the invite to one email
+	Note      string    // optional admin note
+	// Groups and Attributes are granted to the accounts created with the
+	// invite. Attributes bypass the registration's attribute schema: they
+	// come from an admin, not the registrant.
+	Groups     []string
+	Attributes map[string]string
+	// IssuedBy records the issuing user; Refer sets it.
+	IssuedBy string
+}
+
+// Issue generates a fresh code and persists the invite.
+func (s *Service) Issue(opts IssueOpts) (Invite, error) {
+	code, err := generateCode(s.codeLen)
+	if err != nil {
+		return Invite{}, err
+	}
+	inv := Invite{
+		Code:       code,
+		Note:       opts.Note,
+		Email:      opts.Email,
+		UsesLeft:   opts.Uses,
+		ExpiresAt:  opts.ExpiresAt,
+		CreatedAt:  time.Now().UTC(),
+		Groups:     slices.Clone(opts.Groups),
+		Attributes: maps.Clone(opts.Attributes),
+		IssuedBy:   opts.IssuedBy,
+	}
+	if inv.UsesLeft <= 0 {
+		inv.UsesLeft = 1
+	}
+	if err := s.store.Save(inv); err != nil {
+		return Invite{}, err
+	}
+	return inv, nil
+}
+
+// List returns all invites, including revoked and exhausted ones.
+func (s *Service) List() ([]Invite, error) {
+	return s.store.List()
+}
+
+// ReferOpts describes a referral invite. A referral is always single use,
+// expires after Opts.ReferralExpiry and grants nothing: a user cannot hand
+// out more than an ordinary account.
+type ReferOpts struct {
+	Email string // optional: bind the invite to one email
+	Note  string // optional note for the issuing user
+}
+
+// Refer issues a referral invite on behalf of userID, recorded as its
+// IssuedBy, and counts it against the user's quota. It returns
+// ErrReferralDisabled when Opts.ReferralQuota is zero and ErrQuotaExceeded
+// once the user has issued their quota; revoked and expired referrals still
+// count.
+//
+// Refer is serialized within one Service. Instances sharing a store can
+// race on the quota and overshoot it by at most the number of concurrent
+// requests.
+func (s *Service) Refer(userID string, opts ReferOpts) (Invite, error) {
+	if s.referralQuota <= 0 {
+		return Invite{}, ErrReferralDisabled
+	}
+	if userID == "" {
+		return Invite{}, errors.New("invite: referral without a user")
+	}
+	s.referMu.Lock()
+	defer s.referMu.Unlock()
+	_, left, err := s.Referrals(userID)
+	if err != nil {
+		return Invite{}, err
+	}
+	if left <= 0 {
+		return Invite{}, ErrQuotaExceeded
+	}
+	return s.Issue(IssueOpts{
+		Uses:      1,
+		ExpiresAt: time.Now().Add(s.referralExpiry),
+		Email:     opts.Email,
+		Note:      opts.Note,
+		IssuedBy:  userID,
+	})
+}
+
+// Referrals returns the invites userID issued, oldest first, and how many
+// more they may issue. It returns ErrReferralDisabled when
+// Opts.ReferralQuota is zero.
+func (s *Service) Referrals(userID string) (invites []Invite, remaining int, err error) {
+	if s.referralQuota <= 0 {
+		return nil, 0, ErrReferralDisabled
+	}
+	invites, err = s.store.ListIssuedBy(userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	return invites, max(s.referralQuota-len(invites), 0), nil
+}
+
+// Revoke marks the invite as no longer consumable. Revoking an unknown code
+// returns ErrInviteNotFound.
+func (s *Service) Revoke(code string) error {
+	inv, err := s.store.Get(code)
+	if err != nil {
+		return err
+	}
+	inv.Revoked = true
+	return s.store.Save(inv)
+}
+
+// Validate reports whether the code could currently be consumed by the given
+// email. It is a read-only courtesy check: only Consume is authoritative.
+// Any invalid-code-shaped reason yields (false, nil).
+func (s *Service) Validate(code, email string) (bool, error) {
+	inv, err := s.store.Get(code)
+	if err != nil {
+		if errors.Is(err, ErrInviteNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return inv.Usable(email, time.Now()), nil
+}
+
+// Consume atomically uses up one use of the invite. It returns (false, nil)
+// when the invite is unknown, revoked, expired, exhausted, or bound to a
+// different email.
+func (s *Service) Consume(code, email string) (bool, error) {
+	_, ok, err := s.store.Consume(code, email, "")
+	return ok, err
+}
+
+// Redeem consumes like Consume, records loginID as accepting the invite and
+// returns the groups and attributes it grants and, for a referral, the
+// issuing user.
+func (s *Service) Redeem(code, email, loginID string) (groups []string, attributes map[string]string, invitedBy string, ok bool, err error) {
+	inv, ok, err := s.store.Consume(code, email, loginID)
+	if err != nil || !ok {
+		return nil, nil, "", ok, err
+	}
+	return inv.Groups, inv.Attributes, inv.IssuedBy, true, nil
+}
+
+// Send delivers the invite to its bound email, with the registration link
+// when Opts.Link is set; calling it again resends. The message language is
+// the context's (verificationcode.WithLocale). It returns ErrNoDeliverer
+// without Opts.Deliver, ErrInviteNotFound, ErrNoEmail for an unbound invite
+// and ErrNotUsable for one that can no longer be used.
+func (s *Service) Send(ctx context.Context, code string) error {
+	if s.deliver == nil {
+		return ErrNoDeliverer
+	}
+	inv, err := s.store.Get(code)
+	if err != nil {
+		return err
+	}
+	if inv.Email == "" {
+		return ErrNoEmail
+	}
+	if !inv.Usable(inv.Email, time.Now()) {
+		return ErrNotUsable
+	}
+	msg := verificationcode.Message{
+		To:        inv.Email,
+		Code:      inv.Code,
+		ExpiresAt: inv.ExpiresAt,
+		Purpose:   verificationcode.PurposeInvite,
+		Locale:    verificationcode.LocaleFromContext(ctx),
+	}
+	if s.link != nil {
+		msg.Link = s.link(inv.Code)
+	}
+	if err := s.deliver.Deliver(ctx, msg); err != nil {
+		return fmt.Errorf("invite: deliver: %w", err)
+	}
+	return nil
+}
+
+func generateCode(length int) (string, error) {
+	b := make([]byte, length)
+	max := big.NewInt(int64(len(codeCharset)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("invite: generate code: %w", err)
+		}
+		b[i] = codeCharset[n.Int64()]
+	}
+	return string(b), nil
+}
@@ -0,0 +1,321 @@
+package invite_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-bumbu/userauth/service/invite"
+	"github.com/go-bumbu/userauth/service/invite/memory"
+	"github.com/go-bumbu/userauth/service/verificationcode"
+	"github.com/google/go-cmp/cmp"
+)
+
+func newService(t *testing.T, opts invite.Opts) *invite.Service {
+	t.Helper()
+	return invite.New(memory.New(), opts)
+}
+
+func TestIssueDefaults(t *testing.T) {
+	svc := newService(t, invite.Opts{})
+	inv, err := svc.Issue(invite.IssueOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inv.Code) != invite.DefaultCodeLength {
+		t.Errorf("want code length %d, got %d", invite.DefaultCodeLength, len(inv.Code))
+	}
+	if inv.UsesLeft != 1 {
+		t.Errorf("want 1 use by default, got %d", inv.UsesLeft)
+	}
+	if !inv.ExpiresAt.IsZero() {
+		t.Errorf("want no expiry by default, got %v", inv.ExpiresAt)
+	}
+}
+
+func TestIssueCustomLength(t *testing.T) {
+	svc := newService(t, invite.Opts{CodeLength: 20})
+	inv, err := svc.Issue(invite.IssueOpts{Uses: 5, Note: "team A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inv.Code) != 20 {
+		t.Errorf("want code length 20, got %d", len(inv.Code))
+	}
+	if inv.UsesLeft != 5 {
+		t.Errorf("want 5 uses, got %d", inv.UsesLeft)
+	}
+	if inv.Note != "team A" {
+		t.Errorf("want note kept, got %q", inv.Note)
+	}
+}
+
+func TestValidateAndConsume(t *testing.T) {
+	tcs := []struct {
+		name  string
+		issue invite.IssueOpts
+		code  func(issued string) string // code submitted; default = issued
+		email string
+		want  bool
+	}{
+		{name: "valid single use", issue: invite.IssueOpts{}, want: true},
+		{name: "unknown code", issue: invite.IssueOpts{}, code: func(string) string { return "nope" }, want: false},
+		{name: "expired", issue: invite.IssueOpts{ExpiresAt: time.Now().Add(-time.Minute)}, want: false},
+		{name: "email bound match", issue: invite.IssueOpts{Email: "a@example.com"}, email: "a@example.com", want: true},
+		{name: "email bound mismatch", issue: invite.IssueOpts{Email: "a@example.com"}, email: "b@example.com", want: false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := newService(t, invite.Opts{})
+			inv, err := svc.Issue(tc.issue)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code := inv.Code
+			if tc.code != nil {
+				code = tc.code(inv.Code)
+			}
+
+			ok, err := svc.Validate(code, tc.email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tc.want {
+				t.Errorf("Validate: want %v, got %v", tc.want, ok)
+			}
+			ok, err = svc.Consume(code, tc.email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tc.want {
+				t.Errorf("Consume: want %v, got %v", tc.want, ok)
+			}
+		})
+	}
+}
+
+func TestConsumeExhausts(t *testing.T) {
+	svc := newService(t, invite.Opts{})
+	inv, err := svc.Issue(invite.IssueOpts{Uses: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		ok, err := svc.Consume(inv.Code, "")
+		if err != nil || !ok {
+			t.Fatalf("consume %d: want ok, got ok=%v err=%v", i+1, ok, err)
+		}
+	}
+	ok, err := svc.Consume(inv.Code, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("want exhausted invite to be rejected")
+	}
+	if ok, _ := svc.Validate(inv.Code, ""); ok {
+		t.Error("want exhausted invite to fail validation")
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	svc := newService(t, invite.Opts{})
+	inv, err := svc.Issue(invite.IssueOpts{Uses: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Revoke(inv.Code); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := svc.Validate(inv.Code, ""); ok {
+		t.Error("want revoked invite to fail validation")
+	}
+	if ok, _ := svc.Consume(inv.Code, ""); ok {
+		t.Error("want revoked invite to fail consumption")
+	}
+	if err := svc.Revoke("unknown"); err == nil {
+		t.Error("want error revoking unknown code")
+	}
+}
+
+func TestList(t *testing.T) {
+	svc := newService(t, invite.Opts{})
+	for i := 0; i < 3; i++ {
+		if _, err := svc.Issue(invite.IssueOpts{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err := svc.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 {
+		t.Errorf("want 3 invites, got %d", len(list))
+	}
+}
+
+func TestRedeem(t *testing.T) {
+	svc := newService(t, invite.Opts{})
+	inv, err := svc.Issue(invite.IssueOpts{
+		Uses:       2,
+		Groups:     []string{"beta"},
+		Attributes: map[string]string{"team": "a"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, attrs, invitedBy, ok, err := svc.Redeem(inv.Code, "alice@example.com", "alice")
+	if err != nil || !ok {
+		t.Fatalf("redeem: ok=%v err=%v", ok, err)
+	}
+	if diff := cmp.Diff([]string{"beta"}, groups); diff != "" {
+		t.Errorf("groups mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(map[string]string{"team": "a"}, attrs); diff != "" {
+		t.Errorf("attributes mismatch (-want +got):\n%s", diff)
+	}
+	if invitedBy != "" {
+		t.Errorf("admin invite: invitedBy = %q, want empty", invitedBy)
+	}
+	if _, _, _, ok, _ := svc.Redeem("bogus", "", "mallory"); ok {
+		t.Error("want an unknown code refused")
+	}
+
+	list, err := svc.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || len(list[0].Accepted) != 1 || list[0].Accepted[0].LoginID != "alice" || list[0].UsesLeft != 1 {
+		t.Errorf("want alice recorded and one use left, got %+v", list)
+	}
+}
+
+// captureDeliverer records delivered messages.
+type captureDeliverer struct {
+	msgs []verificationcode.Message
+	err  error
+}
+
+func (d *captureDeliverer) Deliver(_ context.Context, msg verificationcode.Message) error {
+	if d.err != nil {
+		return d.err
+	}
+	d.msgs = append(d.msgs, msg)
+	return nil
+}
+
+func TestSend(t *testing.T) {
+	d := &captureDeliverer{}
+	svc := newService(t, invite.Opts{
+		Deliver: d,
+		Link:    func(code string) string { return "https://example.com/register?invite=" + code },
+	})
+	expires := time.Now().Add(time.Hour)
+	bound, _ := svc.Issue(invite.IssueOpts{Email: "vip@example.com", ExpiresAt: expires})
+	unbound, _ := svc.Issue(invite.IssueOpts{})
+	revoked, _ := svc.Issue(invite.IssueOpts{Email: "gone@example.com"})
+	if err := svc.Revoke(revoked.Code); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := verificationcode.WithLocale(context.Background(), "de")
+	for range 2 { // send, then resend
+		if err := svc.Send(ctx, bound.Code); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := verificationcode.Message{
+		To:        "vip@example.com",
+		Code:      bound.Code,
+		ExpiresAt: expires,
+		Purpose:   verificationcode.PurposeInvite,
+		Locale:    "de",
+		Link:      "https://example.com/register?invite=" + bound.Code,
+	}
+	if diff := cmp.Diff([]verificationcode.Message{want, want}, d.msgs); diff != "" {
+		t.Errorf("messages mismatch (-want +got):\n%s", diff)
+	}
+
+	tcs := []struct {
+		name string
+		code string
+		want error
+	}{
+		{name: "unbound", code: unbound.Code, want: invite.ErrNoEmail},
+		{name: "revoked", code: revoked.Code, want: invite.ErrNotUsable},
+		{name: "unknown", code: "nope", want: invite.ErrInviteNotFound},
+	}
+	for _, tc := range tcs {
+		if err := svc.Send(ctx, tc.code); !errors.Is(err, tc.want) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+	d.err = errors.New("smtp down")
+	if err := svc.Send(ctx, bound.Code); err == nil {
+		t.Error("want the delivery failure returned")
+	}
+	if err := newService(t, invite.Opts{}).Send(ctx, bound.Code); !errors.Is(err, invite.ErrNoDeliverer) {
+		t.Errorf("without a Deliverer: err = %v, want ErrNoDeliverer", err)
+	}
+}
+
+func TestRefer(t *testing.T) {
+	svc := newService(t, invite.Opts{ReferralQuota: 2, ReferralExpiry: time.Hour})
+
+	first, err := svc.Refer("u-alice", invite.ReferOpts{Email: "bob@example.com", Note: "for bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.IssuedBy != "u-alice" || first.UsesLeft != 1 || first.Email != "bob@example.com" {
+		t.Errorf("unexpected referral %+v", first)
+	}
+	if d := time.Until(first.ExpiresAt); d <= 0 || d > time.Hour {
+		t.Errorf("want expiry within ReferralExpiry, got %v", d)
+	}
+	if _, err := svc.Refer("u-alice", invite.ReferOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Refer("u-alice", invite.ReferOpts{}); !errors.Is(err, invite.ErrQuotaExceeded) {
+		t.Errorf("third referral: err = %v, want ErrQuotaExceeded", err)
+	}
+	if err := svc.Revoke(first.Code); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Refer("u-alice", invite.ReferOpts{}); !errors.Is(err, invite.ErrQuotaExceeded) {
+		t.Errorf("revoking must not refund the quota, err = %v", err)
+	}
+
+	// quotas are per user, and admin invites do not count
+	if _, err := svc.Issue(invite.IssueOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	list, left, err := svc.Referrals("u-carol")
+	if err != nil || len(list) != 0 || left != 2 {
+		t.Errorf("carol: list=%v left=%d err=%v", list, left, err)
+	}
+	list, left, err = svc.Referrals("u-alice")
+	if err != nil || len(list) != 2 || left != 0 || list[0].Code != first.Code {
+		t.Errorf("alice: list=%+v left=%d err=%v", list, left, err)
+	}
+
+	_, _, invitedBy, ok, err := svc.Redeem(list[1].Code, "", "bob")
+	if err != nil || !ok || invitedBy != "u-alice" {
+		t.Errorf("redeem: invitedBy=%q ok=%v err=%v", invitedBy, ok, err)
+	}
+}
+
+func TestReferDisabled(t *testing.T) {
+	svc := newService(t, invite.Opts{})
+	if _, err := svc.Refer("u-alice", invite.ReferOpts{}); !errors.Is(err, invite.ErrReferralDisabled) {
+		t.Errorf("err = %v, want ErrReferralDisabled", err)
+	}
+	if _, _, err := svc.Referrals("u-alice"); !errors.Is(err, invite.ErrReferralDisabled) {
+		t.Errorf("Referrals: err = %v, want ErrReferralDisabled", err)
+	}
+	svc = newService(t, invite.Opts{ReferralQuota: 1})
+	if _, err := svc.Refer("", invite.ReferOpts{}); err == nil {
+		t.Error("want an error without a user")
+	}
+}
@@ -0,0 +1,110 @@
+// Package memory provides an in-memory invite.Store. Safe for concurrent
+// use. Suitable for development and testing, or for single-instance
+// deployments.
+package memory
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-bumbu/userauth/service/invite"
+)
+
+// Store is an in-memory invite store.
+type Store struct {
+	mu    sync.Mutex
+	store map[string]invite.Invite
+}
+
+func New() *Store {
+	return &Store{store: make(map[string]invite.Invite)}
+}
+
+// Save stores the invite; its acceptances are kept from the stored copy.
+func (m *Store) Save(inv invite.Invite) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	inv.Accepted = m.store[inv.Code].Accepted
+	m.store[inv.Code] = inv
+	return nil
+}
+
+func (m *Store) Get(code string) (invite.Invite, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	inv, ok := m.store[code]
+	if !ok {
+		return invite.Invite{}, invite.ErrInviteNotFound
+	}
+	return inv, nil
+}
+
+func (m *Store) List() ([]invite.Invite, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]invite.Invite, 0, len(m.store))
+	for _, inv := range m.store {
+		out = append(out, inv)
+	}
+	return out, nil
+}
+
+// ListIssuedBy returns the invites issued by userID, oldest first.
+func (m *Store) ListIssuedBy(userID string) ([]invite.Invite, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []invite.Invite
+	for _, inv := range m.store {
+		if inv.IssuedBy == userID {
+			out = append(out, inv)
+		}
+	}
+	slices.SortFunc(out, func(a, b invite.Invite) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return out, nil
+}
+
+func (m *Store) Delete(code string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.store, code)
+	return nil
+}
+
+// Consume atomically decrements UsesLeft of a usable invite and records the
+// acceptance; the mutex makes the check-and-decrement atomic.
+func (m *Store) Consume(code, email, acceptedBy string) (invite.Invite, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	inv, ok := m.store[code]
+	now := time.Now()
+	if !ok || !inv.Usable(email, now) {
+		return invite.Invite{}, false, nil
+	}
+	inv.UsesLeft--
+	if acceptedBy != "" {
+		// clip: never append into a backing array a caller still holds
+		inv.Accepted = append(slices.Clip(inv.Accepted), invite.Acceptance{LoginID: acceptedBy, At: now.UTC()})
+	}
+	m.store[code] = inv
+	return inv, true, nil
+}
+
+// Sweep removes invites past their expiry; invites without one are kept.
+func (m *Store) Sweep(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for code, inv := range m.store {
+		if !inv.ExpiresAt.IsZero() && now.After(inv.ExpiresAt) {
+			delete(m.store, code)
+			n++
+		}
+	}
+	return n, nil
+}
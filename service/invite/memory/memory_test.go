@@ -1,13 +1,14 @@
 package memory_test
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"testing"
 	"time"
 
-	"github.com/go-bumbu/userauth/flow/register/invite"
-	"github.com/go-bumbu/userauth/flow/register/invite/memory"
+	"github.com/go-bumbu/userauth/service/invite"
+	"github.com/go-bumbu/userauth/service/invite/memory"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -59,7 +60,7 @@ func TestStore(t *testing.T) {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				ok, err := store.Consume("once", "")
+				_, ok, err := store.Consume("once", "", "")
 				if err != nil {
 					t.Error(err)
 				}
@@ -80,6 +81,33 @@ func TestStore(t *testing.T) {
 	})
 }
 
+func TestAcceptances(t *testing.T) {
+	store := memory.New()
+	if err := store.Save(invite.Invite{Code: "team", UsesLeft: 2, Groups: []string{"staff"}}); err != nil {
+		t.Fatal(err)
+	}
+	inv, ok, err := store.Consume("team", "", "alice")
+	if err != nil || !ok {
+		t.Fatalf("consume: ok=%v err=%v", ok, err)
+	}
+	if len(inv.Accepted) != 1 || inv.Accepted[0].LoginID != "alice" || inv.Groups[0] != "staff" {
+		t.Fatalf("unexpected consumed invite %+v", inv)
+	}
+	// Save, e.g. from Revoke, leaves the acceptances alone
+	inv.Accepted = nil
+	inv.Revoked = true
+	if err := store.Save(inv); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Get("team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Accepted) != 1 || !got.Revoked {
+		t.Errorf("want the acceptance kept on a revoked invite, got %+v", got)
+	}
+}
+
 func TestList(t *testing.T) {
 	store := memory.New()
 	got, err := store.List()
@@ -115,3 +143,54 @@ func TestList(t *testing.T) {
 		}
 	}
 }
+
+func TestListIssuedBy(t *testing.T) {
+	store := memory.New()
+	now := time.Now()
+	for i, inv := range []invite.Invite{
+		{Code: "r2", UsesLeft: 1, IssuedBy: "u-alice"},
+		{Code: "admin", UsesLeft: 1},
+		{Code: "r1", UsesLeft: 1, IssuedBy: "u-alice"},
+		{Code: "r3", UsesLeft: 1, IssuedBy: "u-bob"},
+	} {
+		inv.CreatedAt = now.Add(-time.Duration(i) * time.Minute)
+		if err := store.Save(inv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := store.ListIssuedBy("u-alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var codes []string
+	for _, inv := range got {
+		codes = append(codes, inv.Code)
+	}
+	if diff := cmp.Diff([]string{"r1", "r2"}, codes); diff != "" {
+		t.Errorf("want oldest first (-want +got):\n%s", diff)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	store := memory.New()
+	now := time.Now()
+	_ = store.Save(invite.Invite{Code: "open", UsesLeft: 1})
+	_ = store.Save(invite.Invite{Code: "live", UsesLeft: 1, ExpiresAt: now.Add(time.Hour)})
+	_ = store.Save(invite.Invite{Code: "expired", UsesLeft: 1, ExpiresAt: now.Add(-time.Hour)})
+
+	n, err := store.Sweep(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("removed %d invites, want 1", n)
+	}
+	if _, err := store.Get("expired"); !errors.Is(err, invite.ErrInviteNotFound) {
+		t.Errorf("want ErrInviteNotFound for the swept invite, got %v", err)
+	}
+	for _, code := range []string{"open", "live"} {
+		if _, err := store.Get(code); err != nil {
+			t.Errorf("invite %q must survive the sweep: %v", code, err)
+		}
+	}
+}
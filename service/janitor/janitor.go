@@ -0,0 +1,127 @@
+// Package janitor removes expired state on a schedule. Every store that
+// keeps expiring records implements userauth.Sweeper; a Janitor calls a
+// set of them on an interval until its context is cancelled, logging and
+// reporting how many records each removed.
+//
+//	j, err := janitor.New(janitor.Opts{Logger: logger},
+//		janitor.Task{Name: "login_attempts", Sweeper: attempts},
+//		janitor.Task{Name: "login_throttle", Sweeper: throttleStore},
+//		janitor.Task{Name: "users", Sweeper: userStore},
+//		janitor.Task{Name: "sessions", Sweeper: cookieauth.FsSweeper{Path: dir}},
+//	)
+//	go j.Run(ctx)
+//
+// Sweeping is housekeeping: stores already ignore expired records on read,
+// so a janitor that is late or down costs space, never security. With
+// several instances sharing one database, running it on every instance is
+// harmless (deletes are idempotent) but one is enough.
+package janitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-bumbu/userauth"
+)
+
+// DefaultInterval is the time between sweeps.
+const DefaultInterval = 10 * time.Minute
+
+// Task is one store to sweep; Name labels it in logs and results.
+type Task struct {
+	Name    string
+	Sweeper userauth.Sweeper
+}
+
+// Result is the outcome of sweeping one Task.
+type Result struct {
+	Name    string
+	Removed int
+	Err     error
+}
+
+// Opts configures a Janitor. Zero-valued fields fall back to defaults.
+type Opts struct {
+	Interval time.Duration // time between sweeps; default DefaultInterval
+	// Report, when set, receives the results of every sweep (metrics,
+	// tests). It runs on the sweeping goroutine.
+	Report func([]Result)
+	Logger *slog.Logger
+}
+
+// Janitor sweeps a fixed set of tasks.
+type Janitor struct {
+	tasks    []Task
+	interval time.Duration
+	report   func([]Result)
+	logger   *slog.Logger
+}
+
+// New validates the tasks and returns a Janitor.
+func New(opts Opts, tasks ...Task) (*Janitor, error) {
+	if len(tasks) == 0 {
+		return nil, errors.New("janitor: at least one task is required")
+	}
+	for i, t := range tasks {
+		if t.Name == "" || t.Sweeper == nil {
+			return nil, fmt.Errorf("janitor: task %d needs a Name and a Sweeper", i)
+		}
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.DiscardHandler)
+	}
+	return &Janitor{
+		tasks:    tasks,
+		interval: opts.Interval,
+		report:   opts.Report,
+		logger:   opts.Logger,
+	}, nil
+}
+
+// Sweep runs every task once, in order. A failing task does not stop the
+// others; its error is logged and returned in its Result. Cancelling ctx
+// stops the sweep before the next task, and the results cover only the
+// tasks that ran.
+func (j *Janitor) Sweep(ctx context.Context) []Result {
+	results := make([]Result, 0, len(j.tasks))
+	for _, t := range j.tasks {
+		if ctx.Err() != nil {
+			break
+		}
+		n, err := t.Sweeper.Sweep(ctx)
+		results = append(results, Result{Name: t.Name, Removed: n, Err: err})
+		switch {
+		case err != nil:
+			j.logger.Error("janitor: sweep failed", "task", t.Name, "removed", n, "err", err)
+		case n > 0:
+			j.logger.Info("janitor: swept expired records", "task", t.Name, "removed", n)
+		default:
+			j.logger.Debug("janitor: nothing to sweep", "task", t.Name)
+		}
+	}
+	if j.report != nil {
+		j.report(results)
+	}
+	return results
+}
+
+// Run sweeps immediately and then every Interval until ctx is cancelled.
+// It blocks; start it on its own goroutine.
+func (j *Janitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		j.Sweep(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package janitor_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-bumbu/userauth/service/janitor"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// fakeSweeper removes n records per call, or fails with err.
+type fakeSweeper struct {
+	n     int
+	err   error
+	calls atomic.Int32
+}
+
+func (f *fakeSweeper) Sweep(context.Context) (int, error) {
+	f.calls.Add(1)
+	return f.n, f.err
+}
+
+func TestNew(t *testing.T) {
+	tcs := []struct {
+		name  string
+		tasks []janitor.Task
+	}{
+		{name: "no tasks"},
+		{name: "unnamed task", tasks: []janitor.Task{{Sweeper: &fakeSweeper{}}}},
+		{name: "nil sweeper", tasks: []janitor.Task{{Name: "x"}}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := janitor.New(janitor.Opts{}, tc.tasks...); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestSweep(t *testing.T) {
+	boom := errors.New("boom")
+	failing := &fakeSweeper{n: 1, err: boom}
+	after := &fakeSweeper{n: 3}
+	var reported []janitor.Result
+	j, err := janitor.New(janitor.Opts{Report: func(r []janitor.Result) { reported = r }},
+		janitor.Task{Name: "failing", Sweeper: failing},
+		janitor.Task{Name: "after", Sweeper: after},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := j.Sweep(context.Background())
+	want := []janitor.Result{
+		{Name: "failing", Removed: 1, Err: boom},
+		{Name: "after", Removed: 3},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.EquateErrors()); diff != "" {
+		t.Errorf("results (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(want, reported, cmpopts.EquateErrors()); diff != "" {
+		t.Errorf("reported (-want +got):\n%s", diff)
+	}
+
+	t.Run("cancelled context stops before the next task", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if got := j.Sweep(ctx); len(got) != 0 {
+			t.Errorf("want no results, got %+v", got)
+		}
+	})
+}
+
+func TestRun(t *testing.T) {
+	s := &fakeSweeper{n: 1}
+	sweeps := make(chan int, 16)
+	j, err := janitor.New(janitor.Opts{
+		Interval: time.Millisecond,
+		Report: func(r []janitor.Result) {
+			select {
+			case sweeps <- len(r):
+			default: // never block Run once the test stops reading
+			}
+		},
+	}, janitor.Task{Name: "s", Sweeper: s})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		j.Run(ctx)
+		close(done)
+	}()
+	// the first sweep runs immediately, the next ones on the interval
+	for range 3 {
+		select {
+		case <-sweeps:
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for a sweep")
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+	if s.calls.Load() < 3 {
+		t.Errorf("sweeper called %d times, want at least 3", s.calls.Load())
+	}
+}
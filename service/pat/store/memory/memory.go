@@ -3,6 +3,7 @@
 package memory
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"sync"
@@ -88,3 +89,21 @@ func (s *Store) Touch(tokenID string, t time.Time) error {
 	s.recs[tokenID] = rec
 	return nil
 }
+
+// Sweep removes tokens past their expiry; tokens without one are kept.
+func (s *Store) Sweep(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for id, rec := range s.recs {
+		if rec.ExpiresAt != nil && now.After(*rec.ExpiresAt) {
+			delete(s.recs, id)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -1,7 +1,10 @@
 package memory_test
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/go-bumbu/userauth/service/pat"
 	"github.com/go-bumbu/userauth/service/pat/store/memory"
@@ -13,3 +16,29 @@ func TestConformance(t *testing.T) {
 		return memory.New()
 	})
 }
+
+func TestSweep(t *testing.T) {
+	s := memory.New()
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	for id, exp := range map[string]*time.Time{"forever": nil, "live": &future, "expired": &past} {
+		if err := s.Insert(pat.TokenRecord{TokenID: id, UserID: "user1", ExpiresAt: exp}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := s.Sweep(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("removed %d tokens, want 1", n)
+	}
+	if _, err := s.GetByTokenID("expired"); !errors.Is(err, pat.ErrTokenNotFound) {
+		t.Errorf("want ErrTokenNotFound for the swept token, got %v", err)
+	}
+	for _, id := range []string{"forever", "live"} {
+		if _, err := s.GetByTokenID(id); err != nil {
+			t.Errorf("token %q must survive the sweep: %v", id, err)
+		}
+	}
+}
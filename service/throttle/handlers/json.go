@@ -0,0 +1,236 @@
+// Package handlers provides admin JSON endpoints over a throttle.Backoff:
+// list recorded failure state, query one key, and reset it — for support
+// staff answering "why can't I log in?". The endpoints expose login
+// identifiers and client networks and can lift brute-force protection, so
+// mount them behind an admin check (authz.Middleware with
+// authz.RequireGroup, for instance); the package does no authorization of
+// its own.
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-bumbu/userauth/auth/csrf"
+	"github.com/go-bumbu/userauth/service/throttle"
+)
+
+// JSON exposes a throttle.Backoff as admin endpoints. Listing, and resetting
+// every method of a key at once, need a Store implementing throttle.Lister
+// (both bundled stores do).
+type JSON struct {
+	Backoff *throttle.Backoff
+	Logger  *slog.Logger
+	CSRF    *csrf.Protector // optional; the reset endpoint must pass its checks
+}
+
+// EntryStatus is one key and method as the Backoff sees it.
+type EntryStatus struct {
+	Key         string     `json:"key"`
+	Method      string     `json:"method"`
+	Failures    int        `json:"failures"`
+	LastFailure *time.Time `json:"last_failure,omitempty"`
+	NextAllowed *time.Time `json:"next_allowed,omitempty"` // absent = no delay applies
+	// WaitSeconds is the remaining delay, rounded up; 0 when an attempt
+	// is allowed now.
+	WaitSeconds int64 `json:"wait_seconds"`
+}
+
+// ListResponse is the body of a successful list.
+type ListResponse struct {
+	Entries []EntryStatus `json:"entries"`
+}
+
+// ResetPayload is the request body for ResetHandler. An empty Method
+// resets every method recorded for Key.
+type ResetPayload struct {
+	Key    string `json:"key"`
+	Method string `json:"method,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func toEntryStatus(st throttle.Status, now time.Time) EntryStatus {
+	out := EntryStatus{Key: st.Key, Method: st.Method, Failures: st.Count}
+	if !st.LastFailure.IsZero() {
+		last := st.LastFailure
+		out.LastFailure = &last
+	}
+	if !st.NextAllowed.IsZero() {
+		next := st.NextAllowed
+		out.NextAllowed = &next
+	}
+	if st.Active(now) {
+		out.WaitSeconds = int64(math.Ceil(st.NextAllowed.Sub(now).Seconds()))
+	}
+	return out
+}
+
+// ListHandler returns the GET endpoint listing failure state, most recent
+// failure first. Query parameters, all optional: key, method, active=true
+// (only entries that currently delay attempts) and limit.
+//
+// Responses:
+//   - 200 ListResponse
+//   - 400 for a malformed active or limit parameter
+//   - 405 for non-GET requests
+//   - 501 when the store cannot list
+//   - 500 for store failures
+func (h *JSON) ListHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		params := r.URL.Query()
+		q := throttle.Query{Key: params.Get("key"), Method: params.Get("method")}
+		if v := params.Get("active"); v != "" {
+			active, err := strconv.ParseBool(v)
+			if err != nil {
+				h.writeError(w, http.StatusBadRequest, "invalid active parameter")
+				return
+			}
+			q.Active = active
+		}
+		if v := params.Get("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 0 {
+				h.writeError(w, http.StatusBadRequest, "invalid limit parameter")
+				return
+			}
+			q.Limit = limit
+		}
+		sts, err := h.Backoff.List(q)
+		if err != nil {
+			h.writeBackoffError(w, err)
+			return
+		}
+		now := time.Now()
+		out := ListResponse{Entries: make([]EntryStatus, 0, len(sts))}
+		for _, st := range sts {
+			out.Entries = append(out.Entries, toEntryStatus(st, now))
+		}
+		h.writeJSON(w, http.StatusOK, out)
+	})
+}
+
+// StatusHandler returns the GET endpoint reporting one key and method
+// (both required query parameters). A key without failures answers 200
+// with zero failures.
+//
+// Responses:
+//   - 200 EntryStatus
+//   - 400 when key or method is missing
+//   - 405 for non-GET requests
+//   - 500 for store failures
+func (h *JSON) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		key, method := r.URL.Query().Get("key"), r.URL.Query().Get("method")
+		if key == "" || method == "" {
+			h.writeError(w, http.StatusBadRequest, "key and method are required")
+			return
+		}
+		st, err := h.Backoff.Status(key, method)
+		if err != nil {
+			h.writeBackoffError(w, err)
+			return
+		}
+		h.writeJSON(w, http.StatusOK, toEntryStatus(st, time.Now()))
+	})
+}
+
+// ResetHandler returns the POST endpoint clearing failure state, as if the
+// key had just succeeded. Resetting is idempotent: absent state is not an
+// error.
+//
+// Responses:
+//   - 204 on success
+//   - 400 for a malformed body or missing key
+//   - 405 for non-POST requests
+//   - 501 when method is empty and the store cannot list
+//   - 500 for store failures
+func (h *JSON) ResetHandler() http.Handler {
+	return h.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			h.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		var p ResetPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			h.writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if p.Key == "" {
+			h.writeError(w, http.StatusBadRequest, "key is required")
+			return
+		}
+		methods := []string{p.Method}
+		if p.Method == "" {
+			sts, err := h.Backoff.List(throttle.Query{Key: p.Key})
+			if err != nil {
+				h.writeBackoffError(w, err)
+				return
+			}
+			methods = methods[:0]
+			for _, st := range sts {
+				methods = append(methods, st.Method)
+			}
+		}
+		for _, m := range methods {
+			if err := h.Backoff.Success(p.Key, m); err != nil {
+				h.writeBackoffError(w, err)
+				return
+			}
+		}
+		h.logger().Info("throttle state reset", "key", p.Key, "methods", methods)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+// writeBackoffError maps Backoff errors to HTTP responses.
+func (h *JSON) writeBackoffError(w http.ResponseWriter, err error) {
+	if errors.Is(err, throttle.ErrNotListable) {
+		h.writeError(w, http.StatusNotImplemented, "store does not support listing")
+		return
+	}
+	h.logger().Error("throttle handler: internal error", "err", err)
+	h.writeError(w, http.StatusInternalServerError, "internal error")
+}
+
+func (h *JSON) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.logger().Error("throttle handler: encode response", "err", err)
+	}
+}
+
+func (h *JSON) writeError(w http.ResponseWriter, status int, msg string) {
+	h.writeJSON(w, status, errorResponse{Error: msg})
+}
+
+// protect wraps next in the CSRF middleware when one is configured.
+func (h *JSON) protect(next http.Handler) http.Handler {
+	if h.CSRF == nil {
+		return next
+	}
+	return h.CSRF.Middleware(next)
+}
+
+func (h *JSON) logger() *slog.Logger {
+	if h.Logger != nil {
+		return h.Logger
+	}
+	return slog.Default()
+}
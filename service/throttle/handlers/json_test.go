@@ -0,0 +1,166 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-bumbu/userauth/service/throttle"
+	"github.com/go-bumbu/userauth/service/throttle/handlers"
+	"github.com/go-bumbu/userauth/service/throttle/store/memory"
+	"github.com/google/go-cmp/cmp"
+)
+
+// newFixture returns handlers over a Backoff with one free failure and a
+// one-minute base delay. "bob" is delayed on totp and has a free failure on
+// recovery; "carol" is within her free failures.
+func newFixture(t *testing.T) (*handlers.JSON, *memory.Store) {
+	t.Helper()
+	store := memory.New()
+	now := time.Now()
+	_ = store.AddFailure("bob", "totp", now.Add(-2*time.Second))
+	_ = store.AddFailure("bob", "totp", now.Add(-time.Second))
+	_ = store.AddFailure("bob", "recovery", now.Add(-time.Hour))
+	_ = store.AddFailure("carol", "totp", now.Add(-time.Minute))
+	return &handlers.JSON{
+		Backoff: &throttle.Backoff{Store: store, FreeFailures: 1, BaseDelay: time.Minute},
+		Logger:  slog.New(slog.DiscardHandler),
+	}, store
+}
+
+func do(t *testing.T, h http.Handler, method, target string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, &buf))
+	return rec
+}
+
+func TestListHandler(t *testing.T) {
+	tcs := []struct {
+		name       string
+		target     string
+		wantStatus int
+		want       []string // key/method in response order
+	}{
+		{name: "all", target: "/throttle", wantStatus: http.StatusOK, want: []string{"bob/totp", "carol/totp", "bob/recovery"}},
+		{name: "by key", target: "/throttle?key=bob", wantStatus: http.StatusOK, want: []string{"bob/totp", "bob/recovery"}},
+		{name: "by method", target: "/throttle?method=totp", wantStatus: http.StatusOK, want: []string{"bob/totp", "carol/totp"}},
+		{name: "active only", target: "/throttle?active=true", wantStatus: http.StatusOK, want: []string{"bob/totp"}},
+		{name: "limit", target: "/throttle?limit=1", wantStatus: http.StatusOK, want: []string{"bob/totp"}},
+		{name: "bad active", target: "/throttle?active=maybe", wantStatus: http.StatusBadRequest},
+		{name: "bad limit", target: "/throttle?limit=-1", wantStatus: http.StatusBadRequest},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			h, _ := newFixture(t)
+			rec := do(t, h.ListHandler(), http.MethodGet, tc.target, nil)
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tc.wantStatus, rec.Body)
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			var resp handlers.ListResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			got := []string{}
+			for _, e := range resp.Entries {
+				got = append(got, e.Key+"/"+e.Method)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("entries mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("store without listing", func(t *testing.T) {
+		h := &handlers.JSON{Backoff: &throttle.Backoff{Store: struct{ throttle.Store }{memory.New()}}}
+		if rec := do(t, h.ListHandler(), http.MethodGet, "/throttle", nil); rec.Code != http.StatusNotImplemented {
+			t.Fatalf("status = %d, want 501", rec.Code)
+		}
+	})
+}
+
+func TestStatusHandler(t *testing.T) {
+	h, _ := newFixture(t)
+
+	rec := do(t, h.StatusHandler(), http.MethodGet, "/throttle/status?key=bob&method=totp", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var st handlers.EntryStatus
+	if err := json.NewDecoder(rec.Body).Decode(&st); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	// two failures, one free: the doubled two-minute delay from the last failure
+	if st.Failures != 2 || st.NextAllowed == nil || st.WaitSeconds < 118 || st.WaitSeconds > 120 {
+		t.Fatalf("unexpected status %+v", st)
+	}
+
+	rec = do(t, h.StatusHandler(), http.MethodGet, "/throttle/status?key=nobody&method=totp", nil)
+	st = handlers.EntryStatus{}
+	_ = json.NewDecoder(rec.Body).Decode(&st)
+	if rec.Code != http.StatusOK || st.Failures != 0 || st.NextAllowed != nil || st.WaitSeconds != 0 {
+		t.Fatalf("unknown key: status %d, body %+v", rec.Code, st)
+	}
+
+	if rec := do(t, h.StatusHandler(), http.MethodGet, "/throttle/status?key=bob", nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("missing method: status = %d, want 400", rec.Code)
+	}
+	if rec := do(t, h.StatusHandler(), http.MethodPost, "/throttle/status?key=bob&method=totp", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST: status = %d, want 405", rec.Code)
+	}
+}
+
+func TestResetHandler(t *testing.T) {
+	t.Run("one method", func(t *testing.T) {
+		h, store := newFixture(t)
+		rec := do(t, h.ResetHandler(), http.MethodPost, "/throttle/reset", handlers.ResetPayload{Key: "bob", Method: "totp"})
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+		}
+		if n, _, _ := store.Failures("bob", "totp"); n != 0 {
+			t.Error("bob/totp should be cleared")
+		}
+		if n, _, _ := store.Failures("bob", "recovery"); n != 1 {
+			t.Error("bob/recovery must be left alone")
+		}
+	})
+
+	t.Run("every method of a key", func(t *testing.T) {
+		h, store := newFixture(t)
+		rec := do(t, h.ResetHandler(), http.MethodPost, "/throttle/reset", handlers.ResetPayload{Key: "bob"})
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+		}
+		entries, _ := store.List(throttle.Query{})
+		if len(entries) != 1 || entries[0].Key != "carol" {
+			t.Errorf("only carol should remain, got %+v", entries)
+		}
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		h, _ := newFixture(t)
+		if rec := do(t, h.ResetHandler(), http.MethodPost, "/throttle/reset", handlers.ResetPayload{}); rec.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want 400", rec.Code)
+		}
+	})
+
+	t.Run("wrong verb", func(t *testing.T) {
+		h, _ := newFixture(t)
+		if rec := do(t, h.ResetHandler(), http.MethodGet, "/throttle/reset", nil); rec.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("status = %d, want 405", rec.Code)
+		}
+	})
+}
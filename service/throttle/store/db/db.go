@@ -4,9 +4,12 @@
 package db
 
 import (
+	"cmp"
+	"context"
 	"errors"
 	"time"
 
+	"github.com/go-bumbu/userauth/service/throttle"
 	"gorm.io/gorm"
 )
 
@@ -26,6 +29,10 @@ func (throttleModel) TableName() string { return "login_throttle" }
 
 // Store is a GORM-backed throttle store.
 type Store struct {
+	// Retention is how long Sweep keeps a row after its last failure; zero
+	// means throttle.DefaultRetention.
+	Retention time.Duration
+
 	db *gorm.DB
 }
 
@@ -71,3 +78,35 @@ func (s *Store) AddFailure(userID, method string, at time.Time) error {
 func (s *Store) Clear(userID, method string) error {
 	return s.db.Where("user_id = ? AND method = ?", userID, method).Delete(&throttleModel{}).Error
 }
+
+var _ throttle.Lister = (*Store)(nil)
+
+// List returns the entries matching q, most recent failure first.
+func (s *Store) List(q throttle.Query) ([]throttle.Entry, error) {
+	tx := s.db.Model(&throttleModel{})
+	if q.Key != "" {
+		tx = tx.Where("user_id = ?", q.Key)
+	}
+	if q.Method != "" {
+		tx = tx.Where("method = ?", q.Method)
+	}
+	if q.Limit > 0 {
+		tx = tx.Limit(q.Limit)
+	}
+	var rows []throttleModel
+	if err := tx.Order("last_at DESC, user_id, method").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make([]throttle.Entry, 0, len(rows))
+	for _, m := range rows {
+		out = append(out, throttle.Entry{Key: m.UserID, Method: m.Method, Count: m.Count, LastFailure: m.LastAt})
+	}
+	return out, nil
+}
+
+// Sweep deletes rows whose last failure is older than Retention.
+func (s *Store) Sweep(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-cmp.Or(s.Retention, throttle.DefaultRetention))
+	res := s.db.WithContext(ctx).Where("last_at < ?", cutoff).Delete(&throttleModel{})
+	return int(res.RowsAffected), res.Error
+}
@@ -1,9 +1,13 @@
 package db
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	"github.com/go-bumbu/userauth/service/throttle"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -82,3 +86,69 @@ func TestClear_NoState(t *testing.T) {
 		t.Fatalf("Clear on empty state should not error: %v", err)
 	}
 }
+
+func TestList(t *testing.T) {
+	s := newStore(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	_ = s.AddFailure("u", "totp", now.Add(-2*time.Minute))
+	_ = s.AddFailure("u", "totp", now.Add(-2*time.Minute))
+	_ = s.AddFailure("u", "recovery", now)
+	_ = s.AddFailure("v", "totp", now.Add(-time.Minute))
+
+	tcs := []struct {
+		name string
+		q    throttle.Query
+		want []throttle.Entry
+	}{
+		{
+			name: "all, newest first",
+			want: []throttle.Entry{
+				{Key: "u", Method: "recovery", Count: 1, LastFailure: now},
+				{Key: "v", Method: "totp", Count: 1, LastFailure: now.Add(-time.Minute)},
+				{Key: "u", Method: "totp", Count: 2, LastFailure: now.Add(-2 * time.Minute)},
+			},
+		},
+		{
+			name: "by key and method",
+			q:    throttle.Query{Key: "u", Method: "totp"},
+			want: []throttle.Entry{{Key: "u", Method: "totp", Count: 2, LastFailure: now.Add(-2 * time.Minute)}},
+		},
+		{
+			name: "limit",
+			q:    throttle.Query{Method: "totp", Limit: 1},
+			want: []throttle.Entry{{Key: "v", Method: "totp", Count: 1, LastFailure: now.Add(-time.Minute)}},
+		},
+		{name: "no match", q: throttle.Query{Key: "w"}, want: []throttle.Entry{}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := s.List(tc.q)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got, cmpopts.EquateApproxTime(0)); diff != "" {
+				t.Errorf("List mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSweep(t *testing.T) {
+	s := newStore(t)
+	_ = s.AddFailure("u", "totp", time.Now().Add(-2*throttle.DefaultRetention))
+	_ = s.AddFailure("u", "recovery", time.Now())
+
+	n, err := s.Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("Sweep: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("removed %d rows, want 1", n)
+	}
+	if count, _, _ := s.Failures("u", "totp"); count != 0 {
+		t.Fatal("stale row should be gone")
+	}
+	if count, _, _ := s.Failures("u", "recovery"); count != 1 {
+		t.Fatal("recent row must survive the sweep")
+	}
+}
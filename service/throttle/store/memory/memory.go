@@ -4,8 +4,13 @@
 package memory
 
 import (
+	"cmp"
+	"context"
+	"slices"
 	"sync"
 	"time"
+
+	"github.com/go-bumbu/userauth/service/throttle"
 )
 
 type failState struct {
@@ -13,23 +18,29 @@ type failState struct {
 	last  time.Time
 }
 
+type entryKey struct {
+	key, method string
+}
+
 // Store is an in-memory ThrottleStore. Safe for concurrent use.
 type Store struct {
+	// Retention is how long Sweep keeps an entry after its last failure;
+	// zero means throttle.DefaultRetention.
+	Retention time.Duration
+
 	mu    sync.Mutex
-	fails map[string]failState
+	fails map[entryKey]failState
 }
 
 func New() *Store {
-	return &Store{fails: make(map[string]failState)}
+	return &Store{fails: make(map[entryKey]failState)}
 }
 
-func key(userID, method string) string { return userID + "\x00" + method }
-
 // Failures returns the consecutive failure count and last failure time.
 func (s *Store) Failures(userID, method string) (int, time.Time, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	f := s.fails[key(userID, method)]
+	f := s.fails[entryKey{userID, method}]
 	return f.count, f.last, nil
 }
 
@@ -37,7 +48,7 @@ func (s *Store) Failures(userID, method string) (int, time.Time, error) {
 func (s *Store) AddFailure(userID, method string, at time.Time) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	k := key(userID, method)
+	k := entryKey{userID, method}
 	f := s.fails[k]
 	f.count++
 	f.last = at
@@ -49,6 +60,49 @@ func (s *Store) AddFailure(userID, method string, at time.Time) error {
 func (s *Store) Clear(userID, method string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	delete(s.fails, key(userID, method))
+	delete(s.fails, entryKey{userID, method})
 	return nil
 }
+
+var _ throttle.Lister = (*Store)(nil)
+
+// List returns the entries matching q, most recent failure first.
+func (s *Store) List(q throttle.Query) ([]throttle.Entry, error) {
+	s.mu.Lock()
+	out := make([]throttle.Entry, 0, len(s.fails))
+	for k, f := range s.fails {
+		if (q.Key != "" && k.key != q.Key) || (q.Method != "" && k.method != q.Method) {
+			continue
+		}
+		out = append(out, throttle.Entry{Key: k.key, Method: k.method, Count: f.count, LastFailure: f.last})
+	}
+	s.mu.Unlock()
+	slices.SortFunc(out, func(a, b throttle.Entry) int {
+		if c := b.LastFailure.Compare(a.LastFailure); c != 0 {
+			return c
+		}
+		return cmp.Or(cmp.Compare(a.Key, b.Key), cmp.Compare(a.Method, b.Method))
+	})
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[:q.Limit]
+	}
+	return out, nil
+}
+
+// Sweep removes entries whose last failure is older than Retention.
+func (s *Store) Sweep(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	cutoff := time.Now().Add(-cmp.Or(s.Retention, throttle.DefaultRetention))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for k, f := range s.fails {
+		if f.last.Before(cutoff) {
+			delete(s.fails, k)
+			n++
+		}
+	}
+	return n, nil
+}
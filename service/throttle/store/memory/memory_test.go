@@ -1,8 +1,12 @@
 package memory
 
 import (
+	"context"
 	"testing"
 	"time"
+
+	"github.com/go-bumbu/userauth/service/throttle"
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestFailures_EmptyState(t *testing.T) {
@@ -56,3 +60,59 @@ func TestClear(t *testing.T) {
 		t.Fatal("state should be gone after Clear")
 	}
 }
+
+func TestList(t *testing.T) {
+	s := New()
+	now := time.Now()
+	_ = s.AddFailure("u", "totp", now.Add(-2*time.Minute))
+	_ = s.AddFailure("u", "recovery", now)
+	_ = s.AddFailure("v", "totp", now.Add(-time.Minute))
+
+	tcs := []struct {
+		name string
+		q    throttle.Query
+		want []string
+	}{
+		{name: "all, newest first", want: []string{"u/recovery", "v/totp", "u/totp"}},
+		{name: "by key", q: throttle.Query{Key: "u"}, want: []string{"u/recovery", "u/totp"}},
+		{name: "by method", q: throttle.Query{Method: "totp"}, want: []string{"v/totp", "u/totp"}},
+		{name: "limit", q: throttle.Query{Limit: 1}, want: []string{"u/recovery"}},
+		{name: "no match", q: throttle.Query{Key: "w"}, want: []string{}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, err := s.List(tc.q)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			got := make([]string, 0, len(entries))
+			for _, e := range entries {
+				got = append(got, e.Key+"/"+e.Method)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("List mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSweep(t *testing.T) {
+	s := New()
+	s.Retention = time.Hour
+	_ = s.AddFailure("u", "totp", time.Now().Add(-2*time.Hour))
+	_ = s.AddFailure("u", "recovery", time.Now())
+
+	n, err := s.Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("Sweep: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("removed %d entries, want 1", n)
+	}
+	if count, _, _ := s.Failures("u", "totp"); count != 0 {
+		t.Fatal("stale entry should be gone")
+	}
+	if count, _, _ := s.Failures("u", "recovery"); count != 1 {
+		t.Fatal("recent entry must survive the sweep")
+	}
+}
@@ -20,6 +20,11 @@ const (
 	DefaultMaxDelay     = 5 * time.Minute
 )
 
+// DefaultRetention is how long stores keep an entry after its last failure
+// before Sweep removes it. It outlasts every delay and window the login
+// engine uses; a key that stays quiet this long starts over at zero.
+const DefaultRetention = 24 * time.Hour
+
 // Store persists consecutive failure state per key and method.
 // Implementations are pure persistence: they count and report, but never
 // decide when an attempt is allowed (Backoff does).
@@ -34,6 +39,35 @@ type Store interface {
 	Clear(key, method string) error
 }
 
+// Entry is the recorded failure state of one key and method.
+type Entry struct {
+	Key         string
+	Method      string
+	Count       int
+	LastFailure time.Time
+}
+
+// Query selects entries. Empty Key and Method match every value; Limit <= 0
+// means no limit. Active is a Backoff concern: stores ignore it, and
+// Backoff.List keeps only entries that are currently delayed.
+type Query struct {
+	Key    string
+	Method string
+	Active bool
+	Limit  int
+}
+
+// Lister is the optional administration side of a Store: it enumerates
+// recorded state, most recent failure first. The login path never needs
+// it; support tooling (Backoff.List, the handlers package) does.
+type Lister interface {
+	List(q Query) ([]Entry, error)
+}
+
+// ErrNotListable is returned by Backoff.List when the Store does not
+// implement Lister.
+var ErrNotListable = errors.New("throttle: store does not support listing")
+
 // Backoff slows down repeated failures with an escalating delay: after
 // FreeFailures consecutive failures, the next attempt is only allowed once
 // BaseDelay·2^(extra failures) has passed since the last failure, capped at
@@ -96,6 +130,80 @@ func (t *Backoff) delay(failures int) time.Duration {
 	return d
 }
 
+// Status is an Entry as the Backoff sees it.
+type Status struct {
+	Entry
+	// Delay is the wait imposed after LastFailure; zero while the count
+	// is within the free failures.
+	Delay time.Duration
+	// NextAllowed is when the next attempt is allowed: LastFailure+Delay,
+	// or the zero time when no delay applies.
+	NextAllowed time.Time
+}
+
+// Active reports whether the entry still delays attempts at now.
+func (s Status) Active(now time.Time) bool {
+	return !s.NextAllowed.IsZero() && now.Before(s.NextAllowed)
+}
+
+func (t *Backoff) status(e Entry) Status {
+	st := Status{Entry: e, Delay: t.delay(e.Count)}
+	if st.Delay > 0 {
+		st.NextAllowed = e.LastFailure.Add(st.Delay)
+	}
+	return st
+}
+
+// Status returns the failure state of key and method together with the
+// time of the next allowed attempt. A key without failures returns a
+// Status with a zero Count.
+func (t *Backoff) Status(key, method string) (Status, error) {
+	if t.Store == nil {
+		return Status{}, errors.New("throttle: backoff requires a Store")
+	}
+	count, last, err := t.Store.Failures(key, method)
+	if err != nil {
+		return Status{}, err
+	}
+	return t.status(Entry{Key: key, Method: method, Count: count, LastFailure: last}), nil
+}
+
+// List returns the entries selected by q, most recent failure first, each
+// evaluated against this Backoff's delays. It requires the Store to
+// implement Lister and returns ErrNotListable otherwise. Entries written by
+// other policies sharing the store (ResendLimiter, IPGuard) are reported
+// with this Backoff's delays all the same.
+func (t *Backoff) List(q Query) ([]Status, error) {
+	if t.Store == nil {
+		return nil, errors.New("throttle: backoff requires a Store")
+	}
+	l, ok := t.Store.(Lister)
+	if !ok {
+		return nil, ErrNotListable
+	}
+	sq := q
+	if q.Active {
+		sq.Limit = 0 // the limit applies after filtering
+	}
+	entries, err := l.List(sq)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	out := make([]Status, 0, len(entries))
+	for _, e := range entries {
+		st := t.status(e)
+		if q.Active && !st.Active(now) {
+			continue
+		}
+		out = append(out, st)
+		if q.Limit > 0 && len(out) == q.Limit {
+			break
+		}
+	}
+	return out, nil
+}
+
 // Allow reports whether the key may attempt the method now. Callers should
 // render a denial exactly like a credential failure. A non-nil error is a
 // store failure (the backoff fails closed).
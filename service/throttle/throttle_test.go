@@ -1,11 +1,13 @@
 package throttle_test
 
 import (
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/go-bumbu/userauth/service/throttle"
 	"github.com/go-bumbu/userauth/service/throttle/store/memory"
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestBackoff_FreeFailuresAllowed(t *testing.T) {
@@ -104,3 +106,82 @@ func TestBackoff_NoStoreFailsClosed(t *testing.T) {
 		t.Fatal("Success without store must error")
 	}
 }
+
+func TestBackoff_Status(t *testing.T) {
+	store := memory.New()
+	b := &throttle.Backoff{Store: store, FreeFailures: 1, BaseDelay: time.Minute}
+	at := time.Now().Add(-10 * time.Second)
+
+	st, err := b.Status("u", "totp")
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if st.Count != 0 || !st.NextAllowed.IsZero() || st.Active(time.Now()) {
+		t.Fatalf("unknown key should have no state, got %+v", st)
+	}
+
+	_ = store.AddFailure("u", "totp", at)
+	st, _ = b.Status("u", "totp")
+	if st.Count != 1 || st.Delay != time.Minute || !st.NextAllowed.Equal(at.Add(time.Minute)) {
+		t.Fatalf("after the free failure: got %+v", st)
+	}
+	if !st.Active(time.Now()) {
+		t.Fatal("status should be active within the delay")
+	}
+
+	_ = store.AddFailure("u", "totp", at)
+	st, _ = b.Status("u", "totp")
+	if st.Delay != 2*time.Minute || !st.NextAllowed.Equal(at.Add(2*time.Minute)) {
+		t.Fatalf("delay should double: got %+v", st)
+	}
+}
+
+func TestBackoff_List(t *testing.T) {
+	store := memory.New()
+	b := &throttle.Backoff{Store: store, FreeFailures: 2, BaseDelay: time.Minute}
+	now := time.Now()
+	_ = store.AddFailure("free", "totp", now)                   // within the free failures
+	_ = store.AddFailure("lapsed", "totp", now.Add(-time.Hour)) // delay long over
+	_ = store.AddFailure("lapsed", "totp", now.Add(-time.Hour))
+	_ = store.AddFailure("slowed", "totp", now.Add(-time.Second))
+	_ = store.AddFailure("slowed", "totp", now.Add(-time.Second))
+
+	keys := func(sts []throttle.Status) []string {
+		out := []string{}
+		for _, st := range sts {
+			out = append(out, st.Key)
+		}
+		return out
+	}
+	tcs := []struct {
+		name string
+		q    throttle.Query
+		want []string
+	}{
+		{name: "all", want: []string{"free", "slowed", "lapsed"}},
+		{name: "active only", q: throttle.Query{Active: true}, want: []string{"slowed"}},
+		{name: "limit after filter", q: throttle.Query{Active: true, Limit: 1}, want: []string{"slowed"}},
+		{name: "by key", q: throttle.Query{Key: "lapsed"}, want: []string{"lapsed"}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := b.List(tc.q)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, keys(got)); diff != "" {
+				t.Errorf("List mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// failuresOnly is a Store without the Lister capability.
+type failuresOnly struct{ throttle.Store }
+
+func TestBackoff_ListNeedsLister(t *testing.T) {
+	b := &throttle.Backoff{Store: failuresOnly{memory.New()}}
+	if _, err := b.List(throttle.Query{}); !errors.Is(err, throttle.ErrNotListable) {
+		t.Fatalf("want ErrNotListable, got %v", err)
+	}
+}
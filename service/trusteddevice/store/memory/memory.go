@@ -0,0 +1,121 @@
+// Package memory provides an in-memory trusteddevice.Store for tests, demos,
+// and applications that do not use a database. Safe for concurrent use.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-bumbu/userauth/service/trusteddevice"
+)
+
+// Store is an in-memory trusteddevice.Store keyed by device ID.
+type Store struct {
+	mu      sync.Mutex
+	devices map[string]trusteddevice.Device
+}
+
+var _ trusteddevice.Store = (*Store)(nil)
+
+func New() *Store {
+	return &Store{devices: make(map[string]trusteddevice.Device)}
+}
+
+// Insert stores a new record; the ID must be unique.
+func (s *Store) Insert(d trusteddevice.Device) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.devices[d.ID]; exists {
+		return fmt.Errorf("device ID %q already exists", d.ID)
+	}
+	s.devices[d.ID] = d
+	return nil
+}
+
+// Get returns the record or trusteddevice.ErrDeviceNotFound.
+func (s *Store) Get(deviceID string) (trusteddevice.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.devices[deviceID]
+	if !ok {
+		return trusteddevice.Device{}, trusteddevice.ErrDeviceNotFound
+	}
+	return d, nil
+}
+
+// ListByUser returns the user's records, oldest first.
+func (s *Store) ListByUser(userID string) ([]trusteddevice.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []trusteddevice.Device
+	for _, d := range s.devices {
+		if d.UserID == userID {
+			out = append(out, d)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].ID < out[j].ID
+		}
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out, nil
+}
+
+// Delete removes the record only when it belongs to userID.
+func (s *Store) Delete(userID, deviceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.devices[deviceID]
+	if !ok || d.UserID != userID {
+		return trusteddevice.ErrDeviceNotFound
+	}
+	delete(s.devices, deviceID)
+	return nil
+}
+
+// DeleteByUser removes every record of the user.
+func (s *Store) DeleteByUser(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, d := range s.devices {
+		if d.UserID == userID {
+			delete(s.devices, id)
+		}
+	}
+	return nil
+}
+
+// Touch updates LastUsedAt for the record.
+func (s *Store) Touch(deviceID string, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.devices[deviceID]
+	if !ok {
+		return trusteddevice.ErrDeviceNotFound
+	}
+	d.LastUsedAt = &t
+	s.devices[deviceID] = d
+	return nil
+}
+
+// Sweep removes expired devices.
+func (s *Store) Sweep(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for id, d := range s.devices {
+		if now.After(d.ExpiresAt) {
+			delete(s.devices, id)
+			n++
+		}
+	}
+	return n, nil
+}
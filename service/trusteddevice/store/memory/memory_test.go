@@ -0,0 +1,39 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-bumbu/userauth/service/trusteddevice"
+	"github.com/go-bumbu/userauth/service/trusteddevice/store/memory"
+	"github.com/go-bumbu/userauth/service/trusteddevice/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) trusteddevice.Store {
+		return memory.New()
+	})
+}
+
+func TestSweep(t *testing.T) {
+	s := memory.New()
+	now := time.Now()
+	_ = s.Insert(trusteddevice.Device{ID: "live", UserID: "user1", ExpiresAt: now.Add(time.Hour)})
+	_ = s.Insert(trusteddevice.Device{ID: "expired", UserID: "user1", ExpiresAt: now.Add(-time.Hour)})
+
+	n, err := s.Sweep(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("removed %d devices, want 1", n)
+	}
+	if _, err := s.Get("expired"); !errors.Is(err, trusteddevice.ErrDeviceNotFound) {
+		t.Errorf("want ErrDeviceNotFound for the swept device, got %v", err)
+	}
+	if _, err := s.Get("live"); err != nil {
+		t.Errorf("live device must survive the sweep: %v", err)
+	}
+}
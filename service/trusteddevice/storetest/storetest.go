@@ -0,0 +1,160 @@
+// Package storetest provides a conformance suite that every
+// trusteddevice.Store implementation must pass. Store tests call Run with a
+// factory that returns a fresh, empty store.
+package storetest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-bumbu/userauth/service/trusteddevice"
+)
+
+// Run exercises the Store contract against a fresh store per subtest.
+//
+//nolint:gocyclo // Conformance suite with multiple test scenarios is inherently complex
+func Run(t *testing.T, newStore func(t *testing.T) trusteddevice.Store) {
+	t.Helper()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	dev := func(id, userID string) trusteddevice.Device {
+		return trusteddevice.Device{
+			ID:         id,
+			UserID:     userID,
+			Name:       "Firefox on Linux",
+			SecretHash: "deadbeef",
+			CreatedAt:  now,
+			ExpiresAt:  now.Add(24 * time.Hour),
+		}
+	}
+	notFound := func(err error) bool { return errors.Is(err, trusteddevice.ErrDeviceNotFound) }
+
+	t.Run("insert and get round-trip", func(t *testing.T) {
+		s := newStore(t)
+		if err := s.Insert(dev("dev1", "user1")); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+		got, err := s.Get("dev1")
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if got.ID != "dev1" || got.UserID != "user1" || got.Name != "Firefox on Linux" ||
+			got.SecretHash != "deadbeef" {
+			t.Errorf("round-trip mismatch: %+v", got)
+		}
+		if !got.CreatedAt.Equal(now) || !got.ExpiresAt.Equal(now.Add(24*time.Hour)) {
+			t.Errorf("timestamps mismatch: created %v, expires %v", got.CreatedAt, got.ExpiresAt)
+		}
+		if got.LastUsedAt != nil {
+			t.Errorf("LastUsedAt should start nil, got %v", got.LastUsedAt)
+		}
+	})
+
+	t.Run("get absent returns ErrDeviceNotFound", func(t *testing.T) {
+		s := newStore(t)
+		if _, err := s.Get("nope"); !notFound(err) {
+			t.Errorf("want ErrDeviceNotFound, got %v", err)
+		}
+	})
+
+	t.Run("duplicate ID rejected", func(t *testing.T) {
+		s := newStore(t)
+		if err := s.Insert(dev("dup", "user1")); err != nil {
+			t.Fatalf("first Insert: %v", err)
+		}
+		if err := s.Insert(dev("dup", "user2")); err == nil {
+			t.Error("second Insert with same ID should fail")
+		}
+	})
+
+	t.Run("list by user, oldest first", func(t *testing.T) {
+		s := newStore(t)
+		a := dev("a1", "user1")
+		a.CreatedAt = now.Add(-2 * time.Hour)
+		b := dev("b1", "user1")
+		b.CreatedAt = now.Add(-1 * time.Hour)
+		c := dev("c1", "user2")
+		for _, d := range []trusteddevice.Device{b, a, c} {
+			if err := s.Insert(d); err != nil {
+				t.Fatalf("Insert %s: %v", d.ID, err)
+			}
+		}
+		got, err := s.ListByUser("user1")
+		if err != nil {
+			t.Fatalf("ListByUser: %v", err)
+		}
+		if len(got) != 2 || got[0].ID != "a1" || got[1].ID != "b1" {
+			t.Errorf("list mismatch: %+v", got)
+		}
+		none, err := s.ListByUser("stranger")
+		if err != nil || len(none) != 0 {
+			t.Errorf("ListByUser(stranger) = %v, %v", none, err)
+		}
+	})
+
+	t.Run("delete is owner-scoped", func(t *testing.T) {
+		s := newStore(t)
+		if err := s.Insert(dev("del1", "user1")); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+		if err := s.Delete("user2", "del1"); !notFound(err) {
+			t.Errorf("foreign delete: want ErrDeviceNotFound, got %v", err)
+		}
+		if err := s.Delete("user1", "absent"); !notFound(err) {
+			t.Errorf("absent delete: want ErrDeviceNotFound, got %v", err)
+		}
+		if err := s.Delete("user1", "del1"); err != nil {
+			t.Errorf("owner delete: %v", err)
+		}
+		if _, err := s.Get("del1"); !notFound(err) {
+			t.Errorf("device should be gone, got %v", err)
+		}
+	})
+
+	t.Run("delete by user leaves other users alone", func(t *testing.T) {
+		s := newStore(t)
+		for _, d := range []trusteddevice.Device{dev("x1", "user1"), dev("x2", "user1"), dev("y1", "user2")} {
+			if err := s.Insert(d); err != nil {
+				t.Fatalf("Insert %s: %v", d.ID, err)
+			}
+		}
+		if err := s.DeleteByUser("user1"); err != nil {
+			t.Fatalf("DeleteByUser: %v", err)
+		}
+		if got, err := s.ListByUser("user1"); err != nil || len(got) != 0 {
+			t.Errorf("ListByUser(user1) = %v, %v; want empty", got, err)
+		}
+		if _, err := s.Get("y1"); err != nil {
+			t.Errorf("other user's device should survive: %v", err)
+		}
+		if err := s.DeleteByUser("nobody"); err != nil {
+			t.Errorf("DeleteByUser without devices: %v", err)
+		}
+	})
+
+	t.Run("touch updates LastUsedAt", func(t *testing.T) {
+		s := newStore(t)
+		if err := s.Insert(dev("touch1", "user1")); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+		when := now.Add(time.Minute)
+		if err := s.Touch("touch1", when); err != nil {
+			t.Fatalf("Touch: %v", err)
+		}
+		got, err := s.Get("touch1")
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if got.LastUsedAt == nil || !got.LastUsedAt.Equal(when) {
+			t.Errorf("LastUsedAt = %v, want %v", got.LastUsedAt, when)
+		}
+	})
+
+	t.Run("touch on absent device returns ErrDeviceNotFound", func(t *testing.T) {
+		s := newStore(t)
+		if err := s.Touch("absent", now); !notFound(err) {
+			t.Errorf("want ErrDeviceNotFound, got %v", err)
+		}
+	})
+}
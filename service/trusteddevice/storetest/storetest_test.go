@@ -0,0 +1,17 @@
+package storetest_test
+
+import (
+	"testing"
+
+	"github.com/go-bumbu/userauth/service/trusteddevice"
+	"github.com/go-bumbu/userauth/service/trusteddevice/store/memory"
+	"github.com/go-bumbu/userauth/service/trusteddevice/storetest"
+)
+
+// TestRunAgainstMemory exercises the conformance suite itself; the memory
+// store is the reference implementation.
+func TestRunAgainstMemory(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) trusteddevice.Store {
+		return memory.New()
+	})
+}
@@ -0,0 +1,350 @@
+// Package trusteddevice owns "remember this device": after a full login a
+// user may trust the browser they are on, which then carries a signed,
+// long-lived cookie naming a server-side device record. login.Flow consults
+// the service (Flow.Devices) and a login.TrustedDevice policy lets a
+// recognised device stand in for the second factor.
+//
+// The cookie alone is never enough: it holds the device ID and a random
+// secret whose SHA-256 hash is stored with the record, so revoking the record
+// (Revoke, RevokeAll) invalidates the cookie wherever it was copied to.
+// Persistence is delegated to a Store (default implementation in
+// userstore/userdb, in-memory implementation under store/memory).
+package trusteddevice
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-bumbu/userauth/internal/hashutil"
+	"github.com/gorilla/securecookie"
+)
+
+// Device is what the store persists about one trusted browser. All fields
+// are opaque to the store: stores never generate, hash or interpret anything.
+type Device struct {
+	ID         string // public lookup key, unique; travels in the cookie
+	UserID     string // owning user (canonical ID)
+	Name       string // user-facing label, by default the browser's User-Agent
+	SecretHash string `json:"-"` // SHA-256 hex of the cookie secret; never the plaintext
+	CreatedAt  time.Time
+	LastUsedAt *time.Time // last time the device skipped a factor
+	ExpiresAt  time.Time  // the device must log in fully again after this
+}
+
+// Store persists device records. Implementations are pure persistence.
+type Store interface {
+	// Insert stores a new record. ID must be unique.
+	Insert(d Device) error
+	// Get returns the record or ErrDeviceNotFound.
+	Get(deviceID string) (Device, error)
+	// ListByUser returns the user's records, oldest first.
+	ListByUser(userID string) ([]Device, error)
+	// Delete removes the record only if it belongs to userID; returns
+	// ErrDeviceNotFound for absent or foreign devices.
+	Delete(userID, deviceID string) error
+	// DeleteByUser removes every record of the user; none is not an error.
+	DeleteByUser(userID string) error
+	// Touch updates LastUsedAt; ErrDeviceNotFound for absent devices.
+	Touch(deviceID string, t time.Time) error
+}
+
+// ErrDeviceNotFound is returned for absent or foreign devices.
+var ErrDeviceNotFound = errors.New("device not found")
+
+const (
+	// DefaultCookieName is the device cookie's name when Opts.CookieName is
+	// empty.
+	DefaultCookieName = "_trusted_device"
+	// DefaultLifetime is how long a device stays trusted when Opts.Lifetime
+	// is zero. Trust is not renewed by use: after it the user logs in with
+	// every factor again.
+	DefaultLifetime = 30 * 24 * time.Hour
+	// DefaultMaxPerUser bounds the devices a user keeps when Opts.MaxPerUser
+	// is zero; trusting one more forgets the oldest.
+	DefaultMaxPerUser = 10
+
+	defaultTouchInterval = time.Hour
+	deviceIDLength       = 16
+	secretLength         = 43 // ~256 bits of base62
+	maxNameLength        = 100
+	unknownDeviceName    = "Unknown device"
+)
+
+// Opts configures a Service. Zero values fall back to defaults.
+type Opts struct {
+	// HashKey signs the device cookie; required, 32 or 64 bytes.
+	HashKey []byte
+	// BlockKey optionally encrypts the cookie as well; 16, 24 or 32 bytes.
+	BlockKey []byte
+	// CookieName defaults to DefaultCookieName.
+	CookieName string
+	// Lifetime is how long a device stays trusted; defaults to
+	// DefaultLifetime.
+	Lifetime time.Duration
+	// MaxPerUser bounds the devices per user; 0 uses DefaultMaxPerUser, a
+	// negative value means unlimited.
+	MaxPerUser int
+	// TouchInterval throttles LastUsedAt writes on Verify, like
+	// pat.Opts.TouchInterval. 0 uses the default (1h); a negative value
+	// disables the writes.
+	TouchInterval time.Duration
+	Logger        *slog.Logger
+}
+
+// Service issues and recognises trusted-device cookies and manages the
+// records behind them.
+type Service struct {
+	store         Store
+	codec         *securecookie.SecureCookie
+	cookieName    string
+	lifetime      time.Duration
+	maxPerUser    int
+	touchInterval time.Duration
+	logger        *slog.Logger
+}
+
+// cookieValue is what the signed cookie carries.
+type cookieValue struct {
+	DeviceID string
+	Secret   string
+}
+
+// NewService wires the service to its store.
+func NewService(store Store, opts Opts) (*Service, error) {
+	if store == nil {
+		return nil, fmt.Errorf("trusteddevice: store is required")
+	}
+	if l := len(opts.HashKey); l != 32 && l != 64 {
+		return nil, fmt.Errorf("trusteddevice: HashKey must be 32 or 64 bytes")
+	}
+	if l := len(opts.BlockKey); l != 0 && l != 16 && l != 24 && l != 32 {
+		return nil, fmt.Errorf("trusteddevice: BlockKey must be 16, 24 or 32 bytes")
+	}
+	if opts.CookieName == "" {
+		opts.CookieName = DefaultCookieName
+	}
+	if opts.Lifetime <= 0 {
+		opts.Lifetime = DefaultLifetime
+	}
+	if opts.MaxPerUser == 0 {
+		opts.MaxPerUser = DefaultMaxPerUser
+	}
+	if opts.TouchInterval == 0 {
+		opts.TouchInterval = defaultTouchInterval
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.DiscardHandler)
+	}
+	var blockKey []byte
+	if len(opts.BlockKey) > 0 {
+		blockKey = opts.BlockKey
+	}
+	codec := securecookie.New(opts.HashKey, blockKey)
+	codec.MaxAge(int(opts.Lifetime.Seconds()))
+	return &Service{
+		store:         store,
+		codec:         codec,
+		cookieName:    opts.CookieName,
+		lifetime:      opts.Lifetime,
+		maxPerUser:    opts.MaxPerUser,
+		touchInterval: opts.TouchInterval,
+		logger:        opts.Logger,
+	}, nil
+}
+
+// Trust records the requesting browser as a trusted device of the user and
+// sets its cookie on w. An empty name falls back to the request's
+// User-Agent. A device cookie the browser already carries for the same user
+// is replaced, and when the user is at MaxPerUser their oldest device is
+// forgotten.
+//
+// Call it only right after the user completed a full login in this request;
+// login.Flow does so for requests marked with login.WithRememberDevice.
+func (s *Service) Trust(r *http.Request, w http.ResponseWriter, userID, name string) (Device, error) {
+	if userID == "" {
+		return Device{}, fmt.Errorf("trusteddevice: user ID is required")
+	}
+	if prev, ok, err := s.Verify(r, userID); err == nil && ok {
+		if err := s.store.Delete(userID, prev.ID); err != nil && !errors.Is(err, ErrDeviceNotFound) {
+			return Device{}, err
+		}
+	}
+	if err := s.evict(userID); err != nil {
+		return Device{}, err
+	}
+
+	id, err := hashutil.GenerateBase36(deviceIDLength)
+	if err != nil {
+		return Device{}, err
+	}
+	secret, err := hashutil.GenerateBase62(secretLength)
+	if err != nil {
+		return Device{}, err
+	}
+	now := time.Now().UTC()
+	d := Device{
+		ID:         id,
+		UserID:     userID,
+		Name:       deviceName(name, r.UserAgent()),
+		SecretHash: hashutil.HashCodeSHA256(secret),
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(s.lifetime),
+	}
+	encoded, err := s.codec.Encode(s.cookieName, cookieValue{DeviceID: id, Secret: secret})
+	if err != nil {
+		return Device{}, fmt.Errorf("trusteddevice: encode cookie: %w", err)
+	}
+	if err := s.store.Insert(d); err != nil {
+		return Device{}, err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cookieName,
+		Value:    encoded,
+		Path:     "/",
+		Expires:  d.ExpiresAt,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	s.logger.Debug("trusteddevice: device trusted", "userID", userID, "deviceID", id)
+	return d, nil
+}
+
+// evict makes room for one more device under MaxPerUser by forgetting the
+// user's oldest ones.
+func (s *Service) evict(userID string) error {
+	if s.maxPerUser < 0 {
+		return nil
+	}
+	devices, err := s.store.ListByUser(userID)
+	if err != nil {
+		return err
+	}
+	for i := 0; len(devices)-i >= s.maxPerUser; i++ {
+		if err := s.store.Delete(userID, devices[i].ID); err != nil && !errors.Is(err, ErrDeviceNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// deviceName trims the given name and falls back to the User-Agent, capped
+// at maxNameLength runes.
+func deviceName(name, userAgent string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = strings.TrimSpace(userAgent)
+	}
+	if name == "" {
+		return unknownDeviceName
+	}
+	if r := []rune(name); len(r) > maxNameLength {
+		name = string(r[:maxNameLength])
+	}
+	return name
+}
+
+// Verify reports whether the request carries the cookie of a live trusted
+// device of the user. ok=false covers every failure — no cookie, bad
+// signature, unknown or revoked device, another user's device, wrong
+// secret, expired — indistinguishably; err is only returned for store
+// failures. On success LastUsedAt is updated, throttled by TouchInterval; a
+// failed touch is logged and ignored.
+func (s *Service) Verify(r *http.Request, userID string) (Device, bool, error) {
+	c, err := r.Cookie(s.cookieName)
+	if err != nil {
+		return Device{}, false, nil
+	}
+	var v cookieValue
+	if err := s.codec.Decode(s.cookieName, c.Value, &v); err != nil {
+		s.logger.Debug("trusteddevice verify: undecodable cookie", "error", err)
+		return Device{}, false, nil
+	}
+	d, err := s.store.Get(v.DeviceID)
+	if err != nil {
+		if errors.Is(err, ErrDeviceNotFound) {
+			s.logger.Debug("trusteddevice verify: unknown device", "deviceID", v.DeviceID)
+			return Device{}, false, nil
+		}
+		return Device{}, false, err
+	}
+	if d.UserID != userID {
+		s.logger.Debug("trusteddevice verify: device of another user", "deviceID", d.ID)
+		return Device{}, false, nil
+	}
+	digest := hashutil.HashCodeSHA256(v.Secret)
+	if subtle.ConstantTimeCompare([]byte(digest), []byte(d.SecretHash)) != 1 {
+		s.logger.Debug("trusteddevice verify: secret mismatch", "deviceID", d.ID)
+		return Device{}, false, nil
+	}
+	if !time.Now().Before(d.ExpiresAt) {
+		s.logger.Debug("trusteddevice verify: device expired", "deviceID", d.ID)
+		if err := s.store.Delete(d.UserID, d.ID); err != nil && !errors.Is(err, ErrDeviceNotFound) {
+			s.logger.Warn("trusteddevice verify: failed to delete expired device", "deviceID", d.ID, "err", err)
+		}
+		return Device{}, false, nil
+	}
+
+	if s.touchInterval >= 0 &&
+		(d.LastUsedAt == nil || time.Since(*d.LastUsedAt) >= s.touchInterval) {
+		now := time.Now().UTC()
+		if err := s.store.Touch(d.ID, now); err != nil {
+			s.logger.Warn("trusteddevice verify: failed to update last-used", "deviceID", d.ID, "err", err)
+		} else {
+			d.LastUsedAt = &now
+		}
+	}
+	return d, true, nil
+}
+
+// List returns the user's trusted devices, most recently used first (never
+// used ones by creation). SecretHash is tagged json:"-".
+func (s *Service) List(userID string) ([]Device, error) {
+	devices, err := s.store.ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(devices, func(i, j int) bool {
+		return lastSeen(devices[i]).After(lastSeen(devices[j]))
+	})
+	return devices, nil
+}
+
+func lastSeen(d Device) time.Time {
+	if d.LastUsedAt != nil {
+		return *d.LastUsedAt
+	}
+	return d.CreatedAt
+}
+
+// Revoke forgets one of the user's devices: its cookie stops working
+// everywhere. ErrDeviceNotFound for absent or foreign IDs.
+func (s *Service) Revoke(userID, deviceID string) error {
+	return s.store.Delete(userID, deviceID)
+}
+
+// RevokeAll forgets every device of the user, e.g. after a password reset
+// or when they disable two-factor authentication.
+func (s *Service) RevokeAll(userID string) error {
+	return s.store.DeleteByUser(userID)
+}
+
+// Forget clears the device cookie from the browser; the record is kept, use
+// Revoke for that.
+func (s *Service) Forget(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,219 @@
+package trusteddevice_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-bumbu/userauth/service/trusteddevice"
+	"github.com/go-bumbu/userauth/service/trusteddevice/store/memory"
+)
+
+var hashKey = []byte("0123456789abcdef0123456789abcdef")
+
+func newService(t *testing.T, opts trusteddevice.Opts) (*trusteddevice.Service, *memory.Store) {
+	t.Helper()
+	store := memory.New()
+	if opts.HashKey == nil {
+		opts.HashKey = hashKey
+	}
+	s, err := trusteddevice.NewService(store, opts)
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	return s, store
+}
+
+// trust trusts a fresh browser for the user and returns its cookie.
+func trust(t *testing.T, s *trusteddevice.Service, userID string) (trusteddevice.Device, *http.Cookie) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/login", nil)
+	r.Header.Set("User-Agent", "TestBrowser/1.0")
+	w := httptest.NewRecorder()
+	d, err := s.Trust(r, w, userID, "")
+	if err != nil {
+		t.Fatalf("Trust: %v", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("want one cookie, got %v", cookies)
+	}
+	return d, cookies[0]
+}
+
+func verify(t *testing.T, s *trusteddevice.Service, c *http.Cookie, userID string) (trusteddevice.Device, bool) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/login", nil)
+	if c != nil {
+		r.AddCookie(c)
+	}
+	d, ok, err := s.Verify(r, userID)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	return d, ok
+}
+
+func TestNewService(t *testing.T) {
+	tcs := []struct {
+		name  string
+		store trusteddevice.Store
+		opts  trusteddevice.Opts
+	}{
+		{name: "nil store", opts: trusteddevice.Opts{HashKey: hashKey}},
+		{name: "missing hash key", store: memory.New()},
+		{name: "short hash key", store: memory.New(), opts: trusteddevice.Opts{HashKey: []byte("short")}},
+		{name: "bad block key", store: memory.New(), opts: trusteddevice.Opts{HashKey: hashKey, BlockKey: []byte("nope")}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := trusteddevice.NewService(tc.store, tc.opts); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestTrustAndVerify(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		s, _ := newService(t, trusteddevice.Opts{BlockKey: []byte("0123456789abcdef")})
+		d, c := trust(t, s, "alice")
+		if d.Name != "TestBrowser/1.0" {
+			t.Errorf("Name = %q, want the User-Agent", d.Name)
+		}
+		if c.Name != trusteddevice.DefaultCookieName || !c.HttpOnly || !c.Secure {
+			t.Errorf("unexpected cookie %+v", c)
+		}
+		got, ok := verify(t, s, c, "alice")
+		if !ok || got.ID != d.ID {
+			t.Fatalf("Verify = %+v, %v; want device %s", got, ok, d.ID)
+		}
+		if got.LastUsedAt == nil {
+			t.Error("Verify should record the use")
+		}
+	})
+
+	t.Run("rejections", func(t *testing.T) {
+		s, store := newService(t, trusteddevice.Opts{})
+		d, c := trust(t, s, "alice")
+		tampered := *c
+		tampered.Value = c.Value[:len(c.Value)-2] + "xx"
+
+		if _, ok := verify(t, s, nil, "alice"); ok {
+			t.Error("no cookie must not verify")
+		}
+		if _, ok := verify(t, s, &tampered, "alice"); ok {
+			t.Error("tampered cookie must not verify")
+		}
+		if _, ok := verify(t, s, c, "bob"); ok {
+			t.Error("another user's device must not verify")
+		}
+		if err := store.Delete("alice", d.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := verify(t, s, c, "alice"); ok {
+			t.Error("revoked device must not verify")
+		}
+	})
+
+	t.Run("expired device is forgotten", func(t *testing.T) {
+		s, store := newService(t, trusteddevice.Opts{})
+		d, c := trust(t, s, "alice")
+		d.ExpiresAt = time.Now().Add(-time.Minute)
+		if err := store.Delete("alice", d.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Insert(d); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := verify(t, s, c, "alice"); ok {
+			t.Error("expired device must not verify")
+		}
+		if _, err := store.Get(d.ID); err != trusteddevice.ErrDeviceNotFound {
+			t.Errorf("expired device should be deleted, got %v", err)
+		}
+	})
+
+	t.Run("re-trusting a browser replaces its device", func(t *testing.T) {
+		s, _ := newService(t, trusteddevice.Opts{})
+		first, c := trust(t, s, "alice")
+		r := httptest.NewRequest(http.MethodPost, "/login", nil)
+		r.AddCookie(c)
+		second, err := s.Trust(r, httptest.NewRecorder(), "alice", "renamed")
+		if err != nil {
+			t.Fatal(err)
+		}
+		list, err := s.List("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 1 || list[0].ID != second.ID || second.ID == first.ID {
+			t.Errorf("List = %+v, want only the new device", list)
+		}
+	})
+
+	t.Run("max per user forgets the oldest", func(t *testing.T) {
+		s, _ := newService(t, trusteddevice.Opts{MaxPerUser: 2})
+		oldest, c := trust(t, s, "alice")
+		trust(t, s, "alice")
+		trust(t, s, "alice")
+		list, err := s.List("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 2 {
+			t.Fatalf("want 2 devices, got %d", len(list))
+		}
+		for _, d := range list {
+			if d.ID == oldest.ID {
+				t.Error("the oldest device should have been forgotten")
+			}
+		}
+		if _, ok := verify(t, s, c, "alice"); ok {
+			t.Error("the forgotten device's cookie must not verify")
+		}
+	})
+}
+
+func TestListAndRevoke(t *testing.T) {
+	s, _ := newService(t, trusteddevice.Opts{})
+	a, ca := trust(t, s, "alice")
+	b, _ := trust(t, s, "alice")
+	trust(t, s, "bob")
+
+	verify(t, s, ca, "alice") // a is now the most recently used
+	list, err := s.List("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != a.ID || list[1].ID != b.ID {
+		t.Errorf("List order = %+v, want most recently used first", list)
+	}
+
+	if err := s.Revoke("bob", a.ID); err != trusteddevice.ErrDeviceNotFound {
+		t.Errorf("foreign revoke: want ErrDeviceNotFound, got %v", err)
+	}
+	if err := s.Revoke("alice", a.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if err := s.RevokeAll("alice"); err != nil {
+		t.Fatalf("RevokeAll: %v", err)
+	}
+	if list, _ := s.List("alice"); len(list) != 0 {
+		t.Errorf("alice should have no devices, got %+v", list)
+	}
+	if list, _ := s.List("bob"); len(list) != 1 {
+		t.Errorf("bob's device should survive, got %+v", list)
+	}
+}
+
+func TestForget(t *testing.T) {
+	s, _ := newService(t, trusteddevice.Opts{})
+	w := httptest.NewRecorder()
+	s.Forget(w)
+	c := w.Result().Cookies()
+	if len(c) != 1 || c[0].Name != trusteddevice.DefaultCookieName || c[0].MaxAge >= 0 {
+		t.Errorf("want an expiring device cookie, got %+v", c)
+	}
+}
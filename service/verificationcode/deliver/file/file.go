@@ -7,35 +7,73 @@ import (
 	"path/filepath"
 	"regexp"
 	"time"
+
+	"github.com/go-bumbu/userauth/service/verificationcode"
+	"github.com/go-bumbu/userauth/service/verificationcode/deliver/message"
 )
 
 // sanitize replaces characters unsafe for filenames.
 var unsafeChars = regexp.MustCompile(`[^a-zA-Z0-9@._+-]`)
 
+// Config configures a file Deliverer. Dir is required.
+type Config struct {
+	Dir string
+	// TemplateDir optionally overrides the embedded message templates; see
+	// package deliver/message for the directory layout.
+	TemplateDir string
+	// DefaultLocale is the fallback language for messages whose locale has
+	// no templates; defaults to English.
+	DefaultLocale string
+}
+
 // Deliverer writes verification codes to files on disk. Each call to Deliver
-// creates a new file in dir. Intended for development and testing.
+// creates a new file in dir holding the metadata and the rendered plain-text
+// message, so the wording can be reviewed without a mail server. Intended
+// for development and testing.
 type Deliverer struct {
-	dir string
+	dir      string
+	messages *message.Catalog
 }
 
-// New returns a Deliverer that writes files to dir.
+// New returns a Deliverer that writes files to dir, rendering the embedded
+// message templates. Use NewWithConfig to override the templates or the
+// default locale.
 func New(dir string) (*Deliverer, error) {
-	return &Deliverer{dir: dir}, nil
+	return NewWithConfig(Config{Dir: dir})
+}
+
+// NewWithConfig parses the message templates and returns a Deliverer that
+// writes files to cfg.Dir.
+func NewWithConfig(cfg Config) (*Deliverer, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("file delivery: dir is required")
+	}
+	messages, err := message.New(message.Opts{Dir: cfg.TemplateDir, DefaultLocale: cfg.DefaultLocale})
+	if err != nil {
+		return nil, fmt.Errorf("file delivery: %w", err)
+	}
+	return &Deliverer{dir: cfg.Dir, messages: messages}, nil
 }
 
-// Deliver writes a file containing the code and metadata.
-func (d *Deliverer) Deliver(_ context.Context, to string, code string, expiresAt time.Time) error {
+// Deliver writes a file containing the metadata and the rendered message.
+func (d *Deliverer) Deliver(_ context.Context, msg verificationcode.Message) error {
+	rendered, err := d.messages.Render(msg)
+	if err != nil {
+		return fmt.Errorf("file delivery: render: %w", err)
+	}
 	if err := os.MkdirAll(d.dir, 0750); err != nil {
 		return fmt.Errorf("file delivery: create dir: %w", err)
 	}
 
-	safe := unsafeChars.ReplaceAllString(to, "_")
+	safe := unsafeChars.ReplaceAllString(msg.To, "_")
 	// Also ensure no .. sequences remain (path traversal attempts)
 	safe = regexp.MustCompile(`\.\.`).ReplaceAllString(safe, "_")
 	name := fmt.Sprintf("%d-%s.txt", time.Now().UnixNano(), safe)
 	path := filepath.Join(d.dir, name)
 
-	body := fmt.Sprintf("to: %s\ncode: %s\nexpires: %s\n", to, code, expiresAt.UTC().Format(time.RFC3339))
+	body := fmt.Sprintf("to: %s\ncode: %s\nexpires: %s\npurpose: %s\nlocale: %s\nsubject: %s\n\n%s",
+		msg.To, msg.Code, msg.ExpiresAt.UTC().Format(time.RFC3339), msg.Purpose, rendered.Locale,
+		rendered.Subject, rendered.Text)
 
 	if err := os.WriteFile(path, []byte(body), 0600); err != nil {
 		return fmt.Errorf("file delivery: write: %w", err)
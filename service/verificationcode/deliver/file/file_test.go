@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-bumbu/userauth/service/verificationcode"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -19,7 +20,7 @@ func TestDeliver_CreatesFile(t *testing.T) {
 	}
 
 	exp := time.Now().UTC().Add(15 * time.Minute)
-	err = d.Deliver(context.Background(), "user@example.com", "123456", exp)
+	err = d.Deliver(context.Background(), verificationcode.Message{To: "user@example.com", Code: "123456", ExpiresAt: exp})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -52,7 +53,7 @@ func TestDeliver_CreatesDir(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = d.Deliver(context.Background(), "test@test.com", "999999", time.Now().Add(10*time.Minute))
+	err = d.Deliver(context.Background(), verificationcode.Message{To: "test@test.com", Code: "999999", ExpiresAt: time.Now().Add(10 * time.Minute)})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -73,7 +74,7 @@ func TestDeliver_SanitizesRecipient(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = d.Deliver(context.Background(), "user/../etc/passwd", "000000", time.Now().Add(5*time.Minute))
+	err = d.Deliver(context.Background(), verificationcode.Message{To: "user/../etc/passwd", Code: "000000", ExpiresAt: time.Now().Add(5 * time.Minute)})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -101,7 +102,7 @@ func TestDeliver_MultipleDeliveries(t *testing.T) {
 
 	for i := range 3 {
 		code := strings.Repeat(string(rune('1'+i)), 6)
-		err = d.Deliver(context.Background(), "user@example.com", code, time.Now().Add(15*time.Minute))
+		err = d.Deliver(context.Background(), verificationcode.Message{To: "user@example.com", Code: code, ExpiresAt: time.Now().Add(15 * time.Minute)})
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -115,3 +116,46 @@ func TestDeliver_MultipleDeliveries(t *testing.T) {
 		t.Fatalf("expected 3 files, got %d", len(entries))
 	}
 }
+
+func TestDeliver_RendersPurposeAndLocale(t *testing.T) {
+	dir := t.TempDir()
+	d, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.Deliver(context.Background(), verificationcode.Message{
+		To:        "user@example.com",
+		Code:      "123456",
+		ExpiresAt: time.Now().Add(10 * time.Minute),
+		Purpose:   verificationcode.PurposeRegistration,
+		Locale:    "de",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, entries[0].Name())) //nolint:gosec // reading from t.TempDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := string(content)
+	for _, want := range []string{"purpose: registration", "locale: de", "subject: Bestätigen Sie Ihre E-Mail-Adresse", "10 Minuten"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("file should contain %q, got: %s", want, body)
+		}
+	}
+}
+
+func TestNew_MissingDir(t *testing.T) {
+	if _, err := New(""); err == nil {
+		t.Fatal("expected error for missing dir")
+	}
+	if _, err := NewWithConfig(Config{}); err == nil {
+		t.Fatal("expected error for missing dir")
+	}
+}
@@ -0,0 +1,300 @@
+// Package message renders verification code messages from per-purpose,
+// per-locale templates. It is shared by the deliverers under deliver/ so
+// that every channel words a login code, a registration code and a password
+// reset code the same way.
+//
+// Templates are organised as <purpose>/<locale>/ directories, each holding:
+//
+//	subject.txt  text/template, one line (required)
+//	body.txt     text/template, the plain-text body (required)
+//	body.html    html/template, the HTML body (optional)
+//
+// body.html may invoke {{template "layout" .}} from a layout.html at the
+// root, which in turn calls the "intro", "expires" and "ignore" blocks the
+// body defines. The embedded defaults cover the module's well-known purposes
+// in English and German; Opts.Dir overrides them directory by directory.
+//
+// Lookup prefers the language over the purpose wording: a message for
+// purpose "login" and locale "de-CH" tries login/de-ch, default/de-ch,
+// login/de, default/de, login/<default locale>, default/<default locale>.
+package message
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/go-bumbu/userauth/service/verificationcode"
+)
+
+//go:embed templates
+var embedded embed.FS
+
+// DefaultLocale is the final fallback language when Opts.DefaultLocale is
+// empty.
+const DefaultLocale = "en"
+
+// PurposeDefault names the generic templates used for purposes without
+// their own directory (including an empty Purpose).
+const PurposeDefault verificationcode.Purpose = "default"
+
+const layoutFile = "layout.html"
+
+// Opts configures a Catalog. The zero value uses the embedded templates with
+// English as the fallback language.
+type Opts struct {
+	// Dir optionally points to a directory with the same layout as the
+	// embedded templates. Every <purpose>/<locale>/ found there replaces the
+	// embedded one; everything else keeps the embedded default.
+	Dir string
+	// DefaultLocale is the language used when neither the requested locale
+	// nor its base language has templates. default/<DefaultLocale> must
+	// exist, in Dir or embedded.
+	DefaultLocale string
+}
+
+// Data is passed to every template.
+type Data struct {
+	To        string
+	Code      string
+	ExpiresAt time.Time
+	// ExpiresIn is the remaining validity in English ("10 minutes");
+	// localized templates should phrase Minutes themselves.
+	ExpiresIn string
+	Minutes   int
+	Purpose   verificationcode.Purpose
+	Note      string // operator text, e.g. a rejection reason; often empty
+	Link      string // URL to open instead of typing the code; often empty
+	// Locale is the locale of the template set that was selected, not
+	// necessarily the one requested.
+	Locale string
+}
+
+// Rendered is a message ready for a transport. HTML is empty when the
+// selected template set has no body.html.
+type Rendered struct {
+	Subject string
+	Text    string
+	HTML    string
+	Locale  string
+}
+
+// Catalog holds the parsed templates. It is safe for concurrent use.
+type Catalog struct {
+	sets          map[string]*templateSet
+	defaultLocale string
+}
+
+type templateSet struct {
+	locale  string
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template // nil: plain-text only
+}
+
+// New parses the embedded templates and the optional override directory.
+// Template errors surface here, at startup, rather than on first delivery.
+func New(opts Opts) (*Catalog, error) {
+	if opts.DefaultLocale == "" {
+		opts.DefaultLocale = DefaultLocale
+	}
+	base, err := fs.Sub(embedded, "templates")
+	if err != nil {
+		return nil, err
+	}
+	sets, err := loadSets(base, nil)
+	if err != nil {
+		return nil, fmt.Errorf("message templates: embedded: %w", err)
+	}
+	if opts.Dir != "" {
+		if _, err := os.Stat(opts.Dir); err != nil {
+			return nil, fmt.Errorf("message templates: %w", err)
+		}
+		overrides, err := loadSets(os.DirFS(opts.Dir), base)
+		if err != nil {
+			return nil, fmt.Errorf("message templates: %s: %w", opts.Dir, err)
+		}
+		for k, v := range overrides {
+			sets[k] = v
+		}
+	}
+	c := &Catalog{sets: sets, defaultLocale: normalizeLocale(opts.DefaultLocale)}
+	if _, ok := c.sets[setKey(PurposeDefault, c.defaultLocale)]; !ok {
+		return nil, fmt.Errorf("message templates: no %s/%s templates for the default locale", PurposeDefault, c.defaultLocale)
+	}
+	return c, nil
+}
+
+// Render selects the template set for the message's purpose and locale and
+// executes it.
+func (c *Catalog) Render(msg verificationcode.Message) (Rendered, error) {
+	set := c.lookup(msg.Purpose, msg.Locale)
+	minutes := ceilMinutes(time.Until(msg.ExpiresAt))
+	data := Data{
+		To:        msg.To,
+		Code:      msg.Code,
+		ExpiresAt: msg.ExpiresAt,
+		ExpiresIn: formatMinutes(minutes),
+		Minutes:   minutes,
+		Purpose:   msg.Purpose,
+		Note:      msg.Note,
+		Link:      msg.Link,
+		Locale:    set.locale,
+	}
+
+	var subject, text bytes.Buffer
+	if err := set.subject.Execute(&subject, data); err != nil {
+		return Rendered{}, fmt.Errorf("subject: %w", err)
+	}
+	if err := set.text.Execute(&text, data); err != nil {
+		return Rendered{}, fmt.Errorf("text body: %w", err)
+	}
+	out := Rendered{
+		// a subject is a header: never let a template smuggle in a line break
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		Locale:  set.locale,
+	}
+	if set.html != nil {
+		var html bytes.Buffer
+		if err := set.html.Execute(&html, data); err != nil {
+			return Rendered{}, fmt.Errorf("html body: %w", err)
+		}
+		out.HTML = strings.TrimSpace(html.String()) + "\n"
+	}
+	return out, nil
+}
+
+// lookup walks the fallback chain described in the package comment; New
+// guarantees the last candidate exists.
+func (c *Catalog) lookup(purpose verificationcode.Purpose, locale string) *templateSet {
+	if purpose == "" {
+		purpose = PurposeDefault
+	}
+	for _, loc := range localeCandidates(normalizeLocale(locale), c.defaultLocale) {
+		for _, p := range []verificationcode.Purpose{purpose, PurposeDefault} {
+			if set, ok := c.sets[setKey(p, loc)]; ok {
+				return set
+			}
+		}
+	}
+	return c.sets[setKey(PurposeDefault, c.defaultLocale)]
+}
+
+// localeCandidates returns locale, its base language, and the default
+// locale, without duplicates or empty entries.
+func localeCandidates(locale, def string) []string {
+	var out []string
+	add := func(l string) {
+		if l == "" {
+			return
+		}
+		for _, seen := range out {
+			if seen == l {
+				return
+			}
+		}
+		out = append(out, l)
+	}
+	add(locale)
+	if lang, _, found := strings.Cut(locale, "-"); found {
+		add(lang)
+	}
+	add(def)
+	return out
+}
+
+// normalizeLocale lower-cases a tag and accepts POSIX-style underscores, so
+// "de_CH", "de-CH" and "de-ch" select the same directory.
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+func setKey(purpose verificationcode.Purpose, locale string) string {
+	return string(purpose) + "/" + locale
+}
+
+// loadSets parses every <purpose>/<locale>/ directory in fsys. A body.html
+// is parsed together with fsys's layout.html, or with fallbackLayout's when
+// fsys has none.
+func loadSets(fsys fs.FS, fallbackLayout fs.FS) (map[string]*templateSet, error) {
+	layout, err := fs.ReadFile(fsys, layoutFile)
+	if errors.Is(err, fs.ErrNotExist) && fallbackLayout != nil {
+		layout, err = fs.ReadFile(fallbackLayout, layoutFile)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	dirs, err := fs.Glob(fsys, "*/*/subject.txt")
+	if err != nil {
+		return nil, err
+	}
+	sets := make(map[string]*templateSet, len(dirs))
+	for _, subjectPath := range dirs {
+		dir := path.Dir(subjectPath)
+		purpose, locale := path.Dir(dir), normalizeLocale(path.Base(dir))
+		set, err := loadSet(fsys, dir, locale, layout)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", dir, err)
+		}
+		sets[setKey(verificationcode.Purpose(purpose), locale)] = set
+	}
+	return sets, nil
+}
+
+func loadSet(fsys fs.FS, dir, locale string, layout []byte) (*templateSet, error) {
+	subject, err := texttemplate.ParseFS(fsys, path.Join(dir, "subject.txt"))
+	if err != nil {
+		return nil, err
+	}
+	text, err := texttemplate.ParseFS(fsys, path.Join(dir, "body.txt"))
+	if err != nil {
+		return nil, err
+	}
+	set := &templateSet{locale: locale, subject: subject, text: text}
+
+	body, err := fs.ReadFile(fsys, path.Join(dir, "body.html"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return set, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	html := htmltemplate.New("body.html")
+	if layout != nil {
+		if _, err := html.New(layoutFile).Parse(string(layout)); err != nil {
+			return nil, fmt.Errorf("%s: %w", layoutFile, err)
+		}
+	}
+	if _, err := html.Parse(string(body)); err != nil {
+		return nil, err
+	}
+	set.html = html
+	return set, nil
+}
+
+// ceilMinutes rounds a remaining validity up to whole minutes, at least one.
+func ceilMinutes(d time.Duration) int {
+	minutes := int(math.Ceil(d.Minutes()))
+	if minutes < 1 {
+		return 1
+	}
+	return minutes
+}
+
+func formatMinutes(minutes int) string {
+	if minutes == 1 {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
@@ -0,0 +1,243 @@
+package message
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-bumbu/userauth/service/verificationcode"
+	"github.com/google/go-cmp/cmp"
+)
+
+func writeSet(t *testing.T, root, purpose, locale string, files map[string]string) {
+	t.Helper()
+	dir := filepath.Join(root, purpose, locale)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRender_Lookup(t *testing.T) {
+	c, err := New(Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcs := []struct {
+		name        string
+		purpose     verificationcode.Purpose
+		locale      string
+		wantSubject string
+		wantLocale  string
+	}{
+		{name: "purpose and locale", purpose: verificationcode.PurposeLogin, locale: "en", wantSubject: "Your sign-in code", wantLocale: "en"},
+		{name: "region falls back to language", purpose: verificationcode.PurposeLogin, locale: "de-AT", wantSubject: "Ihr Anmeldecode", wantLocale: "de"},
+		{name: "posix style tag", purpose: verificationcode.PurposePasswordReset, locale: "de_DE", wantSubject: "Ihr Code zum Zurücksetzen des Passworts", wantLocale: "de"},
+		{name: "unknown locale falls back to default", purpose: verificationcode.PurposeRegistration, locale: "fr", wantSubject: "Confirm your email address", wantLocale: "en"},
+		{name: "unknown purpose keeps the language", purpose: "email_change", locale: "de", wantSubject: "Ihr Bestätigungscode", wantLocale: "de"},
+		{name: "empty purpose and locale", wantSubject: "Your verification code", wantLocale: "en"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := c.Render(verificationcode.Message{
+				To: "u@example.com", Code: "123456", ExpiresAt: time.Now().Add(5 * time.Minute),
+				Purpose: tc.purpose, Locale: tc.locale,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Subject != tc.wantSubject {
+				t.Errorf("subject = %q, want %q", got.Subject, tc.wantSubject)
+			}
+			if got.Locale != tc.wantLocale {
+				t.Errorf("locale = %q, want %q", got.Locale, tc.wantLocale)
+			}
+			for name, body := range map[string]string{"text": got.Text, "html": got.HTML} {
+				if !strings.Contains(body, "123456") {
+					t.Errorf("%s body should contain the code, got:\n%s", name, body)
+				}
+			}
+		})
+	}
+}
+
+func TestRender_Notice(t *testing.T) {
+	c, err := New(Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcs := []struct {
+		name        string
+		msg         verificationcode.Message
+		wantSubject string
+		wantText    string
+	}{
+		{
+			name:        "approval without note",
+			msg:         verificationcode.Message{Purpose: verificationcode.PurposeRegistrationApproved},
+			wantSubject: "Your account has been approved",
+			wantText:    "Your account has been approved. You can sign in now.\n",
+		},
+		{
+			name:        "rejection with reason",
+			msg:         verificationcode.Message{Purpose: verificationcode.PurposeRegistrationRejected, Locale: "de", Note: "Spam"},
+			wantSubject: "Ihre Registrierung wurde nicht freigegeben",
+			wantText:    "Ihre Registrierung wurde geprüft und nicht freigegeben. Mit diesem Konto ist keine Anmeldung möglich.\n\nBegründung: Spam\n",
+		},
+		{
+			name:        "invite with link",
+			msg:         verificationcode.Message{Purpose: verificationcode.PurposeInvite, Code: "abc", Link: "https://example.com/register?invite=abc"},
+			wantSubject: "You have been invited",
+			wantText: "You have been invited to create an account.\n\nOpen this link to register:\n\n    https://example.com/register?invite=abc\n\n" +
+				"Your invite code is:\n\n    abc\n\nIf you did not expect this invite, you can safely ignore this email.\n",
+		},
+		{
+			name:        "invite with expiry",
+			msg:         verificationcode.Message{Purpose: verificationcode.PurposeInvite, Code: "abc", ExpiresAt: time.Date(2030, 1, 2, 3, 4, 0, 0, time.UTC)},
+			wantSubject: "You have been invited",
+			wantText: "You have been invited to create an account.\n\nYour invite code is:\n\n    abc\n\n" +
+				"The invite expires on 2030-01-02 03:04 UTC.\n\nIf you did not expect this invite, you can safely ignore this email.\n",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := c.Render(tc.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Subject != tc.wantSubject {
+				t.Errorf("subject = %q, want %q", got.Subject, tc.wantSubject)
+			}
+			if diff := cmp.Diff(tc.wantText, got.Text); diff != "" {
+				t.Errorf("text mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRender_OverrideDir(t *testing.T) {
+	dir := t.TempDir()
+	writeSet(t, dir, "login", "en", map[string]string{
+		"subject.txt": "Sign in to Example\n",
+		"body.txt":    "{{.Code}} ({{.Minutes}} min)",
+		// no layout.html in dir: the embedded layout is used
+		"body.html": `{{define "intro"}}Hi {{.To}}{{end}}{{define "expires"}}soon{{end}}{{define "ignore"}}{{end}}{{template "layout" .}}`,
+	})
+	writeSet(t, dir, "default", "fr", map[string]string{
+		"subject.txt": "Votre code",
+		"body.txt":    "Code : {{.Code}}",
+	})
+
+	c, err := New(Opts{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := time.Now().Add(3 * time.Minute)
+
+	got, err := c.Render(verificationcode.Message{To: "a<b>@example.com", Code: "111111", ExpiresAt: exp, Purpose: verificationcode.PurposeLogin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("Sign in to Example", got.Subject); diff != "" {
+		t.Errorf("unexpected subject (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("111111 (3 min)\n", got.Text); diff != "" {
+		t.Errorf("unexpected text (-want +got):\n%s", diff)
+	}
+	if !strings.Contains(got.HTML, "Hi a&lt;b&gt;@example.com") || !strings.Contains(got.HTML, `class="code">111111`) {
+		t.Errorf("html should use the embedded layout with escaped data, got:\n%s", got.HTML)
+	}
+
+	// a locale only the override provides, without an HTML body
+	got, err = c.Render(verificationcode.Message{Code: "222222", ExpiresAt: exp, Purpose: verificationcode.PurposeRegistration, Locale: "fr-CA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Rendered{Subject: "Votre code", Text: "Code : 222222\n", Locale: "fr"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected rendering (-want +got):\n%s", diff)
+	}
+
+	// sets not overridden keep the embedded wording
+	got, err = c.Render(verificationcode.Message{Code: "333333", ExpiresAt: exp, Purpose: verificationcode.PurposeRegistration})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Subject != "Confirm your email address" {
+		t.Errorf("unexpected subject %q", got.Subject)
+	}
+}
+
+func TestRender_SubjectIsOneLine(t *testing.T) {
+	dir := t.TempDir()
+	writeSet(t, dir, "default", "en", map[string]string{
+		"subject.txt": "Code\r\nBcc: victim@example.com\n{{.Code}}",
+		"body.txt":    "{{.Code}}",
+	})
+	c, err := New(Opts{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.Render(verificationcode.Message{Code: "123456", ExpiresAt: time.Now().Add(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("Code Bcc: victim@example.com 123456", got.Subject); diff != "" {
+		t.Errorf("unexpected subject (-want +got):\n%s", diff)
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	t.Run("missing dir", func(t *testing.T) {
+		if _, err := New(Opts{Dir: "/nonexistent/templates"}); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+	t.Run("template syntax", func(t *testing.T) {
+		dir := t.TempDir()
+		writeSet(t, dir, "login", "en", map[string]string{"subject.txt": "{{.Code", "body.txt": "x"})
+		if _, err := New(Opts{Dir: dir}); err == nil {
+			t.Fatal("expected parse error")
+		}
+	})
+	t.Run("missing body", func(t *testing.T) {
+		dir := t.TempDir()
+		writeSet(t, dir, "login", "en", map[string]string{"subject.txt": "x"})
+		if _, err := New(Opts{Dir: dir}); err == nil {
+			t.Fatal("expected error for missing body.txt")
+		}
+	})
+	t.Run("default locale without templates", func(t *testing.T) {
+		if _, err := New(Opts{DefaultLocale: "fr"}); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestFormatMinutes(t *testing.T) {
+	tcs := []struct {
+		name string
+		dur  time.Duration
+		want string
+	}{
+		{name: "15 minutes", dur: 15 * time.Minute, want: "15 minutes"},
+		{name: "1 minute", dur: 1 * time.Minute, want: "1 minute"},
+		{name: "90 seconds rounds to 2 minutes", dur: 90 * time.Second, want: "2 minutes"},
+		{name: "30 seconds shows 1 minute", dur: 30 * time.Second, want: "1 minute"},
+		{name: "expired shows 1 minute", dur: -time.Minute, want: "1 minute"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got := formatMinutes(ceilMinutes(tc.dur))
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("unexpected result (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
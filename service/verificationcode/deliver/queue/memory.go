@@ -0,0 +1,90 @@
+package queue
+
+import (
+	"cmp"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is the default Store: per-process, lost on restart. Safe for
+// concurrent use.
+type MemoryStore struct {
+	// Retention is how long Sweep keeps a record after its final status;
+	// zero means DefaultRetention.
+	Retention time.Duration
+
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record)}
+}
+
+func (s *MemoryStore) Add(rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[rec.ID] = rec
+	return nil
+}
+
+func (s *MemoryStore) Update(rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[rec.ID]; !ok {
+		return ErrNotFound
+	}
+	s.records[rec.ID] = rec
+	return nil
+}
+
+func (s *MemoryStore) Get(id string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[id]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	return rec, nil
+}
+
+func (s *MemoryStore) Claim(now, until time.Time, limit int) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Record
+	for _, rec := range s.records {
+		if rec.Status == StatusPending && !rec.NextAttempt.After(now) {
+			out = append(out, rec)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].NextAttempt.Before(out[j].NextAttempt) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	for i := range out {
+		out[i].NextAttempt = until
+		s.records[out[i].ID] = out[i]
+	}
+	return out, nil
+}
+
+// Sweep removes records that reached a final status more than Retention ago.
+func (s *MemoryStore) Sweep(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	cutoff := time.Now().Add(-cmp.Or(s.Retention, DefaultRetention))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for id, rec := range s.records {
+		if rec.Status != StatusPending && rec.UpdatedAt.Before(cutoff) {
+			delete(s.records, id)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,451 @@
+// Package queue makes any verificationcode.Deliverer asynchronous: Deliver
+// records the message and returns immediately, and a bounded pool of
+// workers hands it to the wrapped deliverer, retrying failures with
+// exponential backoff.
+//
+// Asynchronous delivery is what closes the timing side channel the login and
+// registration engines warn about: with a synchronous SMTP deliverer, a
+// request that issued a code takes visibly longer than one that did not.
+//
+// Queued messages live in a Store. The default is in-memory, so a restart
+// drops whatever was still queued; pass store/db to keep them in an outbox
+// table that a restarted queue picks up again. Because the outbox holds
+// plaintext codes until they are handed over, the queue blanks the code of
+// every record that reaches a final status, and never sends a code whose
+// expiry has already passed.
+//
+// Several queues may share one outbox: a queue claims a record before
+// handing it to a worker by moving its NextAttempt forward by a lease
+// (twice Opts.Timeout) in the same update that checks it is still due, so
+// only one of them sends it. Delivery is at least once: when an instance
+// dies or stalls past the lease mid-attempt, another one sends the code
+// again.
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/go-bumbu/userauth/service/verificationcode"
+	"github.com/google/uuid"
+)
+
+// Status is the delivery state of a queued message.
+type Status string
+
+const (
+	// StatusPending: queued, in flight, or waiting for a retry.
+	StatusPending Status = "pending"
+	// StatusSent: the wrapped deliverer accepted the message.
+	StatusSent Status = "sent"
+	// StatusFailed: every attempt failed; the queue gave up.
+	StatusFailed Status = "failed"
+	// StatusExpired: the code expired before it could be delivered.
+	StatusExpired Status = "expired"
+)
+
+// Record is a queued message and its delivery state.
+type Record struct {
+	ID          string
+	Message     verificationcode.Message // Code is blanked once the status is final
+	Status      Status
+	Attempts    int
+	NextAttempt time.Time // when a pending record is due
+	LastError   string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// DefaultRetention is how long the stores keep a record after it reached a
+// final status (sent, failed, expired) before Sweep removes it; long enough
+// to look into a failed delivery.
+const DefaultRetention = 7 * 24 * time.Hour
+
+// ErrNotFound is returned by Store.Get (and Queue.Status) for unknown IDs.
+var ErrNotFound = errors.New("queue: message not found")
+
+// ErrClosed is returned by Deliver after Close.
+var ErrClosed = errors.New("queue: closed")
+
+// Store persists queued messages. Implementations are pure persistence: the
+// queue decides statuses, retry times, leases and when codes are blanked.
+type Store interface {
+	// Add inserts a new record.
+	Add(rec Record) error
+	// Update replaces the stored record with the same ID.
+	Update(rec Record) error
+	// Get returns the record, or ErrNotFound.
+	Get(id string) (Record, error)
+	// Claim returns up to limit pending records whose NextAttempt is not
+	// after now, earliest first, and sets their NextAttempt to until. The
+	// check and the update must be atomic per record, so that a record is
+	// claimed by one caller only even when several queues share the store.
+	// The returned records carry the new NextAttempt.
+	Claim(now, until time.Time, limit int) ([]Record, error)
+}
+
+const (
+	defaultWorkers      = 4
+	defaultMaxAttempts  = 5
+	defaultBaseBackoff  = 2 * time.Second
+	defaultMaxBackoff   = 5 * time.Minute
+	defaultTimeout      = 30 * time.Second
+	defaultPollInterval = 5 * time.Second
+)
+
+// Opts configures a Queue. Zero-valued fields fall back to the defaults
+// (4 workers, 5 attempts, 2s doubling backoff capped at 5m, 30s per attempt,
+// 5s poll interval, in-memory store).
+type Opts struct {
+	// Store persists queued messages; nil keeps them in memory only.
+	Store Store
+	// Workers bounds how many messages are handed to the wrapped deliverer
+	// concurrently.
+	Workers     int
+	MaxAttempts int
+	// BaseBackoff is the wait after the first failure; it doubles per
+	// attempt (with jitter) up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Timeout bounds a single attempt of the wrapped deliverer. A claimed
+	// record is leased for twice Timeout before another queue sharing the
+	// store may claim it again.
+	Timeout time.Duration
+	// PollInterval is how often the store is checked for due retries and
+	// for records added by other instances sharing the outbox.
+	PollInterval time.Duration
+	// OnResult, when set, is called after every final status (sent, failed,
+	// expired), e.g. for metrics or alerting.
+	OnResult func(Record)
+	Logger   *slog.Logger // optional; defaults to slog.Default()
+}
+
+// Queue is an asynchronous verificationcode.Deliverer. Create it with New
+// and stop it with Close.
+type Queue struct {
+	next  verificationcode.Deliverer
+	store Store
+	opts  Opts
+
+	jobs chan Record
+	wake chan struct{}
+	// ctx is cancelled when Close gives up draining, aborting in-flight
+	// attempts.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	inFlight map[string]bool
+	closing  bool
+	added    uint64        // records enqueued so far; tells the dispatcher a feed may be stale
+	drained  chan struct{} // closed by the dispatcher once closing and idle
+	workers  sync.WaitGroup
+}
+
+// New starts the workers and the dispatcher. Pending records already in the
+// store (left over from a previous run) are delivered right away.
+func New(next verificationcode.Deliverer, opts Opts) (*Queue, error) {
+	if next == nil {
+		return nil, errors.New("queue: a deliverer is required")
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryStore()
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = defaultWorkers
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.BaseBackoff <= 0 {
+		opts.BaseBackoff = defaultBaseBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaultMaxBackoff
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultPollInterval
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue{
+		next:     next,
+		store:    opts.Store,
+		opts:     opts,
+		jobs:     make(chan Record),
+		wake:     make(chan struct{}, 1),
+		ctx:      ctx,
+		cancel:   cancel,
+		inFlight: make(map[string]bool),
+		drained:  make(chan struct{}),
+	}
+	for range opts.Workers {
+		q.workers.Add(1)
+		go q.work()
+	}
+	go q.dispatch()
+	return q, nil
+}
+
+// Deliver implements verificationcode.Deliverer: it records the message and
+// returns without waiting for the wrapped deliverer. Only a store failure or
+// a closed queue is reported; delivery failures surface through Status,
+// OnResult and the log.
+func (q *Queue) Deliver(_ context.Context, msg verificationcode.Message) error {
+	_, err := q.Enqueue(msg)
+	return err
+}
+
+// Enqueue is Deliver returning the record ID, for callers that want to
+// follow the message with Status.
+func (q *Queue) Enqueue(msg verificationcode.Message) (string, error) {
+	now := time.Now().UTC()
+	rec := Record{
+		ID:          uuid.NewString(),
+		Message:     msg,
+		Status:      StatusPending,
+		NextAttempt: now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	// the lock spans the check and the add, so Close cannot start draining
+	// between them and miss the record
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closing {
+		return "", ErrClosed
+	}
+	if err := q.store.Add(rec); err != nil {
+		return "", fmt.Errorf("queue: add: %w", err)
+	}
+	q.added++
+	q.poke()
+	return rec.ID, nil
+}
+
+// Status returns the current state of a queued message.
+func (q *Queue) Status(id string) (Record, error) {
+	return q.store.Get(id)
+}
+
+// Close stops accepting messages and drains: every record that is due now
+// is still handed to the wrapped deliverer. Retries scheduled for later are
+// not waited for; with a persistent store they resume on the next start.
+//
+// When ctx ends first, in-flight attempts are cancelled and Close returns
+// ctx.Err(); their records stay pending.
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if q.closing {
+		q.mu.Unlock()
+		return ErrClosed
+	}
+	q.closing = true
+	q.mu.Unlock()
+	q.poke()
+
+	done := make(chan struct{})
+	go func() {
+		<-q.drained
+		q.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// poke wakes the dispatcher without blocking.
+func (q *Queue) poke() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch feeds due records to the workers. Records are claimed in the
+// store before they are handed out, so neither this queue nor another one
+// sharing the store hands a record out twice concurrently.
+func (q *Queue) dispatch() {
+	ticker := time.NewTicker(q.opts.PollInterval)
+	defer ticker.Stop()
+	defer close(q.jobs)
+	for {
+		q.mu.Lock()
+		added := q.added
+		q.mu.Unlock()
+		q.feed()
+
+		q.mu.Lock()
+		// feed returns with idle workers only once nothing is due; a record
+		// enqueued while it ran needs another round
+		idle := q.closing && len(q.inFlight) == 0 && q.added == added
+		q.mu.Unlock()
+		if idle {
+			close(q.drained)
+			return
+		}
+
+		select {
+		case <-q.wake:
+		case <-ticker.C:
+		case <-q.ctx.Done():
+			close(q.drained)
+			return
+		}
+	}
+}
+
+// feed claims due records for the idle workers and hands them over, until
+// nothing is due or every worker is busy; release wakes the dispatcher
+// again when a worker frees up.
+func (q *Queue) feed() {
+	for {
+		idle := q.opts.Workers - q.inFlightCount()
+		if idle <= 0 {
+			return
+		}
+		now := time.Now().UTC()
+		recs, err := q.store.Claim(now, now.Add(2*q.opts.Timeout), idle)
+		if err != nil {
+			q.opts.Logger.Error("queue: claiming due messages failed", "error", err)
+			return
+		}
+		if len(recs) == 0 {
+			return
+		}
+		for i, rec := range recs {
+			q.mu.Lock()
+			q.inFlight[rec.ID] = true
+			q.mu.Unlock()
+			select {
+			case q.jobs <- rec:
+			case <-q.ctx.Done():
+				// hand the unsent claims back for the next start
+				for _, r := range recs[i:] {
+					r.NextAttempt = time.Now().UTC()
+					q.save(r)
+					q.release(r.ID)
+				}
+				return
+			}
+		}
+	}
+}
+
+func (q *Queue) inFlightCount() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.inFlight)
+}
+
+func (q *Queue) release(id string) {
+	q.mu.Lock()
+	delete(q.inFlight, id)
+	q.mu.Unlock()
+	q.poke()
+}
+
+func (q *Queue) work() {
+	defer q.workers.Done()
+	for rec := range q.jobs {
+		q.attempt(rec)
+		q.release(rec.ID)
+	}
+}
+
+// attempt makes one delivery attempt and records the outcome.
+func (q *Queue) attempt(rec Record) {
+	now := time.Now().UTC()
+	if !rec.Message.ExpiresAt.IsZero() && now.After(rec.Message.ExpiresAt) {
+		q.finish(rec, StatusExpired, "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(q.ctx, q.opts.Timeout)
+	err := q.next.Deliver(ctx, rec.Message)
+	cancel()
+	rec.Attempts++
+	if err == nil {
+		q.finish(rec, StatusSent, "")
+		return
+	}
+	if q.ctx.Err() != nil {
+		// aborted by Close: not the deliverer's fault, try again next start
+		rec.Attempts--
+		rec.NextAttempt = time.Now().UTC()
+		q.save(rec)
+		return
+	}
+	if rec.Attempts >= q.opts.MaxAttempts {
+		q.finish(rec, StatusFailed, err.Error())
+		return
+	}
+	rec.LastError = err.Error()
+	rec.NextAttempt = now.Add(q.backoff(rec.Attempts))
+	q.opts.Logger.Warn("queue: delivery attempt failed, will retry",
+		"id", rec.ID, "attempt", rec.Attempts, "retryAt", rec.NextAttempt, "error", err)
+	q.save(rec)
+}
+
+// finish records a final status and blanks the code and the link, which
+// usually embeds it: the outbox keeps a plaintext code only while it may
+// still be sent.
+func (q *Queue) finish(rec Record, status Status, lastErr string) {
+	rec.Status = status
+	rec.LastError = lastErr
+	rec.Message.Code = ""
+	rec.Message.Link = ""
+	if q.save(rec) != nil {
+		return
+	}
+	if status == StatusFailed {
+		q.opts.Logger.Error("queue: delivery failed, giving up", "id", rec.ID, "attempts", rec.Attempts, "error", lastErr)
+	} else {
+		q.opts.Logger.Debug("queue: delivery finished", "id", rec.ID, "status", status, "attempts", rec.Attempts)
+	}
+	if q.opts.OnResult != nil {
+		q.opts.OnResult(rec)
+	}
+}
+
+func (q *Queue) save(rec Record) error {
+	rec.UpdatedAt = time.Now().UTC()
+	if err := q.store.Update(rec); err != nil {
+		q.opts.Logger.Error("queue: updating message failed", "id", rec.ID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// backoff returns the wait before the next attempt: BaseBackoff doubled per
+// failed attempt, capped at MaxBackoff, minus up to 20% jitter so that a
+// burst of failures does not retry in lockstep.
+func (q *Queue) backoff(attempts int) time.Duration {
+	d := q.opts.BaseBackoff
+	for i := 1; i < attempts && d < q.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > q.opts.MaxBackoff {
+		d = q.opts.MaxBackoff
+	}
+	jitter := time.Duration(rand.Int64N(int64(d)/5 + 1)) //nolint:gosec // jitter, not a secret
+	return d - jitter
+}
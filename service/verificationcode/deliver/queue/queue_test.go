@@ -0,0 +1,387 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-bumbu/userauth/service/verificationcode"
+	"github.com/go-bumbu/userauth/service/verificationcode/deliver/queue"
+	"github.com/go-bumbu/userauth/service/verificationcode/deliver/queue/store/db"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// fakeDeliverer records delivered messages; it can fail a number of times,
+// block until released, and track the peak concurrency.
+type fakeDeliverer struct {
+	mu        sync.Mutex
+	delivered []verificationcode.Message
+	failFirst int
+	calls     int
+	block     chan struct{} // when set, Deliver waits for it (or ctx)
+
+	active, peak atomic.Int32
+}
+
+func (d *fakeDeliverer) Deliver(ctx context.Context, msg verificationcode.Message) error {
+	n := d.active.Add(1)
+	defer d.active.Add(-1)
+	for {
+		p := d.peak.Load()
+		if n <= p || d.peak.CompareAndSwap(p, n) {
+			break
+		}
+	}
+	if d.block != nil {
+		select {
+		case <-d.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls++
+	if d.calls <= d.failFirst {
+		return errors.New("smtp down")
+	}
+	d.delivered = append(d.delivered, msg)
+	return nil
+}
+
+func (d *fakeDeliverer) count() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.delivered)
+}
+
+func msg(to string) verificationcode.Message {
+	return verificationcode.Message{
+		To: to, Code: "123456", ExpiresAt: time.Now().Add(10 * time.Minute), Purpose: verificationcode.PurposeLogin,
+		Link: "https://example.com/verify?code=123456",
+	}
+}
+
+// waitStatus polls until the record reaches want or the deadline passes.
+func waitStatus(t *testing.T, q *queue.Queue, id string, want queue.Status) queue.Record {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec, err := q.Status(id)
+		if err != nil {
+			t.Fatalf("Status: %v", err)
+		}
+		if rec.Status == want {
+			return rec
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status = %s after 5s, want %s (record %+v)", rec.Status, want, rec)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func closeQueue(t *testing.T, q *queue.Queue) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := q.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestDeliverReturnsImmediately(t *testing.T) {
+	next := &fakeDeliverer{block: make(chan struct{})}
+	q, err := queue.New(next, queue.Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	id, err := q.Enqueue(msg("a@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Deliver(context.Background(), msg("b@example.com")); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Deliver blocked for %v", elapsed)
+	}
+	if rec, _ := q.Status(id); rec.Status != queue.StatusPending {
+		t.Errorf("want pending while the deliverer blocks, got %s", rec.Status)
+	}
+
+	close(next.block)
+	rec := waitStatus(t, q, id, queue.StatusSent)
+	if rec.Message.Code != "" || rec.Message.Link != "" {
+		t.Error("the code and link must be blanked once sent")
+	}
+	if rec.Attempts != 1 {
+		t.Errorf("want 1 attempt, got %d", rec.Attempts)
+	}
+	closeQueue(t, q)
+	if next.count() != 2 {
+		t.Errorf("want 2 deliveries, got %d", next.count())
+	}
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	next := &fakeDeliverer{failFirst: 2}
+	var results []queue.Record
+	var mu sync.Mutex
+	q, err := queue.New(next, queue.Opts{
+		BaseBackoff:  10 * time.Millisecond,
+		PollInterval: 5 * time.Millisecond,
+		OnResult: func(r queue.Record) {
+			mu.Lock()
+			results = append(results, r)
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeQueue(t, q)
+
+	id, err := q.Enqueue(msg("a@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := waitStatus(t, q, id, queue.StatusSent)
+	if rec.Attempts != 3 {
+		t.Errorf("want 3 attempts, got %d", rec.Attempts)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(results) != 1 || results[0].Status != queue.StatusSent {
+		t.Errorf("want one sent result, got %+v", results)
+	}
+}
+
+func TestGivesUpAfterMaxAttempts(t *testing.T) {
+	next := &fakeDeliverer{failFirst: 100}
+	q, err := queue.New(next, queue.Opts{
+		MaxAttempts:  2,
+		BaseBackoff:  time.Millisecond,
+		PollInterval: 5 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeQueue(t, q)
+
+	id, _ := q.Enqueue(msg("a@example.com"))
+	rec := waitStatus(t, q, id, queue.StatusFailed)
+	if rec.Attempts != 2 || rec.LastError != "smtp down" || rec.Message.Code != "" {
+		t.Errorf("unexpected failed record %+v", rec)
+	}
+}
+
+func TestExpiredCodesAreNotSent(t *testing.T) {
+	next := &fakeDeliverer{}
+	q, err := queue.New(next, queue.Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := msg("a@example.com")
+	m.ExpiresAt = time.Now().Add(-time.Second)
+	id, _ := q.Enqueue(m)
+	waitStatus(t, q, id, queue.StatusExpired)
+	closeQueue(t, q)
+	if next.count() != 0 {
+		t.Error("an expired code must not be delivered")
+	}
+}
+
+func TestWorkerPoolIsBounded(t *testing.T) {
+	next := &fakeDeliverer{block: make(chan struct{})}
+	q, err := queue.New(next, queue.Opts{Workers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 6 {
+		if _, err := q.Enqueue(msg("a@example.com")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(next.block)
+	closeQueue(t, q)
+	if next.count() != 6 {
+		t.Errorf("want 6 deliveries, got %d", next.count())
+	}
+	if p := next.peak.Load(); p > 2 {
+		t.Errorf("peak concurrency %d exceeds 2 workers", p)
+	}
+}
+
+func TestCloseDrainsAndRejects(t *testing.T) {
+	next := &fakeDeliverer{}
+	q, err := queue.New(next, queue.Opts{Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 20 {
+		_, _ = q.Enqueue(msg("a@example.com"))
+	}
+	closeQueue(t, q)
+	if next.count() != 20 {
+		t.Errorf("Close should drain every queued message, delivered %d", next.count())
+	}
+	if err := q.Deliver(context.Background(), msg("late@example.com")); !errors.Is(err, queue.ErrClosed) {
+		t.Errorf("Deliver after Close: err = %v, want ErrClosed", err)
+	}
+}
+
+func TestEnqueueRacingClose(t *testing.T) {
+	for range 50 {
+		next := &fakeDeliverer{}
+		q, err := queue.New(next, queue.Opts{Workers: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var accepted atomic.Int64
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 10 {
+					_, err := q.Enqueue(msg("a@example.com"))
+					switch {
+					case err == nil:
+						accepted.Add(1)
+					case !errors.Is(err, queue.ErrClosed):
+						t.Errorf("Enqueue: %v", err)
+					}
+				}
+			}()
+		}
+		closeQueue(t, q)
+		wg.Wait()
+		if got := int64(next.count()); got != accepted.Load() {
+			t.Fatalf("every accepted message must be delivered before Close returns: accepted %d, delivered %d", accepted.Load(), got)
+		}
+	}
+}
+
+func TestCloseTimeoutCancelsInFlight(t *testing.T) {
+	next := &fakeDeliverer{block: make(chan struct{})}
+	q, err := queue.New(next, queue.Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := q.Enqueue(msg("a@example.com"))
+	time.Sleep(20 * time.Millisecond) // let a worker pick it up
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := q.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Close: err = %v, want deadline exceeded", err)
+	}
+	rec, err := q.Status(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Status != queue.StatusPending || rec.Attempts != 0 || rec.Message.Code == "" {
+		t.Errorf("an aborted attempt must leave the message pending for the next start, got %+v", rec)
+	}
+}
+
+func TestOutboxSurvivesRestart(t *testing.T) {
+	// a file, not :memory:, so the workers' pooled connections share one database
+	gdb, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "outbox.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := db.New(gdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// first run: the deliverer never returns before shutdown
+	first, err := queue.New(&fakeDeliverer{block: make(chan struct{})}, queue.Opts{Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := first.Enqueue(msg("a@example.com"))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_ = first.Close(ctx)
+
+	// second run over the same outbox picks the message up
+	next := &fakeDeliverer{}
+	second, err := queue.New(next, queue.Opts{Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, second, id, queue.StatusSent)
+	closeQueue(t, second)
+	if next.count() != 1 || next.delivered[0].Code != "123456" {
+		t.Errorf("want the original message delivered after restart, got %+v", next.delivered)
+	}
+}
+
+func TestSharedOutboxSendsOnce(t *testing.T) {
+	gdb, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "outbox.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := db.New(gdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// two instances poll one outbox; records added through either are
+	// claimed by exactly one of them
+	next := &fakeDeliverer{}
+	var queues []*queue.Queue
+	for range 2 {
+		q, err := queue.New(next, queue.Opts{Store: store, PollInterval: time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		queues = append(queues, q)
+	}
+	var ids []string
+	for i := range 20 {
+		id, err := queues[i%2].Enqueue(msg(fmt.Sprintf("u%d@example.com", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	for _, id := range ids {
+		waitStatus(t, queues[0], id, queue.StatusSent)
+	}
+	for _, q := range queues {
+		closeQueue(t, q)
+	}
+	if next.count() != 20 {
+		t.Errorf("want 20 deliveries, got %d", next.count())
+	}
+}
+
+func TestStatusUnknown(t *testing.T) {
+	q, err := queue.New(&fakeDeliverer{}, queue.Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeQueue(t, q)
+	if _, err := q.Status("nope"); !errors.Is(err, queue.ErrNotFound) {
+		t.Errorf("err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestNewRequiresDeliverer(t *testing.T) {
+	if _, err := queue.New(nil, queue.Opts{}); err == nil {
+		t.Fatal("want error for nil deliverer")
+	}
+}
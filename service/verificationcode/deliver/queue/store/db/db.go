@@ -0,0 +1,164 @@
+// Package db provides a GORM-backed queue.Store: an outbox table
+// (verification_outbox) that survives restarts, so messages queued but not
+// yet delivered are picked up again by the next queue.New. It owns its own
+// model and auto-migration, independent from userdb.
+package db
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-bumbu/userauth/service/verificationcode"
+	"github.com/go-bumbu/userauth/service/verificationcode/deliver/queue"
+	"gorm.io/gorm"
+)
+
+// outboxModel stores one queued message (verification_outbox table). Code
+// holds the plaintext code while the message is pending; the queue blanks
+// it once the status is final.
+type outboxModel struct {
+	ID          string `gorm:"primaryKey"`
+	To          string `gorm:"not null"`
+	Code        string
+	ExpiresAt   time.Time
+	Purpose     string
+	Locale      string
+	Note        string
+	Link        string
+	Status      string    `gorm:"index:idx_outbox_due;not null"`
+	NextAttempt time.Time `gorm:"index:idx_outbox_due"`
+	Attempts    int       `gorm:"not null"`
+	LastError   string
+	// the queue owns the timestamps; GORM must not rewrite them
+	CreatedAt time.Time `gorm:"autoCreateTime:false"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime:false"`
+}
+
+func (outboxModel) TableName() string { return "verification_outbox" }
+
+func toModel(rec queue.Record) outboxModel {
+	return outboxModel{
+		ID:          rec.ID,
+		To:          rec.Message.To,
+		Code:        rec.Message.Code,
+		ExpiresAt:   rec.Message.ExpiresAt,
+		Purpose:     string(rec.Message.Purpose),
+		Locale:      rec.Message.Locale,
+		Note:        rec.Message.Note,
+		Link:        rec.Message.Link,
+		Status:      string(rec.Status),
+		NextAttempt: rec.NextAttempt,
+		Attempts:    rec.Attempts,
+		LastError:   rec.LastError,
+		CreatedAt:   rec.CreatedAt,
+		UpdatedAt:   rec.UpdatedAt,
+	}
+}
+
+func (m outboxModel) record() queue.Record {
+	return queue.Record{
+		ID: m.ID,
+		Message: verificationcode.Message{
+			To:        m.To,
+			Code:      m.Code,
+			ExpiresAt: m.ExpiresAt,
+			Purpose:   verificationcode.Purpose(m.Purpose),
+			Locale:    m.Locale,
+			Note:      m.Note,
+			Link:      m.Link,
+		},
+		Status:      queue.Status(m.Status),
+		NextAttempt: m.NextAttempt,
+		Attempts:    m.Attempts,
+		LastError:   m.LastError,
+		CreatedAt:   m.CreatedAt,
+		UpdatedAt:   m.UpdatedAt,
+	}
+}
+
+// Store is a GORM-backed outbox.
+type Store struct {
+	// Retention is how long Sweep keeps a row after its final status; zero
+	// means queue.DefaultRetention.
+	Retention time.Duration
+
+	db *gorm.DB
+}
+
+// New creates a Store and auto-migrates the verification_outbox table.
+func New(db *gorm.DB) (*Store, error) {
+	if err := db.AutoMigrate(&outboxModel{}); err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Add inserts a new record.
+func (s *Store) Add(rec queue.Record) error {
+	m := toModel(rec)
+	return s.db.Create(&m).Error
+}
+
+// Update replaces the stored record with the same ID.
+func (s *Store) Update(rec queue.Record) error {
+	m := toModel(rec)
+	// Select("*") writes zero values too: a blanked code must be persisted
+	res := s.db.Model(&outboxModel{}).Where("id = ?", rec.ID).Select("*").Updates(&m)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return queue.ErrNotFound
+	}
+	return nil
+}
+
+// Get returns the record, or queue.ErrNotFound.
+func (s *Store) Get(id string) (queue.Record, error) {
+	var m outboxModel
+	if err := s.db.Where("id = ?", id).First(&m).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return queue.Record{}, queue.ErrNotFound
+		}
+		return queue.Record{}, err
+	}
+	return m.record(), nil
+}
+
+// Claim returns up to limit pending records whose NextAttempt is not after
+// now, earliest first, and moves their NextAttempt to until. Each row is
+// claimed with an update that repeats the due condition, so of several
+// queues racing for it only the one whose update matched gets it.
+func (s *Store) Claim(now, until time.Time, limit int) ([]queue.Record, error) {
+	var ms []outboxModel
+	err := s.db.Where("status = ? AND next_attempt <= ?", string(queue.StatusPending), now).
+		Order("next_attempt ASC").Limit(limit).Find(&ms).Error
+	if err != nil {
+		return nil, err
+	}
+	out := make([]queue.Record, 0, len(ms))
+	for _, m := range ms {
+		res := s.db.Model(&outboxModel{}).
+			Where("id = ? AND status = ? AND next_attempt <= ?", m.ID, string(queue.StatusPending), now).
+			Update("next_attempt", until)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			continue // claimed by another queue in the meantime
+		}
+		m.NextAttempt = until
+		out = append(out, m.record())
+	}
+	return out, nil
+}
+
+// Sweep deletes rows that reached a final status more than Retention ago.
+func (s *Store) Sweep(ctx context.Context) (int, error) {
+	cutoff := time.Now().UTC().Add(-cmp.Or(s.Retention, queue.DefaultRetention))
+	res := s.db.WithContext(ctx).Where("status <> ? AND updated_at < ?", string(queue.StatusPending), cutoff).
+		Delete(&outboxModel{})
+	return int(res.RowsAffected), res.Error
+}
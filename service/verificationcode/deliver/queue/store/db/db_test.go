@@ -0,0 +1,29 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/go-bumbu/userauth/service/verificationcode/deliver/queue"
+	"github.com/go-bumbu/userauth/service/verificationcode/deliver/queue/storetest"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newStore(t *testing.T) *Store {
+	t.Helper()
+	gdb, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	s, err := New(gdb)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return s
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) queue.Store {
+		return newStore(t)
+	})
+}
@@ -0,0 +1,266 @@
+// Package storetest provides a conformance suite that every queue.Store
+// implementation must pass. Store tests call Run with a factory that returns a
+// fresh, empty store.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-bumbu/userauth"
+	"github.com/go-bumbu/userauth/service/verificationcode"
+	"github.com/go-bumbu/userauth/service/verificationcode/deliver/queue"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// sameInstant compares times by instant, ignoring location and monotonic
+// clock, so stores may return UTC or local times.
+var sameInstant = cmpopts.EquateApproxTime(time.Millisecond)
+
+func record(id string, next time.Time) queue.Record {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	return queue.Record{
+		ID: id,
+		Message: verificationcode.Message{
+			To:        id + "@example.com",
+			Code:      "123456",
+			ExpiresAt: now.Add(10 * time.Minute),
+			Purpose:   verificationcode.PurposeLogin,
+			Locale:    "de",
+			Note:      "queued for delivery",
+			Link:      "https://example.com/register?invite=123456",
+		},
+		Status:      queue.StatusPending,
+		NextAttempt: next.UTC().Truncate(time.Millisecond),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+// final returns a record with the given status, last updated at updated.
+func final(id string, status queue.Status, updated time.Time) queue.Record {
+	rec := record(id, updated)
+	rec.Status = status
+	rec.Message.Code = ""
+	rec.Message.Link = ""
+	rec.CreatedAt = updated.UTC().Truncate(time.Millisecond)
+	rec.UpdatedAt = rec.CreatedAt
+	return rec
+}
+
+func ids(recs []queue.Record) []string {
+	out := make([]string, 0, len(recs))
+	for _, r := range recs {
+		out = append(out, r.ID)
+	}
+	return out
+}
+
+// Run exercises the queue.Store contract against a fresh store per subtest.
+func Run(t *testing.T, newStore func(t *testing.T) queue.Store) {
+	t.Helper()
+
+	t.Run("get unknown reports ErrNotFound", func(t *testing.T) {
+		s := newStore(t)
+		if _, err := s.Get("nope"); !errors.Is(err, queue.ErrNotFound) {
+			t.Errorf("Get: err = %v, want queue.ErrNotFound", err)
+		}
+	})
+
+	t.Run("add and get round-trip", func(t *testing.T) {
+		s := newStore(t)
+		in := record("a", time.Now())
+		if err := s.Add(in); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+		got, err := s.Get("a")
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if diff := cmp.Diff(in, got, sameInstant); diff != "" {
+			t.Errorf("round-trip (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("update replaces the record", func(t *testing.T) {
+		s := newStore(t)
+		in := record("a", time.Now())
+		if err := s.Add(in); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+		in.Status = queue.StatusSent
+		in.Attempts = 2
+		in.LastError = "temporary"
+		in.Message.Code = ""
+		if err := s.Update(in); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		got, err := s.Get("a")
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if diff := cmp.Diff(in, got, sameInstant); diff != "" {
+			t.Errorf("after update (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("update unknown reports ErrNotFound", func(t *testing.T) {
+		s := newStore(t)
+		if err := s.Update(record("nope", time.Now())); !errors.Is(err, queue.ErrNotFound) {
+			t.Errorf("Update: err = %v, want queue.ErrNotFound", err)
+		}
+	})
+
+	t.Run("claim returns pending records in order, up to limit", func(t *testing.T) {
+		s := newStore(t)
+		now := time.Now()
+		sent := record("sent", now.Add(-time.Hour))
+		sent.Status = queue.StatusSent
+		for _, rec := range []queue.Record{
+			record("later", now.Add(time.Hour)),
+			record("second", now.Add(-time.Minute)),
+			record("first", now.Add(-2*time.Minute)),
+			record("third", now),
+			sent,
+		} {
+			if err := s.Add(rec); err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+		}
+
+		until := now.Add(time.Minute).UTC().Truncate(time.Millisecond)
+		got, err := s.Claim(now, until, 2)
+		if err != nil {
+			t.Fatalf("Claim: %v", err)
+		}
+		if diff := cmp.Diff([]string{"first", "second"}, ids(got)); diff != "" {
+			t.Errorf("claim with limit (-want +got):\n%s", diff)
+		}
+		for _, rec := range got {
+			if !rec.NextAttempt.Equal(until) {
+				t.Errorf("%s: returned NextAttempt = %v, want %v", rec.ID, rec.NextAttempt, until)
+			}
+		}
+
+		got, err = s.Claim(now, until, 10)
+		if err != nil {
+			t.Fatalf("Claim: %v", err)
+		}
+		if diff := cmp.Diff([]string{"third"}, ids(got)); diff != "" {
+			t.Errorf("second claim (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("claimed records are due again after the lease", func(t *testing.T) {
+		s := newStore(t)
+		now := time.Now()
+		if err := s.Add(record("a", now.Add(-time.Minute))); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+		until := now.Add(time.Minute)
+		if got, err := s.Claim(now, until, 10); err != nil || len(got) != 1 {
+			t.Fatalf("Claim: got %v, err %v; want one record", ids(got), err)
+		}
+		stored, err := s.Get("a")
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if diff := cmp.Diff(until, stored.NextAttempt, sameInstant); diff != "" {
+			t.Errorf("stored NextAttempt (-want +got):\n%s", diff)
+		}
+		if got, _ := s.Claim(now.Add(30*time.Second), until, 10); len(got) != 0 {
+			t.Errorf("claim during lease: got %v, want none", ids(got))
+		}
+		if got, _ := s.Claim(until.Add(time.Second), until.Add(time.Minute), 10); len(got) != 1 {
+			t.Errorf("claim after lease: got %v, want [a]", ids(got))
+		}
+	})
+
+	t.Run("concurrent claims hand out each record once", func(t *testing.T) {
+		s := newStore(t)
+		now := time.Now()
+		for i := range 20 {
+			if err := s.Add(record(fmt.Sprintf("r%02d", i), now.Add(-time.Minute))); err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+		}
+		var (
+			mu      sync.Mutex
+			claimed = map[string]int{}
+			wg      sync.WaitGroup
+		)
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					got, err := s.Claim(now, now.Add(time.Hour), 3)
+					if err != nil {
+						t.Errorf("Claim: %v", err)
+						return
+					}
+					if len(got) == 0 {
+						return
+					}
+					mu.Lock()
+					for _, rec := range got {
+						claimed[rec.ID]++
+					}
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		if len(claimed) != 20 {
+			t.Errorf("claimed %d distinct records, want 20", len(claimed))
+		}
+		for id, n := range claimed {
+			if n != 1 {
+				t.Errorf("%s claimed %d times", id, n)
+			}
+		}
+	})
+
+	t.Run("sweep removes final records past retention", func(t *testing.T) {
+		s := newStore(t)
+		sw, ok := s.(userauth.Sweeper)
+		if !ok {
+			t.Skip("store does not implement userauth.Sweeper")
+		}
+		old := time.Now().Add(-queue.DefaultRetention - time.Hour)
+		for _, rec := range []queue.Record{
+			final("sent", queue.StatusSent, old),
+			final("failed", queue.StatusFailed, old),
+			final("expired", queue.StatusExpired, old),
+			final("recent", queue.StatusSent, time.Now()),
+			final("pending", queue.StatusPending, old),
+		} {
+			if err := s.Add(rec); err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+		}
+
+		n, err := sw.Sweep(context.Background())
+		if err != nil {
+			t.Fatalf("Sweep: %v", err)
+		}
+		if n != 3 {
+			t.Errorf("removed %d records, want 3", n)
+		}
+		for _, id := range []string{"sent", "failed", "expired"} {
+			if _, err := s.Get(id); !errors.Is(err, queue.ErrNotFound) {
+				t.Errorf("%s: err = %v, want queue.ErrNotFound", id, err)
+			}
+		}
+		for _, id := range []string{"recent", "pending"} {
+			if _, err := s.Get(id); err != nil {
+				t.Errorf("%s must survive the sweep: %v", id, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,16 @@
+package storetest_test
+
+import (
+	"testing"
+
+	"github.com/go-bumbu/userauth/service/verificationcode/deliver/queue"
+	"github.com/go-bumbu/userauth/service/verificationcode/deliver/queue/storetest"
+)
+
+// TestRunAgainstMemory exercises the conformance suite itself; the memory
+// store is the reference implementation.
+func TestRunAgainstMemory(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) queue.Store {
+		return queue.NewMemoryStore()
+	})
+}
@@ -0,0 +1,215 @@
+package smtp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DKIMConfig enables DKIM signing (RFC 6376) with relaxed/relaxed
+// canonicalization. The public key must be published in DNS at
+// <Selector>._domainkey.<Domain>.
+type DKIMConfig struct {
+	Domain   string // d= tag, normally the domain of From
+	Selector string // s= tag
+	// PrivateKey is a PEM key (PKCS#1 or PKCS#8; RSA or Ed25519), or
+	// "@/path/to/key.pem" to read it from disk.
+	PrivateKey string
+	// Headers lists the header fields to sign; defaults to
+	// DefaultDKIMHeaders. Fields missing from a message are skipped.
+	Headers []string
+}
+
+// DefaultDKIMHeaders are the header fields signed when DKIMConfig.Headers is
+// empty.
+var DefaultDKIMHeaders = []string{
+	"From", "To", "Subject", "Date", "Message-ID",
+	"MIME-Version", "Content-Type", "Content-Language",
+}
+
+type dkimSigner struct {
+	domain   string
+	selector string
+	key      crypto.Signer
+	algo     string // a= tag
+	headers  []string
+}
+
+func newDKIMSigner(cfg DKIMConfig) (*dkimSigner, error) {
+	if cfg.Domain == "" || cfg.Selector == "" {
+		return nil, errors.New("domain and selector are required")
+	}
+	raw, err := resolvePassword(cfg.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode([]byte(raw))
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+	var key any
+	if key, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+		if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("parsing private key: %w", err)
+		}
+	}
+
+	s := &dkimSigner{domain: cfg.Domain, selector: cfg.Selector, headers: cfg.Headers}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		s.key, s.algo = k, "rsa-sha256"
+	case ed25519.PrivateKey:
+		s.key, s.algo = k, "ed25519-sha256"
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	if len(s.headers) == 0 {
+		s.headers = DefaultDKIMHeaders
+	}
+	return s, nil
+}
+
+// sign returns msg with a DKIM-Signature header prepended. msg must use CRLF
+// line endings, as renderMessage produces.
+func (s *dkimSigner) sign(msg []byte) ([]byte, error) {
+	header, body, ok := bytes.Cut(msg, []byte("\r\n\r\n"))
+	if !ok {
+		return nil, errors.New("message has no header/body separator")
+	}
+	fields := splitHeaderFields(string(header) + "\r\n")
+
+	// sign the last instance of each listed field (RFC 6376 §5.4.2)
+	var names []string
+	var signed []string
+	used := map[int]bool{}
+	for _, name := range s.headers {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(fieldName(fields[i]), name) {
+				used[i] = true
+				names = append(names, strings.ToLower(name))
+				signed = append(signed, fields[i])
+				break
+			}
+		}
+	}
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+	value := fmt.Sprintf("v=1; a=%s; c=relaxed/relaxed; d=%s; s=%s;\r\n\tt=%s; h=%s;\r\n\tbh=%s;\r\n\tb=",
+		s.algo, s.domain, s.selector,
+		strconv.FormatInt(time.Now().Unix(), 10), strings.Join(names, ":"),
+		base64.StdEncoding.EncodeToString(bodyHash[:]))
+
+	h := sha256.New()
+	for _, f := range signed {
+		h.Write([]byte(relaxedHeader(f)))
+	}
+	// the signature header itself, with an empty b= and no trailing CRLF
+	h.Write([]byte(strings.TrimSuffix(relaxedHeader("DKIM-Signature: "+value), "\r\n")))
+	digest := h.Sum(nil)
+
+	var sig []byte
+	var err error
+	if s.algo == "ed25519-sha256" {
+		// RFC 8463: Ed25519 signs the SHA-256 digest, not the data
+		sig, err = s.key.Sign(rand.Reader, digest, crypto.Hash(0))
+	} else {
+		sig, err = s.key.Sign(rand.Reader, digest, crypto.SHA256)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.WriteString("DKIM-Signature: " + value + foldBase64(base64.StdEncoding.EncodeToString(sig)) + "\r\n")
+	out.Write(msg)
+	return out.Bytes(), nil
+}
+
+// splitHeaderFields splits a CRLF-terminated header block into fields,
+// keeping folded continuation lines with their field.
+func splitHeaderFields(header string) []string {
+	var fields []string
+	for _, line := range strings.SplitAfter(header, "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1] += line
+			continue
+		}
+		fields = append(fields, line)
+	}
+	return fields
+}
+
+func fieldName(field string) string {
+	name, _, _ := strings.Cut(field, ":")
+	return strings.TrimRight(name, " \t")
+}
+
+// relaxedHeader canonicalizes one header field (RFC 6376 §3.4.2): lower-case
+// name, unfolded value with runs of whitespace reduced to one space and no
+// whitespace around the colon or at the end.
+func relaxedHeader(field string) string {
+	name, value, _ := strings.Cut(field, ":")
+	value = strings.NewReplacer("\r\n", "").Replace(value)
+	value = strings.Join(strings.FieldsFunc(value, isWSP), " ")
+	return strings.ToLower(strings.TrimRight(name, " \t")) + ":" + value + "\r\n"
+}
+
+// relaxedBody canonicalizes the body (RFC 6376 §3.4.4): whitespace runs
+// reduced to one space, trailing whitespace and trailing empty lines removed.
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\n")
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		line = strings.TrimRight(line, " \t")
+		var b strings.Builder
+		wsp := false
+		for _, r := range line {
+			if isWSP(r) {
+				wsp = true
+				continue
+			}
+			if wsp {
+				b.WriteByte(' ')
+				wsp = false
+			}
+			b.WriteRune(r)
+		}
+		lines[i] = b.String()
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+func isWSP(r rune) bool { return r == ' ' || r == '\t' }
+
+// foldBase64 breaks a long b= value into header continuation lines;
+// verifiers ignore the whitespace.
+func foldBase64(s string) string {
+	const width = 72
+	var b strings.Builder
+	for len(s) > width {
+		b.WriteString(s[:width] + "\r\n\t")
+		s = s[width:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
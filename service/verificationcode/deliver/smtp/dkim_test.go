@@ -0,0 +1,155 @@
+package smtp
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-bumbu/userauth/service/verificationcode"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRelaxedCanonicalization(t *testing.T) {
+	// the example from RFC 6376 §3.4.5
+	var got string
+	for _, f := range splitHeaderFields("A: X\r\nB : Y\t\r\n\tZ  \r\n") {
+		got += relaxedHeader(f)
+	}
+	if diff := cmp.Diff("a:X\r\nb:Y Z\r\n", got); diff != "" {
+		t.Errorf("header (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(" C\r\nD E\r\n", string(relaxedBody([]byte(" C \r\nD \t E\r\n\r\n\r\n")))); diff != "" {
+		t.Errorf("body (-want +got):\n%s", diff)
+	}
+	if got := relaxedBody([]byte("\r\n\r\n")); len(got) != 0 {
+		t.Errorf("an empty body canonicalizes to nothing, got %q", got)
+	}
+}
+
+func TestDeliver_DKIM(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPEM := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}))
+	edFile := filepath.Join(t.TempDir(), "dkim.pem")
+	if err := os.WriteFile(edFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		name     string
+		key      string
+		algo     string
+		verifier func(digest, sig []byte) bool
+	}{
+		{
+			name: "rsa, inline PKCS#1", key: rsaPEM, algo: "rsa-sha256",
+			verifier: func(digest, sig []byte) bool {
+				return rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, digest, sig) == nil
+			},
+		},
+		{
+			name: "ed25519, PKCS#8 from file", key: "@" + edFile, algo: "ed25519-sha256",
+			verifier: func(digest, sig []byte) bool { return ed25519.Verify(edPub, digest, sig) },
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := &fakeServer{}
+			srv.start(t)
+			d, err := New(Config{
+				Host: srv.host, Port: srv.port, From: "noreply@example.com",
+				DKIM: &DKIMConfig{Domain: "example.com", Selector: "mail", PrivateKey: tc.key},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = d.Close() }()
+			msg := verificationcode.Message{To: "user@example.com", Code: "654321", ExpiresAt: time.Now().Add(time.Minute), Locale: "de"}
+			if err := d.Deliver(context.Background(), msg); err != nil {
+				t.Fatal(err)
+			}
+			_, _, got := srv.stats()
+			if len(got) != 1 {
+				t.Fatalf("want 1 message, got %d", len(got))
+			}
+			verifyDKIM(t, got[0].data, tc.algo, tc.verifier)
+		})
+	}
+}
+
+var bTag = regexp.MustCompile(`(^|;)(\s*b=)[^;]*`)
+
+// verifyDKIM checks the message's DKIM-Signature the way a receiver would.
+func verifyDKIM(t *testing.T, data, algo string, verify func(digest, sig []byte) bool) {
+	t.Helper()
+	header, body, _ := strings.Cut(data, "\r\n\r\n")
+	fields := splitHeaderFields(header + "\r\n")
+	sigField := fields[0]
+	name, value, _ := strings.Cut(sigField, ":")
+	if name != "DKIM-Signature" {
+		t.Fatalf("first header is %q, want DKIM-Signature", name)
+	}
+	tags := map[string]string{}
+	for _, tag := range strings.Split(value, ";") {
+		k, v, _ := strings.Cut(tag, "=")
+		tags[strings.TrimSpace(k)] = strings.Join(strings.Fields(v), "")
+	}
+	want := map[string]string{"v": "1", "a": algo, "c": "relaxed/relaxed", "d": "example.com", "s": "mail"}
+	for k, v := range want {
+		if tags[k] != v {
+			t.Errorf("tag %s = %q, want %q", k, tags[k], v)
+		}
+	}
+	if !strings.HasPrefix(tags["h"], "from:to:subject:date:message-id:") {
+		t.Errorf("unexpected signed headers %q", tags["h"])
+	}
+
+	bh := sha256.Sum256(relaxedBody([]byte(body)))
+	if tags["bh"] != base64.StdEncoding.EncodeToString(bh[:]) {
+		t.Error("body hash does not match")
+	}
+
+	h := sha256.New()
+	rest := fields[1:]
+	for _, name := range strings.Split(tags["h"], ":") {
+		for i := len(rest) - 1; i >= 0; i-- {
+			if strings.EqualFold(fieldName(rest[i]), name) {
+				h.Write([]byte(relaxedHeader(rest[i])))
+				rest = append(rest[:i:i], rest[i+1:]...)
+				break
+			}
+		}
+	}
+	unsigned := name + ":" + bTag.ReplaceAllString(value, "$1$2")
+	h.Write([]byte(strings.TrimSuffix(relaxedHeader(unsigned), "\r\n")))
+
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verify(h.Sum(nil), sig) {
+		t.Error("signature does not verify")
+	}
+}
@@ -0,0 +1,199 @@
+package smtp
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer is an in-process SMTP stand-in: it speaks enough ESMTP for
+// net/smtp (EHLO, STARTTLS, AUTH, MAIL, RCPT, DATA, RSET, QUIT) and records
+// what it receives.
+type fakeServer struct {
+	host string
+	port int
+
+	tls       *tls.Config // certificate for STARTTLS / implicit TLS
+	implicit  bool        // TLS from the first byte
+	starttls  bool        // advertise STARTTLS
+	dropAfter bool        // hang up after each message, without QUIT
+	stallData bool        // never answer the end of DATA
+
+	mu       sync.Mutex
+	conns    int
+	quits    int
+	received []received
+}
+
+type received struct {
+	from string
+	to   []string
+	data string
+	tls  bool
+}
+
+// serverCert is a self-signed certificate for 127.0.0.1 and the path of a
+// PEM file holding it, for Config.CAFile.
+func serverCert(t *testing.T) (*tls.Config, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake smtp"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	return cfg, caFile
+}
+
+// start listens on a random local port and serves until the test ends.
+func (s *fakeServer) start(t *testing.T) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	s.host, s.port = "127.0.0.1", ln.Addr().(*net.TCPAddr).Port
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns++
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	secure := false
+	if s.implicit {
+		tc := tls.Server(conn, s.tls)
+		if err := tc.Handshake(); err != nil {
+			return
+		}
+		conn, secure = tc, true
+	}
+	r := bufio.NewReader(conn)
+	reply := func(format string, args ...any) { _, _ = fmt.Fprintf(conn, format+"\r\n", args...) }
+
+	reply("220 fake ESMTP")
+	var cur received
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			reply("250-fake")
+			if s.starttls && !secure {
+				reply("250-STARTTLS")
+			}
+			reply("250 AUTH PLAIN")
+		case "STARTTLS":
+			reply("220 ready")
+			tc := tls.Server(conn, s.tls)
+			if err := tc.Handshake(); err != nil {
+				return
+			}
+			conn, secure = tc, true
+			r = bufio.NewReader(conn)
+		case "AUTH":
+			reply("235 authenticated")
+		case "MAIL":
+			cur = received{from: addrArg(line), tls: secure}
+			reply("250 ok")
+		case "RCPT":
+			cur.to = append(cur.to, addrArg(line))
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			if s.stallData {
+				_, _ = r.ReadString('\n') // until the client gives up
+				return
+			}
+			cur.data = data.String()
+			s.mu.Lock()
+			s.received = append(s.received, cur)
+			s.mu.Unlock()
+			reply("250 queued")
+			if s.dropAfter {
+				return
+			}
+		case "RSET":
+			cur = received{}
+			reply("250 ok")
+		case "QUIT":
+			s.mu.Lock()
+			s.quits++
+			s.mu.Unlock()
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+// addrArg extracts the address from "MAIL FROM:<a>" or "RCPT TO:<a>".
+func addrArg(line string) string {
+	_, rest, _ := strings.Cut(line, "<")
+	addr, _, _ := strings.Cut(rest, ">")
+	return addr
+}
+
+func (s *fakeServer) stats() (conns, quits int, msgs []received) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns, s.quits, append([]received(nil), s.received...)
+}
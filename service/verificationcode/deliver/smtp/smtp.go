@@ -3,47 +3,109 @@ package smtp
 import (
 	"bytes"
 	"context"
-	"embed"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"html/template"
-	"math"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
 	"net/smtp"
+	"net/textproto"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/go-bumbu/userauth/service/verificationcode"
+	"github.com/go-bumbu/userauth/service/verificationcode/deliver/message"
+)
+
+// TLSMode selects how the connection to the server is secured.
+type TLSMode string
+
+const (
+	// TLSAuto upgrades with STARTTLS when the server offers it, and uses
+	// implicit TLS on port 465. It is the zero value.
+	TLSAuto TLSMode = ""
+	// TLSImplicit speaks TLS from the first byte (SMTPS, usually port 465).
+	TLSImplicit TLSMode = "implicit"
+	// TLSStartTLS requires the server to offer STARTTLS and fails otherwise.
+	TLSStartTLS TLSMode = "starttls"
+	// TLSNone never encrypts. Only for local relays: net/smtp refuses to send
+	// credentials in the clear to anything but localhost.
+	TLSNone TLSMode = "none"
 )
 
-//go:embed default.html
-var defaultTemplate embed.FS
+// Defaults applied by New.
+const (
+	DefaultTimeout      = 30 * time.Second
+	DefaultMaxIdleConns = 2
+	DefaultIdleTimeout  = 30 * time.Second
+)
 
 // Config holds SMTP connection and template settings.
 type Config struct {
-	Host         string
-	Port         int
-	Username     string
-	Password     string // literal value, or "@/path/to/file" to read from disk
-	From         string
-	TemplatePath string // optional; empty = use embedded default
-}
-
-// TemplateData is passed to the HTML template.
-type TemplateData struct {
-	To        string
-	Code      string
-	ExpiresIn string
+	Host     string
+	Port     int
+	Username string
+	Password string // literal value, or "@/path/to/file" to read from disk
+	// From is the sender, either a bare address or "Name <address>".
+	From string
+	// TLS selects the transport security; see TLSMode.
+	TLS TLSMode
+	// CAFile optionally names a PEM bundle trusted instead of the system
+	// roots when verifying the server certificate.
+	CAFile string
+	// Timeout bounds a delivery whose context has no deadline; defaults to
+	// DefaultTimeout.
+	Timeout time.Duration
+	// MaxIdleConns is the number of connections kept open for reuse between
+	// deliveries, so bursts skip the handshake; defaults to
+	// DefaultMaxIdleConns, negative disables reuse.
+	MaxIdleConns int
+	// IdleTimeout closes pooled connections unused for longer; defaults to
+	// DefaultIdleTimeout.
+	IdleTimeout time.Duration
+	// DKIM, when set, signs every message.
+	DKIM *DKIMConfig
+	// TemplateDir optionally overrides the embedded message templates; see
+	// package deliver/message for the directory layout.
+	TemplateDir string
+	// DefaultLocale is the fallback language for messages whose locale has
+	// no templates; defaults to English.
+	DefaultLocale string
 }
 
-// Deliverer sends verification codes via SMTP.
+// Deliverer sends verification codes via SMTP. It keeps a small pool of
+// idle connections; call Close on shutdown to end them cleanly.
 type Deliverer struct {
-	host     string
-	port     int
-	username string
-	password string
-	from     string
-	tmpl     *template.Template
+	host        string
+	port        int
+	mode        TLSMode
+	tlsConfig   *tls.Config
+	auth        smtp.Auth
+	from        string // header value
+	envelope    string // bare address for MAIL FROM
+	msgIDDomain string
+	timeout     time.Duration
+	maxIdle     int
+	idleTimeout time.Duration
+	dkim        *dkimSigner
+	messages    *message.Catalog
+
+	mu     sync.Mutex
+	idle   []*conn
+	closed bool
 }
 
-// New validates config, resolves password, parses template, and returns a Deliverer.
+// New validates config, resolves password, parses templates, and returns a Deliverer.
 func New(cfg Config) (*Deliverer, error) {
 	if cfg.Host == "" {
 		return nil, fmt.Errorf("smtp delivery: host is required")
@@ -54,69 +116,347 @@ func New(cfg Config) (*Deliverer, error) {
 	if cfg.From == "" {
 		return nil, fmt.Errorf("smtp delivery: from is required")
 	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("smtp delivery: invalid from %q: %w", cfg.From, err)
+	}
+
+	mode := cfg.TLS
+	switch mode {
+	case TLSAuto:
+		if cfg.Port == 465 {
+			mode = TLSImplicit
+		}
+	case TLSImplicit, TLSStartTLS, TLSNone:
+	default:
+		return nil, fmt.Errorf("smtp delivery: unknown TLS mode %q", cfg.TLS)
+	}
+	tlsConfig := &tls.Config{ServerName: cfg.Host, MinVersion: tls.VersionTLS12}
+	if cfg.CAFile != "" {
+		pool, err := loadCAFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("smtp delivery: %w", err)
+		}
+		tlsConfig.RootCAs = pool
+	}
 
 	password, err := resolvePassword(cfg.Password)
 	if err != nil {
 		return nil, fmt.Errorf("smtp delivery: %w", err)
 	}
+	var auth smtp.Auth
+	if cfg.Username != "" || password != "" {
+		auth = smtp.PlainAuth("", cfg.Username, password, cfg.Host)
+	}
 
-	tmpl, err := parseTemplate(cfg.TemplatePath)
+	var signer *dkimSigner
+	if cfg.DKIM != nil {
+		if signer, err = newDKIMSigner(*cfg.DKIM); err != nil {
+			return nil, fmt.Errorf("smtp delivery: dkim: %w", err)
+		}
+	}
+
+	messages, err := message.New(message.Opts{Dir: cfg.TemplateDir, DefaultLocale: cfg.DefaultLocale})
 	if err != nil {
 		return nil, fmt.Errorf("smtp delivery: %w", err)
 	}
 
-	return &Deliverer{
-		host:     cfg.Host,
-		port:     cfg.Port,
-		username: cfg.Username,
-		password: password,
-		from:     cfg.From,
-		tmpl:     tmpl,
-	}, nil
+	d := &Deliverer{
+		host:        cfg.Host,
+		port:        cfg.Port,
+		mode:        mode,
+		tlsConfig:   tlsConfig,
+		auth:        auth,
+		from:        cfg.From,
+		envelope:    from.Address,
+		msgIDDomain: "localhost",
+		timeout:     cfg.Timeout,
+		maxIdle:     cfg.MaxIdleConns,
+		idleTimeout: cfg.IdleTimeout,
+		dkim:        signer,
+		messages:    messages,
+	}
+	if at := strings.LastIndexByte(from.Address, '@'); at >= 0 {
+		d.msgIDDomain = from.Address[at+1:]
+	}
+	if d.timeout == 0 {
+		d.timeout = DefaultTimeout
+	}
+	if d.maxIdle == 0 {
+		d.maxIdle = DefaultMaxIdleConns
+	}
+	if d.idleTimeout == 0 {
+		d.idleTimeout = DefaultIdleTimeout
+	}
+	return d, nil
 }
 
-// Deliver sends an HTML email with the verification code.
-func (d *Deliverer) Deliver(_ context.Context, to string, code string, expiresAt time.Time) error {
-	msg, err := d.renderMessage(to, code, expiresAt)
+// Deliver sends a multipart email with the verification code, worded for
+// the message's purpose and locale. It reuses an idle connection when one
+// is still alive and dials otherwise; ctx bounds the whole exchange.
+func (d *Deliverer) Deliver(ctx context.Context, msg verificationcode.Message) error {
+	body, err := d.renderMessage(msg)
 	if err != nil {
 		return fmt.Errorf("smtp delivery: render: %w", err)
 	}
+	if d.dkim != nil {
+		if body, err = d.dkim.sign(body); err != nil {
+			return fmt.Errorf("smtp delivery: dkim: %w", err)
+		}
+	}
 
-	addr := fmt.Sprintf("%s:%d", d.host, d.port)
-	var auth smtp.Auth
-	if d.username != "" || d.password != "" {
-		auth = smtp.PlainAuth("", d.username, d.password, d.host)
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
 	}
 
-	if err := smtp.SendMail(addr, auth, d.from, []string{to}, msg); err != nil {
+	c, err := d.conn(ctx)
+	if err != nil {
+		return fmt.Errorf("smtp delivery: send: %w", err)
+	}
+	if err := c.send(ctx, d.envelope, msg.To, body); err != nil {
+		c.close()
 		return fmt.Errorf("smtp delivery: send: %w", err)
 	}
+	d.release(c)
+	return nil
+}
+
+// Close ends the pooled connections. Deliver keeps working afterwards but
+// no longer pools.
+func (d *Deliverer) Close() error {
+	d.mu.Lock()
+	idle := d.idle
+	d.idle, d.closed = nil, true
+	d.mu.Unlock()
+	for _, c := range idle {
+		c.quit()
+	}
 	return nil
 }
 
-// renderMessage builds the full MIME email message.
-func (d *Deliverer) renderMessage(to string, code string, expiresAt time.Time) ([]byte, error) {
-	data := TemplateData{
-		To:        to,
-		Code:      code,
-		ExpiresIn: formatExpiresIn(time.Until(expiresAt)),
+// conn returns a live pooled connection, or dials a new one. Pooled
+// connections are checked with RSET, which also clears any half-finished
+// transaction; the server may have dropped them since.
+func (d *Deliverer) conn(ctx context.Context) (*conn, error) {
+	for {
+		c := d.takeIdle()
+		if c == nil {
+			return d.dial(ctx)
+		}
+		stop := c.bind(ctx)
+		err := c.client.Reset()
+		stop()
+		if err == nil {
+			return c, nil
+		}
+		c.close()
 	}
+}
 
-	var htmlBuf bytes.Buffer
-	if err := d.tmpl.Execute(&htmlBuf, data); err != nil {
+func (d *Deliverer) takeIdle() *conn {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for len(d.idle) > 0 {
+		c := d.idle[len(d.idle)-1]
+		d.idle = d.idle[:len(d.idle)-1]
+		if time.Since(c.idleSince) < d.idleTimeout {
+			return c
+		}
+		go c.quit()
+	}
+	return nil
+}
+
+func (d *Deliverer) release(c *conn) {
+	d.mu.Lock()
+	if d.closed || len(d.idle) >= d.maxIdle {
+		d.mu.Unlock()
+		c.quit()
+		return
+	}
+	c.idleSince = time.Now()
+	d.idle = append(d.idle, c)
+	d.mu.Unlock()
+}
+
+// dial connects, secures the connection according to the TLS mode and
+// authenticates.
+func (d *Deliverer) dial(ctx context.Context) (*conn, error) {
+	var dialer net.Dialer
+	raw, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(d.host, strconv.Itoa(d.port)))
+	if err != nil {
 		return nil, err
 	}
+	c := &conn{raw: raw}
+	stop := c.bind(ctx)
+	defer stop()
 
-	var msg bytes.Buffer
-	fmt.Fprintf(&msg, "From: %s\r\n", d.from)
-	fmt.Fprintf(&msg, "To: %s\r\n", to)
-	fmt.Fprintf(&msg, "Subject: Your verification code\r\n")
-	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
-	fmt.Fprintf(&msg, "Content-Type: text/html; charset=UTF-8\r\n")
-	fmt.Fprintf(&msg, "\r\n")
-	msg.Write(htmlBuf.Bytes())
+	var nc net.Conn = raw
+	if d.mode == TLSImplicit {
+		tc := tls.Client(raw, d.tlsConfig.Clone())
+		if err := tc.HandshakeContext(ctx); err != nil {
+			_ = raw.Close()
+			return nil, err
+		}
+		nc = tc
+	}
+	if c.client, err = smtp.NewClient(nc, d.host); err != nil {
+		_ = raw.Close()
+		return nil, err
+	}
 
-	return msg.Bytes(), nil
+	if d.mode == TLSAuto || d.mode == TLSStartTLS {
+		ok, _ := c.client.Extension("STARTTLS")
+		switch {
+		case ok:
+			if err := c.client.StartTLS(d.tlsConfig.Clone()); err != nil {
+				c.close()
+				return nil, err
+			}
+		case d.mode == TLSStartTLS:
+			c.close()
+			return nil, errors.New("server does not offer STARTTLS")
+		}
+	}
+	if d.auth != nil {
+		if err := c.client.Auth(d.auth); err != nil {
+			c.close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// conn is one SMTP session. Deadlines are set on the TCP connection, which
+// also bounds the TLS layer on top of it.
+type conn struct {
+	raw       net.Conn
+	client    *smtp.Client
+	idleSince time.Time
+}
+
+// bind applies ctx's deadline to the connection and aborts blocked I/O when
+// ctx is cancelled, until the returned stop is called.
+func (c *conn) bind(ctx context.Context) (stop func()) {
+	deadline, _ := ctx.Deadline()
+	_ = c.raw.SetDeadline(deadline)
+	unbind := context.AfterFunc(ctx, func() { _ = c.raw.SetDeadline(time.Now()) })
+	return func() {
+		unbind()
+		_ = c.raw.SetDeadline(time.Time{})
+	}
+}
+
+func (c *conn) send(ctx context.Context, from, to string, body []byte) error {
+	stop := c.bind(ctx)
+	defer stop()
+	if err := c.client.Mail(from); err != nil {
+		return err
+	}
+	if err := c.client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// quit ends the session politely, without waiting long for the server.
+func (c *conn) quit() {
+	_ = c.raw.SetDeadline(time.Now().Add(time.Second))
+	_ = c.client.Quit()
+	c.close()
+}
+
+func (c *conn) close() {
+	_ = c.raw.Close()
+}
+
+// renderMessage builds the full MIME email message: multipart/alternative
+// with a plain-text and an HTML part, or a single text/plain part when the
+// selected templates have no HTML body.
+func (d *Deliverer) renderMessage(msg verificationcode.Message) ([]byte, error) {
+	rendered, err := d.messages.Render(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", d.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", rendered.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", messageID(), d.msgIDDomain)
+	fmt.Fprintf(&buf, "Content-Language: %s\r\n", rendered.Locale)
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+
+	if rendered.HTML == "" {
+		fmt.Fprintf(&buf, "Content-Type: text/plain; charset=UTF-8\r\n")
+		fmt.Fprintf(&buf, "Content-Transfer-Encoding: quoted-printable\r\n")
+		fmt.Fprintf(&buf, "\r\n")
+		if err := writeQuotedPrintable(&buf, rendered.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n", mw.Boundary())
+	fmt.Fprintf(&buf, "\r\n")
+	// least preferred first (RFC 2046 §5.1.4): clients that render HTML pick it
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=UTF-8", rendered.Text},
+		{"text/html; charset=UTF-8", rendered.HTML},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, s string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qp, s); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// messageID returns a random, globally unique Message-ID local part.
+func messageID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b) // never fails, see crypto/rand
+	return hex.EncodeToString(b)
+}
+
+func loadCAFile(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // path is operator-configured, not user input
+	if err != nil {
+		return nil, fmt.Errorf("reading CA file %s: %w", path, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("CA file %s holds no PEM certificates", path)
+	}
+	return pool, nil
 }
 
 // resolvePassword returns the password value. If it starts with "@", the
@@ -132,23 +472,3 @@ func resolvePassword(raw string) (string, error) {
 	}
 	return strings.TrimSpace(string(data)), nil
 }
-
-// parseTemplate parses the HTML template from path, or uses the embedded default.
-func parseTemplate(path string) (*template.Template, error) {
-	if path != "" {
-		return template.ParseFiles(path)
-	}
-	return template.ParseFS(defaultTemplate, "default.html")
-}
-
-// formatExpiresIn returns a human-readable duration string rounded up to minutes.
-func formatExpiresIn(d time.Duration) string {
-	minutes := int(math.Ceil(d.Minutes()))
-	if minutes < 1 {
-		minutes = 1
-	}
-	if minutes == 1 {
-		return "1 minute"
-	}
-	return fmt.Sprintf("%d minutes", minutes)
-}
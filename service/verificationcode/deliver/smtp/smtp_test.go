@@ -1,16 +1,23 @@
 package smtp
 
 import (
-	"bufio"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
 	"net"
+	"net/mail"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-bumbu/userauth/service/verificationcode"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -83,19 +90,34 @@ func TestNew_ValidConfig(t *testing.T) {
 	}
 }
 
-func TestNew_CustomTemplate(t *testing.T) {
-	dir := t.TempDir()
-	tmplPath := filepath.Join(dir, "custom.html")
-	if err := os.WriteFile(tmplPath, []byte(`<p>Code: {{.Code}}</p>`), 0600); err != nil {
+// writeTemplates creates a <purpose>/<locale>/ template directory under root.
+func writeTemplates(t *testing.T, root, purpose, locale, subject, text, html string) {
+	t.Helper()
+	dir := filepath.Join(root, purpose, locale)
+	if err := os.MkdirAll(dir, 0750); err != nil {
 		t.Fatal(err)
 	}
+	files := map[string]string{"subject.txt": subject, "body.txt": text, "body.html": html}
+	for name, content := range files {
+		if content == "" {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNew_CustomTemplate(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplates(t, dir, "login", "en", "Sign in", "Code: {{.Code}}", `<p>Code: {{.Code}}</p>`)
 
 	d, err := New(Config{
-		Host:         "smtp.example.com",
-		Port:         587,
-		From:         "noreply@example.com",
-		Password:     "secret",
-		TemplatePath: tmplPath,
+		Host:        "smtp.example.com",
+		Port:        587,
+		From:        "noreply@example.com",
+		Password:    "secret",
+		TemplateDir: dir,
 	})
 	if err != nil {
 		t.Fatal(err)
@@ -117,82 +139,60 @@ func TestNew_MissingPasswordFile(t *testing.T) {
 	}
 }
 
-func TestNew_MissingTemplateFile(t *testing.T) {
-	_, err := New(Config{
-		Host:         "smtp.example.com",
-		Port:         587,
-		From:         "noreply@example.com",
-		TemplatePath: "/nonexistent/template.html",
-	})
-	if err == nil {
-		t.Fatal("expected error for missing template file")
+func TestNew_InvalidConfig(t *testing.T) {
+	tcs := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "from is not an address", cfg: Config{From: "not an address"}},
+		{name: "unknown TLS mode", cfg: Config{TLS: "ssl"}},
+		{name: "missing CA file", cfg: Config{CAFile: "/nonexistent/ca.pem"}},
+		{name: "DKIM without selector", cfg: Config{DKIM: &DKIMConfig{Domain: "example.com", PrivateKey: "x"}}},
+		{name: "DKIM key not PEM", cfg: Config{DKIM: &DKIMConfig{Domain: "example.com", Selector: "s1", PrivateKey: "x"}}},
 	}
-}
-
-// fakeSMTPHandler speaks just enough SMTP for net/smtp.SendMail to succeed.
-func fakeSMTPHandler(conn net.Conn) {
-	defer func() { _ = conn.Close() }()
-	reply := func(s string) { _, _ = fmt.Fprint(conn, s) }
-	r := bufio.NewReader(conn)
-	reply("220 test ESMTP\r\n")
-	inData := false
-	for {
-		line, err := r.ReadString('\n')
-		if err != nil {
-			return
-		}
-		line = strings.TrimRight(line, "\r\n")
-		if inData {
-			if line == "." {
-				inData = false
-				reply("250 ok\r\n")
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := tc.cfg
+			cfg.Host, cfg.Port = "smtp.example.com", 587
+			if cfg.From == "" {
+				cfg.From = "noreply@example.com"
 			}
-			continue
-		}
-		switch {
-		case strings.HasPrefix(line, "EHLO"), strings.HasPrefix(line, "HELO"):
-			reply("250-test\r\n250 AUTH PLAIN\r\n")
-		case strings.HasPrefix(line, "AUTH"):
-			reply("235 authenticated\r\n")
-		case strings.HasPrefix(line, "DATA"):
-			inData = true
-			reply("354 go ahead\r\n")
-		case strings.HasPrefix(line, "QUIT"):
-			reply("221 bye\r\n")
-			return
-		default:
-			reply("250 ok\r\n")
-		}
+			if _, err := New(cfg); err == nil {
+				t.Fatal("expected error")
+			}
+		})
 	}
 }
 
-// startFakeSMTP starts a minimal SMTP server on a random local port.
-func startFakeSMTP(t *testing.T) (host string, port int) {
-	t.Helper()
-	ln, err := net.Listen("tcp", "127.0.0.1:0")
+func TestNew_ImplicitTLSOnPort465(t *testing.T) {
+	d, err := New(Config{Host: "smtp.example.com", Port: 465, From: "noreply@example.com"})
 	if err != nil {
 		t.Fatal(err)
 	}
-	t.Cleanup(func() { _ = ln.Close() })
-	go func() {
-		for {
-			conn, err := ln.Accept()
-			if err != nil {
-				return
-			}
-			go fakeSMTPHandler(conn)
-		}
-	}()
-	addr := ln.Addr().(*net.TCPAddr)
-	return "127.0.0.1", addr.Port
+	if d.mode != TLSImplicit {
+		t.Errorf("mode = %q, want implicit", d.mode)
+	}
+}
+
+func TestNew_MissingTemplateDir(t *testing.T) {
+	_, err := New(Config{
+		Host:        "smtp.example.com",
+		Port:        587,
+		From:        "noreply@example.com",
+		TemplateDir: "/nonexistent/templates",
+	})
+	if err == nil {
+		t.Fatal("expected error for missing template dir")
+	}
 }
 
 func TestDeliver_Success(t *testing.T) {
-	host, port := startFakeSMTP(t)
+	srv := &fakeServer{}
+	srv.start(t)
 	d, err := New(Config{
-		Host:     host,
-		Port:     port,
-		From:     "noreply@example.com",
+		Host:     srv.host,
+		Port:     srv.port,
+		From:     "Example <noreply@example.com>",
 		Username: "user",
 		Password: "secret",
 	})
@@ -200,10 +200,156 @@ func TestDeliver_Success(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	expiresAt := time.Now().Add(10 * time.Minute)
-	if err := d.Deliver(context.Background(), "user@example.com", "654321", expiresAt); err != nil {
+	msg := verificationcode.Message{To: "user@example.com", Code: "654321", ExpiresAt: time.Now().Add(10 * time.Minute)}
+	if err := d.Deliver(context.Background(), msg); err != nil {
 		t.Fatalf("unexpected deliver error: %v", err)
 	}
+
+	_, _, got := srv.stats()
+	if len(got) != 1 {
+		t.Fatalf("want 1 message, got %d", len(got))
+	}
+	if got[0].from != "noreply@example.com" || !cmp.Equal(got[0].to, []string{"user@example.com"}) {
+		t.Errorf("unexpected envelope from=%q to=%v", got[0].from, got[0].to)
+	}
+	m, err := mail.ReadMessage(strings.NewReader(got[0].data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from := m.Header.Get("From"); from != "Example <noreply@example.com>" {
+		t.Errorf("unexpected From header %q", from)
+	}
+	if !strings.HasSuffix(m.Header.Get("Message-ID"), "@example.com>") {
+		t.Errorf("unexpected Message-ID %q", m.Header.Get("Message-ID"))
+	}
+	if date, err := m.Header.Date(); err != nil || time.Since(date) > time.Minute {
+		t.Errorf("unexpected Date %q (%v)", m.Header.Get("Date"), err)
+	}
+}
+
+func TestDeliver_TLSModes(t *testing.T) {
+	serverTLS, caFile := serverCert(t)
+	tcs := []struct {
+		name    string
+		server  *fakeServer
+		mode    TLSMode
+		caFile  string
+		wantTLS bool
+		wantErr string
+	}{
+		{name: "auto upgrades when offered", server: &fakeServer{starttls: true}, mode: TLSAuto, caFile: caFile, wantTLS: true},
+		{name: "auto stays plain when not offered", server: &fakeServer{}, mode: TLSAuto, wantTLS: false},
+		{name: "starttls", server: &fakeServer{starttls: true}, mode: TLSStartTLS, caFile: caFile, wantTLS: true},
+		{name: "starttls required", server: &fakeServer{}, mode: TLSStartTLS, wantErr: "does not offer STARTTLS"},
+		{name: "implicit", server: &fakeServer{implicit: true}, mode: TLSImplicit, caFile: caFile, wantTLS: true},
+		{name: "none ignores STARTTLS", server: &fakeServer{starttls: true}, mode: TLSNone, wantTLS: false},
+		{name: "untrusted certificate", server: &fakeServer{starttls: true}, mode: TLSStartTLS, wantErr: "certificate"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := tc.server
+			srv.tls = serverTLS
+			srv.start(t)
+			d, err := New(Config{Host: srv.host, Port: srv.port, From: "noreply@example.com", TLS: tc.mode, CAFile: tc.caFile})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = d.Close() }()
+
+			err = d.Deliver(context.Background(), verificationcode.Message{To: "user@example.com", Code: "654321", ExpiresAt: time.Now().Add(time.Minute)})
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _, got := srv.stats()
+			if len(got) != 1 || got[0].tls != tc.wantTLS {
+				t.Errorf("want one message with tls=%v, got %+v", tc.wantTLS, got)
+			}
+		})
+	}
+}
+
+func TestDeliver_ReusesConnection(t *testing.T) {
+	srv := &fakeServer{}
+	srv.start(t)
+	d, err := New(Config{Host: srv.host, Port: srv.port, From: "noreply@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 3 {
+		msg := verificationcode.Message{To: fmt.Sprintf("user%d@example.com", i), Code: "654321", ExpiresAt: time.Now().Add(time.Minute)}
+		if err := d.Deliver(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	conns, quits, got := srv.stats()
+	if conns != 1 || len(got) != 3 {
+		t.Errorf("want 3 messages over 1 connection, got %d over %d", len(got), conns)
+	}
+	if quits != 1 {
+		t.Errorf("Close should QUIT the pooled connection, got %d QUITs", quits)
+	}
+}
+
+func TestDeliver_Redials(t *testing.T) {
+	tcs := []struct {
+		name   string
+		server *fakeServer
+		cfg    Config
+	}{
+		{name: "server dropped the connection", server: &fakeServer{dropAfter: true}},
+		{name: "reuse disabled", server: &fakeServer{}, cfg: Config{MaxIdleConns: -1}},
+		{name: "idle connection expired", server: &fakeServer{}, cfg: Config{IdleTimeout: time.Nanosecond}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := tc.server
+			srv.start(t)
+			cfg := tc.cfg
+			cfg.Host, cfg.Port, cfg.From = srv.host, srv.port, "noreply@example.com"
+			d, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = d.Close() }()
+			for range 2 {
+				if err := d.Deliver(context.Background(), verificationcode.Message{To: "user@example.com", Code: "654321", ExpiresAt: time.Now().Add(time.Minute)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			conns, _, got := srv.stats()
+			if conns != 2 || len(got) != 2 {
+				t.Errorf("want 2 messages over 2 connections, got %d over %d", len(got), conns)
+			}
+		})
+	}
+}
+
+func TestDeliver_ContextDeadline(t *testing.T) {
+	srv := &fakeServer{stallData: true}
+	srv.start(t)
+	d, err := New(Config{Host: srv.host, Port: srv.port, From: "noreply@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = d.Deliver(ctx, verificationcode.Message{To: "user@example.com", Code: "654321", ExpiresAt: time.Now().Add(time.Minute)})
+	if err == nil {
+		t.Fatal("expected error from a stalled server")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Deliver ignored the deadline, took %v", elapsed)
+	}
 }
 
 func TestDeliver_ConnectionRefused(t *testing.T) {
@@ -226,7 +372,7 @@ func TestDeliver_ConnectionRefused(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = d.Deliver(context.Background(), "user@example.com", "654321", time.Now().Add(time.Minute))
+	err = d.Deliver(context.Background(), verificationcode.Message{To: "user@example.com", Code: "654321", ExpiresAt: time.Now().Add(time.Minute)})
 	if err == nil {
 		t.Fatal("expected error for refused connection")
 	}
@@ -237,23 +383,21 @@ func TestDeliver_ConnectionRefused(t *testing.T) {
 
 func TestDeliver_RenderError(t *testing.T) {
 	dir := t.TempDir()
-	tmplPath := filepath.Join(dir, "bad.html")
-	// References a field that does not exist on TemplateData, so Execute fails.
-	if err := os.WriteFile(tmplPath, []byte(`<p>{{.NoSuchField}}</p>`), 0600); err != nil {
-		t.Fatal(err)
-	}
+	// References a field that does not exist on message.Data, so Execute fails.
+	writeTemplates(t, dir, "login", "en", "Sign in", "Code: {{.Code}}", `<p>{{.NoSuchField}}</p>`)
 
 	d, err := New(Config{
-		Host:         "smtp.example.com",
-		Port:         587,
-		From:         "noreply@example.com",
-		TemplatePath: tmplPath,
+		Host:        "smtp.example.com",
+		Port:        587,
+		From:        "noreply@example.com",
+		TemplateDir: dir,
 	})
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = d.Deliver(context.Background(), "user@example.com", "654321", time.Now().Add(time.Minute))
+	msg := verificationcode.Message{To: "user@example.com", Code: "654321", ExpiresAt: time.Now().Add(time.Minute), Purpose: verificationcode.PurposeLogin}
+	err = d.Deliver(context.Background(), msg)
 	if err == nil {
 		t.Fatal("expected render error")
 	}
@@ -273,50 +417,148 @@ func TestRenderMessage(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	expiresAt := time.Now().Add(15 * time.Minute)
-	msg, err := d.renderMessage("user@example.com", "123456", expiresAt)
+	raw, err := d.renderMessage(verificationcode.Message{
+		To:        "user@example.com",
+		Code:      "123456",
+		ExpiresAt: time.Now().Add(15 * time.Minute),
+		Purpose:   verificationcode.PurposeRegistration,
+	})
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	body := string(msg)
-	if !strings.Contains(body, "From: noreply@example.com") {
-		t.Errorf("message should contain From header, got:\n%s", body)
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("message does not parse: %v\n%s", err, raw)
+	}
+	headers := map[string]string{
+		"From":             "noreply@example.com",
+		"To":               "user@example.com",
+		"Subject":          "Confirm your email address",
+		"Content-Language": "en",
 	}
-	if !strings.Contains(body, "To: user@example.com") {
-		t.Errorf("message should contain To header, got:\n%s", body)
+	for name, want := range headers {
+		if got := m.Header.Get(name); got != want {
+			t.Errorf("header %s = %q, want %q", name, got, want)
+		}
 	}
-	if !strings.Contains(body, "Subject: Your verification code") {
-		t.Errorf("message should contain Subject header, got:\n%s", body)
+
+	parts := readParts(t, m)
+	if diff := cmp.Diff([]string{"text/plain", "text/html"}, keys(parts)); diff != "" {
+		t.Fatalf("unexpected parts (-want +got):\n%s", diff)
 	}
-	if !strings.Contains(body, "Content-Type: text/html; charset=UTF-8") {
-		t.Errorf("message should contain Content-Type header, got:\n%s", body)
+	for typ, body := range parts {
+		if !strings.Contains(body, "123456") {
+			t.Errorf("%s part should contain the code, got:\n%s", typ, body)
+		}
+		if !strings.Contains(body, "15 minutes") {
+			t.Errorf("%s part should contain expiry duration, got:\n%s", typ, body)
+		}
+	}
+}
+
+func TestRenderMessage_Localized(t *testing.T) {
+	d, err := New(Config{Host: "smtp.example.com", Port: 587, From: "noreply@example.com"})
+	if err != nil {
+		t.Fatal(err)
 	}
-	if !strings.Contains(body, "123456") {
-		t.Errorf("message should contain the code, got:\n%s", body)
+
+	raw, err := d.renderMessage(verificationcode.Message{
+		To:        "user@example.com",
+		Code:      "123456",
+		ExpiresAt: time.Now().Add(10 * time.Minute),
+		Purpose:   verificationcode.PurposeLogin,
+		Locale:    "de-CH",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
 	}
-	if !strings.Contains(body, "15 minutes") {
-		t.Errorf("message should contain expiry duration, got:\n%s", body)
+	if subject != "Ihr Anmeldecode" {
+		t.Errorf("unexpected subject %q", subject)
+	}
+	if got := m.Header.Get("Content-Language"); got != "de" {
+		t.Errorf("unexpected Content-Language %q", got)
+	}
+	if text := readParts(t, m)["text/plain"]; !strings.Contains(text, "10 Minuten") {
+		t.Errorf("text part should be German, got:\n%s", text)
 	}
 }
 
-func TestFormatExpiresIn(t *testing.T) {
-	tcs := []struct {
-		name string
-		dur  time.Duration
-		want string
-	}{
-		{name: "15 minutes", dur: 15 * time.Minute, want: "15 minutes"},
-		{name: "1 minute", dur: 1 * time.Minute, want: "1 minute"},
-		{name: "90 seconds rounds to 2 minutes", dur: 90 * time.Second, want: "2 minutes"},
-		{name: "30 seconds shows 1 minute", dur: 30 * time.Second, want: "1 minute"},
+func TestRenderMessage_TextOnly(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplates(t, dir, "default", "en", "Code", "Your code: {{.Code}}", "")
+
+	d, err := New(Config{Host: "smtp.example.com", Port: 587, From: "noreply@example.com", TemplateDir: dir})
+	if err != nil {
+		t.Fatal(err)
 	}
-	for _, tc := range tcs {
-		t.Run(tc.name, func(t *testing.T) {
-			got := formatExpiresIn(tc.dur)
-			if diff := cmp.Diff(got, tc.want); diff != "" {
-				t.Errorf("unexpected result (-got +want):\n%s", diff)
-			}
-		})
+	raw, err := d.renderMessage(verificationcode.Message{To: "user@example.com", Code: "123456", ExpiresAt: time.Now().Add(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[string]string{"text/plain": "Your code: 123456\r\n"}, readParts(t, m)); diff != "" {
+		t.Errorf("unexpected parts (-want +got):\n%s", diff)
+	}
+}
+
+// readParts decodes the message body into content type -> decoded text,
+// handling both a single part and multipart/alternative.
+func readParts(t *testing.T, m *mail.Message) map[string]string {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string]string{}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		body, err := io.ReadAll(quotedprintable.NewReader(m.Body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[mediaType] = string(body)
+		return parts
+	}
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return parts
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		typ, _, err := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// multipart.Part decodes quoted-printable transparently
+		body, err := io.ReadAll(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[typ] = string(body)
+	}
+}
+
+// keys returns the part types in the conventional alternative order.
+func keys(parts map[string]string) []string {
+	var out []string
+	for _, typ := range []string{"text/plain", "text/html"} {
+		if _, ok := parts[typ]; ok {
+			out = append(out, typ)
+		}
 	}
+	return out
 }
@@ -0,0 +1,107 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultTolerance is the replay window used when Verifier.Tolerance is zero.
+const DefaultTolerance = 5 * time.Minute
+
+// maxBodyBytes caps the request body VerifyRequest reads.
+const maxBodyBytes = 64 << 10
+
+var (
+	// ErrInvalidSignature: the signature is missing, malformed or does not
+	// match the body.
+	ErrInvalidSignature = errors.New("webhook: invalid signature")
+	// ErrStale: the timestamp lies outside the replay window.
+	ErrStale = errors.New("webhook: timestamp outside the replay window")
+	// ErrReplayed: a payload with this ID was already accepted within the
+	// replay window.
+	ErrReplayed = errors.New("webhook: payload replayed")
+)
+
+// Verifier checks incoming webhook requests on the receiving side. It is
+// safe for concurrent use; the zero Tolerance means DefaultTolerance.
+//
+// Replay protection is two-fold: the signed timestamp must be within
+// Tolerance of the receiver's clock, and within that window each payload ID
+// is accepted once. Seen IDs are kept in memory, so several receiver
+// instances each accept a replay once; deduplicate on Payload.ID downstream
+// if that matters. The Deliverer retries with the same ID when it sees no
+// response, so answer ErrReplayed with a 2xx: the message already arrived.
+type Verifier struct {
+	Secret    []byte
+	Tolerance time.Duration
+
+	mu   sync.Mutex
+	seen map[string]time.Time // payload ID -> when it stops being remembered
+}
+
+// VerifyRequest reads r's body and verifies it; see Verify.
+func (v *Verifier) VerifyRequest(r *http.Request) (Payload, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodyBytes+1))
+	if err != nil {
+		return Payload{}, fmt.Errorf("webhook: reading body: %w", err)
+	}
+	if len(body) > maxBodyBytes {
+		return Payload{}, fmt.Errorf("webhook: body exceeds %d bytes", maxBodyBytes)
+	}
+	return v.Verify(r.Header, body)
+}
+
+// Verify checks the signature and timestamp headers against body and
+// returns the decoded payload. The signature is checked before anything in
+// the body is trusted.
+func (v *Verifier) Verify(header http.Header, body []byte) (Payload, error) {
+	ts, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return Payload{}, ErrInvalidSignature
+	}
+	signedAt := time.Unix(ts, 0)
+	if !hmac.Equal([]byte(header.Get(SignatureHeader)), []byte(Sign(v.Secret, signedAt, body))) {
+		return Payload{}, ErrInvalidSignature
+	}
+	tolerance := v.Tolerance
+	if tolerance == 0 {
+		tolerance = DefaultTolerance
+	}
+	now := time.Now()
+	if d := now.Sub(signedAt); d > tolerance || d < -tolerance {
+		return Payload{}, ErrStale
+	}
+
+	var p Payload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return Payload{}, fmt.Errorf("webhook: decoding payload: %w", err)
+	}
+	if p.ID == "" {
+		return Payload{}, errors.New("webhook: payload has no id")
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for id, until := range v.seen {
+		if now.After(until) {
+			delete(v.seen, id)
+		}
+	}
+	if _, ok := v.seen[p.ID]; ok {
+		return Payload{}, ErrReplayed
+	}
+	if v.seen == nil {
+		v.seen = map[string]time.Time{}
+	}
+	// a replay of this request stays acceptable to the timestamp check until
+	// signedAt+tolerance, so remember the ID that long
+	v.seen[p.ID] = signedAt.Add(tolerance)
+	return p, nil
+}
@@ -0,0 +1,97 @@
+package webhook_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-bumbu/userauth/service/verificationcode/deliver/webhook"
+)
+
+func signedHeader(key []byte, at time.Time, body []byte) http.Header {
+	h := http.Header{}
+	h.Set(webhook.TimestampHeader, strconv.FormatInt(at.Unix(), 10))
+	h.Set(webhook.SignatureHeader, webhook.Sign(key, at, body))
+	return h
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":"d1","to":"user@example.com","code":"654321"}`)
+	now := time.Now()
+	tcs := []struct {
+		name    string
+		header  http.Header
+		body    []byte
+		wantErr error
+	}{
+		{name: "valid", header: signedHeader(secret, now, body), body: body},
+		{name: "small clock skew", header: signedHeader(secret, now.Add(time.Minute), body), body: body},
+		{name: "tampered body", header: signedHeader(secret, now, body), body: bytes.Replace(body, []byte("654321"), []byte("000000"), 1), wantErr: webhook.ErrInvalidSignature},
+		{name: "wrong secret", header: signedHeader([]byte("other"), now, body), body: body, wantErr: webhook.ErrInvalidSignature},
+		{name: "no headers", header: http.Header{}, body: body, wantErr: webhook.ErrInvalidSignature},
+		{name: "timestamp changed after signing", header: func() http.Header {
+			h := signedHeader(secret, now, body)
+			h.Set(webhook.TimestampHeader, strconv.FormatInt(now.Unix()+1, 10))
+			return h
+		}(), body: body, wantErr: webhook.ErrInvalidSignature},
+		{name: "too old", header: signedHeader(secret, now.Add(-10*time.Minute), body), body: body, wantErr: webhook.ErrStale},
+		{name: "too far in the future", header: signedHeader(secret, now.Add(10*time.Minute), body), body: body, wantErr: webhook.ErrStale},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v := &webhook.Verifier{Secret: secret}
+			p, err := v.Verify(tc.header, tc.body)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tc.wantErr)
+			}
+			if err == nil && p.Code != "654321" {
+				t.Errorf("unexpected payload %+v", p)
+			}
+		})
+	}
+}
+
+func TestVerify_Replay(t *testing.T) {
+	body := []byte(`{"id":"d1","code":"654321"}`)
+	v := &webhook.Verifier{Secret: secret, Tolerance: time.Minute}
+	if _, err := v.Verify(signedHeader(secret, time.Now(), body), body); err != nil {
+		t.Fatal(err)
+	}
+	// a captured request replayed, even re-timestamped by the sender
+	if _, err := v.Verify(signedHeader(secret, time.Now(), body), body); !errors.Is(err, webhook.ErrReplayed) {
+		t.Fatalf("err = %v, want ErrReplayed", err)
+	}
+	other := []byte(`{"id":"d2","code":"654321"}`)
+	if _, err := v.Verify(signedHeader(secret, time.Now(), other), other); err != nil {
+		t.Errorf("a different id must be accepted: %v", err)
+	}
+}
+
+func TestVerify_RequiresID(t *testing.T) {
+	body := []byte(`{"code":"654321"}`)
+	v := &webhook.Verifier{Secret: secret}
+	if _, err := v.Verify(signedHeader(secret, time.Now(), body), body); err == nil {
+		t.Fatal("want error for a payload without id")
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	body := []byte(`{"id":"d1","code":"654321"}`)
+	r := httptest.NewRequest(http.MethodPost, "/hook", bytes.NewReader(body))
+	r.Header = signedHeader(secret, time.Now(), body)
+	v := &webhook.Verifier{Secret: secret}
+	if _, err := v.VerifyRequest(r); err != nil {
+		t.Fatal(err)
+	}
+
+	big := bytes.Repeat([]byte("x"), 65<<10)
+	r = httptest.NewRequest(http.MethodPost, "/hook", bytes.NewReader(big))
+	r.Header = signedHeader(secret, time.Now(), big)
+	if _, err := v.VerifyRequest(r); err == nil {
+		t.Fatal("want error for an oversized body")
+	}
+}
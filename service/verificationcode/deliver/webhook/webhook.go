@@ -0,0 +1,207 @@
+// Package webhook delivers verification codes by POSTing a signed JSON
+// payload to an HTTP endpoint, for deployments that route notifications
+// through their own messaging service instead of SMTP.
+//
+// Every request carries a timestamp and an HMAC-SHA256 signature over the
+// timestamp and the body, keyed with a shared secret. The receiving side
+// checks both with a Verifier, which also rejects a payload it has already
+// accepted within the replay window.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-bumbu/userauth/service/verificationcode"
+	"github.com/google/uuid"
+)
+
+// Header names set on every request.
+const (
+	// SignatureHeader holds "sha256=<hex HMAC>" of "<timestamp>.<body>".
+	SignatureHeader = "X-Userauth-Signature"
+	// TimestampHeader holds the signing time in Unix seconds.
+	TimestampHeader = "X-Userauth-Timestamp"
+)
+
+// Defaults applied by New.
+const (
+	DefaultTimeout     = 10 * time.Second
+	DefaultMaxAttempts = 3
+	DefaultBackoff     = 500 * time.Millisecond
+)
+
+// Payload is the JSON body of a delivery request.
+type Payload struct {
+	// ID is unique per message and stays the same across retries, so the
+	// receiver can deduplicate.
+	ID        string    `json:"id"`
+	To        string    `json:"to"`
+	Code      string    `json:"code"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Purpose   string    `json:"purpose,omitempty"`
+	Locale    string    `json:"locale,omitempty"`
+	Note      string    `json:"note,omitempty"`
+	Link      string    `json:"link,omitempty"`
+}
+
+// Config configures a webhook Deliverer. URL and Secret are required.
+type Config struct {
+	URL    string
+	Secret string // literal value, or "@/path/to/file" to read from disk
+	// Client sends the requests; defaults to a plain http.Client.
+	Client *http.Client
+	// Timeout bounds each attempt; defaults to DefaultTimeout.
+	Timeout time.Duration
+	// MaxAttempts is how often a request is tried before Deliver gives up;
+	// defaults to DefaultMaxAttempts.
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubling after each
+	// further attempt; defaults to DefaultBackoff.
+	Backoff time.Duration
+}
+
+// Deliverer POSTs verification codes to a webhook.
+type Deliverer struct {
+	url         string
+	secret      []byte
+	client      *http.Client
+	timeout     time.Duration
+	maxAttempts int
+	backoff     time.Duration
+}
+
+// New validates cfg, resolves the secret and returns a Deliverer.
+func New(cfg Config) (*Deliverer, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("webhook delivery: url is required")
+	}
+	secret, err := resolveSecret(cfg.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("webhook delivery: %w", err)
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("webhook delivery: secret is required")
+	}
+	d := &Deliverer{
+		url:         cfg.URL,
+		secret:      []byte(secret),
+		client:      cfg.Client,
+		timeout:     cfg.Timeout,
+		maxAttempts: cfg.MaxAttempts,
+		backoff:     cfg.Backoff,
+	}
+	if d.client == nil {
+		d.client = &http.Client{}
+	}
+	if d.timeout == 0 {
+		d.timeout = DefaultTimeout
+	}
+	if d.maxAttempts <= 0 {
+		d.maxAttempts = DefaultMaxAttempts
+	}
+	if d.backoff == 0 {
+		d.backoff = DefaultBackoff
+	}
+	return d, nil
+}
+
+// Deliver POSTs the message. Network errors, 5xx and 429 responses are
+// retried with doubling backoff; any other non-2xx status fails at once.
+func (d *Deliverer) Deliver(ctx context.Context, msg verificationcode.Message) error {
+	body, err := json.Marshal(Payload{
+		ID:        uuid.NewString(),
+		To:        msg.To,
+		Code:      msg.Code,
+		ExpiresAt: msg.ExpiresAt.UTC(),
+		Purpose:   string(msg.Purpose),
+		Locale:    msg.Locale,
+		Note:      msg.Note,
+		Link:      msg.Link,
+	})
+	if err != nil {
+		return fmt.Errorf("webhook delivery: %w", err)
+	}
+
+	wait := d.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := d.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= d.maxAttempts {
+			return fmt.Errorf("webhook delivery: attempt %d: %w", attempt, err)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("webhook delivery: %w (last error: %v)", ctx.Err(), err)
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// post makes one signed attempt and reports whether a failure is worth
+// retrying.
+func (d *Deliverer) post(ctx context.Context, body []byte) (retry bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	// signed per attempt, so a retry carries a fresh timestamp
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(SignatureHeader, Sign(d.secret, now, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // lets the connection be reused
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusTooManyRequests:
+		return true, fmt.Errorf("unexpected status %s", resp.Status)
+	default:
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+}
+
+// Sign returns the SignatureHeader value for body signed at t.
+func Sign(secret []byte, t time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(t.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// resolveSecret returns the secret value. If it starts with "@", the
+// remainder is treated as a file path and its contents are read and trimmed.
+func resolveSecret(raw string) (string, error) {
+	if !strings.HasPrefix(raw, "@") {
+		return raw, nil
+	}
+	path := raw[1:]
+	data, err := os.ReadFile(path) //nolint:gosec // path is operator-configured, not user input
+	if err != nil {
+		return "", fmt.Errorf("reading secret file %s: %w", path, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,204 @@
+package webhook_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-bumbu/userauth/service/verificationcode"
+	"github.com/go-bumbu/userauth/service/verificationcode/deliver/webhook"
+	"github.com/google/go-cmp/cmp"
+)
+
+var secret = []byte("s3cret")
+
+// request is one call the receiver saw.
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver is a webhook endpoint answering with the given statuses in turn
+// (the last one repeats) and recording every request.
+type receiver struct {
+	statuses []int
+	delay    time.Duration // before answering, unless the client gives up
+
+	mu       sync.Mutex
+	requests []request
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	status := rc.statuses[min(len(rc.requests), len(rc.statuses)-1)]
+	rc.requests = append(rc.requests, request{header: r.Header.Clone(), body: body})
+	rc.mu.Unlock()
+	select {
+	case <-time.After(rc.delay):
+	case <-r.Context().Done():
+	}
+	w.WriteHeader(status)
+}
+
+func (rc *receiver) seen() []request {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]request(nil), rc.requests...)
+}
+
+func newDeliverer(t *testing.T, rc *receiver, cfg webhook.Config) *webhook.Deliverer {
+	t.Helper()
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+	cfg.URL = srv.URL
+	if cfg.Secret == "" {
+		cfg.Secret = string(secret)
+	}
+	if cfg.Backoff == 0 {
+		cfg.Backoff = time.Millisecond
+	}
+	d, err := webhook.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func message() verificationcode.Message {
+	return verificationcode.Message{
+		To:        "user@example.com",
+		Code:      "654321",
+		ExpiresAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Purpose:   verificationcode.PurposeLogin,
+		Locale:    "de",
+	}
+}
+
+func TestDeliver_Success(t *testing.T) {
+	rc := &receiver{statuses: []int{http.StatusNoContent}}
+	d := newDeliverer(t, rc, webhook.Config{})
+	if err := d.Deliver(context.Background(), message()); err != nil {
+		t.Fatal(err)
+	}
+
+	reqs := rc.seen()
+	if len(reqs) != 1 {
+		t.Fatalf("want 1 request, got %d", len(reqs))
+	}
+	if ct := reqs[0].header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("unexpected Content-Type %q", ct)
+	}
+	v := &webhook.Verifier{Secret: secret}
+	got, err := v.Verify(reqs[0].header, reqs[0].body)
+	if err != nil {
+		t.Fatalf("the receiver must accept the request: %v", err)
+	}
+	if got.ID == "" {
+		t.Error("payload needs an id")
+	}
+	want := webhook.Payload{ID: got.ID, To: "user@example.com", Code: "654321", ExpiresAt: message().ExpiresAt, Purpose: "login", Locale: "de"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected payload (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeliver_Retries(t *testing.T) {
+	tcs := []struct {
+		name      string
+		statuses  []int
+		cfg       webhook.Config
+		wantErr   bool
+		wantCalls int
+	}{
+		{name: "recovers after server errors", statuses: []int{503, 500, 200}, wantCalls: 3},
+		{name: "retries rate limiting", statuses: []int{429, 200}, wantCalls: 2},
+		{name: "gives up after MaxAttempts", statuses: []int{502}, cfg: webhook.Config{MaxAttempts: 4}, wantErr: true, wantCalls: 4},
+		{name: "client errors are final", statuses: []int{400, 200}, wantErr: true, wantCalls: 1},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			rc := &receiver{statuses: tc.statuses}
+			d := newDeliverer(t, rc, tc.cfg)
+			err := d.Deliver(context.Background(), message())
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+			reqs := rc.seen()
+			if len(reqs) != tc.wantCalls {
+				t.Fatalf("want %d calls, got %d", tc.wantCalls, len(reqs))
+			}
+			for _, r := range reqs[1:] {
+				if string(r.body) != string(reqs[0].body) {
+					t.Error("retries must resend the same payload, including its id")
+				}
+			}
+		})
+	}
+}
+
+func TestDeliver_Timeout(t *testing.T) {
+	rc := &receiver{statuses: []int{200}, delay: time.Second}
+	d := newDeliverer(t, rc, webhook.Config{Timeout: 20 * time.Millisecond, MaxAttempts: 2})
+	start := time.Now()
+	err := d.Deliver(context.Background(), message())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("attempts were not bounded by Timeout, took %v", elapsed)
+	}
+	if n := len(rc.seen()); n != 2 {
+		t.Errorf("a timed-out attempt should be retried, got %d calls", n)
+	}
+}
+
+func TestDeliver_ContextCancelledDuringBackoff(t *testing.T) {
+	rc := &receiver{statuses: []int{503}}
+	d := newDeliverer(t, rc, webhook.Config{Backoff: time.Minute})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := d.Deliver(ctx, message()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tcs := []struct {
+		name    string
+		cfg     webhook.Config
+		wantErr string
+	}{
+		{name: "valid", cfg: webhook.Config{URL: "https://example.com/hook", Secret: "x"}},
+		{name: "secret from file", cfg: webhook.Config{URL: "https://example.com/hook", Secret: "@" + secretFile}},
+		{name: "missing url", cfg: webhook.Config{Secret: "x"}, wantErr: "url is required"},
+		{name: "missing secret", cfg: webhook.Config{URL: "https://example.com/hook"}, wantErr: "secret is required"},
+		{name: "missing secret file", cfg: webhook.Config{URL: "https://example.com/hook", Secret: "@/nonexistent"}, wantErr: "reading secret file"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := webhook.New(tc.cfg)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
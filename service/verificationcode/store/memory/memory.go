@@ -1,6 +1,7 @@
 package memory
 
 import (
+	"context"
 	"sync"
 	"time"
 )
@@ -58,3 +59,21 @@ func (s *Store) ConsumeCode(userID, hash string, maxAttempts int) (bool, error)
 	delete(s.codes, userID)
 	return true, nil
 }
+
+// Sweep removes expired codes.
+func (s *Store) Sweep(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for id, entry := range s.codes {
+		if now.After(entry.expiresAt) {
+			delete(s.codes, id)
+			n++
+		}
+	}
+	return n, nil
+}
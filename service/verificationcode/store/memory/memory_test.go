@@ -1,6 +1,7 @@
 package memory
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -114,3 +115,24 @@ func TestStoreCode_OverwritesPrevious(t *testing.T) {
 		t.Fatal("new code should consume")
 	}
 }
+
+func TestSweep(t *testing.T) {
+	s := New()
+	hash := hashutil.HashCodeSHA256("123456")
+	_ = s.StoreCode("live", hash, time.Now().Add(15*time.Minute))
+	_ = s.StoreCode("expired", hash, time.Now().Add(-time.Minute))
+
+	n, err := s.Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("Sweep: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("removed %d codes, want 1", n)
+	}
+	if _, ok := s.codes["expired"]; ok {
+		t.Fatal("expired code should be gone")
+	}
+	if ok, _ := s.ConsumeCode("live", hash, 5); !ok {
+		t.Fatal("live code must survive the sweep")
+	}
+}
@@ -7,6 +7,8 @@ package verificationcode
 
 import (
 	"context"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-bumbu/userauth/internal/hashutil"
@@ -36,7 +38,85 @@ type CodeVerifier interface {
 // transport-agnostic: implementations decide how to format and deliver the
 // message (email, SMS, file, Slack, etc.).
 type Deliverer interface {
-	Deliver(ctx context.Context, to string, code string, expiresAt time.Time) error
+	Deliver(ctx context.Context, msg Message) error
+}
+
+// Purpose says why a code is being sent, so deliverers can word the message
+// accordingly. Custom flows may introduce their own values; deliverers fall
+// back to a generic message for purposes they do not know.
+type Purpose string
+
+// Well-known purposes used by the engines in this module.
+const (
+	PurposeLogin         Purpose = "login"
+	PurposeRegistration  Purpose = "registration"
+	PurposePasswordReset Purpose = "password_reset"
+	// The approval notices carry no code: they tell a registrant that an
+	// admin approved or rejected their account (flow/register/approval).
+	PurposeRegistrationApproved Purpose = "registration_approved"
+	PurposeRegistrationRejected Purpose = "registration_rejected"
+	// PurposeInvite carries an invite code and the Link to register with it
+	// (service/invite).
+	PurposeInvite Purpose = "invite"
+)
+
+// Message is one verification code on its way to a recipient.
+//
+// ExpiresAt is informational — expiry is enforced by the store. Locale is a
+// BCP 47 language tag ("en", "de-CH") or empty; deliverers treat it as a
+// preference and fall back to their default language. Notices without a
+// code leave Code and ExpiresAt empty; Note carries free text from an
+// operator, such as a rejection reason. Link, when set, is a URL the
+// recipient opens instead of typing the code.
+type Message struct {
+	To        string
+	Code      string
+	ExpiresAt time.Time
+	Purpose   Purpose
+	Locale    string
+	Note      string
+	Link      string
+}
+
+type localeKey struct{}
+
+// WithLocale returns a context carrying the recipient's preferred locale.
+// Transports set it (e.g. from Accept-Language) so that engines can address
+// the message without knowing about HTTP.
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, locale)
+}
+
+// LocaleFromContext returns the locale set by WithLocale, or "".
+func LocaleFromContext(ctx context.Context) string {
+	locale, _ := ctx.Value(localeKey{}).(string)
+	return locale
+}
+
+// PreferredLocale returns the highest-ranked language tag of an
+// Accept-Language header value, ignoring the wildcard. It returns "" when
+// the header names no language.
+func PreferredLocale(acceptLanguage string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > bestQ {
+			best, bestQ = tag, q
+		}
+	}
+	return best
 }
 
 const (
@@ -1,6 +1,7 @@
 package verificationcode_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -127,3 +128,36 @@ func TestVerificationCodeService_MaxAttemptsPassedToStore(t *testing.T) {
 
 // Compile-time check that the service satisfies the login verifier interface.
 var _ verificationcode.CodeVerifier = (*verificationcode.Service)(nil)
+
+func TestPreferredLocale(t *testing.T) {
+	tcs := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "empty", header: "", want: ""},
+		{name: "single tag", header: "de-CH", want: "de-CH"},
+		{name: "first of equals wins", header: "fr, en", want: "fr"},
+		{name: "quality ranks", header: "en;q=0.5, de;q=0.9, *;q=1", want: "de"},
+		{name: "wildcard only", header: "*", want: ""},
+		{name: "malformed quality skipped", header: "it;q=x, es;q=0.2", want: "es"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := verificationcode.PreferredLocale(tc.header); got != tc.want {
+				t.Errorf("PreferredLocale(%q) = %q, want %q", tc.header, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLocaleContext(t *testing.T) {
+	ctx := context.Background()
+	if got := verificationcode.LocaleFromContext(ctx); got != "" {
+		t.Fatalf("want empty locale, got %q", got)
+	}
+	ctx = verificationcode.WithLocale(ctx, "de")
+	if got := verificationcode.LocaleFromContext(ctx); got != "de" {
+		t.Fatalf("want de, got %q", got)
+	}
+}
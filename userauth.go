@@ -1,11 +1,14 @@
 package userauth
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/mail"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // UsernameFormat is the policy for allowed login identifier format (e.g. email-only or plain).
@@ -136,6 +139,90 @@ type UserUpdater interface {
 	SetEnabled(userID string, enabled bool) error
 }
 
+// Profile is the descriptive data about a user: what an application shows
+// and personalizes with, never what authenticates them.
+type Profile struct {
+	Name      string // display name
+	Locale    string // BCP 47 language tag, e.g. "de-CH"
+	Timezone  string // IANA time zone name, e.g. "Europe/Zurich"
+	AvatarURL string // absolute http(s) URL
+	// Attributes is application-defined data; keys and values are opaque to
+	// the library. Nil when there is none.
+	Attributes map[string]string
+}
+
+// ProfileGetter reads a user's profile. Unknown users are ErrUserNotFound.
+type ProfileGetter interface {
+	GetProfile(userID string) (Profile, error)
+}
+
+// ProfileUpdater replaces a user's profile as a whole: read it, change
+// fields, write it back. Implementations reject invalid profiles (see
+// ValidateProfile).
+type ProfileUpdater interface {
+	SetProfile(userID string, p Profile) error
+}
+
+// ValidateProfile returns an error if a typed Profile field is malformed:
+// a Locale that is not shaped like a language tag, a Timezone the time
+// package cannot load, or an AvatarURL that is not an absolute http(s) URL.
+// Empty fields are valid. Timezones need the tz database at run time; import
+// time/tzdata in binaries that run without one.
+func ValidateProfile(p Profile) error {
+	if p.Locale != "" && !isLanguageTag(p.Locale) {
+		return fmt.Errorf("invalid locale %q", p.Locale)
+	}
+	if p.Timezone != "" {
+		if _, err := time.LoadLocation(p.Timezone); err != nil || p.Timezone == "Local" {
+			return fmt.Errorf("invalid timezone %q", p.Timezone)
+		}
+	}
+	if p.AvatarURL != "" {
+		u, err := url.Parse(p.AvatarURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("avatar URL must be an absolute http(s) URL")
+		}
+	}
+	return nil
+}
+
+// isLanguageTag reports whether s has the shape of a BCP 47 tag: a 2–8
+// letter language followed by alphanumeric subtags of 1–8 characters.
+func isLanguageTag(s string) bool {
+	for i, sub := range strings.Split(s, "-") {
+		if len(sub) < 1 || len(sub) > 8 || (i == 0 && len(sub) < 2) {
+			return false
+		}
+		for _, r := range sub {
+			letter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+			if !letter && (i == 0 || r < '0' || r > '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// GroupsGetter reports the groups a user belongs to. Group names are opaque
+// to the library; auth/authz checks them against route requirements.
+type GroupsGetter interface {
+	GetGroups(userID string) ([]string, error)
+}
+
+// GroupsSetter replaces a user's group memberships.
+type GroupsSetter interface {
+	SetGroups(userID string, groups []string) error
+}
+
+// Sweeper is implemented by stores that keep expiring state (login attempts,
+// pending registrations, codes, invites, tokens, throttle entries). Sweep
+// permanently removes what has expired and reports how many records went;
+// service/janitor calls it on an interval. Stores already treat expired
+// records as absent when reading them, so sweeping only reclaims space.
+type Sweeper interface {
+	Sweep(ctx context.Context) (removed int, err error)
+}
+
 // The write side of TOTP and recovery codes is not a store interface: enrolment
 // and code issuance are policy (secret generation, confirmation, hashing, how
 // many codes a user gets), so they live in service/totp and
@@ -1,6 +1,7 @@
 package userauth
 
 import (
+	"context"
 	"errors"
 	"testing"
 
@@ -184,3 +185,54 @@ func TestValidateLoginID(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateProfile(t *testing.T) {
+	tcs := []struct {
+		name    string
+		profile Profile
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "all fields", profile: Profile{
+			Name: "Alice", Locale: "de-CH", Timezone: "Europe/Zurich", AvatarURL: "https://cdn.example.com/a.png",
+			Attributes: map[string]string{"anything": "goes"},
+		}},
+		{name: "language only", profile: Profile{Locale: "en"}},
+		{name: "script and region", profile: Profile{Locale: "zh-Hant-TW"}},
+		{name: "numeric region", profile: Profile{Locale: "es-419"}},
+		{name: "UTC", profile: Profile{Timezone: "UTC"}},
+		{name: "one-letter language", profile: Profile{Locale: "e"}, wantErr: true},
+		{name: "underscore locale", profile: Profile{Locale: "de_CH"}, wantErr: true},
+		{name: "empty subtag", profile: Profile{Locale: "de--CH"}, wantErr: true},
+		{name: "unknown timezone", profile: Profile{Timezone: "Mars/Olympus"}, wantErr: true},
+		{name: "Local timezone", profile: Profile{Timezone: "Local"}, wantErr: true},
+		{name: "relative avatar", profile: Profile{AvatarURL: "/a.png"}, wantErr: true},
+		{name: "javascript avatar", profile: Profile{AvatarURL: "javascript:alert(1)"}, wantErr: true},
+		{name: "data avatar", profile: Profile{AvatarURL: "data:image/png;base64,AAAA"}, wantErr: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateProfile(tc.profile)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("ValidateProfile() err = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestIdentityFromContext(t *testing.T) {
+	if _, ok := IdentityFromContext(context.Background()); ok {
+		t.Error("a bare context has no identity")
+	}
+	if _, ok := IdentityFromContext(ContextWithIdentity(context.Background(), Identity{Method: "x"})); ok {
+		t.Error("an identity without a user ID does not count")
+	}
+	want := Identity{UserID: "u1", LoginID: "ana", Method: "tokenauth", TokenID: "t1", Scopes: []string{"read"}}
+	got, ok := IdentityFromContext(ContextWithIdentity(context.Background(), want))
+	if !ok {
+		t.Fatal("identity not found")
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("identity (-want +got):\n%s", diff)
+	}
+}
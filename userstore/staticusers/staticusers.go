@@ -16,6 +16,7 @@ var _ userauth.UserGetter = &Users{}
 var _ userauth.TOTPGetter = &Users{}
 var _ userauth.RecoveryCodeVerifier = &Users{}
 var _ userauth.SecondFactorProvider = &Users{}
+var _ userauth.ProfileGetter = &Users{}
 
 type User struct {
 	Id         string `yaml:"id" json:"id"`                   // user identifying string: e.g. name or email; static users never rename, so it doubles as the canonical ID
@@ -23,6 +24,24 @@ type User struct {
 	Enabled    bool   `yaml:"enabled" json:"enabled"`         // flag if user is enabled
 	TOTPSecret string `yaml:"totp_secret" json:"totp_secret"` // base32 TOTP secret (optional); non-empty means TOTP available
 	Email2FA   string `yaml:"email_2fa" json:"email_2fa"`     // email address for email 2FA (optional); non-empty means email 2FA available
+
+	// profile (optional), see userauth.Profile; checked with
+	// userauth.ValidateProfile when the file is loaded
+	Name       string            `yaml:"name" json:"name"`
+	Locale     string            `yaml:"locale" json:"locale"`
+	Timezone   string            `yaml:"timezone" json:"timezone"`
+	AvatarURL  string            `yaml:"avatar_url" json:"avatar_url"`
+	Attributes map[string]string `yaml:"attributes" json:"attributes"`
+}
+
+func (u User) profile() userauth.Profile {
+	return userauth.Profile{
+		Name:       u.Name,
+		Locale:     u.Locale,
+		Timezone:   u.Timezone,
+		AvatarURL:  u.AvatarURL,
+		Attributes: u.Attributes,
+	}
 }
 
 // TODO: add option to allow plaintext passwords in files,
@@ -84,6 +103,17 @@ func (stu *Users) AvailableSecondFactors(userID string) ([]userauth.SecondFactor
 	return nil, nil
 }
 
+// GetProfile implements userauth.ProfileGetter. Static profiles are read-only:
+// change them in the file.
+func (stu *Users) GetProfile(userID string) (userauth.Profile, error) {
+	for _, u := range stu.Users {
+		if u.Id == userID {
+			return u.profile(), nil
+		}
+	}
+	return userauth.Profile{}, userauth.ErrUserNotFound
+}
+
 // VerifyRecoveryCode implements userauth.RecoveryCodeVerifier. Static users have no codes; always false.
 func (stu *Users) VerifyRecoveryCode(userID, code string) (bool, error) {
 	return false, nil
@@ -120,7 +150,10 @@ func yamlBytes(in []byte) (*Users, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &data, err
+	if err := data.validate(); err != nil {
+		return nil, err
+	}
+	return &data, nil
 }
 
 // unmarshal a json containing users into a list of users
@@ -130,7 +163,21 @@ func jsonBytes(in []byte) (*Users, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &data, err
+	if err := data.validate(); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// validate rejects malformed profiles, so a typo in the file fails at load
+// time rather than when the profile is shown.
+func (stu *Users) validate() error {
+	for _, u := range stu.Users {
+		if err := userauth.ValidateProfile(u.profile()); err != nil {
+			return fmt.Errorf("user %q: %w", u.Id, err)
+		}
+	}
+	return nil
 }
 
 const (
@@ -204,3 +204,45 @@ func TestGetUser_Email2FA(t *testing.T) {
 		t.Errorf("unexpected value (-got +want)\n%s", diff)
 	}
 }
+
+func TestGetProfile(t *testing.T) {
+	want := userauth.Profile{
+		Name:       "Carol",
+		Locale:     "de-CH",
+		Timezone:   "Europe/Zurich",
+		AvatarURL:  "https://cdn.example.com/carol.png",
+		Attributes: map[string]string{"team": "platform"},
+	}
+	for _, file := range []string{"testdata/users.yaml", "testdata/users.json"} {
+		t.Run(file, func(t *testing.T) {
+			users, err := FromFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := users.GetProfile("carol")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("profile mismatch (-want +got):\n%s", diff)
+			}
+			if got, err := users.GetProfile("demo"); err != nil || !cmp.Equal(got, userauth.Profile{}) {
+				t.Errorf("want an empty profile, got %+v err=%v", got, err)
+			}
+			if _, err := users.GetProfile("nobody"); err != userauth.ErrUserNotFound {
+				t.Errorf("want ErrUserNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestInvalidProfile(t *testing.T) {
+	_, err := yamlBytes([]byte("users:\n  - id: eve\n    avatar_url: \"javascript:alert(1)\"\n"))
+	if err == nil {
+		t.Error("want an invalid avatar URL rejected at load")
+	}
+	_, err = jsonBytes([]byte(`{"users": [{"id": "eve", "timezone": "Mars/Olympus"}]}`))
+	if err == nil {
+		t.Error("want an invalid timezone rejected at load")
+	}
+}
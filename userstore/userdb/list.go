@@ -0,0 +1,207 @@
+package userdb
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-bumbu/userauth"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+// The list vocabulary lives in userauth, which the engine and the admin flow
+// share; these aliases keep it reachable under the names userdb callers
+// already use.
+type (
+	SortField  = userauth.SortField
+	ListOpts   = userauth.ListOpts
+	ListResult = userauth.ListResult
+)
+
+const (
+	SortLoginID   = userauth.SortLoginID
+	SortName      = userauth.SortName
+	SortEmail     = userauth.SortEmail
+	SortCreatedAt = userauth.SortCreatedAt
+)
+
+// ErrInvalidCursor is userauth.ErrInvalidCursor.
+var ErrInvalidCursor = userauth.ErrInvalidCursor
+
+// sortColumn returns the users column f orders by.
+func sortColumn(f userauth.SortField) (string, bool) {
+	switch f {
+	case userauth.SortLoginID, "":
+		return "login_id", true
+	case userauth.SortName:
+		return "name", true
+	case userauth.SortEmail:
+		return "primary_email", true
+	case userauth.SortCreatedAt:
+		return "created_at", true
+	}
+	return "", false
+}
+
+// cursor is the decoded form of ListOpts.Cursor: the sort key and row ID of
+// the last user on the page, and the ordering they belong to.
+type cursor struct {
+	Sort  userauth.SortField `json:"s"`
+	Desc  bool               `json:"d"`
+	Value string             `json:"v"`
+	ID    uint               `json:"i"`
+}
+
+// List implements userauth.UserLister. Limit defaults to 50 and is capped
+// at 200; users with equal sort keys are ordered by creation.
+func (s Store) List(opts userauth.ListOpts) (userauth.ListResult, error) {
+	col, ok := sortColumn(opts.Sort)
+	if !ok {
+		return userauth.ListResult{}, fmt.Errorf("unknown sort field %q", opts.Sort)
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	var total int64
+	if err := s.filter(opts).Count(&total).Error; err != nil {
+		return userauth.ListResult{}, err
+	}
+
+	dir, cmp := "ASC", ">"
+	if opts.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	q := s.filter(opts).Order(col + " " + dir).Order("id " + dir)
+	if opts.Cursor != "" {
+		c, err := decodeCursor(opts.Cursor)
+		if err != nil || c.Sort != sortOrDefault(opts.Sort) || c.Desc != opts.Desc {
+			return userauth.ListResult{}, userauth.ErrInvalidCursor
+		}
+		v, err := c.value()
+		if err != nil {
+			return userauth.ListResult{}, userauth.ErrInvalidCursor
+		}
+		q = q.Where(fmt.Sprintf("(%[1]s %[2]s ?) OR (%[1]s = ? AND id %[2]s ?)", col, cmp), v, v, c.ID)
+	} else if opts.Offset > 0 {
+		q = q.Offset(opts.Offset)
+	}
+
+	// one row more than asked tells whether another page follows
+	var rows []userModel
+	if err := q.Limit(limit + 1).Find(&rows).Error; err != nil {
+		return userauth.ListResult{}, err
+	}
+	res := userauth.ListResult{Total: int(total)}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		next, err := newCursor(opts, rows[limit-1]).encode()
+		if err != nil {
+			return userauth.ListResult{}, err
+		}
+		res.NextCursor = next
+	}
+	res.Users = make([]userauth.User, 0, len(rows))
+	for _, m := range rows {
+		res.Users = append(res.Users, m.toUser())
+	}
+	return res, nil
+}
+
+// filter returns the users query restricted by the filters in opts.
+func (s Store) filter(opts userauth.ListOpts) *gorm.DB {
+	q := s.db.Model(&userModel{})
+	if opts.Search != "" {
+		pattern := "%" + escapeLike(strings.ToLower(opts.Search)) + "%"
+		q = q.Where("LOWER(login_id) LIKE ? ESCAPE '!' OR LOWER(primary_email) LIKE ? ESCAPE '!' OR LOWER(name) LIKE ? ESCAPE '!'",
+			pattern, pattern, pattern)
+	}
+	if opts.Enabled != nil {
+		q = q.Where("enabled = ?", *opts.Enabled)
+	}
+	if opts.Group != "" {
+		q = q.Where("uuid IN (?)", s.db.Model(&groupModel{}).Select("user_id").Where("group_name = ?", opts.Group))
+	}
+	if opts.SecondFactor != nil {
+		totp := s.db.Model(&totpModel{}).Select("user_id").Where("enabled = ?", true)
+		codes := s.db.Model(&secondFactorFlagsModel{}).Select("user_id").
+			Where("email_enabled = ? OR sms_enabled = ?", true, true)
+		if *opts.SecondFactor {
+			q = q.Where("uuid IN (?) OR uuid IN (?)", totp, codes)
+		} else {
+			q = q.Where("uuid NOT IN (?) AND uuid NOT IN (?)", totp, codes)
+		}
+	}
+	if !opts.CreatedAfter.IsZero() {
+		q = q.Where("created_at >= ?", opts.CreatedAfter)
+	}
+	if !opts.CreatedBefore.IsZero() {
+		q = q.Where("created_at < ?", opts.CreatedBefore)
+	}
+	return q
+}
+
+// escapeLike escapes the LIKE wildcards in s for ESCAPE '!', a character
+// every dialect takes literally in a string.
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+func sortOrDefault(f userauth.SortField) userauth.SortField {
+	if f == "" {
+		return userauth.SortLoginID
+	}
+	return f
+}
+
+func newCursor(opts userauth.ListOpts, last userModel) cursor {
+	c := cursor{Sort: sortOrDefault(opts.Sort), Desc: opts.Desc, ID: last.ID}
+	switch c.Sort {
+	case userauth.SortName:
+		c.Value = last.Name
+	case userauth.SortEmail:
+		c.Value = last.PrimaryEmail
+	case userauth.SortCreatedAt:
+		c.Value = last.CreatedAt.Format(time.RFC3339Nano)
+	default:
+		c.Value = last.LoginID
+	}
+	return c
+}
+
+// value returns the sort key as the query binds it.
+func (c cursor) value() (any, error) {
+	if c.Sort == userauth.SortCreatedAt {
+		return time.Parse(time.RFC3339Nano, c.Value)
+	}
+	return c.Value, nil
+}
+
+func (c cursor) encode() (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("encode list cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(b, &c)
+	return c, err
+}
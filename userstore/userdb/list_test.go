@@ -0,0 +1,227 @@
+package userdb
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-bumbu/userauth/service/totp"
+	"github.com/google/go-cmp/cmp"
+)
+
+// seedListUsers creates the users the List tests query and returns their IDs
+// by login ID. Creation times are a day apart, in slice order, from base.
+func seedListUsers(t *testing.T, mng *Store, base time.Time) map[string]string {
+	t.Helper()
+	users := []User{
+		{LoginID: "alice", Name: "Alice Smith", PrimaryEmail: "alice@example.com", Enabled: true, Groups: []string{"admin"}},
+		{LoginID: "bob", Name: "Bob Jones", PrimaryEmail: "bob@corp.test", Enabled: true},
+		{LoginID: "carol", Name: "Carol 100%", PrimaryEmail: "carol@example.com", Enabled: false, Groups: []string{"admin", "ops"}},
+		{LoginID: "dave_x", Name: "Dave", PrimaryEmail: "DAVE@Example.com", Enabled: true, Groups: []string{"ops"}},
+		{LoginID: "erin", Name: "Erin", PrimaryEmail: "erin@corp.test", Enabled: false},
+	}
+	ids := make(map[string]string, len(users))
+	for i, u := range users {
+		u.Pw = "pw"
+		if err := mng.CreateUser(u); err != nil {
+			t.Fatalf("create %s: %s", u.LoginID, err)
+		}
+		got, err := mng.GetUserByLogin(u.LoginID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[u.LoginID] = got.ID
+		err = mng.db.Model(&userModel{}).Where("uuid = ?", got.ID).
+			Update("created_at", base.Add(time.Duration(i)*24*time.Hour)).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// alice enrolled TOTP, bob only started enrolling, dave uses SMS codes
+	if err := mng.TOTPStore().Set(ids["alice"], totp.Record{Secret: "s", Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := mng.TOTPStore().Set(ids["bob"], totp.Record{Secret: "s"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := mng.SetSMSCodeEnabled(ids["dave_x"], true); err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func loginIDs(res ListResult) []string {
+	out := make([]string, 0, len(res.Users))
+	for _, u := range res.Users {
+		out = append(out, u.LoginID)
+	}
+	return out
+}
+
+func TestListFilters(t *testing.T) {
+	mng := setup(t)
+	defer clean()
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	seedListUsers(t, mng, base)
+	yes, no := true, false
+
+	tcs := []struct {
+		name string
+		opts ListOpts
+		want []string
+	}{
+		{name: "no filter", opts: ListOpts{}, want: []string{"alice", "bob", "carol", "dave_x", "erin"}},
+		{name: "search login id", opts: ListOpts{Search: "ali"}, want: []string{"alice"}},
+		{name: "search email case-insensitive", opts: ListOpts{Search: "EXAMPLE.COM"}, want: []string{"alice", "carol", "dave_x"}},
+		{name: "search name", opts: ListOpts{Search: "jones"}, want: []string{"bob"}},
+		{name: "search wildcard is literal", opts: ListOpts{Search: "%"}, want: []string{"carol"}},
+		{name: "search underscore is literal", opts: ListOpts{Search: "_"}, want: []string{"dave_x"}},
+		{name: "search no match", opts: ListOpts{Search: "zed"}, want: []string{}},
+		{name: "enabled", opts: ListOpts{Enabled: &yes}, want: []string{"alice", "bob", "dave_x"}},
+		{name: "disabled", opts: ListOpts{Enabled: &no}, want: []string{"carol", "erin"}},
+		{name: "group", opts: ListOpts{Group: "admin"}, want: []string{"alice", "carol"}},
+		{name: "unknown group", opts: ListOpts{Group: "nobody"}, want: []string{}},
+		{name: "with second factor", opts: ListOpts{SecondFactor: &yes}, want: []string{"alice", "dave_x"}},
+		{name: "without second factor", opts: ListOpts{SecondFactor: &no}, want: []string{"bob", "carol", "erin"}},
+		{
+			name: "created range",
+			opts: ListOpts{CreatedAfter: base.Add(24 * time.Hour), CreatedBefore: base.Add(3 * 24 * time.Hour)},
+			want: []string{"bob", "carol"},
+		},
+		{
+			name: "combined",
+			opts: ListOpts{Search: "example", Group: "ops", Enabled: &yes},
+			want: []string{"dave_x"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := mng.List(tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, loginIDs(res)); diff != "" {
+				t.Errorf("unexpected users (-want +got):\n%s", diff)
+			}
+			if res.Total != len(tc.want) {
+				t.Errorf("want total %d, got %d", len(tc.want), res.Total)
+			}
+			if res.NextCursor != "" {
+				t.Errorf("single page: want no next cursor, got %q", res.NextCursor)
+			}
+		})
+	}
+}
+
+func TestListSort(t *testing.T) {
+	mng := setup(t)
+	defer clean()
+	seedListUsers(t, mng, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	tcs := []struct {
+		name string
+		opts ListOpts
+		want []string
+	}{
+		{name: "login id desc", opts: ListOpts{Desc: true}, want: []string{"erin", "dave_x", "carol", "bob", "alice"}},
+		{name: "name", opts: ListOpts{Sort: SortName}, want: []string{"alice", "bob", "carol", "dave_x", "erin"}},
+		// "DAVE@..." sorts before lower-case addresses
+		{name: "email", opts: ListOpts{Sort: SortEmail}, want: []string{"dave_x", "alice", "bob", "carol", "erin"}},
+		{name: "created at desc", opts: ListOpts{Sort: SortCreatedAt, Desc: true}, want: []string{"erin", "dave_x", "carol", "bob", "alice"}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := mng.List(tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, loginIDs(res)); diff != "" {
+				t.Errorf("unexpected order (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if _, err := mng.List(ListOpts{Sort: "password"}); err == nil {
+		t.Error("unknown sort field: want error, got nil")
+	}
+}
+
+func TestListCursor(t *testing.T) {
+	mng := setup(t)
+	defer clean()
+	seedListUsers(t, mng, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	// a duplicate name exercises the ID tie-break
+	if err := mng.CreateUser(User{LoginID: "frank", Name: "Bob Jones", Pw: "pw"}); err != nil {
+		t.Fatal(err)
+	}
+
+	walk := func(t *testing.T, opts ListOpts) []string {
+		t.Helper()
+		var got []string
+		for page := 0; ; page++ {
+			if page > 10 {
+				t.Fatal("cursor does not terminate")
+			}
+			res, err := mng.List(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, loginIDs(res)...)
+			if res.NextCursor == "" {
+				return got
+			}
+			opts.Cursor = res.NextCursor
+		}
+	}
+
+	tcs := []struct {
+		name string
+		opts ListOpts
+		want []string
+	}{
+		{name: "login id", opts: ListOpts{Limit: 2}, want: []string{"alice", "bob", "carol", "dave_x", "erin", "frank"}},
+		{name: "name desc", opts: ListOpts{Limit: 2, Sort: SortName, Desc: true}, want: []string{"erin", "dave_x", "carol", "frank", "bob", "alice"}},
+		{name: "created at", opts: ListOpts{Limit: 4, Sort: SortCreatedAt}, want: []string{"alice", "bob", "carol", "dave_x", "erin", "frank"}},
+		{name: "filtered", opts: ListOpts{Limit: 1, Search: "example"}, want: []string{"alice", "carol", "dave_x"}},
+		{name: "exact last page", opts: ListOpts{Limit: 3}, want: []string{"alice", "bob", "carol", "dave_x", "erin", "frank"}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, walk(t, tc.opts)); diff != "" {
+				t.Errorf("unexpected users (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("offset ignored with cursor", func(t *testing.T) {
+		res, err := mng.List(ListOpts{Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err = mng.List(ListOpts{Limit: 2, Offset: 3, Cursor: res.NextCursor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"carol", "dave_x"}, loginIDs(res)); diff != "" {
+			t.Errorf("unexpected users (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		res, err := mng.List(ListOpts{Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, opts := range map[string]ListOpts{
+			"garbage":    {Cursor: "not a cursor"},
+			"other sort": {Cursor: res.NextCursor, Sort: SortName},
+			"other dir":  {Cursor: res.NextCursor, Desc: true},
+		} {
+			if _, err := mng.List(opts); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("%s: want ErrInvalidCursor, got %v", name, err)
+			}
+		}
+	})
+}
@@ -13,6 +13,8 @@ import (
 	recstoretest "github.com/go-bumbu/userauth/service/recoverycodes/storetest"
 	"github.com/go-bumbu/userauth/service/totp"
 	totpstoretest "github.com/go-bumbu/userauth/service/totp/storetest"
+	"github.com/go-bumbu/userauth/service/trusteddevice"
+	devicestoretest "github.com/go-bumbu/userauth/service/trusteddevice/storetest"
 	"github.com/go-bumbu/userauth/userstore/userdb"
 	otptotp "github.com/pquerna/otp/totp"
 	"golang.org/x/crypto/bcrypt"
@@ -57,6 +59,12 @@ func TestRecoveryCodeStoreConformance(t *testing.T) {
 	})
 }
 
+func TestTrustedDeviceStoreConformance(t *testing.T) {
+	devicestoretest.Run(t, func(t *testing.T) trusteddevice.Store {
+		return newStore(t).TrustedDeviceStore()
+	})
+}
+
 // TestTOTPSecretsEncryptedBeforeTheServiceOwnedTheCipher is the migration
 // guard. Before service/totp existed, userdb encrypted TOTP secrets itself with
 // hashutil.Encrypt(secret, key, nil) and had no key-id column. Moving the key
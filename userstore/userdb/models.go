@@ -26,6 +26,13 @@ type userModel struct {
 	PrimaryEmailVerified bool
 	BackupEmail          string
 	BackupEmailVerified  bool
+	InvitedBy            string `gorm:"index"` // UUID of the referring user, if any
+	// Profile fields besides Name (see profile.go). Attributes holds the
+	// JSON-encoded map[string]string; empty without attributes.
+	Locale     string
+	Timezone   string
+	AvatarURL  string
+	Attributes string
 }
 
 // groupModel stores one group membership per row (user_groups table,
@@ -137,3 +144,19 @@ type patModel struct {
 }
 
 func (patModel) TableName() string { return "user_pats" }
+
+// trustedDeviceModel stores one trusted browser per row (user_trusted_devices
+// table, UserID = user UUID). SecretHash is the SHA-256 hex of the secret the
+// device cookie carries; the plaintext is never stored.
+type trustedDeviceModel struct {
+	ID         uint      `gorm:"primaryKey"`
+	DeviceID   string    `gorm:"uniqueIndex;not null"`
+	UserID     string    `gorm:"index;not null"`
+	Name       string    `gorm:"not null"`
+	SecretHash string    `gorm:"not null"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+func (trustedDeviceModel) TableName() string { return "user_trusted_devices" }
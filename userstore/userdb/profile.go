@@ -0,0 +1,78 @@
+package userdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/go-bumbu/userauth"
+	"gorm.io/gorm"
+)
+
+// GetProfile implements userauth.ProfileGetter. Returns
+// userauth.ErrUserNotFound if the user does not exist.
+func (s Store) GetProfile(userID string) (userauth.Profile, error) {
+	var m userModel
+	err := s.db.Select("name", "locale", "timezone", "avatar_url", "attributes").
+		First(&m, "uuid = ?", userID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return userauth.Profile{}, userauth.ErrUserNotFound
+		}
+		return userauth.Profile{}, err
+	}
+	p := userauth.Profile{
+		Name:      m.Name,
+		Locale:    m.Locale,
+		Timezone:  m.Timezone,
+		AvatarURL: m.AvatarURL,
+	}
+	if m.Attributes != "" {
+		if err := json.Unmarshal([]byte(m.Attributes), &p.Attributes); err != nil {
+			return userauth.Profile{}, fmt.Errorf("decode profile attributes: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// SetProfile implements userauth.ProfileUpdater. It replaces every profile
+// field, Attributes included, after checking them with
+// userauth.ValidateProfile. Returns userauth.ErrUserNotFound if the user
+// does not exist.
+func (s Store) SetProfile(userID string, p userauth.Profile) error {
+	if err := userauth.ValidateProfile(p); err != nil {
+		return err
+	}
+	attributes, err := encodeAttributes(p.Attributes)
+	if err != nil {
+		return err
+	}
+	res := s.db.Model(&userModel{}).Where("uuid = ?", userID).
+		Updates(map[string]interface{}{
+			"name":       p.Name,
+			"locale":     p.Locale,
+			"timezone":   p.Timezone,
+			"avatar_url": p.AvatarURL,
+			"attributes": attributes,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return userauth.ErrUserNotFound
+	}
+	return nil
+}
+
+// encodeAttributes returns the stored form of a profile's Attributes: JSON,
+// or empty for none.
+func encodeAttributes(attributes map[string]string) (string, error) {
+	if len(attributes) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(attributes)
+	if err != nil {
+		return "", fmt.Errorf("encode profile attributes: %w", err)
+	}
+	return string(b), nil
+}
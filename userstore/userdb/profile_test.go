@@ -0,0 +1,99 @@
+package userdb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-bumbu/userauth"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProfile(t *testing.T) {
+	mng := setup(t)
+	defer clean()
+
+	mustCreate := func(t *testing.T, usr User) string {
+		t.Helper()
+		if err := mng.CreateUser(usr); err != nil {
+			t.Fatalf("create user: %s", err)
+		}
+		got, err := mng.GetUserByLogin(usr.LoginID)
+		if err != nil {
+			t.Fatalf("read back user: %s", err)
+		}
+		return got.ID
+	}
+
+	t.Run("created with profile", func(t *testing.T) {
+		id := mustCreate(t, User{
+			LoginID: "alice", Pw: "1234", Name: "Alice",
+			Locale: "de-CH", Timezone: "Europe/Zurich", AvatarURL: "https://cdn.example.com/alice.png",
+			Attributes: map[string]string{"team": "platform"},
+		})
+		got, err := mng.GetProfile(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := userauth.Profile{
+			Name: "Alice", Locale: "de-CH", Timezone: "Europe/Zurich", AvatarURL: "https://cdn.example.com/alice.png",
+			Attributes: map[string]string{"team": "platform"},
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("profile mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("empty profile", func(t *testing.T) {
+		id := mustCreate(t, User{LoginID: "bob", Pw: "1234"})
+		got, err := mng.GetProfile(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(userauth.Profile{}, got); diff != "" {
+			t.Errorf("want the zero profile (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("set replaces the whole profile", func(t *testing.T) {
+		id := mustCreate(t, User{LoginID: "carol", Pw: "1234", Name: "Carol", Locale: "en", Attributes: map[string]string{"a": "1"}})
+		p := userauth.Profile{Name: "Caroline", Timezone: "UTC", Attributes: map[string]string{"b": "2"}}
+		if err := mng.SetProfile(id, p); err != nil {
+			t.Fatal(err)
+		}
+		got, err := mng.GetProfile(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(p, got); diff != "" {
+			t.Errorf("profile mismatch (-want +got):\n%s", diff)
+		}
+		if err := mng.SetProfile(id, userauth.Profile{}); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := mng.GetProfile(id); got.Name != "" || got.Attributes != nil {
+			t.Errorf("want the profile cleared, got %+v", got)
+		}
+	})
+
+	t.Run("invalid profiles are rejected", func(t *testing.T) {
+		id := mustCreate(t, User{LoginID: "dave", Pw: "1234", Name: "Dave"})
+		if err := mng.SetProfile(id, userauth.Profile{Name: "Eve", AvatarURL: "javascript:alert(1)"}); err == nil {
+			t.Error("want an invalid avatar URL rejected")
+		}
+		if got, _ := mng.GetProfile(id); got.Name != "Dave" {
+			t.Errorf("a rejected update must change nothing, got %+v", got)
+		}
+		if err := mng.CreateUser(User{LoginID: "erin", Pw: "1234", Timezone: "Mars/Olympus"}); err == nil {
+			t.Error("want create with an invalid timezone rejected")
+		}
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		if _, err := mng.GetProfile("does-not-exist"); !errors.Is(err, userauth.ErrUserNotFound) {
+			t.Errorf("get: want ErrUserNotFound, got %v", err)
+		}
+		if err := mng.SetProfile("does-not-exist", userauth.Profile{Name: "x"}); !errors.Is(err, userauth.ErrUserNotFound) {
+			t.Errorf("set: want ErrUserNotFound, got %v", err)
+		}
+	})
+}
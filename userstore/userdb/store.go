@@ -9,7 +9,10 @@ import (
 var (
 	_ userauth.UserGetter           = (*Store)(nil)
 	_ userauth.UserUpdater          = (*Store)(nil)
+	_ userauth.UserLister           = (*Store)(nil)
 	_ userauth.SecondFactorProvider = (*Store)(nil)
+	_ userauth.ProfileGetter        = (*Store)(nil)
+	_ userauth.ProfileUpdater       = (*Store)(nil)
 )
 
 // Store is an opinionated user manager that stores the information on a gorm database
@@ -30,7 +33,7 @@ type Opts struct {
 func New(db *gorm.DB, opts Opts) (*Store, error) {
 
 	// Migrate the schema
-	err := db.AutoMigrate(&userModel{}, &groupModel{}, &totpModel{}, &recoveryCodeModel{}, &emailVerificationCodeModel{}, &smsVerificationCodeModel{}, &secondFactorFlagsModel{}, &pendingEmailChangeModel{}, &patModel{})
+	err := db.AutoMigrate(&userModel{}, &groupModel{}, &totpModel{}, &recoveryCodeModel{}, &emailVerificationCodeModel{}, &smsVerificationCodeModel{}, &secondFactorFlagsModel{}, &pendingEmailChangeModel{}, &patModel{}, &trustedDeviceModel{})
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,44 @@
+package userdb
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-bumbu/userauth"
+	"gorm.io/gorm"
+)
+
+var _ userauth.Sweeper = (*Store)(nil)
+
+// Sweep deletes expired rows from every table the store owns that holds
+// expiring state: email and SMS codes, pending email changes, personal access
+// tokens past their expiry, and trusted devices. Users, groups and second-factor
+// enrolment never expire and are left alone.
+func (s Store) Sweep(ctx context.Context) (int, error) {
+	now := time.Now()
+	removed := 0
+	expired := []struct {
+		model any
+		where string
+	}{
+		{&emailVerificationCodeModel{}, "expires_at < ?"},
+		{&smsVerificationCodeModel{}, "expires_at < ?"},
+		{&pendingEmailChangeModel{}, "expires_at < ?"},
+		{&patModel{}, "expires_at IS NOT NULL AND expires_at < ?"},
+		{&trustedDeviceModel{}, "expires_at < ?"},
+	}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, e := range expired {
+			res := tx.Where(e.where, now).Delete(e.model)
+			if res.Error != nil {
+				return res.Error
+			}
+			removed += int(res.RowsAffected)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
@@ -0,0 +1,72 @@
+package userdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-bumbu/userauth/service/pat"
+	"github.com/go-bumbu/userauth/service/trusteddevice"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSweep(t *testing.T) {
+	mng := setup(t)
+	defer clean()
+
+	u1 := mustCreateUser(t, mng, "sweep-1")
+	u2 := mustCreateUser(t, mng, "sweep-2")
+	past, future := time.Now().UTC().Add(-time.Hour), time.Now().UTC().Add(time.Hour)
+
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(mng.StoreEmailCode(u1, "h", past))
+	must(mng.StoreEmailCode(u2, "h", future))
+	must(mng.StoreSMSCode(u1, "h", past))
+	must(mng.StorePendingEmailChange(u1, "new@example.com", "h", past))
+	must(mng.StorePendingEmailChange(u2, "new@example.com", "h", future))
+	pats := mng.PATStore()
+	must(pats.Insert(pat.TokenRecord{TokenID: "expired", UserID: u1, Name: "a", SecretHash: "h", ExpiresAt: &past}))
+	must(pats.Insert(pat.TokenRecord{TokenID: "live", UserID: u1, Name: "b", SecretHash: "h", ExpiresAt: &future}))
+	must(pats.Insert(pat.TokenRecord{TokenID: "forever", UserID: u1, Name: "c", SecretHash: "h"}))
+	devices := mng.TrustedDeviceStore()
+	must(devices.Insert(trusteddevice.Device{ID: "expired", UserID: u1, Name: "a", SecretHash: "h", ExpiresAt: past}))
+	must(devices.Insert(trusteddevice.Device{ID: "live", UserID: u1, Name: "b", SecretHash: "h", ExpiresAt: future}))
+
+	n, err := mng.Sweep(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Errorf("removed %d rows, want 5", n)
+	}
+
+	count := func(model any) int64 {
+		var c int64
+		must(mng.db.Model(model).Count(&c).Error)
+		return c
+	}
+	got := map[string]int64{
+		"email codes":           count(&emailVerificationCodeModel{}),
+		"sms codes":             count(&smsVerificationCodeModel{}),
+		"pending email changes": count(&pendingEmailChangeModel{}),
+		"pats":                  count(&patModel{}),
+		"trusted devices":       count(&trustedDeviceModel{}),
+		"users":                 count(&userModel{}),
+	}
+	want := map[string]int64{
+		"email codes":           1,
+		"sms codes":             0,
+		"pending email changes": 1,
+		"pats":                  2,
+		"trusted devices":       1,
+		"users":                 2,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("remaining rows (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,102 @@
+package userdb
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-bumbu/userauth/service/trusteddevice"
+	"gorm.io/gorm"
+)
+
+// TrustedDeviceStore returns the store's trusteddevice.Store view.
+// Persistence only: secret hashes are stored as service/trusteddevice hands
+// them over, and expiry is the service's to enforce.
+func (s Store) TrustedDeviceStore() trusteddevice.Store { return trustedDeviceStore{s} }
+
+// trustedDeviceStore adapts Store to trusteddevice.Store.
+type trustedDeviceStore struct{ s Store }
+
+var _ trusteddevice.Store = trustedDeviceStore{}
+
+// Insert stores a new record; the device ID must be unique.
+func (t trustedDeviceStore) Insert(d trusteddevice.Device) error {
+	m := trustedDeviceModel{
+		DeviceID:   d.ID,
+		UserID:     d.UserID,
+		Name:       d.Name,
+		SecretHash: d.SecretHash,
+		ExpiresAt:  d.ExpiresAt,
+		LastUsedAt: d.LastUsedAt,
+		CreatedAt:  d.CreatedAt,
+	}
+	return t.s.db.Create(&m).Error
+}
+
+// Get returns the record or trusteddevice.ErrDeviceNotFound.
+func (t trustedDeviceStore) Get(deviceID string) (trusteddevice.Device, error) {
+	var m trustedDeviceModel
+	err := t.s.db.First(&m, "device_id = ?", deviceID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return trusteddevice.Device{}, trusteddevice.ErrDeviceNotFound
+		}
+		return trusteddevice.Device{}, err
+	}
+	return toDevice(m), nil
+}
+
+// ListByUser returns the user's records, oldest first.
+func (t trustedDeviceStore) ListByUser(userID string) ([]trusteddevice.Device, error) {
+	var rows []trustedDeviceModel
+	if err := t.s.db.Where("user_id = ?", userID).
+		Order("created_at ASC, device_id ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make([]trusteddevice.Device, 0, len(rows))
+	for _, m := range rows {
+		out = append(out, toDevice(m))
+	}
+	return out, nil
+}
+
+// Delete removes the device only when it belongs to userID.
+func (t trustedDeviceStore) Delete(userID, deviceID string) error {
+	res := t.s.db.Where("user_id = ? AND device_id = ?", userID, deviceID).Delete(&trustedDeviceModel{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return trusteddevice.ErrDeviceNotFound
+	}
+	return nil
+}
+
+// DeleteByUser removes every device of the user.
+func (t trustedDeviceStore) DeleteByUser(userID string) error {
+	return t.s.db.Where("user_id = ?", userID).Delete(&trustedDeviceModel{}).Error
+}
+
+// Touch updates the device's last-used timestamp.
+func (t trustedDeviceStore) Touch(deviceID string, at time.Time) error {
+	res := t.s.db.Model(&trustedDeviceModel{}).Where("device_id = ?", deviceID).
+		Update("last_used_at", at)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return trusteddevice.ErrDeviceNotFound
+	}
+	return nil
+}
+
+func toDevice(m trustedDeviceModel) trusteddevice.Device {
+	return trusteddevice.Device{
+		ID:         m.DeviceID,
+		UserID:     m.UserID,
+		Name:       m.Name,
+		SecretHash: m.SecretHash,
+		ExpiresAt:  m.ExpiresAt,
+		LastUsedAt: m.LastUsedAt,
+		CreatedAt:  m.CreatedAt,
+	}
+}
@@ -11,7 +11,8 @@ import (
 	"gorm.io/gorm"
 )
 
-// User is the input struct for CreateUser (login ID and optional email fields).
+// User is the input struct for CreateUser (login ID and optional email and
+// profile fields).
 type User struct {
 	Name                 string `yaml:"name"`
 	LoginID              string `yaml:"login_id"` // unique login identifier (required)
@@ -25,6 +26,26 @@ type User struct {
 	// Groups are the initial group memberships (optional). Group names are
 	// opaque to the library; see userauth.GroupsGetter.
 	Groups []string `yaml:"groups"`
+	// InvitedBy is the user ID of the user whose referral invite created
+	// this account (optional); see InvitedBy.
+	InvitedBy string `yaml:"invited_by"`
+	// Locale, Timezone, AvatarURL and Attributes complete the profile with
+	// Name; see userauth.Profile. They are validated like in SetProfile.
+	Locale     string            `yaml:"locale"`
+	Timezone   string            `yaml:"timezone"`
+	AvatarURL  string            `yaml:"avatar_url"`
+	Attributes map[string]string `yaml:"attributes"`
+}
+
+// profile returns the profile part of usr.
+func (usr User) profile() userauth.Profile {
+	return userauth.Profile{
+		Name:       usr.Name,
+		Locale:     usr.Locale,
+		Timezone:   usr.Timezone,
+		AvatarURL:  usr.AvatarURL,
+		Attributes: usr.Attributes,
+	}
 }
 
 func (s Store) Create(id string, pw string) error {
@@ -57,6 +78,13 @@ func (s Store) createUser(db *gorm.DB, usr User) error {
 	if usr.Pw == "" {
 		return errors.New("password cannot be empty")
 	}
+	if err := userauth.ValidateProfile(usr.profile()); err != nil {
+		return err
+	}
+	attributes, err := encodeAttributes(usr.Attributes)
+	if err != nil {
+		return err
+	}
 
 	pw := usr.Pw
 	if usr.PwIsHashed {
@@ -86,6 +114,11 @@ func (s Store) createUser(db *gorm.DB, usr User) error {
 		PrimaryEmailVerified: usr.PrimaryEmailVerified,
 		BackupEmail:          usr.BackupEmail,
 		BackupEmailVerified:  usr.BackupEmailVerified,
+		InvitedBy:            usr.InvitedBy,
+		Locale:               usr.Locale,
+		Timezone:             usr.Timezone,
+		AvatarURL:            usr.AvatarURL,
+		Attributes:           attributes,
 	}
 
 	if err := db.Create(&usrModel).Error; err != nil {
@@ -142,6 +175,18 @@ func (s Store) getUser(query string, arg string) (userauth.User, error) {
 	return m.toUser(), nil
 }
 
+// InvitedBy returns the user ID of the user whose referral invite created
+// the account, empty when it was not referred. Returns
+// userauth.ErrUserNotFound if the user does not exist.
+func (s Store) InvitedBy(userID string) (string, error) {
+	var m userModel
+	err := s.db.Select("invited_by").First(&m, "uuid = ?", userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", userauth.ErrUserNotFound
+	}
+	return m.InvitedBy, err
+}
+
 // Count returns the total number of users in the store.
 func (s Store) Count() (int64, error) {
 	var total int64
@@ -158,7 +203,8 @@ func (s Store) IsEmpty() (bool, error) {
 
 // Delete permanently removes a user and all associated data (group
 // memberships, TOTP config, recovery codes, verification codes, second-factor
-// flags, pending email changes, personal access tokens), so the login ID can be reused.
+// flags, pending email changes, personal access tokens, trusted devices), so
+// the login ID can be reused.
 // Returns userauth.ErrUserNotFound if the user does not exist.
 func (s Store) Delete(userID string) error {
 	return s.db.Transaction(func(tx *gorm.DB) error {
@@ -172,6 +218,7 @@ func (s Store) Delete(userID string) error {
 		for _, m := range []interface{}{
 			&groupModel{}, &totpModel{}, &recoveryCodeModel{}, &emailVerificationCodeModel{},
 			&smsVerificationCodeModel{}, &secondFactorFlagsModel{}, &pendingEmailChangeModel{}, &patModel{},
+			&trustedDeviceModel{},
 		} {
 			if err := tx.Where("user_id = ?", userID).Delete(m).Error; err != nil {
 				return err
@@ -181,55 +228,6 @@ func (s Store) Delete(userID string) error {
 	})
 }
 
-const (
-	defaultListLimit = 50
-	maxListLimit     = 200
-)
-
-// ListOpts controls pagination for List.
-type ListOpts struct {
-	Limit  int // max rows to return; <=0 uses defaultListLimit, capped at maxListLimit
-	Offset int // rows to skip; <0 is treated as 0
-}
-
-// ListResult is a page of users plus the total count.
-type ListResult struct {
-	Users []userauth.User // page of users, ordered by login_id ASC
-	Total int             // total number of users, ignoring Limit/Offset
-}
-
-// List returns a page of users ordered by login ID, plus the total user count
-// so callers can render "page X of Y".
-func (s Store) List(opts ListOpts) (ListResult, error) {
-	limit := opts.Limit
-	if limit <= 0 {
-		limit = defaultListLimit
-	}
-	if limit > maxListLimit {
-		limit = maxListLimit
-	}
-	offset := opts.Offset
-	if offset < 0 {
-		offset = 0
-	}
-
-	var total int64
-	if err := s.db.Model(&userModel{}).Count(&total).Error; err != nil {
-		return ListResult{}, err
-	}
-
-	var rows []userModel
-	if err := s.db.Order("login_id ASC").Limit(limit).Offset(offset).Find(&rows).Error; err != nil {
-		return ListResult{}, err
-	}
-
-	users := make([]userauth.User, 0, len(rows))
-	for _, m := range rows {
-		users = append(users, m.toUser())
-	}
-	return ListResult{Users: users, Total: int(total)}, nil
-}
-
 // SetLoginID changes the login identifier for a user. The canonical identity
 // (UUID) is untouched, so sessions, 2FA enrolments and satellite data survive
 // the rename. The new login ID must satisfy the store's username format and
@@ -1,8 +1,10 @@
 package userdb
 
 import (
+	"errors"
 	"testing"
 
+	"github.com/go-bumbu/userauth"
 	"github.com/go-bumbu/userauth/internal/hashutil"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -42,6 +44,36 @@ func TestCreateUser(t *testing.T) {
 	}
 }
 
+func TestInvitedBy(t *testing.T) {
+	mng := setup(t)
+	defer clean()
+
+	for _, usr := range []User{
+		{LoginID: "alice", Pw: "1234"},
+		{LoginID: "bob", Pw: "1234", InvitedBy: "uuid-of-alice"},
+	} {
+		if err := mng.CreateUser(usr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for login, want := range map[string]string{"alice": "", "bob": "uuid-of-alice"} {
+		u, err := mng.GetUserByLogin(login)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := mng.InvitedBy(u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("InvitedBy(%s) = %q, want %q", login, got, want)
+		}
+	}
+	if _, err := mng.InvitedBy("does-not-exist"); !errors.Is(err, userauth.ErrUserNotFound) {
+		t.Errorf("want ErrUserNotFound, got %v", err)
+	}
+}
+
 func TestLogin(t *testing.T) {
 	mng := setup(t)
 	defer clean()